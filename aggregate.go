@@ -0,0 +1,729 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// Aggregation represents a function which reduces a set of values into a single value.
+type Aggregation uint8
+
+// Various supported aggregation functions
+const (
+	AggCount Aggregation = iota // The number of values
+	AggSum                      // The sum of the values
+	AggAvg                      // The arithmetic mean of the values
+	AggMin                      // The smallest value
+	AggMax                      // The largest value
+	AggFirst                    // The first value, in order
+	AggLast                     // The last value, in order
+)
+
+// accumulator accumulates values for computing an aggregation
+type accumulator struct {
+	count       int     // The number of values
+	sum         float64 // The sum of the values
+	min, max    float64 // The smallest and largest values
+	first, last float64 // The first and last values, in order
+	lo, hi      int64   // The order of the first and last values
+}
+
+// add adds a value along with its order into the accumulator
+func (a *accumulator) add(value float64, order int64) {
+	if a.count == 0 {
+		a.min, a.max = value, value
+		a.first, a.last = value, value
+		a.lo, a.hi = order, order
+	}
+
+	a.count++
+	a.sum += value
+	switch {
+	case value < a.min:
+		a.min = value
+	case value > a.max:
+		a.max = value
+	}
+
+	if order < a.lo {
+		a.first, a.lo = value, order
+	}
+	if order >= a.hi {
+		a.last, a.hi = value, order
+	}
+}
+
+// merge merges the values of another accumulator into this one
+func (a *accumulator) merge(other accumulator) {
+	switch {
+	case other.count == 0:
+		return
+	case a.count == 0:
+		*a = other
+		return
+	}
+
+	a.count += other.count
+	a.sum += other.sum
+	if other.min < a.min {
+		a.min = other.min
+	}
+	if other.max > a.max {
+		a.max = other.max
+	}
+	if other.lo < a.lo {
+		a.first, a.lo = other.first, other.lo
+	}
+	if other.hi >= a.hi {
+		a.last, a.hi = other.last, other.hi
+	}
+}
+
+// result computes the result of the aggregation
+func (a *accumulator) result(agg Aggregation) float64 {
+	switch {
+	case agg == AggCount:
+		return float64(a.count)
+	case a.count == 0:
+		return 0
+	}
+
+	switch agg {
+	case AggSum:
+		return a.sum
+	case AggAvg:
+		return a.sum / float64(a.count)
+	case AggMin:
+		return a.min
+	case AggMax:
+		return a.max
+	case AggFirst:
+		return a.first
+	default:
+		return a.last
+	}
+}
+
+// numericOf loads a numeric column for the transaction
+func numericOf(txn *Txn, columnName string) (Numeric, error) {
+	column, ok := txn.columnAt(columnName)
+	if !ok {
+		return nil, fmt.Errorf("column: column '%s' does not exist", columnName)
+	}
+
+	numeric, ok := column.Column.(Numeric)
+	if !ok {
+		return nil, fmt.Errorf("column: column '%s' is not numeric", columnName)
+	}
+	return numeric, nil
+}
+
+// --------------------------- Downsample ----------------------------
+
+// Sample represents an aggregated value of a single time bucket.
+type Sample struct {
+	Time  int64   // The start of the bucket
+	Value float64 // The aggregated value
+	Count int     // The number of values in the bucket
+}
+
+// Downsample groups the rows of the current selection into buckets of the specified width
+// based on the numeric time column, and aggregates the values of the numeric value column
+// for each bucket. The width must be in the same unit as the time column, for example a
+// time.Duration for unix nanoseconds. The first and last aggregations are based on the
+// time of the rows. The resulting series is ordered by time and omits empty buckets.
+func (txn *Txn) Downsample(timeColumn, valueColumn string, bucket int64, agg Aggregation) ([]Sample, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("column: downsample bucket must be positive")
+	}
+
+	times, err := numericOf(txn, timeColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := numericOf(txn, valueColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Accumulate the values for each bucket
+	buckets := make(map[int64]*accumulator, 64)
+	txn.initialize()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		offset := chunk.Min()
+		index.Range(func(x uint32) {
+			ts, ok1 := times.LoadInt64(offset + x)
+			v, ok2 := values.LoadFloat64(offset + x)
+			if !ok1 || !ok2 {
+				return
+			}
+
+			// Floor the time to the start of the bucket
+			at := ts - ts%bucket
+			if ts < 0 && ts%bucket != 0 {
+				at -= bucket
+			}
+
+			acc, ok := buckets[at]
+			if !ok {
+				acc = new(accumulator)
+				buckets[at] = acc
+			}
+			acc.add(v, ts)
+		})
+	})
+
+	// Produce the series, ordered by time
+	series := make([]Sample, 0, len(buckets))
+	for at, acc := range buckets {
+		series = append(series, Sample{
+			Time:  at,
+			Value: acc.result(agg),
+			Count: acc.count,
+		})
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Time < series[j].Time
+	})
+	return series, nil
+}
+
+// --------------------------- Pivot ----------------------------
+
+// PivotTable represents a two-dimensional aggregation table, where each cell contains the
+// aggregated value for a pair of row and column labels.
+type PivotTable struct {
+	Rows    []string    // The sorted labels of the rows
+	Columns []string    // The sorted labels of the columns
+	Values  [][]float64 // The aggregated values, indexed by row and column
+	Counts  [][]int     // The number of values aggregated, indexed by row and column
+}
+
+// Value returns the aggregated value for a pair of row and column labels, if present.
+func (p *PivotTable) Value(row, column string) (float64, bool) {
+	i := sort.SearchStrings(p.Rows, row)
+	j := sort.SearchStrings(p.Columns, column)
+	if i >= len(p.Rows) || p.Rows[i] != row || j >= len(p.Columns) || p.Columns[j] != column {
+		return 0, false
+	}
+
+	return p.Values[i][j], p.Counts[i][j] > 0
+}
+
+// Pivot groups the rows of the current selection by the values of the row and column (e.g.
+// race and class), and aggregates the values of the numeric value column for each pair, for
+// example to compute the average balance by race and class. The values of the row and column
+// are converted into their string representation to be used as labels, after being masked if
+// their columns are masked. The first and last aggregations are based on the order of the rows
+// in the collection.
+func (txn *Txn) Pivot(rowColumn, colColumn, valueColumn string, agg Aggregation) (*PivotTable, error) {
+	rows, ok := txn.columnAt(rowColumn)
+	if !ok {
+		return nil, fmt.Errorf("column: column '%s' does not exist", rowColumn)
+	}
+
+	cols, ok := txn.columnAt(colColumn)
+	if !ok {
+		return nil, fmt.Errorf("column: column '%s' does not exist", colColumn)
+	}
+
+	values, err := numericOf(txn, valueColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Accumulate the values for each cell
+	rowMask, colMask := txn.maskOf(rowColumn), txn.maskOf(colColumn)
+	type cell struct{ row, col string }
+	cells := make(map[cell]*accumulator, 64)
+	txn.initialize()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		offset := chunk.Min()
+		index.Range(func(x uint32) {
+			r, ok1 := rows.Value(offset + x)
+			c, ok2 := cols.Value(offset + x)
+			v, ok3 := values.LoadFloat64(offset + x)
+			if !ok1 || !ok2 || !ok3 {
+				return
+			}
+
+			if rowMask != nil {
+				r = rowMask(r)
+			}
+			if colMask != nil {
+				c = colMask(c)
+			}
+
+			key := cell{row: fmt.Sprint(r), col: fmt.Sprint(c)}
+			acc, ok := cells[key]
+			if !ok {
+				acc = new(accumulator)
+				cells[key] = acc
+			}
+			acc.add(v, int64(offset+x))
+		})
+	})
+
+	// Collect the sorted labels
+	rowAt, colAt := make(map[string]int), make(map[string]int)
+	table := new(PivotTable)
+	for key := range cells {
+		if _, ok := rowAt[key.row]; !ok {
+			rowAt[key.row] = 0
+			table.Rows = append(table.Rows, key.row)
+		}
+		if _, ok := colAt[key.col]; !ok {
+			colAt[key.col] = 0
+			table.Columns = append(table.Columns, key.col)
+		}
+	}
+
+	sort.Strings(table.Rows)
+	sort.Strings(table.Columns)
+	for i, v := range table.Rows {
+		rowAt[v] = i
+	}
+	for i, v := range table.Columns {
+		colAt[v] = i
+	}
+
+	// Fill the table with the aggregated values
+	table.Values = make([][]float64, len(table.Rows))
+	table.Counts = make([][]int, len(table.Rows))
+	for i := range table.Rows {
+		table.Values[i] = make([]float64, len(table.Columns))
+		table.Counts[i] = make([]int, len(table.Columns))
+	}
+
+	for key, acc := range cells {
+		i, j := rowAt[key.row], colAt[key.col]
+		table.Values[i][j] = acc.result(agg)
+		table.Counts[i][j] = acc.count
+	}
+	return table, nil
+}
+
+// --------------------------- Multiple Aggregates ----------------------------
+
+// Aggregate computes several aggregates during a single scan of the current selection, instead
+// of scanning the selection once per aggregate, and returns their values in the same order. Each
+// numeric column is only loaded once per row, even if several aggregates refer to it, and the
+// filtered aggregates such as SumWhere() only accumulate the rows of the selection which match
+// their filter. The first and last aggregations are based on the order of the rows.
+func (txn *Txn) Aggregate(aggs ...Aggregate) ([]float64, error) {
+	type slot struct {
+		column int          // The offset of the numeric column
+		where  *derivedExpr // The filter of the values, if any
+		acc    accumulator  // The accumulated values
+	}
+
+	columns := make([]Numeric, 0, len(aggs))
+	offsets := make(map[string]int, len(aggs))
+	shared := make(map[string]int, len(aggs))
+	slots := make([]slot, 0, len(aggs))
+	slotOf := make([]int, 0, len(aggs))
+	for _, agg := range aggs {
+		if _, ok := offsets[agg.Column]; !ok {
+			numeric, err := numericOf(txn, agg.Column)
+			if err != nil {
+				return nil, err
+			}
+
+			offsets[agg.Column] = len(columns)
+			columns = append(columns, numeric)
+		}
+
+		// The unfiltered aggregates of a column share the same accumulator
+		if agg.Where == nil {
+			if at, ok := shared[agg.Column]; ok {
+				slotOf = append(slotOf, at)
+				continue
+			}
+			shared[agg.Column] = len(slots)
+			slotOf = append(slotOf, len(slots))
+			slots = append(slots, slot{column: offsets[agg.Column]})
+			continue
+		}
+
+		where, err := agg.Where.bind(txn)
+		if err != nil {
+			return nil, err
+		}
+
+		slotOf = append(slotOf, len(slots))
+		slots = append(slots, slot{column: offsets[agg.Column], where: &where})
+	}
+
+	// Accumulate the values of every column in a single pass
+	values := make([]float64, len(columns))
+	loaded := make([]bool, len(columns))
+	txn.initialize()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		offset := chunk.Min()
+		index.Range(func(x uint32) {
+			idx := offset + x
+			for i, column := range columns {
+				values[i], loaded[i] = column.LoadFloat64(idx)
+			}
+
+			for i := range slots {
+				s := &slots[i]
+				if loaded[s.column] && (s.where == nil || s.where.eval(idx)) {
+					s.acc.add(values[s.column], int64(idx))
+				}
+			}
+		})
+	})
+
+	results := make([]float64, 0, len(aggs))
+	for i, agg := range aggs {
+		results = append(results, slots[slotOf[i]].acc.result(agg.Func))
+	}
+	return results, nil
+}
+
+// bind resolves the columns of a filter expression for the transaction. Unlike the derived
+// indexes, any column can be used as an operand, matching the rows where it has a value, or
+// the rows where it is set for the boolean columns and the indexes.
+func (e IndexExpr) bind(txn *Txn) (derivedExpr, error) {
+	if e.err != nil {
+		return derivedExpr{}, e.err
+	}
+
+	switch e.op {
+	case opIndex:
+		column, ok := txn.columnAt(e.name)
+		if !ok {
+			return derivedExpr{}, fmt.Errorf("column: column '%s' does not exist", e.name)
+		}
+		return derivedExpr{op: opIndex, index: column.Column}, nil
+	case opNot:
+		if len(e.operands) != 1 {
+			return derivedExpr{}, fmt.Errorf("column: filter 'not' requires exactly one operand")
+		}
+	default:
+		if len(e.operands) == 0 {
+			return derivedExpr{}, fmt.Errorf("column: filter requires at least one operand")
+		}
+	}
+
+	out := derivedExpr{op: e.op, operands: make([]derivedExpr, 0, len(e.operands))}
+	for _, operand := range e.operands {
+		expr, err := operand.bind(txn)
+		if err != nil {
+			return derivedExpr{}, err
+		}
+		out.operands = append(out.operands, expr)
+	}
+	return out, nil
+}
+
+// --------------------------- Incremental ----------------------------
+
+// Aggregate represents an aggregation function over a numeric column, which can be
+// registered on a collection to be maintained incrementally.
+type Aggregate struct {
+	Func   Aggregation // The aggregation function
+	Column string      // The name of the numeric column
+	Where  *IndexExpr  // The filter of the aggregated rows, only supported by Txn.Aggregate()
+}
+
+// Count creates an aggregate which counts the values of a numeric column.
+func Count(columnName string) Aggregate {
+	return Aggregate{Func: AggCount, Column: columnName}
+}
+
+// Sum creates an aggregate which sums the values of a numeric column.
+func Sum(columnName string) Aggregate {
+	return Aggregate{Func: AggSum, Column: columnName}
+}
+
+// Avg creates an aggregate which computes the arithmetic mean of a numeric column.
+func Avg(columnName string) Aggregate {
+	return Aggregate{Func: AggAvg, Column: columnName}
+}
+
+// Min creates an aggregate which finds the smallest value of a numeric column.
+func Min(columnName string) Aggregate {
+	return Aggregate{Func: AggMin, Column: columnName}
+}
+
+// Max creates an aggregate which finds the largest value of a numeric column.
+func Max(columnName string) Aggregate {
+	return Aggregate{Func: AggMax, Column: columnName}
+}
+
+// CountWhere creates an aggregate which counts the values of a numeric column, for the rows
+// matching the filter, for example With("active").
+func CountWhere(columnName string, where IndexExpr) Aggregate {
+	return Aggregate{Func: AggCount, Column: columnName, Where: &where}
+}
+
+// SumWhere creates an aggregate which sums the values of a numeric column, for the rows
+// matching the filter, for example With("active").
+func SumWhere(columnName string, where IndexExpr) Aggregate {
+	return Aggregate{Func: AggSum, Column: columnName, Where: &where}
+}
+
+// AvgWhere creates an aggregate which computes the arithmetic mean of a numeric column, for
+// the rows matching the filter, for example With("active").
+func AvgWhere(columnName string, where IndexExpr) Aggregate {
+	return Aggregate{Func: AggAvg, Column: columnName, Where: &where}
+}
+
+// MinWhere creates an aggregate which finds the smallest value of a numeric column, for the
+// rows matching the filter, for example With("active").
+func MinWhere(columnName string, where IndexExpr) Aggregate {
+	return Aggregate{Func: AggMin, Column: columnName, Where: &where}
+}
+
+// MaxWhere creates an aggregate which finds the largest value of a numeric column, for the
+// rows matching the filter, for example With("active").
+func MaxWhere(columnName string, where IndexExpr) Aggregate {
+	return Aggregate{Func: AggMax, Column: columnName, Where: &where}
+}
+
+// RegisterAggregate registers an aggregate with a specified name, which is then maintained
+// incrementally as the commits are applied to the collection and can be read in constant
+// time using Aggregate(). The aggregate is computed over all of the rows of the collection.
+func (c *Collection) RegisterAggregate(aggregateName string, agg Aggregate) error {
+	switch agg.Func {
+	case AggCount, AggSum, AggAvg, AggMin, AggMax:
+	default:
+		return fmt.Errorf("column: unable to register aggregate '%s', unsupported function", aggregateName)
+	}
+
+	if agg.Where != nil {
+		return fmt.Errorf("column: unable to register aggregate '%s', filtered aggregates are not supported", aggregateName)
+	}
+
+	// Prior to creating an aggregate, we should have a numeric column
+	column, ok := c.cols.Load(agg.Column)
+	if !ok {
+		return fmt.Errorf("column: unable to register aggregate, column '%v' does not exist", agg.Column)
+	}
+
+	source, ok := column.Column.(Numeric)
+	if !ok {
+		return fmt.Errorf("column: unable to register aggregate, column '%v' is not numeric", agg.Column)
+	}
+
+	if _, ok := c.cols.Load(aggregateName); ok {
+		return fmt.Errorf("column: unable to register aggregate '%s', already exists", aggregateName)
+	}
+
+	// Create and add the aggregate column
+	aggregate := columnFor(aggregateName, &columnAggregate{
+		name:   agg.Column,
+		fn:     agg.Func,
+		source: source,
+	})
+
+	c.lock.Lock()
+	c.cols.Store(aggregateName, aggregate)
+	c.cols.Store(agg.Column, column, aggregate)
+	c.lock.Unlock()
+
+	// Iterate over all of the values of the target column, chunk by chunk and fill
+	// the aggregate accordingly.
+	chunks := c.chunks()
+	buffer := commit.NewBuffer(c.Count())
+	reader := commit.NewReader()
+	for chunk := commit.Chunk(0); int(chunk) < chunks; chunk++ {
+		if column.Snapshot(chunk, buffer) {
+			reader.Seek(buffer)
+			aggregate.Apply(chunk, reader)
+		}
+	}
+
+	return nil
+}
+
+// DropAggregate removes the aggregate with the specified name.
+func (c *Collection) DropAggregate(aggregateName string) error {
+	column, exists := c.cols.Load(aggregateName)
+	if !exists {
+		return fmt.Errorf("column: unable to drop aggregate, aggregate '%v' does not exist", aggregateName)
+	}
+
+	if _, ok := column.Column.(*columnAggregate); !ok {
+		return fmt.Errorf("column: unable to drop aggregate, '%v' is not an aggregate", aggregateName)
+	}
+
+	// Figure out the associated column and delete the aggregate from that
+	columnName := column.Column.(computed).Column()
+	c.cols.DeleteIndex(columnName, aggregateName)
+	c.cols.DeleteColumn(aggregateName)
+	return nil
+}
+
+// Aggregate returns the current value of a registered aggregate. It returns false if the
+// aggregate does not exist, or if there are no values to aggregate (except for the count).
+func (c *Collection) Aggregate(aggregateName string) (float64, bool) {
+	column, exists := c.cols.Load(aggregateName)
+	if !exists {
+		return 0, false
+	}
+
+	aggregate, ok := column.Column.(*columnAggregate)
+	if !ok {
+		return 0, false
+	}
+
+	return aggregate.result()
+}
+
+// columnAggregate represents a computed column which incrementally maintains an aggregate
+type columnAggregate struct {
+	lock     sync.Mutex    // The mutex to guard the state
+	name     string        // The name of the target column
+	fn       Aggregation   // The aggregation function
+	source   Numeric       // The source column to read the values from
+	fill     bitmap.Bitmap // The rows which contribute to the aggregate
+	values   []float64     // The contribution of each row
+	count    int           // The number of values
+	sum      float64       // The sum of the values
+	min, max float64       // The smallest and largest values
+	stale    bool          // Whether the min and max need to be recomputed
+}
+
+// Column returns the target name of the column on which this aggregate should apply.
+func (c *columnAggregate) Column() string {
+	return c.name
+}
+
+// Grow grows the size of the column until we have enough to store
+func (c *columnAggregate) Grow(idx uint32) {
+	// Noop, grows on demand
+}
+
+// Apply applies a set of operations to the column. Since the operations are already
+// applied to the source column, the final values are loaded from it.
+func (c *columnAggregate) Apply(chunk commit.Chunk, r *commit.Reader) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for r.Next() {
+		idx := r.Index()
+		switch r.Type {
+		case commit.Put:
+			if v, ok := c.source.LoadFloat64(idx); ok {
+				c.remove(idx)
+				c.add(idx, v)
+			}
+		case commit.Delete:
+			c.remove(idx)
+		}
+	}
+}
+
+// add adds the contribution of a row
+func (c *columnAggregate) add(idx uint32, value float64) {
+	for uint32(len(c.values)) <= idx {
+		c.values = append(c.values, 0)
+	}
+
+	if c.count == 0 || value < c.min {
+		c.min = value
+	}
+	if c.count == 0 || value > c.max {
+		c.max = value
+	}
+
+	c.fill.Set(idx)
+	c.values[idx] = value
+	c.count++
+	c.sum += value
+}
+
+// remove removes the contribution of a row, if any
+func (c *columnAggregate) remove(idx uint32) {
+	if !c.fill.Contains(idx) {
+		return
+	}
+
+	value := c.values[idx]
+	c.fill.Remove(idx)
+	c.count--
+	c.sum -= value
+	if value == c.min || value == c.max {
+		c.stale = true
+	}
+}
+
+// result computes the current value of the aggregate
+func (c *columnAggregate) result() (float64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch {
+	case c.fn == AggCount:
+		return float64(c.count), true
+	case c.count == 0:
+		return 0, false
+	case c.fn == AggSum:
+		return c.sum, true
+	case c.fn == AggAvg:
+		return c.sum / float64(c.count), true
+	}
+
+	// Recompute the extremes only when a previous one was removed
+	if c.stale {
+		first := true
+		c.fill.Range(func(idx uint32) {
+			if v := c.values[idx]; first || v < c.min {
+				c.min = v
+			}
+			if v := c.values[idx]; first || v > c.max {
+				c.max = v
+			}
+			first = false
+		})
+		c.stale = false
+	}
+
+	if c.fn == AggMin {
+		return c.min, true
+	}
+	return c.max, true
+}
+
+// accumulate merges the current state of the aggregate into the accumulator
+func (c *columnAggregate) accumulate(dst *accumulator) {
+	c.result() // Recompute the extremes, if required
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.count > 0 {
+		dst.merge(accumulator{count: c.count, sum: c.sum, min: c.min, max: c.max})
+	}
+}
+
+// Value retrieves a value at a specified index.
+func (c *columnAggregate) Value(idx uint32) (v any, ok bool) {
+	return nil, false
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *columnAggregate) Contains(idx uint32) bool {
+	return false
+}
+
+// Index returns the fill list for the column
+func (c *columnAggregate) Index(chunk commit.Chunk) bitmap.Bitmap {
+	return nil
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *columnAggregate) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	// Noop
+}
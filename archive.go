@@ -0,0 +1,92 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+)
+
+// ArchiveWhere moves the rows selected by the predicate into the sink and deletes them, for
+// example to implement a tiering of the hot and the cold rows. The rows are exported with the
+// values of all of their columns, including the masked ones, and they are only deleted if the
+// sink accepted every batch, otherwise the deletion is rolled back. Since the sink may have
+// received some of the batches by then, it should discard them or be idempotent. The query
+// holds the read locks of every chunk until it completes, so the archived rows reflect a single
+// state of the collection. It returns the number of archived rows.
+func (c *Collection) ArchiveWhere(predicate func(txn *Txn) *Txn, sink Exporter) (archived int, err error) {
+	if predicate == nil || sink == nil {
+		return 0, fmt.Errorf("column: unable to archive, predicate and sink must be specified")
+	}
+
+	err = c.QueryWith(ReadSnapshot, func(txn *Txn) error {
+		txn = predicate(txn)
+		if err := txn.export(sink, defaultExportBatch, false, nil); err != nil {
+			return err
+		}
+
+		archived = txn.Count()
+		txn.DeleteAll()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return archived, nil
+}
+
+// --------------------------- Collection Sink ----------------------------
+
+// CollectionExporter represents an exporter which inserts the exported rows into another
+// collection, each batch within a single transaction. If the collection has a primary key,
+// the exported rows must contain its column and are inserted with their key.
+type CollectionExporter struct {
+	dst *Collection
+}
+
+// NewCollectionExporter creates a new exporter which inserts the rows into the collection,
+// which must have every exported column.
+func NewCollectionExporter(dst *Collection) *CollectionExporter {
+	return &CollectionExporter{dst: dst}
+}
+
+// WriteBatch inserts the rows of the batch into the collection
+func (e *CollectionExporter) WriteBatch(batch *ExportBatch) error {
+	key := -1
+	for i, column := range batch.Columns {
+		if _, ok := e.dst.cols.Load(column.Name); !ok {
+			return fmt.Errorf("column: unable to insert, column '%s' does not exist", column.Name)
+		}
+		if e.dst.pk != nil && column.Name == e.dst.pk.name {
+			key = i
+		}
+	}
+
+	if e.dst.pk != nil && key < 0 {
+		return fmt.Errorf("column: unable to insert, key column '%s' was not exported", e.dst.pk.name)
+	}
+
+	return e.dst.Query(func(txn *Txn) error {
+		for row := 0; row < batch.Rows; row++ {
+			insert := func(r Row) error {
+				for i, column := range batch.Columns {
+					if value := column.Values[row]; value != nil && i != key {
+						r.SetAny(column.Name, value)
+					}
+				}
+				return nil
+			}
+
+			var err error
+			if key >= 0 {
+				err = txn.InsertKey(fmt.Sprint(batch.Columns[key].Values[row]), insert)
+			} else {
+				_, err = txn.Insert(insert)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newArchiveCollection() *Collection {
+	c := NewCollection()
+	c.CreateColumn("id", ForKey())
+	c.CreateColumn("email", ForString(WithMask[string](func(v any) any { return "***" })))
+	c.CreateColumn("age", ForInt())
+	return c
+}
+
+func TestArchiveWhere(t *testing.T) {
+	hot, cold := newArchiveCollection(), newArchiveCollection()
+	defer hot.Close()
+	defer cold.Close()
+
+	for i := 0; i < 20000; i++ {
+		assert.NoError(t, hot.InsertKey(fmt.Sprint(i), func(r Row) error {
+			r.SetString("email", fmt.Sprintf("%d@example.com", i))
+			r.SetInt("age", i%100)
+			return nil
+		}))
+	}
+
+	// Move the old rows into the cold collection
+	archived, err := hot.ArchiveWhere(func(txn *Txn) *Txn {
+		return txn.WithInt("age", func(v int64) bool { return v >= 90 })
+	}, NewCollectionExporter(cold))
+	assert.NoError(t, err)
+	assert.Equal(t, 2000, archived)
+	assert.Equal(t, 18000, hot.Count())
+	assert.Equal(t, 2000, cold.Count())
+
+	// The values are archived along with their key, without being masked
+	assert.NoError(t, cold.QueryKey("199", func(r Row) error {
+		column, _ := cold.cols.Load("email")
+		email, _ := column.Value(r.Index())
+		age, _ := r.Int("age")
+		assert.Equal(t, "199@example.com", email)
+		assert.Equal(t, 99, age)
+		return nil
+	}))
+	assert.Error(t, hot.QueryKey("199", func(r Row) error { return nil }))
+}
+
+func TestArchiveWhereFailed(t *testing.T) {
+	hot := newArchiveCollection()
+	defer hot.Close()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, hot.InsertKey(fmt.Sprint(i), func(r Row) error {
+			r.SetInt("age", i)
+			return nil
+		}))
+	}
+
+	_, err := hot.ArchiveWhere(nil, nil)
+	assert.Error(t, err)
+
+	// The rows are kept if the sink fails
+	_, err = hot.ArchiveWhere(func(txn *Txn) *Txn {
+		return txn
+	}, ExportFunc(func(batch *ExportBatch) error {
+		return fmt.Errorf("unavailable")
+	}))
+	assert.Error(t, err)
+	assert.Equal(t, 10, hot.Count())
+
+	// The destination must have every column, as well as the key
+	other := NewCollection()
+	other.CreateColumn("age", ForInt())
+	_, err = hot.ArchiveWhere(func(txn *Txn) *Txn { return txn }, NewCollectionExporter(other))
+	assert.Error(t, err)
+
+	keyed := NewCollection()
+	keyed.CreateColumn("key", ForKey())
+	keyed.CreateColumn("age", ForInt())
+	err = NewCollectionExporter(keyed).WriteBatch(&ExportBatch{
+		Columns: []ExportColumn{{Name: "age"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 10, hot.Count())
+
+	// Without a key, the rows are simply inserted
+	archived, err := hot.ArchiveWhere(func(txn *Txn) *Txn {
+		return txn.WithInt("age", func(v int64) bool { return v < 5 })
+	}, ExportFunc(func(batch *ExportBatch) error {
+		plain := NewCollection()
+		plain.CreateColumn("id", ForString())
+		plain.CreateColumn("email", ForString())
+		plain.CreateColumn("age", ForInt())
+		if err := NewCollectionExporter(plain).WriteBatch(batch); err != nil {
+			return err
+		}
+		assert.Equal(t, 5, plain.Count())
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, archived)
+	assert.Equal(t, 5, hot.Count())
+}
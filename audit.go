@@ -0,0 +1,232 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kelindar/column/commit"
+)
+
+// AuditSink represents a sink which receives the audit records of a collection, for example
+// to store them for compliance. It is called synchronously after every transaction which
+// changed the collection, with one record per commit, hence it should return quickly.
+type AuditSink interface {
+	OnAudit(record AuditRecord)
+}
+
+// AuditRecord represents the audit record of a single commit, listing the rows it changed
+// along with their values before and after the commit. The values of the masked columns are
+// always masked.
+type AuditRecord struct {
+	Actor  string     // The actor of the transaction, as specified with QueryAs()
+	Commit uint64     // The ID of the commit
+	Time   time.Time  // The time of the commit
+	Rows   []AuditRow // The rows changed by the commit, in the order of their indexes
+}
+
+// AuditRow represents the changes of a single row within a commit
+type AuditRow struct {
+	Index    uint32      // The index of the row
+	Inserted bool        // Whether the row was inserted
+	Deleted  bool        // Whether the row was deleted
+	Values   []ValueDiff // The values which changed, in the order in which they were written
+}
+
+// QueryAs creates a transaction similarly to Query(), on behalf of the specified actor. The
+// actor is reported in the audit records of the commits of the transaction.
+func (c *Collection) QueryAs(actor string, fn func(txn *Txn) error) error {
+	return c.Query(func(txn *Txn) error {
+		txn.actor = actor
+		return fn(txn)
+	})
+}
+
+// --------------------------- Audit Log ----------------------------
+
+// AuditLog represents an audit sink which keeps the most recent audit records in memory
+type AuditLog struct {
+	lock    sync.Mutex
+	size    int           // The maximum number of records
+	records []AuditRecord // The records, oldest first
+}
+
+// NewAuditLog creates a new audit log which keeps up to the specified number of records
+func NewAuditLog(size int) *AuditLog {
+	return &AuditLog{
+		size:    size,
+		records: make([]AuditRecord, 0, size),
+	}
+}
+
+// OnAudit stores an audit record, dropping the oldest one if the log is full
+func (l *AuditLog) OnAudit(record AuditRecord) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.records) >= l.size && l.size > 0 {
+		copy(l.records, l.records[1:])
+		l.records = l.records[:len(l.records)-1]
+	}
+	l.records = append(l.records, record)
+}
+
+// Records returns a copy of the audit records, oldest first
+func (l *AuditLog) Records() []AuditRecord {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]AuditRecord(nil), l.records...)
+}
+
+// --------------------------- Audit Trail ----------------------------
+
+// auditTrail represents the audit records of a transaction, which are collected while the
+// chunks are being committed, possibly in parallel.
+type auditTrail struct {
+	sync.Mutex
+	records []AuditRecord
+}
+
+// auditBefore captures the values of the rows changed in the chunk, before they are applied
+func (txn *Txn) auditBefore(r *commit.Reader, chunk commit.Chunk, markers *commit.Buffer) map[uint32]*AuditRow {
+	rows := make(map[uint32]*AuditRow)
+	rowAt := func(idx uint32) *AuditRow {
+		row, ok := rows[idx]
+		if !ok {
+			row = &AuditRow{Index: idx}
+			rows[idx] = row
+		}
+		return row
+	}
+
+	// The deleted rows lose all of their values
+	if markers != nil {
+		r.Range(markers, chunk, func(r *commit.Reader) {
+			for r.Next() {
+				row := rowAt(r.Index())
+				switch r.Type {
+				case commit.Insert:
+					row.Inserted = true
+				case commit.Delete:
+					row.Deleted = true
+					txn.owner.cols.Range(func(column *column) {
+						if !column.IsIndex() {
+							row.capture(column, r.Index())
+						}
+					})
+				}
+			}
+		})
+	}
+
+	for _, u := range txn.updates {
+		if u.IsEmpty() || u.Column == rowColumn {
+			continue
+		}
+
+		column, ok := txn.owner.cols.Load(u.Column)
+		if !ok || column.IsIndex() {
+			continue
+		}
+
+		r.Range(u, chunk, func(r *commit.Reader) {
+			for r.Next() {
+				rowAt(r.Index()).capture(column, r.Index())
+			}
+		})
+	}
+	return rows
+}
+
+// auditAfter completes the captured rows with their values after the commit and records them
+func (txn *Txn) auditAfter(rows map[uint32]*AuditRow, commitID uint64) {
+	record := AuditRecord{
+		Actor:  txn.actor,
+		Commit: commitID,
+		Time:   time.Now(),
+		Rows:   make([]AuditRow, 0, len(rows)),
+	}
+
+	for idx, row := range rows {
+		if row.Inserted && row.Deleted {
+			continue
+		}
+
+		values := row.Values[:0]
+		for _, v := range row.Values {
+			column, ok := txn.owner.cols.Load(v.Column)
+			if ok && !row.Deleted {
+				v.After = valueAt(column, idx)
+			}
+
+			switch {
+			case reflect.DeepEqual(v.Before, v.After):
+			case ok:
+				v.Before, v.After = maskValue(column, v.Before), maskValue(column, v.After)
+				values = append(values, v)
+			default:
+				values = append(values, v)
+			}
+		}
+
+		if row.Values = values; len(values) > 0 || row.Inserted || row.Deleted {
+			record.Rows = append(record.Rows, *row)
+		}
+	}
+
+	if len(record.Rows) == 0 {
+		return
+	}
+
+	sort.Slice(record.Rows, func(i, j int) bool {
+		return record.Rows[i].Index < record.Rows[j].Index
+	})
+
+	txn.audits.Lock()
+	txn.audits.records = append(txn.audits.records, record)
+	txn.audits.Unlock()
+}
+
+// publishAudits sends the audit records of the transaction to the audit sink, in the order
+// of their commit IDs.
+func (txn *Txn) publishAudits() {
+	records := txn.audits.records
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Commit < records[j].Commit
+	})
+
+	for _, record := range records {
+		txn.owner.options().Events.Audit.OnAudit(record)
+	}
+	txn.audits.records = records[:0]
+}
+
+// capture records the value of a column before it is changed, once per row and column
+func (row *AuditRow) capture(column *column, idx uint32) {
+	for _, v := range row.Values {
+		if v.Column == column.name {
+			return
+		}
+	}
+
+	row.Values = append(row.Values, ValueDiff{Column: column.name, Before: valueAt(column, idx)})
+}
+
+// valueAt returns the value of a column, or nil if it is not present
+func valueAt(column *column, idx uint32) any {
+	if v, ok := column.Value(idx); ok {
+		return v
+	}
+	return nil
+}
+
+// maskValue masks a value of a column if the column is masked, leaving the missing values as is
+func maskValue(column *column, v any) any {
+	if mask := column.valueMask(); mask != nil && v != nil {
+		return mask(v)
+	}
+	return v
+}
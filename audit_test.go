@@ -0,0 +1,134 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	audit := NewAuditLog(10)
+	players := NewCollection(Options{Events: EventOptions{Audit: audit}})
+	players.CreateColumn("name", ForString())
+	players.CreateColumn("balance", ForFloat64())
+	players.CreateIndex("rich", "balance", func(r Reader) bool {
+		return r.Float() > 100
+	})
+
+	assert.NoError(t, players.QueryAs("alice", func(txn *Txn) error {
+		_, err := txn.Insert(func(r Row) error {
+			r.SetString("name", "Roman")
+			r.SetFloat64("balance", 50)
+			return nil
+		})
+		return err
+	}))
+
+	assert.NoError(t, players.QueryAs("bob", func(txn *Txn) error {
+		return txn.QueryAt(0, func(r Row) error {
+			r.MergeFloat64("balance", 100)
+			r.SetString("name", "Roman") // Unchanged
+			return nil
+		})
+	}))
+
+	// Transactions which change nothing are not audited
+	assert.NoError(t, players.QueryAs("bob", func(txn *Txn) error {
+		return nil
+	}))
+
+	assert.True(t, players.DeleteAt(0))
+
+	records := audit.Records()
+	assert.Len(t, records, 3)
+	assert.Equal(t, "alice", records[0].Actor)
+	assert.NotZero(t, records[0].Commit)
+	assert.False(t, records[0].Time.IsZero())
+	assert.Equal(t, []AuditRow{{
+		Index:    0,
+		Inserted: true,
+		Values: []ValueDiff{
+			{Column: "name", After: "Roman"},
+			{Column: "balance", After: 50.0},
+		},
+	}}, records[0].Rows)
+
+	assert.Equal(t, "bob", records[1].Actor)
+	assert.Equal(t, []AuditRow{{
+		Index:  0,
+		Values: []ValueDiff{{Column: "balance", Before: 50.0, After: 150.0}},
+	}}, records[1].Rows)
+
+	assert.Equal(t, "", records[2].Actor)
+	assert.Len(t, records[2].Rows, 1)
+	assert.True(t, records[2].Rows[0].Deleted)
+	assert.Contains(t, records[2].Rows[0].Values, ValueDiff{Column: "balance", Before: 150.0})
+	assert.Contains(t, records[2].Rows[0].Values, ValueDiff{Column: "name", Before: "Roman"})
+}
+
+func TestAuditLogSize(t *testing.T) {
+	audit := NewAuditLog(2)
+	for i := uint64(1); i <= 3; i++ {
+		audit.OnAudit(AuditRecord{Commit: i})
+	}
+
+	records := audit.Records()
+	assert.Len(t, records, 2)
+	assert.Equal(t, uint64(2), records[0].Commit)
+	assert.Equal(t, uint64(3), records[1].Commit)
+}
+
+func TestAuditParallel(t *testing.T) {
+	audit := NewAuditLog(100)
+
+	// Without the cleanup goroutine, the options can be changed once the players are loaded
+	players := loadPlayers(40000, Options{Vacuum: -1})
+	players.options().Events.Audit = audit
+	assert.NoError(t, players.QueryAs("admin", func(txn *Txn) error {
+		for i := 0; i < 5; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetInt("age", 10)
+				return nil
+			})
+		}
+
+		return txn.With("old").Range(func(idx uint32) {
+			txn.Int("age").Merge(1)
+		})
+	}))
+
+	records := audit.Records()
+	assert.NotEmpty(t, records)
+	for i, record := range records {
+		assert.Equal(t, "admin", record.Actor)
+		if i > 0 {
+			assert.Greater(t, record.Commit, records[i-1].Commit)
+		}
+	}
+}
+
+func TestAuditMask(t *testing.T) {
+	audit := NewAuditLog(10)
+	players := NewCollection(Options{Events: EventOptions{Audit: audit}})
+	players.CreateColumn("email", ForString(WithMask[string](func(any) any {
+		return "***"
+	})))
+
+	players.Insert(func(r Row) error {
+		r.SetString("email", "roman@example.com")
+		return nil
+	})
+	players.QueryAt(0, func(r Row) error {
+		r.SetString("email", "merlin@example.com")
+		return nil
+	})
+
+	// The changes of the masked values are audited, without revealing them
+	records := audit.Records()
+	assert.Len(t, records, 2)
+	assert.Equal(t, []ValueDiff{{Column: "email", After: "***"}}, records[0].Rows[0].Values)
+	assert.Equal(t, []ValueDiff{{Column: "email", Before: "***", After: "***"}}, records[1].Rows[0].Values)
+}
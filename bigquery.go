@@ -0,0 +1,121 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+)
+
+// BigQueryField represents a field of the schema of a BigQuery table, as used by the load jobs
+type BigQueryField struct {
+	Name string `json:"name"` // The name of the field
+	Type string `json:"type"` // The type of the field, such as "INTEGER" or "STRING"
+	Mode string `json:"mode"` // The mode of the field, always "NULLABLE"
+}
+
+// BigQueryLoad represents the source of a BigQuery load job, with the schema of the table and
+// the rows encoded as newline-delimited JSON.
+type BigQueryLoad struct {
+	Schema []BigQueryField // The schema of the table
+	Rows   int             // The number of rows of the load
+	Data   []byte          // The rows, in the NEWLINE_DELIMITED_JSON source format
+}
+
+// BigQueryExporter converts the exported batches into the sources of BigQuery load jobs, which
+// the function submits, typically using the BigQuery client with a reader over the data. The
+// numbers keep their type, the other values are strings and the missing values are omitted.
+type BigQueryExporter struct {
+	submit func(load BigQueryLoad) error
+	buffer bytes.Buffer
+}
+
+// NewBigQueryExporter creates a new exporter submitting a load job for each exported batch
+func NewBigQueryExporter(submit func(load BigQueryLoad) error) *BigQueryExporter {
+	return &BigQueryExporter{
+		submit: submit,
+	}
+}
+
+// WriteBatch converts the batch into a load job and submits it, implementing Exporter.
+func (e *BigQueryExporter) WriteBatch(batch *ExportBatch) error {
+	schema := make([]BigQueryField, 0, len(batch.Columns))
+	names := make([][]byte, 0, len(batch.Columns))
+	for _, column := range batch.Columns {
+		name, _ := json.Marshal(column.Name)
+		names = append(names, name)
+		schema = append(schema, BigQueryField{
+			Name: column.Name,
+			Type: bigQueryTypeOf(column.Kind),
+			Mode: "NULLABLE",
+		})
+	}
+
+	e.buffer.Reset()
+	for row := 0; row < batch.Rows; row++ {
+		e.buffer.WriteByte('{')
+		first := true
+		for i, column := range batch.Columns {
+			value, ok := bigQueryValueOf(column.Kind, column.Values[row])
+			if !ok {
+				continue
+			}
+
+			if !first {
+				e.buffer.WriteByte(',')
+			}
+			first = false
+			e.buffer.Write(names[i])
+			e.buffer.WriteByte(':')
+			e.buffer.Write(value)
+		}
+		e.buffer.WriteString("}\n")
+	}
+
+	return e.submit(BigQueryLoad{
+		Schema: schema,
+		Rows:   batch.Rows,
+		Data:   e.buffer.Bytes(),
+	})
+}
+
+// bigQueryTypeOf returns the BigQuery type for the kind of the exported values
+func bigQueryTypeOf(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "FLOAT"
+	default:
+		return "STRING"
+	}
+}
+
+// bigQueryValueOf encodes a value as JSON, or returns false if the value is missing
+func bigQueryValueOf(kind reflect.Kind, value any) ([]byte, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, false
+		}
+	}
+
+	if kind == reflect.String {
+		value = exportText(value)
+	}
+
+	encoded, err := json.Marshal(value)
+	return encoded, err == nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// QueryOptions represents the options of the queries of a collection.
+type QueryOptions struct {
+	// Cache is the maximum number of query results kept by QueryCached(). The cache is
+	// disabled by default.
+	Cache int
+
+	// UnmaskToken is the secret which allows a transaction to read the values of the masked
+	// columns, using the Unmask() hint. If empty, the masked values can never be read.
+	UnmaskToken string
+
+	// RecoverPanics recovers the panics raised while executing the callback of a query, such
+	// as a bad predicate, and returns them as a *PanicError instead of crashing the process.
+	RecoverPanics bool
+}
+
+// merge merges the options specified on top of the current ones, ignoring the zero values.
+func (o *QueryOptions) merge(other QueryOptions) {
+	if other.Cache > 0 {
+		o.Cache = other.Cache
+	}
+	if other.UnmaskToken != "" {
+		o.UnmaskToken = other.UnmaskToken
+	}
+	if other.RecoverPanics {
+		o.RecoverPanics = true
+	}
+}
+
+// configureQuery creates the query cache, if enabled or resized
+func (c *Collection) configureQuery(options QueryOptions) {
+	if options.Cache > 0 && options.Cache != c.options().Query.Cache {
+		c.cache = newQueryCache(options.Cache)
+	}
+}
+
+// QueryCached executes a read-only query and caches its result under the specified key until
+// the next change is committed to the collection (or its schema changes). The key must uniquely
+// identify both the selection and the computation, for example a fingerprint of a filter with
+// the name of the aggregate. Errors are not cached. The cache must be enabled using the
+// Query.Cache option, otherwise the query is simply executed every time.
+//
+// The query is executed with the ReadSnapshot consistency level, hence it must not start another
+// query on the same collection from within its callback. A query which attempts to change the
+// collection fails and its changes are rolled back.
+func (c *Collection) QueryCached(key string, fn func(txn *Txn) (any, error)) (result any, err error) {
+	if c.cache != nil {
+		if value, ok := c.cache.load(key, atomic.LoadUint64(&c.generation)); ok {
+			return value, nil
+		}
+	}
+
+	// Execute the query on a single state of the collection, the result is associated with the
+	// generation observed once the commits are blocked, so a stale result is never served.
+	var generation uint64
+	if err = c.QueryWith(ReadSnapshot, func(txn *Txn) error {
+		txn.readOnly = true
+		generation = atomic.LoadUint64(&c.generation)
+		result, err = fn(txn)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if c.cache != nil {
+		c.cache.store(key, generation, result)
+	}
+	return result, nil
+}
+
+// changed marks the collection as changed, invalidating the cached query results
+func (c *Collection) changed() {
+	atomic.AddUint64(&c.generation, 1)
+}
+
+// Fingerprint returns a string which uniquely identifies the filter, and can be used as
+// a part of the key for a cached query.
+func (f Filter) Fingerprint() string {
+	if b, err := json.Marshal(f); err == nil {
+		return string(b)
+	}
+
+	return fmt.Sprintf("%#v", f)
+}
+
+// --------------------------- Query Cache ----------------------------
+
+// queryCache represents a bounded cache of query results
+type queryCache struct {
+	lock     sync.Mutex            // The mutex to guard the entries
+	capacity int                   // The maximum number of entries
+	entries  map[string]cacheEntry // The cached results, by key
+}
+
+// cacheEntry represents a cached query result
+type cacheEntry struct {
+	generation uint64 // The generation of the collection when computed
+	value      any    // The result of the query
+}
+
+// newQueryCache creates a new query cache with the specified capacity
+func newQueryCache(capacity int) *queryCache {
+	return &queryCache{
+		capacity: capacity,
+		entries:  make(map[string]cacheEntry, capacity),
+	}
+}
+
+// load loads a cached result, if present and still valid for the generation
+func (c *queryCache) load(key string, generation uint64) (any, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.generation != generation {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// store stores a result into the cache, evicting the stale entries if the cache is full
+func (c *queryCache) store(key string, generation uint64, value any) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.capacity {
+		for k, v := range c.entries {
+			if v.generation != generation {
+				delete(c.entries, k)
+			}
+		}
+
+		// If everything is still valid, evict an arbitrary entry
+		for k := range c.entries {
+			if len(c.entries) < c.capacity {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = cacheEntry{
+		generation: generation,
+		value:      value,
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryCached(t *testing.T) {
+	coll := NewCollection(Options{Query: QueryOptions{Cache: 10}})
+	coll.CreateColumn("age", ForInt())
+	for i := 0; i < 100; i++ {
+		coll.Insert(func(r Row) error {
+			r.SetInt("age", i)
+			return nil
+		})
+	}
+
+	calls := 0
+	filter := F("age").Gte(50)
+	count := func() int {
+		v, err := coll.QueryCached(filter.Fingerprint()+"/count", func(txn *Txn) (any, error) {
+			calls++
+			return txn.WithFilter(filter).Count(), nil
+		})
+		assert.NoError(t, err)
+		return v.(int)
+	}
+
+	// Repeated queries are served from the cache
+	assert.Equal(t, 50, count())
+	assert.Equal(t, 50, count())
+	assert.Equal(t, 1, calls)
+
+	// A read-only query does not invalidate the cache
+	coll.Query(func(txn *Txn) error {
+		assert.Equal(t, 100, txn.Count())
+		return nil
+	})
+	assert.Equal(t, 50, count())
+	assert.Equal(t, 1, calls)
+
+	// A commit invalidates the cache
+	coll.Insert(func(r Row) error {
+		r.SetInt("age", 99)
+		return nil
+	})
+	assert.Equal(t, 51, count())
+	assert.Equal(t, 2, calls)
+
+	// An update invalidates the cache
+	coll.QueryAt(0, func(r Row) error {
+		r.SetInt("age", 60)
+		return nil
+	})
+	assert.Equal(t, 52, count())
+	assert.Equal(t, 3, calls)
+
+	// A schema change invalidates the cache
+	assert.NoError(t, coll.CreateIndex("old", "age", func(r Reader) bool {
+		return r.Int() >= 50
+	}))
+	assert.Equal(t, 52, count())
+	assert.Equal(t, 4, calls)
+
+	// Writes are rejected and rolled back
+	_, err := coll.QueryCached("write", func(txn *Txn) (any, error) {
+		calls++
+		return nil, txn.QueryAt(0, func(r Row) error {
+			r.SetInt("age", 10)
+			return nil
+		})
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 52, count())
+	assert.Equal(t, 5, calls)
+
+	// Errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err := coll.QueryCached("error", func(txn *Txn) (any, error) {
+			calls++
+			return nil, fmt.Errorf("boom")
+		})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 7, calls)
+}
+
+func TestQueryCachedEviction(t *testing.T) {
+	coll := NewCollection(Options{Query: QueryOptions{Cache: 2}})
+	for i := 0; i < 10; i++ {
+		coll.QueryCached(fmt.Sprint(i), func(txn *Txn) (any, error) {
+			return i, nil
+		})
+	}
+
+	assert.Equal(t, 2, len(coll.cache.entries))
+}
+
+func TestQueryCachedDisabled(t *testing.T) {
+	coll := NewCollection()
+	calls := 0
+	for i := 0; i < 3; i++ {
+		v, err := coll.QueryCached("key", func(txn *Txn) (any, error) {
+			calls++
+			return txn.Count(), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, v)
+	}
+	assert.Equal(t, 3, calls)
+}
+
+func TestFilterFingerprint(t *testing.T) {
+	filter := F("age").Gte(30).And(F("race").Eq("human"))
+	encoded, err := json.Marshal(filter)
+	assert.NoError(t, err)
+
+	var decoded Filter
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, filter.Fingerprint(), decoded.Fingerprint())
+	assert.NotEqual(t, filter.Fingerprint(), F("age").Gte("30").And(F("race").Eq("human")).Fingerprint())
+	assert.NotEmpty(t, F("age").Eq(func() {}).Fingerprint())
+}
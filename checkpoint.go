@@ -0,0 +1,103 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sync"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// Checkpoint represents the chunks of a collection which have changed since the last snapshot,
+// so that an incremental backup only needs to copy these chunks.
+type Checkpoint struct {
+	Rows    []commit.Chunk            // The chunks with inserted or deleted rows
+	Columns map[string][]commit.Chunk // The chunks with changed values, for each column
+}
+
+// IsEmpty returns whether nothing has changed since the last snapshot
+func (c *Checkpoint) IsEmpty() bool {
+	return len(c.Rows) == 0 && len(c.Columns) == 0
+}
+
+// Checkpoint returns the chunks which have changed since the last snapshot of the collection,
+// or since its creation if no snapshot was taken. A chunk is marked as changed by any commit
+// which modifies it, even if the values are later changed back, and the internal columns
+// such as the expiration are reported along with the others.
+func (c *Collection) Checkpoint() Checkpoint {
+	c.changes.lock.Lock()
+	defer c.changes.lock.Unlock()
+
+	out := Checkpoint{
+		Columns: make(map[string][]commit.Chunk, len(c.changes.columns)),
+	}
+
+	for name, chunks := range c.changes.columns {
+		switch {
+		case chunks.Count() == 0:
+			continue
+		case name == rowColumn:
+			out.Rows = chunksOf(chunks)
+		default:
+			out.Columns[name] = chunksOf(chunks)
+		}
+	}
+
+	if len(out.Columns) == 0 {
+		out.Columns = nil
+	}
+	return out
+}
+
+// chunksOf returns the chunks which are set in the bitmap, in ascending order
+func chunksOf(chunks bitmap.Bitmap) []commit.Chunk {
+	out := make([]commit.Chunk, 0, chunks.Count())
+	chunks.Range(func(x uint32) {
+		out = append(out, commit.Chunk(x))
+	})
+	return out
+}
+
+// --------------------------- Change Set ----------------------------
+
+// changedChunk represents the columns which have changed in a chunk
+type changedChunk struct {
+	chunk   commit.Chunk
+	columns []string
+}
+
+// changeSet represents the chunks of each column which have changed since the last snapshot
+type changeSet struct {
+	lock    sync.Mutex
+	columns map[string]bitmap.Bitmap
+}
+
+// mark marks the chunk of the column as changed
+func (c *changeSet) mark(columnName string, chunk commit.Chunk) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.columns == nil {
+		c.columns = make(map[string]bitmap.Bitmap)
+	}
+
+	chunks := c.columns[columnName]
+	if !chunks.Contains(uint32(chunk)) {
+		chunks.Set(uint32(chunk))
+		c.columns[columnName] = chunks
+	}
+}
+
+// take clears the chunk of every column and returns the columns which have changed
+func (c *changeSet) take(chunk commit.Chunk) (columns []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for name, chunks := range c.columns {
+		if chunks.Contains(uint32(chunk)) {
+			chunks.Remove(uint32(chunk))
+			columns = append(columns, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,65 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kelindar/column/commit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("name", ForString())
+	c.CreateColumn("age", ForInt())
+	c.CreateIndex("old", "age", func(r Reader) bool {
+		return r.Int() >= 50
+	})
+
+	for i := 0; i < 20000; i++ {
+		c.Insert(func(r Row) error {
+			r.SetString("name", "Merlin")
+			r.SetInt("age", i%100)
+			return nil
+		})
+	}
+
+	// Everything has changed since the creation
+	assert.Equal(t, Checkpoint{
+		Rows: []commit.Chunk{0, 1},
+		Columns: map[string][]commit.Chunk{
+			"name": {0, 1},
+			"age":  {0, 1},
+		},
+	}, c.Checkpoint())
+
+	// Nothing has changed since the snapshot
+	assert.NoError(t, c.Snapshot(bytes.NewBuffer(nil)))
+	checkpoint := c.Checkpoint()
+	assert.True(t, checkpoint.IsEmpty())
+
+	// Updates only change the chunk of their column
+	assert.NoError(t, c.QueryAt(17000, func(r Row) error {
+		r.SetInt("age", 1)
+		return nil
+	}))
+	assert.Equal(t, Checkpoint{
+		Columns: map[string][]commit.Chunk{
+			"age": {1},
+		},
+	}, c.Checkpoint())
+
+	// Deletes change the rows and every column of the chunk, including the internal ones
+	assert.True(t, c.DeleteAt(5))
+	assert.Equal(t, Checkpoint{
+		Rows: []commit.Chunk{0},
+		Columns: map[string][]commit.Chunk{
+			"name":       {0},
+			"age":        {0, 1},
+			expireColumn: {0},
+		},
+	}, c.Checkpoint())
+}
@@ -0,0 +1,138 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sync"
+
+	"github.com/kelindar/column/commit"
+)
+
+// checksumKey represents the key of the checksum of a column chunk
+type checksumKey struct {
+	column string
+	chunk  commit.Chunk
+}
+
+// checksumSet keeps the checksums of the values of each column, per chunk. It is only used
+// in the paranoid mode, in order to detect the memory corruption of the columns.
+type checksumSet struct {
+	lock sync.Mutex
+	sums map[checksumKey]uint32
+}
+
+// load returns the checksum of a column chunk, if known
+func (s *checksumSet) load(key checksumKey) (uint32, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sum, ok := s.sums[key]
+	return sum, ok
+}
+
+// store stores the checksum of a column chunk
+func (s *checksumSet) store(key checksumKey, sum uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.sums == nil {
+		s.sums = make(map[checksumKey]uint32)
+	}
+	s.sums[key] = sum
+}
+
+// drop removes the checksums of a column, or of every column if the name is empty
+func (s *checksumSet) drop(columnName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key := range s.sums {
+		if columnName == "" || key.column == columnName {
+			delete(s.sums, key)
+		}
+	}
+}
+
+// checksumOf computes the checksum of the values of a column chunk. The indexes are not
+// checksummed, since they are computed from the values. The snapshot of the column holds its
+// read lock, so the chunk can be verified while the other commits grow the columns.
+func (c *Collection) checksumOf(column *column, chunk commit.Chunk) (uint32, bool) {
+	buffer := c.txns.acquirePage(column.name)
+	defer c.txns.releasePage(buffer)
+	if !column.Snapshot(chunk, buffer) {
+		return 0, false
+	}
+
+	hash := crc32.NewIEEE()
+	buffer.WriteTo(hash)
+	return hash.Sum32(), true
+}
+
+// updateChecksums recomputes the checksums of a chunk once a commit was applied on it. This
+// must be called while holding the write lock of the chunk.
+func (c *Collection) updateChecksums(chunk commit.Chunk) {
+	c.cols.Range(func(column *column) {
+		if sum, ok := c.checksumOf(column, chunk); ok {
+			c.sums.store(checksumKey{column.name, chunk}, sum)
+		}
+	})
+}
+
+// verifyChunk verifies the checksums of every column of a chunk, the columns whose checksum
+// is not yet known are trusted. This must be called while holding the lock of the chunk.
+func (c *Collection) verifyChunk(chunk commit.Chunk) (err error) {
+	c.cols.Range(func(column *column) {
+		sum, ok := c.checksumOf(column, chunk)
+		if !ok || err != nil {
+			return
+		}
+
+		key := checksumKey{column.name, chunk}
+		switch expect, known := c.sums.load(key); {
+		case !known:
+			c.sums.store(key, sum)
+		case expect != sum:
+			err = fmt.Errorf("column: checksum mismatch in column '%s' of chunk %d, the memory may be corrupted", column.name, chunk)
+		}
+	})
+	return
+}
+
+// Verify verifies the checksums of every chunk of the collection in the paranoid mode, and
+// returns an error if the values of a column were corrupted since they were committed.
+func (c *Collection) Verify() error {
+	if !c.options().Storage.Paranoid {
+		return fmt.Errorf("column: unable to verify, the paranoid mode is not enabled")
+	}
+
+	for chunk := commit.Chunk(0); c.isCommitted(chunk); chunk++ {
+		c.slock.RLock(uint(chunk))
+		err := c.verifyChunk(chunk)
+		c.slock.RUnlock(uint(chunk))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isCommitted returns whether a chunk was committed at least once, hence has columns to verify
+func (c *Collection) isCommitted(chunk commit.Chunk) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return int(chunk) < len(c.commits)
+}
+
+// verify verifies the checksums of a chunk read by the transaction, in the paranoid mode. Each
+// chunk is verified once per transaction and the first mismatch is kept, in order to return it
+// once the query completes.
+func (txn *Txn) verify(chunk commit.Chunk) {
+	if !txn.owner.options().Storage.Paranoid || txn.corrupt != nil || txn.verified.Contains(uint32(chunk)) {
+		return
+	}
+
+	txn.verified.Set(uint32(chunk))
+	if txn.owner.isCommitted(chunk) {
+		txn.corrupt = txn.owner.verifyChunk(chunk)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParanoid(t *testing.T) {
+	assert.Error(t, NewCollection().Verify())
+
+	c := NewCollection(Options{Storage: StorageOptions{Paranoid: true}})
+	c.CreateColumn("name", ForString())
+	c.CreateColumn("balance", ForFloat64())
+	c.CreateIndex("rich", "balance", func(r Reader) bool {
+		return r.Float() >= 10000
+	})
+
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		for i := 0; i < 20000; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetString("name", "Merlin")
+				r.SetFloat64("balance", float64(i))
+				return nil
+			})
+		}
+		return nil
+	}))
+
+	// The commits keep the checksums up to date
+	assert.NoError(t, c.Verify())
+	assert.NoError(t, c.QueryAt(17000, func(r Row) error {
+		r.SetFloat64("balance", 1)
+		return nil
+	}))
+	assert.True(t, c.DeleteAt(5))
+	assert.NoError(t, c.Verify())
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		assert.Equal(t, 9999, txn.With("rich").Count())
+		return nil
+	}))
+
+	// Corrupt the memory of the second chunk
+	column, _ := c.cols.Load("balance")
+	column.Column.(*numericColumn[float64]).chunks[1].data[100] = 42
+
+	assert.Error(t, c.Verify())
+	assert.Error(t, c.Snapshot(bytes.NewBuffer(nil)))
+	assert.Error(t, c.PointReader().ReadAt(16484, func(r Row) error { return nil }))
+	assert.ErrorContains(t, c.Query(func(txn *Txn) error {
+		return txn.Range(func(idx uint32) {})
+	}), "column 'balance' of chunk 1")
+
+	// The first chunk remains readable
+	assert.NoError(t, c.QueryAt(0, func(r Row) error {
+		return nil
+	}))
+}
+
+func TestParanoidGrow(t *testing.T) {
+	c := NewCollection(Options{Storage: StorageOptions{Paranoid: true}})
+	c.CreateColumn("balance", ForFloat64())
+
+	// Verify the chunks while the other commits keep growing the columns
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				assert.NoError(t, c.Verify())
+			}
+		}
+	}()
+
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, c.Query(func(txn *Txn) error {
+			for j := 0; j < chunkSize; j++ {
+				txn.Insert(func(r Row) error {
+					r.SetFloat64("balance", 1)
+					return nil
+				})
+			}
+			return nil
+		}))
+	}
+
+	close(done)
+	wg.Wait()
+	assert.NoError(t, c.Verify())
+}
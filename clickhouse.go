@@ -0,0 +1,126 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+)
+
+// ClickHouseExporter writes the exported batches as blocks of the ClickHouse Native format,
+// which is column-oriented as well. The output can be sent as the body of an INSERT query with
+// "FORMAT Native" to the HTTP interface, or written to a file loaded by clickhouse-client. All
+// of the columns are nullable, the numbers keep their width and the other values are strings.
+type ClickHouseExporter struct {
+	dst     *bufio.Writer
+	scratch []byte
+}
+
+// NewClickHouseExporter creates a new exporter writing the Native blocks into the destination
+func NewClickHouseExporter(dst io.Writer) *ClickHouseExporter {
+	return &ClickHouseExporter{
+		dst: bufio.NewWriter(dst),
+	}
+}
+
+// WriteBatch writes the batch as a Native block, implementing Exporter.
+func (e *ClickHouseExporter) WriteBatch(batch *ExportBatch) error {
+	e.scratch = binary.AppendUvarint(e.scratch[:0], uint64(len(batch.Columns)))
+	e.scratch = binary.AppendUvarint(e.scratch, uint64(batch.Rows))
+	for _, column := range batch.Columns {
+		e.scratch = appendClickHouseString(e.scratch, column.Name)
+		e.scratch = appendClickHouseString(e.scratch, "Nullable("+clickHouseTypeOf(column.Kind)+")")
+
+		// The null map is followed by the values, with a default value for the nulls
+		for _, v := range column.Values {
+			if v == nil {
+				e.scratch = append(e.scratch, 1)
+			} else {
+				e.scratch = append(e.scratch, 0)
+			}
+		}
+		for _, v := range column.Values {
+			e.scratch = appendClickHouseValue(e.scratch, column.Kind, v)
+		}
+
+		// Flush each column, in order to bound the size of the scratch buffer
+		if _, err := e.dst.Write(e.scratch); err != nil {
+			return err
+		}
+		e.scratch = e.scratch[:0]
+	}
+
+	if _, err := e.dst.Write(e.scratch); err != nil {
+		return err
+	}
+	return e.dst.Flush()
+}
+
+// clickHouseTypeOf returns the ClickHouse type for the kind of the exported values
+func clickHouseTypeOf(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "Bool"
+	case reflect.Int16:
+		return "Int16"
+	case reflect.Int32:
+		return "Int32"
+	case reflect.Int, reflect.Int64:
+		return "Int64"
+	case reflect.Uint16:
+		return "UInt16"
+	case reflect.Uint32:
+		return "UInt32"
+	case reflect.Uint, reflect.Uint64:
+		return "UInt64"
+	case reflect.Float32:
+		return "Float32"
+	case reflect.Float64:
+		return "Float64"
+	default:
+		return "String"
+	}
+}
+
+// appendClickHouseString appends a string prefixed by its length
+func appendClickHouseString(dst []byte, value string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(value)))
+	return append(dst, value...)
+}
+
+// appendClickHouseValue appends a value in the little-endian encoding of its type
+func appendClickHouseValue(dst []byte, kind reflect.Kind, value any) []byte {
+	switch kind {
+	case reflect.Bool:
+		if v, _ := value.(bool); v {
+			return append(dst, 1)
+		}
+		return append(dst, 0)
+	case reflect.Int16, reflect.Uint16:
+		v, _ := numberOf[uint16](value)
+		return binary.LittleEndian.AppendUint16(dst, v)
+	case reflect.Int32, reflect.Uint32:
+		v, _ := numberOf[uint32](value)
+		return binary.LittleEndian.AppendUint32(dst, v)
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		v, _ := numberOf[uint64](value)
+		return binary.LittleEndian.AppendUint64(dst, v)
+	case reflect.Float32:
+		v, _ := numberOf[float32](value)
+		return binary.LittleEndian.AppendUint32(dst, math.Float32bits(v))
+	case reflect.Float64:
+		v, _ := numberOf[float64](value)
+		return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+	case reflect.String:
+		if value == nil {
+			return appendClickHouseString(dst, "")
+		}
+		return appendClickHouseString(dst, exportText(value))
+	default:
+		return dst
+	}
+}
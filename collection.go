@@ -14,35 +14,104 @@ import (
 
 	"github.com/kelindar/bitmap"
 	"github.com/kelindar/column/commit"
-	"github.com/kelindar/smutex"
 )
 
 const (
-	expireColumn = "expire"
-	rowColumn    = "row"
+	expireColumn  = "expire"
+	rowColumn     = "row"
+	pseudoPrefix  = "$"
+	versionColumn = pseudoPrefix + "version"
+	createdColumn = pseudoPrefix + "created"
+	outboxColumn  = pseudoPrefix + "outbox"
 )
 
 // Collection represents a collection of objects in a columnar format
 type Collection struct {
-	count   uint64             // The current count of elements
-	txns    *txnPool           // The transaction pool
-	lock    sync.RWMutex       // The mutex to guard the fill-list
-	slock   *smutex.SMutex128  // The sharded mutex for the collection
-	cols    columns            // The map of columns
-	fill    bitmap.Bitmap      // The fill-list
-	opts    Options            // The options configured
-	logger  commit.Logger      // The commit logger for CDC
-	record  *commit.Log        // The commit logger for snapshot
-	pk      *columnKey         // The primary key column
-	cancel  context.CancelFunc // The cancellation function for the context
-	commits []uint64           // The array of commit IDs for corresponding chunk
-}
-
-// Options represents the options for a collection.
+	count      uint64                  // The current count of elements
+	generation uint64                  // The generation, incremented on every change
+	txns       *txnPool                // The transaction pool
+	lock       collectionLock          // The mutex to guard the fill-list
+	slock      *chunkLock              // The sharded mutex for the collection
+	cols       columns                 // The map of columns
+	fill       bitmap.Bitmap           // The fill-list
+	opts       atomic.Pointer[Options] // The options configured, replaced as a whole
+	logger     commit.Logger           // The commit logger for CDC
+	record     *commit.Log             // The commit logger for snapshot
+	pk         *columnKey              // The primary key column
+	cancel     context.CancelFunc      // The cancellation function for the context
+	vacuuming  sync.WaitGroup          // The cleanup goroutine, if running
+	commits    []uint64                // The array of commit IDs for corresponding chunk
+	cache      *queryCache             // The cache of query results (optional)
+	quota      func() error            // The check of the shared resource limits (optional)
+	replicas   atomic.Value            // The replicas receiving the commits ([]*Replica)
+	latency    latencyTracker          // The latency of the queries with a target latency
+	keyLocks   keyLocks                // The advisory locks of the keys
+	changes    changeSet               // The chunks changed since the last snapshot
+	sums       checksumSet             // The checksums of the columns, in the paranoid mode
+	sizes      atomic.Pointer[sizeSet] // The sizes of the columns, if limited by a quota
+	lanes      commitLanes             // The priority lanes of the commits
+	retained   retentionStats          // The rows purged by the retention policies
+	revision   uint64                  // The revision of the columns, incremented whenever they change
+	history    history                 // The past versions which can be viewed, if enabled
+	outbox     *outbox                 // The messages pending delivery, if enabled
+}
+
+// Options represents the configuration profile of a collection. The rows are always
+// stored in chunks of 16K, as the chunk size is part of the commit encoding. The profile,
+// consisting of the capacity, the vacuum interval, the query cache and the lifecycle tracking,
+// is saved in the snapshots and applied to the collection on restore, so that the restored
+// collection is configured as the original. The optional features are configured in their
+// own sections of the options.
 type Options struct {
 	Capacity int           // The initial capacity when creating columns
-	Writer   commit.Logger // The writer for the commit log (optional)
-	Vacuum   time.Duration // The interval at which the vacuum of expired entries will be done
+	Writer   commit.Logger // The writer for the commit log, used for persistence (optional)
+	Metrics  MetricsSink   // The sink receiving the information about each commit (optional)
+
+	// Vacuum is the interval at which the vacuum of expired entries will be done. It defaults
+	// to one second, while a negative interval disables the vacuum entirely.
+	Vacuum time.Duration
+
+	// Retention are the retention policies enforced by the vacuum, each deleting the rows
+	// whose timestamp is older than its period, see WithRetention().
+	Retention []Retention
+
+	Query   QueryOptions   // The options of the queries, such as the query cache
+	Storage StorageOptions // The options of the storage, such as the lifecycle tracking
+	History HistoryOptions // The options of the history of the past versions
+	Events  EventOptions   // The sinks receiving the changes of each transaction
+	Logging LoggingOptions // The options of the diagnostic logs
+}
+
+// MetricsSink represents a sink which receives the information about the commits of a
+// collection, for example to export them as metrics. It is called synchronously after
+// every commit which changed the collection, hence it should return quickly.
+type MetricsSink interface {
+	OnCommit(info CommitInfo)
+}
+
+// merge merges the options specified on top of the current ones, ignoring the zero values.
+func (o *Options) merge(other Options) {
+	if other.Capacity > 0 {
+		o.Capacity = other.Capacity
+	}
+	if other.Vacuum != 0 {
+		o.Vacuum = other.Vacuum
+	}
+	if len(other.Retention) > 0 {
+		o.Retention = append(o.Retention[:len(o.Retention):len(o.Retention)], other.Retention...)
+	}
+	if other.Writer != nil {
+		o.Writer = other.Writer
+	}
+	if other.Metrics != nil {
+		o.Metrics = other.Metrics
+	}
+
+	o.Query.merge(other.Query)
+	o.Storage.merge(other.Storage)
+	o.History.merge(other.History)
+	o.Events.merge(other.Events)
+	o.Logging.merge(other.Logging)
 }
 
 // NewCollection creates a new columnar collection.
@@ -51,39 +120,87 @@ func NewCollection(opts ...Options) *Collection {
 		Capacity: 1024,
 		Vacuum:   1 * time.Second,
 		Writer:   nil,
+		Logging: LoggingOptions{
+			LargeCommitSize: 64 << 20,
+			SlowLockWait:    100 * time.Millisecond,
+		},
 	}
 
 	// Merge options together
 	for _, o := range opts {
-		if o.Capacity > 0 {
-			options.Capacity = o.Capacity
-		}
-		if o.Vacuum > 0 {
-			options.Vacuum = o.Vacuum
-		}
-		if o.Writer != nil {
-			options.Writer = o.Writer
-		}
+		options.merge(o)
 	}
 
 	// Create a new collection
-	ctx, cancel := context.WithCancel(context.Background())
 	store := &Collection{
 		cols:   makeColumns(8),
 		txns:   newTxnPool(),
-		opts:   options,
-		slock:  new(smutex.SMutex128),
+		slock:  new(chunkLock),
 		fill:   make(bitmap.Bitmap, 0, options.Capacity>>6),
 		logger: options.Writer,
-		cancel: cancel,
 	}
 
-	// Create an expiration column and start the cleanup goroutine
+	// Create an expiration column and apply the configuration
+	store.opts.Store(&Options{Capacity: options.Capacity})
 	store.CreateColumn(expireColumn, ForInt64())
-	go store.vacuum(ctx, options.Vacuum)
+	store.configure(options)
 	return store
 }
 
+// Options returns the options the collection is configured with.
+func (c *Collection) Options() Options {
+	return *c.options()
+}
+
+// options returns the options the collection is currently configured with, which must not
+// be modified since they are shared with the concurrent readers.
+func (c *Collection) options() *Options {
+	return c.opts.Load()
+}
+
+// configure applies the configuration profile to the collection, configuring each of the
+// features and (re)starting the cleanup goroutine as required.
+func (c *Collection) configure(options Options) {
+	c.configureQuery(options.Query)
+	c.configureStorage(options.Storage)
+	c.configureEvents(options.Events)
+
+	// Restart the cleanup goroutine if the interval or the retention has changed. The previous
+	// one is stopped before the options are replaced, and the new one started once they are set.
+	current := c.options()
+	restart := c.cancel == nil || options.Vacuum != current.Vacuum ||
+		!sameRetention(options.Retention, current.Retention)
+	if restart && c.cancel != nil {
+		c.cancel()
+		c.vacuuming.Wait()
+	}
+
+	history := options.History.enabled() != current.History.enabled()
+	c.opts.Store(&options)
+	if history {
+		c.resetHistory()
+	}
+	if restart {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.cancel = cancel
+		if options.Vacuum > 0 {
+			c.vacuuming.Add(1)
+			go func() {
+				defer c.vacuuming.Done()
+				c.vacuum(ctx, options.Vacuum, options.Retention)
+			}()
+		}
+	}
+}
+
+// commitLogger returns the commit logger of the collection, which may be replaced by a state
+// machine while the collection is in use.
+func (c *Collection) commitLogger() commit.Logger {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.logger
+}
+
 // next finds the next free index in the collection, atomically.
 func (c *Collection) next() uint32 {
 	c.lock.Lock()
@@ -174,20 +291,47 @@ func (c *Collection) CreateColumnsOf(value map[string]any) error {
 	return nil
 }
 
-// CreateColumn creates a column of a specified type and adds it to the collection.
+// CreateColumn creates a column of a specified type and adds it to the collection. The names
+// starting with "$" are reserved for the pseudo-columns maintained by the collection.
 func (c *Collection) CreateColumn(columnName string, column Column) error {
+	if isPseudo(columnName) {
+		return fmt.Errorf("column: unable to create column '%s', the name is reserved", columnName)
+	}
+
+	return c.createColumn(columnName, column)
+}
+
+// createColumn creates a column of a specified type and adds it to the collection.
+func (c *Collection) createColumn(columnName string, column Column) error {
 	if _, ok := c.cols.Load(columnName); ok {
 		return fmt.Errorf("column: unable to create column '%s', already exists", columnName)
 	}
 
+	// Validate the configuration of the columns which can be misconfigured
+	if v, ok := column.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("column: unable to create column '%s', %w", columnName, err)
+		}
+	}
+
 	// Grow the column to the current capacity
 	capacity := uint32(atomic.LoadUint64(&c.count))
-	if c.opts.Capacity > int(capacity) {
-		capacity = uint32(c.opts.Capacity)
+	if c.options().Capacity > int(capacity) {
+		capacity = uint32(c.options().Capacity)
 	}
 
 	column.Grow(capacity)
-	c.cols.Store(columnName, columnFor(columnName, column))
+	wrapped := columnFor(columnName, column)
+	c.cols.Store(columnName, wrapped)
+	c.sums.drop(columnName)
+	c.dropSizes(columnName)
+	atomic.AddUint64(&c.revision, 1)
+	c.changed()
+
+	// If the values expire, create a column with their expiration time
+	if wrapped.valueTTL() > 0 {
+		c.CreateColumn(expireOf(columnName), ForInt64(WithReadOnly[int64]()))
+	}
 
 	// If necessary, create a primary key column
 	if pk, ok := column.(*columnKey); ok {
@@ -199,7 +343,18 @@ func (c *Collection) CreateColumn(columnName string, column Column) error {
 // DropColumn removes the column (or an index) with the specified name. If the column with this
 // name does not exist, this operation is a no-op.
 func (c *Collection) DropColumn(columnName string) {
+	if isPseudo(columnName) {
+		return
+	}
+
 	c.cols.DeleteColumn(columnName)
+	c.cols.DeleteColumn(expireOf(columnName))
+	c.sums.drop(columnName)
+	c.sums.drop(expireOf(columnName))
+	c.dropSizes(columnName)
+	c.dropSizes(expireOf(columnName))
+	atomic.AddUint64(&c.revision, 1)
+	c.changed()
 }
 
 // CreateTrigger creates an trigger column with a specified name which depends on a given
@@ -218,6 +373,7 @@ func (c *Collection) CreateTrigger(triggerName, columnName string, fn func(r Rea
 
 	// Create and add the trigger column
 	trigger := newTrigger(triggerName, columnName, fn)
+	trigger.Column.(*columnTrigger).cols = &c.cols
 	c.lock.Lock()
 	c.cols.Store(triggerName, trigger)
 	c.cols.Store(columnName, column, trigger)
@@ -246,38 +402,117 @@ func (c *Collection) DropTrigger(triggerName string) error {
 
 // CreateIndex creates an index column with a specified name which depends on a given
 // data column. The index function will be applied on the values of the column whenever
-// a new row is added or updated.
+// a new row is added or updated. While the function can read the other columns of the
+// row with Lookup(), the index is not updated when they change, see CreateIndexOf().
 func (c *Collection) CreateIndex(indexName, columnName string, fn func(r Reader) bool) error {
+	return c.createIndex(indexName, []string{columnName}, fn, 0)
+}
+
+// CreateEnumIndex creates an index column with a specified name on an enum column. Since the
+// enum column stores each distinct value once in its dictionary, the index function receives
+// the dictionary ID along with the value, and it is only evaluated once per distinct value
+// while its result is cached by the ID. This avoids evaluating the function again for the same
+// values when large commits are applied, which requires the function to be deterministic.
+func (c *Collection) CreateEnumIndex(indexName, columnName string, fn func(id uint32, value string) bool) error {
+	if fn == nil {
+		return fmt.Errorf("column: create index must specify name, column and function")
+	}
+
+	column, ok := c.cols.Load(columnName)
+	if !ok {
+		return fmt.Errorf("column: unable to create index, column '%v' does not exist", columnName)
+	}
+
+	enum, ok := column.Column.(*columnEnum)
+	if !ok {
+		return fmt.Errorf("column: unable to create index, column '%v' is not an enum", columnName)
+	}
+
+	return c.createIndex(indexName, []string{columnName}, enum.ruleOf(fn), 0)
+}
+
+// CreateIndexOf creates an index column with a specified name which depends on several data
+// columns, for example to index the players which are both rich and active. The reader of the
+// index function is positioned on the value of the first column, while the values of the other
+// columns of the row are read with Lookup(). The index function is applied whenever a row is
+// added or any of these columns is updated, and only the rows which have a value in the first
+// column are indexed.
+func (c *Collection) CreateIndexOf(indexName string, columnNames []string, fn func(r Reader) bool) error {
+	if len(columnNames) == 0 {
+		return fmt.Errorf("column: create index must specify name, column and function")
+	}
+
+	return c.createIndex(indexName, columnNames, fn, 0)
+}
+
+// CreateAsyncIndex creates an index column similarly to CreateIndex(), except that the index
+// function is applied asynchronously, at most after the specified delay, rather than during
+// every commit. This trades the freshness of the index for a lower latency of the writes,
+// and is useful for the indexes with expensive functions on the hot paths. Until then, the
+// index still contains the rows which matched the previous values, except for the deleted
+// ones. The asynchronous indexes cannot be combined into derived indexes.
+func (c *Collection) CreateAsyncIndex(indexName, columnName string, delay time.Duration, fn func(r Reader) bool) error {
+	if delay <= 0 {
+		return fmt.Errorf("column: create async index must specify a positive delay")
+	}
+
+	return c.createIndex(indexName, []string{columnName}, fn, delay)
+}
+
+// createIndex creates an index column on the first column, which is also updated when the
+// other columns change and asynchronously if a delay is specified.
+func (c *Collection) createIndex(indexName string, columnNames []string, fn func(r Reader) bool, delay time.Duration) error {
+	columnName, others := columnNames[0], columnNames[1:]
 	if fn == nil || columnName == "" || indexName == "" {
 		return fmt.Errorf("column: create index must specify name, column and function")
 	}
 
-	// Prior to creating an index, we should have a column
+	// Prior to creating an index, we should have the columns
 	column, ok := c.cols.Load(columnName)
 	if !ok {
 		return fmt.Errorf("column: unable to create index, column '%v' does not exist", columnName)
 	}
 
-	// Create and add the index column,
+	for _, name := range others {
+		if _, ok := c.cols.Load(name); !ok || name == columnName {
+			return fmt.Errorf("column: unable to create index, column '%v' is invalid", name)
+		}
+	}
+
+	// Create and add the index column, along with its trigger on the other columns
 	index := newIndex(indexName, columnName, fn)
+	build := index.Column.(*columnIndex)
+	build.cols = &c.cols
+	build.others = others
+	build.trigger = columnFor(indexName, &indexTrigger{build})
+	if delay > 0 {
+		build.async = &asyncIndex{owner: c, index: build, delay: delay}
+	}
+
 	c.lock.Lock()
-	index.Grow(uint32(c.opts.Capacity))
+	index.Grow(uint32(c.options().Capacity))
 	c.cols.Store(indexName, index)
 	c.cols.Store(columnName, column, index)
+	for _, name := range others {
+		c.cols.Store(name, nil, build.trigger)
+	}
 	c.lock.Unlock()
 
 	// Iterate over all of the values of the target column, chunk by chunk and fill
 	// the index accordingly.
+	start := time.Now()
 	chunks := c.chunks()
 	buffer := commit.NewBuffer(c.Count())
 	reader := commit.NewReader()
 	for chunk := commit.Chunk(0); int(chunk) < chunks; chunk++ {
 		if column.Snapshot(chunk, buffer) {
 			reader.Seek(buffer)
-			index.Apply(chunk, reader)
+			build.apply(reader, false)
 		}
 	}
 
+	c.logIndex(indexName, start)
+	c.changed()
 	return nil
 }
 
@@ -319,6 +554,58 @@ func (c *Collection) CreateSortIndex(indexName, columnName string) error {
 		}
 	}
 
+	c.changed()
+	return nil
+}
+
+// CreateDerivedIndex creates an index column with a specified name which is defined as a
+// boolean combination of other indexes, for example And("active", Not("banned")). The index
+// is maintained incrementally, by re-evaluating the expression for a row whenever one of the
+// columns of the underlying indexes changes, so the combination is not computed per query.
+func (c *Collection) CreateDerivedIndex(indexName string, expr IndexExpr) error {
+	if indexName == "" {
+		return fmt.Errorf("column: create index must specify name & expression")
+	}
+
+	if _, ok := c.cols.Load(indexName); ok {
+		return fmt.Errorf("column: unable to create index, index '%v' already exist", indexName)
+	}
+
+	// Resolve the underlying indexes and the columns they depend on
+	root, sources, err := expr.compile(&c.cols, nil)
+	if err != nil {
+		return err
+	}
+
+	// Create and add the index column, along with its trigger on the source columns
+	index := newDerivedIndex(indexName, root, sources)
+	derived := index.Column.(*columnDerived)
+	c.lock.Lock()
+	index.Grow(uint32(c.options().Capacity))
+	c.cols.Store(indexName, index)
+	for _, columnName := range sources {
+		c.cols.Store(columnName, nil, derived.trigger)
+	}
+	c.lock.Unlock()
+
+	// Evaluate the index for every row which has a value in one of the source columns
+	start := time.Now()
+	chunks := c.chunks()
+	for _, columnName := range sources {
+		columns, ok := c.cols.LoadWithIndex(columnName)
+		if !ok {
+			continue
+		}
+
+		for chunk := commit.Chunk(0); int(chunk) < chunks; chunk++ {
+			columns[0].Index(chunk).Range(func(x uint32) {
+				derived.evaluate(chunk.Min() + x)
+			})
+		}
+	}
+
+	c.logIndex(indexName, start)
+	c.changed()
 	return nil
 }
 
@@ -330,14 +617,31 @@ func (c *Collection) DropIndex(indexName string) error {
 		return fmt.Errorf("column: unable to drop index, index '%v' does not exist", indexName)
 	}
 
+	// A derived index is attached to every column of its underlying indexes
+	if derived, ok := column.Column.(*columnDerived); ok {
+		for _, columnName := range derived.sources {
+			c.cols.deleteComputed(columnName, derived.trigger)
+		}
+		c.cols.DeleteColumn(indexName)
+		c.changed()
+		return nil
+	}
+
 	if _, ok := column.Column.(computed); !ok {
 		return fmt.Errorf("column: unable to drop index, '%v' is not an index", indexName)
 	}
 
-	// Figure out the associated column and delete the index from that
+	// Figure out the associated columns and delete the index from them
 	columnName := column.Column.(computed).Column()
+	if index, ok := column.Column.(*columnIndex); ok {
+		for _, name := range index.others {
+			c.cols.deleteComputed(name, index.trigger)
+		}
+	}
+
 	c.cols.DeleteIndex(columnName, indexName)
 	c.cols.DeleteColumn(indexName)
+	c.changed()
 	return nil
 }
 
@@ -352,27 +656,117 @@ func (c *Collection) QueryAt(idx uint32, fn func(Row) error) error {
 // Query creates a transaction which allows for filtering and iteration over the
 // columns in this collection. It also allows for individual rows to be modified or
 // deleted during iteration (range), but the actual operations will be queued and
-// executed after the iteration.
+// executed after the iteration. Hence, the reads within the transaction do not observe
+// its own pending changes. The query uses the ReadCommitted consistency level.
 func (c *Collection) Query(fn func(txn *Txn) error) error {
+	return c.QueryWith(ReadCommitted, fn)
+}
+
+// Consistency represents the read consistency level of a query.
+type Consistency uint8
+
+const (
+	// ReadCommitted reads each chunk of the collection under its own lock, so every chunk
+	// reflects a set of fully applied commits. However, a commit applied while the query
+	// is running may be observed in some chunks but not in others. This is the cheapest
+	// level since writers are only blocked for the chunk being read, and is suitable for
+	// analytical queries.
+	ReadCommitted Consistency = iota
+
+	// ReadSnapshot holds the read locks of all chunks for the entire duration of the query,
+	// so all of the reads observe a single state of the collection. Commits of concurrent
+	// transactions wait until the query completes. A ReadSnapshot query must not start
+	// another query on the same collection from within its callback.
+	ReadSnapshot
+)
+
+// QueryWith creates a transaction similarly to Query(), using the specified read
+// consistency level.
+func (c *Collection) QueryWith(level Consistency, fn func(txn *Txn) error) error {
+	return c.query(level, fn, nil)
+}
+
+// QueryInfo creates a transaction similarly to Query() and returns the information about
+// the changes it has committed, which can be used to log or meter the transactions.
+func (c *Collection) QueryInfo(fn func(txn *Txn) error) (info CommitInfo, err error) {
+	err = c.query(ReadCommitted, fn, &info)
+	return
+}
+
+// query executes a transaction with the read consistency level and optionally collects
+// the information about the commit.
+func (c *Collection) query(level Consistency, fn func(txn *Txn) error, info *CommitInfo) error {
 	txn := c.txns.acquire(c)
+	txn.tracer.begin(c.options().Logging.SlowQueries != nil)
+	if level == ReadSnapshot {
+		txn.lockStable()
+	}
+
+	// Execute the query and keep the error for later, the read locks must be released
+	// before committing since the commit acquires the write locks.
+	err := c.execute(txn, fn)
+	txn.unlockStable()
+	if txn.hints.latency > 0 {
+		c.latency.observe(time.Since(txn.hints.start), txn.hints.stride)
+	}
+	if err == nil {
+		err = txn.checkReadOnly()
+	}
+	if err == nil {
+		err = txn.checkOverflow()
+	}
+	if err == nil {
+		err = txn.checkSampled()
+	}
+	if err == nil {
+		err = txn.checkWrites()
+	}
+	if err == nil {
+		err = txn.corrupt
+	}
 
-	// Execute the query and keep the error for later
-	if err := fn(txn); err != nil {
+	// The changes flushed by the transaction are published even if it rolls back, since
+	// they were already applied to the collection.
+	flushed := txn.publishFlushed()
+	if err != nil {
 		txn.rollback()
+		txn.unlockExclusive()
+		c.observeSlow(txn, err)
 		c.txns.release(txn)
+		if c.options().Metrics != nil && flushed.Version > 0 {
+			c.options().Metrics.OnCommit(flushed)
+		}
 		return err
 	}
 
 	// Now that the iteration has finished, we can range over the pending action
 	// queue and apply all of the actions that were requested by the Selector.
-	txn.commit()
+	if info == nil && c.options().Metrics != nil {
+		info = new(CommitInfo)
+	}
+
+	txn.commit(info)
+	txn.unlockExclusive()
+	err = txn.logged
+	c.observeSlow(txn, err)
+	if info != nil {
+		info.add(flushed)
+	}
+
 	c.txns.release(txn)
-	return nil
+
+	if c.options().Metrics != nil && info.Version > 0 {
+		c.options().Metrics.OnCommit(*info)
+	}
+	return err
 }
 
 // Close closes the collection and clears up all of the resources.
 func (c *Collection) Close() error {
 	c.cancel()
+	if c.outbox != nil {
+		c.outbox.close()
+	}
 	return nil
 }
 
@@ -392,6 +786,14 @@ func (c *Collection) UpsertKey(key string, fn func(Row) error) error {
 	})
 }
 
+// InsertOrMerge inserts or merges a row given its corresponding primary key, within a single
+// transaction. See Txn.InsertOrMerge() for more details.
+func (c *Collection) InsertOrMerge(key string, object map[string]any, merge func(column string, current, incoming any) any) error {
+	return c.Query(func(txn *Txn) error {
+		return txn.InsertOrMerge(key, object, merge)
+	})
+}
+
 // QueryKey queries/updates a row given its corresponding primary key.
 func (c *Collection) QueryKey(key string, fn func(Row) error) error {
 	return c.Query(func(txn *Txn) error {
@@ -406,6 +808,40 @@ func (c *Collection) DeleteKey(key string) error {
 	})
 }
 
+// DeleteKeys deletes the rows for the given primary keys within a single transaction, which
+// is much faster than deleting them one by one, and returns the number of rows which existed.
+func (c *Collection) DeleteKeys(keys []string) (deleted int) {
+	c.Query(func(txn *Txn) error {
+		deleted = txn.DeleteKeys(keys)
+		return nil
+	})
+	return
+}
+
+// Keys iterates over all of the primary keys of the collection in ascending order, until the
+// function returns false. See KeysWithPrefix() for more details.
+func (c *Collection) Keys(fn func(key string, idx uint32) bool) error {
+	return c.KeysWithPrefix("", fn)
+}
+
+// KeysWithPrefix iterates over the primary keys which start with the prefix in ascending order,
+// along with the index of their row, until the function returns false. This allows to scan the
+// keys such as "user:42:" similarly to a key-value store. The matching keys are collected
+// upfront from the ordered index of the keys, so the rows may be modified by the function.
+func (c *Collection) KeysWithPrefix(prefix string, fn func(key string, idx uint32) bool) error {
+	if c.pk == nil {
+		return errNoKey
+	}
+
+	keys := c.pk.keysWithPrefix(prefix)
+	for _, key := range keys {
+		if idx, ok := c.pk.OffsetOf(key); ok && !fn(key, idx) {
+			return nil
+		}
+	}
+	return nil
+}
+
 // --------------------------- column registry ---------------------------
 
 // columns represents a concurrent column registry.
@@ -459,20 +895,28 @@ func (c *columns) RangeUntil(fn func(column *column) error) error {
 	return nil
 }
 
-// Load loads a column by its name.
+// Load loads a column by its name, restoring it if it was restored lazily.
 func (c *columns) Load(columnName string) (*column, bool) {
-	cols := c.cols.Load().([]columnEntry)
-	for _, v := range cols {
-		if v.name == columnName {
-			col := v.cols[0]
-			return col, col != nil
-		}
+	cols, ok := c.lookup(columnName)
+	if !ok || cols[0] == nil {
+		return nil, false
 	}
-	return nil, false
+
+	cols[0].restore()
+	return cols[0], true
 }
 
 // LoadWithIndex loads a column by its name along with the triggers.
 func (c *columns) LoadWithIndex(columnName string) ([]*column, bool) {
+	cols, ok := c.lookup(columnName)
+	if ok && cols[0] != nil {
+		cols[0].restore()
+	}
+	return cols, ok
+}
+
+// lookup finds a column by its name along with the triggers, without restoring it.
+func (c *columns) lookup(columnName string) ([]*column, bool) {
 	cols := c.cols.Load().([]columnEntry)
 	for _, v := range cols {
 		if v.name == columnName {
@@ -529,6 +973,11 @@ func (c *columns) DeleteColumn(columnName string) {
 // Delete deletes a column from the registry.
 func (c *columns) DeleteIndex(columnName, indexName string) {
 	index, _ := c.Load(indexName)
+	c.deleteComputed(columnName, index)
+}
+
+// deleteComputed deletes a computed column of a column from the registry.
+func (c *columns) deleteComputed(columnName string, index *column) {
 	columns := c.cols.Load().([]columnEntry)
 	for i, v := range columns {
 		if v.name != columnName {
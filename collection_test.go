@@ -4,6 +4,7 @@
 package column
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -424,13 +425,76 @@ func TestExpire(t *testing.T) {
 	assert.Equal(t, 1, col.Count())
 
 	// Perform a cleanup every microsecond for tests
-	go col.vacuum(ctx, time.Microsecond)
+	go col.vacuum(ctx, time.Microsecond, nil)
 
 	// Wait a bit, should be cleaned up
 	time.Sleep(100 * time.Millisecond)
 	assert.Equal(t, 0, col.Count())
 }
 
+func TestExpireValues(t *testing.T) {
+	col := NewCollection(Options{Vacuum: -1})
+	col.CreateColumn("name", ForString())
+	col.CreateColumn("buff", ForString(WithTTL[string](50*time.Millisecond)))
+	col.CreateColumn("power", ForInt(WithTTL[int](time.Hour)))
+	defer col.Close()
+
+	for i := 0; i < 10; i++ {
+		col.Insert(func(r Row) error {
+			r.SetString("name", fmt.Sprintf("player-%d", i))
+			r.SetString("buff", "haste")
+			r.SetInt("power", i)
+			return nil
+		})
+	}
+
+	// Refresh the buff of a few players, after which the others expire
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, col.Query(func(txn *Txn) error {
+		buff := txn.String("buff")
+		return txn.WithInt("power", func(v int64) bool {
+			return v < 3
+		}).Range(func(idx uint32) {
+			buff.Set("haste")
+		})
+	}))
+
+	count := func(filter func(txn *Txn) *Txn) (n int) {
+		col.Query(func(txn *Txn) error {
+			n = filter(txn).Count()
+			return nil
+		})
+		return
+	}
+
+	expired := func(txn *Txn) *Txn { return txn.WithExpired("buff") }
+	hasBuff := func(txn *Txn) *Txn { return txn.With("buff") }
+	assert.Equal(t, 7, count(expired))
+	assert.Equal(t, 10, count(hasBuff))
+
+	// The vacuum removes the expired values, but not the rows
+	col.expireValues()
+	assert.Equal(t, 7, count(expired))
+	assert.Equal(t, 3, count(hasBuff))
+	assert.Equal(t, 10, col.Count())
+	assert.Equal(t, 0, count(func(txn *Txn) *Txn { return txn.WithExpired("power") }))
+	assert.Equal(t, 0, count(func(txn *Txn) *Txn { return txn.WithExpired("name") }))
+
+	// Setting a new value, or deleting the row, removes it from the expired ones
+	assert.NoError(t, col.QueryAt(5, func(r Row) error {
+		r.SetString("buff", "shield")
+		return nil
+	}))
+	assert.True(t, col.DeleteAt(9))
+	assert.Equal(t, 5, count(expired))
+	assert.Equal(t, 4, count(hasBuff))
+
+	// Once dropped, the expiration column is dropped as well
+	col.DropColumn("buff")
+	_, ok := col.cols.Load(expireOf("buff"))
+	assert.False(t, ok)
+}
+
 func TestExpireExtend(t *testing.T) {
 	col := loadPlayers(500)
 	assert.NoError(t, col.Query(func(txn *Txn) error {
@@ -498,6 +562,167 @@ func TestCreateIndex(t *testing.T) {
 	})
 }
 
+func TestCreateAsyncIndex(t *testing.T) {
+	col := NewCollection()
+	col.CreateColumn("age", ForInt())
+	defer col.Close()
+
+	for i := 0; i < 100; i++ {
+		col.Insert(func(r Row) error {
+			r.SetInt("age", i)
+			return nil
+		})
+	}
+
+	// The index is built synchronously for the existing rows
+	assert.Error(t, col.CreateAsyncIndex("young", "age", 0, func(r Reader) bool {
+		return r.Int() < 50
+	}))
+	assert.NoError(t, col.CreateAsyncIndex("young", "age", 20*time.Millisecond, func(r Reader) bool {
+		return r.Int() < 50
+	}))
+	assert.Error(t, col.CreateDerivedIndex("old", Not("young")))
+	count := func() (n int) {
+		col.Query(func(txn *Txn) error {
+			n = txn.With("young").Count()
+			return nil
+		})
+		return
+	}
+
+	assert.Equal(t, 50, count())
+
+	// The updates are reflected after the delay, but the deletes are immediate
+	col.Query(func(txn *Txn) error {
+		return txn.Range(func(idx uint32) {
+			txn.Int("age").Set(int(idx) + 50)
+		})
+	})
+	assert.True(t, col.DeleteAt(99))
+	assert.Equal(t, 50, count())
+	assert.NoError(t, CheckInvariants(col))
+	assert.True(t, col.DeleteAt(0))
+	assert.Equal(t, 49, count())
+	assert.Eventually(t, func() bool {
+		return count() == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.NoError(t, CheckInvariants(col))
+}
+
+func TestCreateIndexOf(t *testing.T) {
+	col := NewCollection()
+	col.CreateColumn("balance", ForFloat64())
+	col.CreateColumn("active", ForBool())
+	col.CreateColumn("name", ForString())
+	defer col.Close()
+
+	for i := 0; i < 100; i++ {
+		col.Insert(func(r Row) error {
+			r.SetFloat64("balance", float64(i*100))
+			r.SetBool("active", i%2 == 0)
+			r.SetString("name", fmt.Sprintf("player-%d", i))
+			return nil
+		})
+	}
+
+	assert.Error(t, col.CreateIndexOf("rich", nil, nil))
+	assert.Error(t, col.CreateIndexOf("rich", []string{"balance", "invalid"}, func(r Reader) bool {
+		return false
+	}))
+	assert.NoError(t, col.CreateIndexOf("rich", []string{"balance", "active"}, func(r Reader) bool {
+		active, ok := r.Lookup("active")
+		return ok && active.Bool() && r.Float() >= 5000
+	}))
+	assert.NoError(t, col.CreateDerivedIndex("poor", Not("rich")))
+	count := func(indexName string) (n int) {
+		col.Query(func(txn *Txn) error {
+			n = txn.With(indexName).Count()
+			return nil
+		})
+		return
+	}
+
+	assert.Equal(t, 25, count("rich"))
+	assert.Equal(t, 75, count("poor"))
+
+	// The index is updated when either of the columns changes
+	assert.NoError(t, col.QueryAt(51, func(r Row) error {
+		r.SetBool("active", true)
+		return nil
+	}))
+	assert.NoError(t, col.QueryAt(50, func(r Row) error {
+		r.SetFloat64("balance", 0)
+		return nil
+	}))
+	assert.Equal(t, 25, count("rich"))
+	assert.Equal(t, 75, count("poor"))
+	assert.NoError(t, col.QueryAt(52, func(r Row) error {
+		r.SetBool("active", false)
+		return nil
+	}))
+	assert.Equal(t, 24, count("rich"))
+	assert.Equal(t, 76, count("poor"))
+	assert.NoError(t, CheckInvariants(col))
+
+	// The lookups read the values of the other columns
+	assert.NoError(t, col.CreateIndex("first", "balance", func(r Reader) bool {
+		name, _ := r.Lookup("name")
+		_, missing := r.Lookup("invalid")
+		return !missing && name.String() == "player-1"
+	}))
+	assert.Equal(t, 1, count("first"))
+
+	// Once dropped, the index is no longer attached to the other columns
+	assert.NoError(t, col.DropIndex("poor"))
+	assert.NoError(t, col.DropIndex("rich"))
+	columns, _ := col.cols.lookup("active")
+	assert.Len(t, columns, 1)
+}
+
+func TestCreateEnumIndex(t *testing.T) {
+	col := NewCollection()
+	col.CreateColumn("class", ForEnum())
+	col.CreateColumn("name", ForString())
+	defer col.Close()
+
+	classes := []string{"mage", "rogue", "warrior", "druid"}
+	for i := 0; i < 1000; i++ {
+		col.Insert(func(r Row) error {
+			r.SetEnum("class", classes[i%4])
+			return nil
+		})
+	}
+
+	// The function is only evaluated once per distinct value
+	var evaluated []string
+	assert.Error(t, col.CreateEnumIndex("caster", "invalid", func(uint32, string) bool { return false }))
+	assert.Error(t, col.CreateEnumIndex("caster", "name", func(uint32, string) bool { return false }))
+	assert.NoError(t, col.CreateEnumIndex("caster", "class", func(id uint32, value string) bool {
+		evaluated = append(evaluated, value)
+		return value == "mage" || value == "druid"
+	}))
+	assert.ElementsMatch(t, classes, evaluated)
+
+	// Updating the rows with the known values does not evaluate it again
+	col.Query(func(txn *Txn) error {
+		return txn.Range(func(idx uint32) {
+			txn.Enum("class").Set(classes[(idx+1)%4])
+		})
+	})
+	assert.Len(t, evaluated, 4)
+	assert.NoError(t, col.QueryAt(0, func(r Row) error {
+		r.SetEnum("class", "priest")
+		return nil
+	}))
+	assert.Len(t, evaluated, 5)
+
+	col.Query(func(txn *Txn) error {
+		assert.Equal(t, 500, txn.With("caster").Count())
+		return nil
+	})
+	assert.NoError(t, CheckInvariants(col))
+}
+
 func TestCreateIndexInvalidColumn(t *testing.T) {
 	col := NewCollection()
 	defer col.Close()
@@ -543,6 +768,101 @@ func TestDropColumnNotIndex(t *testing.T) {
 	assert.Error(t, col.DropIndex("age"))
 }
 
+func TestCreateDerivedIndex(t *testing.T) {
+	col := NewCollection()
+	col.CreateColumn("status", ForString())
+	col.CreateColumn("strikes", ForInt())
+	col.CreateColumn("age", ForInt())
+	defer col.Close()
+
+	for i := 0; i < 1000; i++ {
+		col.Insert(func(r Row) error {
+			r.SetString("status", []string{"active", "idle"}[i%2])
+			r.SetInt("strikes", i%5)
+			r.SetInt("age", i%100)
+			return nil
+		})
+	}
+
+	assert.NoError(t, col.CreateIndex("active", "status", func(r Reader) bool {
+		return r.String() == "active"
+	}))
+	assert.NoError(t, col.CreateIndex("banned", "strikes", func(r Reader) bool {
+		return r.Int() >= 3
+	}))
+	assert.NoError(t, col.CreateIndex("adult", "age", func(r Reader) bool {
+		return r.Int() >= 18
+	}))
+
+	// The index is computed for the existing rows
+	assert.NoError(t, col.CreateDerivedIndex("eligible", And("active", Not("banned"))))
+	assert.NoError(t, col.CreateDerivedIndex("adult-eligible", And("eligible", "adult")))
+	count := func(indexName string) (n int) {
+		col.Query(func(txn *Txn) error {
+			n = txn.With(indexName).Count()
+			return nil
+		})
+		return
+	}
+
+	assert.Equal(t, 300, count("eligible"))
+	assert.Equal(t, 240, count("adult-eligible"))
+
+	// The index is maintained when the underlying columns change
+	assert.NoError(t, col.QueryAt(0, func(r Row) error {
+		r.SetInt("strikes", 4)
+		return nil
+	}))
+	assert.NoError(t, col.QueryAt(4, func(r Row) error {
+		r.SetInt("strikes", 0)
+		r.SetInt("age", 50)
+		return nil
+	}))
+	assert.NoError(t, col.QueryAt(1, func(r Row) error {
+		r.SetString("status", "active")
+		return nil
+	}))
+	assert.Equal(t, 301, count("eligible"))
+	assert.Equal(t, 241, count("adult-eligible"))
+
+	// Deleted rows are removed from the index
+	assert.True(t, col.DeleteAt(1))
+	assert.Equal(t, 300, count("eligible"))
+
+	// The index is rebuilt when restoring from a snapshot
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, col.Snapshot(buffer))
+	clone := NewCollection()
+	clone.CreateColumn("status", ForString())
+	clone.CreateColumn("strikes", ForInt())
+	clone.CreateIndex("active", "status", func(r Reader) bool { return r.String() == "active" })
+	clone.CreateIndex("banned", "strikes", func(r Reader) bool { return r.Int() >= 3 })
+	assert.NoError(t, clone.CreateDerivedIndex("eligible", And("active", Not("banned"))))
+	assert.NoError(t, clone.Restore(buffer))
+	clone.Query(func(txn *Txn) error {
+		assert.Equal(t, 300, txn.With("eligible").Count())
+		return nil
+	})
+
+	// Invalid expressions
+	assert.Error(t, col.CreateDerivedIndex("", And("active")))
+	assert.Error(t, col.CreateDerivedIndex("eligible", And("active")))
+	assert.Error(t, col.CreateDerivedIndex("x", And("active", "missing")))
+	assert.Error(t, col.CreateDerivedIndex("x", And("active", "age")))
+	assert.Error(t, col.CreateDerivedIndex("x", Or("active", 42)))
+	assert.Error(t, col.CreateDerivedIndex("x", Or()))
+
+	// Once dropped, the index is no longer maintained
+	assert.NoError(t, col.DropIndex("adult-eligible"))
+	assert.NoError(t, col.DropIndex("eligible"))
+	assert.NoError(t, col.QueryAt(2, func(r Row) error {
+		r.SetInt("strikes", 4)
+		return nil
+	}))
+	columns, _ := col.cols.LoadWithIndex("strikes")
+	assert.Len(t, columns, 2)
+}
+
 func TestDropOneOfMultipleIndices(t *testing.T) {
 	col := NewCollection()
 	col.CreateColumn("age", ForInt())
@@ -680,6 +1000,71 @@ func TestParallelSort(t *testing.T) {
 	assert.Equal(t, 100_000, col.Count())
 }
 
+func TestQueryWithSnapshot(t *testing.T) {
+	const rows = 4 * chunkSize
+	col := NewCollection()
+	col.CreateColumn("balance", ForInt())
+	col.Query(func(txn *Txn) error {
+		for i := 0; i < rows; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetInt("balance", 10)
+				return nil
+			})
+		}
+		return nil
+	})
+
+	// Writer, moves the balance between the first and the last chunk in a single commit
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			col.Query(func(txn *Txn) error {
+				balance := txn.Int("balance")
+				txn.QueryAt(uint32(i), func(r Row) error {
+					balance.Merge(-1)
+					return nil
+				})
+				txn.QueryAt(uint32(rows-1-i), func(r Row) error {
+					balance.Merge(1)
+					return nil
+				})
+				return nil
+			})
+		}
+	}()
+
+	// Reader, the total must always be the same
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, col.QueryWith(ReadSnapshot, func(txn *Txn) error {
+			assert.True(t, txn.stable)
+			assert.Equal(t, 10*rows, txn.Int("balance").Sum())
+			return nil
+		}))
+	}
+	wg.Wait()
+
+	// A snapshot query can also write, once the reads are done
+	assert.NoError(t, col.QueryWith(ReadSnapshot, func(txn *Txn) error {
+		return txn.QueryAt(0, func(r Row) error {
+			r.SetInt("balance", 100)
+			return nil
+		})
+	}))
+
+	// The locks must be released, even on error
+	assert.Error(t, col.QueryWith(ReadSnapshot, func(txn *Txn) error {
+		return fmt.Errorf("boom")
+	}))
+	col.QueryAt(0, func(r Row) error {
+		v, _ := r.Int("balance")
+		assert.Equal(t, 100, v)
+		r.SetInt("balance", 10)
+		return nil
+	})
+}
+
 func TestConcurrentPointReads(t *testing.T) {
 	obj := map[string]any{
 		"name":   "Roman",
@@ -888,11 +1273,111 @@ func TestTriggerImpl(t *testing.T) {
 	})
 }
 
+func TestAggregateRegister(t *testing.T) {
+	players := loadPlayers(500)
+	assert.NoError(t, players.RegisterAggregate("count", Count("balance")))
+	assert.NoError(t, players.RegisterAggregate("sum", Sum("balance")))
+	assert.NoError(t, players.RegisterAggregate("avg", Avg("balance")))
+	assert.NoError(t, players.RegisterAggregate("min", Min("balance")))
+	assert.NoError(t, players.RegisterAggregate("max", Max("balance")))
+
+	// Aggregates must match the values recomputed from scratch
+	assertAggregates := func() {
+		acc := new(accumulator)
+		players.Query(func(txn *Txn) error {
+			balance := txn.Float64("balance")
+			return txn.Range(func(idx uint32) {
+				v, _ := balance.Get()
+				acc.add(v, int64(idx))
+			})
+		})
+
+		for name, agg := range map[string]Aggregation{
+			"count": AggCount, "sum": AggSum, "avg": AggAvg, "min": AggMin, "max": AggMax,
+		} {
+			v, ok := players.Aggregate(name)
+			assert.True(t, ok)
+			assert.InDelta(t, acc.result(agg), v, 1e-6, name)
+		}
+	}
+
+	assertAggregates()
+
+	// Insert, update and delete a few rows, including the extremes
+	players.Insert(func(r Row) error {
+		r.SetFloat64("balance", 100000)
+		return nil
+	})
+	players.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		return txn.Range(func(idx uint32) {
+			if idx%10 == 0 {
+				balance.Merge(10)
+			}
+		})
+	})
+
+	assertAggregates()
+	players.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		txn.WithFloat("balance", func(v float64) bool {
+			return v > 4000
+		}).DeleteAll()
+		txn.QueryAt(1, func(r Row) error {
+			balance.Set(-1)
+			return nil
+		})
+		return nil
+	})
+	assertAggregates()
+
+	// Dropping the aggregate removes it
+	assert.NoError(t, players.DropAggregate("sum"))
+	assert.Error(t, players.DropAggregate("sum"))
+	assert.Error(t, players.DropAggregate("balance"))
+	_, ok := players.Aggregate("sum")
+	assert.False(t, ok)
+	_, ok = players.Aggregate("balance")
+	assert.False(t, ok)
+}
+
+func TestAggregateInvalid(t *testing.T) {
+	players := newEmpty(10)
+	assert.Error(t, players.RegisterAggregate("sum", Sum("invalid")))
+	assert.Error(t, players.RegisterAggregate("sum", Sum("name")))
+	assert.Error(t, players.RegisterAggregate("sum", Aggregate{Func: AggFirst, Column: "balance"}))
+	assert.Error(t, players.RegisterAggregate("balance", Sum("balance")))
+
+	// Empty aggregates
+	assert.NoError(t, players.RegisterAggregate("sum", Sum("balance")))
+	assert.NoError(t, players.RegisterAggregate("count", Count("balance")))
+	_, ok := players.Aggregate("sum")
+	assert.False(t, ok)
+	count, ok := players.Aggregate("count")
+	assert.True(t, ok)
+	assert.Equal(t, 0.0, count)
+}
+
+func TestAggregateImpl(t *testing.T) {
+	column := &columnAggregate{name: "target"}
+	v, ok := column.Value(0)
+
+	assert.Nil(t, v)
+	assert.False(t, ok)
+	assert.False(t, column.Contains(0))
+	assert.Nil(t, column.Index(0))
+	assert.Equal(t, "target", column.Column())
+	assert.NotPanics(t, func() {
+		column.Grow(100)
+		column.Snapshot(0, nil)
+	})
+}
+
 // --------------------------- Mocks & Fixtures ----------------------------
 
 // loadPlayers loads a list of players from the fixture
-func loadPlayers(amount int) *Collection {
-	out := newEmpty(amount)
+func loadPlayers(amount int, opts ...Options) *Collection {
+	out := newEmpty(amount, opts...)
 
 	// Load and copy until we reach the amount required
 	data := fixtures.Players()
@@ -926,12 +1411,12 @@ func insertPlayers(dst *Collection, data []fixtures.Player) error {
 }
 
 // newEmpty creates a new empty collection for a the fixture
-func newEmpty(capacity int) *Collection {
-	out := NewCollection(Options{
+func newEmpty(capacity int, opts ...Options) *Collection {
+	out := NewCollection(append([]Options{{
 		Capacity: capacity,
 		Vacuum:   500 * time.Millisecond,
 		Writer:   new(noopWriter),
-	})
+	}}, opts...)...)
 
 	// Load the items into the collection
 	out.CreateColumn("serial", ForString())
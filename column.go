@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kelindar/bitmap"
 	"github.com/kelindar/column/commit"
@@ -34,17 +36,36 @@ func typeOf(column Column) (typ columnType) {
 
 // --------------------------- Contracts ----------------------------
 
-// Column represents a column implementation
+// Column represents a column implementation. Custom column types can be implemented
+// outside of this package by satisfying this contract and registering a constructor
+// with Register(). All of the methods are called by the collection while holding the
+// appropriate chunk lock, hence implementations do not need to synchronize their data.
 type Column interface {
+
+	// Grow is called when the collection grows and must make sure that the column
+	// can store a value at the specified index.
 	Grow(idx uint32)
+
+	// Apply applies the operations of a commit for a specific chunk. The reader only
+	// contains operations for that chunk, and must be iterated by calling Next().
 	Apply(commit.Chunk, *commit.Reader)
+
+	// Value retrieves a value at a specified index, or false if not present.
 	Value(idx uint32) (interface{}, bool)
+
+	// Contains checks whether the column has a value at a specified index.
 	Contains(idx uint32) bool
+
+	// Index returns the fill list (presence bitmap) for a specified chunk.
 	Index(commit.Chunk) bitmap.Bitmap
+
+	// Snapshot writes the entire chunk of the column into the destination buffer, by
+	// encoding the values as commit operations that can be re-applied with Apply().
 	Snapshot(chunk commit.Chunk, dst *commit.Buffer)
 }
 
-// Numeric represents a column that stores numbers.
+// Numeric represents a column that stores numbers. Implementing this contract allows
+// a column to be used with numeric filters such as WithFloat(), WithInt() or WithUint().
 type Numeric interface {
 	Column
 	LoadFloat64(uint32) (float64, bool)
@@ -55,7 +76,8 @@ type Numeric interface {
 	FilterInt64(commit.Chunk, bitmap.Bitmap, func(v int64) bool)
 }
 
-// Textual represents a column that stores strings.
+// Textual represents a column that stores strings. Implementing this contract allows
+// a column to be used with string filters such as WithString().
 type Textual interface {
 	Column
 	LoadString(uint32) (string, bool)
@@ -114,11 +136,142 @@ func ForKind(kind reflect.Kind) (Column, error) {
 	}
 }
 
+// --------------------------- Registry ----------------------------
+
+// registry contains the named column constructors
+var registry = struct {
+	sync.RWMutex
+	byName map[string]func() Column
+	byType map[reflect.Type]string // The names of the built-in types
+}{
+	byName: make(map[string]func() Column, 16),
+	byType: make(map[reflect.Type]string, 16),
+}
+
+func init() {
+	for _, builtin := range []struct {
+		name string
+		fn   func() Column
+	}{
+		{"string", func() Column { return makeStrings() }},
+		{"float32", func() Column { return makeFloat32s() }},
+		{"float64", func() Column { return makeFloat64s() }},
+		{"int", func() Column { return makeInts() }},
+		{"int16", func() Column { return makeInt16s() }},
+		{"int32", func() Column { return makeInt32s() }},
+		{"int64", func() Column { return makeInt64s() }},
+		{"uint", func() Column { return makeUints() }},
+		{"uint16", func() Column { return makeUint16s() }},
+		{"uint32", func() Column { return makeUint32s() }},
+		{"uint64", func() Column { return makeUint64s() }},
+		{"bool", makeBools},
+		{"enum", makeEnum},
+		{"key", makeKey},
+		{"sequence", ForSequence},
+		{"packed", func() Column { return ForPacked() }},
+	} {
+		if err := Register(builtin.name, builtin.fn); err != nil {
+			panic(err)
+		}
+
+		// The sequence shares the type of the uint64 column, it is found by its stamp instead
+		if typ := reflect.TypeOf(builtin.fn()); builtin.name != "sequence" {
+			registry.byType[typ] = builtin.name
+		}
+	}
+}
+
+// Register registers a named column constructor, allowing custom column types to be
+// created by their name using ForType(). This is typically called in an init() function
+// of the package that implements the custom column. In order to be recorded in the schema
+// of the snapshots, and created when restoring into a collection which does not have it,
+// a custom column must also implement a TypeName() method which returns its registered name.
+func Register(typeName string, constructor func() Column) error {
+	if typeName == "" || constructor == nil {
+		return fmt.Errorf("column: register must specify a type name and a constructor")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.byName[typeName]; ok {
+		return fmt.Errorf("column: unable to register '%s', already exists", typeName)
+	}
+
+	registry.byName[typeName] = constructor
+	return nil
+}
+
+// ForType creates a new column instance for a type name which was previously registered
+// using Register(). Built-in columns are registered by the name of their type, e.g.
+// "float64", "string", "bool" or "enum".
+func ForType(typeName string) (Column, error) {
+	registry.RLock()
+	fn, ok := registry.byName[typeName]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("column: unsupported column type '%s'", typeName)
+	}
+
+	return fn(), nil
+}
+
+// typeName returns the registered name of the type of the column, or an empty string if
+// the column can not be created by its name.
+func (c *column) typeName() string {
+	if _, seq := c.stampMode(); seq != nil {
+		return "sequence"
+	}
+
+	if named, ok := c.Column.(interface{ TypeName() string }); ok {
+		return named.TypeName()
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.byType[reflect.TypeOf(c.Column)]
+}
+
 // --------------------------- Generic Options ----------------------------
 
 // option represents options for variouos columns.
 type option[T any] struct {
-	Merge func(value, delta T) T
+	Merge    func(value, delta T) T
+	Stamp    stampMode     // The automatic stamping mode
+	ReadOnly bool          // Whether the values can only be set on insert
+	TTL      time.Duration // The duration after which the values expire
+	Mask     func(any) any // The function which masks the values on read
+	Overflow Overflow      // The behavior of the default merge on overflow
+	seq      *sequence     // The sequence for sequence columns
+}
+
+// stampMode represents the mode in which a column is automatically populated during
+// the commit, either with the current time or with the next value of a sequence.
+type stampMode uint8
+
+const (
+	stampInsert   stampMode = 1 << iota // Stamp on insert
+	stampUpdate                         // Stamp on update
+	stampSequence                       // Stamp with a sequence instead of the time
+)
+
+// autoStamp returns the automatic stamping mode of the column.
+func (o option[T]) autoStamp() (stampMode, *sequence) {
+	return o.Stamp, o.seq
+}
+
+// readOnly returns whether the column rejects the updates of existing rows.
+func (o option[T]) readOnly() bool {
+	return o.ReadOnly
+}
+
+// valueTTL returns the duration after which the values of the column expire.
+func (o option[T]) valueTTL() time.Duration {
+	return o.TTL
+}
+
+// valueMask returns the function which masks the values of the column on read.
+func (o option[T]) valueMask() func(any) any {
+	return o.Mask
 }
 
 // configure applies options
@@ -137,14 +290,65 @@ func WithMerge[T any](fn func(value, delta T) T) func(*option[T]) {
 	}
 }
 
+// WithReadOnly marks the column as read-only. The values of a read-only column can only be
+// set when the row is inserted (e.g. by a loader), by the automatic stamping or when replaying
+// and restoring the collection. A transaction which attempts to update the column of an existing
+// row fails on commit and is rolled back, protecting system-managed fields from application bugs.
+func WithReadOnly[T any]() func(*option[T]) {
+	return func(v *option[T]) {
+		v.ReadOnly = true
+	}
+}
+
+// WithTTL sets the duration after which the values of the column expire. Every time a value
+// is set or merged, its expiration is extended and once it expires, the vacuum removes the
+// value while the row itself remains. This is typically used for temporary states, such as
+// status effects. The rows whose value has expired can be selected using WithExpired().
+func WithTTL[T any](ttl time.Duration) func(*option[T]) {
+	return func(v *option[T]) {
+		v.TTL = ttl
+	}
+}
+
+// WithMask sets a function which masks the values of the column whenever they are read, filtered
+// or exported, unless the transaction was unmasked with the Query.UnmaskToken of the collection.
+// The typed accessors report a value as missing if its mask is not of the type of the column.
+// This allows to redact the personal data for the analytics consumers without duplicating the
+// collection.
+func WithMask[T any](fn func(v any) any) func(*option[T]) {
+	return func(v *option[T]) {
+		v.Mask = fn
+	}
+}
+
+// WithAutoNow sets the column to be automatically populated with the current time (in unix
+// nanoseconds) when a row is inserted, unless a value was explicitly set by the transaction.
+// This is typically used for "created_at" columns.
+func WithAutoNow() func(*option[int64]) {
+	return func(v *option[int64]) {
+		v.Stamp |= stampInsert
+	}
+}
+
+// WithAutoUpdateNow sets the column to be automatically populated with the current time (in
+// unix nanoseconds) when a row is inserted or updated, unless a value was explicitly set by
+// the transaction. This is typically used for "updated_at" columns.
+func WithAutoUpdateNow() func(*option[int64]) {
+	return func(v *option[int64]) {
+		v.Stamp |= stampInsert | stampUpdate
+	}
+}
+
 // --------------------------- Column ----------------------------
 
 // column represents a column wrapper that synchronizes operations
 type column struct {
 	Column
-	lock sync.RWMutex // The lock to protect the entire column
-	kind columnType   // The type of the colum
-	name string       // The name of the column
+	lock    sync.RWMutex     // The lock to protect the entire column
+	kind    columnType       // The type of the colum
+	name    string           // The name of the column
+	lazy    int32            // Whether some snapshot pages are pending (atomic)
+	pending []*commit.Buffer // The snapshot pages deferred by a lazy restore
 }
 
 // columnFor creates a synchronized column for a column implementation
@@ -158,8 +362,12 @@ func columnFor(name string, v Column) *column {
 
 // IsIndex returns whether the column is an index
 func (c *column) IsIndex() bool {
-	_, ok := c.Column.(*columnIndex)
-	return ok
+	switch c.Column.(type) {
+	case *columnIndex, *columnDerived:
+		return true
+	default:
+		return false
+	}
 }
 
 // IsNumeric checks whether a column type supports certain numerical operations.
@@ -172,6 +380,41 @@ func (c *column) IsTextual() bool {
 	return (c.kind & typeTextual) == typeTextual
 }
 
+// stampMode returns the automatic stamping mode of the column along with its
+// sequence, if any.
+func (c *column) stampMode() (stampMode, *sequence) {
+	if v, ok := c.Column.(interface{ autoStamp() (stampMode, *sequence) }); ok {
+		return v.autoStamp()
+	}
+	return 0, nil
+}
+
+// valueTTL returns the duration after which the values of the column expire, or zero if
+// the values never expire.
+func (c *column) valueTTL() time.Duration {
+	if v, ok := c.Column.(interface{ valueTTL() time.Duration }); ok {
+		return v.valueTTL()
+	}
+	return 0
+}
+
+// valueMask returns the function which masks the values of the column on read, or nil if
+// the values are not masked.
+func (c *column) valueMask() func(any) any {
+	if v, ok := c.Column.(interface{ valueMask() func(any) any }); ok {
+		return v.valueMask()
+	}
+	return nil
+}
+
+// IsReadOnly returns whether the column only accepts values for the inserted rows.
+func (c *column) IsReadOnly() bool {
+	if v, ok := c.Column.(interface{ readOnly() bool }); ok {
+		return v.readOnly()
+	}
+	return false
+}
+
 // Grow grows the size of the column
 func (c *column) Grow(idx uint32) {
 	c.lock.Lock()
@@ -182,6 +425,7 @@ func (c *column) Grow(idx uint32) {
 
 // Apply performs a series of operations on a column.
 func (c *column) Apply(chunk commit.Chunk, r *commit.Reader) {
+	c.restore()
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
@@ -191,6 +435,7 @@ func (c *column) Apply(chunk commit.Chunk, r *commit.Reader) {
 
 // Index loads the appropriate column index for a given chunk
 func (c *column) Index(chunk commit.Chunk) bitmap.Bitmap {
+	c.restore()
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	return c.Column.Index(chunk)
@@ -202,23 +447,66 @@ func (c *column) Snapshot(chunk commit.Chunk, buffer *commit.Buffer) bool {
 		return false
 	}
 
+	c.restore()
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	buffer.Reset(c.name)
 	c.Column.Snapshot(chunk, buffer)
 	return true
 }
 
+// deferPage defers a snapshot page until the column is first accessed
+func (c *column) deferPage(page *commit.Buffer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending = append(c.pending, page)
+	atomic.StoreInt32(&c.lazy, 1)
+}
+
+// restore applies the snapshot pages which were deferred by a lazy restore, if any. This
+// is called whenever the column is accessed, so it must remain cheap once restored.
+func (c *column) restore() {
+	if atomic.LoadInt32(&c.lazy) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	reader := commit.NewReader()
+	for _, page := range c.pending {
+		page.RangeChunks(func(chunk commit.Chunk) {
+			reader.Range(page, chunk, func(r *commit.Reader) {
+				c.Column.Apply(chunk, r)
+			})
+		})
+	}
+
+	c.pending = nil
+	atomic.StoreInt32(&c.lazy, 0)
+}
+
 // Value retrieves a value at a specified index
 func (c *column) Value(idx uint32) (v interface{}, ok bool) {
+	c.restore()
 	v, ok = c.Column.Value(idx)
 	return
 }
 
+// Contains checks whether the column has a value at a specified index
+func (c *column) Contains(idx uint32) bool {
+	c.restore()
+	return c.Column.Contains(idx)
+}
+
 // --------------------------- Accessor  ----------------------------
 
 // Reader represents a generic reader
 type reader[T any] struct {
 	cursor *uint32
 	reader T
+	txn    *Txn
+	mask   func(any) any // The mask applied to the values, if any
 }
 
 // readerFor creates a read-only accessor
@@ -238,6 +526,8 @@ func readerFor[T any](txn *Txn, columnName string) reader[T] {
 	return reader[T]{
 		cursor: &txn.cursor,
 		reader: target,
+		txn:    txn,
+		mask:   txn.maskOf(columnName),
 	}
 }
 
@@ -257,16 +547,33 @@ func (s rwAny) Set(value any) error {
 // --------------------------- Any Reader ----------------------------
 
 // rdAny represents a read-only accessor for any value
-type rdAny reader[Column]
+type rdAny struct {
+	cursor *uint32
+	reader Column
+	txn    *Txn
+	mask   func(any) any // The mask applied to the values, if any
+}
 
-// Get loads the value at the current transaction cursor
+// Get loads the value at the current transaction cursor. If the column is masked, the
+// masked value is returned unless the transaction is unmasked.
 func (s rdAny) Get() (any, bool) {
-	return s.reader.Value(*s.cursor)
+	s.txn.checkRead(s.reader, *s.cursor)
+	v, ok := s.reader.Value(*s.cursor)
+	if ok && s.mask != nil {
+		v = s.mask(v)
+	}
+	return v, ok
 }
 
 // readAnyOf creates a new any reader
 func readAnyOf(txn *Txn, columnName string) rdAny {
-	return rdAny(readerFor[Column](txn, columnName))
+	r := readerFor[Column](txn, columnName)
+	return rdAny{
+		cursor: r.cursor,
+		reader: r.reader,
+		txn:    r.txn,
+		mask:   r.mask,
+	}
 }
 
 // Any returns a column accessor
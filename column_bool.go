@@ -87,7 +87,9 @@ type rdBool reader[Column]
 
 // Get loads the value at the current transaction cursor
 func (s rdBool) Get() bool {
-	return s.reader.Contains(*s.cursor)
+	s.txn.checkRead(s.reader, *s.cursor)
+	v, _ := maskAs(s.mask, s.reader.Contains(*s.cursor), true)
+	return v
 }
 
 // readBoolOf creates a new boolean reader
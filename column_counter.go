@@ -0,0 +1,241 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// --------------------------- Counter Column ----------------------------
+
+// columnCounter represents a column of counters which decay over a time window, such as
+// the number of requests per minute. Each counter keeps the count of the current and the
+// previous window, and the value is estimated as a sliding window over both of them.
+type columnCounter struct {
+	chunks[counter]
+	window int64        // The size of the window, in nanoseconds
+	now    func() int64 // The clock, in unix nanoseconds
+}
+
+// ForCounter creates a new column of counters which decay over the specified time window,
+// useful for tracking rates such as requests per minute alongside the entity data. The
+// counters are incremented with Increment() and their value is an estimate of the number
+// of increments during the last window, which gradually decays to zero without any writes.
+func ForCounter(window time.Duration) Column {
+	if window <= 0 {
+		panic(fmt.Errorf("column: counter window must be positive, got %v", window))
+	}
+
+	return &columnCounter{
+		chunks: make(chunks[counter], 0, 4),
+		window: int64(window),
+		now: func() int64 {
+			return time.Now().UnixNano()
+		},
+	}
+}
+
+// Apply applies a set of operations to the column.
+func (c *columnCounter) Apply(chunk commit.Chunk, r *commit.Reader) {
+	fill, data := c.chunkAt(chunk)
+	for r.Next() {
+		offset := r.IndexAtChunk()
+		switch r.Type {
+		case commit.Put:
+			fill[offset>>6] |= 1 << (offset & 0x3f)
+			data[offset] = readCounter(r.Bytes())
+		case commit.Merge:
+			if !fill.Contains(offset) {
+				data[offset] = counter{}
+			}
+
+			// Write back the resulting counter so that the commit log can be replayed
+			fill[offset>>6] |= 1 << (offset & 0x3f)
+			data[offset] = data[offset].merge(readCounter(r.Bytes()))
+			r.SwapBytes(data[offset].encode())
+		case commit.Delete:
+			fill.Remove(offset)
+		}
+	}
+}
+
+// load retrieves the estimated value of the counter at a specified index
+func (c *columnCounter) load(idx uint32) (int64, bool) {
+	chunk := commit.ChunkAt(idx)
+	index := idx - chunk.Min()
+	if int(chunk) < len(c.chunks) && c.chunks[chunk].fill.Contains(index) {
+		return c.chunks[chunk].data[index].load(c.now(), c.window), true
+	}
+	return 0, false
+}
+
+// Value retrieves a value at a specified index
+func (c *columnCounter) Value(idx uint32) (any, bool) {
+	return c.load(idx)
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *columnCounter) Contains(idx uint32) bool {
+	chunk := commit.ChunkAt(idx)
+	return int(chunk) < len(c.chunks) && c.chunks[chunk].fill.Contains(idx-chunk.Min())
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *columnCounter) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	fill, data := c.chunkAt(chunk)
+	fill.Range(func(x uint32) {
+		dst.PutBytes(commit.Put, chunk.Min()+x, data[x].encode())
+	})
+}
+
+// filter filters down the values based on the specified predicate.
+func (c *columnCounter) filter(chunk commit.Chunk, index bitmap.Bitmap, predicate func(int64) bool) {
+	if int(chunk) < len(c.chunks) {
+		now := c.now()
+		fill, data := c.chunkAt(chunk)
+		index.And(fill)
+		index.Filter(func(idx uint32) bool {
+			return predicate(data[idx].load(now, c.window))
+		})
+	}
+}
+
+// LoadFloat64 retrieves a float64 value at a specified index
+func (c *columnCounter) LoadFloat64(idx uint32) (float64, bool) {
+	v, ok := c.load(idx)
+	return float64(v), ok
+}
+
+// LoadInt64 retrieves an int64 value at a specified index
+func (c *columnCounter) LoadInt64(idx uint32) (int64, bool) {
+	return c.load(idx)
+}
+
+// LoadUint64 retrieves an uint64 value at a specified index
+func (c *columnCounter) LoadUint64(idx uint32) (uint64, bool) {
+	v, ok := c.load(idx)
+	return uint64(v), ok
+}
+
+// FilterFloat64 filters down the values based on the specified predicate.
+func (c *columnCounter) FilterFloat64(chunk commit.Chunk, index bitmap.Bitmap, predicate func(float64) bool) {
+	c.filter(chunk, index, func(v int64) bool { return predicate(float64(v)) })
+}
+
+// FilterInt64 filters down the values based on the specified predicate.
+func (c *columnCounter) FilterInt64(chunk commit.Chunk, index bitmap.Bitmap, predicate func(int64) bool) {
+	c.filter(chunk, index, predicate)
+}
+
+// FilterUint64 filters down the values based on the specified predicate.
+func (c *columnCounter) FilterUint64(chunk commit.Chunk, index bitmap.Bitmap, predicate func(uint64) bool) {
+	c.filter(chunk, index, func(v int64) bool { return predicate(uint64(v)) })
+}
+
+// --------------------------- Counter ----------------------------
+
+// counter represents the state of a windowed counter
+type counter struct {
+	window  int64 // The index of the current window since the epoch
+	current int64 // The count during the current window
+	prior   int64 // The count during the previous window
+}
+
+// readCounter decodes a counter from its binary representation
+func readCounter(b []byte) counter {
+	if len(b) < 24 {
+		return counter{}
+	}
+
+	return counter{
+		window:  int64(binary.BigEndian.Uint64(b[0:8])),
+		current: int64(binary.BigEndian.Uint64(b[8:16])),
+		prior:   int64(binary.BigEndian.Uint64(b[16:24])),
+	}
+}
+
+// encode encodes the counter into its binary representation
+func (c counter) encode() []byte {
+	b := make([]byte, 24)
+	binary.BigEndian.PutUint64(b[0:8], uint64(c.window))
+	binary.BigEndian.PutUint64(b[8:16], uint64(c.current))
+	binary.BigEndian.PutUint64(b[16:24], uint64(c.prior))
+	return b
+}
+
+// merge adds the count of a delta into the counter, shifting the windows forward if the
+// delta happened in a later window. Deltas older than the previous window are ignored.
+func (c counter) merge(delta counter) counter {
+	switch {
+	case delta.window == c.window:
+		c.current += delta.current
+	case delta.window == c.window+1:
+		c.prior, c.current = c.current, delta.current
+		c.window = delta.window
+	case delta.window > c.window+1:
+		c.prior, c.current = 0, delta.current
+		c.window = delta.window
+	case delta.window == c.window-1:
+		c.prior += delta.current
+	}
+	return c
+}
+
+// load estimates the count during the last window at the specified time, by weighting
+// the count of the previous window with the part of it which is still in the sliding window.
+func (c counter) load(now, window int64) int64 {
+	elapsed := float64(now%window) / float64(window)
+	switch at := now / window; {
+	case at < c.window:
+		return c.current + c.prior
+	case at == c.window:
+		return c.current + int64(float64(c.prior)*(1-elapsed))
+	case at == c.window+1:
+		return int64(float64(c.current) * (1 - elapsed))
+	default:
+		return 0
+	}
+}
+
+// --------------------------- Accessor ----------------------------
+
+// rwCounter represents a read-write accessor for windowed counters
+type rwCounter struct {
+	reader[*columnCounter]
+	writer *commit.Buffer
+}
+
+// Get loads the estimated value of the counter at the current transaction cursor
+func (s rwCounter) Get() (int64, bool) {
+	s.txn.checkRead(s.reader.reader, *s.cursor)
+	return s.reader.reader.load(*s.cursor)
+}
+
+// Increment atomically increments the counter at the current transaction cursor
+func (s rwCounter) Increment(delta int64) {
+	s.writer.PutBytes(commit.Merge, *s.cursor, counter{
+		window:  s.reader.reader.now() / s.reader.reader.window,
+		current: delta,
+	}.encode())
+}
+
+// Reset resets the counter at the current transaction cursor to zero
+func (s rwCounter) Reset() {
+	s.writer.PutBytes(commit.Put, *s.cursor, counter{
+		window: s.reader.reader.now() / s.reader.reader.window,
+	}.encode())
+}
+
+// Counter returns a read-write accessor for a windowed counter column
+func (txn *Txn) Counter(columnName string) rwCounter {
+	return rwCounter{
+		reader: readerFor[*columnCounter](txn, columnName),
+		writer: txn.bufferFor(columnName),
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// --------------------------- Index Expression ----------------------------
+
+// indexOp represents a boolean operation between indexes
+type indexOp uint8
+
+// Various supported boolean operations
+const (
+	opIndex indexOp = iota
+	opAnd
+	opOr
+	opNot
+)
+
+// IndexExpr represents a boolean combination of bitmap indexes, built using And(), Or() and
+// Not() on the names of the indexes, and used to create a derived index.
+type IndexExpr struct {
+	op       indexOp     // The boolean operation
+	name     string      // The name of the index, for the leaves
+	operands []IndexExpr // The operands of the operation
+	err      error       // The error while building the expression
+}
+
+// And combines the indexes, matching the rows which are present in all of them. Each operand
+// is either the name of an index or another expression.
+func And(indexes ...any) IndexExpr {
+	return combine(opAnd, indexes)
+}
+
+// Or combines the indexes, matching the rows which are present in any of them. Each operand
+// is either the name of an index or another expression.
+func Or(indexes ...any) IndexExpr {
+	return combine(opOr, indexes)
+}
+
+// Not negates the index, matching the rows which are not present in it. The operand is
+// either the name of an index or another expression.
+func Not(index any) IndexExpr {
+	return combine(opNot, []any{index})
+}
+
+// With matches the rows which are present in all of the specified columns, similarly to the
+// With() of a transaction. It is used to filter the values of an aggregate, for example in
+// SumWhere("balance", With("active")).
+func With(columns ...string) IndexExpr {
+	operands := make([]any, 0, len(columns))
+	for _, v := range columns {
+		operands = append(operands, v)
+	}
+	return combine(opAnd, operands)
+}
+
+// combine creates an expression for the specified operation and operands
+func combine(op indexOp, operands []any) IndexExpr {
+	expr := IndexExpr{op: op, operands: make([]IndexExpr, 0, len(operands))}
+	for _, v := range operands {
+		switch v := v.(type) {
+		case string:
+			expr.operands = append(expr.operands, IndexExpr{op: opIndex, name: v})
+		case IndexExpr:
+			expr.operands = append(expr.operands, v)
+		default:
+			expr.err = fmt.Errorf("column: invalid index operand of type %T", v)
+		}
+	}
+	return expr
+}
+
+// compile resolves the indexes of the expression and returns the names of the columns on
+// which the resulting index depends.
+func (e IndexExpr) compile(cols *columns, sources []string) (derivedExpr, []string, error) {
+	if e.err != nil {
+		return derivedExpr{}, nil, e.err
+	}
+
+	switch e.op {
+	case opIndex:
+		column, ok := cols.Load(e.name)
+		if !ok {
+			return derivedExpr{}, nil, fmt.Errorf("column: index '%s' does not exist", e.name)
+		}
+
+		switch index := column.Column.(type) {
+		case *columnIndex:
+			if index.async != nil {
+				return derivedExpr{}, nil, fmt.Errorf("column: index '%s' is asynchronous", e.name)
+			}
+			sources = appendUnique(sources, index.Column())
+			sources = appendUnique(sources, index.others...)
+		case *columnDerived:
+			sources = appendUnique(sources, index.sources...)
+		default:
+			return derivedExpr{}, nil, fmt.Errorf("column: '%s' is not an index", e.name)
+		}
+		return derivedExpr{op: opIndex, index: column.Column}, sources, nil
+	case opNot:
+		if len(e.operands) != 1 {
+			return derivedExpr{}, nil, fmt.Errorf("column: index 'not' requires exactly one operand")
+		}
+	default:
+		if len(e.operands) == 0 {
+			return derivedExpr{}, nil, fmt.Errorf("column: index expression requires at least one operand")
+		}
+	}
+
+	out := derivedExpr{op: e.op, operands: make([]derivedExpr, 0, len(e.operands))}
+	for _, operand := range e.operands {
+		expr, names, err := operand.compile(cols, sources)
+		if err != nil {
+			return derivedExpr{}, nil, err
+		}
+
+		sources = names
+		out.operands = append(out.operands, expr)
+	}
+	return out, sources, nil
+}
+
+// appendUnique appends the names which are not yet present in the list
+func appendUnique(names []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, name := range names {
+			found = found || name == v
+		}
+
+		if !found {
+			names = append(names, v)
+		}
+	}
+	return names
+}
+
+// derivedExpr represents a compiled expression of a derived index
+type derivedExpr struct {
+	op       indexOp       // The boolean operation
+	index    Column        // The index, for the leaves
+	operands []derivedExpr // The operands of the operation
+}
+
+// eval evaluates the expression for a specified row
+func (e *derivedExpr) eval(idx uint32) bool {
+	switch e.op {
+	case opIndex:
+		return e.index.Contains(idx)
+	case opNot:
+		return !e.operands[0].eval(idx)
+	case opAnd:
+		for i := range e.operands {
+			if !e.operands[i].eval(idx) {
+				return false
+			}
+		}
+		return true
+	default:
+		for i := range e.operands {
+			if e.operands[i].eval(idx) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// --------------------------- Derived Index ----------------------------
+
+// columnDerived represents an index defined as a boolean combination of other indexes. It
+// is re-evaluated for a row whenever a column of the underlying indexes changes.
+type columnDerived struct {
+	fill    bitmap.Bitmap // The fill list for the column
+	expr    derivedExpr   // The expression of the index
+	sources []string      // The names of the columns of the underlying indexes
+	trigger *column       // The trigger which is attached to the source columns
+}
+
+// newDerivedIndex creates a new derived bitmap index column.
+func newDerivedIndex(indexName string, expr derivedExpr, sources []string) *column {
+	index := &columnDerived{
+		fill:    make(bitmap.Bitmap, 0, 4),
+		expr:    expr,
+		sources: sources,
+	}
+
+	index.trigger = columnFor(indexName, &derivedTrigger{index})
+	return columnFor(indexName, index)
+}
+
+// Grow grows the size of the column until we have enough to store
+func (c *columnDerived) Grow(idx uint32) {
+	c.fill.Grow(idx)
+}
+
+// Apply applies a set of operations to the column. The index itself only receives the
+// deletes of the rows, since it is updated by its trigger otherwise.
+func (c *columnDerived) Apply(chunk commit.Chunk, r *commit.Reader) {
+	for r.Next() {
+		if r.Type == commit.Delete {
+			c.fill.Remove(uint32(r.Offset))
+		}
+	}
+}
+
+// evaluate re-evaluates the index for a specified row
+func (c *columnDerived) evaluate(idx uint32) {
+	if c.expr.eval(idx) {
+		c.fill.Set(idx)
+	} else {
+		c.fill.Remove(idx)
+	}
+}
+
+// Value retrieves a value at a specified index.
+func (c *columnDerived) Value(idx uint32) (v any, ok bool) {
+	if idx < uint32(len(c.fill))<<6 {
+		v, ok = c.fill.Contains(idx), true
+	}
+	return
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *columnDerived) Contains(idx uint32) bool {
+	return c.fill.Contains(idx)
+}
+
+// Index returns the fill list for the column
+func (c *columnDerived) Index(chunk commit.Chunk) bitmap.Bitmap {
+	return chunk.OfBitmap(c.fill)
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *columnDerived) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	dst.PutBitmap(commit.PutTrue, chunk, c.fill)
+}
+
+// --------------------------- Derived Trigger ----------------------------
+
+// derivedTrigger re-evaluates a derived index when the source column of one of its
+// underlying indexes changes. It is applied after these indexes, since it is created later.
+type derivedTrigger struct {
+	index *columnDerived
+}
+
+// Grow grows the size of the column until we have enough to store
+func (c *derivedTrigger) Grow(idx uint32) {
+	// Noop
+}
+
+// Apply applies a set of operations to the column.
+func (c *derivedTrigger) Apply(chunk commit.Chunk, r *commit.Reader) {
+	for r.Next() {
+		if r.Type == commit.Put || r.Type == commit.Delete {
+			c.index.evaluate(uint32(r.Offset))
+		}
+	}
+}
+
+// Value retrieves a value at a specified index.
+func (c *derivedTrigger) Value(idx uint32) (v any, ok bool) {
+	return nil, false
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *derivedTrigger) Contains(idx uint32) bool {
+	return false
+}
+
+// Index returns the fill list for the column
+func (c *derivedTrigger) Index(chunk commit.Chunk) bitmap.Bitmap {
+	return nil
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *derivedTrigger) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	// Noop
+}
@@ -6,12 +6,16 @@ package column
 import (
 	"context"
 	"time"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
 )
 
 // --------------------------- Expiration (Vacuum) ----------------------------
 
-// vacuum cleans up the expired objects on a specified interval.
-func (c *Collection) vacuum(ctx context.Context, interval time.Duration) {
+// vacuum cleans up the expired objects on a specified interval, and deletes the rows which are
+// older than the period of the retention policies.
+func (c *Collection) vacuum(ctx context.Context, interval time.Duration, retention []Retention) {
 	ticker := time.NewTicker(interval)
 	for {
 		select {
@@ -27,6 +31,101 @@ func (c *Collection) vacuum(ctx context.Context, interval time.Duration) {
 					}
 				})
 			})
+			c.expireValues()
+			c.enforceRetention(retention, time.Now())
+			c.recordHistory(time.Now())
+		}
+	}
+}
+
+// --------------------------- Expiration (Values) ----------------------------
+
+// expireOf returns the name of the column which contains the expiration time of the values
+// of a column created with the WithTTL() option.
+func expireOf(columnName string) string {
+	return columnName + "." + expireColumn
+}
+
+// WithExpired filters down the rows for which the value of the column has expired, for a
+// column created with the WithTTL() option. The expired values are removed by the vacuum,
+// but the rows remain selected until a new value is set or the value is deleted.
+func (txn *Txn) WithExpired(column string) *Txn {
+	now := time.Now().UnixNano()
+	return txn.WithInt(expireOf(column), func(v int64) bool {
+		return v <= now
+	})
+}
+
+// expireValues removes the expired values of the columns created with the WithTTL() option.
+// Their expiration time is kept, so that the rows can still be selected using WithExpired().
+func (c *Collection) expireValues() {
+	var names []string
+	c.cols.Range(func(column *column) {
+		if column.valueTTL() > 0 {
+			names = append(names, column.name)
+		}
+	})
+
+	for _, name := range names {
+		c.Query(func(txn *Txn) error {
+			txn.system = true
+			column, ok := txn.columnAt(name)
+			if !ok {
+				return nil
+			}
+
+			values, expiry := txn.bufferFor(name), txn.Int64(expireOf(name))
+			return txn.WithExpired(name).Range(func(idx uint32) {
+				if column.Contains(idx) {
+					expireAt, _ := expiry.Get()
+					values.PutOperation(commit.Delete, idx)
+					expiry.Set(expireAt)
+				}
+			})
+		})
+	}
+}
+
+// commitExpiry extends the expiration of the values which were set or merged by the
+// transaction, for the columns created with the WithTTL() option. The expiration of a
+// value which was deleted is removed along with it.
+func (txn *Txn) commitExpiry() {
+	var now time.Time
+	for _, u := range txn.updates {
+		if u.IsEmpty() || u.Column == rowColumn {
+			continue
+		}
+
+		column, ok := txn.columnAt(u.Column)
+		if !ok || column.valueTTL() <= 0 {
+			continue
+		}
+
+		if now.IsZero() {
+			now = time.Now()
+		}
+
+		// Expirations which were explicitly set by the transaction must not be overwritten
+		var written bitmap.Bitmap
+		buffer := txn.bufferFor(expireOf(u.Column))
+		txn.reader.Seek(buffer)
+		for txn.reader.Next() {
+			written.Set(txn.reader.Index())
+		}
+
+		expireAt := now.Add(column.valueTTL()).UnixNano()
+		txn.reader.Seek(u)
+		for txn.reader.Next() {
+			idx := txn.reader.Index()
+			switch {
+			case written.Contains(idx):
+				continue
+			case txn.reader.Type == commit.Delete:
+				buffer.PutOperation(commit.Delete, idx)
+			default:
+				buffer.PutInt64(commit.Put, idx, expireAt)
+			}
+			written.Set(idx)
 		}
 	}
 }
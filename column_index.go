@@ -4,8 +4,10 @@
 package column
 
 import (
+	"math"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kelindar/bitmap"
 	"github.com/kelindar/column/commit"
@@ -26,11 +28,142 @@ type Reader interface {
 	Int() int
 	Uint() uint
 	Bool() bool
+
+	// FloatNear returns whether the value, read as a float64, is within the epsilon of the target.
+	FloatNear(target, epsilon float64) bool
+
+	// Lookup returns a reader of the value of another column of the same row, or false if
+	// the column does not exist or if the row has no value in it.
+	Lookup(columnName string) (Reader, bool)
+}
+
+// Assert reader implementations. Both the commit reader and the value reader need to implement
+// this so that we can feed them to the index transparently.
+var _ Reader = rowReader{}
+var _ Reader = valueReader{}
+
+// rowReader represents a commit reader which can also read the other columns of the row
+type rowReader struct {
+	*commit.Reader
+	cols *columns // The columns of the collection
+}
+
+// Lookup returns a reader of the value of another column of the same row
+func (r rowReader) Lookup(columnName string) (Reader, bool) {
+	return lookupValue(r.cols, columnName, r.Index())
+}
+
+// FloatNear returns whether the value is within the epsilon of the target
+func (r rowReader) FloatNear(target, epsilon float64) bool {
+	return isNear(r.Float(), target, epsilon)
+}
+
+// valueReader represents a reader of the value of a column at a specific row
+type valueReader struct {
+	cols   *columns // The columns of the collection
+	column *column  // The column to read
+	idx    uint32   // The row to read
+}
+
+// lookupValue returns a reader of the value of a column at a specific row, if present
+func lookupValue(cols *columns, columnName string, idx uint32) (Reader, bool) {
+	if cols == nil {
+		return nil, false
+	}
+
+	column, ok := cols.Load(columnName)
+	if !ok || column.IsIndex() || !column.Contains(idx) {
+		return nil, false
+	}
+
+	return valueReader{cols: cols, column: column, idx: idx}, true
+}
+
+// IsUpsert returns true, since the value is present
+func (r valueReader) IsUpsert() bool {
+	return true
+}
+
+// IsDelete returns false, since the value is present
+func (r valueReader) IsDelete() bool {
+	return false
+}
+
+// Index returns the row of the value
+func (r valueReader) Index() uint32 {
+	return r.idx
+}
+
+// String reads the value as a string
+func (r valueReader) String() string {
+	if column, ok := r.column.Column.(Textual); ok {
+		v, _ := column.LoadString(r.idx)
+		return v
+	}
+	return ""
 }
 
-// Assert reader implementations. Both our cursor and commit reader need to implement
-// this so that we can feed it to the index transparently.
-var _ Reader = new(commit.Reader)
+// Bytes reads the value as a byte slice
+func (r valueReader) Bytes() []byte {
+	switch v, _ := r.column.Value(r.idx); v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return nil
+	}
+}
+
+// Float reads the value as a float64
+func (r valueReader) Float() float64 {
+	if column, ok := r.column.Column.(Numeric); ok {
+		v, _ := column.LoadFloat64(r.idx)
+		return v
+	}
+	return 0
+}
+
+// Int reads the value as an int
+func (r valueReader) Int() int {
+	if column, ok := r.column.Column.(Numeric); ok {
+		v, _ := column.LoadInt64(r.idx)
+		return int(v)
+	}
+	return 0
+}
+
+// Uint reads the value as an uint
+func (r valueReader) Uint() uint {
+	if column, ok := r.column.Column.(Numeric); ok {
+		v, _ := column.LoadUint64(r.idx)
+		return uint(v)
+	}
+	return 0
+}
+
+// Bool reads the value as a boolean
+func (r valueReader) Bool() bool {
+	v, _ := r.column.Value(r.idx)
+	b, _ := v.(bool)
+	return b
+}
+
+// Lookup returns a reader of the value of another column of the same row
+func (r valueReader) Lookup(columnName string) (Reader, bool) {
+	return lookupValue(r.cols, columnName, r.idx)
+}
+
+// FloatNear returns whether the value is within the epsilon of the target
+func (r valueReader) FloatNear(target, epsilon float64) bool {
+	return isNear(r.Float(), target, epsilon)
+}
+
+// isNear returns whether the value is within the epsilon of the target, the comparison
+// of a NaN is always false.
+func isNear(value, target, epsilon float64) bool {
+	return math.Abs(value-target) <= math.Abs(epsilon)
+}
 
 // computed represents a computed column
 type computed interface {
@@ -41,9 +174,13 @@ type computed interface {
 
 // columnIndex represents the index implementation
 type columnIndex struct {
-	fill bitmap.Bitmap     // The fill list for the column
-	name string            // The name of the target column
-	rule func(Reader) bool // The rule to apply when building the index
+	fill    bitmap.Bitmap     // The fill list for the column
+	name    string            // The name of the target column
+	rule    func(Reader) bool // The rule to apply when building the index
+	async   *asyncIndex       // The pending updates, if the index is updated asynchronously
+	cols    *columns          // The columns of the collection, for the lookups
+	others  []string          // The other columns read by the rule, if any
+	trigger *column           // The trigger which is attached to the other columns
 }
 
 // newIndex creates a new bitmap index column.
@@ -67,19 +204,28 @@ func (c *columnIndex) Column() string {
 
 // Apply applies a set of operations to the column.
 func (c *columnIndex) Apply(chunk commit.Chunk, r *commit.Reader) {
+	c.apply(r, c.async != nil)
+}
+
+// apply applies a set of operations to the index, deferring the evaluation of the rule if
+// the index is updated asynchronously.
+func (c *columnIndex) apply(r *commit.Reader, deferred bool) {
 
 	// Index can only be updated based on the final stored value, so we can only work
 	// with put operations here. The trick is to update the final value after applying
 	// on the actual column.
+	reader := rowReader{Reader: r, cols: c.cols}
 	for r.Next() {
-		switch r.Type {
-		case commit.Put:
-			if c.rule(r) {
+		switch {
+		case r.Type == commit.Put && deferred:
+			c.async.mark(uint32(r.Offset))
+		case r.Type == commit.Put:
+			if c.rule(reader) {
 				c.fill.Set(uint32(r.Offset))
 			} else {
 				c.fill.Remove(uint32(r.Offset))
 			}
-		case commit.Delete:
+		case r.Type == commit.Delete:
 			c.fill.Remove(uint32(r.Offset))
 		}
 	}
@@ -108,12 +254,167 @@ func (c *columnIndex) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
 	dst.PutBitmap(commit.PutTrue, chunk, c.fill)
 }
 
+// evaluate re-evaluates the index for a row, based on the current value of the indexed column
+func (c *columnIndex) evaluate(idx uint32) {
+	if c.async != nil {
+		c.async.mark(idx)
+		return
+	}
+
+	switch r, ok := lookupValue(c.cols, c.name, idx); {
+	case ok && c.rule(r):
+		c.fill.Set(idx)
+	default:
+		c.fill.Remove(idx)
+	}
+}
+
+// load sets the rows of a snapshot page of the index, without evaluating the rule
+func (c *columnIndex) load(page *commit.Buffer) {
+	reader := commit.NewReader()
+	reader.Seek(page)
+	for reader.Next() {
+		if reader.Type == commit.PutTrue {
+			c.fill.Set(reader.Index())
+		}
+	}
+}
+
+// --------------------------- Async Index ----------------------------
+
+// asyncIndex represents the pending updates of an index which is updated asynchronously,
+// within a bounded delay after the commits rather than during the commits.
+type asyncIndex struct {
+	lock      sync.Mutex
+	owner     *Collection   // The collection of the index
+	index     *columnIndex  // The index to update
+	delay     time.Duration // The maximum delay of the updates
+	pending   bitmap.Bitmap // The rows whose values have changed since the last update
+	scheduled bool          // Whether an update is scheduled
+}
+
+// mark marks the row as pending and schedules an update of the index, if necessary
+func (a *asyncIndex) mark(idx uint32) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.pending.Set(idx)
+	if !a.scheduled {
+		a.scheduled = true
+		time.AfterFunc(a.delay, a.refresh)
+	}
+}
+
+// take removes the pending rows of the chunk and returns them
+func (a *asyncIndex) take(chunk commit.Chunk) bitmap.Bitmap {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	pending := chunk.OfBitmap(a.pending)
+	rows := pending.Clone(nil)
+	for i := range pending {
+		pending[i] = 0
+	}
+	return rows
+}
+
+// refresh evaluates the rule of the index on the values of the pending rows, chunk by chunk
+// while holding the write lock of each chunk, similarly to a commit.
+func (a *asyncIndex) refresh() {
+	a.lock.Lock()
+	last, ok := a.pending.Max()
+	a.scheduled = false
+	a.lock.Unlock()
+
+	column, exists := a.owner.cols.Load(a.index.name)
+	if !ok || !exists {
+		return
+	}
+
+	buffer := commit.NewBuffer(0)
+	reader := commit.NewReader()
+	lookup := rowReader{Reader: reader, cols: a.index.cols}
+	for chunk := commit.Chunk(0); chunk <= commit.ChunkAt(last); chunk++ {
+		a.owner.slock.Lock(uint(chunk))
+		rows := a.take(chunk)
+		if rows.Count() == 0 {
+			a.owner.slock.Unlock(uint(chunk))
+			continue
+		}
+
+		if column.Snapshot(chunk, buffer) {
+			reader.Seek(buffer)
+			for reader.Next() {
+				offset := reader.Index()
+				if x := offset - chunk.Min(); rows.Contains(x) {
+					rows.Remove(x)
+					if a.index.rule(lookup) {
+						a.index.fill.Set(offset)
+					} else {
+						a.index.fill.Remove(offset)
+					}
+				}
+			}
+		}
+
+		// The rows without a value no longer match
+		rows.Range(func(x uint32) {
+			a.index.fill.Remove(chunk.Min() + x)
+		})
+		a.owner.slock.Unlock(uint(chunk))
+	}
+
+	a.owner.changed()
+}
+
+// --------------------------- Index Trigger ----------------------------
+
+// indexTrigger re-evaluates an index when one of the other columns read by its rule changes.
+// It is applied after the indexed column, since it is attached to the other columns.
+type indexTrigger struct {
+	index *columnIndex
+}
+
+// Grow grows the size of the column until we have enough to store
+func (c *indexTrigger) Grow(idx uint32) {
+	// Noop
+}
+
+// Apply applies a set of operations to the column. The deletes of the rows are received by
+// the index itself, and the values removed from the other columns are treated as updates.
+func (c *indexTrigger) Apply(chunk commit.Chunk, r *commit.Reader) {
+	for r.Next() {
+		if r.Type == commit.Put || r.Type == commit.Delete {
+			c.index.evaluate(uint32(r.Offset))
+		}
+	}
+}
+
+// Value retrieves a value at a specified index.
+func (c *indexTrigger) Value(idx uint32) (v any, ok bool) {
+	return nil, false
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *indexTrigger) Contains(idx uint32) bool {
+	return false
+}
+
+// Index returns the fill list for the column
+func (c *indexTrigger) Index(chunk commit.Chunk) bitmap.Bitmap {
+	return nil
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *indexTrigger) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	// Noop
+}
+
 // --------------------------- Trigger ----------------------------
 
 // columnTrigger represents the trigger implementation
 type columnTrigger struct {
 	name string       // The name of the target column
 	clbk func(Reader) // The trigger callback
+	cols *columns     // The columns of the collection, for the lookups
 }
 
 // newTrigger creates a new trigger column.
@@ -136,9 +437,10 @@ func (c *columnTrigger) Grow(idx uint32) {
 
 // Apply applies a set of operations to the column.
 func (c *columnTrigger) Apply(chunk commit.Chunk, r *commit.Reader) {
+	reader := rowReader{Reader: r, cols: c.cols}
 	for r.Next() {
 		if r.Type == commit.Put || r.Type == commit.Delete {
-			c.clbk(r)
+			c.clbk(reader)
 		}
 	}
 }
@@ -5,6 +5,7 @@ package column
 
 import (
 	"fmt"
+	"math/rand"
 
 	"github.com/kelindar/bitmap"
 	"github.com/kelindar/column/commit"
@@ -13,16 +14,31 @@ import (
 
 //go:generate go run ./codegen/main.go
 
-// readNumber is a helper function for point reads
+// readNumber is a helper function for point reads, masking the value if the column is masked
 func readNumber[T simd.Number](txn *Txn, columnName string) (value T, found bool) {
 	if column, ok := txn.columnAt(columnName); ok {
-		if rdr, ok := column.Column.(*numericColumn[T]); ok {
+		txn.checkRead(column.Column, txn.cursor)
+		switch rdr := column.Column.(type) {
+		case *numericColumn[T]:
 			value, found = rdr.load(txn.cursor)
+		case *columnPacked:
+			v, ok := rdr.load(txn.cursor)
+			value, found = T(v), ok
 		}
+		return maskNumber(txn.maskOf(columnName), value, found)
 	}
 	return
 }
 
+// maskNumber masks a numeric value read by a typed accessor. If the masked value is not a
+// number, the value is reported as missing rather than revealed.
+func maskNumber[T simd.Number](mask func(any) any, v T, ok bool) (T, bool) {
+	if !ok || mask == nil {
+		return v, ok
+	}
+	return numberOf[T](mask(v))
+}
+
 // --------------------------- Generic Column ----------------------------
 
 // numericColumn represents a numeric column
@@ -39,13 +55,16 @@ func makeNumeric[T simd.Number](
 	apply func(*commit.Reader, bitmap.Bitmap, []T, option[T]),
 	opts []func(*option[T]),
 ) *numericColumn[T] {
+	option := configure(opts, option[T]{})
+	if option.Merge == nil {
+		option.Merge = mergeAdd[T](option.Overflow)
+	}
+
 	return &numericColumn[T]{
 		chunks: make(chunks[T], 0, 4),
 		write:  write,
 		apply:  apply,
-		option: configure(opts, option[T]{
-			Merge: func(value, delta T) T { return value + delta },
-		}),
+		option: option,
 	}
 }
 
@@ -134,21 +153,72 @@ func (c *numericColumn[T]) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
 	})
 }
 
+// convert converts a numeric value of any type to the type of the column
+func (c *numericColumn[T]) convert(value any) any {
+	if v, ok := numberOf[T](value); ok {
+		return v
+	}
+	return value
+}
+
+// numberOf converts a numeric value of any type to the specified type
+func numberOf[T simd.Number](value any) (T, bool) {
+	switch v := value.(type) {
+	case float64:
+		return T(v), true
+	case float32:
+		return T(v), true
+	case int:
+		return T(v), true
+	case int8:
+		return T(v), true
+	case int16:
+		return T(v), true
+	case int32:
+		return T(v), true
+	case int64:
+		return T(v), true
+	case uint:
+		return T(v), true
+	case uint8:
+		return T(v), true
+	case uint16:
+		return T(v), true
+	case uint32:
+		return T(v), true
+	case uint64:
+		return T(v), true
+	default:
+		return 0, false
+	}
+}
+
 // --------------------------- Reader/Writer ----------------------------
 
 // rdNumber represents a read-only accessor for simd.Numbers
 type rdNumber[T simd.Number] struct {
 	reader *numericColumn[T]
 	txn    *Txn
+	mask   func(any) any // The mask applied to the values, if any
 }
 
-// Get loads the value at the current transaction cursor
+// Get loads the value at the current transaction cursor. If the column is masked, the masked
+// value is returned unless the transaction is unmasked.
 func (s rdNumber[T]) Get() (T, bool) {
-	return s.reader.load(s.txn.cursor)
+	s.txn.checkRead(s.reader, s.txn.cursor)
+	v, ok := s.reader.load(s.txn.cursor)
+	return maskNumber(s.mask, v, ok)
 }
 
 // Sum computes a sum of the column values selected by this transaction
 func (s rdNumber[T]) Sum() (sum T) {
+	if s.mask != nil {
+		s.reader.rangeMasked(s.txn, s.mask, func(_ uint32, v T) {
+			sum += v
+		})
+		return sum
+	}
+
 	s.txn.initialize()
 	s.txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		if int(chunk) < len(s.reader.chunks) {
@@ -161,6 +231,14 @@ func (s rdNumber[T]) Sum() (sum T) {
 // Avg computes an arithmetic mean of the column values selected by this transaction
 func (s rdNumber[T]) Avg() float64 {
 	sum, ct := T(0), 0
+	if s.mask != nil {
+		s.reader.rangeMasked(s.txn, s.mask, func(_ uint32, v T) {
+			sum += v
+			ct++
+		})
+		return float64(sum) / float64(ct)
+	}
+
 	s.txn.initialize()
 	s.txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		if int(chunk) < len(s.reader.chunks) {
@@ -173,6 +251,11 @@ func (s rdNumber[T]) Avg() float64 {
 
 // Min finds the smallest value from the column values selected by this transaction
 func (s rdNumber[T]) Min() (min T, ok bool) {
+	if s.mask != nil {
+		_, min, ok = argBest(s.reader, s.txn, s.mask, func(v, best T) bool { return v < best })
+		return
+	}
+
 	s.txn.initialize()
 	s.txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		if int(chunk) < len(s.reader.chunks) {
@@ -187,6 +270,11 @@ func (s rdNumber[T]) Min() (min T, ok bool) {
 
 // Max finds the largest value from the column values selected by this transaction
 func (s rdNumber[T]) Max() (max T, ok bool) {
+	if s.mask != nil {
+		_, max, ok = argBest(s.reader, s.txn, s.mask, func(v, best T) bool { return v > best })
+		return
+	}
+
 	s.txn.initialize()
 	s.txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		if int(chunk) < len(s.reader.chunks) {
@@ -199,6 +287,80 @@ func (s rdNumber[T]) Max() (max T, ok bool) {
 	return
 }
 
+// ArgMin finds the row with the smallest value from the column values selected by this
+// transaction and returns its index along with the value.
+func (s rdNumber[T]) ArgMin() (idx uint32, min T, ok bool) {
+	return argBest(s.reader, s.txn, s.mask, func(v, best T) bool { return v < best })
+}
+
+// ArgMax finds the row with the largest value from the column values selected by this
+// transaction and returns its index along with the value.
+func (s rdNumber[T]) ArgMax() (idx uint32, max T, ok bool) {
+	return argBest(s.reader, s.txn, s.mask, func(v, best T) bool { return v > best })
+}
+
+// argMin finds the row with the smallest value, converted to float64
+func (c *numericColumn[T]) argMin(txn *Txn, mask func(any) any) (uint32, float64, bool) {
+	idx, v, ok := argBest(c, txn, mask, func(v, best T) bool { return v < best })
+	return idx, float64(v), ok
+}
+
+// argMax finds the row with the largest value, converted to float64
+func (c *numericColumn[T]) argMax(txn *Txn, mask func(any) any) (uint32, float64, bool) {
+	idx, v, ok := argBest(c, txn, mask, func(v, best T) bool { return v > best })
+	return idx, float64(v), ok
+}
+
+// argBest finds the row with the best value, as per the comparison function, within the
+// values selected by the transaction. This is done in a single pass over the column data.
+func argBest[T simd.Number](c *numericColumn[T], txn *Txn, mask func(any) any, better func(v, best T) bool) (idx uint32, best T, ok bool) {
+	c.rangeMasked(txn, mask, func(x uint32, v T) {
+		if !ok || better(v, best) {
+			idx, best, ok = x, v, true
+		}
+	})
+	return
+}
+
+// pickWeighted selects a random row within the values selected by the transaction, with the
+// probability proportional to its value. This uses a single pass of a weighted reservoir
+// sampling, rows with a zero or negative weight are never selected.
+func (c *numericColumn[T]) pickWeighted(txn *Txn, mask func(any) any) (idx uint32, ok bool) {
+	total := 0.0
+	c.rangeMasked(txn, mask, func(x uint32, v T) {
+		weight := float64(v)
+		if weight <= 0 {
+			return
+		}
+
+		total += weight
+		if rand.Float64()*total < weight {
+			idx, ok = x, true
+		}
+	})
+	return
+}
+
+// rangeMasked calls the function with the index and the value of every row selected by the
+// transaction which has a value, masked if a mask is specified. The masked values which are
+// not numbers are skipped.
+func (c *numericColumn[T]) rangeMasked(txn *Txn, mask func(any) any, fn func(idx uint32, v T)) {
+	txn.initialize()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		if int(chunk) >= len(c.chunks) {
+			return
+		}
+
+		offset := chunk.Min()
+		fill, data := c.chunkAt(chunk)
+		index.Range(func(x uint32) {
+			if v, ok := maskNumber(mask, data[x], fill.Contains(x)); ok {
+				fn(offset+x, v)
+			}
+		})
+	})
+}
+
 // readNumberOf creates a new numeric reader
 func readNumberOf[T simd.Number](txn *Txn, columnName string) rdNumber[T] {
 	column, ok := txn.columnAt(columnName)
@@ -214,5 +376,6 @@ func readNumberOf[T simd.Number](txn *Txn, columnName string) rdNumber[T] {
 	return rdNumber[T]{
 		reader: reader,
 		txn:    txn,
+		mask:   txn.maskOf(columnName),
 	}
 }
@@ -0,0 +1,276 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"math/bits"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// --------------------------- Packed Column ----------------------------
+
+// columnPacked represents an int64 column which stores its values bit-packed. Each chunk
+// uses as many bits per value as required by its largest (zigzag-encoded) value, so a
+// chunk of ages only takes 7 bits per row instead of 64. The width of a chunk grows as
+// larger values are written, which requires the chunk to be re-packed.
+type columnPacked struct {
+	option[int64]
+	chunks []packedChunk
+}
+
+// ForPacked creates a new int64 column which stores its values bit-packed in memory. This
+// trades CPU for memory, as every read and write needs to decode or encode the value,
+// and is best suited for low-cardinality numeric columns with small values on wide datasets.
+// The column can be read with the numeric filters and accessors of a row, for example Int64().
+func ForPacked(opts ...func(*option[int64])) Column {
+	option := configure(opts, option[int64]{})
+	if option.Merge == nil {
+		option.Merge = mergeAdd[int64](option.Overflow)
+	}
+
+	return &columnPacked{
+		chunks: make([]packedChunk, 0, 4),
+		option: option,
+	}
+}
+
+// Grow grows the size of the column until we have enough to store
+func (c *columnPacked) Grow(idx uint32) {
+	for i := len(c.chunks); i <= int(commit.ChunkAt(idx)); i++ {
+		c.chunks = append(c.chunks, packedChunk{
+			fill: make(bitmap.Bitmap, chunkSize/64),
+		})
+	}
+}
+
+// Apply applies a set of operations to the column.
+func (c *columnPacked) Apply(chunk commit.Chunk, r *commit.Reader) {
+	packed := &c.chunks[chunk]
+	for r.Next() {
+		offset := r.IndexAtChunk()
+		switch r.Type {
+		case commit.Put:
+			packed.fill.Set(offset)
+			packed.store(offset, readInt64(r))
+		case commit.Merge:
+			packed.fill.Set(offset)
+			packed.store(offset, swapInt64(r, c.Merge(packed.load(offset), readInt64(r))))
+		case commit.Delete:
+			packed.fill.Remove(offset)
+		}
+	}
+}
+
+// load retrieves a value at a specified index
+func (c *columnPacked) load(idx uint32) (int64, bool) {
+	chunk := commit.ChunkAt(idx)
+	index := idx - chunk.Min()
+	if int(chunk) < len(c.chunks) && c.chunks[chunk].fill.Contains(index) {
+		return c.chunks[chunk].load(index), true
+	}
+	return 0, false
+}
+
+// Value retrieves a value at a specified index
+func (c *columnPacked) Value(idx uint32) (any, bool) {
+	return c.load(idx)
+}
+
+// convert converts a numeric value of any type to an int64
+func (c *columnPacked) convert(value any) any {
+	if v, ok := numberOf[int64](value); ok {
+		return v
+	}
+	return value
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *columnPacked) Contains(idx uint32) bool {
+	chunk := commit.ChunkAt(idx)
+	return int(chunk) < len(c.chunks) && c.chunks[chunk].fill.Contains(idx-chunk.Min())
+}
+
+// Index returns the fill list for the column
+func (c *columnPacked) Index(chunk commit.Chunk) (fill bitmap.Bitmap) {
+	if int(chunk) < len(c.chunks) {
+		fill = c.chunks[chunk].fill
+	}
+	return
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *columnPacked) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	packed := &c.chunks[chunk]
+	packed.fill.Range(func(x uint32) {
+		dst.PutInt64(commit.Put, chunk.Min()+x, packed.load(x))
+	})
+}
+
+// LoadFloat64 retrieves a float64 value at a specified index
+func (c *columnPacked) LoadFloat64(idx uint32) (float64, bool) {
+	v, ok := c.load(idx)
+	return float64(v), ok
+}
+
+// LoadInt64 retrieves an int64 value at a specified index
+func (c *columnPacked) LoadInt64(idx uint32) (int64, bool) {
+	return c.load(idx)
+}
+
+// LoadUint64 retrieves an uint64 value at a specified index
+func (c *columnPacked) LoadUint64(idx uint32) (uint64, bool) {
+	v, ok := c.load(idx)
+	return uint64(v), ok
+}
+
+// filter filters down the values based on the specified predicate.
+func (c *columnPacked) filter(chunk commit.Chunk, index bitmap.Bitmap, predicate func(int64) bool) {
+	if int(chunk) < len(c.chunks) {
+		packed := &c.chunks[chunk]
+		index.And(packed.fill)
+		index.Filter(func(idx uint32) bool {
+			return predicate(packed.load(idx))
+		})
+	}
+}
+
+// FilterFloat64 filters down the values based on the specified predicate.
+func (c *columnPacked) FilterFloat64(chunk commit.Chunk, index bitmap.Bitmap, predicate func(float64) bool) {
+	c.filter(chunk, index, func(v int64) bool { return predicate(float64(v)) })
+}
+
+// FilterInt64 filters down the values based on the specified predicate.
+func (c *columnPacked) FilterInt64(chunk commit.Chunk, index bitmap.Bitmap, predicate func(int64) bool) {
+	c.filter(chunk, index, predicate)
+}
+
+// FilterUint64 filters down the values based on the specified predicate.
+func (c *columnPacked) FilterUint64(chunk commit.Chunk, index bitmap.Bitmap, predicate func(uint64) bool) {
+	c.filter(chunk, index, func(v int64) bool { return predicate(uint64(v)) })
+}
+
+// readInt64 reads a signed integer of any size from the commit reader
+func readInt64(r *commit.Reader) int64 {
+	switch r.Size() {
+	case 2:
+		return int64(r.Int16())
+	case 4:
+		return int64(r.Int32())
+	default:
+		return r.Int64()
+	}
+}
+
+// swapInt64 swaps the signed integer of any size in the commit reader with a new value
+func swapInt64(r *commit.Reader, value int64) int64 {
+	switch r.Size() {
+	case 2:
+		return int64(r.SwapInt16(int16(value)))
+	case 4:
+		return int64(r.SwapInt32(int32(value)))
+	default:
+		return r.SwapInt64(value)
+	}
+}
+
+// --------------------------- Packed Chunk ----------------------------
+
+// packedChunk represents a chunk of bit-packed values
+type packedChunk struct {
+	fill  bitmap.Bitmap // The fill-list
+	words []uint64      // The packed values
+	width uint          // The number of bits per value
+}
+
+// load decodes the value at the specified offset within the chunk
+func (p *packedChunk) load(offset uint32) int64 {
+	if p.width == 0 {
+		return 0
+	}
+
+	at := uint(offset) * p.width
+	word, shift := at>>6, at&63
+	v := p.words[word] >> shift
+	if shift+p.width > 64 {
+		v |= p.words[word+1] << (64 - shift)
+	}
+
+	// Decode the zigzag-encoded value
+	v &= (1 << p.width) - 1
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// store encodes the value at the specified offset within the chunk, re-packing the
+// entire chunk if the value does not fit into the current width.
+func (p *packedChunk) store(offset uint32, value int64) {
+	v := uint64(value<<1) ^ uint64(value>>63)
+	if width := uint(bits.Len64(v)); width > p.width {
+		p.repack(width)
+	}
+
+	if p.width == 0 {
+		return
+	}
+
+	at := uint(offset) * p.width
+	word, shift := at>>6, at&63
+	mask := uint64(1)<<p.width - 1
+	p.words[word] = p.words[word]&^(mask<<shift) | v<<shift
+	if shift+p.width > 64 {
+		p.words[word+1] = p.words[word+1]&^(mask>>(64-shift)) | v>>(64-shift)
+	}
+}
+
+// repack re-encodes all of the values of the chunk with a larger width
+func (p *packedChunk) repack(width uint) {
+	packed := packedChunk{
+		words: make([]uint64, (chunkSize*width+63)/64),
+		width: width,
+	}
+
+	if p.width > 0 {
+		for i := uint32(0); i < chunkSize; i++ {
+			packed.store(i, p.load(i))
+		}
+	}
+
+	p.words = packed.words
+	p.width = packed.width
+}
+
+// --------------------------- Accessor ----------------------------
+
+// rwPacked represents a read-write accessor for bit-packed values
+type rwPacked struct {
+	reader[*columnPacked]
+	writer *commit.Buffer
+}
+
+// Get loads the value at the current transaction cursor. If the column is masked, the masked
+// value is returned unless the transaction is unmasked.
+func (s rwPacked) Get() (int64, bool) {
+	s.txn.checkRead(s.reader.reader, *s.cursor)
+	v, ok := s.reader.reader.load(*s.cursor)
+	return maskNumber(s.mask, v, ok)
+}
+
+// Set sets the value at the current transaction cursor
+func (s rwPacked) Set(value int64) {
+	s.writer.PutInt64(commit.Put, *s.cursor, value)
+}
+
+// Merge atomically merges a delta to the value at the current transaction cursor
+func (s rwPacked) Merge(delta int64) {
+	s.writer.PutInt64(commit.Merge, *s.cursor, delta)
+}
+
+// Packed returns a read-write accessor for a bit-packed column
+func (txn *Txn) Packed(columnName string) rwPacked {
+	return rwPacked{
+		reader: readerFor[*columnPacked](txn, columnName),
+		writer: txn.bufferFor(columnName),
+	}
+}
@@ -5,9 +5,7 @@ package column
 
 import (
 	"encoding"
-	"reflect"
 	"sync"
-	"unsafe"
 
 	"github.com/kelindar/column/commit"
 )
@@ -29,9 +27,10 @@ type columnRecord struct {
 // a constructor for the type as well as optional merge function. If merge function is
 // set to nil, "overwrite" strategy will be used.
 func ForRecord[T recordType](new func() T, opts ...func(*option[T])) Column {
-	mergeFunc := configure(opts, option[T]{
+	options := configure(opts, option[T]{
 		Merge: func(value, delta T) T { return delta },
-	}).Merge
+	})
+	mergeFunc := options.Merge
 
 	pool := &sync.Pool{
 		New: func() any { return new() },
@@ -65,7 +64,8 @@ func ForRecord[T recordType](new func() T, opts ...func(*option[T])) Column {
 		columnString: columnString{
 			chunks: make(chunks[string], 0, 4),
 			option: option[string]{
-				Merge: mergeRecord,
+				Merge:    mergeRecord,
+				ReadOnly: options.ReadOnly,
 			},
 		},
 	}
@@ -134,6 +134,7 @@ func (s rdRecord) Get() (any, bool) {
 // Unmarshal loads the value at the current transaction index using a
 // specified function to decode the value.
 func (s rdRecord) Unmarshal(decode func(data []byte) error) bool {
+	s.txn.checkRead(s.reader, *s.cursor)
 	encoded, ok := s.reader.LoadString(*s.cursor)
 	if !ok {
 		return false
@@ -151,17 +152,10 @@ func readRecordOf(txn *Txn, columnName string) rdRecord {
 
 // b2s converts byte slice to a string without allocating.
 func b2s(b *[]byte) string {
-	return *(*string)(unsafe.Pointer(b))
+	return commit.ToString(*b)
 }
 
 // s2b converts a string to a byte slice without allocating.
-func s2b(v string) (b []byte) {
-	strHeader := (*reflect.StringHeader)(unsafe.Pointer(&v))
-	byteHeader := (*reflect.SliceHeader)(unsafe.Pointer(&b))
-	byteHeader.Data = strHeader.Data
-
-	l := len(v)
-	byteHeader.Len = l
-	byteHeader.Cap = l
-	return
+func s2b(v string) []byte {
+	return commit.ToBytes(v)
 }
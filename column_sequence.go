@@ -0,0 +1,65 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sync/atomic"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// --------------------------- Sequence ----------------------------
+
+// ForSequence creates a new uint64 column which is automatically populated with a
+// monotonically increasing value when a row is inserted. Values are only assigned
+// once the transaction commits, hence rolled back transactions do not consume any
+// value of the sequence. Values explicitly set by a transaction are kept as-is and
+// the sequence continues after the largest value observed.
+func ForSequence() Column {
+	seq := new(sequence)
+	column := makeUint64s(func(o *option[uint64]) {
+		o.Stamp = stampInsert | stampSequence
+		o.seq = seq
+	}).(*numericColumn[uint64])
+
+	// Observe the values written so the sequence keeps increasing after a restore
+	apply := column.apply
+	column.apply = func(r *commit.Reader, fill bitmap.Bitmap, data []uint64, opts option[uint64]) {
+		apply(r, fill, data, opts)
+		for r.Rewind(); r.Next(); {
+			if r.Type == commit.Put {
+				seq.observe(r.Uint64())
+			}
+		}
+	}
+	return column
+}
+
+// sequenceStamp represents the rows of a transaction which are stamped with a sequence
+type sequenceStamp struct {
+	seq    *sequence      // The sequence to draw the values from
+	buffer *commit.Buffer // The update buffer of the column
+	rows   bitmap.Bitmap  // The rows which are not explicitly set
+}
+
+// sequence represents a thread-safe, monotonically increasing counter
+type sequence struct {
+	last uint64 // The last value of the sequence
+}
+
+// next returns the next value of the sequence
+func (s *sequence) next() uint64 {
+	return atomic.AddUint64(&s.last, 1)
+}
+
+// observe moves the sequence forward if the value is larger than the last one
+func (s *sequence) observe(value uint64) {
+	for {
+		last := atomic.LoadUint64(&s.last)
+		if value <= last || atomic.CompareAndSwapUint64(&s.last, last, value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,593 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// Sketch represents a probabilistic summary of a stream of items, which can be updated
+// incrementally and merged with another sketch of the same type and parameters. The
+// supported sketches are the *HyperLogLog, the *CountMin and the *Bloom.
+type Sketch interface {
+
+	// Add adds an item into the sketch.
+	Add(item string)
+
+	// Merge merges another sketch into this one, which must be of the same type and
+	// created with the same parameters.
+	Merge(other Sketch) error
+
+	// Clone returns a copy of the sketch.
+	Clone() Sketch
+
+	// MarshalBinary encodes the sketch into its binary representation.
+	MarshalBinary() ([]byte, error)
+
+	// add adds an item into the sketch, by its hash and its number of occurrences
+	add(hash, count uint64)
+
+	// empty creates an empty sketch with the same parameters
+	empty() Sketch
+}
+
+// Various kinds of sketches, used as the first byte of their binary representation
+const (
+	sketchHyperLogLog = 1
+	sketchCountMin    = 2
+	sketchBloom       = 3
+)
+
+// Various kinds of deltas merged into a sketch column
+const (
+	sketchDeltaAdd   = 0 // Adds the hash of an item along with its count
+	sketchDeltaMerge = 1 // Merges an encoded sketch
+)
+
+// hashItem hashes an item using FNV-1a, with a final mix so that every bit of the hash is
+// well distributed, as required by the sketches.
+func hashItem(item string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(item); i++ {
+		h ^= uint64(item[i])
+		h *= 1099511628211
+	}
+
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// probeAt returns the i-th probe of a hash within a range, using double hashing
+func probeAt(hash uint64, i, size int) int {
+	h1, h2 := hash&0xffffffff, (hash>>32)|1
+	return int((h1 + uint64(i)*h2) % uint64(size))
+}
+
+// errIncompatibleSketch is returned when merging sketches of different types or parameters
+var errIncompatibleSketch = fmt.Errorf("column: unable to merge sketches, incompatible type or parameters")
+
+// decodeSketch decodes a sketch from its binary representation
+func decodeSketch(b []byte) (Sketch, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("column: unable to decode sketch, empty buffer")
+	}
+
+	switch b[0] {
+	case sketchHyperLogLog:
+		if len(b) < 2 || b[1] < 4 || b[1] > 16 || len(b) != 2+1<<b[1] {
+			break
+		}
+
+		out := NewHyperLogLog(b[1])
+		copy(out.registers, b[2:])
+		return out, nil
+	case sketchCountMin:
+		if len(b) < 9 {
+			break
+		}
+
+		width := int(binary.BigEndian.Uint32(b[1:5]))
+		depth := int(binary.BigEndian.Uint32(b[5:9]))
+		if width <= 0 || depth <= 0 || len(b) != 9+8*width*depth {
+			break
+		}
+
+		out := NewCountMin(width, depth)
+		for i := range out.counts {
+			out.counts[i] = binary.BigEndian.Uint64(b[9+8*i:])
+		}
+		return out, nil
+	case sketchBloom:
+		if len(b) < 6 {
+			break
+		}
+
+		size := int(binary.BigEndian.Uint32(b[1:5]))
+		hashes := int(b[5])
+		if size <= 0 || hashes <= 0 || len(b) != 6+8*((size+63)/64) {
+			break
+		}
+
+		out := NewBloom(size, hashes)
+		for i := range out.bits {
+			out.bits[i] = binary.BigEndian.Uint64(b[6+8*i:])
+		}
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("column: unable to decode sketch, invalid encoding")
+}
+
+// --------------------------- HyperLogLog ----------------------------
+
+// HyperLogLog represents a sketch which estimates the number of distinct items, using 2^p
+// registers of one byte each. The standard error of the estimate is about 1.04/sqrt(2^p).
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// NewHyperLogLog creates a new HyperLogLog sketch with the specified precision, between 4 and
+// 16. For example, a precision of 14 uses 16KB of memory for an error of about 0.8%.
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 || precision > 16 {
+		panic(fmt.Errorf("column: hyperloglog precision must be between 4 and 16, got %d", precision))
+	}
+
+	return &HyperLogLog{
+		precision: precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+// Add adds an item into the sketch.
+func (s *HyperLogLog) Add(item string) {
+	s.add(hashItem(item), 1)
+}
+
+// add adds an item into the sketch, by its hash
+func (s *HyperLogLog) add(hash, _ uint64) {
+	at := hash >> (64 - s.precision)
+	rank := uint8(bits.LeadingZeros64(hash<<s.precision|1<<(s.precision-1))) + 1
+	if rank > s.registers[at] {
+		s.registers[at] = rank
+	}
+}
+
+// Distinct returns the estimated number of distinct items added into the sketch.
+func (s *HyperLogLog) Distinct() uint64 {
+	m := float64(len(s.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range s.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(s.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+
+	// Use the linear counting for the small cardinalities
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Merge merges another sketch into this one.
+func (s *HyperLogLog) Merge(other Sketch) error {
+	o, ok := other.(*HyperLogLog)
+	if !ok || o.precision != s.precision {
+		return errIncompatibleSketch
+	}
+
+	for i, r := range o.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy of the sketch.
+func (s *HyperLogLog) Clone() Sketch {
+	out := s.empty().(*HyperLogLog)
+	copy(out.registers, s.registers)
+	return out
+}
+
+// empty creates an empty sketch with the same parameters
+func (s *HyperLogLog) empty() Sketch {
+	return NewHyperLogLog(s.precision)
+}
+
+// MarshalBinary encodes the sketch into its binary representation.
+func (s *HyperLogLog) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 2, 2+len(s.registers))
+	out[0], out[1] = sketchHyperLogLog, s.precision
+	return append(out, s.registers...), nil
+}
+
+// --------------------------- Count-Min ----------------------------
+
+// CountMin represents a sketch which estimates the frequency of the items, using a number of
+// rows (depth) of counters (width). The estimate is never lower than the actual frequency and
+// exceeds it by at most 2n/width with a probability of 1-(1/2)^depth, for n added items.
+type CountMin struct {
+	width  int
+	depth  int
+	counts []uint64
+}
+
+// NewCountMin creates a new count-min sketch with the specified width and depth.
+func NewCountMin(width, depth int) *CountMin {
+	if width <= 0 || depth <= 0 {
+		panic(fmt.Errorf("column: count-min width and depth must be positive, got %dx%d", width, depth))
+	}
+
+	return &CountMin{
+		width:  width,
+		depth:  depth,
+		counts: make([]uint64, width*depth),
+	}
+}
+
+// Add adds a single occurrence of an item into the sketch.
+func (s *CountMin) Add(item string) {
+	s.add(hashItem(item), 1)
+}
+
+// AddCount adds a number of occurrences of an item into the sketch.
+func (s *CountMin) AddCount(item string, count uint64) {
+	s.add(hashItem(item), count)
+}
+
+// add adds a number of occurrences of an item into the sketch, by its hash
+func (s *CountMin) add(hash, count uint64) {
+	for i := 0; i < s.depth; i++ {
+		s.counts[i*s.width+probeAt(hash, i, s.width)] += count
+	}
+}
+
+// Frequency returns the estimated number of occurrences of an item.
+func (s *CountMin) Frequency(item string) uint64 {
+	hash := hashItem(item)
+	min := uint64(math.MaxUint64)
+	for i := 0; i < s.depth; i++ {
+		if v := s.counts[i*s.width+probeAt(hash, i, s.width)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Merge merges another sketch into this one.
+func (s *CountMin) Merge(other Sketch) error {
+	o, ok := other.(*CountMin)
+	if !ok || o.width != s.width || o.depth != s.depth {
+		return errIncompatibleSketch
+	}
+
+	for i, v := range o.counts {
+		s.counts[i] += v
+	}
+	return nil
+}
+
+// Clone returns a copy of the sketch.
+func (s *CountMin) Clone() Sketch {
+	out := s.empty().(*CountMin)
+	copy(out.counts, s.counts)
+	return out
+}
+
+// empty creates an empty sketch with the same parameters
+func (s *CountMin) empty() Sketch {
+	return NewCountMin(s.width, s.depth)
+}
+
+// MarshalBinary encodes the sketch into its binary representation.
+func (s *CountMin) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 9+8*len(s.counts))
+	out[0] = sketchCountMin
+	binary.BigEndian.PutUint32(out[1:5], uint32(s.width))
+	binary.BigEndian.PutUint32(out[5:9], uint32(s.depth))
+	for i, v := range s.counts {
+		binary.BigEndian.PutUint64(out[9+8*i:], v)
+	}
+	return out, nil
+}
+
+// --------------------------- Bloom ----------------------------
+
+// Bloom represents a bloom filter, a sketch which tests whether an item was added, without
+// false negatives but with a rate of false positives which depends on its size.
+type Bloom struct {
+	size   int
+	hashes int
+	bits   bitmap.Bitmap
+}
+
+// NewBloom creates a new bloom filter with the specified number of bits and of hash functions,
+// which must be between 1 and 255. For example, 10 bits per item and 7 hashes result in about
+// 1% of false positives.
+func NewBloom(size, hashes int) *Bloom {
+	if size <= 0 || hashes <= 0 || hashes > 255 {
+		panic(fmt.Errorf("column: bloom size must be positive and hashes between 1 and 255, got %d and %d", size, hashes))
+	}
+
+	return &Bloom{
+		size:   size,
+		hashes: hashes,
+		bits:   make(bitmap.Bitmap, (size+63)/64),
+	}
+}
+
+// Add adds an item into the filter.
+func (s *Bloom) Add(item string) {
+	s.add(hashItem(item), 1)
+}
+
+// add adds an item into the filter, by its hash
+func (s *Bloom) add(hash, _ uint64) {
+	for i := 0; i < s.hashes; i++ {
+		s.bits.Set(uint32(probeAt(hash, i, s.size)))
+	}
+}
+
+// Contains returns whether the item may have been added into the filter. If it returns false,
+// the item was definitely not added.
+func (s *Bloom) Contains(item string) bool {
+	hash := hashItem(item)
+	for i := 0; i < s.hashes; i++ {
+		if !s.bits.Contains(uint32(probeAt(hash, i, s.size))) {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge merges another filter into this one.
+func (s *Bloom) Merge(other Sketch) error {
+	o, ok := other.(*Bloom)
+	if !ok || o.size != s.size || o.hashes != s.hashes {
+		return errIncompatibleSketch
+	}
+
+	s.bits.Or(o.bits)
+	return nil
+}
+
+// Clone returns a copy of the filter.
+func (s *Bloom) Clone() Sketch {
+	out := s.empty().(*Bloom)
+	copy(out.bits, s.bits)
+	return out
+}
+
+// empty creates an empty filter with the same parameters
+func (s *Bloom) empty() Sketch {
+	return NewBloom(s.size, s.hashes)
+}
+
+// MarshalBinary encodes the filter into its binary representation.
+func (s *Bloom) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 6+8*len(s.bits))
+	out[0] = sketchBloom
+	binary.BigEndian.PutUint32(out[1:5], uint32(s.size))
+	out[5] = byte(s.hashes)
+	for i, v := range s.bits {
+		binary.BigEndian.PutUint64(out[6+8*i:], v)
+	}
+	return out, nil
+}
+
+// --------------------------- Sketch Column ----------------------------
+
+// columnSketch represents a column of sketches, one for each row, which are updated with the
+// items of the events related to the row, such as the visitors of a page.
+type columnSketch struct {
+	chunks[Sketch]
+	template Sketch // The empty sketch with the parameters of the column
+}
+
+// ForHyperLogLog creates a new column of HyperLogLog sketches with the specified precision,
+// between 4 and 16, which estimate the number of distinct items added into each row.
+func ForHyperLogLog(precision uint8) Column {
+	return forSketch(NewHyperLogLog(precision))
+}
+
+// ForCountMin creates a new column of count-min sketches with the specified width and depth,
+// which estimate the frequency of the items added into each row.
+func ForCountMin(width, depth int) Column {
+	return forSketch(NewCountMin(width, depth))
+}
+
+// ForBloom creates a new column of bloom filters with the specified number of bits and of hash
+// functions, which test whether an item was added into each row.
+func ForBloom(size, hashes int) Column {
+	return forSketch(NewBloom(size, hashes))
+}
+
+// forSketch creates a new column of sketches with the parameters of the template
+func forSketch(template Sketch) Column {
+	return &columnSketch{
+		chunks:   make(chunks[Sketch], 0, 4),
+		template: template,
+	}
+}
+
+// Apply applies a set of operations to the column.
+func (c *columnSketch) Apply(chunk commit.Chunk, r *commit.Reader) {
+	fill, data := c.chunkAt(chunk)
+	for r.Next() {
+		offset := r.IndexAtChunk()
+		switch r.Type {
+		case commit.Put:
+			if sketch, err := decodeSketch(r.Bytes()); err == nil {
+				fill[offset>>6] |= 1 << (offset & 0x3f)
+				data[offset] = sketch
+			}
+		case commit.Merge:
+			if !fill.Contains(offset) || data[offset] == nil {
+				data[offset] = c.template.empty()
+			}
+
+			// Apply the delta, incompatible sketches are ignored
+			switch delta := r.Bytes(); {
+			case len(delta) == 17 && delta[0] == sketchDeltaAdd:
+				data[offset].add(binary.BigEndian.Uint64(delta[1:9]), binary.BigEndian.Uint64(delta[9:17]))
+			case len(delta) > 1 && delta[0] == sketchDeltaMerge:
+				if other, err := decodeSketch(delta[1:]); err == nil {
+					data[offset].Merge(other)
+				}
+			}
+
+			// Write back the resulting sketch so that the commit log can be replayed
+			fill[offset>>6] |= 1 << (offset & 0x3f)
+			encoded, _ := data[offset].MarshalBinary()
+			r.SwapBytes(encoded)
+		case commit.Delete:
+			fill.Remove(offset)
+			data[offset] = nil
+		}
+	}
+}
+
+// load retrieves the sketch at a specified index, without copying it
+func (c *columnSketch) load(idx uint32) (Sketch, bool) {
+	chunk := commit.ChunkAt(idx)
+	index := idx - chunk.Min()
+	if int(chunk) < len(c.chunks) && c.chunks[chunk].fill.Contains(index) {
+		return c.chunks[chunk].data[index], true
+	}
+	return nil, false
+}
+
+// Value retrieves a copy of the sketch at a specified index
+func (c *columnSketch) Value(idx uint32) (any, bool) {
+	if sketch, ok := c.load(idx); ok {
+		return sketch.Clone(), true
+	}
+	return nil, false
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *columnSketch) Contains(idx uint32) bool {
+	chunk := commit.ChunkAt(idx)
+	return int(chunk) < len(c.chunks) && c.chunks[chunk].fill.Contains(idx-chunk.Min())
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *columnSketch) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	fill, data := c.chunkAt(chunk)
+	fill.Range(func(x uint32) {
+		encoded, _ := data[x].MarshalBinary()
+		dst.PutBytes(commit.Put, chunk.Min()+x, encoded)
+	})
+}
+
+// --------------------------- Accessor ----------------------------
+
+// rwSketch represents a read-write accessor for sketches
+type rwSketch struct {
+	reader[*columnSketch]
+	writer *commit.Buffer
+}
+
+// Get loads a copy of the sketch at the current transaction cursor
+func (s rwSketch) Get() (Sketch, bool) {
+	s.txn.checkRead(s.reader.reader, *s.cursor)
+	if sketch, ok := s.reader.reader.load(*s.cursor); ok {
+		return sketch.Clone(), true
+	}
+	return nil, false
+}
+
+// Add atomically adds an item into the sketch at the current transaction cursor
+func (s rwSketch) Add(item string) {
+	s.AddCount(item, 1)
+}
+
+// AddCount atomically adds a number of occurrences of an item into the sketch at the current
+// transaction cursor. The count is only relevant for the count-min sketches.
+func (s rwSketch) AddCount(item string, count uint64) {
+	delta := make([]byte, 17)
+	delta[0] = sketchDeltaAdd
+	binary.BigEndian.PutUint64(delta[1:9], hashItem(item))
+	binary.BigEndian.PutUint64(delta[9:17], count)
+	s.writer.PutBytes(commit.Merge, *s.cursor, delta)
+}
+
+// Merge atomically merges another sketch into the sketch at the current transaction cursor,
+// which must be of the same type and parameters as the sketches of the column.
+func (s rwSketch) Merge(other Sketch) error {
+	if err := s.reader.reader.template.empty().Merge(other); err != nil {
+		return err
+	}
+
+	encoded, err := other.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	s.writer.PutBytes(commit.Merge, *s.cursor, append([]byte{sketchDeltaMerge}, encoded...))
+	return nil
+}
+
+// Sketch returns a read-write accessor for a sketch column
+func (txn *Txn) Sketch(columnName string) rwSketch {
+	return rwSketch{
+		reader: readerFor[*columnSketch](txn, columnName),
+		writer: txn.bufferFor(columnName),
+	}
+}
+
+// MergeSketches merges the sketches of every row of the current selection into a new sketch,
+// for example to estimate the number of distinct visitors of a set of pages. The rows which
+// have no sketch are skipped.
+func (txn *Txn) MergeSketches(columnName string) (Sketch, error) {
+	column, ok := txn.columnAt(columnName)
+	if !ok {
+		return nil, fmt.Errorf("column: column '%s' does not exist", columnName)
+	}
+
+	sketches, ok := column.Column.(*columnSketch)
+	if !ok {
+		return nil, fmt.Errorf("column: column '%s' is not a sketch", columnName)
+	}
+
+	out := sketches.template.empty()
+	txn.initialize()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		offset := chunk.Min()
+		index.Range(func(x uint32) {
+			if sketch, ok := sketches.load(offset + x); ok {
+				out.Merge(sketch)
+			}
+		})
+	})
+	return out, nil
+}
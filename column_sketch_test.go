@@ -0,0 +1,193 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	s := NewHyperLogLog(12)
+	assert.Equal(t, uint64(0), s.Distinct())
+	for i := 0; i < 20000; i++ {
+		s.Add(fmt.Sprintf("user-%d", i%10000))
+	}
+	assert.InDelta(t, 10000, float64(s.Distinct()), 500)
+
+	// Merging counts the overlapping items only once
+	other := NewHyperLogLog(12)
+	for i := 5000; i < 15000; i++ {
+		other.Add(fmt.Sprintf("user-%d", i))
+	}
+	assert.NoError(t, s.Merge(other))
+	assert.InDelta(t, 15000, float64(s.Distinct()), 750)
+	assert.Error(t, s.Merge(NewHyperLogLog(10)))
+	assert.Error(t, s.Merge(NewBloom(64, 2)))
+	assert.Panics(t, func() { NewHyperLogLog(3) })
+	assert.Panics(t, func() { NewHyperLogLog(17) })
+}
+
+func TestCountMin(t *testing.T) {
+	s := NewCountMin(1024, 4)
+	for i := 0; i < 1000; i++ {
+		s.AddCount(fmt.Sprintf("item-%d", i), uint64(i%10))
+	}
+	s.Add("hot")
+	s.AddCount("hot", 99)
+
+	assert.Equal(t, uint64(100), s.Frequency("hot"))
+	for i := 0; i < 1000; i++ {
+		assert.GreaterOrEqual(t, s.Frequency(fmt.Sprintf("item-%d", i)), uint64(i%10))
+	}
+
+	other := NewCountMin(1024, 4)
+	other.AddCount("hot", 50)
+	assert.NoError(t, s.Merge(other))
+	assert.Equal(t, uint64(150), s.Frequency("hot"))
+	assert.Error(t, s.Merge(NewCountMin(512, 4)))
+	assert.Panics(t, func() { NewCountMin(0, 4) })
+}
+
+func TestBloom(t *testing.T) {
+	s := NewBloom(10000, 7)
+	for i := 0; i < 1000; i++ {
+		s.Add(fmt.Sprintf("item-%d", i))
+	}
+
+	positives := 0
+	for i := 0; i < 1000; i++ {
+		assert.True(t, s.Contains(fmt.Sprintf("item-%d", i)))
+		if s.Contains(fmt.Sprintf("other-%d", i)) {
+			positives++
+		}
+	}
+	assert.Less(t, positives, 50)
+
+	other := NewBloom(10000, 7)
+	other.Add("merged")
+	assert.NoError(t, s.Merge(other))
+	assert.True(t, s.Contains("merged"))
+	assert.Error(t, s.Merge(NewBloom(10000, 3)))
+	assert.Panics(t, func() { NewBloom(100, 0) })
+}
+
+func TestSketchEncoding(t *testing.T) {
+	hll := NewHyperLogLog(4)
+	hll.Add("a")
+	cms := NewCountMin(16, 2)
+	cms.AddCount("a", 3)
+	bloom := NewBloom(100, 3)
+	bloom.Add("a")
+
+	for _, sketch := range []Sketch{hll, cms, bloom} {
+		encoded, err := sketch.MarshalBinary()
+		assert.NoError(t, err)
+		decoded, err := decodeSketch(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, sketch, decoded)
+		assert.Equal(t, sketch, sketch.Clone())
+
+		_, err = decodeSketch(encoded[:len(encoded)-1])
+		assert.Error(t, err)
+	}
+
+	_, err := decodeSketch(nil)
+	assert.Error(t, err)
+	_, err = decodeSketch([]byte{42})
+	assert.Error(t, err)
+}
+
+func TestSketchColumn(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("page", ForString())
+	coll.CreateColumn("visitors", ForHyperLogLog(12))
+	coll.CreateColumn("referrers", ForCountMin(256, 4))
+	coll.CreateColumn("seen", ForBloom(4096, 5))
+
+	var pages []uint32
+	for i := 0; i < 3; i++ {
+		idx, _ := coll.Insert(func(r Row) error {
+			r.SetString("page", fmt.Sprintf("page-%d", i))
+			return nil
+		})
+		pages = append(pages, idx)
+	}
+
+	// Each page is visited by a different set of users, one commit per event
+	for i, idx := range pages {
+		for u := 0; u < 300; u++ {
+			user := fmt.Sprintf("user-%d", i*100+u)
+			assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+				r.Observe("visitors", user)
+				r.txn.Sketch("referrers").AddCount("google", 2)
+				r.txn.Sketch("seen").Add(user)
+				return nil
+			}))
+		}
+	}
+
+	assert.NoError(t, coll.QueryAt(pages[0], func(r Row) error {
+		visitors, ok := r.Sketch("visitors")
+		assert.True(t, ok)
+		assert.InDelta(t, 300, float64(visitors.(*HyperLogLog).Distinct()), 15)
+
+		referrers, _ := r.Sketch("referrers")
+		assert.Equal(t, uint64(600), referrers.(*CountMin).Frequency("google"))
+
+		seen, _ := r.Sketch("seen")
+		assert.True(t, seen.(*Bloom).Contains("user-42"))
+		return nil
+	}))
+
+	// Merge the sketches of all of the pages, users overlap between pages
+	coll.Query(func(txn *Txn) error {
+		merged, err := txn.MergeSketches("visitors")
+		assert.NoError(t, err)
+		assert.InDelta(t, 500, float64(merged.(*HyperLogLog).Distinct()), 25)
+
+		_, err = txn.MergeSketches("page")
+		assert.Error(t, err)
+		_, err = txn.MergeSketches("missing")
+		assert.Error(t, err)
+		return nil
+	})
+
+	// Merge an external sketch into a row
+	external := NewHyperLogLog(12)
+	for u := 0; u < 300; u++ {
+		external.Add(fmt.Sprintf("guest-%d", u))
+	}
+	assert.NoError(t, coll.QueryAt(pages[1], func(r Row) error {
+		assert.Error(t, r.txn.Sketch("visitors").Merge(NewHyperLogLog(4)))
+		return r.txn.Sketch("visitors").Merge(external)
+	}))
+
+	// Restore the collection from a snapshot
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, coll.Snapshot(buffer))
+	clone := NewCollection()
+	clone.CreateColumn("page", ForString())
+	clone.CreateColumn("visitors", ForHyperLogLog(12))
+	clone.CreateColumn("referrers", ForCountMin(256, 4))
+	clone.CreateColumn("seen", ForBloom(4096, 5))
+	assert.NoError(t, clone.Restore(buffer))
+	assert.NoError(t, clone.QueryAt(pages[1], func(r Row) error {
+		visitors, ok := r.Sketch("visitors")
+		assert.True(t, ok)
+		assert.InDelta(t, 600, float64(visitors.(*HyperLogLog).Distinct()), 30)
+		return nil
+	}))
+
+	// Deleted rows no longer have a sketch
+	assert.True(t, coll.DeleteAt(pages[2]))
+	visitors, _ := coll.cols.Load("visitors")
+	_, ok := visitors.Value(pages[2])
+	assert.False(t, ok)
+
+	assert.Panics(t, func() { ForHyperLogLog(2) })
+}
@@ -6,11 +6,13 @@ package column
 import (
 	"fmt"
 	"math"
+	"strings"
 	"sync"
 
 	"github.com/kelindar/bitmap"
 	"github.com/kelindar/column/commit"
 	"github.com/kelindar/intmap"
+	"github.com/tidwall/btree"
 	"github.com/zeebo/xxh3"
 )
 
@@ -61,6 +63,23 @@ func (c *columnEnum) findOrAdd(v []byte) uint32 {
 	return at
 }
 
+// ruleOf returns an index rule which evaluates the predicate only once for each value of the
+// dictionary, caching its result by the dictionary ID of the value.
+func (c *columnEnum) ruleOf(predicate func(id uint32, value string) bool) func(Reader) bool {
+	cache := intmap.NewSync(64, .95)
+	return func(r Reader) bool {
+		value := r.Bytes()
+		id := c.findOrAdd(value)
+		result, _ := cache.LoadOrStore(id, func() uint32 {
+			if predicate(id, string(value)) {
+				return 1
+			}
+			return 0
+		})
+		return result == 1
+	}
+}
+
 // readAt reads a string at a location
 func (c *columnEnum) readAt(at uint32) string {
 	return c.data[at]
@@ -258,24 +277,81 @@ func (txn *Txn) String(columnName string) rwString {
 
 // --------------------------- Key ----------------------------
 
+// keySeparator separates the parts of a composite key
+const keySeparator = ':'
+
 // columnKey represents the primary key column implementation
 type columnKey struct {
 	columnString
-	name string            // Name of the column
-	lock sync.RWMutex      // Lock to protect the lookup table
-	seek map[string]uint32 // Lookup table for O(1) index seek
+	name  string                // Name of the column
+	parts []string              // The columns of the parts of a composite key, if any
+	lock  sync.RWMutex          // Lock to protect the lookup table
+	seek  map[string]uint32     // Lookup table for O(1) index seek
+	keys  *btree.BTreeG[string] // The ordered keys, for the prefix scans
 }
 
 // makeKey creates a new primary key column
 func makeKey() Column {
 	return &columnKey{
 		seek: make(map[string]uint32, 64),
+		keys: btree.NewBTreeGOptions(func(a, b string) bool {
+			return a < b
+		}, btree.Options{NoLocks: true}),
 		columnString: columnString{
 			chunks: make(chunks[string], 0, 4),
 		},
 	}
 }
 
+// ForKeyOf creates a new composite primary key column, built from the values of several
+// string or enum columns, such as a tenant and a user. The keys are composed with KeyOf()
+// and whenever a row is inserted with a key, the columns are populated with its parts, so
+// they can be filtered and indexed like any other column. The parts must therefore not be
+// updated separately from the key.
+func ForKeyOf(columns ...string) Column {
+	column := makeKey().(*columnKey)
+	column.parts = columns
+	return column
+}
+
+// KeyOf composes a primary key from its parts, for the collections with a composite key
+// created using ForKeyOf(). The parts are joined with a colon, escaping the colons and the
+// backslashes within them, so that any string can be used as a part.
+func KeyOf(parts ...string) string {
+	var key strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			key.WriteByte(keySeparator)
+		}
+
+		for j := 0; j < len(part); j++ {
+			if part[j] == keySeparator || part[j] == '\\' {
+				key.WriteByte('\\')
+			}
+			key.WriteByte(part[j])
+		}
+	}
+	return key.String()
+}
+
+// SplitKey splits a primary key composed with KeyOf() into its parts
+func SplitKey(key string) (parts []string) {
+	var part strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key):
+			i++
+			part.WriteByte(key[i])
+		case key[i] == keySeparator:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(key[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
 // Apply applies a set of operations to the column.
 func (c *columnKey) Apply(chunk commit.Chunk, r *commit.Reader) {
 	fill, data := c.chunkAt(chunk)
@@ -287,16 +363,24 @@ func (c *columnKey) Apply(chunk commit.Chunk, r *commit.Reader) {
 		case commit.Put:
 			value := string(r.Bytes())
 
+			// A row whose key was changed is no longer reachable by its previous key
+			c.lock.Lock()
+			if old := data[offset]; fill.Contains(uint32(offset)) && old != value && c.seek[old] == uint32(r.Offset) {
+				delete(c.seek, old)
+				c.keys.Delete(old)
+			}
+
 			fill[offset>>6] |= 1 << (offset & 0x3f)
 			data[offset] = value
-			c.lock.Lock()
 			c.seek[value] = uint32(r.Offset)
+			c.keys.Set(value)
 			c.lock.Unlock()
 
 		case commit.Delete:
 			fill.Remove(uint32(offset))
 			c.lock.Lock()
 			delete(c.seek, string(data[offset]))
+			c.keys.Delete(string(data[offset]))
 			c.lock.Unlock()
 		}
 	}
@@ -310,18 +394,34 @@ func (c *columnKey) OffsetOf(v string) (uint32, bool) {
 	return idx, ok
 }
 
+// keysWithPrefix returns the keys which start with the prefix in ascending order, by only
+// visiting the range of the ordered keys which start with it
+func (c *columnKey) keysWithPrefix(prefix string) []string {
+	c.lock.RLock()
+	var keys []string
+	c.keys.Ascend(prefix, func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+
+		keys = append(keys, key)
+		return true
+	})
+	c.lock.RUnlock()
+	return keys
+}
+
 // rwKey represents read-write accessor for primary keys.
 type rwKey struct {
 	cursor *uint32
-	writer *commit.Buffer
+	txn    *Txn
 	reader *columnKey
 }
 
 // Set sets the value at the current transaction index
 func (s rwKey) Set(value string) error {
 	if _, ok := s.reader.OffsetOf(value); !ok {
-		s.writer.PutString(commit.Put, *s.cursor, value)
-		return nil
+		return s.txn.putKey(*s.cursor, value)
 	}
 
 	return fmt.Errorf("column: unable to set duplicate key '%s'", value)
@@ -340,19 +440,62 @@ func (txn *Txn) Key() rwKey {
 
 	return rwKey{
 		cursor: &txn.cursor,
-		writer: txn.bufferFor(txn.owner.pk.name),
+		txn:    txn,
 		reader: txn.owner.pk,
 	}
 }
 
+// keyParts splits a composite primary key into its parts, making sure that they match the
+// columns of the key. It returns no parts if the key is not composite.
+func (txn *Txn) keyParts(key string) ([]string, error) {
+	pk := txn.owner.pk
+	if len(pk.parts) == 0 {
+		return nil, nil
+	}
+
+	parts := SplitKey(key)
+	if len(parts) != len(pk.parts) {
+		return nil, fmt.Errorf("column: key '%s' has %d parts, expected %d", key, len(parts), len(pk.parts))
+	}
+
+	for _, name := range pk.parts {
+		column, ok := txn.columnAt(name)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("column: key part '%s' does not exist", name)
+		case !column.IsTextual():
+			return nil, fmt.Errorf("column: key part '%s' is not a string column", name)
+		}
+	}
+	return parts, nil
+}
+
+// putKey writes the primary key of a row along with its parts, if the key is composite
+func (txn *Txn) putKey(idx uint32, key string) error {
+	parts, err := txn.keyParts(key)
+	if err != nil {
+		return err
+	}
+
+	for i, part := range parts {
+		txn.bufferFor(txn.owner.pk.parts[i]).PutString(commit.Put, idx, part)
+	}
+
+	txn.bufferFor(txn.owner.pk.name).PutString(commit.Put, idx, key)
+	return nil
+}
+
 // --------------------------- Reader ----------------------------
 
 // rdString represents a read-only accessor for strings
 type rdString[T Textual] reader[T]
 
-// Get loads the value at the current transaction cursor
+// Get loads the value at the current transaction cursor. If the column is masked, the masked
+// value is returned unless the transaction is unmasked.
 func (s rdString[T]) Get() (string, bool) {
-	return s.reader.LoadString(*s.cursor)
+	s.txn.checkRead(s.reader, *s.cursor)
+	v, ok := s.reader.LoadString(*s.cursor)
+	return maskAs(s.mask, v, ok)
 }
 
 // readStringOf creates a new string reader
@@ -4,8 +4,14 @@
 package column
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"math/rand"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -304,6 +310,140 @@ func TestSelectAtKeyWithoutPK(t *testing.T) {
 	assert.Error(t, col.DeleteKey("test"))
 }
 
+func TestKeyOf(t *testing.T) {
+	for _, parts := range [][]string{
+		{"acme", "roman"},
+		{"a:b", "c\\d", ""},
+		{"trailing\\"},
+		{"", ""},
+	} {
+		assert.Equal(t, parts, SplitKey(KeyOf(parts...)))
+	}
+
+	assert.Equal(t, "acme:roman", KeyOf("acme", "roman"))
+	assert.Equal(t, `a\:b:c`, KeyOf("a:b", "c"))
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	col := NewCollection()
+	col.CreateColumn("id", ForKey())
+	for _, key := range []string{"user:42:b", "user:7:a", "user:42:a", "order:1"} {
+		assert.NoError(t, col.InsertKey(key, func(r Row) error { return nil }))
+	}
+
+	var keys []string
+	assert.NoError(t, col.Keys(func(key string, idx uint32) bool {
+		keys = append(keys, key)
+		return true
+	}))
+	assert.Equal(t, []string{"order:1", "user:42:a", "user:42:b", "user:7:a"}, keys)
+
+	keys = keys[:0]
+	assert.NoError(t, col.KeysWithPrefix("user:42:", func(key string, idx uint32) bool {
+		keys = append(keys, key)
+		assert.Equal(t, map[string]uint32{"user:42:a": 2, "user:42:b": 0}[key], idx)
+		return true
+	}))
+	assert.Equal(t, []string{"user:42:a", "user:42:b"}, keys)
+
+	// Stop the iteration early
+	count := 0
+	assert.NoError(t, col.Keys(func(key string, idx uint32) bool {
+		count++
+		return false
+	}))
+	assert.Equal(t, 1, count)
+
+	assert.NoError(t, col.Query(func(txn *Txn) error {
+		assert.Equal(t, 3, txn.WithKeyPrefix("user:").Count())
+		assert.Equal(t, 0, txn.WithKeyPrefix("order:").Count())
+		return nil
+	}))
+
+	// The ordered keys follow the deleted and the renamed keys
+	assert.NoError(t, col.DeleteKey("user:7:a"))
+	assert.NoError(t, col.QueryKey("user:42:b", func(r Row) error {
+		r.SetKey("user:43:b")
+		return nil
+	}))
+
+	keys = keys[:0]
+	assert.NoError(t, col.KeysWithPrefix("user:4", func(key string, idx uint32) bool {
+		keys = append(keys, key)
+		return true
+	}))
+	assert.Equal(t, []string{"user:42:a", "user:43:b"}, keys)
+	assert.Equal(t, []string{"user:42:a"}, col.pk.keysWithPrefix("user:42"))
+	assert.Empty(t, col.pk.keysWithPrefix("user:7"))
+
+	// Collections without a primary key
+	empty := NewCollection()
+	assert.Error(t, empty.Keys(func(string, uint32) bool { return true }))
+	assert.NoError(t, empty.Query(func(txn *Txn) error {
+		assert.Equal(t, 0, txn.WithKeyPrefix("").Count())
+		return nil
+	}))
+}
+
+func TestCompositeKey(t *testing.T) {
+	col := NewCollection()
+	col.CreateColumn("tenant", ForEnum())
+	col.CreateColumn("user", ForString())
+	col.CreateColumn("age", ForInt())
+	col.CreateColumn("id", ForKeyOf("tenant", "user"))
+
+	assert.NoError(t, col.InsertKey(KeyOf("acme", "roman"), func(r Row) error {
+		r.SetInt("age", 30)
+		return nil
+	}))
+	assert.NoError(t, col.UpsertKey(KeyOf("acme", "a:b"), func(r Row) error {
+		r.SetInt("age", 40)
+		return nil
+	}))
+	assert.NoError(t, col.Query(func(txn *Txn) error {
+		return txn.QueryKey(KeyOf("acme", "roman"), func(r Row) error {
+			r.SetKey(KeyOf("globex", "roman"))
+			return nil
+		})
+	}))
+
+	// The parts are populated from the key
+	assert.NoError(t, col.QueryKey(KeyOf("acme", "a:b"), func(r Row) error {
+		tenant, _ := r.Enum("tenant")
+		user, _ := r.String("user")
+		age, _ := r.Int("age")
+		assert.Equal(t, "acme", tenant)
+		assert.Equal(t, "a:b", user)
+		assert.Equal(t, 40, age)
+		return nil
+	}))
+
+	assert.NoError(t, col.Query(func(txn *Txn) error {
+		assert.Equal(t, 1, txn.WithString("tenant", func(v string) bool {
+			return v == "acme"
+		}).Count())
+		return nil
+	}))
+
+	// Keys with an invalid number of parts are rejected
+	assert.Error(t, col.InsertKey("acme", func(r Row) error { return nil }))
+	assert.Error(t, col.UpsertKey(KeyOf("a", "b", "c"), func(r Row) error { return nil }))
+	assert.Equal(t, 2, col.Count())
+	assert.NoError(t, col.DeleteKey(KeyOf("globex", "roman")))
+	assert.Equal(t, 1, col.Count())
+	assert.NoError(t, CheckInvariants(col))
+
+	// The parts must be existing string columns
+	invalid := NewCollection()
+	invalid.CreateColumn("tenant", ForInt())
+	invalid.CreateColumn("id", ForKeyOf("tenant", "user"))
+	assert.Error(t, invalid.InsertKey(KeyOf("1", "2"), func(r Row) error { return nil }))
+	invalid.DropColumn("tenant")
+	invalid.CreateColumn("tenant", ForString())
+	assert.Error(t, invalid.InsertKey(KeyOf("1", "2"), func(r Row) error { return nil }))
+	assert.Equal(t, 0, invalid.Count())
+}
+
 func TestBulkUpdateDuplicatePK(t *testing.T) {
 	col := NewCollection()
 	col.CreateColumn("key", ForKey())
@@ -543,6 +683,32 @@ func TestDuplicatePK(t *testing.T) {
 	assert.Equal(t, 1, col.Count())
 }
 
+func TestLongString(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+	col := NewCollection()
+	col.CreateColumn("text", ForString())
+	idx, err := col.Insert(func(r Row) error {
+		r.SetString("text", long)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Restore the collection from a snapshot
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, col.Snapshot(buffer))
+	clone := NewCollection()
+	clone.CreateColumn("text", ForString())
+	assert.NoError(t, clone.Restore(buffer))
+
+	for _, c := range []*Collection{col, clone} {
+		assert.NoError(t, c.QueryAt(idx, func(r Row) error {
+			text, _ := r.String("text")
+			assert.Equal(t, long, text)
+			return nil
+		}))
+	}
+}
+
 func TestMergeString(t *testing.T) {
 	col := NewCollection()
 	col.CreateColumn("name", ForString())
@@ -788,3 +954,539 @@ func invoke(any interface{}, name string, args ...interface{}) []reflect.Value {
 
 	return reflect.ValueOf(any).MethodByName(name).Call(inputs)
 }
+
+func TestRegister(t *testing.T) {
+	assert.Error(t, Register("", nil))
+	assert.Error(t, Register("bool", makeBools))
+	assert.NoError(t, Register("mock", func() Column {
+		return ForRecord(func() *mockRecord { return new(mockRecord) })
+	}))
+
+	// Built-in type
+	c1, err := ForType("float64")
+	assert.NoError(t, err)
+	assert.IsType(t, new(numericColumn[float64]), c1)
+
+	// Custom type
+	c2, err := ForType("mock")
+	assert.NoError(t, err)
+	assert.IsType(t, new(columnRecord), c2)
+
+	// Missing type
+	c3, err := ForType("missing")
+	assert.Error(t, err)
+	assert.Nil(t, c3)
+}
+
+func TestSequence(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("id", ForSequence())
+	coll.CreateColumn("name", ForString())
+
+	insert := func(fn func(r Row) error) uint64 {
+		idx, err := coll.Insert(fn)
+		if err != nil {
+			return 0
+		}
+
+		var id uint64
+		coll.QueryAt(idx, func(r Row) error {
+			id, _ = r.Uint64("id")
+			return nil
+		})
+		return id
+	}
+
+	// Insert concurrently, every row must get a unique value
+	var wg sync.WaitGroup
+	seen := make(chan uint64, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seen <- insert(func(r Row) error {
+				r.SetString("name", "Roman")
+				return nil
+			})
+		}()
+	}
+
+	wg.Wait()
+	close(seen)
+	unique := make(map[uint64]bool)
+	for v := range seen {
+		unique[v] = true
+	}
+	assert.Equal(t, 100, len(unique))
+	assert.False(t, unique[0])
+	assert.False(t, unique[101])
+
+	// Rolled back inserts must not consume the sequence
+	assert.Equal(t, uint64(0), insert(func(r Row) error {
+		return fmt.Errorf("rollback")
+	}))
+	assert.Equal(t, uint64(101), insert(func(r Row) error {
+		return nil
+	}))
+
+	// Explicitly set values must be kept and move the sequence forward
+	assert.Equal(t, uint64(500), insert(func(r Row) error {
+		r.SetUint64("id", 500)
+		return nil
+	}))
+	assert.Equal(t, uint64(501), insert(func(r Row) error {
+		return nil
+	}))
+
+	// The values drawn in the same transaction must not collide with the explicit ones
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		txn.Insert(func(r Row) error {
+			r.SetUint64("id", 510)
+			return nil
+		})
+		_, err := txn.Insert(func(r Row) error { return nil })
+		return err
+	}))
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		assert.Equal(t, 1, txn.WithUint("id", func(v uint64) bool { return v == 511 }).Count())
+		return nil
+	}))
+
+	// The sequence must continue after a restore
+	buffer := bytes.NewBuffer(nil)
+	_, err := coll.writeState(buffer)
+	assert.NoError(t, err)
+
+	coll = NewCollection()
+	coll.CreateColumn("id", ForSequence())
+	coll.CreateColumn("name", ForString())
+	_, _, err = coll.readState(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(512), insert(func(r Row) error {
+		return nil
+	}))
+}
+
+func TestSequenceOrder(t *testing.T) {
+	coll := NewCollection(Options{Storage: StorageOptions{Lifecycle: true}})
+	coll.CreateColumn("id", ForSequence())
+
+	// Insert concurrently into the same chunk
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			coll.Insert(func(r Row) error { return nil })
+		}()
+	}
+	wg.Wait()
+
+	// The values must follow the order in which the commits were applied
+	type stamp struct{ id, version uint64 }
+	var stamps []stamp
+	coll.Query(func(txn *Txn) error {
+		ids, versions := txn.Uint64("id"), txn.Uint64("$version")
+		return txn.Range(func(idx uint32) {
+			id, _ := ids.Get()
+			version, _ := versions.Get()
+			stamps = append(stamps, stamp{id, version})
+		})
+	})
+
+	assert.Len(t, stamps, 100)
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].version < stamps[j].version })
+	for i := 1; i < len(stamps); i++ {
+		assert.Less(t, stamps[i-1].id, stamps[i].id)
+	}
+}
+
+func TestVector(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("l2", ForVector(2, Euclidean))
+	coll.CreateColumn("cos", ForVector(2, Cosine))
+	coll.CreateColumn("name", ForString())
+	for _, v := range [][]float32{{1, 0}, {0, 1}, {3, 3}, {-1, 0}} {
+		coll.Insert(func(r Row) error {
+			r.SetVector("l2", v)
+			r.SetVector("cos", v)
+			return nil
+		})
+	}
+
+	// Row without a vector
+	coll.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	})
+
+	coll.Query(func(txn *Txn) error {
+		result := txn.Nearest("l2", []float32{1, 1}, 2)
+		assert.Equal(t, 2, len(result))
+		assert.ElementsMatch(t, []uint32{0, 1}, []uint32{result[0].Index, result[1].Index})
+		assert.Equal(t, float32(1), result[0].Distance)
+
+		result = txn.Nearest("cos", []float32{1, 1}, 10)
+		assert.Equal(t, 4, len(result))
+		assert.Equal(t, uint32(2), result[0].Index)
+		assert.Equal(t, uint32(3), result[3].Index)
+		assert.InDelta(t, 0, result[0].Distance, 1e-6)
+
+		// Invalid queries
+		assert.Nil(t, txn.Nearest("l2", []float32{1}, 1))
+		assert.Nil(t, txn.Nearest("name", []float32{1, 1}, 1))
+		assert.Nil(t, txn.Nearest("l2", []float32{1, 1}, 0))
+		return nil
+	})
+
+	// Within a selection
+	coll.Query(func(txn *Txn) error {
+		result := txn.WithValue("l2", func(v any) bool {
+			return v.([]float32)[0] < 0
+		}).Nearest("l2", []float32{1, 1}, 2)
+		assert.Equal(t, []Neighbor{{Index: 3, Distance: 5}}, result)
+		return nil
+	})
+
+	// Read back the vector, must be a copy
+	assert.NoError(t, coll.QueryAt(2, func(r Row) error {
+		v, ok := r.Vector("l2")
+		assert.True(t, ok)
+		assert.Equal(t, []float32{3, 3}, v)
+		v[0] = 100
+		v, _ = r.Vector("l2")
+		assert.Equal(t, []float32{3, 3}, v)
+		return nil
+	}))
+
+	// Snapshot and restore
+	buffer := bytes.NewBuffer(nil)
+	_, err := coll.writeState(buffer)
+	assert.NoError(t, err)
+
+	other := NewCollection()
+	other.CreateColumn("l2", ForVector(2, Euclidean))
+	other.CreateColumn("cos", ForVector(2, Cosine))
+	other.CreateColumn("name", ForString())
+	_, _, err = other.readState(buffer)
+	assert.NoError(t, err)
+	assert.NoError(t, other.QueryAt(3, func(r Row) error {
+		v, _ := r.Vector("cos")
+		assert.Equal(t, []float32{-1, 0}, v)
+		return nil
+	}))
+}
+
+func TestVectorApproximateDrift(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("exact", ForVector(4, Euclidean))
+	coll.CreateColumn("approx", ForVector(4, Euclidean, WithApproximate(16, 4)))
+
+	rng := rand.New(rand.NewSource(1))
+	random := func() []float32 {
+		return []float32{rng.Float32(), rng.Float32(), rng.Float32(), rng.Float32()}
+	}
+
+	for i := 0; i < 2000; i++ {
+		v := random()
+		coll.Insert(func(r Row) error {
+			r.SetVector("exact", v)
+			r.SetVector("approx", v)
+			return nil
+		})
+	}
+
+	// Move some of the vectors and delete most of the others
+	coll.Query(func(txn *Txn) error {
+		exact, approx := txn.Vector("exact"), txn.Vector("approx")
+		return txn.Range(func(idx uint32) {
+			v, _ := exact.Get()
+			switch {
+			case idx%5 == 0:
+				v = []float32{v[0] / 2, v[1] / 2, v[2], v[3]}
+				exact.Set(v)
+				approx.Set(v)
+			case v[0] < 0.8:
+				txn.DeleteAt(idx)
+			}
+		})
+	})
+
+	// The centroid of each list must remain the mean of the vectors assigned to it
+	column, _ := coll.cols.Load("approx")
+	vectors := column.Column.(*columnVector)
+	for list, rows := range vectors.index.lists {
+		mean := make([]float32, 4)
+		rows.Range(func(idx uint32) {
+			v, _ := vectors.load(idx)
+			for i := range mean {
+				mean[i] += v[i] / float32(rows.Count())
+			}
+		})
+
+		if rows.Count() > 0 {
+			assert.InDeltaSlice(t, mean, vectors.index.centroids[list], 1e-3)
+		}
+	}
+
+	// The recall must remain high after the deletes
+	found, total := 0, 0
+	coll.Query(func(txn *Txn) error {
+		for i := 0; i < 20; i++ {
+			query := random()
+			expect := make(map[uint32]bool)
+			for _, n := range txn.Nearest("exact", query, 10) {
+				expect[n.Index] = true
+			}
+			for _, n := range txn.Nearest("approx", query, 10) {
+				if expect[n.Index] {
+					found++
+				}
+			}
+			total += len(expect)
+		}
+		return nil
+	})
+	assert.Greater(t, float64(found)/float64(total), 0.8)
+}
+
+func TestVectorInvalid(t *testing.T) {
+	coll := NewCollection()
+	assert.Error(t, coll.CreateColumn("empty", ForVector(0, Euclidean)))
+	assert.Error(t, coll.CreateColumn("large", ForVector(maxVectorDims+1, Euclidean)))
+	assert.NoError(t, coll.CreateColumn("v", ForVector(2, Euclidean)))
+
+	idx, err := coll.Insert(func(r Row) error {
+		r.SetVector("v", []float32{1, 2})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// A vector of another length fails the transaction
+	for _, v := range [][]float32{{1}, {1, 2, 3}, nil} {
+		assert.Error(t, coll.QueryAt(idx, func(r Row) error {
+			r.SetVector("v", v)
+			return nil
+		}))
+	}
+
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		v, _ := r.Vector("v")
+		assert.Equal(t, []float32{1, 2}, v)
+		return nil
+	}))
+
+	// A replayed vector of another length is rejected as well
+	update := commit.NewBuffer(10)
+	update.Reset("v")
+	update.PutBytes(commit.Put, 0, encodeVector(nil, []float32{1, 2, 3}))
+	assert.Error(t, coll.Replay(commit.Commit{ID: 1, Updates: []*commit.Buffer{update}}))
+}
+
+func TestVectorApproximate(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("exact", ForVector(4, Euclidean))
+	coll.CreateColumn("all", ForVector(4, Euclidean, WithApproximate(8, 8)))
+	coll.CreateColumn("some", ForVector(4, Cosine, WithApproximate(8, 2)))
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		v := []float32{rng.Float32(), rng.Float32(), rng.Float32(), rng.Float32()}
+		coll.Insert(func(r Row) error {
+			r.SetVector("exact", v)
+			r.SetVector("all", v)
+			r.SetVector("some", v)
+			return nil
+		})
+	}
+
+	// Delete a row, it must be removed from the index
+	exact := make([]Neighbor, 0)
+	query := []float32{0.5, 0.5, 0.5, 0.5}
+	coll.Query(func(txn *Txn) error {
+		exact = txn.Nearest("exact", query, 5)
+		return nil
+	})
+	coll.DeleteAt(exact[0].Index)
+
+	// Probing all of the lists must be equivalent to a brute-force search
+	coll.Query(func(txn *Txn) error {
+		expect := txn.Nearest("exact", query, 5)
+		assert.Equal(t, expect, txn.Nearest("all", query, 5))
+		assert.Equal(t, exact[1:], expect[:4])
+
+		// Probing only some of the lists must still find the neighbours
+		some := txn.Nearest("some", query, 5)
+		assert.Equal(t, 5, len(some))
+		for _, v := range some {
+			assert.NotEqual(t, exact[0].Index, v.Index)
+		}
+		return nil
+	})
+}
+
+func TestPacked(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("age", ForPacked())
+	coll.CreateColumn("balance", ForPacked())
+	for i := 0; i < 20000; i++ {
+		coll.Insert(func(r Row) error {
+			r.SetPacked("age", int64(i%100))
+			r.SetAny("balance", i-10000)
+			return nil
+		})
+	}
+
+	// Small values only take a few bits, larger ones widen the chunk
+	packed, _ := coll.cols.Load("age")
+	assert.Equal(t, uint(8), packed.Column.(*columnPacked).chunks[0].width)
+	packed, _ = coll.cols.Load("balance")
+	assert.Equal(t, uint(15), packed.Column.(*columnPacked).chunks[0].width)
+
+	// Values can be read, filtered and aggregated transparently
+	assert.NoError(t, coll.QueryAt(10050, func(r Row) error {
+		age, _ := r.Int64("age")
+		balance, _ := r.Int("balance")
+		assert.Equal(t, int64(50), age)
+		assert.Equal(t, 50, balance)
+		return nil
+	}))
+
+	coll.Query(func(txn *Txn) error {
+		assert.Equal(t, 200, txn.WithInt("age", func(v int64) bool { return v == 42 }).Count())
+		assert.Equal(t, 100, txn.WithFloat("balance", func(v float64) bool { return v < 0 }).Count())
+		return nil
+	})
+
+	// Values can be updated and merged through the accessor
+	assert.NoError(t, coll.QueryAt(0, func(r Row) error {
+		r.SetPacked("age", -5)
+		r.MergePacked("balance", 1<<40)
+		return nil
+	}))
+	assert.NoError(t, coll.QueryAt(0, func(r Row) error {
+		age, ok := r.Packed("age")
+		assert.True(t, ok)
+		assert.Equal(t, int64(-5), age)
+		balance, _ := r.Int64("balance")
+		assert.Equal(t, int64(1<<40-10000), balance)
+		return nil
+	}))
+
+	// Restore the collection from a snapshot
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, coll.Snapshot(buffer))
+	clone := NewCollection()
+	clone.CreateColumn("age", ForPacked())
+	clone.CreateColumn("balance", ForPacked())
+	assert.NoError(t, clone.Restore(buffer))
+	assert.NoError(t, clone.QueryAt(19999, func(r Row) error {
+		age, _ := r.Int64("age")
+		balance, _ := r.Int64("balance")
+		assert.Equal(t, int64(99), age)
+		assert.Equal(t, int64(9999), balance)
+		return nil
+	}))
+}
+
+func TestPackedChunk(t *testing.T) {
+	var chunk packedChunk
+	values := []int64{0, 1, -1, 127, -128, 1 << 20, -(1 << 40), math.MaxInt64, math.MinInt64}
+	for i, v := range values {
+		chunk.store(uint32(i*7), v)
+		for j := 0; j <= i; j++ {
+			assert.Equal(t, values[j], chunk.load(uint32(j*7)))
+		}
+	}
+
+	// A chunk of small values is much smaller than a plain one
+	var small packedChunk
+	for i := uint32(0); i < chunkSize; i++ {
+		small.store(i, int64(i%100))
+	}
+	assert.Equal(t, chunkSize/8, len(small.words))
+}
+
+func TestCounter(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("name", ForString())
+	coll.CreateColumn("requests", ForCounter(time.Minute))
+	idx, _ := coll.Insert(func(r Row) error {
+		r.SetString("name", "merlin")
+		return nil
+	})
+
+	// Use a fake clock, starting at the beginning of a window
+	now := int64(100 * time.Minute)
+	counter, _ := coll.cols.Load("requests")
+	counter.Column.(*columnCounter).now = func() int64 { return now }
+
+	// Increments within the same window are accumulated
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+			r.Increment("requests", 6)
+			return nil
+		}))
+	}
+
+	load := func() (v int64) {
+		coll.QueryAt(idx, func(r Row) error {
+			v, _ = r.Counter("requests")
+			return nil
+		})
+		return
+	}
+
+	assert.Equal(t, int64(60), load())
+
+	// In the next window, the previous count slides out of the window
+	now += int64(90 * time.Second)
+	assert.Equal(t, int64(30), load())
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		r.Increment("requests", 10)
+		return nil
+	}))
+	assert.Equal(t, int64(40), load())
+
+	// The counter can be filtered like any other number
+	coll.Query(func(txn *Txn) error {
+		assert.Equal(t, 1, txn.WithInt("requests", func(v int64) bool { return v >= 40 }).Count())
+		return nil
+	})
+
+	// Restore the collection from a snapshot
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, coll.Snapshot(buffer))
+	clone := NewCollection()
+	clone.CreateColumn("name", ForString())
+	clone.CreateColumn("requests", ForCounter(time.Minute))
+	counter, _ = clone.cols.Load("requests")
+	counter.Column.(*columnCounter).now = func() int64 { return now }
+	assert.NoError(t, clone.Restore(buffer))
+	assert.NoError(t, clone.QueryAt(idx, func(r Row) error {
+		v, ok := r.Counter("requests")
+		assert.True(t, ok)
+		assert.Equal(t, int64(40), v)
+		return nil
+	}))
+
+	// Without any increments, the counter decays to zero
+	now += int64(2 * time.Minute)
+	assert.Equal(t, int64(0), load())
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		r.txn.Counter("requests").Reset()
+		return nil
+	}))
+	assert.Equal(t, int64(0), load())
+}
+
+func TestCounterMerge(t *testing.T) {
+	c := counter{window: 10, current: 5, prior: 3}
+	assert.Equal(t, counter{10, 6, 3}, c.merge(counter{window: 10, current: 1}))
+	assert.Equal(t, counter{11, 1, 5}, c.merge(counter{window: 11, current: 1}))
+	assert.Equal(t, counter{12, 1, 0}, c.merge(counter{window: 12, current: 1}))
+	assert.Equal(t, counter{10, 5, 4}, c.merge(counter{window: 9, current: 1}))
+	assert.Equal(t, c, c.merge(counter{window: 8, current: 1}))
+	assert.Equal(t, c, readCounter(c.encode()))
+	assert.Panics(t, func() { ForCounter(0) })
+}
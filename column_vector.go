@@ -0,0 +1,489 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// maxVectorDims is the maximum number of dimensions of a vector, since each vector is
+// encoded as a single binary value in the commit buffer.
+const maxVectorDims = math.MaxUint16 / 4
+
+// Metric represents a distance metric used for the similarity search of vectors
+type Metric uint8
+
+// Various supported distance metrics
+const (
+	Euclidean Metric = iota // Squared euclidean (L2) distance
+	Cosine                  // Cosine distance, 1 - cosine similarity
+)
+
+// --------------------------- Vector ----------------------------
+
+// columnVector represents a column of fixed-length float32 vectors, stored contiguously
+// for each chunk along with their norms.
+type columnVector struct {
+	dims   int           // The number of dimensions
+	metric Metric        // The distance metric for the search
+	fill   bitmap.Bitmap // The fill-list
+	data   [][]float32   // The vectors, contiguous for each chunk
+	norms  [][]float32   // The norms of the vectors for each chunk
+	index  *vectorIndex  // The optional approximate index
+}
+
+// ForVector creates a new column of fixed-length float32 vectors (e.g. embeddings) which
+// supports similarity search using Nearest() with the specified distance metric. The
+// number of dimensions is validated when the column is created in a collection.
+func ForVector(dims int, metric Metric, opts ...func(*columnVector)) Column {
+	column := &columnVector{
+		dims:   dims,
+		metric: metric,
+		fill:   make(bitmap.Bitmap, 0, 4),
+	}
+
+	for _, fn := range opts {
+		fn(column)
+	}
+	return column
+}
+
+// WithApproximate enables an approximate nearest neighbour index (IVF) on a vector column.
+// The vectors are clustered into the specified number of lists, which are maintained on
+// every commit, and Nearest() only searches the rows of the closest lists (probes). More
+// probes improve the recall at the expense of the search speed.
+func WithApproximate(lists, probes int) func(*columnVector) {
+	return func(c *columnVector) {
+		if lists > 0 && probes > 0 {
+			c.index = newVectorIndex(lists, probes)
+		}
+	}
+}
+
+// validate checks that the number of dimensions can be encoded
+func (c *columnVector) validate() error {
+	if c.dims <= 0 || c.dims > maxVectorDims {
+		return fmt.Errorf("vector must have between 1 and %d dimensions", maxVectorDims)
+	}
+	return nil
+}
+
+// valueSize returns the size of an encoded vector
+func (c *columnVector) valueSize() int {
+	return c.dims * 4
+}
+
+// Grow grows the size of the column until we have enough to store
+func (c *columnVector) Grow(idx uint32) {
+	c.fill.Grow(idx)
+	for i := len(c.data); i <= int(commit.ChunkAt(idx)); i++ {
+		c.data = append(c.data, nil)
+		c.norms = append(c.norms, nil)
+	}
+}
+
+// Apply applies a set of operations to the column.
+func (c *columnVector) Apply(chunk commit.Chunk, r *commit.Reader) {
+	for r.Next() {
+		switch r.Type {
+		case commit.Put:
+
+			// Lazily allocate the storage for the chunk
+			if c.data[chunk] == nil {
+				c.data[chunk] = make([]float32, chunkSize*c.dims)
+				c.norms[chunk] = make([]float32, chunkSize)
+			}
+
+			// The previous vector must be removed from the index before it is overwritten
+			at := r.IndexAtChunk()
+			dst := c.data[chunk][int(at)*c.dims : int(at+1)*c.dims]
+			if c.index != nil && c.fill.Contains(uint32(r.Offset)) {
+				c.index.remove(uint32(r.Offset), dst)
+			}
+
+			decodeVector(dst, r.Bytes())
+			c.norms[chunk][at] = norm(dst)
+			c.fill.Set(uint32(r.Offset))
+			if c.index != nil {
+				c.index.assign(uint32(r.Offset), dst, c.metric)
+			}
+
+		case commit.Delete:
+			if v, ok := c.load(uint32(r.Offset)); ok && c.index != nil {
+				c.index.remove(uint32(r.Offset), v)
+			}
+			c.fill.Remove(uint32(r.Offset))
+		}
+	}
+}
+
+// load returns the vector at a specified index, without copying it
+func (c *columnVector) load(idx uint32) ([]float32, bool) {
+	if !c.fill.Contains(idx) {
+		return nil, false
+	}
+
+	chunk := commit.ChunkAt(idx)
+	at := int(idx - chunk.Min())
+	return c.data[chunk][at*c.dims : (at+1)*c.dims], true
+}
+
+// Value retrieves a value at a specified index
+func (c *columnVector) Value(idx uint32) (any, bool) {
+	if v, ok := c.load(idx); ok {
+		return append([]float32(nil), v...), true
+	}
+	return nil, false
+}
+
+// Contains checks whether the column has a value at a specified index.
+func (c *columnVector) Contains(idx uint32) bool {
+	return c.fill.Contains(idx)
+}
+
+// Index returns the fill list for the column
+func (c *columnVector) Index(chunk commit.Chunk) bitmap.Bitmap {
+	return chunk.OfBitmap(c.fill)
+}
+
+// Snapshot writes the entire column into the specified destination buffer
+func (c *columnVector) Snapshot(chunk commit.Chunk, dst *commit.Buffer) {
+	buffer := make([]byte, 0, c.dims*4)
+	offset := chunk.Min()
+	chunk.OfBitmap(c.fill).Range(func(x uint32) {
+		v, _ := c.load(offset + x)
+		buffer = encodeVector(buffer[:0], v)
+		dst.PutBytes(commit.Put, offset+x, buffer)
+	})
+}
+
+// distance computes the distance between the query and the vector at a chunk offset
+func (c *columnVector) distance(chunk commit.Chunk, at uint32, query []float32, queryNorm float32) float32 {
+	v := c.data[chunk][int(at)*c.dims : int(at+1)*c.dims]
+	switch c.metric {
+	case Cosine:
+		if n := c.norms[chunk][at] * queryNorm; n > 0 {
+			return 1 - dot(v, query)/n
+		}
+		return 1
+	default:
+		return euclidean(v, query)
+	}
+}
+
+// --------------------------- Writer ----------------------------
+
+// rwVector represents read-write accessor for vector values
+type rwVector struct {
+	rdVector
+	writer *commit.Buffer
+}
+
+// Set sets the value at the current transaction cursor. A vector whose length does not match
+// the dimensions of the column is not written, and fails the transaction instead.
+func (s rwVector) Set(value []float32) {
+	if len(value) != s.reader.dims {
+		if s.txn.corrupt == nil {
+			s.txn.corrupt = fmt.Errorf("column: vector of %d dimensions can not be stored in a column of %d dimensions", len(value), s.reader.dims)
+		}
+		return
+	}
+
+	s.writer.PutBytes(commit.Put, *s.cursor, encodeVector(nil, value))
+}
+
+// Vector returns a vector column accessor
+func (txn *Txn) Vector(columnName string) rwVector {
+	return rwVector{
+		rdVector: rdVector(readerFor[*columnVector](txn, columnName)),
+		writer:   txn.bufferFor(columnName),
+	}
+}
+
+// --------------------------- Reader ----------------------------
+
+// rdVector represents a read-only accessor for vector values
+type rdVector reader[*columnVector]
+
+// Get loads a copy of the value at the current transaction cursor
+func (s rdVector) Get() ([]float32, bool) {
+	s.txn.checkRead(s.reader, *s.cursor)
+	if v, ok := s.reader.Value(*s.cursor); ok {
+		return v.([]float32), true
+	}
+	return nil, false
+}
+
+// --------------------------- Similarity Search ----------------------------
+
+// Neighbor represents a row found by the similarity search, along with its distance
+// to the query vector.
+type Neighbor struct {
+	Index    uint32  // The index of the row
+	Distance float32 // The distance to the query vector
+}
+
+// Nearest performs a similarity search on a vector column and returns up to k rows of the
+// current selection which are closest to the query vector, ordered by their distance.
+func (txn *Txn) Nearest(columnName string, query []float32, k int) []Neighbor {
+	column, ok := txn.columnAt(columnName)
+	if !ok || k <= 0 {
+		return nil
+	}
+
+	vectors, ok := column.Column.(*columnVector)
+	if !ok || len(query) != vectors.dims {
+		return nil
+	}
+
+	// If the column is indexed, only the candidates of the closest lists are searched
+	var candidates bitmap.Bitmap
+	if vectors.index != nil {
+		candidates = vectors.index.candidates(query, vectors.metric)
+	}
+
+	// Scan through the selection and keep the k closest rows in a max-heap
+	result := make(neighbors, 0, k)
+	queryNorm := norm(query)
+	txn.initialize()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		if int(chunk) >= len(vectors.data) || vectors.data[chunk] == nil {
+			return
+		}
+
+		offset := chunk.Min()
+		fill := chunk.OfBitmap(vectors.fill)
+		if candidates != nil {
+			fill = chunk.OfBitmap(candidates)
+		}
+
+		rangeBoth(index, fill, func(x uint32) {
+			d := vectors.distance(chunk, x, query, queryNorm)
+			switch {
+			case len(result) < k:
+				heap.Push(&result, Neighbor{Index: offset + x, Distance: d})
+			case d < result[0].Distance:
+				result[0] = Neighbor{Index: offset + x, Distance: d}
+				heap.Fix(&result, 0)
+			}
+		})
+	})
+
+	sort.Sort(sort.Reverse(result))
+	return result
+}
+
+// rangeBoth iterates over the bits which are set in both of the bitmaps
+func rangeBoth(a, b bitmap.Bitmap, fn func(x uint32)) {
+	if len(b) < len(a) {
+		a = a[:len(b)]
+	}
+
+	for blkAt, blk := range a {
+		for blk &= b[blkAt]; blk != 0; blk &= blk - 1 {
+			fn(uint32(blkAt<<6 + bits.TrailingZeros64(blk)))
+		}
+	}
+}
+
+// neighbors represents a max-heap of neighbors, ordered by their distance
+type neighbors []Neighbor
+
+func (h neighbors) Len() int           { return len(h) }
+func (h neighbors) Less(i, j int) bool { return h[i].Distance > h[j].Distance }
+func (h neighbors) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *neighbors) Push(x any)        { *h = append(*h, x.(Neighbor)) }
+func (h *neighbors) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// --------------------------- Approximate Index ----------------------------
+
+// vectorIndex represents an inverted file (IVF) index which clusters the vectors into a
+// number of lists. The centroids are seeded with the first vectors and then maintained
+// as the running mean of the vectors assigned to each list, including their removals.
+type vectorIndex struct {
+	lock      sync.RWMutex
+	probes    int             // The number of lists to search
+	lists     []bitmap.Bitmap // The rows assigned to each list
+	centroids [][]float32     // The centroid of each list
+	counts    []float32       // The number of vectors assigned to each list
+	listOf    []int32         // The list (plus one) to which each row is assigned
+}
+
+// newVectorIndex creates a new approximate index
+func newVectorIndex(lists, probes int) *vectorIndex {
+	if probes > lists {
+		probes = lists
+	}
+
+	return &vectorIndex{
+		probes:    probes,
+		lists:     make([]bitmap.Bitmap, 0, lists),
+		centroids: make([][]float32, 0, lists),
+		counts:    make([]float32, 0, lists),
+	}
+}
+
+// assign assigns the row to the list with the closest centroid. The row must have been
+// removed from the index beforehand, along with its previous vector.
+func (x *vectorIndex) assign(idx uint32, v []float32, metric Metric) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	// Seed a new list until we have enough of them
+	if len(x.centroids) < cap(x.centroids) {
+		x.centroids = append(x.centroids, append([]float32(nil), v...))
+		x.counts = append(x.counts, 0)
+		x.lists = append(x.lists, nil)
+	}
+
+	// Find the closest list and move its centroid towards the vector
+	list := x.closest(v, metric, 1)[0]
+	x.counts[list]++
+	centroid := x.centroids[list]
+	for i := range centroid {
+		centroid[i] += (v[i] - centroid[i]) / x.counts[list]
+	}
+
+	if int(idx) >= len(x.listOf) {
+		x.listOf = append(x.listOf, make([]int32, int(idx)+1-len(x.listOf))...)
+	}
+
+	x.lists[list].Set(idx)
+	x.listOf[idx] = int32(list + 1)
+}
+
+// remove removes the row from its list and moves the centroid of the list away from the
+// vector of the row, so that it remains the mean of the vectors which are still assigned.
+func (x *vectorIndex) remove(idx uint32, v []float32) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if int(idx) >= len(x.listOf) || x.listOf[idx] == 0 {
+		return
+	}
+
+	list := x.listOf[idx] - 1
+	x.lists[list].Remove(idx)
+	x.listOf[idx] = 0
+	x.counts[list]--
+
+	// An empty list keeps its centroid, which is replaced by the next vector assigned
+	if n := x.counts[list]; n > 0 {
+		centroid := x.centroids[list]
+		for i := range centroid {
+			centroid[i] += (centroid[i] - v[i]) / n
+		}
+	}
+}
+
+// candidates returns the rows of the lists which are closest to the query
+func (x *vectorIndex) candidates(query []float32, metric Metric) bitmap.Bitmap {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+
+	out := make(bitmap.Bitmap, 0, 4)
+	for _, list := range x.closest(query, metric, x.probes) {
+		out.Or(x.lists[list])
+	}
+	return out
+}
+
+// closest finds up to n lists which have their centroid closest to the vector
+func (x *vectorIndex) closest(v []float32, metric Metric, n int) []int {
+	result := make(neighbors, 0, n)
+	for i, centroid := range x.centroids {
+		d := metric.distance(centroid, v)
+		switch {
+		case len(result) < n:
+			heap.Push(&result, Neighbor{Index: uint32(i), Distance: d})
+		case d < result[0].Distance:
+			result[0] = Neighbor{Index: uint32(i), Distance: d}
+			heap.Fix(&result, 0)
+		}
+	}
+
+	lists := make([]int, 0, len(result))
+	for _, v := range result {
+		lists = append(lists, int(v.Index))
+	}
+	return lists
+}
+
+// --------------------------- Vector Math ----------------------------
+
+// distance computes the distance between two vectors of the same size
+func (m Metric) distance(a, b []float32) float32 {
+	switch m {
+	case Cosine:
+		if n := norm(a) * norm(b); n > 0 {
+			return 1 - dot(a, b)/n
+		}
+		return 1
+	default:
+		return euclidean(a, b)
+	}
+}
+
+// dot computes a dot product of two vectors of the same size
+func dot(a, b []float32) (sum float32) {
+	b = b[:len(a)]
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		sum += a[i]*b[i] + a[i+1]*b[i+1] + a[i+2]*b[i+2] + a[i+3]*b[i+3]
+	}
+	for ; i < len(a); i++ {
+		sum += a[i] * b[i]
+	}
+	return
+}
+
+// euclidean computes a squared euclidean distance of two vectors of the same size
+func euclidean(a, b []float32) (sum float32) {
+	b = b[:len(a)]
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return
+}
+
+// norm computes the euclidean norm of a vector
+func norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(dot(v, v))))
+}
+
+// encodeVector appends the little-endian binary representation of the vector
+func encodeVector(dst []byte, v []float32) []byte {
+	for _, x := range v {
+		dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(x))
+	}
+	return dst
+}
+
+// decodeVector decodes the vector into the destination, missing dimensions are zeroed
+func decodeVector(dst []float32, src []byte) {
+	for i := range dst {
+		if len(src) < 4 {
+			dst[i] = 0
+			continue
+		}
+
+		dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(src))
+		src = src[4:]
+	}
+}
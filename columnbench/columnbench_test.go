@@ -0,0 +1,87 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package columnbench
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/kelindar/column"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	dataset := Dataset{
+		Rows: 2500,
+		Seed: 42,
+		Columns: []Column{
+			{Name: "class", Type: "enum", Cardinality: 3},
+			{Name: "balance", Type: "float64"},
+			{Name: "age", Type: "packed", Cardinality: 100},
+			{Name: "active", Type: "bool", Cardinality: 2},
+		},
+	}
+
+	coll, err := dataset.Generate()
+	assert.NoError(t, err)
+	assert.Equal(t, 2500, coll.Count())
+
+	// The values are drawn from the cardinality of the column
+	classes := map[any]bool{}
+	coll.Query(func(txn *column.Txn) error {
+		class := txn.Enum("class")
+		return txn.Range(func(idx uint32) {
+			v, _ := class.Get()
+			classes[v] = true
+		})
+	})
+	assert.Len(t, classes, 3)
+
+	// The same seed generates the same dataset
+	clone, err := dataset.Generate()
+	assert.NoError(t, err)
+	assert.NoError(t, coll.QueryAt(1234, func(r column.Row) error {
+		return clone.QueryAt(1234, func(c column.Row) error {
+			v1, _ := r.Float64("balance")
+			v2, _ := c.Float64("balance")
+			assert.Equal(t, v1, v2)
+			return nil
+		})
+	}))
+
+	// Unsupported column types
+	_, err = Dataset{Columns: []Column{{Name: "x", Type: "record"}}}.Generate()
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	coll, err := Dataset{
+		Rows:    1000,
+		Columns: []Column{{Name: "balance", Type: "int64", Cardinality: 10}},
+	}.Generate()
+	assert.NoError(t, err)
+
+	results, err := RunAll(coll, Standard("balance"), Options{
+		Duration:    20 * time.Millisecond,
+		Concurrency: 4,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	for _, result := range results {
+		assert.Greater(t, result.Operations, int64(0))
+		assert.Greater(t, result.Throughput, float64(0))
+		assert.Contains(t, result.String(), result.Workload)
+	}
+
+	// The run stops at the first error
+	_, err = Run(coll, Workload{
+		Name: "fail",
+		Fn: func(*column.Collection, *rand.Rand) (int, error) {
+			return 0, errors.New("boom")
+		},
+	}, Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,123 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+// Package columnbench generates synthetic datasets and runs standard read, write and scan
+// workloads against them, in order to evaluate schema designs and detect regressions on
+// a specific hardware.
+package columnbench
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/kelindar/column"
+)
+
+// batchSize is the number of rows inserted per transaction while generating a dataset
+const batchSize = 1000
+
+// Column describes a column of a synthetic dataset
+type Column struct {
+	Name        string // The name of the column
+	Type        string // The registered type of the column, for example "float64" or "enum"
+	Cardinality int    // The number of distinct values, or zero for random values
+}
+
+// Dataset describes a synthetic dataset, with the values of each column drawn uniformly
+// from its cardinality. The same seed always generates the same dataset.
+type Dataset struct {
+	Rows    int      // The number of rows to generate
+	Columns []Column // The columns of the dataset
+	Seed    int64    // The seed of the random generator
+}
+
+// Generate creates a new collection and fills it with the synthetic dataset
+func (d Dataset) Generate() (*column.Collection, error) {
+	coll := column.NewCollection(column.Options{
+		Capacity: d.Rows,
+	})
+
+	for _, c := range d.Columns {
+		if _, err := valueOf(c.Type, 0); err != nil {
+			return nil, err
+		}
+
+		created, err := column.ForType(c.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := coll.CreateColumn(c.Name, created); err != nil {
+			return nil, err
+		}
+	}
+
+	// Insert the rows in batches, in order to amortize the cost of the commits
+	rng := rand.New(rand.NewSource(d.Seed))
+	for offset := 0; offset < d.Rows; offset += batchSize {
+		if err := coll.Query(func(txn *column.Txn) error {
+			for i := offset; i < offset+batchSize && i < d.Rows; i++ {
+				if _, err := txn.Insert(func(r column.Row) error {
+					return d.fill(r, rng)
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return coll, nil
+}
+
+// fill sets random values for all of the columns of a row
+func (d Dataset) fill(r column.Row, rng *rand.Rand) error {
+	for _, c := range d.Columns {
+		n := rng.Int63()
+		if c.Cardinality > 0 {
+			n = rng.Int63n(int64(c.Cardinality))
+		}
+
+		value, err := valueOf(c.Type, n)
+		if err != nil {
+			return err
+		}
+
+		r.SetAny(c.Name, value)
+	}
+	return nil
+}
+
+// valueOf converts a random number to a value of the specified column type
+func valueOf(typeName string, n int64) (any, error) {
+	switch typeName {
+	case "string", "enum":
+		return fmt.Sprintf("value-%d", n), nil
+	case "bool":
+		return n%2 == 1, nil
+	case "float32":
+		return float32(n), nil
+	case "float64":
+		return float64(n), nil
+	case "int":
+		return int(n), nil
+	case "int16":
+		return int16(n), nil
+	case "int32":
+		return int32(n), nil
+	case "int64", "packed":
+		return n, nil
+	case "uint":
+		return uint(n), nil
+	case "uint16":
+		return uint16(n), nil
+	case "uint32":
+		return uint32(n), nil
+	case "uint64":
+		return uint64(n), nil
+	default:
+		return nil, fmt.Errorf("columnbench: unsupported column type '%s'", typeName)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package columnbench
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kelindar/column"
+)
+
+// Workload represents a benchmark workload. Its function performs a number of operations
+// on the collection and returns how many were performed.
+type Workload struct {
+	Name string                                                     // The name of the workload
+	Fn   func(coll *column.Collection, rng *rand.Rand) (int, error) // The operations to perform
+}
+
+// PointRead creates a workload which reads the value of a column at random rows
+func PointRead(columnName string) Workload {
+	return Workload{
+		Name: fmt.Sprintf("read(%s)", columnName),
+		Fn: func(coll *column.Collection, rng *rand.Rand) (int, error) {
+			return 1, coll.QueryAt(randomRow(coll, rng), func(r column.Row) error {
+				_, _ = r.Any(columnName)
+				return nil
+			})
+		},
+	}
+}
+
+// PointWrite creates a workload which copies the value of a column from a random row to
+// another one, so that the written values preserve the distribution of the dataset.
+func PointWrite(columnName string) Workload {
+	return Workload{
+		Name: fmt.Sprintf("write(%s)", columnName),
+		Fn: func(coll *column.Collection, rng *rand.Rand) (int, error) {
+			var value any
+			if err := coll.QueryAt(randomRow(coll, rng), func(r column.Row) error {
+				value, _ = r.Any(columnName)
+				return nil
+			}); err != nil || value == nil {
+				return 0, err
+			}
+
+			return 1, coll.QueryAt(randomRow(coll, rng), func(r column.Row) error {
+				r.SetAny(columnName, value)
+				return nil
+			})
+		},
+	}
+}
+
+// Scan creates a workload which filters all of the rows by comparing the value of a column
+// with the value of a random row, and counts the matching rows.
+func Scan(columnName string) Workload {
+	return Workload{
+		Name: fmt.Sprintf("scan(%s)", columnName),
+		Fn: func(coll *column.Collection, rng *rand.Rand) (int, error) {
+			return 1, coll.Query(func(txn *column.Txn) error {
+				var target any
+				txn.QueryAt(randomRow(coll, rng), func(r column.Row) error {
+					target, _ = r.Any(columnName)
+					return nil
+				})
+
+				txn.WithValue(columnName, func(v any) bool {
+					return v == target
+				}).Count()
+				return nil
+			})
+		},
+	}
+}
+
+// Mixed creates a workload which performs the read workload for the specified percentage
+// of the operations, and the write workload otherwise.
+func Mixed(readPercent int, read, write Workload) Workload {
+	return Workload{
+		Name: fmt.Sprintf("mixed(%d%% %s, %s)", readPercent, read.Name, write.Name),
+		Fn: func(coll *column.Collection, rng *rand.Rand) (int, error) {
+			if rng.Intn(100) < readPercent {
+				return read.Fn(coll, rng)
+			}
+			return write.Fn(coll, rng)
+		},
+	}
+}
+
+// Standard returns the standard workloads for a column, namely the point reads, the point
+// writes, a mix of 90% reads and 10% writes and the full scans.
+func Standard(columnName string) []Workload {
+	read, write := PointRead(columnName), PointWrite(columnName)
+	return []Workload{read, write, Mixed(90, read, write), Scan(columnName)}
+}
+
+// randomRow returns a random row of the collection, assuming the rows are contiguous
+func randomRow(coll *column.Collection, rng *rand.Rand) uint32 {
+	if count := coll.Count(); count > 0 {
+		return uint32(rng.Intn(count))
+	}
+	return 0
+}
+
+// --------------------------- Runner ----------------------------
+
+// Options represents the options for running a workload
+type Options struct {
+	Duration    time.Duration // The duration of the run, one second by default
+	Concurrency int           // The number of concurrent workers, one by default
+	Seed        int64         // The seed of the random generators of the workers
+}
+
+// Result represents the result of running a workload
+type Result struct {
+	Workload    string        // The name of the workload
+	Concurrency int           // The number of concurrent workers
+	Operations  int64         // The number of operations performed
+	Elapsed     time.Duration // The duration of the run
+	Throughput  float64       // The number of operations per second
+}
+
+// String returns a human-readable summary of the result
+func (r Result) String() string {
+	return fmt.Sprintf("%-40s procs=%-4d ops=%-10d %12.0f ops/s", r.Workload, r.Concurrency, r.Operations, r.Throughput)
+}
+
+// Run runs the workload against the collection for the specified duration and reports the
+// throughput. The run stops at the first error returned by the workload.
+func Run(coll *column.Collection, workload Workload, opts Options) (Result, error) {
+	if opts.Duration <= 0 {
+		opts.Duration = time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	var ops int64
+	var wg sync.WaitGroup
+	var failure atomic.Value
+	start := time.Now()
+	deadline := start.Add(opts.Duration)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) && failure.Load() == nil {
+				n, err := workload.Fn(coll, rng)
+				if err != nil {
+					failure.Store(err)
+					return
+				}
+				atomic.AddInt64(&ops, int64(n))
+			}
+		}(opts.Seed + int64(i))
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+	result := Result{
+		Workload:    workload.Name,
+		Concurrency: opts.Concurrency,
+		Operations:  ops,
+		Elapsed:     elapsed,
+		Throughput:  float64(ops) / elapsed.Seconds(),
+	}
+
+	if err, ok := failure.Load().(error); ok {
+		return result, err
+	}
+	return result, nil
+}
+
+// RunAll runs each of the workloads one after the other and returns their results
+func RunAll(coll *column.Collection, workloads []Workload, opts Options) ([]Result, error) {
+	results := make([]Result, 0, len(workloads))
+	for _, w := range workloads {
+		result, err := Run(coll, w, opts)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
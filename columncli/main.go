@@ -0,0 +1,93 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+// Command columncli opens a snapshot of a collection and provides an interactive shell to
+// inspect its schema, query its rows and export them, without writing any Go code. Since
+// the snapshots do not contain the schema, the columns must be specified on the command
+// line as a list of names and registered types, for example:
+//
+//	columncli -snapshot players.bin -schema serial:key,name:enum,age:float64
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kelindar/column"
+)
+
+func main() {
+	snapshot := flag.String("snapshot", "", "the path to the snapshot of the collection")
+	schema := flag.String("schema", "", "the columns of the collection, as a list of name:type pairs")
+	flag.Parse()
+
+	coll, columns, err := open(*snapshot, *schema)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("columncli: opened '%s' (%d rows), type 'help' for the commands\n", *snapshot, coll.Count())
+	newShell(coll, columns, os.Stdout).Run(os.Stdin)
+}
+
+// open creates a collection with the schema specified and restores the snapshot into it
+func open(path, schema string) (*column.Collection, []schemaColumn, error) {
+	columns, err := parseSchema(schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	coll := column.NewCollection(column.Options{Vacuum: -1})
+	for _, c := range columns {
+		typed, err := column.ForType(c.Type)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := coll.CreateColumn(c.Name, typed); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if path == "" {
+		return coll, columns, nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer src.Close()
+	return coll, columns, coll.Restore(src)
+}
+
+// schemaColumn represents a column of the schema specified on the command line
+type schemaColumn struct {
+	Name string // The name of the column
+	Type string // The registered type of the column
+}
+
+// parseSchema parses the list of name:type pairs of the schema
+func parseSchema(schema string) (columns []schemaColumn, err error) {
+	for _, pair := range strings.Split(schema, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		name, typ, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || typ == "" {
+			return nil, fmt.Errorf("columncli: invalid column '%s', expected name:type", pair)
+		}
+
+		columns = append(columns, schemaColumn{Name: name, Type: typ})
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("columncli: the schema must contain at least one column")
+	}
+	return
+}
@@ -0,0 +1,262 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kelindar/column"
+)
+
+// usage describes the commands of the shell
+const usage = `Commands:
+  schema                               lists the columns of the collection
+  count [where <expr>]                 counts the rows matching the expression
+  select <columns|*> [where <expr>]    prints the rows matching the expression
+  dump <index>                         prints the complete state of a row
+  export <file> [where <expr>]         exports the rows into a .csv or a .json file
+  help                                 prints this message
+  quit                                 exits the shell
+`
+
+// shell represents an interactive shell on top of a collection
+type shell struct {
+	coll    *column.Collection
+	columns []schemaColumn
+	out     io.Writer
+}
+
+// newShell creates a new shell for the collection
+func newShell(coll *column.Collection, columns []schemaColumn, out io.Writer) *shell {
+	return &shell{
+		coll:    coll,
+		columns: columns,
+		out:     out,
+	}
+}
+
+// Run reads the commands line by line and executes them until the input ends or the
+// quit command is entered.
+func (s *shell) Run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for fmt.Fprint(s.out, "> "); scanner.Scan(); fmt.Fprint(s.out, "> ") {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "quit" || line == "exit" {
+			return
+		}
+
+		if err := s.Execute(line); err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
+
+// Execute executes a single command
+func (s *shell) Execute(line string) error {
+	command, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	switch command {
+	case "":
+		return nil
+	case "help":
+		_, err := fmt.Fprint(s.out, usage)
+		return err
+	case "schema":
+		return s.schema()
+	case "count":
+		return s.count(args)
+	case "select":
+		return s.selectRows(args)
+	case "dump":
+		return s.dump(args)
+	case "export":
+		return s.export(args)
+	default:
+		return fmt.Errorf("columncli: unknown command '%s', type 'help' for the commands", command)
+	}
+}
+
+// schema prints the columns of the collection along with their types
+func (s *shell) schema() error {
+	out := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "column\ttype")
+	for _, c := range s.columns {
+		fmt.Fprintf(out, "%s\t%s\n", c.Name, c.Type)
+	}
+	fmt.Fprintf(out, "(%d rows)\n", s.coll.Count())
+	return out.Flush()
+}
+
+// count prints the number of rows matching the expression
+func (s *shell) count(args string) error {
+	_, expr := splitWhere(args)
+	return s.query(expr, func(txn *column.Txn) error {
+		_, err := fmt.Fprintln(s.out, txn.Count())
+		return err
+	})
+}
+
+// selectRows prints the rows matching the expression as a table
+func (s *shell) selectRows(args string) error {
+	head, expr := splitWhere(args)
+	columns := s.columnsOf(head)
+	return s.query(expr, func(txn *column.Txn) error {
+		return txn.Print(s.out, columns...)
+	})
+}
+
+// dump prints the complete state of a row as JSON
+func (s *shell) dump(args string) error {
+	idx, err := strconv.ParseUint(strings.TrimSpace(args), 10, 32)
+	if err != nil {
+		return fmt.Errorf("columncli: invalid row index '%s'", args)
+	}
+
+	out, err := json.MarshalIndent(s.coll.DumpAt(uint32(idx)), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(s.out, string(out))
+	return err
+}
+
+// export writes the rows matching the expression into a file, either as CSV or as JSON
+// lines depending on the extension of the file.
+func (s *shell) export(args string) error {
+	path, expr := splitWhere(args)
+	if path == "" {
+		return fmt.Errorf("columncli: export must specify a file")
+	}
+
+	ext := filepath.Ext(path)
+	if ext != ".csv" && ext != ".json" {
+		return fmt.Errorf("columncli: unsupported export format '%s'", ext)
+	}
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+	count := 0
+	if err := s.query(expr, func(txn *column.Txn) error {
+		write := s.exportJSON(dst)
+		if ext == ".csv" {
+			write = s.exportCSV(dst)
+		}
+
+		return txn.RangeRows(func(r column.Row) error {
+			values := make([]any, len(s.columns))
+			for i, c := range s.columns {
+				values[i], _ = r.Any(c.Name)
+			}
+
+			count++
+			return write(values)
+		})
+	}); err != nil {
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "exported %d rows into '%s'\n", count, path)
+	return err
+}
+
+// exportJSON returns a function which writes each row as a line of JSON
+func (s *shell) exportJSON(dst io.Writer) func(values []any) error {
+	encoder := json.NewEncoder(dst)
+	return func(values []any) error {
+		object := make(map[string]any, len(values))
+		for i, v := range values {
+			if v != nil {
+				object[s.columns[i].Name] = v
+			}
+		}
+		return encoder.Encode(object)
+	}
+}
+
+// exportCSV returns a function which writes each row as a line of CSV, after a header
+func (s *shell) exportCSV(dst io.Writer) func(values []any) error {
+	writer := csv.NewWriter(dst)
+	record := make([]string, len(s.columns))
+	for i, c := range s.columns {
+		record[i] = c.Name
+	}
+
+	header := false
+	return func(values []any) error {
+		if !header {
+			header = true
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+
+		for i, v := range values {
+			record[i] = ""
+			if v != nil {
+				record[i] = fmt.Sprint(v)
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+
+		writer.Flush()
+		return writer.Error()
+	}
+}
+
+// query runs a transaction, filtered by the expression if specified
+func (s *shell) query(expr string, fn func(txn *column.Txn) error) error {
+	if expr != "" {
+		if _, err := column.ParseExpr(expr); err != nil {
+			return err
+		}
+	}
+
+	return s.coll.Query(func(txn *column.Txn) error {
+		if expr != "" {
+			txn = txn.WithExpr(expr)
+		}
+		return fn(txn)
+	})
+}
+
+// columnsOf returns the list of columns selected, or all of them for "*"
+func (s *shell) columnsOf(list string) (columns []string) {
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" && name != "*" {
+			columns = append(columns, name)
+		}
+	}
+	return
+}
+
+// splitWhere splits the arguments of a command from its optional "where" clause
+func splitWhere(args string) (head, expr string) {
+	args = strings.TrimSpace(args)
+	if strings.HasPrefix(args, "where ") {
+		return "", strings.TrimSpace(strings.TrimPrefix(args, "where "))
+	}
+
+	head, expr, _ = strings.Cut(args, " where ")
+	return strings.TrimSpace(head), strings.TrimSpace(expr)
+}
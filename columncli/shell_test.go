@@ -0,0 +1,85 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = "serial:key,name:enum,active:bool,class:enum,race:enum,age:float64," +
+	"hp:float64,mp:float64,balance:float64,gender:enum,guild:enum"
+
+func TestShell(t *testing.T) {
+	coll, columns, err := open("../fixtures/players.bin", testSchema)
+	assert.NoError(t, err)
+	assert.Equal(t, 500, coll.Count())
+
+	var out bytes.Buffer
+	newShell(coll, columns, &out).Run(strings.NewReader("" +
+		"count\n" +
+		"count where race == 'human' && age > 30\n" +
+		"select name, age where age > 200\n" +
+		"invalid\n" +
+		"quit\n" +
+		"count\n",
+	))
+
+	output := out.String()
+	assert.Contains(t, output, "> 500\n")
+	assert.Contains(t, output, "idx  name  age\n")
+	assert.Contains(t, output, "(0 rows)\n")
+	assert.Contains(t, output, "error: columncli: unknown command 'invalid'")
+	assert.Equal(t, 5, strings.Count(output, "> "), "stops at quit")
+}
+
+func TestShellCommands(t *testing.T) {
+	coll, columns, err := open("../fixtures/players.bin", testSchema)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	s := newShell(coll, columns, &out)
+	assert.NoError(t, s.Execute("schema"))
+	assert.Contains(t, out.String(), "balance  float64\n")
+
+	out.Reset()
+	assert.NoError(t, s.Execute("dump 0"))
+	assert.Contains(t, out.String(), `"exists": true`)
+
+	dir := t.TempDir()
+	for _, file := range []string{"out.csv", "out.json"} {
+		out.Reset()
+		path := filepath.Join(dir, file)
+		assert.NoError(t, s.Execute("export "+path+" where race == 'elf'"))
+		assert.Contains(t, out.String(), "exported ")
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "elf")
+		assert.NotContains(t, string(data), "human")
+	}
+
+	assert.Error(t, s.Execute("dump abc"))
+	assert.Error(t, s.Execute("count where age >"))
+	assert.Error(t, s.Execute("export out.xml"))
+	assert.Error(t, s.Execute("select invalid"))
+}
+
+func TestParseSchema(t *testing.T) {
+	columns, err := parseSchema("name:string, age:int")
+	assert.NoError(t, err)
+	assert.Equal(t, []schemaColumn{{"name", "string"}, {"age", "int"}}, columns)
+
+	_, err = parseSchema("")
+	assert.Error(t, err)
+	_, err = parseSchema("name")
+	assert.Error(t, err)
+	_, _, err = open("", "name:invalid")
+	assert.Error(t, err)
+}
@@ -0,0 +1,285 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package columnflight
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kelindar/column"
+)
+
+// query represents a parsed SQL query, of the form:
+//
+//	SELECT <* | columns | COUNT(*)> FROM <table> [WHERE <condition>] [LIMIT <n>]
+type query struct {
+	table   string   // The name of the collection
+	columns []string // The columns selected, or all of them if empty
+	count   bool     // Whether the query only counts the rows
+	where   string   // The condition, translated into a column expression
+	limit   int      // The maximum number of rows, or -1 if unlimited
+}
+
+// parseQuery parses the text of a SQL query. Only the subset of SQL which maps directly onto
+// a transaction is supported, the condition is translated into an expression of the column
+// package and the other statements, joins, grouping or ordering are rejected.
+func parseQuery(text string) (*query, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &sqlParser{tokens: tokens}
+	q := &query{limit: -1}
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+
+	// Parse the list of columns selected
+	switch {
+	case p.accept("*"):
+	case p.accept("COUNT"):
+		if err := p.expectAll("(", "*", ")"); err != nil {
+			return nil, err
+		}
+		q.count = true
+	default:
+		for {
+			name, err := p.identifier()
+			if err != nil {
+				return nil, err
+			}
+
+			q.columns = append(q.columns, name)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+
+	if q.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+
+	if p.accept("WHERE") {
+		if q.where, err = p.condition(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept("LIMIT") {
+		tok := p.next()
+		if q.limit, err = strconv.Atoi(tok.text); err != nil || tok.kind != sqlNumber || q.limit < 0 {
+			return nil, fmt.Errorf("columnflight: invalid limit '%s'", tok.text)
+		}
+	}
+
+	p.accept(";")
+	if tok := p.peek(); tok.kind != sqlEOF {
+		return nil, fmt.Errorf("columnflight: unsupported query, unexpected '%s'", tok.text)
+	}
+	return q, nil
+}
+
+// --------------------------- Parser ----------------------------
+
+// sqlParser represents a parser over the tokens of a SQL query
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+// peek returns the current token without consuming it
+func (p *sqlParser) peek() sqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return sqlToken{kind: sqlEOF}
+}
+
+// next consumes and returns the current token
+func (p *sqlParser) next() sqlToken {
+	tok := p.peek()
+	if tok.kind != sqlEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the current token if it is the specified keyword or symbol
+func (p *sqlParser) accept(text string) bool {
+	if tok := p.peek(); (tok.kind == sqlWord || tok.kind == sqlSymbol) && strings.EqualFold(tok.text, text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes the specified keyword or symbol, or returns an error
+func (p *sqlParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("columnflight: unsupported query, expected '%s' but got '%s'", text, p.peek().text)
+	}
+	return nil
+}
+
+// expectAll consumes the specified sequence of keywords or symbols
+func (p *sqlParser) expectAll(texts ...string) error {
+	for _, text := range texts {
+		if err := p.expect(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// identifier consumes the name of a table or a column, which may be quoted
+func (p *sqlParser) identifier() (string, error) {
+	switch tok := p.next(); {
+	case tok.kind == sqlQuoted:
+		return tok.text, nil
+	case tok.kind == sqlWord && !isReserved(tok.text):
+		return tok.text, nil
+	default:
+		return "", fmt.Errorf("columnflight: unsupported query, expected a name but got '%s'", tok.text)
+	}
+}
+
+// condition consumes the tokens of a WHERE clause and translates them into the syntax of a
+// column expression, which is then validated.
+func (p *sqlParser) condition() (string, error) {
+	var expr strings.Builder
+	for tok := p.peek(); tok.kind != sqlEOF && !strings.EqualFold(tok.text, "LIMIT") && tok.text != ";"; tok = p.peek() {
+		p.next()
+		if expr.Len() > 0 {
+			expr.WriteByte(' ')
+		}
+
+		switch text := strings.ToUpper(tok.text); {
+		case tok.kind == sqlString:
+			expr.WriteString("'" + tok.text + "'")
+		case tok.kind == sqlQuoted || tok.kind == sqlNumber:
+			expr.WriteString(tok.text)
+		case tok.kind == sqlSymbol && text == "=":
+			expr.WriteString("==")
+		case tok.kind == sqlSymbol && text == "<>":
+			expr.WriteString("!=")
+		case tok.kind == sqlWord && text == "AND":
+			expr.WriteString("&&")
+		case tok.kind == sqlWord && text == "OR":
+			expr.WriteString("||")
+		case tok.kind == sqlWord && text == "NOT":
+			expr.WriteString("!")
+		case tok.kind == sqlWord && (text == "TRUE" || text == "FALSE"):
+			expr.WriteString(strings.ToLower(text))
+		case tok.kind == sqlWord && isReserved(text):
+			return "", fmt.Errorf("columnflight: unsupported query, unexpected '%s'", tok.text)
+		default:
+			expr.WriteString(tok.text)
+		}
+	}
+
+	if _, err := column.ParseExpr(expr.String()); err != nil {
+		return "", fmt.Errorf("columnflight: unsupported condition, %w", err)
+	}
+	return expr.String(), nil
+}
+
+// isReserved returns whether a word is a keyword which can not be used as a name
+func isReserved(word string) bool {
+	switch strings.ToUpper(word) {
+	case "SELECT", "FROM", "WHERE", "LIMIT", "AND", "OR", "NOT", "GROUP", "ORDER", "BY", "JOIN",
+		"HAVING", "UNION", "OFFSET", "AS", "ON", "IN", "LIKE", "IS", "NULL", "BETWEEN":
+		return true
+	default:
+		return false
+	}
+}
+
+// --------------------------- Lexer ----------------------------
+
+// sqlKind represents the kind of a SQL token
+type sqlKind int
+
+const (
+	sqlEOF    sqlKind = iota // The end of the query
+	sqlWord                  // A keyword or a name
+	sqlQuoted                // A name in double quotes
+	sqlString                // A string literal in single quotes
+	sqlNumber                // A numeric literal
+	sqlSymbol                // An operator or a punctuation
+)
+
+// sqlToken represents a token of a SQL query
+type sqlToken struct {
+	kind sqlKind
+	text string
+}
+
+// tokenize splits the text of a SQL query into tokens
+func tokenize(text string) (tokens []sqlToken, err error) {
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(text[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("columnflight: unterminated quote in query")
+			}
+
+			// The expressions do not support escaped quotes within the strings
+			kind, value := sqlString, text[i+1:i+1+end]
+			if c == '"' {
+				kind = sqlQuoted
+			}
+			if strings.HasPrefix(text[i+2+end:], string(c)) {
+				return nil, fmt.Errorf("columnflight: escaped quotes are not supported")
+			}
+
+			tokens = append(tokens, sqlToken{kind: kind, text: value})
+			i += end + 2
+		case isDigit(c) || (c == '.' && i+1 < len(text) && isDigit(text[i+1])):
+			start := i
+			for i < len(text) && (isDigit(text[i]) || text[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: text[start:i]})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(text) && (text[i] == '_' || isDigit(text[i]) || unicode.IsLetter(rune(text[i]))) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: text[start:i]})
+		default:
+			symbol := string(c)
+			for _, op := range []string{"<>", "<=", ">=", "!=", "=="} {
+				if strings.HasPrefix(text[i:], op) {
+					symbol = op
+					break
+				}
+			}
+
+			if !strings.Contains("<>=!*,;()+-/%", string(c)) {
+				return nil, fmt.Errorf("columnflight: unexpected '%c' in query", c)
+			}
+
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: symbol})
+			i += len(symbol)
+		}
+	}
+	return
+}
+
+// isDigit returns whether a character is a decimal digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package columnflight
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect query
+	}{
+		{"SELECT * FROM players", query{table: "players", limit: -1}},
+		{"select name, age from players;", query{table: "players", columns: []string{"name", "age"}, limit: -1}},
+		{`SELECT "name" FROM "players" LIMIT 10`, query{table: "players", columns: []string{"name"}, limit: 10}},
+		{"SELECT COUNT(*) FROM players", query{table: "players", count: true, limit: -1}},
+		{
+			"SELECT * FROM players WHERE age >= 30 AND (race = 'elf' OR race <> 'human') AND NOT active = true LIMIT 5",
+			query{table: "players", where: "age >= 30 && ( race == 'elf' || race != 'human' ) && ! active == true", limit: 5},
+		},
+	}
+
+	for _, tc := range tests {
+		q, err := parseQuery(tc.sql)
+		assert.NoError(t, err, tc.sql)
+		assert.Equal(t, tc.expect, *q, tc.sql)
+	}
+}
+
+func TestParseQueryInvalid(t *testing.T) {
+	for _, sql := range []string{
+		"",
+		"DELETE FROM players",
+		"SELECT * FROM",
+		"SELECT * FROM players ORDER BY age",
+		"SELECT * FROM players WHERE name LIKE 'a%'",
+		"SELECT * FROM players WHERE age >",
+		"SELECT * FROM players WHERE name = 'it''s'",
+		"SELECT * FROM players LIMIT -1",
+		"SELECT * FROM players LIMIT x",
+		"SELECT * FROM a.players",
+		"SELECT COUNT(name) FROM players",
+		"SELECT * FROM 'players",
+	} {
+		_, err := parseQuery(sql)
+		assert.Error(t, err, sql)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	assert.True(t, matchPattern("%", "players"))
+	assert.True(t, matchPattern("play%", "players"))
+	assert.True(t, matchPattern("p_ayers", "players"))
+	assert.True(t, matchPattern("%ers", "players"))
+	assert.False(t, matchPattern("play", "players"))
+	assert.False(t, matchPattern("_", ""))
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package columnflight
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/kelindar/column"
+)
+
+// schemaOf returns the arrow schema of the exported columns, all of the fields are nullable
+// since a row may not have a value for every column.
+func schemaOf(columns []column.ColumnSchema) *arrow.Schema {
+	fields := make([]arrow.Field, 0, len(columns))
+	for _, c := range columns {
+		fields = append(fields, arrow.Field{
+			Name:     c.Name,
+			Type:     arrowTypeOf(c.Kind),
+			Nullable: true,
+		})
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// arrowTypeOf returns the arrow type for the kind of the exported values
+func arrowTypeOf(kind reflect.Kind) arrow.DataType {
+	switch kind {
+	case reflect.Bool:
+		return arrow.FixedWidthTypes.Boolean
+	case reflect.Int8:
+		return arrow.PrimitiveTypes.Int8
+	case reflect.Int16:
+		return arrow.PrimitiveTypes.Int16
+	case reflect.Int32:
+		return arrow.PrimitiveTypes.Int32
+	case reflect.Int, reflect.Int64:
+		return arrow.PrimitiveTypes.Int64
+	case reflect.Uint8:
+		return arrow.PrimitiveTypes.Uint8
+	case reflect.Uint16:
+		return arrow.PrimitiveTypes.Uint16
+	case reflect.Uint32:
+		return arrow.PrimitiveTypes.Uint32
+	case reflect.Uint, reflect.Uint64:
+		return arrow.PrimitiveTypes.Uint64
+	case reflect.Float32:
+		return arrow.PrimitiveTypes.Float32
+	case reflect.Float64:
+		return arrow.PrimitiveTypes.Float64
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// recordOf converts the first rows of an exported batch into an arrow record of the schema
+func recordOf(mem memory.Allocator, schema *arrow.Schema, batch *column.ExportBatch, rows int) arrow.RecordBatch {
+	builder := array.NewRecordBuilder(mem, schema)
+	defer builder.Release()
+
+	for i, c := range batch.Columns {
+		field := builder.Field(i)
+		for _, v := range c.Values[:rows] {
+			if v == nil {
+				field.AppendNull()
+				continue
+			}
+
+			appendValue(field, v)
+		}
+	}
+
+	return builder.NewRecordBatch()
+}
+
+// appendValue appends a value to the builder of its field. The numbers are converted to the
+// type of the field, while the values of the string fields are encoded as JSON unless they
+// are already strings, similarly to the other exporters.
+func appendValue(field array.Builder, value any) {
+	switch b := field.(type) {
+	case *array.StringBuilder:
+		b.Append(textOf(value))
+	case *array.BooleanBuilder:
+		v, _ := value.(bool)
+		b.Append(v)
+	case *array.Float64Builder:
+		b.Append(floatOf(value))
+	case *array.Float32Builder:
+		b.Append(float32(floatOf(value)))
+	case *array.Int64Builder:
+		b.Append(intOf(value))
+	case *array.Int32Builder:
+		b.Append(int32(intOf(value)))
+	case *array.Int16Builder:
+		b.Append(int16(intOf(value)))
+	case *array.Int8Builder:
+		b.Append(int8(intOf(value)))
+	case *array.Uint64Builder:
+		b.Append(uintOf(value))
+	case *array.Uint32Builder:
+		b.Append(uint32(uintOf(value)))
+	case *array.Uint16Builder:
+		b.Append(uint16(uintOf(value)))
+	case *array.Uint8Builder:
+		b.Append(uint8(uintOf(value)))
+	default:
+		field.AppendNull()
+	}
+}
+
+// intOf converts a number into an int64
+func intOf(value any) int64 {
+	switch v := reflect.ValueOf(value); {
+	case v.CanInt():
+		return v.Int()
+	case v.CanUint():
+		return int64(v.Uint())
+	case v.CanFloat():
+		return int64(v.Float())
+	default:
+		return 0
+	}
+}
+
+// uintOf converts a number into an uint64
+func uintOf(value any) uint64 {
+	switch v := reflect.ValueOf(value); {
+	case v.CanUint():
+		return v.Uint()
+	case v.CanInt():
+		return uint64(v.Int())
+	case v.CanFloat():
+		return uint64(v.Float())
+	default:
+		return 0
+	}
+}
+
+// floatOf converts a number into a float64
+func floatOf(value any) float64 {
+	switch v := reflect.ValueOf(value); {
+	case v.CanFloat():
+		return v.Float()
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return 0
+	}
+}
+
+// textOf returns the textual representation of a value
+func textOf(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	if encoded, err := json.Marshal(value); err == nil {
+		return string(encoded)
+	}
+	return fmt.Sprint(value)
+}
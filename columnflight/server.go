@@ -0,0 +1,379 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+// Package columnflight serves the collections of a registry over Arrow Flight SQL, so that the
+// BI tools such as Tableau, Metabase or DuckDB can query them directly with their Flight SQL
+// or ADBC drivers. Each collection is exposed as a read-only table named after it, and the
+// queries are executed as transactions of the collection, with the rows streamed as Arrow
+// record batches. Only a subset of SQL is supported, for example:
+//
+//	SELECT name, balance FROM players WHERE balance > 100 AND race = 'human' LIMIT 10
+//	SELECT COUNT(*) FROM players WHERE active = true
+//
+// The server is kept in a separate module so that the core package does not depend on Arrow
+// and gRPC.
+package columnflight
+
+import (
+	"context"
+	"errors"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql/schema_ref"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/kelindar/column"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tableType is the type reported for every table
+const tableType = "TABLE"
+
+// errLimit is returned by the exporter once the limit of a query is reached
+var errLimit = errors.New("columnflight: limit reached")
+
+// Options represents the options of a Flight SQL server
+type Options struct {
+	BatchSize int // The maximum number of rows of a record batch, 65536 by default
+}
+
+// Server represents a Flight SQL server which executes the queries over the collections of
+// a registry. It is read-only, the statements which modify the data are rejected.
+type Server struct {
+	flightsql.BaseServer
+	registry *column.Registry
+	options  Options
+}
+
+// NewServer creates a new Flight SQL server for the collections of the registry.
+func NewServer(registry *column.Registry, opts ...Options) (*Server, error) {
+	server := &Server{
+		registry: registry,
+	}
+
+	if len(opts) > 0 {
+		server.options = opts[0]
+	}
+
+	server.Alloc = memory.DefaultAllocator
+	for id, value := range map[flightsql.SqlInfo]any{
+		flightsql.SqlInfoFlightSqlServerName:     "column",
+		flightsql.SqlInfoFlightSqlServerReadOnly: true,
+		flightsql.SqlInfoIdentifierQuoteChar:     `"`,
+	} {
+		if err := server.RegisterSqlInfo(id, value); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// Listen creates a gRPC server listening on the address, with the Flight SQL service of the
+// server registered. The caller is responsible for calling Serve() and Shutdown() on it.
+func (s *Server) Listen(addr string) (flight.Server, error) {
+	server := flight.NewServerWithMiddleware(nil)
+	server.RegisterFlightService(flightsql.NewFlightServer(s))
+	if err := server.Init(addr); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// --------------------------- Statements ----------------------------
+
+// GetFlightInfoStatement validates the query and returns its schema along with a ticket to
+// execute it, the ticket being the text of the query itself.
+func (s *Server) GetFlightInfoStatement(ctx context.Context, cmd flightsql.StatementQuery, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	_, schema, err := s.prepare(cmd.GetQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, err := flightsql.CreateStatementQueryTicket([]byte(cmd.GetQuery()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &flight.FlightInfo{
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: ticket}}},
+		FlightDescriptor: desc,
+		Schema:           flight.SerializeSchema(schema, s.Alloc),
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}, nil
+}
+
+// GetSchemaStatement returns the schema of the result of the query, without executing it.
+func (s *Server) GetSchemaStatement(ctx context.Context, cmd flightsql.StatementQuery, desc *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	_, schema, err := s.prepare(cmd.GetQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	return &flight.SchemaResult{
+		Schema: flight.SerializeSchema(schema, s.Alloc),
+	}, nil
+}
+
+// DoGetStatement executes the query of the ticket and streams the selected rows, in batches
+// of the configured size.
+func (s *Server) DoGetStatement(ctx context.Context, ticket flightsql.StatementQueryTicket) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	q, schema, err := s.prepare(string(ticket.GetStatementHandle()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan flight.StreamChunk)
+	go func() {
+		defer close(ch)
+		if err := s.execute(ctx, q, schema, ch); err != nil {
+			send(ctx, ch, flight.StreamChunk{Err: err})
+		}
+	}()
+	return schema, ch, nil
+}
+
+// prepare parses the query and returns it along with the schema of its result
+func (s *Server) prepare(text string) (*query, *arrow.Schema, error) {
+	q, err := parseQuery(text)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	collection, err := s.collection(q.table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if q.count {
+		return q, arrow.NewSchema([]arrow.Field{
+			{Name: "count", Type: arrow.PrimitiveTypes.Int64},
+		}, nil), nil
+	}
+
+	schema, err := tableSchema(collection, q.columns)
+	return q, schema, err
+}
+
+// tableSchema returns the schema of the specified columns of a collection, or all of them
+func tableSchema(collection *column.Collection, columnNames []string) (*arrow.Schema, error) {
+	var columns []column.ColumnSchema
+	if err := collection.Query(func(txn *column.Txn) (err error) {
+		columns, err = txn.Schema(columnNames...)
+		return
+	}); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return schemaOf(columns), nil
+}
+
+// execute runs the query in a transaction of the collection and sends the result as record
+// batches into the channel. The batches are sent while the transaction is running, and the
+// execution stops as soon as the limit of the query is reached or the client goes away.
+func (s *Server) execute(ctx context.Context, q *query, schema *arrow.Schema, ch chan<- flight.StreamChunk) error {
+	collection, err := s.collection(q.table)
+	if err != nil {
+		return err
+	}
+
+	err = collection.Query(func(txn *column.Txn) error {
+		if q.where != "" {
+			txn = txn.WithExpr(q.where)
+		}
+
+		switch {
+		case q.count && q.limit == 0:
+			return nil
+		case q.count:
+			return s.sendCount(ctx, schema, int64(txn.Count()), ch)
+		}
+
+		remaining := q.limit
+		return txn.Export(column.ExportFunc(func(batch *column.ExportBatch) error {
+			rows := batch.Rows
+			if remaining >= 0 && rows > remaining {
+				rows = remaining
+			}
+
+			if rows > 0 {
+				record := recordOf(s.Alloc, schema, batch, rows)
+				if !send(ctx, ch, flight.StreamChunk{Data: record}) {
+					record.Release()
+					return ctx.Err()
+				}
+			}
+
+			if remaining -= rows; q.limit >= 0 && remaining == 0 {
+				return errLimit
+			}
+			return nil
+		}), s.options.BatchSize, q.columns...)
+	})
+
+	if errors.Is(err, errLimit) {
+		return nil
+	}
+	return err
+}
+
+// sendCount sends the result of a COUNT(*) query as a record with a single row
+func (s *Server) sendCount(ctx context.Context, schema *arrow.Schema, count int64, ch chan<- flight.StreamChunk) error {
+	builder := array.NewRecordBuilder(s.Alloc, schema)
+	defer builder.Release()
+
+	builder.Field(0).(*array.Int64Builder).Append(count)
+	record := builder.NewRecordBatch()
+	if !send(ctx, ch, flight.StreamChunk{Data: record}) {
+		record.Release()
+		return ctx.Err()
+	}
+	return nil
+}
+
+// collection returns the collection with the name of the table, or an error if not found
+func (s *Server) collection(table string) (*column.Collection, error) {
+	collection, ok := s.registry.Get(table)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "columnflight: table '%s' does not exist", table)
+	}
+	return collection, nil
+}
+
+// send sends a chunk into the channel, unless the context is cancelled first
+func send(ctx context.Context, ch chan<- flight.StreamChunk, chunk flight.StreamChunk) bool {
+	select {
+	case ch <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// --------------------------- Metadata ----------------------------
+
+// GetFlightInfoTables returns the schema of the listing of the tables
+func (s *Server) GetFlightInfoTables(ctx context.Context, cmd flightsql.GetTables, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	schema := schema_ref.Tables
+	if cmd.GetIncludeSchema() {
+		schema = schema_ref.TablesWithIncludedSchema
+	}
+	return s.flightInfoFor(desc, schema), nil
+}
+
+// DoGetTables lists the collections of the registry as tables, filtered by the name pattern
+// and the types of the request. The catalog and the database schema are always null.
+func (s *Server) DoGetTables(ctx context.Context, cmd flightsql.GetTables) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	schema := schema_ref.Tables
+	if cmd.GetIncludeSchema() {
+		schema = schema_ref.TablesWithIncludedSchema
+	}
+
+	builder := array.NewRecordBuilder(s.Alloc, schema)
+	defer builder.Release()
+
+	for _, name := range s.tablesOf(cmd) {
+		builder.Field(0).AppendNull()
+		builder.Field(1).AppendNull()
+		builder.Field(2).(*array.StringBuilder).Append(name)
+		builder.Field(3).(*array.StringBuilder).Append(tableType)
+		if !cmd.GetIncludeSchema() {
+			continue
+		}
+
+		collection, err := s.collection(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		table, err := tableSchema(collection, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		builder.Field(4).(*array.BinaryBuilder).Append(flight.SerializeSchema(table, s.Alloc))
+	}
+
+	return s.streamOf(schema, builder.NewRecordBatch())
+}
+
+// tablesOf returns the names of the tables which match the request
+func (s *Server) tablesOf(cmd flightsql.GetTables) (names []string) {
+	if types := cmd.GetTableTypes(); len(types) > 0 && !contains(types, tableType) {
+		return nil
+	}
+
+	for _, name := range s.registry.List() {
+		if pattern := cmd.GetTableNameFilterPattern(); pattern == nil || matchPattern(*pattern, name) {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// GetFlightInfoTableTypes returns the schema of the listing of the table types
+func (s *Server) GetFlightInfoTableTypes(ctx context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	return s.flightInfoFor(desc, schema_ref.TableTypes), nil
+}
+
+// DoGetTableTypes returns the only type of table supported
+func (s *Server) DoGetTableTypes(ctx context.Context) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	builder := array.NewRecordBuilder(s.Alloc, schema_ref.TableTypes)
+	defer builder.Release()
+
+	builder.Field(0).(*array.StringBuilder).Append(tableType)
+	return s.streamOf(schema_ref.TableTypes, builder.NewRecordBatch())
+}
+
+// flightInfoFor returns the flight info of a metadata command, using the command as a ticket
+func (s *Server) flightInfoFor(desc *flight.FlightDescriptor, schema *arrow.Schema) *flight.FlightInfo {
+	return &flight.FlightInfo{
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: desc.Cmd}}},
+		FlightDescriptor: desc,
+		Schema:           flight.SerializeSchema(schema, s.Alloc),
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}
+}
+
+// streamOf returns a stream containing a single record
+func (s *Server) streamOf(schema *arrow.Schema, record arrow.RecordBatch) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	ch := make(chan flight.StreamChunk, 1)
+	ch <- flight.StreamChunk{Data: record}
+	close(ch)
+	return schema, ch, nil
+}
+
+// matchPattern returns whether a name matches a SQL LIKE pattern, where '%' matches any
+// sequence of characters and '_' matches any single character.
+func matchPattern(pattern, name string) bool {
+	switch {
+	case pattern == "":
+		return name == ""
+	case pattern[0] == '%':
+		for i := 0; i <= len(name); i++ {
+			if matchPattern(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	case name == "":
+		return false
+	case pattern[0] == '_' || pattern[0] == name[0]:
+		return matchPattern(pattern[1:], name[1:])
+	default:
+		return false
+	}
+}
+
+// contains returns whether the list contains the value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package columnflight
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql"
+	"github.com/kelindar/column"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestServer(t *testing.T) {
+	client := newTestServer(t, Options{BatchSize: 100})
+	ctx := context.Background()
+
+	// The rows are streamed in batches, with the types of the columns
+	schema, rows := execute(t, client, "SELECT name, age, active FROM players WHERE age >= 20")
+	assert.Equal(t, "name", schema.Field(0).Name)
+	assert.Equal(t, arrow.BinaryTypes.String, schema.Field(0).Type)
+	assert.Equal(t, arrow.PrimitiveTypes.Int64, schema.Field(1).Type)
+	assert.Equal(t, arrow.FixedWidthTypes.Boolean, schema.Field(2).Type)
+	assert.Len(t, rows, 230)
+	assert.Equal(t, []any{"player-20", int64(20), true}, rows[0])
+
+	// The conditions, the limits and the counts are supported
+	_, rows = execute(t, client, "SELECT name FROM players WHERE age < 10 AND active = false LIMIT 3")
+	assert.Equal(t, [][]any{{"player-1"}, {"player-3"}, {"player-5"}}, rows)
+
+	_, rows = execute(t, client, "SELECT COUNT(*) FROM players WHERE name = 'player-42'")
+	assert.Equal(t, [][]any{{int64(1)}}, rows)
+
+	_, rows = execute(t, client, "SELECT age FROM players LIMIT 0")
+	assert.Len(t, rows, 0)
+
+	// The invalid queries are rejected before being executed
+	for _, sql := range []string{
+		"SELECT * FROM unknown",
+		"SELECT unknown FROM players",
+		"UPDATE players SET age = 1",
+	} {
+		_, err := client.Execute(ctx, sql)
+		assert.Error(t, err, sql)
+	}
+}
+
+func TestServerTables(t *testing.T) {
+	client := newTestServer(t, Options{})
+	ctx := context.Background()
+
+	pattern := "play%"
+	info, err := client.GetTables(ctx, &flightsql.GetTablesOpts{
+		TableNameFilterPattern: &pattern,
+		IncludeSchema:          true,
+	})
+	assert.NoError(t, err)
+
+	_, rows := readAll(t, client, info)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, []any{nil, nil, "players", "TABLE"}, rows[0][:4])
+
+	// The schema of the table is included
+	schema, err := flight.DeserializeSchema([]byte(rows[0][4].(string)), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"active", "age", "name"}, fieldNames(schema))
+
+	// The table types only contain tables
+	info, err = client.GetTableTypes(ctx)
+	assert.NoError(t, err)
+	_, rows = readAll(t, client, info)
+	assert.Equal(t, [][]any{{"TABLE"}}, rows)
+}
+
+// newTestServer starts a server with a registry containing a collection of players
+func newTestServer(t *testing.T, opts Options) *flightsql.Client {
+	registry := column.NewRegistry()
+	players, err := registry.Create("players")
+	assert.NoError(t, err)
+	players.CreateColumn("name", column.ForString())
+	players.CreateColumn("age", column.ForInt())
+	players.CreateColumn("active", column.ForBool())
+	for i := 0; i < 250; i++ {
+		players.Insert(func(r column.Row) error {
+			r.SetString("name", fmt.Sprintf("player-%d", i))
+			r.SetInt("age", i)
+			if i%2 == 0 {
+				r.SetBool("active", true)
+			}
+			return nil
+		})
+	}
+
+	_, err = registry.Create("games")
+	assert.NoError(t, err)
+
+	server, err := NewServer(registry, opts)
+	assert.NoError(t, err)
+	listener, err := server.Listen("localhost:0")
+	assert.NoError(t, err)
+	go listener.Serve()
+
+	client, err := flightsql.NewClient(listener.Addr().String(), nil, nil,
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		listener.Shutdown()
+		registry.Close()
+	})
+	return client
+}
+
+// execute executes the query and reads all of the rows of its result
+func execute(t *testing.T, client *flightsql.Client, sql string) (*arrow.Schema, [][]any) {
+	info, err := client.Execute(context.Background(), sql)
+	assert.NoError(t, err)
+	return readAll(t, client, info)
+}
+
+// readAll reads all of the rows of the first endpoint of the flight
+func readAll(t *testing.T, client *flightsql.Client, info *flight.FlightInfo) (*arrow.Schema, [][]any) {
+	reader, err := client.DoGet(context.Background(), info.Endpoint[0].Ticket)
+	assert.NoError(t, err)
+	defer reader.Release()
+
+	var rows [][]any
+	for reader.Next() {
+		record := reader.RecordBatch()
+		for i := 0; i < int(record.NumRows()); i++ {
+			row := make([]any, record.NumCols())
+			for j, col := range record.Columns() {
+				row[j] = valueAt(col, i)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	assert.NoError(t, reader.Err())
+	return reader.Schema(), rows
+}
+
+// valueAt returns the value of an array at the specified index
+func valueAt(arr arrow.Array, i int) any {
+	if arr.IsNull(i) {
+		return nil
+	}
+
+	switch v := arr.(type) {
+	case *array.String:
+		return v.Value(i)
+	case *array.Binary:
+		return string(v.Value(i))
+	case *array.Int64:
+		return v.Value(i)
+	case *array.Boolean:
+		return v.Value(i)
+	default:
+		return v.ValueStr(i)
+	}
+}
+
+// fieldNames returns the names of the fields of the schema
+func fieldNames(schema *arrow.Schema) (names []string) {
+	for _, field := range schema.Fields() {
+		names = append(names, field.Name)
+	}
+	return
+}
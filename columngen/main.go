@@ -0,0 +1,227 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+// Command columngen generates a strongly typed wrapper around a collection for a struct, with
+// a column per field, typed inserts, lookups and filters, without any reflection. It is meant
+// to be used with go:generate, next to the definition of the struct:
+//
+//	//go:generate go run github.com/kelindar/column/columngen -type Player
+//
+// The columns are named after the "column" tags of the fields or their lowercased names. The
+// tag may also specify the "key" option for the primary key or the "enum" option for the
+// strings with few distinct values, while the fields tagged with "-" are skipped.
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed wrapper.tpl
+var wrapper string
+
+// Wrapper represents the input of the template, for a single struct
+type Wrapper struct {
+	Package string  // The name of the package
+	Type    string  // The name of the struct
+	Fields  []Field // The fields of the struct mapped to columns
+	Key     *Field  // The field of the primary key, if any
+}
+
+// Field represents a field of the struct mapped to a column
+type Field struct {
+	Name       string // The name of the field
+	Column     string // The name of the column
+	Type       string // The Go type of the field
+	Kind       string // The kind of the column, as used by the constructors and the row accessors
+	Filter     string // The kind of the filter of the transaction
+	FilterType string // The type of the value of the filter
+}
+
+func main() {
+	typeName := flag.String("type", "", "the name of the struct to generate the wrapper for")
+	output := flag.String("output", "", "the output file, by default <type>_column.go")
+	flag.Parse()
+
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_column.go"
+	}
+
+	if err := run(".", *typeName, *output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run generates the wrapper for a struct defined in the package of the directory
+func run(dir, typeName, output string) error {
+	w, err := parse(dir, typeName)
+	if err != nil {
+		return err
+	}
+
+	code, err := generate(w)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, code, 0644)
+}
+
+// generate executes the template and formats the generated code
+func generate(w *Wrapper) ([]byte, error) {
+	t, err := template.New("wrapper").Parse(wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, w); err != nil {
+		return nil, err
+	}
+
+	return format.Source(out.Bytes())
+}
+
+// parse finds the definition of the struct in the package of the directory
+func parse(dir, typeName string) (*Wrapper, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			obj := file.Scope.Lookup(typeName)
+			if obj == nil {
+				continue
+			}
+
+			if spec, ok := obj.Decl.(*ast.TypeSpec); ok {
+				if st, ok := spec.Type.(*ast.StructType); ok {
+					return parseStruct(pkg.Name, typeName, st)
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("columngen: struct '%s' not found", typeName)
+}
+
+// parseStruct maps the fields of the struct to the columns
+func parseStruct(pkg, typeName string, st *ast.StructType) (*Wrapper, error) {
+	w := &Wrapper{Package: pkg, Type: typeName}
+	for _, f := range st.Fields.List {
+		ident, ok := f.Type.(*ast.Ident)
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+
+			column, options := columnOf(name.Name, f.Tag)
+			if column == "-" {
+				continue
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("columngen: unsupported type of field '%s'", name.Name)
+			}
+
+			field, err := fieldOf(name.Name, column, ident.Name, options)
+			if err != nil {
+				return nil, err
+			}
+
+			w.Fields = append(w.Fields, field)
+		}
+	}
+
+	if len(w.Fields) == 0 {
+		return nil, fmt.Errorf("columngen: struct '%s' has no exported fields", typeName)
+	}
+
+	for i := range w.Fields {
+		if w.Fields[i].Kind != "Key" {
+			continue
+		}
+
+		if w.Key != nil {
+			return nil, fmt.Errorf("columngen: struct '%s' has more than one key", typeName)
+		}
+		w.Key = &w.Fields[i]
+	}
+	return w, nil
+}
+
+// columnOf returns the name of the column and its options, from the tag of the field
+func columnOf(fieldName string, tag *ast.BasicLit) (string, []string) {
+	if tag != nil {
+		if text, err := strconv.Unquote(tag.Value); err == nil {
+			if value, ok := reflect.StructTag(text).Lookup("column"); ok {
+				parts := strings.Split(value, ",")
+				if parts[0] != "" {
+					return parts[0], parts[1:]
+				}
+				return lowerFirst(fieldName), parts[1:]
+			}
+		}
+	}
+
+	return lowerFirst(fieldName), nil
+}
+
+// fieldOf maps a field to a column based on its type and the options of its tag
+func fieldOf(name, column, typ string, options []string) (Field, error) {
+	field := Field{Name: name, Column: column, Type: typ}
+	switch typ {
+	case "string":
+		field.Kind, field.Filter, field.FilterType = "String", "String", "string"
+		for _, option := range options {
+			switch option {
+			case "key":
+				field.Kind = "Key"
+			case "enum":
+				field.Kind = "Enum"
+			}
+		}
+	case "bool":
+		field.Kind = "Bool"
+	case "int", "int16", "int32", "int64":
+		field.Kind, field.Filter, field.FilterType = title(typ), "Int", "int64"
+	case "uint", "uint16", "uint32", "uint64":
+		field.Kind, field.Filter, field.FilterType = title(typ), "Uint", "uint64"
+	case "float32", "float64":
+		field.Kind, field.Filter, field.FilterType = title(typ), "Float", "float64"
+	default:
+		return field, fmt.Errorf("columngen: unsupported type '%s' of field '%s'", typ, name)
+	}
+	return field, nil
+}
+
+// title returns the string with its first letter in upper case
+func title(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// lowerFirst returns the string with its first letter in lower case
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateExample(t *testing.T) {
+	w, err := parse("../examples/typed", "Player")
+	assert.NoError(t, err)
+	assert.Equal(t, "main", w.Package)
+	assert.Len(t, w.Fields, 6)
+	assert.Equal(t, "Serial", w.Key.Name)
+
+	// The generated example must be up to date
+	code, err := generate(w)
+	assert.NoError(t, err)
+	expect, err := os.ReadFile("../examples/typed/player_column.go")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expect), string(code))
+}
+
+func TestGenerateUnkeyed(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "point.go"), []byte(`package geo
+
+type Point struct {
+	X, Y   float32
+	Label  string `+"`column:\"name,enum\"`"+`
+	Weight uint16
+	hidden int
+}
+`), 0644))
+
+	output := filepath.Join(dir, "point_column.go")
+	assert.NoError(t, run(dir, "Point", output))
+
+	code, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Contains(t, string(code), "package geo\n")
+	assert.Contains(t, string(code), `c.CreateColumn("x", column.ForFloat32())`)
+	assert.Contains(t, string(code), `c.CreateColumn("name", column.ForEnum())`)
+	assert.Contains(t, string(code), "func (c *PointCollection) Insert(v Point) (uint32, error) {")
+	assert.Contains(t, string(code), "q.Txn.WithUint(\"weight\", func(v uint64) bool {\n\t\treturn predicate(uint16(v))")
+	assert.NotContains(t, string(code), "hidden")
+	assert.NotContains(t, string(code), "UpsertKey")
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "types.go"), []byte(`package types
+
+type Tags struct {
+	Values []string
+}
+
+type Keys struct {
+	A string `+"`column:\",key\"`"+`
+	B string `+"`column:\",key\"`"+`
+}
+
+type Empty struct {
+	hidden int
+}
+
+type Unsupported struct {
+	Value complex64
+}
+`), 0644))
+
+	for _, typeName := range []string{"Tags", "Keys", "Empty", "Unsupported", "Missing"} {
+		_, err := parse(dir, typeName)
+		assert.Error(t, err, typeName)
+	}
+}
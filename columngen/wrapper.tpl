@@ -0,0 +1,140 @@
+// Code generated by columngen, DO NOT EDIT.
+// Any changes will be lost if this file is regenerated.
+
+package {{.Package}}
+
+import (
+	"github.com/kelindar/column"
+)
+
+// {{.Type}}Collection represents a collection of {{.Type}} values, with strongly typed
+// accessors for each of their fields.
+type {{.Type}}Collection struct {
+	*column.Collection
+}
+
+// New{{.Type}}Collection creates a new collection with a column for each field of {{.Type}}
+func New{{.Type}}Collection(opts ...column.Options) *{{.Type}}Collection {
+	c := column.NewCollection(opts...)
+{{- range .Fields }}
+	c.CreateColumn("{{.Column}}", column.For{{.Kind}}())
+{{- end }}
+	return &{{.Type}}Collection{Collection: c}
+}
+
+{{- if .Key }}
+
+// InsertKey inserts a new {{.Type}}, failing if one with the same key already exists
+func (c *{{.Type}}Collection) InsertKey(v {{.Type}}) error {
+	return c.Collection.InsertKey(v.{{.Key.Name}}, func(r column.Row) error {
+		set{{.Type}}(r, &v)
+		return nil
+	})
+}
+{{- else }}
+
+// Insert inserts a new {{.Type}} and returns its index
+func (c *{{.Type}}Collection) Insert(v {{.Type}}) (uint32, error) {
+	return c.Collection.Insert(func(r column.Row) error {
+		set{{.Type}}(r, &v)
+		return nil
+	})
+}
+{{- end }}
+{{- with .Key }}
+
+// UpsertKey inserts a new {{$.Type}} or updates the existing one with the same key
+func (c *{{$.Type}}Collection) UpsertKey(v {{$.Type}}) error {
+	return c.Collection.UpsertKey(v.{{.Name}}, func(r column.Row) error {
+		set{{$.Type}}(r, &v)
+		return nil
+	})
+}
+
+// SelectAtKey returns the {{$.Type}} with the specified key, if it exists
+func (c *{{$.Type}}Collection) SelectAtKey(key string) (v {{$.Type}}, ok bool) {
+	c.Collection.QueryKey(key, func(r column.Row) error {
+		v, ok = get{{$.Type}}(r), true
+		return nil
+	})
+	return
+}
+{{- end }}
+
+// Query creates a transaction on the collection, similarly to Collection.Query()
+func (c *{{.Type}}Collection) Query(fn func(q {{.Type}}Query) error) error {
+	return c.Collection.Query(func(txn *column.Txn) error {
+		return fn({{.Type}}Query{Txn: txn})
+	})
+}
+
+// --------------------------- Query ----------------------------
+
+// {{.Type}}Query represents a transaction on a collection of {{.Type}} values, with strongly
+// typed filters for each of their fields.
+type {{.Type}}Query struct {
+	*column.Txn
+}
+
+// Range iterates over the {{.Type}} values of the current selection
+func (q {{.Type}}Query) Range(fn func(idx uint32, v {{.Type}})) error {
+	return q.Txn.RangeRows(func(r column.Row) error {
+		fn(r.Index(), get{{.Type}}(r))
+		return nil
+	})
+}
+
+// Update overwrites the values of the current selection with the values returned by the function
+func (q {{.Type}}Query) Update(fn func(v *{{.Type}})) error {
+	return q.Txn.RangeRows(func(r column.Row) error {
+		v := get{{.Type}}(r)
+		fn(&v)
+		set{{.Type}}(r, &v)
+		return nil
+	})
+}
+{{ range .Fields }}
+{{- if eq .Kind "Bool" }}
+// With{{.Name}} filters down the rows for which {{.Name}} is true
+func (q {{$.Type}}Query) With{{.Name}}() {{$.Type}}Query {
+	q.Txn.With("{{.Column}}")
+	return q
+}
+{{ else }}
+// With{{.Name}} filters down the rows for which the predicate on {{.Name}} returns true
+func (q {{$.Type}}Query) With{{.Name}}(predicate func(v {{.Type}}) bool) {{$.Type}}Query {
+{{- if eq .Filter "String" }}
+	q.Txn.WithString("{{.Column}}", predicate)
+{{- else if eq .FilterType .Type }}
+	q.Txn.With{{.Filter}}("{{.Column}}", predicate)
+{{- else }}
+	q.Txn.With{{.Filter}}("{{.Column}}", func(v {{.FilterType}}) bool {
+		return predicate({{.Type}}(v))
+	})
+{{- end }}
+	return q
+}
+{{ end }}
+{{- end }}
+// --------------------------- Mapping ----------------------------
+
+// set{{.Type}} writes the fields of {{.Type}} into the row, except for its key
+func set{{.Type}}(r column.Row, v *{{.Type}}) {
+{{- range .Fields }}{{ if ne .Kind "Key" }}
+	r.Set{{.Kind}}("{{.Column}}", v.{{.Name}})
+{{- end }}{{ end }}
+}
+
+// get{{.Type}} reads the fields of {{.Type}} from the row
+func get{{.Type}}(r column.Row) (v {{.Type}}) {
+{{- range .Fields }}
+{{- if eq .Kind "Key" }}
+	v.{{.Name}}, _ = r.Key()
+{{- else if eq .Kind "Bool" }}
+	v.{{.Name}} = r.Bool("{{.Column}}")
+{{- else }}
+	v.{{.Name}}, _ = r.{{.Kind}}("{{.Column}}")
+{{- end }}
+{{- end }}
+	return
+}
@@ -0,0 +1,237 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+// Package columntest provides the dataset builders and the golden file helpers in order to
+// write reproducible tests against collections. The collections are built from the players
+// fixture, either by copying it or by drawing random players from a seeded generator.
+package columntest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/kelindar/column"
+	"github.com/kelindar/column/fixtures"
+)
+
+// Columns contains the names of the columns of the players collection
+var Columns = []string{
+	"serial", "name", "active", "class", "race", "age",
+	"hp", "mp", "balance", "gender", "guild", "location",
+}
+
+// NewPlayers creates an empty collection with the schema of the players fixture, along with
+// the "human", "dwarf", "elf", "orc", "mage" and "old" (age >= 30) indexes.
+func NewPlayers(capacity int) *column.Collection {
+	out := column.NewCollection(column.Options{
+		Capacity: capacity,
+	})
+
+	out.CreateColumn("serial", column.ForString())
+	out.CreateColumn("name", column.ForString())
+	out.CreateColumn("active", column.ForBool())
+	out.CreateColumn("class", column.ForEnum())
+	out.CreateColumn("race", column.ForEnum())
+	out.CreateColumn("age", column.ForInt())
+	out.CreateColumn("hp", column.ForInt())
+	out.CreateColumn("mp", column.ForInt())
+	out.CreateColumn("balance", column.ForFloat64())
+	out.CreateColumn("gender", column.ForEnum())
+	out.CreateColumn("guild", column.ForEnum())
+	out.CreateColumn("location", column.ForRecord(func() *fixtures.Location {
+		return new(fixtures.Location)
+	}))
+
+	for _, race := range []string{"human", "dwarf", "elf", "orc"} {
+		race := race
+		out.CreateIndex(race, "race", func(r column.Reader) bool {
+			return r.String() == race
+		})
+	}
+
+	out.CreateIndex("mage", "class", func(r column.Reader) bool {
+		return r.String() == "mage"
+	})
+	out.CreateIndex("old", "age", func(r column.Reader) bool {
+		return r.Int() >= 30
+	})
+	return out
+}
+
+// Players creates a collection of players by copying the players fixture, in order, until
+// the specified amount is reached.
+func Players(amount int) *column.Collection {
+	data := fixtures.Players()
+	players := make([]fixtures.Player, 0, amount)
+	for i := 0; i < amount; i++ {
+		players = append(players, data[i%len(data)])
+	}
+
+	out := NewPlayers(amount)
+	if err := InsertPlayers(out, players); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// RandomPlayers creates a collection of random players. Their attributes are drawn from the
+// players fixture and the numbers are generated, so the same seed always generates the same
+// collection.
+func RandomPlayers(seed int64, amount int) *column.Collection {
+	out := NewPlayers(amount)
+	if err := InsertPlayers(out, Generate(seed, amount)); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Generate generates the specified amount of random players using a seeded generator
+func Generate(seed int64, amount int) []fixtures.Player {
+	rng := rand.New(rand.NewSource(seed))
+	data := fixtures.Players()
+	pick := func() fixtures.Player {
+		return data[rng.Intn(len(data))]
+	}
+
+	players := make([]fixtures.Player, 0, amount)
+	for i := 0; i < amount; i++ {
+		players = append(players, fixtures.Player{
+			Serial:  fmt.Sprintf("%016x", rng.Uint64()),
+			Name:    pick().Name,
+			Active:  rng.Intn(2) == 1,
+			Class:   pick().Class,
+			Race:    pick().Race,
+			Age:     18 + rng.Intn(50),
+			Hp:      rng.Intn(100),
+			Mp:      rng.Intn(100),
+			Balance: math.Round(rng.Float64()*500000) / 100,
+			Gender:  pick().Gender,
+			Guild:   pick().Guild,
+			Location: fixtures.Location{
+				X: float64(rng.Intn(2000)),
+				Y: float64(rng.Intn(2000)),
+			},
+		})
+	}
+	return players
+}
+
+// InsertPlayers inserts the players into a collection created with NewPlayers()
+func InsertPlayers(dst *column.Collection, players []fixtures.Player) error {
+	return dst.Query(func(txn *column.Txn) error {
+		for _, v := range players {
+			v := v
+			if _, err := txn.Insert(func(r column.Row) error {
+				r.SetString("serial", v.Serial)
+				r.SetString("name", v.Name)
+				r.SetBool("active", v.Active)
+				r.SetEnum("class", v.Class)
+				r.SetEnum("race", v.Race)
+				r.SetInt("age", v.Age)
+				r.SetInt("hp", v.Hp)
+				r.SetInt("mp", v.Mp)
+				r.SetFloat64("balance", v.Balance)
+				r.SetEnum("gender", v.Gender)
+				r.SetEnum("guild", v.Guild)
+				return r.SetRecord("location", &v.Location)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// --------------------------- Golden Files ----------------------------
+
+// UpdateEnv is the environment variable which, when set, makes Golden() overwrite the
+// golden files with the current contents of the collections instead of comparing them.
+const UpdateEnv = "COLUMNTEST_UPDATE"
+
+// Dump returns a deterministic textual representation of the specified columns of the
+// collection, with one line per row in the order of their indexes. The values which are
+// not present are written as "<nil>".
+func Dump(coll *column.Collection, columns ...string) (string, error) {
+	var rows []uint32
+	if err := coll.Query(func(txn *column.Txn) error {
+		return txn.Range(func(idx uint32) {
+			rows = append(rows, idx)
+		})
+	}); err != nil {
+		return "", err
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i] < rows[j] })
+	out := bytes.NewBuffer(nil)
+	for _, idx := range rows {
+		if err := coll.QueryAt(idx, func(r column.Row) error {
+			fmt.Fprintf(out, "%d", idx)
+			for _, name := range columns {
+				value, _ := r.Any(name)
+				fmt.Fprintf(out, "\t%s=%v", name, value)
+			}
+			out.WriteByte('\n')
+			return nil
+		}); err != nil {
+			return "", err
+		}
+	}
+	return out.String(), nil
+}
+
+// Golden compares the dump of the specified columns of the collection with the contents of
+// a golden file and fails the test if they differ. The golden file is written if it does not
+// exist yet, or if the COLUMNTEST_UPDATE environment variable is set.
+func Golden(t testing.TB, path string, coll *column.Collection, columns ...string) {
+	t.Helper()
+	got, err := Dump(coll, columns...)
+	if err != nil {
+		t.Fatalf("columntest: unable to dump the collection, %v", err)
+	}
+
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) || os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("columntest: unable to write golden file, %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("columntest: unable to write golden file, %v", err)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("columntest: unable to read golden file, %v", err)
+	}
+
+	if string(want) != got {
+		t.Errorf("columntest: collection does not match golden file '%s', run with %s=1 to update it\n%s",
+			path, UpdateEnv, diff(string(want), got))
+	}
+}
+
+// diff returns the first line which differs between the expected and the actual dumps
+func diff(want, got string) string {
+	wantLines := bytes.Split([]byte(want), []byte{'\n'})
+	gotLines := bytes.Split([]byte(got), []byte{'\n'})
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g []byte
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+
+		if !bytes.Equal(w, g) {
+			return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, w, g)
+		}
+	}
+	return ""
+}
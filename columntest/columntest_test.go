@@ -0,0 +1,67 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package columntest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kelindar/column"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlayers(t *testing.T) {
+	players := Players(1200)
+	assert.Equal(t, 1200, players.Count())
+	assert.NoError(t, players.QueryAt(500, func(r column.Row) error {
+		name, _ := r.String("name")
+		assert.Equal(t, "Maura Daugherty", name)
+		return nil
+	}))
+
+	assert.NoError(t, players.Query(func(txn *column.Txn) error {
+		assert.NotZero(t, txn.With("human", "mage", "old").Count())
+		return nil
+	}))
+}
+
+func TestRandomPlayers(t *testing.T) {
+	a, err := Dump(RandomPlayers(42, 300), Columns...)
+	assert.NoError(t, err)
+	b, err := Dump(RandomPlayers(42, 300), Columns...)
+	assert.NoError(t, err)
+	c, err := Dump(RandomPlayers(7, 300), Columns...)
+	assert.NoError(t, err)
+
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+	assert.Contains(t, a, "299\tserial=")
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "players.golden")
+	players := RandomPlayers(1, 50)
+
+	// The golden file is written on the first run, and then compared
+	Golden(t, path, players, Columns...)
+	assert.FileExists(t, path)
+	Golden(t, path, players, Columns...)
+
+	// A change is reported
+	players.QueryAt(10, func(r column.Row) error {
+		r.SetInt("age", 99)
+		return nil
+	})
+
+	mock := new(testing.T)
+	Golden(mock, path, players, Columns...)
+	assert.True(t, mock.Failed())
+
+	// The golden file can be updated
+	t.Setenv(UpdateEnv, "1")
+	Golden(t, path, players, "age")
+	golden, _ := os.ReadFile(path)
+	assert.Contains(t, string(golden), "10\tage=99\n")
+}
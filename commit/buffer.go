@@ -5,6 +5,7 @@ package commit
 
 import (
 	"encoding"
+	"encoding/binary"
 	"fmt"
 	"math"
 
@@ -58,12 +59,14 @@ func (o OpType) String() string {
 
 // Buffer represents a buffer of delta operations.
 type Buffer struct {
-	last   int32    // The last offset written
-	chunk  Chunk    // The current chunk
-	buffer []byte   // The destination buffer
-	chunks []header // The offsets of chunks
-	_      [8]byte  // padding
-	Column string   // The column for the queue
+	last   int32      // The last offset written
+	chunk  Chunk      // The current chunk
+	buffer []byte     // The destination buffer
+	chunks []header   // The offsets of chunks
+	caps   Capability // The encoding capabilities used
+	merges bool       // Whether there are variable-size merges
+	_      [3]byte    // padding
+	Column string     // The column for the queue
 }
 
 // header represents a chunk metadata header.
@@ -94,15 +97,50 @@ func (b *Buffer) Clone() *Buffer {
 		chunks: chunks,
 		last:   b.last,
 		chunk:  b.chunk,
+		caps:   b.caps,
+		merges: b.merges,
 	}
 }
 
+// cloneChunk clones the parts of the buffer which belong to a specified chunk.
+func (b *Buffer) cloneChunk(chunk Chunk) *Buffer {
+	clone := &Buffer{
+		Column: b.Column,
+		last:   b.last,
+		chunk:  chunk,
+		caps:   b.caps,
+		merges: b.merges,
+	}
+
+	for i, c := range b.chunks {
+		if c.Chunk != chunk {
+			continue
+		}
+
+		// Find the end of the chunk and copy it over
+		x0, x1 := c.Start, uint32(len(b.buffer))
+		if len(b.chunks) > i+1 {
+			x1 = b.chunks[i+1].Start
+		}
+
+		clone.chunks = append(clone.chunks, header{
+			Chunk: chunk,
+			Start: uint32(len(clone.buffer)),
+			Value: c.Value,
+		})
+		clone.buffer = append(clone.buffer, b.buffer[x0:x1]...)
+	}
+	return clone
+}
+
 // Reset resets the queue so it can be reused.
 func (b *Buffer) Reset(column string) {
 	b.last = 0
 	b.chunk = math.MaxUint32
 	b.buffer = b.buffer[:0]
 	b.chunks = b.chunks[:0]
+	b.caps = 0
+	b.merges = false
 	b.Column = column
 }
 
@@ -111,6 +149,18 @@ func (b *Buffer) IsEmpty() bool {
 	return len(b.buffer) == 0
 }
 
+// Len returns the number of bytes encoded in the buffer.
+func (b *Buffer) Len() int {
+	return len(b.buffer)
+}
+
+// IsParallel returns whether the different chunks of the buffer can be applied in
+// parallel. This is not the case if the buffer contains merges of variable-size values,
+// since resolving them may append new operations at the end of the buffer.
+func (b *Buffer) IsParallel() bool {
+	return !b.merges
+}
+
 // Range iterates over the chunks present in the buffer
 func (b *Buffer) RangeChunks(fn func(chunk Chunk)) {
 	for _, c := range b.chunks {
@@ -248,32 +298,38 @@ func (b *Buffer) PutBool(idx uint32, value bool) {
 	b.PutOperation(op, idx)
 }
 
-// PutBytes appends a binary value.
+// PutBytes appends a binary value. Values up to 64KB are prefixed with a 2-byte length,
+// while the longer ones are prefixed with a variable-size length. Since the latter can not
+// be decoded by older readers, the buffer is then marked with the long string capability.
 func (b *Buffer) PutBytes(op OpType, idx uint32, value []byte) {
 	delta := b.writeChunk(idx)
-	length := len(value) // max 65K slices
-	switch delta {
-	case 1:
-		b.buffer = append(b.buffer,
-			byte(op)|size2|isString|isNext,
-			byte(length>>8), byte(length),
-		)
-		b.buffer = append(b.buffer, value...)
+	length := len(value)
+	b.merges = b.merges || op == Merge
+
+	head := byte(op) | isString
+	if delta == 1 {
+		head |= isNext
+	}
+
+	switch {
+	case length > math.MaxUint16:
+		b.caps |= capLongString
+		b.buffer = append(b.buffer, head|size8)
+		b.buffer = binary.AppendUvarint(b.buffer, uint64(length))
 	default:
-		b.buffer = append(b.buffer,
-			byte(op)|size2|isString,
-			byte(length>>8), byte(length),
-		)
+		b.buffer = append(b.buffer, head|size2, byte(length>>8), byte(length))
+	}
 
-		// Write the the data itself and the offset
-		b.buffer = append(b.buffer, value...)
+	// Write the the data itself and the offset
+	b.buffer = append(b.buffer, value...)
+	if delta != 1 {
 		b.writeOffset(uint32(delta))
 	}
 }
 
 // PutString appends a string value.
 func (b *Buffer) PutString(op OpType, idx uint32, value string) {
-	b.PutBytes(op, idx, toBytes(value))
+	b.PutBytes(op, idx, ToBytes(value))
 }
 
 // PutBitmap iterates over the bitmap values and appends an operation for each bit set to one
@@ -4,20 +4,38 @@
 package commit
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
-	"reflect"
-	"unsafe"
+	"math"
 
 	"github.com/kelindar/iostream"
 )
 
+// marker is written at the beginning of a versioned buffer. It is a non-minimal varint encoding
+// of zero, which is never written at the beginning of a legacy buffer since a legacy buffer
+// starts with the varint length of the column name.
+var marker = []byte{0x80, 0x00}
+
 // --------------------------- WriteTo ----------------------------
 
 // WriteTo writes data to w until there's no more data to write or when an error occurs. The return
 // value n is the number of bytes written. Any error encountered during the write is also returned.
 func (b *Buffer) WriteTo(dst io.Writer) (int64, error) {
 	w := iostream.NewWriter(dst)
+	if _, err := w.Write(marker); err != nil {
+		return w.Offset(), err
+	}
+
+	// Write the format version and capabilities
+	if err := w.WriteUvarint(Version); err != nil {
+		return w.Offset(), err
+	}
+	if err := w.WriteUvarint(uint64(b.caps)); err != nil {
+		return w.Offset(), err
+	}
+
 	if err := w.WriteString(b.Column); err != nil {
 		return w.Offset(), err
 	}
@@ -45,14 +63,60 @@ func (b *Buffer) WriteTo(dst io.Writer) (int64, error) {
 // --------------------------- ReadFrom ----------------------------
 
 // ReadFrom reads data from r until EOF or error. The return value n is the number of
-// bytes read. Any error except EOF encountered during the read is also returned.
+// bytes read. Any error except EOF encountered during the read is also returned. The
+// legacy buffers, which were encoded without the format version, are detected as well.
 func (b *Buffer) ReadFrom(src io.Reader) (int64, error) {
+	r := iostream.NewReader(src)
+	size, versioned, err := readPrefix(r)
+	if err != nil {
+		return r.Offset(), err
+	}
+
+	// Read the format version and capabilities, followed by the column name
+	b.caps = 0
+	if versioned {
+		version, err := r.ReadUvarint()
+		if err != nil {
+			return r.Offset(), err
+		}
+		caps, err := r.ReadUvarint()
+		if err != nil {
+			return r.Offset(), err
+		}
+		if err := checkFormat(version, Capability(caps)); err != nil {
+			return r.Offset(), err
+		}
+		if size, err = r.ReadUvarint(); err != nil {
+			return r.Offset(), err
+		}
+		b.caps = Capability(caps)
+	}
+
+	column, err := readSized(r, size)
+	if err != nil {
+		return r.Offset(), err
+	}
+
+	b.Column = string(column)
+	return b.readBody(r)
+}
+
+// ReadLegacyFrom reads a buffer which was encoded without the format version, as written
+// by the first version of the snapshot format.
+func (b *Buffer) ReadLegacyFrom(src io.Reader) (int64, error) {
 	r := iostream.NewReader(src)
 	var err error
-	if b.Column, err = r.ReadString(); err != nil {
+	if b.Column, err = readString(r); err != nil {
 		return r.Offset(), err
 	}
 
+	b.caps = 0
+	return b.readBody(r)
+}
+
+// readBody reads the part of the buffer which follows the column name
+func (b *Buffer) readBody(r *iostream.Reader) (int64, error) {
+	var err error
 	if b.last, err = r.ReadInt32(); err != nil {
 		return r.Offset(), err
 	}
@@ -61,7 +125,7 @@ func (b *Buffer) ReadFrom(src io.Reader) (int64, error) {
 		return r.Offset(), err
 	}
 
-	if b.buffer, err = r.ReadBytes(); err != nil {
+	if b.buffer, err = readBytes(r); err != nil {
 		return r.Offset(), err
 	}
 
@@ -80,28 +144,77 @@ func readChunksFrom(r *iostream.Reader) ([]header, error) {
 		return nil, err
 	}
 
-	v := make([]header, size)
+	// The size may be corrupted, so only pre-allocate a reasonable amount of headers
+	v := make([]header, 0, capacityOf(size, 1024))
 	var temp [12]byte
-	for i := 0; i < int(size); i++ {
+	for i := uint64(0); i < size; i++ {
 		if _, err := io.ReadFull(r, temp[:]); err != nil {
 			return nil, err
 		}
 
-		v[i].Chunk = Chunk(binary.BigEndian.Uint32(temp[0:4]))
-		v[i].Start = binary.BigEndian.Uint32(temp[4:8])
-		v[i].Value = binary.BigEndian.Uint32(temp[8:12])
+		v = append(v, header{
+			Chunk: Chunk(binary.BigEndian.Uint32(temp[0:4])),
+			Start: binary.BigEndian.Uint32(temp[4:8]),
+			Value: binary.BigEndian.Uint32(temp[8:12]),
+		})
 	}
 	return v, nil
 }
 
-// toBytes converts a string to a byte slice without allocating.
-func toBytes(v string) (b []byte) {
-	strHeader := (*reflect.StringHeader)(unsafe.Pointer(&v))
-	byteHeader := (*reflect.SliceHeader)(unsafe.Pointer(&b))
-	byteHeader.Data = strHeader.Data
+// readPrefix reads the varint at the beginning of a buffer, which is either the marker of a
+// versioned buffer or the length of the column name of a legacy buffer.
+func readPrefix(r *iostream.Reader) (size uint64, versioned bool, err error) {
+	for i, shift := 0, uint(0); i < binary.MaxVarintLen64; i, shift = i+1, shift+7 {
+		v, err := r.ReadUint8()
+		switch {
+		case err != nil:
+			return 0, false, err
+		case v < 0x80:
+			if i == len(marker)-1 && size == 0 && v == 0 {
+				return 0, true, nil
+			}
+			return size | uint64(v)<<shift, false, nil
+		}
+
+		size |= uint64(v&0x7f) << shift
+	}
+	return 0, false, fmt.Errorf("commit: invalid size prefix")
+}
 
-	l := len(v)
-	byteHeader.Len = l
-	byteHeader.Cap = l
-	return
+// readBytes reads a byte slice prefixed with its size.
+func readBytes(r *iostream.Reader) ([]byte, error) {
+	size, err := r.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	return readSized(r, size)
+}
+
+// readSized reads a byte slice of the specified size. Unlike the underlying reader, the
+// slice grows as the data is read so that a corrupted size does not allocate a huge slice.
+func readSized(r *iostream.Reader, size uint64) ([]byte, error) {
+	if size > math.MaxInt32 {
+		return nil, fmt.Errorf("commit: invalid size %d", size)
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, capacityOf(size, 64*1024)))
+	n, err := out.ReadFrom(io.LimitReader(r, int64(size)))
+	if err == nil && n < int64(size) {
+		err = io.ErrUnexpectedEOF
+	}
+	return out.Bytes(), err
+}
+
+// readString reads a string prefixed with its size.
+func readString(r *iostream.Reader) (string, error) {
+	b, err := readBytes(r)
+	return string(b), err
+}
+
+// capacityOf returns the capacity to pre-allocate for a size, up to a limit
+func capacityOf(size uint64, limit int) int {
+	if size > uint64(limit) {
+		return limit
+	}
+	return int(size)
 }
@@ -5,6 +5,8 @@ package commit
 
 import (
 	"bytes"
+	"math"
+	"strings"
 	"testing"
 	"time"
 	"unsafe"
@@ -135,7 +137,7 @@ func run(name string, b *testing.B, count int, fn func(buf *Buffer, r *Reader))
 }
 
 func TestSizeof(t *testing.T) {
-	assert.Equal(t, 96, int(unsafe.Sizeof(Reader{})))
+	assert.Equal(t, 112, int(unsafe.Sizeof(Reader{})))
 	assert.Equal(t, 80, int(unsafe.Sizeof(Buffer{})))
 }
 
@@ -227,6 +229,8 @@ func TestBufferClone(t *testing.T) {
 
 	cloned := buf.Clone()
 	assert.EqualValues(t, buf, cloned)
+	assert.NotZero(t, cloned.Len())
+	assert.Equal(t, buf.Len(), cloned.Len())
 }
 
 func TestPutNil(t *testing.T) {
@@ -259,6 +263,50 @@ func TestPutBitmap(t *testing.T) {
 	assert.Equal(t, Insert, r.Type)
 }
 
+func TestPutLongString(t *testing.T) {
+	long := strings.Repeat("x", math.MaxUint16+1)
+	buf := NewBuffer(0)
+	buf.PutString(Put, 10, "short")
+	assert.Equal(t, Capability(0), buf.caps)
+
+	buf.PutString(Put, 11, long)
+	buf.PutString(Merge, 20, long+long)
+	buf.PutString(Put, 21, "short")
+	assert.Equal(t, capLongString, buf.caps)
+	assert.NoError(t, Validate(buf))
+
+	// Read the values back
+	r := NewReader()
+	r.Seek(buf)
+	for _, expect := range []struct {
+		index uint32
+		value string
+	}{{10, "short"}, {11, long}, {20, long + long}, {21, "short"}} {
+		assert.True(t, r.Next())
+		assert.Equal(t, expect.index, r.Index())
+		assert.Equal(t, expect.value, r.String())
+	}
+	assert.False(t, r.Next())
+
+	// Swapping a value with a long one
+	r.Range(buf, 0, func(r *Reader) {
+		assert.True(t, r.Next())
+		r.SwapString(long)
+	})
+	assert.NoError(t, Validate(buf))
+
+	// Encode and decode the buffer
+	encoded := bytes.NewBuffer(nil)
+	_, err := buf.WriteTo(encoded)
+	assert.NoError(t, err)
+
+	output := NewBuffer(0)
+	_, err = output.ReadFrom(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.caps, output.caps)
+	assert.Equal(t, buf.buffer, output.buffer)
+}
+
 func TestBufferWriteTo(t *testing.T) {
 	input := NewBuffer(0)
 	input.Column = "test"
@@ -269,7 +317,7 @@ func TestBufferWriteTo(t *testing.T) {
 	n, err := input.WriteTo(buffer)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(buffer.Len()), n)
-	assert.Equal(t, int64(36), n)
+	assert.Equal(t, int64(40), n)
 
 	output := NewBuffer(0)
 	m, err := output.ReadFrom(buffer)
@@ -277,6 +325,47 @@ func TestBufferWriteTo(t *testing.T) {
 	assert.Equal(t, input, output)
 }
 
+func TestBufferReadLegacy(t *testing.T) {
+	for _, column := range []string{"", "test", strings.Repeat("x", 200)} {
+		input := NewBuffer(0)
+		input.Column = column
+		input.PutInt16(Put, 10, 100)
+		input.PutString(Put, 20, "hello")
+
+		// The legacy encoding is the same, without the marker, version and capabilities
+		buffer := bytes.NewBuffer(nil)
+		_, err := input.WriteTo(buffer)
+		assert.NoError(t, err)
+		legacy := buffer.Bytes()[len(marker)+2:]
+
+		output := NewBuffer(0)
+		_, err = output.ReadFrom(bytes.NewReader(legacy))
+		assert.NoError(t, err)
+		assert.Equal(t, input, output)
+
+		output = NewBuffer(0)
+		_, err = output.ReadLegacyFrom(bytes.NewReader(legacy))
+		assert.NoError(t, err)
+		assert.Equal(t, input, output)
+	}
+}
+
+func TestBufferReadUnsupported(t *testing.T) {
+	input := NewBuffer(0)
+	input.Column = "test"
+	input.PutInt16(Put, 10, 100)
+
+	buffer := bytes.NewBuffer(nil)
+	_, err := input.WriteTo(buffer)
+	assert.NoError(t, err)
+
+	// A newer version of the format must be rejected
+	encoded := buffer.Bytes()
+	encoded[len(marker)] = Version + 1
+	_, err = NewBuffer(0).ReadFrom(bytes.NewReader(encoded))
+	assert.Error(t, err)
+}
+
 func TestBufferWriteToFailures(t *testing.T) {
 	buf := NewBuffer(0)
 	buf.Column = "test"
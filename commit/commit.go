@@ -4,6 +4,7 @@
 package commit
 
 import (
+	"fmt"
 	"io"
 	"sync/atomic"
 	"time"
@@ -70,6 +71,59 @@ func min(v1, v2 int32) int32 {
 	return v2 + ((v1 - v2) & ((v1 - v2) >> 31))
 }
 
+// --------------------------- Format ----------------------------
+
+// Version is the version of the binary format used to encode commits. It is written
+// at the beginning of every encoded commit, followed by a set of capability flags.
+//
+// The format follows a set of forward-compatibility rules so that the logs written
+// by one version of the library can be replayed by newer versions:
+//
+//  1. The version is only incremented when the layout of a commit changes in a way
+//     that cannot be expressed by a capability. Readers reject newer versions.
+//  2. Optional encoding features are signalled by capability flags. Flags in the
+//     lower 16 bits are required, a reader rejects a commit which uses a required
+//     capability it does not understand instead of silently misreading it.
+//  3. Flags in the upper 16 bits are advisory and are ignored by readers which do
+//     not understand them.
+const Version = 1
+
+// Capability represents a set of optional encoding features used by an encoded commit.
+type Capability uint32
+
+const (
+	capLongString Capability = 1 << 0     // Variable-size values longer than 64KB, with a varint length
+	capVarint     Capability = 1 << 1     // Fixed-size values encoded as varints
+	capRunLength  Capability = 1 << 2     // Runs of identical operations on consecutive indexes
+	capRequired   Capability = 0x0000ffff // The mask of capabilities a reader must understand
+	capSupported  Capability = capLongString | capVarint | capRunLength
+	capCompact    Capability = capVarint | capRunLength // The capabilities of the compacted commits
+)
+
+// capabilities returns the set of capabilities required to decode the commit
+func (c *Commit) capabilities() (caps Capability) {
+	for _, u := range c.Updates {
+		caps |= u.caps
+	}
+	return
+}
+
+// checkFormat validates the version and capability flags of an encoded commit
+func checkFormat(version uint64, caps Capability) error {
+	if version == 0 || version > Version {
+		return fmt.Errorf("commit: unsupported format version %d", version)
+	}
+	return checkCapabilities(caps)
+}
+
+// checkCapabilities validates that all of the required capabilities are supported
+func checkCapabilities(caps Capability) error {
+	if unknown := caps & capRequired &^ capSupported; unknown != 0 {
+		return fmt.Errorf("commit: unsupported capabilities %#x", uint32(unknown))
+	}
+	return nil
+}
+
 // --------------------------- Commit ----------------------------
 
 // Commit represents an individual transaction commit. If multiple chunks are committed
@@ -80,12 +134,14 @@ type Commit struct {
 	Updates []*Buffer // The update buffers
 }
 
-// Clone clones a commit into a new one
+// Clone clones a commit into a new one. Only the parts of the update buffers which
+// belong to the chunk of the commit are cloned.
 func (c *Commit) Clone() (clone Commit) {
+	clone.ID = c.ID
 	clone.Chunk = c.Chunk
 	for _, u := range c.Updates {
-		if len(u.buffer) > 0 {
-			clone.Updates = append(clone.Updates, u.Clone())
+		if b := u.cloneChunk(c.Chunk); len(b.buffer) > 0 {
+			clone.Updates = append(clone.Updates, b)
 		}
 	}
 	return
@@ -94,7 +150,35 @@ func (c *Commit) Clone() (clone Commit) {
 // WriteTo writes data to w until there's no more data to write or when an error occurs. The return
 // value n is the number of bytes written. Any error encountered during the write is also returned.
 func (c *Commit) WriteTo(dst io.Writer) (int64, error) {
+
+	// Compact the parts of the buffers which belong to the chunk first, since the
+	// capabilities required to decode them need to be written upfront.
+	caps := c.capabilities()
+	reader := NewReader()
+	updates := make([]compacted, 0, len(c.Updates))
+	for _, buffer := range c.Updates {
+		update := compacted{column: buffer.Column}
+		reader.Range(buffer, c.Chunk, func(r *Reader) {
+			var used Capability
+			update.shards = append(update.shards, header{
+				Value: uint32(r.Offset),
+				Start: uint32(len(update.data)),
+			})
+
+			update.data, used = compactChunk(update.data, r.buffer)
+			caps |= used
+		})
+		updates = append(updates, update)
+	}
+
+	// Write the format version and capabilities
 	w := iostream.NewWriter(dst)
+	if err := w.WriteUvarint(Version); err != nil {
+		return w.Offset(), err
+	}
+	if err := w.WriteUvarint(uint64(caps)); err != nil {
+		return w.Offset(), err
+	}
 
 	// Write the chunk ID
 	if err := w.WriteUvarint(uint64(c.Chunk)); err != nil {
@@ -107,42 +191,27 @@ func (c *Commit) WriteTo(dst io.Writer) (int64, error) {
 	}
 
 	// Write all of the columns for the current chunk
-	reader := NewReader()
-	if err := w.WriteRange(len(c.Updates), func(i int, w *iostream.Writer) error {
-		buffer := c.Updates[i]
+	if err := w.WriteRange(len(updates), func(i int, w *iostream.Writer) error {
+		update := updates[i]
 
 		// Write the column name for this buffer
-		if err := w.WriteString(buffer.Column); err != nil {
+		if err := w.WriteString(update.column); err != nil {
 			return err
 		}
 
 		// Write the number of shards in case of interleaved buffer
-		shards := uint64(0)
-		reader.Range(buffer, c.Chunk, func(r *Reader) {
-			shards++
-		})
-		if err := w.WriteUvarint(shards); err != nil {
+		if err := w.WriteUvarint(uint64(len(update.shards))); err != nil {
 			return err
 		}
 
 		// Write chunk information
-		offset := uint32(0)
-		reader.Range(buffer, c.Chunk, func(r *Reader) {
-			_ = w.WriteUint32(uint32(r.Offset)) // Value
-			_ = w.WriteUint32(offset)           // Offset
-			offset += uint32(len(r.buffer))
-		})
-
-		// Write buffer length
-		if err := w.WriteUvarint(uint64(offset)); err != nil {
-			return err
+		for _, shard := range update.shards {
+			_ = w.WriteUint32(shard.Value) // Value
+			_ = w.WriteUint32(shard.Start) // Offset
 		}
 
-		// Write all chunk bytes together
-		reader.Range(buffer, c.Chunk, func(r *Reader) {
-			_, _ = w.Write(r.buffer)
-		})
-		return nil
+		// Write all chunk bytes together, along with their length
+		return w.WriteBytes(update.data)
 	}); err != nil {
 		return w.Offset(), err
 	}
@@ -153,8 +222,34 @@ func (c *Commit) WriteTo(dst io.Writer) (int64, error) {
 // ReadFrom reads data from r until EOF or error. The return value n is the number of
 // bytes read. Any error except EOF encountered during the read is also returned.
 func (c *Commit) ReadFrom(src io.Reader) (int64, error) {
+	return c.readFrom(src, true)
+}
+
+// ReadLegacyFrom reads a commit which was encoded before the format was versioned, and
+// hence does not start with the format version and capability flags.
+func (c *Commit) ReadLegacyFrom(src io.Reader) (int64, error) {
+	return c.readFrom(src, false)
+}
+
+// readFrom reads the commit, optionally preceded by the format version and capabilities
+func (c *Commit) readFrom(src io.Reader, versioned bool) (int64, error) {
 	r := iostream.NewReader(src)
 
+	// Read the format version and capabilities
+	var caps uint64
+	if versioned {
+		version, err := r.ReadUvarint()
+		if err != nil {
+			return r.Offset(), err
+		}
+		if caps, err = r.ReadUvarint(); err != nil {
+			return r.Offset(), err
+		}
+		if err := checkFormat(version, Capability(caps)); err != nil {
+			return r.Offset(), err
+		}
+	}
+
 	// Read chunk ID
 	chunk, err := r.ReadUvarint()
 	c.Chunk = Chunk(chunk)
@@ -173,14 +268,14 @@ func (c *Commit) ReadFrom(src io.Reader) (int64, error) {
 		c.Updates = append(c.Updates, buffer)
 
 		// Read the column name
-		column, err := r.ReadString()
+		column, err := readString(r)
 		if err != nil {
 			return err
 		}
 
 		// Read the chunks array
 		buffer.Reset(column)
-		r.ReadRange(func(i int, r *iostream.Reader) error {
+		if err := r.ReadRange(func(i int, r *iostream.Reader) error {
 			header := header{
 				Chunk: Chunk(chunk),
 			}
@@ -195,11 +290,20 @@ func (c *Commit) ReadFrom(src io.Reader) (int64, error) {
 
 			buffer.chunks = append(buffer.chunks, header)
 			return nil
-		})
+		}); err != nil {
+			return err
+		}
+
+		// Read the combined buffer, the operations in memory are never compacted
+		buffer.caps = Capability(caps) &^ capCompact
+		if buffer.buffer, err = readBytes(r); err != nil {
+			return err
+		}
 
-		// Read the combined buffer
-		buffer.buffer, err = r.ReadBytes()
-		return err
+		if Capability(caps)&capCompact != 0 {
+			return buffer.expand()
+		}
+		return nil
 	}); err != nil {
 		return r.Offset(), err
 	}
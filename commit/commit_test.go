@@ -35,6 +35,7 @@ func BenchmarkColumn(b *testing.B) {
 
 func TestCommitClone(t *testing.T) {
 	commit := Commit{
+		ID: 42,
 		Updates: []*Buffer{{
 			buffer: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f},
 			chunks: []header{{
@@ -47,6 +48,34 @@ func TestCommitClone(t *testing.T) {
 	assert.EqualValues(t, commit, clone)
 }
 
+func TestCommitCloneChunk(t *testing.T) {
+	buffer := NewBuffer(10)
+	buffer.PutInt64(Put, 10, 1)
+	buffer.PutInt64(Put, 20+chunkSize, 2)
+	buffer.PutInt64(Put, 30, 3)
+	assert.True(t, buffer.IsParallel())
+
+	commit := Commit{Chunk: 1, Updates: []*Buffer{buffer, NewBuffer(10)}}
+	clone := commit.Clone()
+	assert.Equal(t, 1, len(clone.Updates))
+
+	// Only the operations of the chunk must be cloned
+	var offsets []uint32
+	reader := NewReader()
+	for _, chunk := range []Chunk{0, 1} {
+		reader.Range(clone.Updates[0], chunk, func(r *Reader) {
+			for r.Next() {
+				offsets = append(offsets, r.Index())
+			}
+		})
+	}
+	assert.Equal(t, []uint32{20 + chunkSize}, offsets)
+
+	// Merges of variable-size values can not be applied in parallel
+	buffer.PutString(Merge, 40, "hello")
+	assert.False(t, buffer.IsParallel())
+}
+
 func TestWriterChannel(t *testing.T) {
 	w := make(Channel, 1)
 	w.Append(Commit{
@@ -151,7 +180,7 @@ func TestCommitCodec(t *testing.T) {
 
 	// Write into the buffer
 	n, err := input.WriteTo(buffer)
-	assert.Equal(t, int64(197), n)
+	assert.Equal(t, int64(115), n)
 	assert.NoError(t, err)
 
 	// Read the commit back
@@ -174,6 +203,39 @@ func TestCommitCodec(t *testing.T) {
 	assert.Equal(t, []int64{20, 1, 21, 2, 40, 4, 41, 5, 60, 7, 61, 8}, updates)
 }
 
+func TestCommitFormat(t *testing.T) {
+	tests := []struct {
+		version uint64
+		caps    Capability
+		ok      bool
+	}{
+		{version: Version, caps: 0, ok: true},
+		{version: Version, caps: 1 << 20, ok: true},
+		{version: Version, caps: capLongString, ok: true},
+		{version: Version, caps: 1 << 15, ok: false},
+		{version: Version + 1, caps: 0, ok: false},
+		{version: 0, caps: 0, ok: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%v,%v", tc.version, tc.caps), func(t *testing.T) {
+			input := Commit{ID: 1, Updates: []*Buffer{newInterleaved("a")}}
+			input.Updates[0].caps = tc.caps
+
+			// Encode the commit with the format of the test case
+			buffer := bytes.NewBuffer(nil)
+			_, err := input.WriteTo(buffer)
+			assert.NoError(t, err)
+			encoded := buffer.Bytes()
+			encoded[0] = byte(tc.version)
+
+			output := Commit{}
+			_, err = output.ReadFrom(bytes.NewReader(encoded))
+			assert.Equal(t, tc.ok, err == nil)
+		})
+	}
+}
+
 // newInterleaved creates a new interleaved buffer
 func newInterleaved(columnName string) *Buffer {
 	buf := NewBuffer(10)
@@ -0,0 +1,275 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package commit
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	isVarint = 1 << 3 // is a fixed-size value encoded as a varint
+	isRun    = 0x0f   // is a run of identical operations on consecutive indexes
+	minRun   = 3      // The minimum number of operations to encode as a run
+)
+
+// compacted represents the compacted part of a buffer which belongs to a commit
+type compacted struct {
+	column string   // The column of the buffer
+	shards []header // The shards of the chunk, with their start offsets in the data
+	data   []byte   // The compacted operations
+}
+
+// --------------------------- Compact ----------------------------
+
+// The buffers in memory always contain fixed-size values so that they can be swapped in
+// place. When a commit is encoded, the operations are compacted to make it smaller:
+//
+//  1. A fixed-size value is encoded as a varint whenever this is shorter, and its header
+//     is marked with the isVarint flag.
+//  2. A run of operations with identical values on consecutive indexes, such as the bulk
+//     updates of a flag, is encoded as an isRun header followed by the number of the
+//     operations in the run and by the first operation of the run.
+
+// compactChunk appends the operations of the source chunk onto the destination, compacting
+// them. It returns the capabilities required to decode the result.
+func compactChunk(dst, src []byte) ([]byte, Capability) {
+	var caps Capability
+	for i := 0; i < len(src); {
+		n := opSize(src[i:])
+		if n == 0 {
+			return append(dst, src[i:]...), caps // Malformed, keep as-is
+		}
+
+		// Find the operations which repeat the same value on the next indexes
+		count, end := findRun(src, i, n)
+		if count >= minRun {
+			caps |= capRunLength
+			dst = append(dst, isRun)
+			dst = binary.AppendUvarint(dst, uint64(count))
+		} else {
+			end = i + n
+		}
+
+		// Write the first operation of the run, or just the operation itself
+		var used Capability
+		dst, used = compactOp(dst, src[i:i+n])
+		caps |= used
+		if count < minRun {
+			i += n
+			continue
+		}
+		i = end
+	}
+	return dst, caps
+}
+
+// findRun finds the number of operations with the same value as the operation at the
+// specified position, on the consecutive indexes, and the position right after them.
+func findRun(src []byte, i, n int) (count, end int) {
+	head := src[i] | isNext
+	v, _ := opLayout(src[i:])
+	value := src[i+1 : i+v]
+
+	count, end = 1, i+n
+	for end+v <= len(src) && count < chunkSize {
+		next := src[end : end+v]
+		if next[0] != head || opSize(src[end:]) != v || string(next[1:]) != string(value) {
+			break
+		}
+
+		count++
+		end += v
+	}
+	return
+}
+
+// compactOp appends an operation onto the destination, re-encoding its fixed-size value
+// as a varint if this is shorter.
+func compactOp(dst, op []byte) ([]byte, Capability) {
+	head := op[0]
+	size := int(1 << (head >> 4 & 0b11) & 0b1110)
+	if head&isString != 0 || size == 0 {
+		return append(dst, op...), 0
+	}
+
+	var value uint64
+	for _, b := range op[1 : 1+size] {
+		value = value<<8 | uint64(b)
+	}
+
+	if varintSize(value) >= size {
+		return append(dst, op...), 0
+	}
+
+	dst = append(dst, head|isVarint)
+	dst = binary.AppendUvarint(dst, value)
+	dst = append(dst, op[1+size:]...) // The offset, if any
+	return dst, capVarint
+}
+
+// expandChunk appends the operations of the source chunk onto the destination, reverting
+// the compaction of the operations.
+func expandChunk(dst, src []byte) (_ []byte, err error) {
+	var n int
+	for i := 0; i < len(src); {
+		if src[i] != isRun {
+			if dst, n, err = expandOp(dst, src[i:]); err != nil {
+				return nil, fmt.Errorf("%w at %d", err, i)
+			}
+			i += n
+			continue
+		}
+
+		// Read the length of the run and the first operation
+		count, size := binary.Uvarint(src[i+1:])
+		if size <= 0 || count < 2 || count > chunkSize || i+1+size >= len(src) {
+			return nil, fmt.Errorf("commit: invalid run at %d", i)
+		}
+
+		first := len(dst)
+		i += 1 + size
+		if dst, n, err = expandOp(dst, src[i:]); err != nil {
+			return nil, fmt.Errorf("%w at %d", err, i)
+		}
+		i += n
+
+		// Repeat the value of the first operation on the next indexes
+		op := dst[first:]
+		v, _ := opLayout(op)
+		value := append([]byte{op[0] | isNext}, op[1:v]...)
+		for j := uint64(1); j < count; j++ {
+			dst = append(dst, value...)
+		}
+	}
+	return dst, nil
+}
+
+// expandOp appends an operation onto the destination, decoding its value if it was encoded
+// as a varint, and returns the number of bytes read.
+func expandOp(dst, src []byte) ([]byte, int, error) {
+	head := src[0]
+	if head&isString != 0 || head&isVarint == 0 {
+		n := opSize(src)
+		if n == 0 {
+			return nil, 0, fmt.Errorf("commit: truncated operation")
+		}
+		return append(dst, src[:n]...), n, nil
+	}
+
+	// Decode the value and make sure it fits into its fixed size
+	size := int(1 << (head >> 4 & 0b11) & 0b1110)
+	value, n := binary.Uvarint(src[1:])
+	if n <= 0 || size == 0 || (size < 8 && value>>(size*8) != 0) {
+		return nil, 0, fmt.Errorf("commit: invalid varint value")
+	}
+
+	dst = append(dst, head&^isVarint)
+	for shift := (size - 1) * 8; shift >= 0; shift -= 8 {
+		dst = append(dst, byte(value>>shift))
+	}
+
+	// Copy the offset, if any
+	i := 1 + n
+	if head&isNext == 0 {
+		offset := offsetSize(src[i:])
+		if offset == 0 {
+			return nil, 0, fmt.Errorf("commit: invalid offset")
+		}
+
+		dst = append(dst, src[i:i+offset]...)
+		i += offset
+	}
+	return dst, i, nil
+}
+
+// expand reverts the compaction of all of the chunks of the buffer, once it was
+// read from an encoded commit.
+func (b *Buffer) expand() (err error) {
+	if len(b.chunks) == 0 && len(b.buffer) > 0 {
+		return fmt.Errorf("commit: buffer contains data without a chunk")
+	}
+
+	src := b.buffer
+	out := make([]byte, 0, 2*len(src))
+	for i := range b.chunks {
+		x0, x1 := b.chunks[i].Start, uint32(len(src))
+		if len(b.chunks) > i+1 {
+			x1 = b.chunks[i+1].Start
+		}
+
+		if x0 > x1 || x1 > uint32(len(src)) {
+			return fmt.Errorf("commit: chunk %d has invalid bounds [%d, %d)", b.chunks[i].Chunk, x0, x1)
+		}
+
+		b.chunks[i].Start = uint32(len(out))
+		if out, err = expandChunk(out, src[x0:x1]); err != nil {
+			return err
+		}
+	}
+
+	b.buffer = out
+	return nil
+}
+
+// opSize returns the size of the encoded operation at the beginning of the buffer, including
+// its value and offset, or zero if the operation is truncated.
+func opSize(buffer []byte) int {
+	_, n := opLayout(buffer)
+	return n
+}
+
+// opLayout returns the position at which the value of the encoded operation at the beginning
+// of the buffer ends, along with the size of the entire operation including its offset. Both
+// are zero if the operation is truncated.
+func opLayout(buffer []byte) (value, size int) {
+	head := buffer[0]
+	i := 1
+	length := int(1 << (head >> 4 & 0b11) & 0b1110)
+	switch {
+	case head&isString != 0 && head&0x30 == size8:
+		v, n := binary.Uvarint(buffer[i:])
+		if n <= 0 || v > uint64(len(buffer)) {
+			return 0, 0
+		}
+		length = int(v)
+		i += n
+	case head&isString != 0:
+		if i+2 > len(buffer) {
+			return 0, 0
+		}
+		length = int(buffer[i+1]) | int(buffer[i])<<8
+		i += 2
+	}
+
+	if i += length; i > len(buffer) {
+		return 0, 0
+	}
+
+	value = i
+	if head&isNext == 0 {
+		n := offsetSize(buffer[i:])
+		if n == 0 {
+			return 0, 0
+		}
+		i += n
+	}
+	return value, i
+}
+
+// offsetSize returns the size of the variable-size offset at the beginning of the buffer,
+// or zero if the offset is invalid.
+func offsetSize(buffer []byte) int {
+	_, n := validateOffset(buffer)
+	return n
+}
+
+// varintSize returns the number of bytes required to encode the value as a varint
+func varintSize(value uint64) int {
+	n := 1
+	for ; value >= 0x80; value >>= 7 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package commit
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kelindar/bitmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompact(t *testing.T) {
+	buffer := NewBuffer(0)
+	buffer.PutInt64(Merge, 1, 1)
+	buffer.PutInt64(Merge, 2, 300)
+	buffer.PutInt64(Put, 10, -1)
+	buffer.PutUint64(Put, 11, math.MaxUint64)
+	buffer.PutInt32(Put, 20, 100)
+	buffer.PutInt16(Put, 30, 5)
+	buffer.PutUint16(Put, 31, math.MaxUint16)
+	buffer.PutFloat64(Put, 40, 1.5)
+	buffer.PutString(Put, 50, "hello")
+	buffer.PutString(Put, 51, strings.Repeat("x", math.MaxUint16+1))
+	buffer.PutBool(60, true)
+	buffer.PutOperation(Delete, 70)
+	buffer.PutInt64(Put, 5, 2)
+
+	compacted, caps := compactChunk(nil, buffer.buffer)
+	assert.Equal(t, capVarint, caps)
+	assert.Less(t, len(compacted), len(buffer.buffer))
+
+	expanded, err := expandChunk(nil, compacted)
+	assert.NoError(t, err)
+	assert.Equal(t, buffer.buffer, expanded)
+}
+
+func TestCompactRun(t *testing.T) {
+	flags := make(bitmap.Bitmap, 16)
+	for i := uint32(0); i < 1000; i++ {
+		flags.Set(i)
+	}
+
+	buffer := NewBuffer(0)
+	buffer.PutBitmap(PutTrue, 0, flags)
+	buffer.PutString(Put, 2000, "a")
+	buffer.PutString(Put, 2001, "a")
+	buffer.PutString(Put, 2002, "b")
+	for i := uint32(3000); i < 3010; i++ {
+		buffer.PutString(Put, i, "hello")
+	}
+	for i := uint32(4000); i < 4010; i++ {
+		buffer.PutFloat64(Put, i, 1.5)
+	}
+	buffer.PutInt64(Merge, 4010, 1)
+
+	compacted, caps := compactChunk(nil, buffer.buffer)
+	assert.Equal(t, capRunLength|capVarint, caps)
+	assert.Less(t, len(compacted), 100)
+
+	expanded, err := expandChunk(nil, compacted)
+	assert.NoError(t, err)
+	assert.Equal(t, buffer.buffer, expanded)
+
+	// Short runs are kept as-is
+	buffer.Reset("")
+	buffer.PutBool(1, true)
+	buffer.PutBool(2, true)
+	compacted, caps = compactChunk(nil, buffer.buffer)
+	assert.Equal(t, Capability(0), caps)
+	assert.Equal(t, buffer.buffer, compacted)
+}
+
+func TestCompactNothing(t *testing.T) {
+	buffer := NewBuffer(0)
+	buffer.PutFloat64(Put, 10, 1.5)
+	buffer.PutString(Put, 20, "hello")
+
+	compacted, caps := compactChunk(nil, buffer.buffer)
+	assert.Equal(t, Capability(0), caps)
+	assert.Equal(t, buffer.buffer, compacted)
+}
+
+func TestExpandMalformed(t *testing.T) {
+	for _, input := range [][]byte{
+		{byte(Put) | size8 | isVarint},
+		{byte(Put) | size8 | isVarint | isNext, 0xff},
+		{byte(Put) | size2 | isVarint | isNext, 0xff, 0xff, 0x7f},
+		{byte(Put) | isVarint | isNext, 0x01},
+		{byte(Put) | size8 | isVarint, 0x01},
+		{byte(Put) | size8 | isVarint, 0x01, 0xff},
+		{byte(Put) | size8, 0x01},
+		{byte(Put) | size2 | isString | isNext, 0x00},
+		{isRun, 0x00, byte(PutTrue) | isNext},
+		{isRun, 0xff, 0xff, 0x7f, byte(PutTrue) | isNext},
+		{isRun, 0x03},
+		{isRun, 0x03, byte(Put) | size8 | isNext, 0x01},
+	} {
+		_, err := expandChunk(nil, input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCommitCompact(t *testing.T) {
+	counter := NewBuffer(0)
+	counter.Reset("counter")
+	for i := uint32(0); i < 1000; i++ {
+		counter.PutInt64(Merge, i, 1)
+	}
+
+	// Identical deltas should be encoded as a single run
+	encoded := bytes.NewBuffer(nil)
+	input := Commit{ID: 1, Updates: []*Buffer{counter}}
+	_, err := input.WriteTo(encoded)
+	assert.NoError(t, err)
+	assert.Less(t, encoded.Len(), 50)
+
+	output := Commit{}
+	_, err = output.ReadFrom(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, counter.buffer, output.Updates[0].buffer)
+	assert.Equal(t, Capability(0), output.Updates[0].caps)
+	assert.NoError(t, Validate(output.Updates[0]))
+}
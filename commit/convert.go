@@ -0,0 +1,26 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build go1.21 && !tinygo && !purego
+
+// The guard is on go1.21 rather than go1.20, since that is the first toolchain that
+// upgrades the language version of a file based on its build constraint, allowing
+// the module itself to keep supporting older releases.
+
+package commit
+
+import (
+	"unsafe"
+)
+
+// ToBytes converts a string to a byte slice without allocating. The returned slice
+// shares memory with the string and must never be modified.
+func ToBytes(v string) []byte {
+	return unsafe.Slice(unsafe.StringData(v), len(v))
+}
+
+// ToString converts a byte slice to a string without allocating. The string shares
+// memory with the slice, so the slice must not be modified while the string is in use.
+func ToString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
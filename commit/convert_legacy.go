@@ -0,0 +1,25 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build !go1.21 && !tinygo && !purego
+
+package commit
+
+import (
+	"unsafe"
+)
+
+// ToBytes converts a string to a byte slice without allocating. The returned slice
+// shares memory with the string and must never be modified.
+func ToBytes(v string) []byte {
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		string
+		int
+	}{v, len(v)}))
+}
+
+// ToString converts a byte slice to a string without allocating. The string shares
+// memory with the slice, so the slice must not be modified while the string is in use.
+func ToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
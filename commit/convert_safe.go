@@ -0,0 +1,18 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build tinygo || purego
+
+package commit
+
+// ToBytes converts a string to a byte slice. This is the portable variant used by
+// WebAssembly/TinyGo builds, hence it copies the data instead of aliasing it.
+func ToBytes(v string) []byte {
+	return []byte(v)
+}
+
+// ToString converts a byte slice to a string. This is the portable variant used by
+// WebAssembly/TinyGo builds, hence it copies the data instead of aliasing it.
+func ToString(b []byte) string {
+	return string(b)
+}
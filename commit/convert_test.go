@@ -0,0 +1,18 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package commit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	for _, v := range []string{"", "a", "hello world"} {
+		b := ToBytes(v)
+		assert.Equal(t, len(v), len(b))
+		assert.Equal(t, v, ToString(b))
+	}
+}
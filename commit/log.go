@@ -4,6 +4,8 @@
 package commit
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"os"
 	"sync"
@@ -34,20 +36,32 @@ func (w Channel) Append(commit Commit) error {
 
 // --------------------------- Log ----------------------------
 
+// logMagic is written at the beginning of a commit log, followed by the format version. Since
+// it starts with a non-minimal varint, it never appears at the beginning of a commit.
+var logMagic = []byte{0x80, 0x00, 'c', 'l', 'o', 'g'}
+
 // Log represents a commit log that can be used to write the changes to the collection
-// during a snapshot. It also supports reading a commit log back.
+// during a snapshot. It also supports reading a commit log back. The logs which were
+// written before the commit format was versioned do not start with a header, and are
+// read as legacy logs.
 type Log struct {
-	lock   sync.Mutex
-	source io.Reader
-	writer *iostream.Writer
-	reader *iostream.Reader
+	lock     sync.Mutex
+	source   io.Reader
+	writer   *iostream.Writer
+	buffer   *bufio.Reader
+	reader   *iostream.Reader
+	legacy   bool // Whether the commits are encoded with the legacy format
+	detected bool // Whether the format of the log was detected
+	started  bool // Whether the header was written
 }
 
 // Open opens a commit log stream for both read and write.
 func Open(source io.Reader) *Log {
+	buffer := bufio.NewReader(s2.NewReader(source))
 	log := &Log{
 		source: source,
-		reader: iostream.NewReader(s2.NewReader(source)),
+		buffer: buffer,
+		reader: iostream.NewReader(buffer),
 	}
 
 	if rw, ok := source.(io.Writer); ok {
@@ -56,6 +70,17 @@ func Open(source io.Reader) *Log {
 	return log
 }
 
+// OpenLegacy opens a commit log stream which was written before the commit format was
+// versioned, for reading only. Since Open() detects the legacy logs, this is only required
+// to read a legacy log which was concatenated after a versioned one.
+func OpenLegacy(source io.Reader) *Log {
+	log := Open(source)
+	log.legacy = true
+	log.detected = true
+	log.writer = nil
+	return log
+}
+
 // OpenFile opens a specified commit log file in a read/write mode. If
 // the file does not exist, it will create it.
 func OpenFile(filename string) (*Log, error) {
@@ -81,6 +106,14 @@ func (l *Log) Append(commit Commit) (err error) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
+	// Write the header once, at the beginning of the stream
+	if !l.started {
+		if err = l.writeHeader(); err != nil {
+			return
+		}
+		l.started = true
+	}
+
 	// Write the commit into the stream
 	if _, err = commit.WriteTo(l.writer); err == nil {
 		err = l.writer.Flush()
@@ -96,8 +129,17 @@ func (l *Log) Range(fn func(Commit) error) error {
 	defer l.lock.Unlock()
 
 	for {
+		if err := l.readHeader(); err != nil {
+			return err
+		}
+
 		var commit Commit
-		_, err := commit.ReadFrom(l.reader)
+		read := commit.ReadFrom
+		if l.legacy {
+			read = commit.ReadLegacyFrom
+		}
+
+		_, err := read(l.reader)
 		switch {
 		case err == io.EOF:
 			return nil
@@ -112,6 +154,40 @@ func (l *Log) Range(fn func(Commit) error) error {
 	}
 }
 
+// writeHeader writes the magic bytes and the format version of the log
+func (l *Log) writeHeader() error {
+	if _, err := l.writer.Write(logMagic); err != nil {
+		return err
+	}
+	return l.writer.WriteUvarint(Version)
+}
+
+// readHeader reads the header of the log, if present. Since the logs may be concatenated, the
+// header can also be found in between the commits. A log which does not start with a header
+// was written before the commit format was versioned.
+func (l *Log) readHeader() error {
+	prefix, _ := l.buffer.Peek(len(logMagic))
+	if !bytes.Equal(prefix, logMagic) {
+		if !l.detected {
+			l.legacy, l.detected = true, true
+		}
+		return nil
+	}
+
+	// Skip the magic bytes and validate the version
+	_, _ = l.buffer.Discard(len(logMagic))
+	version, err := l.reader.ReadUvarint()
+	switch {
+	case err == io.EOF:
+		return io.ErrUnexpectedEOF
+	case err != nil:
+		return err
+	}
+
+	l.legacy, l.detected = false, true
+	return checkFormat(version, 0)
+}
+
 // Name calls the corresponding Name() method on the underlying source
 func (l *Log) Name() (name string) {
 	if file, ok := l.source.(interface {
@@ -10,6 +10,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/kelindar/iostream"
+	"github.com/klauspost/compress/s2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -81,6 +83,72 @@ func TestLogAppendRange(t *testing.T) {
 	assert.Equal(t, []uint64{1, 2}, arr)
 }
 
+func TestLogLegacy(t *testing.T) {
+	commits := []Commit{newCommit(1), newCommit(2)}
+
+	// Write the commits with the legacy format, which is not versioned
+	buffer := bytes.NewBuffer(nil)
+	writer := s2.NewWriter(buffer)
+	for _, commit := range commits {
+		assert.NoError(t, writeLegacy(writer, commit))
+	}
+	assert.NoError(t, writer.Close())
+
+	var arr []Commit
+	assert.NoError(t, Open(buffer).Range(func(commit Commit) error {
+		arr = append(arr, commit)
+		return nil
+	}))
+
+	assert.Len(t, arr, 2)
+	for i, commit := range arr {
+		assert.Equal(t, commits[i].ID, commit.ID)
+		assert.Equal(t, updatesAt(commits[i].Updates[0], 0), updatesAt(commit.Updates[0], 0))
+	}
+}
+
+func TestLogConcatenated(t *testing.T) {
+	first, second := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	assert.NoError(t, Open(first).Append(newCommit(1)))
+	assert.NoError(t, Open(second).Append(newCommit(2)))
+
+	var arr []uint64
+	assert.NoError(t, Open(io.MultiReader(first, second)).Range(func(commit Commit) error {
+		arr = append(arr, commit.ID)
+		return nil
+	}))
+	assert.Equal(t, []uint64{1, 2}, arr)
+}
+
+func TestLogUnsupported(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	writer := iostream.NewWriter(s2.NewWriter(buffer))
+	_, _ = writer.Write(logMagic)
+	_ = writer.WriteUvarint(Version + 1)
+	assert.NoError(t, writer.Close())
+
+	assert.Error(t, Open(buffer).Range(func(commit Commit) error {
+		return nil
+	}))
+}
+
+// writeLegacy writes a commit using the legacy format, which is not versioned
+func writeLegacy(dst io.Writer, commit Commit) error {
+	w := iostream.NewWriter(dst)
+	_ = w.WriteUvarint(uint64(commit.Chunk))
+	_ = w.WriteUvarint(commit.ID)
+	return w.WriteRange(len(commit.Updates), func(i int, w *iostream.Writer) error {
+		update := commit.Updates[i].cloneChunk(commit.Chunk)
+		_ = w.WriteString(update.Column)
+		_ = w.WriteUvarint(uint64(len(update.chunks)))
+		for _, shard := range update.chunks {
+			_ = w.WriteUint32(shard.Value)
+			_ = w.WriteUint32(shard.Start)
+		}
+		return w.WriteBytes(update.buffer)
+	})
+}
+
 func TestLogRangeFailures(t *testing.T) {
 	buffer := bytes.NewBuffer(nil)
 	logger := Open(buffer)
@@ -6,20 +6,24 @@ package commit
 import (
 	"encoding/binary"
 	"math"
-	"unsafe"
 )
 
-// Reader represnts a commit log reader (iterator).
+// Reader represnts a commit log reader (iterator). It can be used outside of this package
+// in order to decode a Buffer, for example one which was read from a commit log with
+// ReadFrom(), without re-implementing the underlying wire format.
 type Reader struct {
-	Type       OpType  // The current operation type
-	i0, i1     int     // The value start and end
-	buffer     []byte  // The log slice
-	Offset     int32   // The current offset
-	last       int     // The read position
-	start      int32   // The start offset
-	x0, x1     uint32  // The lower and upper bounds of the underlying buffer
-	headString int     // The starting position of a string value
-	parent     *Buffer // The parent buffer
+	Type       OpType   // The current operation type
+	variable   bool     // Whether the current value is variable-size
+	Offset     int32    // The current offset
+	i0, i1     int      // The value start and end
+	buffer     []byte   // The log slice
+	last       int      // The read position
+	start      int32    // The start offset
+	x0, x1     uint32   // The lower and upper bounds of the underlying buffer
+	seq        uint32   // The last sequence number used for coalescing
+	headString int      // The starting position of a string value
+	parent     *Buffer  // The parent buffer
+	seqs       []uint32 // The scratch space used for coalescing
 }
 
 // NewReader creates a new reader for a commit log.
@@ -46,6 +50,7 @@ func (r *Reader) use(buffer []byte) {
 	r.last = 0
 	r.i0 = 0
 	r.i1 = 0
+	r.variable = false
 	r.Offset = 0
 	r.Type = Put
 }
@@ -102,6 +107,34 @@ func (r *Reader) Bytes() []byte {
 	return r.buffer[r.i0:r.i1]
 }
 
+// --------------------------- Value Metadata ----------------------------
+
+// Column returns the name of the column of the buffer being read.
+func (r *Reader) Column() (column string) {
+	if r.parent != nil {
+		column = r.parent.Column
+	}
+	return
+}
+
+// Size returns the size of the current value in bytes. Fixed-size values are either
+// 0, 2, 4 or 8 bytes long, while variable-size values return their actual length.
+func (r *Reader) Size() int {
+	return r.i1 - r.i0
+}
+
+// IsVariable returns whether the current value is a variable-size value, such as a
+// string or a binary value. Otherwise the value is a fixed-size number.
+func (r *Reader) IsVariable() bool {
+	return r.variable
+}
+
+// IsSkip returns whether the current operation should be skipped. This happens when
+// a merge operation was resolved and its result was appended elsewhere in the buffer.
+func (r *Reader) IsSkip() bool {
+	return r.Type == Skip
+}
+
 // --------------------------- Reader Interface ----------------------------
 
 // Index returns the current index of the reader.
@@ -147,8 +180,7 @@ func (r *Reader) Float() float64 {
 
 // String reads a string value.
 func (r *Reader) String() string {
-	b := r.buffer[r.i0:r.i1]
-	return *(*string)(unsafe.Pointer(&b))
+	return ToString(r.buffer[r.i0:r.i1])
 }
 
 // Bool reads a boolean value.
@@ -250,7 +282,7 @@ func (r *Reader) SwapBool(b bool) bool {
 
 // SwapString swaps a string value with a new one.
 func (r *Reader) SwapString(v string) string {
-	r.SwapBytes(toBytes(v))
+	r.SwapBytes(ToBytes(v))
 	return v
 }
 
@@ -304,6 +336,58 @@ func (r *Reader) Range(buf *Buffer, chunk Chunk, fn func(*Reader)) {
 	}
 }
 
+// --------------------------- Coalesce ----------------------------
+
+// Coalesce marks all of the operations for a specified chunk as skipped, except for the
+// last operation on each offset. This should only be called once merge operations were
+// resolved into put operations (i.e. after they were applied on the column), at which
+// point only the last operation for each offset determines the final value.
+func (r *Reader) Coalesce(buf *Buffer, chunk Chunk) {
+	if r.seqs == nil || r.seq > math.MaxUint32-uint32(len(buf.buffer)) {
+		r.seqs = make([]uint32, chunkSize)
+		r.seq = 0
+	}
+
+	// Find the sequence number of the last operation for each offset, while also
+	// checking whether there are any duplicates at all.
+	first, dupes := r.seq, false
+	r.Range(buf, chunk, func(r *Reader) {
+		for r.Next() {
+			offset := r.IndexAtChunk()
+			dupes = dupes || r.seqs[offset] > first
+			r.seq++
+			r.seqs[offset] = r.seq
+		}
+	})
+
+	// If each offset was only written once, there is nothing to coalesce
+	if !dupes {
+		return
+	}
+
+	// Skip all of the operations which are followed by another one
+	seq := first
+	r.Range(buf, chunk, func(r *Reader) {
+		for r.Next() {
+			if seq++; r.seqs[r.IndexAtChunk()] != seq {
+				r.skip()
+			}
+		}
+	})
+}
+
+// skip marks the current operation as skipped
+func (r *Reader) skip() {
+	head := r.i0 - 1
+	if r.variable {
+		head = r.headString
+	}
+
+	r.buffer[head] &= 0xf0
+	r.buffer[head] |= byte(Skip)
+	r.Type = Skip
+}
+
 // --------------------------- Next Iterator ----------------------------
 
 // Next reads the current operation and returns false if there is no more
@@ -400,15 +484,26 @@ func (r *Reader) readFixed(v byte) {
 	r.i0 = r.last
 	r.last += size
 	r.i1 = r.last
+	r.variable = false
 	r.Type = OpType(v & 0x0f)
 }
 
-// readString reads the operation type and the value at the current position.
+// readString reads the operation type and the value at the current position. Long values
+// are prefixed with a variable-size length instead of the 2-byte one.
 func (r *Reader) readString(v byte) {
-	size := int(r.buffer[r.last+2]) | int(r.buffer[r.last+1])<<8
-	r.last += 3
+	var size int
+	if v&0x30 == size8 {
+		length, n := binary.Uvarint(r.buffer[r.last+1:])
+		size = int(length)
+		r.last += 1 + n
+	} else {
+		size = int(r.buffer[r.last+2]) | int(r.buffer[r.last+1])<<8
+		r.last += 3
+	}
+
 	r.i0 = r.last
 	r.last += size
 	r.i1 = r.last
+	r.variable = true
 	r.Type = OpType(v & 0x0f)
 }
@@ -4,6 +4,7 @@
 package commit
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -340,3 +341,80 @@ func TestReaderIsUpsert(t *testing.T) {
 	assert.True(t, r.Next())
 	assert.True(t, r.IsDelete())
 }
+
+func TestReadMetadata(t *testing.T) {
+	buf := NewBuffer(0)
+	buf.Reset("test")
+	buf.PutInt16(Put, 1, 10)
+	buf.PutFloat64(Merge, 2, 1.5)
+	buf.PutString(Put, 3, "hello")
+	buf.PutOperation(Delete, 4)
+
+	// Encode and decode the buffer, as an external consumer would do
+	var encoded bytes.Buffer
+	_, err := buf.WriteTo(&encoded)
+	assert.NoError(t, err)
+
+	decoded := NewBuffer(0)
+	_, err = decoded.ReadFrom(&encoded)
+	assert.NoError(t, err)
+
+	r := NewReader()
+	r.Seek(decoded)
+	assert.Equal(t, "test", r.Column())
+
+	assert.True(t, r.Next())
+	assert.Equal(t, uint32(1), r.Index())
+	assert.Equal(t, 2, r.Size())
+	assert.False(t, r.IsVariable())
+	assert.Equal(t, int16(10), r.Int16())
+
+	assert.True(t, r.Next())
+	assert.Equal(t, Merge, r.Type)
+	assert.Equal(t, 8, r.Size())
+	assert.Equal(t, 1.5, r.Float64())
+
+	assert.True(t, r.Next())
+	assert.Equal(t, 5, r.Size())
+	assert.True(t, r.IsVariable())
+	assert.Equal(t, "hello", r.String())
+
+	assert.True(t, r.Next())
+	assert.True(t, r.IsDelete())
+	assert.False(t, r.IsSkip())
+	assert.Equal(t, 0, r.Size())
+	assert.False(t, r.Next())
+}
+
+func TestCoalesce(t *testing.T) {
+	buf := NewBuffer(0)
+	buf.PutInt64(Put, 1, 10)
+	buf.PutInt64(Put, 2, 20)
+	buf.PutInt64(Put, 1, 11)
+	buf.PutString(Put, 3, "a")
+	buf.PutString(Put, 3, "b")
+	buf.PutOperation(Delete, 2)
+	buf.PutInt64(Put, 1, 12)
+
+	r := NewReader()
+	r.Coalesce(buf, 0)
+
+	var ops []string
+	r.Range(buf, 0, func(r *Reader) {
+		for r.Next() {
+			if !r.IsSkip() {
+				ops = append(ops, fmt.Sprintf("%v:%d", r.Type, r.Offset))
+			}
+		}
+	})
+	assert.Equal(t, []string{"put:3", "delete:2", "put:1"}, ops)
+
+	// Coalescing again should be a no-op
+	r.Coalesce(buf, 0)
+	r.Seek(buf)
+	for r.Next() {
+		if r.Offset == 1 && !r.IsSkip() {
+			assert.Equal(t, int64(12), r.Int64())
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package commit
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Validate checks whether the buffer is well-formed and can be safely read. This walks
+// through all of the operations in the buffer without applying them and verifies that the
+// chunk headers, operation types, value lengths and offsets are consistent. It should be
+// used to validate the buffers received from untrusted sources, for example by replication
+// consumers before calling Replay(), since a malformed buffer may panic when applied.
+func Validate(buffer *Buffer) error {
+	if buffer == nil {
+		return fmt.Errorf("commit: buffer is nil")
+	}
+
+	if err := checkCapabilities(buffer.caps); err != nil {
+		return err
+	}
+
+	// Data which does not belong to any chunk would never be read
+	if len(buffer.chunks) == 0 {
+		if len(buffer.buffer) > 0 {
+			return fmt.Errorf("commit: buffer contains data without a chunk")
+		}
+		return nil
+	}
+
+	if buffer.chunks[0].Start != 0 {
+		return fmt.Errorf("commit: first chunk starts at %d instead of 0", buffer.chunks[0].Start)
+	}
+
+	// Validate every chunk independently, as they are read independently
+	for i, c := range buffer.chunks {
+		x1 := uint32(len(buffer.buffer))
+		if len(buffer.chunks) > i+1 {
+			x1 = buffer.chunks[i+1].Start
+		}
+
+		if c.Start > x1 || x1 > uint32(len(buffer.buffer)) {
+			return fmt.Errorf("commit: chunk %d has invalid bounds [%d, %d)", c.Chunk, c.Start, x1)
+		}
+
+		if err := validateChunk(buffer.buffer[c.Start:x1], c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateChunk validates the operations of a single chunk
+func validateChunk(buffer []byte, c header) error {
+	offset := int32(c.Value)
+	for i := 0; i < len(buffer); {
+		head := buffer[i]
+		if op := OpType(head & 0x0f); op > Skip {
+			return fmt.Errorf("commit: invalid operation %d at %d", op, i)
+		}
+
+		// Read the size of the value
+		i++
+		size := int(1 << (head >> 4 & 0b11) & 0b1110)
+		switch {
+		case head&isString != 0 && head&0x30 == size8:
+			length, n := binary.Uvarint(buffer[i:])
+			if n <= 0 || length > uint64(len(buffer)) {
+				return fmt.Errorf("commit: invalid value length at %d", i)
+			}
+			size = int(length)
+			i += n
+		case head&isString != 0:
+			if i+2 > len(buffer) {
+				return fmt.Errorf("commit: truncated value length at %d", i)
+			}
+			size = int(buffer[i+1]) | int(buffer[i])<<8
+			i += 2
+		}
+
+		if i+size > len(buffer) {
+			return fmt.Errorf("commit: truncated value at %d", i)
+		}
+		i += size
+
+		// Read the offset, which is implied for the immediate neighbours
+		if head&isNext != 0 {
+			offset++
+		} else {
+			delta, n := validateOffset(buffer[i:])
+			if n == 0 {
+				return fmt.Errorf("commit: invalid offset at %d", i)
+			}
+			offset += delta
+			i += n
+		}
+
+		// Every operation must target the chunk it belongs to
+		if ChunkAt(uint32(offset)) != c.Chunk {
+			return fmt.Errorf("commit: offset %d is outside of chunk %d", uint32(offset), c.Chunk)
+		}
+	}
+	return nil
+}
+
+// validateOffset decodes the variable-size offset the same way as the reader does, and
+// returns the number of bytes read or zero if the offset is invalid.
+func validateOffset(buffer []byte) (int32, int) {
+	var x uint32
+	for i := 0; i < 5 && i < len(buffer); i++ {
+		b := uint32(buffer[i])
+		if b < 0x80 {
+			return int32(x | b<<(7*i)), i + 1
+		}
+		x |= (b & 0x7f) << (7 * i)
+	}
+	return 0, 0
+}
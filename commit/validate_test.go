@@ -0,0 +1,104 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package commit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	buffer := NewBuffer(0)
+	buffer.PutInt64(Put, 10, 1)
+	buffer.PutInt64(Put, 11, 2)
+	buffer.PutString(Merge, 5, "hello")
+	buffer.PutString(Put, 6, "world")
+	buffer.PutOperation(Delete, 20+chunkSize)
+	buffer.PutFloat32(Put, 3*chunkSize, 1)
+	buffer.PutBool(30, true)
+	buffer.PutUint16(Put, 1, 7)
+
+	assert.NoError(t, Validate(buffer))
+	assert.NoError(t, Validate(NewBuffer(0)))
+}
+
+func TestValidateMalformed(t *testing.T) {
+	valid := func() *Buffer {
+		buffer := NewBuffer(0)
+		buffer.PutInt32(Put, 10, 1)
+		buffer.PutString(Put, 20, "hello")
+		return buffer
+	}
+
+	for name, corrupt := range map[string]func(b *Buffer){
+		"no chunks":      func(b *Buffer) { b.chunks = nil },
+		"first chunk":    func(b *Buffer) { b.chunks[0].Start = 1 },
+		"chunk bounds":   func(b *Buffer) { b.chunks = append(b.chunks, header{Start: 100}) },
+		"chunk order":    func(b *Buffer) { b.chunks = append(b.chunks, header{Start: 2}, header{Start: 1}) },
+		"operation":      func(b *Buffer) { b.buffer[0] = 0x0f },
+		"fixed value":    func(b *Buffer) { b.buffer = b.buffer[:3] },
+		"string length":  func(b *Buffer) { b.buffer = b.buffer[:7] },
+		"string value":   func(b *Buffer) { b.buffer = b.buffer[:12] },
+		"offset":         func(b *Buffer) { b.buffer = append(b.buffer[:5], 0xff, 0xff, 0xff, 0xff, 0xff) },
+		"offset range":   func(b *Buffer) { b.chunks[0].Value = chunkSize },
+		"capabilities":   func(b *Buffer) { b.caps = 0x1 << 15 },
+		"missing offset": func(b *Buffer) { b.buffer = b.buffer[:5] },
+	} {
+		buffer := valid()
+		assert.NoError(t, Validate(buffer), name)
+		corrupt(buffer)
+		assert.Error(t, Validate(buffer), name)
+	}
+
+	assert.Error(t, Validate(nil))
+}
+
+func FuzzValidate(f *testing.F) {
+	buffer := NewBuffer(0)
+	buffer.Column = "test"
+	buffer.PutInt64(Put, 10, 1)
+	buffer.PutString(Merge, 5, "hello")
+	buffer.PutOperation(Delete, 20+chunkSize)
+	buffer.PutBool(30, true)
+
+	// Seed the corpus with valid commits for each chunk, along with their truncations
+	for _, chunk := range []Chunk{0, 1} {
+		var encoded bytes.Buffer
+		commit := Commit{ID: 1, Chunk: chunk, Updates: []*Buffer{buffer}}
+		_, err := commit.WriteTo(&encoded)
+		assert.NoError(f, err)
+
+		f.Add(encoded.Bytes())
+		f.Add(encoded.Bytes()[:encoded.Len()/2])
+	}
+
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 0, 0, 1, 1, 'x', 1, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0xff, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{1, 0, 0, 0, 1, 1, 'x', 0, 0xff, 0xff, 0xff, 0xff, 0x0f})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var commit Commit
+		if _, err := commit.ReadFrom(bytes.NewReader(data)); err != nil {
+			return // Errors are fine, as long as there is no panic
+		}
+
+		for _, u := range commit.Updates {
+			err := Validate(u)
+			assert.Equal(t, err, Validate(u))
+			if err != nil {
+				continue
+			}
+
+			// A valid buffer must be fully readable
+			reader := NewReader()
+			reader.Range(u, commit.Chunk, func(r *Reader) {
+				for r.Next() {
+					assert.Equal(t, commit.Chunk, ChunkAt(r.Index()))
+					assert.Equal(t, r.Size(), len(r.Bytes()))
+				}
+			})
+		}
+	})
+}
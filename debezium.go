@@ -0,0 +1,213 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// Various operations of the change events, as defined by Debezium
+const (
+	DebeziumCreate = "c"
+	DebeziumUpdate = "u"
+	DebeziumDelete = "d"
+)
+
+// DebeziumEvent represents a change event of a single row, with the images of the row before
+// and after the change, in the format of the Debezium change data capture connectors.
+type DebeziumEvent struct {
+	Before map[string]any `json:"before"` // The values of the row before the change, if any
+	After  map[string]any `json:"after"`  // The values of the row after the change, if any
+	Source DebeziumSource `json:"source"` // The metadata about the source of the change
+	Op     string         `json:"op"`     // The operation, either "c", "u" or "d"
+	TsMs   int64          `json:"ts_ms"`  // The time of the conversion, in milliseconds
+}
+
+// DebeziumSource represents the metadata about the source of a change event
+type DebeziumSource struct {
+	Connector string `json:"connector"` // The name of the connector, always "column"
+	Name      string `json:"name"`      // The logical name of the collection
+	TsMs      int64  `json:"ts_ms"`     // The time of the change, in milliseconds
+	Commit    uint64 `json:"commit"`    // The ID of the commit
+	Chunk     uint32 `json:"chunk"`     // The chunk of the commit
+	Row       uint32 `json:"row"`       // The index of the row
+}
+
+// DebeziumEncoder converts the commits of a collection into Debezium change events, so that
+// the consumers built for the standard change data capture pipelines can ingest the changes of
+// the collection. Since the commits only carry the new values, the encoder replays them on its
+// own copy of the collection in order to produce the images of the rows before each change,
+// and must therefore receive all of the commits, starting with an empty collection. The values
+// of the masked columns of the copy are masked in the images.
+type DebeziumEncoder struct {
+	lock   sync.Mutex
+	name   string         // The logical name of the collection
+	mirror *Collection    // The copy of the collection used for the row images
+	reader *commit.Reader // The reader for the update buffers
+	output io.Writer      // The optional destination of the JSON events
+	now    func() time.Time
+}
+
+// NewDebeziumEncoder creates a new encoder for the change events of a collection. Since the
+// columns are not part of the commits, the schema function must create them on the copy of
+// the collection. If an output is specified, the encoder can be used as the commit logger of
+// the collection and writes each event as a line of JSON into the output.
+func NewDebeziumEncoder(name string, schema func(*Collection) error, output io.Writer) (*DebeziumEncoder, error) {
+	mirror := NewCollection(Options{Vacuum: -1})
+	if schema != nil {
+		if err := schema(mirror); err != nil {
+			mirror.Close()
+			return nil, err
+		}
+	}
+
+	return &DebeziumEncoder{
+		name:   name,
+		mirror: mirror,
+		reader: commit.NewReader(),
+		output: output,
+		now:    time.Now,
+	}, nil
+}
+
+// Append converts the commit into change events and writes them into the output, one line of
+// JSON per event, implementing commit.Logger.
+func (e *DebeziumEncoder) Append(change commit.Commit) error {
+	events, err := e.Encode(change)
+	if err != nil || e.output == nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(e.output)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode converts the commit into a change event for each row it modified, in the order of
+// their indexes. The rows which were inserted and deleted within the same commit are omitted.
+func (e *DebeziumEncoder) Encode(change commit.Commit) ([]DebeziumEvent, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	changes, err := replayChange(e.mirror, e.reader, change)
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.now().UnixMilli()
+	events := make([]DebeziumEvent, 0, len(changes))
+	for _, row := range changes {
+		event := DebeziumEvent{
+			Before: row.before,
+			After:  row.after,
+			Source: DebeziumSource{
+				Connector: "column",
+				Name:      e.name,
+				TsMs:      now,
+				Commit:    change.ID,
+				Chunk:     uint32(change.Chunk),
+				Row:       row.idx,
+			},
+			TsMs: now,
+		}
+
+		switch {
+		case event.Before == nil:
+			event.Op = DebeziumCreate
+		case event.After == nil:
+			event.Op = DebeziumDelete
+		default:
+			event.Op = DebeziumUpdate
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Close closes the encoder and releases its copy of the collection
+func (e *DebeziumEncoder) Close() error {
+	return e.mirror.Close()
+}
+
+// --------------------------- Row Images ----------------------------
+
+// rowChange represents the images of a row before and after a commit
+type rowChange struct {
+	idx    uint32         // The index of the row
+	before map[string]any // The values of the row before the commit, if any
+	after  map[string]any // The values of the row after the commit, if any
+}
+
+// replayChange replays a commit on a copy of a collection and returns the images of the rows
+// it modified, in the order of their indexes. The rows which were inserted and deleted within
+// the same commit are omitted.
+func replayChange(mirror *Collection, reader *commit.Reader, change commit.Commit) ([]rowChange, error) {
+	var rows bitmap.Bitmap
+	for _, u := range change.Updates {
+		if u.IsEmpty() || u.Column == outboxColumn {
+			continue
+		}
+
+		reader.Seek(u)
+		for reader.Next() {
+			rows.Set(reader.Index())
+		}
+	}
+
+	changes := make([]rowChange, 0, rows.Count())
+	rows.Range(func(idx uint32) {
+		changes = append(changes, rowChange{idx: idx, before: mirror.imageOf(idx)})
+	})
+
+	if err := mirror.Replay(change); err != nil {
+		return nil, err
+	}
+
+	// Complete the images once the commit is applied
+	out := changes[:0]
+	for _, row := range changes {
+		if row.after = mirror.imageOf(row.idx); row.before != nil || row.after != nil {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// imageOf returns the values of a row, or nil if the row does not exist. The values of the
+// masked columns are masked.
+func (c *Collection) imageOf(idx uint32) map[string]any {
+	c.lock.RLock()
+	exists := c.fill.Contains(idx)
+	c.lock.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	image := make(map[string]any)
+	c.cols.Range(func(column *column) {
+		if column.IsIndex() {
+			return
+		}
+
+		v, ok := column.Value(idx)
+		switch mask := column.valueMask(); {
+		case !ok:
+		case mask != nil:
+			image[column.name] = mask(v)
+		default:
+			image[column.name] = v
+		}
+	})
+	return image
+}
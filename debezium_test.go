@@ -0,0 +1,76 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebeziumEncoder(t *testing.T) {
+	schema := func(c *Collection) error {
+		c.CreateColumn("name", ForString())
+		c.CreateColumn("age", ForInt())
+		return c.CreateIndex("old", "age", func(r Reader) bool {
+			return r.Int() >= 30
+		})
+	}
+
+	output := bytes.NewBuffer(nil)
+	encoder, err := NewDebeziumEncoder("players", schema, output)
+	assert.NoError(t, err)
+	defer encoder.Close()
+
+	players := NewCollection(Options{Writer: encoder})
+	assert.NoError(t, schema(players))
+
+	// Insert, update and delete a row
+	idx, err := players.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		r.SetInt("age", 25)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, players.QueryAt(idx, func(r Row) error {
+		r.MergeInt("age", 10)
+		return nil
+	}))
+	assert.True(t, players.DeleteAt(idx))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 3)
+
+	events := make([]DebeziumEvent, len(lines))
+	for i, line := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(line), &events[i]))
+		assert.Equal(t, "players", events[i].Source.Name)
+		assert.Equal(t, idx, events[i].Source.Row)
+		assert.NotZero(t, events[i].Source.Commit)
+	}
+
+	assert.Equal(t, DebeziumCreate, events[0].Op)
+	assert.Nil(t, events[0].Before)
+	assert.Equal(t, map[string]any{"name": "Roman", "age": 25.0}, events[0].After)
+
+	assert.Equal(t, DebeziumUpdate, events[1].Op)
+	assert.Equal(t, 25.0, events[1].Before["age"])
+	assert.Equal(t, 35.0, events[1].After["age"])
+
+	assert.Equal(t, DebeziumDelete, events[2].Op)
+	assert.Equal(t, 35.0, events[2].Before["age"])
+	assert.Nil(t, events[2].After)
+	assert.Contains(t, lines[2], `"after":null`)
+}
+
+func TestDebeziumEncoderSchemaError(t *testing.T) {
+	_, err := NewDebeziumEncoder("players", func(c *Collection) error {
+		return fmt.Errorf("schema error")
+	}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,301 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// DiffReport represents the differences between two collections, for example a replica and
+// its primary. The rows are matched by their primary key if both collections have the same
+// one, or by their index otherwise.
+type DiffReport struct {
+	AddedColumns   []string  // The columns which only exist in the second collection
+	RemovedColumns []string  // The columns which only exist in the first collection
+	ChangedColumns []string  // The columns whose type differs, which are not compared
+	Inserted       []RowDiff // The rows which only exist in the second collection
+	Deleted        []RowDiff // The rows which only exist in the first collection
+	Updated        []RowDiff // The rows whose values differ
+}
+
+// RowDiff represents the differences of a single row
+type RowDiff struct {
+	Index  uint32      // The index of the row, in the second collection if it was inserted
+	Key    string      // The primary key of the row, if the rows are matched by key
+	Values []ValueDiff // The values which differ, in the order of the column names
+}
+
+// ValueDiff represents the difference of a single value. The values of the masked columns are
+// masked, while the differences are found on the actual values.
+type ValueDiff struct {
+	Column string // The name of the column
+	Before any    // The value in the first collection, or nil if not present
+	After  any    // The value in the second collection, or nil if not present
+	actual any    // The actual value in the second collection, if masked
+}
+
+// diffOf returns the difference of a value, masking the values if the columns are masked
+func diffOf(x, y *column, before, after any) ValueDiff {
+	diff := ValueDiff{Column: y.name, Before: maskValue(x, before), After: maskValue(y, after)}
+	if y.valueMask() != nil {
+		diff.actual = after
+	}
+	return diff
+}
+
+// value returns the actual value in the second collection, used to patch a collection
+func (v *ValueDiff) value() any {
+	if v.actual != nil {
+		return v.actual
+	}
+	return v.After
+}
+
+// Diff compares two collections and returns a report of the columns and the rows which differ.
+// Only the values of the columns which exist in both collections with the same type are
+// compared, while the indexes are only compared by name. Each collection is read within a
+// consistent snapshot, so the collections may be used concurrently.
+func Diff(a, b *Collection) (*DiffReport, error) {
+	report := new(DiffReport)
+	columns := report.schema(a, b)
+	byKey := a.pk != nil && b.pk != nil && a.pk.name == b.pk.name
+
+	err := a.QueryWith(ReadSnapshot, func(*Txn) error {
+		return b.QueryWith(ReadSnapshot, func(*Txn) error {
+			a.lock.RLock()
+			fillA := a.fill.Clone(nil)
+			a.lock.RUnlock()
+
+			b.lock.RLock()
+			fillB := b.fill.Clone(nil)
+			b.lock.RUnlock()
+
+			if byKey {
+				report.rowsByKey(a, b, fillA, fillB, columns)
+			} else {
+				report.rowsByIndex(a, b, fillA, fillB, columns)
+			}
+			return nil
+		})
+	})
+	return report, err
+}
+
+// IsEmpty returns whether the collections are identical
+func (d *DiffReport) IsEmpty() bool {
+	return len(d.AddedColumns) == 0 && len(d.RemovedColumns) == 0 && len(d.ChangedColumns) == 0 &&
+		len(d.Inserted) == 0 && len(d.Deleted) == 0 && len(d.Updated) == 0
+}
+
+// String returns a human-readable description of the differences, with one line per column
+// and per row, which is useful for the test assertions.
+func (d *DiffReport) String() string {
+	var out strings.Builder
+	for _, name := range d.AddedColumns {
+		fmt.Fprintf(&out, "+column %s\n", name)
+	}
+	for _, name := range d.RemovedColumns {
+		fmt.Fprintf(&out, "-column %s\n", name)
+	}
+	for _, name := range d.ChangedColumns {
+		fmt.Fprintf(&out, "~column %s\n", name)
+	}
+
+	rows := func(prefix string, diffs []RowDiff) {
+		for _, row := range diffs {
+			fmt.Fprintf(&out, "%srow %d", prefix, row.Index)
+			if row.Key != "" {
+				fmt.Fprintf(&out, " (%s)", row.Key)
+			}
+			for _, v := range row.Values {
+				fmt.Fprintf(&out, " %s: %v -> %v", v.Column, v.Before, v.After)
+			}
+			out.WriteByte('\n')
+		}
+	}
+
+	rows("+", d.Inserted)
+	rows("-", d.Deleted)
+	rows("~", d.Updated)
+	return out.String()
+}
+
+// Patch applies the differences of the rows to a collection within a single transaction, in
+// order to transform the first collection into the second one. The commits of the patch are
+// written into the commit logger of the collection, so the patch can also be used to produce
+// the stream of commits which transforms the first collection into the second one.
+func (d *DiffReport) Patch(dst *Collection) error {
+	return dst.Query(func(txn *Txn) error {
+		for _, row := range d.Deleted {
+			if row.Key != "" {
+				if err := txn.DeleteKey(row.Key); err != nil {
+					return err
+				}
+				continue
+			}
+			txn.DeleteAt(row.Index)
+		}
+
+		for _, row := range d.Updated {
+			if err := txn.patchRow(row, false); err != nil {
+				return err
+			}
+		}
+
+		for _, row := range d.Inserted {
+			if err := txn.patchRow(row, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// patchRow writes the values of a row, inserting it if required
+func (txn *Txn) patchRow(row RowDiff, insert bool) error {
+	fn := func(r Row) error {
+		for _, v := range row.Values {
+			switch {
+			case txn.owner.pk != nil && v.Column == txn.owner.pk.name:
+				continue
+			case v.After == nil:
+				txn.bufferFor(v.Column).PutOperation(commit.Delete, r.Index())
+			default:
+				if err := txn.Any(v.Column).Set(v.value()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case row.Key != "":
+		return txn.UpsertKey(row.Key, fn)
+	case insert:
+		txn.bufferFor(rowColumn).PutOperation(commit.Insert, row.Index)
+		return txn.QueryAt(row.Index, fn)
+	default:
+		return txn.QueryAt(row.Index, fn)
+	}
+}
+
+// schema compares the columns of both collections and returns the names of the columns whose
+// values can be compared.
+func (d *DiffReport) schema(a, b *Collection) (columns []string) {
+	typeOf := func(c *column) string {
+		return fmt.Sprintf("%T", c.Column)
+	}
+
+	a.cols.Range(func(x *column) {
+		y, ok := b.cols.Load(x.name)
+		switch {
+		case isPseudo(x.name):
+		case !ok:
+			d.RemovedColumns = append(d.RemovedColumns, x.name)
+		case typeOf(x) != typeOf(y):
+			d.ChangedColumns = append(d.ChangedColumns, x.name)
+		case !x.IsIndex() && !y.IsIndex():
+			columns = append(columns, x.name)
+		}
+	})
+
+	b.cols.Range(func(y *column) {
+		if _, ok := a.cols.Load(y.name); !ok && !isPseudo(y.name) {
+			d.AddedColumns = append(d.AddedColumns, y.name)
+		}
+	})
+
+	sort.Strings(d.AddedColumns)
+	sort.Strings(d.RemovedColumns)
+	sort.Strings(d.ChangedColumns)
+	sort.Strings(columns)
+	return
+}
+
+// rowsByIndex compares the rows of both collections which have the same index
+func (d *DiffReport) rowsByIndex(a, b *Collection, fillA, fillB bitmap.Bitmap, columns []string) {
+	all := fillA.Clone(nil)
+	all.Or(fillB)
+	all.Range(func(idx uint32) {
+		inA, inB := fillA.Contains(idx), fillB.Contains(idx)
+		switch {
+		case inA && inB:
+			if values := diffValues(a, b, idx, idx, columns); len(values) > 0 {
+				d.Updated = append(d.Updated, RowDiff{Index: idx, Values: values})
+			}
+		case inA:
+			d.Deleted = append(d.Deleted, RowDiff{Index: idx, Values: imageValues(a, idx, columns, false)})
+		case inB:
+			d.Inserted = append(d.Inserted, RowDiff{Index: idx, Values: imageValues(b, idx, columns, true)})
+		}
+	})
+}
+
+// rowsByKey compares the rows of both collections which have the same primary key
+func (d *DiffReport) rowsByKey(a, b *Collection, fillA, fillB bitmap.Bitmap, columns []string) {
+	fillA.Range(func(idx uint32) {
+		key := keyAt(a, idx)
+		other, ok := b.pk.OffsetOf(key)
+		switch {
+		case !ok:
+			d.Deleted = append(d.Deleted, RowDiff{Index: idx, Key: key, Values: imageValues(a, idx, columns, false)})
+		default:
+			if values := diffValues(a, b, idx, other, columns); len(values) > 0 {
+				d.Updated = append(d.Updated, RowDiff{Index: idx, Key: key, Values: values})
+			}
+		}
+	})
+
+	fillB.Range(func(idx uint32) {
+		key := keyAt(b, idx)
+		if _, ok := a.pk.OffsetOf(key); !ok {
+			d.Inserted = append(d.Inserted, RowDiff{Index: idx, Key: key, Values: imageValues(b, idx, columns, true)})
+		}
+	})
+}
+
+// keyAt returns the primary key of a row
+func keyAt(c *Collection, idx uint32) string {
+	key, _ := c.pk.Value(idx)
+	s, _ := key.(string)
+	return s
+}
+
+// diffValues returns the values which differ between two rows
+func diffValues(a, b *Collection, idxA, idxB uint32, columns []string) (values []ValueDiff) {
+	for _, name := range columns {
+		x, _ := a.cols.Load(name)
+		y, _ := b.cols.Load(name)
+		before, _ := x.Value(idxA)
+		after, _ := y.Value(idxB)
+		if !reflect.DeepEqual(before, after) {
+			values = append(values, diffOf(x, y, before, after))
+		}
+	}
+	return
+}
+
+// imageValues returns the values of a row, either as the values after or before the change
+func imageValues(c *Collection, idx uint32, columns []string, after bool) (values []ValueDiff) {
+	for _, name := range columns {
+		col, _ := c.cols.Load(name)
+		v, ok := col.Value(idx)
+		switch {
+		case !ok:
+			continue
+		case after:
+			values = append(values, diffOf(col, col, nil, v))
+		default:
+			values = append(values, ValueDiff{Column: name, Before: maskValue(col, v)})
+		}
+	}
+	return
+}
@@ -0,0 +1,131 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a := loadPlayers(500)
+	b := loadPlayers(500)
+
+	report, err := Diff(a, b)
+	assert.NoError(t, err)
+	assert.True(t, report.IsEmpty())
+
+	// Change the schema and the rows of the second collection
+	b.CreateColumn("score", ForFloat64())
+	b.DropIndex("old")
+	assert.NoError(t, b.QueryAt(1, func(r Row) error {
+		r.SetInt("age", 99)
+		r.SetString("name", "Roman")
+		return nil
+	}))
+	assert.True(t, b.DeleteAt(2))
+	assert.True(t, b.DeleteAt(3))
+	b.Insert(func(r Row) error {
+		r.SetString("name", "Merlin")
+		return nil
+	})
+
+	report, err = Diff(a, b)
+	assert.NoError(t, err)
+	assert.False(t, report.IsEmpty())
+	assert.Equal(t, []string{"score"}, report.AddedColumns)
+	assert.Equal(t, []string{"old"}, report.RemovedColumns)
+	assert.Len(t, report.Inserted, 1)
+	assert.Equal(t, uint32(500), report.Inserted[0].Index)
+	assert.Equal(t, []ValueDiff{{Column: "name", After: "Merlin"}}, report.Inserted[0].Values)
+	assert.Len(t, report.Deleted, 2)
+	assert.Equal(t, uint32(3), report.Deleted[1].Index)
+	assert.Equal(t, ValueDiff{Column: "age", Before: 35}, report.Deleted[1].Values[1])
+	assert.Len(t, report.Updated, 1)
+	assert.Equal(t, uint32(1), report.Updated[0].Index)
+	assert.Equal(t, ValueDiff{Column: "age", Before: 25, After: 99}, report.Updated[0].Values[0])
+	assert.Contains(t, report.String(), "+column score\n")
+	assert.Contains(t, report.String(), "~row 1 age: 25 -> 99 name: Mcneil Roberson -> Roman\n")
+
+	// Patching the first collection only leaves the differences of the schema
+	assert.NoError(t, report.Patch(a))
+	report, err = Diff(a, b)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Inserted)
+	assert.Empty(t, report.Deleted)
+	assert.Empty(t, report.Updated)
+	assert.Equal(t, b.Count(), a.Count())
+	assert.NoError(t, CheckInvariants(a))
+}
+
+func TestDiffByKey(t *testing.T) {
+	newKeyed := func() *Collection {
+		c := NewCollection()
+		c.CreateColumn("id", ForKey())
+		c.CreateColumn("age", ForInt())
+		for _, key := range []string{"a", "b", "c"} {
+			c.InsertKey(key, func(r Row) error {
+				r.SetInt("age", 20)
+				return nil
+			})
+		}
+		return c
+	}
+
+	a, b := newKeyed(), newKeyed()
+	b.DeleteKey("a")
+	b.InsertKey("d", func(r Row) error {
+		r.SetInt("age", 40)
+		return nil
+	})
+	b.QueryKey("c", func(r Row) error {
+		r.SetInt("age", 30)
+		return nil
+	})
+
+	report, err := Diff(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"+row 0 (d) age: <nil> -> 40 id: <nil> -> d\n"+
+		"-row 0 (a) age: 20 -> <nil> id: a -> <nil>\n"+
+		"~row 2 (c) age: 20 -> 30\n", report.String())
+
+	assert.NoError(t, report.Patch(a))
+	report, err = Diff(a, b)
+	assert.NoError(t, err)
+	assert.True(t, report.IsEmpty())
+}
+
+func TestDiffMask(t *testing.T) {
+	newMasked := func() *Collection {
+		c := NewCollection()
+		c.CreateColumn("id", ForKey())
+		c.CreateColumn("email", ForString(WithMask[string](func(any) any {
+			return "***"
+		})))
+		c.InsertKey("a", func(r Row) error {
+			r.SetString("email", "roman@example.com")
+			return nil
+		})
+		return c
+	}
+
+	a, b := newMasked(), newMasked()
+	b.QueryKey("a", func(r Row) error {
+		r.SetString("email", "merlin@example.com")
+		return nil
+	})
+
+	// The changes of the masked values are reported, without revealing them
+	report, err := Diff(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "~row 0 (a) email: *** -> ***\n", report.String())
+
+	// The patch still writes the actual values
+	assert.NoError(t, report.Patch(a))
+	report, err = Diff(a, b)
+	assert.NoError(t, err)
+	assert.True(t, report.IsEmpty())
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"github.com/kelindar/column/commit"
+)
+
+// RowDump represents the complete state of a single row, including the internal state of
+// the collection, which can be attached to the bug reports.
+type RowDump struct {
+	Index   uint32         `json:"index"`   // The index of the row
+	Chunk   uint32         `json:"chunk"`   // The chunk containing the row
+	Exists  bool           `json:"exists"`  // Whether the row is set in the fill list
+	Version uint64         `json:"version"` // The version of the last commit of the row, if tracked
+	Values  map[string]any `json:"values"`  // The values of the columns, including the internal ones
+	Indexes []string       `json:"indexes"` // The indexes which contain the row, in sorted order
+}
+
+// DumpAt returns the complete state of the row at the specified index for the support tooling
+// and the bug reports. Unlike the other reads, the dump also includes the internal columns and
+// the values of the rows which are not set in the fill list, in order to expose the leftovers
+// of an inconsistent collection. The values of the masked columns are always masked, so that
+// the dump can be shared safely. The version is only tracked when the Storage.Lifecycle option is set.
+func (c *Collection) DumpAt(idx uint32) (dump RowDump) {
+	dump.Index = idx
+	dump.Chunk = uint32(commit.ChunkAt(idx))
+	dump.Values = make(map[string]any)
+	c.QueryWith(ReadSnapshot, func(txn *Txn) error {
+		c.lock.RLock()
+		dump.Exists = c.fill.Contains(idx)
+		c.lock.RUnlock()
+
+		c.cols.Range(func(column *column) {
+			if column.IsIndex() {
+				return
+			}
+
+			v, ok := column.Value(idx)
+			switch mask := column.valueMask(); {
+			case !ok:
+			case mask != nil:
+				dump.Values[column.name] = mask(v)
+			default:
+				dump.Values[column.name] = v
+			}
+		})
+
+		if version, ok := dump.Values[versionColumn].(uint64); ok {
+			dump.Version = version
+		}
+
+		dump.Indexes = txn.IndexesAt(idx)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,56 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpAt(t *testing.T) {
+	players := NewCollection(Options{Storage: StorageOptions{Lifecycle: true}})
+	players.CreateColumn("name", ForString())
+	players.CreateColumn("email", ForString(WithMask[string](func(any) any {
+		return "***"
+	})))
+	players.CreateColumn("age", ForInt())
+	players.CreateIndex("old", "age", func(r Reader) bool {
+		return r.Int() >= 30
+	})
+	players.CreateIndex("young", "age", func(r Reader) bool {
+		return r.Int() < 30
+	})
+
+	idx, err := players.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		r.SetString("email", "roman@example.com")
+		r.SetInt("age", 35)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	dump := players.DumpAt(idx)
+	assert.Equal(t, idx, dump.Index)
+	assert.Equal(t, uint32(0), dump.Chunk)
+	assert.True(t, dump.Exists)
+	assert.NotZero(t, dump.Version)
+	assert.Equal(t, "Roman", dump.Values["name"])
+	assert.Equal(t, "***", dump.Values["email"])
+	assert.Equal(t, 35, dump.Values["age"])
+	assert.Contains(t, dump.Values, "$created")
+	assert.Equal(t, []string{"old"}, dump.Indexes)
+
+	// A deleted row is no longer in the fill list
+	assert.True(t, players.DeleteAt(idx))
+	dump = players.DumpAt(idx)
+	assert.False(t, dump.Exists)
+	assert.Empty(t, dump.Indexes)
+
+	// A row beyond the capacity of the collection
+	dump = players.DumpAt(100000)
+	assert.Equal(t, uint32(6), dump.Chunk)
+	assert.False(t, dump.Exists)
+	assert.Empty(t, dump.Values)
+}
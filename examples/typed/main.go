@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//go:generate go run github.com/kelindar/column/columngen -type Player
+
+// Player represents a player, stored in a strongly typed collection
+type Player struct {
+	Serial  string  `column:"serial,key"`
+	Name    string  `column:"name"`
+	Race    string  `column:"race,enum"`
+	Age     int     `column:"age"`
+	Balance float64 `column:"balance"`
+	Active  bool    `column:"active"`
+	Notes   string  `column:"-"`
+}
+
+func main() {
+
+	// Create a new collection with a column for each field of the player
+	players := NewPlayerCollection()
+	for i, name := range []string{"Merlin", "Arthur", "Lancelot", "Gawain", "Morgana"} {
+		players.InsertKey(Player{
+			Serial:  fmt.Sprintf("p%d", i),
+			Name:    name,
+			Race:    []string{"human", "elf"}[i%2],
+			Age:     20 + i*10,
+			Balance: float64(i) * 100,
+			Active:  i%2 == 0,
+		})
+	}
+
+	// Update a player by its key
+	merlin, _ := players.SelectAtKey("p0")
+	merlin.Age = 500
+	players.UpsertKey(merlin)
+
+	// Query the active humans older than 30
+	players.Query(func(q PlayerQuery) error {
+		return q.WithActive().
+			WithRace(func(v string) bool { return v == "human" }).
+			WithAge(func(v int) bool { return v > 30 }).
+			Range(func(idx uint32, v Player) {
+				fmt.Println(v.Serial, v.Name, strings.ToUpper(v.Race), v.Age)
+			})
+	})
+}
@@ -0,0 +1,144 @@
+// Code generated by columngen, DO NOT EDIT.
+// Any changes will be lost if this file is regenerated.
+
+package main
+
+import (
+	"github.com/kelindar/column"
+)
+
+// PlayerCollection represents a collection of Player values, with strongly typed
+// accessors for each of their fields.
+type PlayerCollection struct {
+	*column.Collection
+}
+
+// NewPlayerCollection creates a new collection with a column for each field of Player
+func NewPlayerCollection(opts ...column.Options) *PlayerCollection {
+	c := column.NewCollection(opts...)
+	c.CreateColumn("serial", column.ForKey())
+	c.CreateColumn("name", column.ForString())
+	c.CreateColumn("race", column.ForEnum())
+	c.CreateColumn("age", column.ForInt())
+	c.CreateColumn("balance", column.ForFloat64())
+	c.CreateColumn("active", column.ForBool())
+	return &PlayerCollection{Collection: c}
+}
+
+// InsertKey inserts a new Player, failing if one with the same key already exists
+func (c *PlayerCollection) InsertKey(v Player) error {
+	return c.Collection.InsertKey(v.Serial, func(r column.Row) error {
+		setPlayer(r, &v)
+		return nil
+	})
+}
+
+// UpsertKey inserts a new Player or updates the existing one with the same key
+func (c *PlayerCollection) UpsertKey(v Player) error {
+	return c.Collection.UpsertKey(v.Serial, func(r column.Row) error {
+		setPlayer(r, &v)
+		return nil
+	})
+}
+
+// SelectAtKey returns the Player with the specified key, if it exists
+func (c *PlayerCollection) SelectAtKey(key string) (v Player, ok bool) {
+	c.Collection.QueryKey(key, func(r column.Row) error {
+		v, ok = getPlayer(r), true
+		return nil
+	})
+	return
+}
+
+// Query creates a transaction on the collection, similarly to Collection.Query()
+func (c *PlayerCollection) Query(fn func(q PlayerQuery) error) error {
+	return c.Collection.Query(func(txn *column.Txn) error {
+		return fn(PlayerQuery{Txn: txn})
+	})
+}
+
+// --------------------------- Query ----------------------------
+
+// PlayerQuery represents a transaction on a collection of Player values, with strongly
+// typed filters for each of their fields.
+type PlayerQuery struct {
+	*column.Txn
+}
+
+// Range iterates over the Player values of the current selection
+func (q PlayerQuery) Range(fn func(idx uint32, v Player)) error {
+	return q.Txn.RangeRows(func(r column.Row) error {
+		fn(r.Index(), getPlayer(r))
+		return nil
+	})
+}
+
+// Update overwrites the values of the current selection with the values returned by the function
+func (q PlayerQuery) Update(fn func(v *Player)) error {
+	return q.Txn.RangeRows(func(r column.Row) error {
+		v := getPlayer(r)
+		fn(&v)
+		setPlayer(r, &v)
+		return nil
+	})
+}
+
+// WithSerial filters down the rows for which the predicate on Serial returns true
+func (q PlayerQuery) WithSerial(predicate func(v string) bool) PlayerQuery {
+	q.Txn.WithString("serial", predicate)
+	return q
+}
+
+// WithName filters down the rows for which the predicate on Name returns true
+func (q PlayerQuery) WithName(predicate func(v string) bool) PlayerQuery {
+	q.Txn.WithString("name", predicate)
+	return q
+}
+
+// WithRace filters down the rows for which the predicate on Race returns true
+func (q PlayerQuery) WithRace(predicate func(v string) bool) PlayerQuery {
+	q.Txn.WithString("race", predicate)
+	return q
+}
+
+// WithAge filters down the rows for which the predicate on Age returns true
+func (q PlayerQuery) WithAge(predicate func(v int) bool) PlayerQuery {
+	q.Txn.WithInt("age", func(v int64) bool {
+		return predicate(int(v))
+	})
+	return q
+}
+
+// WithBalance filters down the rows for which the predicate on Balance returns true
+func (q PlayerQuery) WithBalance(predicate func(v float64) bool) PlayerQuery {
+	q.Txn.WithFloat("balance", predicate)
+	return q
+}
+
+// WithActive filters down the rows for which Active is true
+func (q PlayerQuery) WithActive() PlayerQuery {
+	q.Txn.With("active")
+	return q
+}
+
+// --------------------------- Mapping ----------------------------
+
+// setPlayer writes the fields of Player into the row, except for its key
+func setPlayer(r column.Row, v *Player) {
+	r.SetString("name", v.Name)
+	r.SetEnum("race", v.Race)
+	r.SetInt("age", v.Age)
+	r.SetFloat64("balance", v.Balance)
+	r.SetBool("active", v.Active)
+}
+
+// getPlayer reads the fields of Player from the row
+func getPlayer(r column.Row) (v Player) {
+	v.Serial, _ = r.Key()
+	v.Name, _ = r.String("name")
+	v.Race, _ = r.Enum("race")
+	v.Age, _ = r.Int("age")
+	v.Balance, _ = r.Float64("balance")
+	v.Active = r.Bool("active")
+	return
+}
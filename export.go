@@ -0,0 +1,188 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/kelindar/column/commit"
+)
+
+// defaultExportBatch is the default number of rows of an exported batch
+const defaultExportBatch = 65536
+
+// Exporter represents a destination of the rows exported by a transaction, such as a bulk
+// loader of a warehouse. The batch is only valid until the function returns.
+type Exporter interface {
+	WriteBatch(batch *ExportBatch) error
+}
+
+// ExportFunc represents a function which receives the exported batches, implementing Exporter
+type ExportFunc func(batch *ExportBatch) error
+
+// WriteBatch calls the function with the batch
+func (fn ExportFunc) WriteBatch(batch *ExportBatch) error {
+	return fn(batch)
+}
+
+// ExportBatch represents a column-oriented batch of the rows exported by a transaction
+type ExportBatch struct {
+	Rows    int            // The number of rows of the batch
+	Indexes []uint32       // The index of each row of the batch
+	Columns []ExportColumn // The values of each exported column
+}
+
+// ExportColumn represents the values of a column within an exported batch
+type ExportColumn struct {
+	Name   string       // The name of the column
+	Kind   reflect.Kind // The kind of the values, or reflect.String for the values encoded as text
+	Values []any        // The value of each row, or nil if the row has no value
+}
+
+// Export streams the rows selected by the transaction into the exporter, in batches of up to
+// the specified number of rows. The values are gathered column by column for each chunk while
+// holding its read lock, while the batches are written once the lock is released. If no column
+// is specified, all of the columns except for the indexes are exported in alphabetical order.
+// The values of the masked columns are masked, unless the transaction was unmasked.
+func (txn *Txn) Export(dst Exporter, batchSize int, columnNames ...string) error {
+	return txn.export(dst, batchSize, true, columnNames)
+}
+
+// export streams the rows selected by the transaction into the exporter, masking the values of
+// the masked columns if requested.
+func (txn *Txn) export(dst Exporter, batchSize int, masked bool, columnNames []string) error {
+	if batchSize <= 0 {
+		batchSize = defaultExportBatch
+	}
+
+	columns, err := txn.exportColumns(columnNames)
+	if err != nil {
+		return err
+	}
+
+	batch := &ExportBatch{Columns: make([]ExportColumn, len(columns))}
+	masks := make([]func(any) any, len(columns))
+	for i, column := range columns {
+		batch.Columns[i] = ExportColumn{Name: column.name, Kind: valueKindOf(column.Column)}
+		if !masked {
+			continue
+		}
+
+		if masks[i] = txn.maskOf(column.name); masks[i] != nil {
+			batch.Columns[i].Kind = reflect.String // The masked values may not be numbers
+		}
+	}
+
+	txn.initialize()
+	rows := make([]uint32, 0, chunkSize)
+	limit := commit.Chunk(len(txn.index) >> bitmapShift)
+	for chunk := commit.Chunk(0); chunk <= limit; chunk++ {
+		offset := chunk.Min()
+		rows = rows[:0]
+		chunk.OfBitmap(txn.index).Range(func(x uint32) {
+			rows = append(rows, offset+x)
+		})
+
+		// Gather the values column by column, while holding the read lock
+		txn.rlock(chunk)
+		for i, column := range columns {
+			values := batch.Columns[i].Values
+			for _, idx := range rows {
+				v, ok := column.Value(idx)
+				switch {
+				case !ok:
+					v = nil
+				case masks[i] != nil:
+					v = masks[i](v)
+				}
+				values = append(values, v)
+			}
+			batch.Columns[i].Values = values
+		}
+		txn.runlock(chunk)
+
+		// Write the complete batches
+		batch.Indexes = append(batch.Indexes, rows...)
+		batch.Rows += len(rows)
+		for batch.Rows >= batchSize {
+			if err := batch.flush(dst, batchSize); err != nil {
+				return err
+			}
+		}
+	}
+
+	if batch.Rows > 0 {
+		return batch.flush(dst, batch.Rows)
+	}
+	return nil
+}
+
+// flush writes the first rows of the batch into the exporter, and removes them from the batch
+func (b *ExportBatch) flush(dst Exporter, rows int) error {
+	head := &ExportBatch{Rows: rows, Indexes: b.Indexes[:rows], Columns: make([]ExportColumn, len(b.Columns))}
+	for i, column := range b.Columns {
+		column.Values = column.Values[:rows]
+		head.Columns[i] = column
+	}
+
+	if err := dst.WriteBatch(head); err != nil {
+		return err
+	}
+
+	b.Rows -= rows
+	b.Indexes = b.Indexes[:copy(b.Indexes, b.Indexes[rows:])]
+	for i := range b.Columns {
+		values := b.Columns[i].Values
+		b.Columns[i].Values = values[:copy(values, values[rows:])]
+	}
+	return nil
+}
+
+// exportColumns returns the columns to export, all of the value columns by default
+func (txn *Txn) exportColumns(columnNames []string) ([]*column, error) {
+	if len(columnNames) == 0 {
+		txn.owner.cols.Range(func(column *column) {
+			if isExportable(column) {
+				columnNames = append(columnNames, column.name)
+			}
+		})
+		sort.Strings(columnNames)
+	}
+
+	columns := make([]*column, 0, len(columnNames))
+	for _, columnName := range columnNames {
+		column, ok := txn.columnAt(columnName)
+		if !ok {
+			return nil, fmt.Errorf("column: column '%s' does not exist", columnName)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// isExportable returns whether a column contains values which are exported by default
+func isExportable(column *column) bool {
+	switch column.Column.(type) {
+	case *columnTrigger, *indexTrigger, *derivedTrigger, *columnSortIndex:
+		return false
+	default:
+		return !column.IsIndex() && !isPseudo(column.name) && column.name != expireColumn
+	}
+}
+
+// exportText returns the textual representation of a value, the values which are not
+// strings are encoded as JSON.
+func exportText(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	if encoded, err := json.Marshal(value); err == nil {
+		return string(encoded)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("name", ForString())
+	c.CreateColumn("balance", ForFloat64())
+	c.CreateIndex("rich", "balance", func(r Reader) bool {
+		return r.Float() >= 100
+	})
+
+	for i := 0; i < 20000; i++ {
+		c.Insert(func(r Row) error {
+			r.SetFloat64("balance", float64(i))
+			if i%2 == 0 {
+				r.SetString("name", "Merlin")
+			}
+			return nil
+		})
+	}
+
+	// The selection is exported in batches
+	var sizes []int
+	var total float64
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		assert.Error(t, txn.Export(nil, 0, "invalid"))
+		return txn.With("rich").Export(ExportFunc(func(batch *ExportBatch) error {
+			assert.Equal(t, "balance", batch.Columns[0].Name)
+			assert.Equal(t, reflect.Float64, batch.Columns[0].Kind)
+			assert.Equal(t, "name", batch.Columns[1].Name)
+			assert.Equal(t, reflect.String, batch.Columns[1].Kind)
+			assert.Len(t, batch.Indexes, batch.Rows)
+			for i, v := range batch.Columns[0].Values {
+				assert.Equal(t, float64(batch.Indexes[i]), v)
+				total += v.(float64)
+			}
+
+			sizes = append(sizes, batch.Rows)
+			return nil
+		}), 7000)
+	}))
+	assert.Equal(t, []int{7000, 7000, 5900}, sizes)
+	assert.Equal(t, float64(19999*20000/2-99*100/2), total)
+
+	// The errors of the exporter are returned
+	assert.Error(t, c.Query(func(txn *Txn) error {
+		return txn.Export(ExportFunc(func(batch *ExportBatch) error {
+			return errors.New("boom")
+		}), 0)
+	}))
+}
+
+func TestExportClickHouse(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("age", ForInt16())
+	c.CreateColumn("name", ForString())
+	c.Insert(func(r Row) error {
+		r.SetInt16("age", -2)
+		r.SetString("name", "Bob")
+		return nil
+	})
+	c.Insert(func(r Row) error {
+		r.SetInt16("age", 3)
+		return nil
+	})
+
+	output := bytes.NewBuffer(nil)
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		return txn.Export(NewClickHouseExporter(output), 0)
+	}))
+
+	expect := []byte{2, 2} // Columns and rows
+	expect = append(expect, 3, 'a', 'g', 'e')
+	expect = append(expect, 15)
+	expect = append(expect, "Nullable(Int16)"...)
+	expect = append(expect, 0, 0, 0xfe, 0xff, 3, 0)
+	expect = append(expect, 4, 'n', 'a', 'm', 'e')
+	expect = append(expect, 16)
+	expect = append(expect, "Nullable(String)"...)
+	expect = append(expect, 0, 1, 3, 'B', 'o', 'b', 0)
+	assert.Equal(t, expect, output.Bytes())
+}
+
+func TestExportBigQuery(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("active", ForBool())
+	c.CreateColumn("age", ForInt())
+	c.CreateColumn("class", ForEnum())
+	c.Insert(func(r Row) error {
+		r.SetBool("active", true)
+		r.SetInt("age", 30)
+		return nil
+	})
+	c.Insert(func(r Row) error {
+		r.SetInt("age", 40)
+		r.SetEnum("class", "mage")
+		return nil
+	})
+
+	var loads []BigQueryLoad
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		return txn.Export(NewBigQueryExporter(func(load BigQueryLoad) error {
+			load.Data = append([]byte(nil), load.Data...)
+			loads = append(loads, load)
+			return nil
+		}), 0)
+	}))
+
+	assert.Len(t, loads, 1)
+	assert.Equal(t, 2, loads[0].Rows)
+	assert.Equal(t, []BigQueryField{
+		{Name: "active", Type: "BOOLEAN", Mode: "NULLABLE"},
+		{Name: "age", Type: "INTEGER", Mode: "NULLABLE"},
+		{Name: "class", Type: "STRING", Mode: "NULLABLE"},
+	}, loads[0].Schema)
+	assert.Equal(t, []string{
+		`{"active":true,"age":30}`,
+		`{"age":40,"class":"mage"}`,
+	}, strings.Split(strings.TrimSpace(string(loads[0].Data)), "\n"))
+}
@@ -0,0 +1,536 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// Expr represents a compiled expression, such as "balance > 2500 && race == 'human'",
+// which can be used to filter rows of a transaction or to compute values. Expressions
+// support numbers, strings, booleans, column names, arithmetic (+ - * / %), comparison
+// (== != < <= > >=) and logical (&& || !) operators as well as parentheses.
+type Expr struct {
+	text string
+	root *node
+}
+
+// ParseExpr parses the text of an expression, making sure it is valid.
+func ParseExpr(text string) (*Expr, error) {
+	p := &parser{lexer: lexer{src: text}}
+	p.next()
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected '%s'", p.tok.text)
+	}
+	return &Expr{text: text, root: root}, nil
+}
+
+// String returns the text of the expression
+func (e *Expr) String() string {
+	return e.text
+}
+
+// --------------------------- Transaction ----------------------------
+
+// WithExpr applies a logical AND operation between the current query and the rows for which
+// the expression evaluates to true. Comparisons between a numeric column and a number are
+// evaluated directly on the column data, chunk by chunk. If the expression is invalid or
+// refers to a column which does not exist, the result is empty. Use ParseExpr() to validate
+// expressions before using them. The masked columns are evaluated on their masked values,
+// unless the transaction is unmasked.
+func (txn *Txn) WithExpr(expr string) *Txn {
+	txn.initialize()
+	txn.trace("withExpr", true, expr)
+	parsed, err := ParseExpr(expr)
+	if err != nil {
+		txn.index.Clear()
+		return txn
+	}
+
+	txn.useIndexes()
+	if err := txn.filterExpr(parsed.root); err != nil {
+		txn.index.Clear()
+	}
+	return txn
+}
+
+// Eval evaluates the expression for every row of the current selection and calls the
+// function with the result, which is either a float64, a string, a bool or nil if one of
+// the columns has no value for the row. Similar to Range(), the cursor is moved to each row.
+func (txn *Txn) Eval(expr string, fn func(idx uint32, value any)) error {
+	parsed, err := ParseExpr(expr)
+	if err != nil {
+		return err
+	}
+
+	eval, err := txn.bindExpr(parsed.root)
+	if err != nil {
+		return err
+	}
+
+	return txn.Range(func(idx uint32) {
+		fn(idx, eval(idx))
+	})
+}
+
+// filterExpr filters down the index based on the expression
+func (txn *Txn) filterExpr(n *node) error {
+	switch {
+
+	// Conjunctions are applied one after the other
+	case n.kind == nodeBinary && n.op == "&&":
+		if err := txn.filterExpr(n.left); err != nil {
+			return err
+		}
+		return txn.filterExpr(n.right)
+
+	// Comparisons of a numeric column with a number can run on the column itself
+	case n.kind == nodeBinary && isComparison(n.op) && n.left.kind == nodeColumn && n.right.kind == nodeNumber:
+		if c, ok := txn.columnAt(n.left.text); ok && c.IsNumeric() && txn.maskOf(c.name) == nil {
+			cmp, rhs := compareNumbers(n.op), n.right.num
+			txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+				c.Column.(Numeric).FilterFloat64(chunk, index, func(v float64) bool {
+					return cmp(v, rhs)
+				})
+			})
+			return nil
+		}
+	}
+
+	// Otherwise, evaluate the expression for every row
+	eval, err := txn.bindExpr(n)
+	if err != nil {
+		return err
+	}
+
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		offset := chunk.Min()
+		index.Filter(func(x uint32) bool {
+			return eval(offset+x) == true
+		})
+	})
+	return nil
+}
+
+// bindExpr binds the expression to the columns of the transaction
+func (txn *Txn) bindExpr(n *node) (func(idx uint32) any, error) {
+	switch n.kind {
+	case nodeNumber:
+		v := n.num
+		return func(uint32) any { return v }, nil
+	case nodeString:
+		v := n.text
+		return func(uint32) any { return v }, nil
+	case nodeBool:
+		v := n.text == "true"
+		return func(uint32) any { return v }, nil
+	case nodeColumn:
+		return txn.bindColumn(n.text)
+	case nodeUnary:
+		operand, err := txn.bindExpr(n.left)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.op == "!" {
+			return func(idx uint32) any {
+				v, ok := operand(idx).(bool)
+				return ok && !v
+			}, nil
+		}
+
+		return func(idx uint32) any {
+			if v, ok := operand(idx).(float64); ok {
+				return -v
+			}
+			return nil
+		}, nil
+	}
+
+	// Binary operator, bind both of the operands first
+	lhs, err := txn.bindExpr(n.left)
+	if err != nil {
+		return nil, err
+	}
+
+	rhs, err := txn.bindExpr(n.right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op := n.op; op {
+	case "&&":
+		return func(idx uint32) any {
+			return lhs(idx) == true && rhs(idx) == true
+		}, nil
+	case "||":
+		return func(idx uint32) any {
+			return lhs(idx) == true || rhs(idx) == true
+		}, nil
+	case "==", "!=":
+		return func(idx uint32) any {
+			a, b := lhs(idx), rhs(idx)
+			if a == nil || b == nil {
+				return false
+			}
+			return (a == b) == (op == "==")
+		}, nil
+	case "<", "<=", ">", ">=":
+		cmp := compareNumbers(op)
+		return func(idx uint32) any {
+			switch a := lhs(idx).(type) {
+			case float64:
+				b, ok := rhs(idx).(float64)
+				return ok && cmp(a, b)
+			case string:
+				b, ok := rhs(idx).(string)
+				return ok && cmp(float64(strings.Compare(a, b)), 0)
+			default:
+				return false
+			}
+		}, nil
+	default:
+		return func(idx uint32) any {
+			a, ok1 := lhs(idx).(float64)
+			b, ok2 := rhs(idx).(float64)
+			if !ok1 || !ok2 {
+				return nil
+			}
+
+			switch op {
+			case "+":
+				return a + b
+			case "-":
+				return a - b
+			case "*":
+				return a * b
+			case "/":
+				return a / b
+			default:
+				return math.Mod(a, b)
+			}
+		}, nil
+	}
+}
+
+// bindColumn binds a column reference to a function which loads its value
+func (txn *Txn) bindColumn(columnName string) (func(idx uint32) any, error) {
+	c, ok := txn.columnAt(columnName)
+	if !ok {
+		return nil, fmt.Errorf("column: column '%s' does not exist", columnName)
+	}
+
+	// The masked columns are evaluated on their masked values, as numbers if possible
+	if mask := txn.maskOf(columnName); mask != nil {
+		return func(idx uint32) any {
+			value, ok := c.Value(idx)
+			if !ok {
+				return nil
+			}
+
+			switch masked := mask(value).(type) {
+			case string, bool:
+				return masked
+			default:
+				if n, ok := numberOf[float64](masked); ok {
+					return n
+				}
+				return nil
+			}
+		}, nil
+	}
+
+	switch v := c.Column.(type) {
+	case Numeric:
+		return func(idx uint32) any {
+			if n, ok := v.LoadFloat64(idx); ok {
+				return n
+			}
+			return nil
+		}, nil
+	case Textual:
+		return func(idx uint32) any {
+			if s, ok := v.LoadString(idx); ok {
+				return s
+			}
+			return nil
+		}, nil
+	case *columnBool:
+		return func(idx uint32) any {
+			return v.Contains(idx)
+		}, nil
+	case *columnIndex:
+		return func(idx uint32) any {
+			return v.Contains(idx)
+		}, nil
+	default:
+		return func(idx uint32) any {
+			if value, ok := v.Value(idx); ok {
+				return value
+			}
+			return nil
+		}, nil
+	}
+}
+
+// isComparison returns whether the operator is a comparison
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return true
+	default:
+		return false
+	}
+}
+
+// compareNumbers returns a comparison function for an operator
+func compareNumbers(op string) func(a, b float64) bool {
+	switch op {
+	case "==":
+		return func(a, b float64) bool { return a == b }
+	case "!=":
+		return func(a, b float64) bool { return a != b }
+	case "<":
+		return func(a, b float64) bool { return a < b }
+	case "<=":
+		return func(a, b float64) bool { return a <= b }
+	case ">":
+		return func(a, b float64) bool { return a > b }
+	default:
+		return func(a, b float64) bool { return a >= b }
+	}
+}
+
+// --------------------------- Syntax Tree ----------------------------
+
+type nodeKind uint8
+
+const (
+	nodeNumber nodeKind = iota
+	nodeString
+	nodeBool
+	nodeColumn
+	nodeUnary
+	nodeBinary
+)
+
+// node represents a node of the syntax tree
+type node struct {
+	kind  nodeKind // The kind of the node
+	op    string   // The operator, for unary and binary nodes
+	text  string   // The text of a string, bool or column
+	num   float64  // The value of a number
+	left  *node    // The left (or only) operand
+	right *node    // The right operand
+}
+
+// parser represents a recursive descent parser for the expressions
+type parser struct {
+	lexer
+	tok token
+}
+
+// next advances to the next token
+func (p *parser) next() {
+	p.tok = p.lexer.next()
+}
+
+// errorf creates a parsing error
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("column: invalid expression '%s', %s", p.src, fmt.Sprintf(format, args...))
+}
+
+// parseBinary parses a left-associative binary operation
+func (p *parser) parseBinary(operand func() (*node, error), ops ...string) (*node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.kind == tokOperator && contains(ops, p.tok.text) {
+		op := p.tok.text
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &node{kind: nodeBinary, op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (*node, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	return p.parseBinary(p.parseCompare, "&&")
+}
+
+func (p *parser) parseCompare() (*node, error) {
+	return p.parseBinary(p.parseAdd, "==", "!=", "<", "<=", ">", ">=")
+}
+
+func (p *parser) parseAdd() (*node, error) {
+	return p.parseBinary(p.parseMul, "+", "-")
+}
+
+func (p *parser) parseMul() (*node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	if p.tok.kind == tokOperator && (p.tok.text == "!" || p.tok.text == "-") {
+		op := p.tok.text
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: nodeUnary, op: op, left: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number '%s'", tok.text)
+		}
+		return &node{kind: nodeNumber, num: v}, nil
+	case tokString:
+		p.next()
+		return &node{kind: nodeString, text: tok.text}, nil
+	case tokIdent:
+		p.next()
+		if tok.text == "true" || tok.text == "false" {
+			return &node{kind: nodeBool, text: tok.text}, nil
+		}
+		return &node{kind: nodeColumn, text: tok.text}, nil
+	case tokOperator:
+		if tok.text == "(" {
+			p.next()
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.tok.kind != tokOperator || p.tok.text != ")" {
+				return nil, p.errorf("missing ')'")
+			}
+			p.next()
+			return inner, nil
+		}
+	case tokEOF:
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected '%s'", tok.text)
+}
+
+// contains checks whether the value is in the list
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// --------------------------- Lexer ----------------------------
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokInvalid
+	tokNumber
+	tokString
+	tokIdent
+	tokOperator
+)
+
+// token represents a lexical token
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lexer splits the expression into tokens
+type lexer struct {
+	src string
+	pos int
+}
+
+// next returns the next token of the expression
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF}
+	}
+
+	start, c := l.pos, l.src[l.pos]
+	switch {
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos]}
+
+	case c == '\'' || c == '"':
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != c {
+			l.pos++
+		}
+
+		if l.pos >= len(l.src) {
+			return token{kind: tokInvalid, text: l.src[start:]}
+		}
+		l.pos++
+		return token{kind: tokString, text: l.src[start+1 : l.pos-1]}
+
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isDigit(l.src[l.pos]) || unicode.IsLetter(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos]}
+	}
+
+	// Two-character operators first, then single-character ones
+	for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOperator, text: op}
+		}
+	}
+
+	l.pos++
+	return token{kind: tokInvalid, text: l.src[start:l.pos]}
+}
+
+// isDigit returns whether the character is a decimal digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpr(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		ok   bool
+	}{
+		{"balance > 2500 && race == 'human'", true},
+		{"!(active || age <= 30) && name != \"Roman\"", true},
+		{"price * qty + 1.5 - -2 / 3 % 4", true},
+		{"balance >", false},
+		{"(balance > 1", false},
+		{"balance > 1)", false},
+		{"name == 'unterminated", false},
+		{"balance # 1", false},
+		{"1..2 > 0", false},
+		{"", false},
+	} {
+		expr, err := ParseExpr(tc.expr)
+		assert.Equal(t, tc.ok, err == nil, tc.expr)
+		if tc.ok {
+			assert.Equal(t, tc.expr, expr.String())
+		}
+	}
+}
+
+func TestWithExpr(t *testing.T) {
+	players := loadPlayers(500)
+	for _, tc := range []struct {
+		expr  string
+		count int
+	}{
+		{"balance >= 2501", 222},
+		{"race == 'human'", 138},
+		{"race == 'human' || race == 'elf' || race == 'dwarf'", 392},
+		{"!(race == 'human' || race == 'elf' || race == 'dwarf')", 108},
+		{"active", 247},
+		{"!active", 253},
+		{"balance >= 2501 && balance < 2501", 0},
+		{"balance * 2 >= 5002", 222},
+		{"name != ''", 500},
+		{"missing > 1", 0},
+		{"balance >", 0},
+	} {
+		players.Query(func(txn *Txn) error {
+			assert.Equal(t, tc.count, txn.WithExpr(tc.expr).Count(), tc.expr)
+			return nil
+		})
+	}
+
+	// Combined with other filters
+	players.Query(func(txn *Txn) error {
+		assert.Equal(t, 138, txn.With("human").WithExpr("race == 'human'").Count())
+		return nil
+	})
+}
+
+func TestEval(t *testing.T) {
+	players := loadPlayers(500)
+	players.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		return txn.Eval("balance * 2 + 1", func(idx uint32, value any) {
+			v, _ := balance.Get()
+			assert.Equal(t, v*2+1, value)
+		})
+	})
+
+	players.Query(func(txn *Txn) error {
+		count := 0
+		assert.NoError(t, txn.Eval("race == 'human' && age >= 30", func(idx uint32, value any) {
+			if value == true {
+				count++
+			}
+		}))
+		assert.Equal(t, txn.WithExpr("race == 'human' && age >= 30").Count(), count)
+		return nil
+	})
+
+	players.Query(func(txn *Txn) error {
+		assert.Error(t, txn.Eval("balance *", func(uint32, any) {}))
+		assert.Error(t, txn.Eval("missing * 2", func(uint32, any) {}))
+		return nil
+	})
+}
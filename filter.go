@@ -0,0 +1,255 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"math"
+)
+
+// Filter represents a composable filter description which can be marshaled to and from JSON,
+// for example to accept filters over an API boundary. Filters are built using F() for the
+// column comparisons, combined with And(), Or() and Not(), then applied using WithFilter().
+type Filter struct {
+	Op      string   `json:"op"`                // The operation of the filter
+	Column  string   `json:"column,omitempty"`  // The column for the comparisons
+	Value   any      `json:"value,omitempty"`   // The value for the comparisons
+	Values  []any    `json:"values,omitempty"`  // The values for the "in" and "near" operations
+	Filters []Filter `json:"filters,omitempty"` // The operands for the logical operations
+}
+
+// Field represents a column used to build a filter
+type Field string
+
+// F starts building a filter on the specified column
+func F(columnName string) Field {
+	return Field(columnName)
+}
+
+// Eq creates a filter which matches the rows where the column is equal to the value
+func (f Field) Eq(value any) Filter {
+	return Filter{Op: "eq", Column: string(f), Value: value}
+}
+
+// Ne creates a filter which matches the rows where the column is not equal to the value
+func (f Field) Ne(value any) Filter {
+	return Filter{Op: "ne", Column: string(f), Value: value}
+}
+
+// Lt creates a filter which matches the rows where the column is less than the value
+func (f Field) Lt(value any) Filter {
+	return Filter{Op: "lt", Column: string(f), Value: value}
+}
+
+// Lte creates a filter which matches the rows where the column is less than or equal to the value
+func (f Field) Lte(value any) Filter {
+	return Filter{Op: "lte", Column: string(f), Value: value}
+}
+
+// Gt creates a filter which matches the rows where the column is greater than the value
+func (f Field) Gt(value any) Filter {
+	return Filter{Op: "gt", Column: string(f), Value: value}
+}
+
+// Gte creates a filter which matches the rows where the column is greater than or equal to the value
+func (f Field) Gte(value any) Filter {
+	return Filter{Op: "gte", Column: string(f), Value: value}
+}
+
+// In creates a filter which matches the rows where the column is equal to one of the values
+func (f Field) In(values ...any) Filter {
+	return Filter{Op: "in", Column: string(f), Values: values}
+}
+
+// Near creates a filter which matches the rows where the column is within the epsilon of the
+// target, for the floats whose exact comparison would fail due to the rounding errors
+func (f Field) Near(target, epsilon float64) Filter {
+	return Filter{Op: "near", Column: string(f), Values: []any{target, epsilon}}
+}
+
+// Is creates a filter which matches the rows where a boolean column or an index is set
+func (f Field) Is() Filter {
+	return Filter{Op: "is", Column: string(f)}
+}
+
+// And combines the filter with other filters, matching the rows which match all of them
+func (f Filter) And(filters ...Filter) Filter {
+	return Filter{Op: "and", Filters: append([]Filter{f}, filters...)}
+}
+
+// Or combines the filter with other filters, matching the rows which match any of them
+func (f Filter) Or(filters ...Filter) Filter {
+	return Filter{Op: "or", Filters: append([]Filter{f}, filters...)}
+}
+
+// Not negates the filter, matching the rows which do not match it
+func (f Filter) Not() Filter {
+	return Filter{Op: "not", Filters: []Filter{f}}
+}
+
+// Validate checks whether the filter is well-formed, for example after unmarshaling it.
+func (f Filter) Validate() error {
+	_, err := f.compile()
+	return err
+}
+
+// WithFilter applies a logical AND operation between the current query and the rows which
+// match the filter. If the filter is invalid or refers to a column which does not exist,
+// the result is empty. Use Validate() to check the filter before using it.
+func (txn *Txn) WithFilter(filter Filter) *Txn {
+	txn.initialize()
+	txn.traceFilter(filter)
+	root, err := filter.compile()
+	if err != nil {
+		txn.index.Clear()
+		return txn
+	}
+
+	txn.useIndexes()
+	if err := txn.filterExpr(root); err != nil {
+		txn.index.Clear()
+	}
+	return txn
+}
+
+// compile compiles the filter into an expression tree
+func (f Filter) compile() (*node, error) {
+	switch f.Op {
+	case "and", "or":
+		if len(f.Filters) == 0 {
+			return nil, fmt.Errorf("column: filter '%s' requires at least one operand", f.Op)
+		}
+
+		op := map[string]string{"and": "&&", "or": "||"}[f.Op]
+		return compileAll(f.Filters, op)
+	case "not":
+		if len(f.Filters) != 1 {
+			return nil, fmt.Errorf("column: filter 'not' requires exactly one operand")
+		}
+
+		operand, err := f.Filters[0].compile()
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: nodeUnary, op: "!", left: operand}, nil
+	}
+
+	// The rest of the operations are on a column
+	if f.Column == "" {
+		return nil, fmt.Errorf("column: filter '%s' requires a column", f.Op)
+	}
+
+	field := &node{kind: nodeColumn, text: f.Column}
+	switch f.Op {
+	case "is":
+		return field, nil
+	case "in":
+		operands := make([]Filter, 0, len(f.Values))
+		for _, v := range f.Values {
+			operands = append(operands, F(f.Column).Eq(v))
+		}
+
+		if len(operands) == 0 {
+			return nil, fmt.Errorf("column: filter 'in' requires at least one value")
+		}
+		return compileAll(operands, "||")
+	case "near":
+		return compileNear(f)
+	}
+
+	op, ok := map[string]string{
+		"eq": "==", "ne": "!=", "lt": "<", "lte": "<=", "gt": ">", "gte": ">=",
+	}[f.Op]
+	if !ok {
+		return nil, fmt.Errorf("column: unsupported filter operation '%s'", f.Op)
+	}
+
+	value, err := literalOf(f.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &node{kind: nodeBinary, op: op, left: field, right: value}, nil
+}
+
+// compileNear compiles a "near" filter into the range between the target minus the epsilon
+// and the target plus the epsilon, both inclusive
+func compileNear(f Filter) (*node, error) {
+	if len(f.Values) != 2 {
+		return nil, fmt.Errorf("column: filter 'near' requires a target and an epsilon")
+	}
+
+	target, err := literalOf(f.Values[0])
+	if err != nil {
+		return nil, err
+	}
+
+	epsilon, err := literalOf(f.Values[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if target.kind != nodeNumber || epsilon.kind != nodeNumber {
+		return nil, fmt.Errorf("column: filter 'near' requires numeric values")
+	}
+
+	field, delta := &node{kind: nodeColumn, text: f.Column}, math.Abs(epsilon.num)
+	return &node{kind: nodeBinary, op: "&&",
+		left:  &node{kind: nodeBinary, op: ">=", left: field, right: &node{kind: nodeNumber, num: target.num - delta}},
+		right: &node{kind: nodeBinary, op: "<=", left: field, right: &node{kind: nodeNumber, num: target.num + delta}},
+	}, nil
+}
+
+// compileAll compiles the filters and combines them with a logical operator
+func compileAll(filters []Filter, op string) (*node, error) {
+	var root *node
+	for _, f := range filters {
+		operand, err := f.compile()
+		if err != nil {
+			return nil, err
+		}
+
+		if root == nil {
+			root = operand
+			continue
+		}
+		root = &node{kind: nodeBinary, op: op, left: root, right: operand}
+	}
+	return root, nil
+}
+
+// literalOf converts a value of a filter into a literal node
+func literalOf(value any) (*node, error) {
+	switch v := value.(type) {
+	case string:
+		return &node{kind: nodeString, text: v}, nil
+	case bool:
+		return &node{kind: nodeBool, text: fmt.Sprint(v)}, nil
+	case float64:
+		return &node{kind: nodeNumber, num: v}, nil
+	case float32:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case int:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case int8:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case int16:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case int32:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case int64:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case uint:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case uint8:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case uint16:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case uint32:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	case uint64:
+		return &node{kind: nodeNumber, num: float64(v)}, nil
+	default:
+		return nil, fmt.Errorf("column: unsupported filter value of type %T", value)
+	}
+}
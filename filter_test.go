@@ -0,0 +1,106 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFilter(t *testing.T) {
+	players := loadPlayers(500)
+	for _, tc := range []struct {
+		filter Filter
+		count  int
+	}{
+		{F("balance").Gte(2501), 222},
+		{F("balance").Lt(2501), 278},
+		{F("race").Eq("human"), 138},
+		{F("race").Ne("human"), 362},
+		{F("race").In("human", "elf", "dwarf"), 392},
+		{F("race").In("human", "elf", "dwarf").Not(), 108},
+		{F("human").Is(), 138},
+		{F("active").Is(), 247},
+		{F("active").Eq(true), 247},
+		{F("balance").Gte(2501).And(F("balance").Lt(2501)), 0},
+		{F("human").Is().Or(F("race").Eq("elf"), F("dwarf").Is()), 392},
+		{F("age").Gt(uint8(100)), 0},
+		{F("balance").Near(2501, 1000), 336},
+		{F("balance").Near(2501, -1000), 336},
+		{F("missing").Gt(1), 0},
+		{Filter{Op: "unknown"}, 0},
+	} {
+		players.Query(func(txn *Txn) error {
+			assert.Equal(t, tc.count, txn.WithFilter(tc.filter).Count(), tc.filter)
+			return nil
+		})
+	}
+
+	// Combined with other filters
+	var expect int
+	players.Query(func(txn *Txn) error {
+		expect = txn.With("human").WithValue("active", func(v any) bool {
+			return v == true
+		}).Count()
+		return nil
+	})
+
+	players.Query(func(txn *Txn) error {
+		assert.NotZero(t, expect)
+		assert.Equal(t, expect, txn.With("human").WithFilter(F("active").Is()).Count())
+		return nil
+	})
+}
+
+func TestFilterJSON(t *testing.T) {
+	filter := F("age").Gte(30).And(F("race").In("human", "elf"), F("active").Is().Not())
+	encoded, err := json.Marshal(filter)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"op":"and","filters":[`+
+		`{"op":"gte","column":"age","value":30},`+
+		`{"op":"in","column":"race","values":["human","elf"]},`+
+		`{"op":"not","filters":[{"op":"is","column":"active"}]}]}`, string(encoded))
+
+	// Decode the filter back, numbers become float64
+	var decoded Filter
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.NoError(t, decoded.Validate())
+
+	players := loadPlayers(500)
+	var expect int
+	players.Query(func(txn *Txn) error {
+		expect = txn.WithFilter(filter).Count()
+		return nil
+	})
+
+	players.Query(func(txn *Txn) error {
+		assert.NotZero(t, expect)
+		assert.Equal(t, expect, txn.WithFilter(decoded).Count())
+		return nil
+	})
+}
+
+func TestFilterValidate(t *testing.T) {
+	for _, f := range []Filter{
+		{Op: "and"},
+		{Op: "or"},
+		{Op: "not"},
+		{Op: "eq"},
+		{Op: "in", Column: "race"},
+		{Op: "eq", Column: "race"},
+		{Op: "eq", Column: "race", Value: []int{1}},
+		{Op: "like", Column: "race", Value: "human"},
+		{Op: "near", Column: "balance", Values: []any{1.0}},
+		{Op: "near", Column: "balance", Values: []any{"a", 1.0}},
+		{Op: "near", Column: "balance", Values: []any{1.0, "a"}},
+		{Op: "near", Column: "balance", Values: []any{1.0, true}},
+		F("race").Eq("human").And(Filter{Op: "gt"}),
+	} {
+		assert.Error(t, f.Validate(), f)
+	}
+
+	assert.NoError(t, F("race").Eq("human").Validate())
+}
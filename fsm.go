@@ -0,0 +1,148 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/kelindar/column/commit"
+)
+
+// FSM adapts a collection to the finite state machine of a raft log, such as the one of the
+// hashicorp/raft library, in order to run a replicated and consistent collection across several
+// nodes. The commits of the transactions executed on the leader are proposed to the log, and
+// every node applies the entries of the log by replaying their commits. Since this package does
+// not depend on any raft implementation, Apply() and Snapshot() need a thin wrapper in order to
+// satisfy the raft.FSM interface, while Restore() can be used as is.
+type FSM struct {
+	coll    *Collection
+	origin  uint64                  // The random identifier of the node which proposes the commits
+	propose func(data []byte) error // The function which proposes an entry to the log
+	next    commit.Logger           // The commit logger of the collection, if any
+}
+
+// NewFSM creates a state machine for the collection. If the propose function is specified,
+// typically calling raft.Apply() and waiting for its result, the state machine becomes the commit
+// logger of the collection and proposes every commit of this node to the log, while the previous
+// commit logger still receives them. The commits of the transactions which completed before are
+// not proposed, hence this should be called before any write.
+//
+// Since the transactions are executed before being proposed, the writes must only happen on the
+// leader. A proposal which fails, for example once the node is no longer the leader, does not
+// roll back the changes already applied on this node. The transaction returns the error instead,
+// so that the node can be restored from a snapshot of the cluster.
+func NewFSM(coll *Collection, propose func(data []byte) error) *FSM {
+	var origin [8]byte
+	rand.Read(origin[:])
+
+	coll.lock.Lock()
+	defer coll.lock.Unlock()
+	fsm := &FSM{
+		coll:    coll,
+		origin:  binary.BigEndian.Uint64(origin[:]),
+		propose: propose,
+		next:    coll.logger,
+	}
+
+	if propose != nil {
+		coll.logger = fsm
+	}
+	return fsm
+}
+
+// Append encodes the commit along with the identifier of this node and proposes it to the log.
+func (f *FSM) Append(change commit.Commit) error {
+	if f.next != nil {
+		if err := f.next.Append(change); err != nil {
+			return err
+		}
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 8, 64))
+	binary.BigEndian.PutUint64(buffer.Bytes(), f.origin)
+	if _, err := change.WriteTo(buffer); err != nil {
+		return err
+	}
+
+	return f.propose(buffer.Bytes())
+}
+
+// Apply applies the data of a committed log entry by replaying its commit on the collection,
+// and returns an error if the entry could not be applied. The entries proposed by this node
+// are skipped, since they were already applied when their transaction was committed.
+func (f *FSM) Apply(data []byte) any {
+	if len(data) < 8 {
+		return fmt.Errorf("column: unable to apply a log entry of %d bytes", len(data))
+	}
+
+	if binary.BigEndian.Uint64(data[:8]) == f.origin {
+		return nil
+	}
+
+	var change commit.Commit
+	if _, err := change.ReadFrom(bytes.NewReader(data[8:])); err != nil {
+		return fmt.Errorf("column: unable to apply a log entry, %w", err)
+	}
+
+	if err := validate(change); err != nil {
+		return err
+	}
+
+	if err := f.coll.validateTypes(change); err != nil {
+		return err
+	}
+
+	return f.coll.replay(change, f.next)
+}
+
+// Snapshot returns a snapshot of the state machine. This is not a point-in-time snapshot, since
+// the collection is only written once the snapshot is persisted and may therefore contain the
+// entries applied in the meantime, which are applied again after a restore. The entries which
+// put the values converge to the same state, but the merges of those entries, such as the ones
+// of the numeric columns, are then applied twice. The collections relying on merges must not be
+// written while the snapshot is persisted.
+func (f *FSM) Snapshot() (*FSMSnapshot, error) {
+	return &FSMSnapshot{coll: f.coll}, nil
+}
+
+// Restore restores the collection from a snapshot written by a state machine, discarding the
+// state of the columns it contains. Similarly to Collection.Restore(), the columns must be
+// created beforehand, since the snapshot does not contain the schema.
+func (f *FSM) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+	return f.coll.Restore(snapshot, func(v *restoreOptions) {
+		v.logger = f.next
+	})
+}
+
+// --------------------------- Snapshot ----------------------------
+
+// SnapshotSink represents the destination of a snapshot, such as raft.SnapshotSink
+type SnapshotSink interface {
+	io.WriteCloser
+	Cancel() error
+}
+
+// FSMSnapshot represents a snapshot of a state machine, which is written into a sink.
+type FSMSnapshot struct {
+	coll *Collection
+}
+
+// Persist writes the snapshot of the collection into the sink and closes it, or cancels the
+// sink if the snapshot has failed.
+func (s *FSMSnapshot) Persist(sink SnapshotSink) error {
+	if err := s.coll.Snapshot(sink); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+// Release releases the snapshot, which holds no resources.
+func (s *FSMSnapshot) Release() {}
@@ -0,0 +1,122 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/kelindar/column/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM(t *testing.T) {
+	leader := newEmpty(500)
+	follower := newEmpty(500)
+	followerFSM := NewFSM(follower, nil)
+
+	// The log applies every entry on all of the nodes, in order
+	var entries int
+	var leaderFSM *FSM
+	leaderFSM = NewFSM(leader, func(data []byte) error {
+		entries++
+		if err, ok := leaderFSM.Apply(data).(error); ok {
+			return err
+		}
+		if err, ok := followerFSM.Apply(data).(error); ok {
+			return err
+		}
+		return nil
+	})
+
+	assert.NoError(t, insertPlayers(leader, fixtures.Players()))
+	assert.NoError(t, leader.QueryAt(20, func(r Row) error {
+		r.MergeInt("age", 100)
+		return nil
+	}))
+	assert.True(t, leader.DeleteAt(10))
+
+	assert.NotZero(t, entries)
+	assert.Equal(t, leader.Count(), follower.Count())
+	assert.NoError(t, CheckInvariants(follower))
+	assert.NoError(t, follower.QueryAt(20, func(r Row) error {
+		age, _ := r.Int("age")
+		assert.Greater(t, age, 100)
+		return nil
+	}))
+
+	// The entries of the leader are not applied twice on its own collection
+	var age int
+	leader.QueryAt(20, func(r Row) error {
+		age, _ = r.Int("age")
+		return nil
+	})
+	follower.QueryAt(20, func(r Row) error {
+		v, _ := r.Int("age")
+		assert.Equal(t, age, v)
+		return nil
+	})
+
+	// Persist a snapshot of the leader and restore it on another node
+	snapshot, err := leaderFSM.Snapshot()
+	assert.NoError(t, err)
+	sink := &fsmSink{}
+	assert.NoError(t, snapshot.Persist(sink))
+	assert.True(t, sink.closed)
+	snapshot.Release()
+
+	other := newEmpty(500)
+	assert.NoError(t, NewFSM(other, nil).Restore(io.NopCloser(&sink.Buffer)))
+	assert.Equal(t, leader.Count(), other.Count())
+	assert.NoError(t, CheckInvariants(other))
+}
+
+func TestFSMMalformed(t *testing.T) {
+	fsm := NewFSM(newEmpty(500), nil)
+	assert.Error(t, fsm.Apply(nil).(error))
+	assert.Error(t, fsm.Apply([]byte{0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3}).(error))
+}
+
+func TestFSMProposeFailed(t *testing.T) {
+	errNotLeader := errors.New("not the leader")
+	coll := newEmpty(500)
+	NewFSM(coll, func(data []byte) error {
+		return errNotLeader
+	})
+
+	// The transaction reports the failed proposal, while its changes remain applied
+	err := coll.Query(func(txn *Txn) error {
+		_, err := txn.Insert(func(r Row) error {
+			r.SetString("name", "Merlin")
+			return nil
+		})
+		return err
+	})
+	assert.ErrorIs(t, err, errNotLeader)
+	assert.Equal(t, 1, coll.Count())
+
+	// The error is not carried over to the next transaction
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		return nil
+	}))
+}
+
+// fsmSink represents a snapshot sink which writes into memory
+type fsmSink struct {
+	bytes.Buffer
+	closed    bool
+	cancelled bool
+}
+
+func (s *fsmSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *fsmSink) Cancel() error {
+	s.cancelled = true
+	return nil
+}
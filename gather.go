@@ -0,0 +1,193 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// --------------------------- Scatter-Gather ----------------------------
+
+// Gather executes the query function on all of the collections concurrently, for example
+// on collections which are sharded manually. Each collection commits or rolls back its own
+// transaction, and the first error encountered is returned.
+func Gather(collections []*Collection, fn func(txn *Txn) error) error {
+	return gatherWith(collections, func(_ int, c *Collection) error {
+		return c.Query(fn)
+	})
+}
+
+// GatherCount counts the rows selected by the filter in all of the collections. The filter
+// is optional, in which case all of the rows are counted.
+func GatherCount(collections []*Collection, filter func(txn *Txn) *Txn) (int, error) {
+	var lock sync.Mutex
+	var count int
+	err := Gather(collections, func(txn *Txn) error {
+		if filter != nil {
+			txn = filter(txn)
+		}
+
+		n := txn.Count()
+		lock.Lock()
+		count += n
+		lock.Unlock()
+		return nil
+	})
+	return count, err
+}
+
+// GatherReduce computes an aggregation over a numeric column for the rows selected by the
+// filter in all of the collections, merging their partial results. The filter is optional.
+func GatherReduce(collections []*Collection, agg Aggregate, filter func(txn *Txn) *Txn) (float64, error) {
+	switch agg.Func {
+	case AggCount, AggSum, AggAvg, AggMin, AggMax:
+	default:
+		return 0, fmt.Errorf("column: unable to reduce, unsupported function")
+	}
+
+	if agg.Where != nil {
+		return 0, fmt.Errorf("column: unable to reduce, filtered aggregates are not supported")
+	}
+
+	var lock sync.Mutex
+	var total accumulator
+	err := Gather(collections, func(txn *Txn) error {
+		numeric, err := numericOf(txn, agg.Column)
+		if err != nil {
+			return err
+		}
+
+		if filter != nil {
+			txn = filter(txn)
+		}
+
+		var acc accumulator
+		txn.Range(func(idx uint32) {
+			if v, ok := numeric.LoadFloat64(idx); ok {
+				acc.add(v, 0)
+			}
+		})
+
+		lock.Lock()
+		total.merge(acc)
+		lock.Unlock()
+		return nil
+	})
+	return total.result(agg.Func), err
+}
+
+// Ranked represents a row ranked by the value of a numeric column.
+type Ranked struct {
+	Collection int     // The position of the collection in the list
+	Index      uint32  // The index of the row in the collection
+	Value      float64 // The value of the row
+}
+
+// GatherTop finds the n rows with the largest values of a numeric column, among the rows
+// selected by the filter in all of the collections. The rows are returned in descending
+// order of their value, ties being ordered by their collection and index.
+func GatherTop(collections []*Collection, columnName string, n int, filter func(txn *Txn) *Txn) ([]Ranked, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var lock sync.Mutex
+	merged := make(rankedHeap, 0, n*len(collections))
+	err := gatherWith(collections, func(i int, c *Collection) error {
+		return c.Query(func(txn *Txn) error {
+			numeric, err := numericOf(txn, columnName)
+			if err != nil {
+				return err
+			}
+
+			if filter != nil {
+				txn = filter(txn)
+			}
+
+			// Keep the top n rows of the collection in a min-heap
+			top := make(rankedHeap, 0, n)
+			txn.Range(func(idx uint32) {
+				v, ok := numeric.LoadFloat64(idx)
+				switch {
+				case !ok:
+				case len(top) < n:
+					heap.Push(&top, Ranked{Collection: i, Index: idx, Value: v})
+				case top.less(top[0], Ranked{Collection: i, Index: idx, Value: v}):
+					top[0] = Ranked{Collection: i, Index: idx, Value: v}
+					heap.Fix(&top, 0)
+				}
+			})
+
+			lock.Lock()
+			merged = append(merged, top...)
+			lock.Unlock()
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge the partial results, as each collection contains its own top n rows
+	sort.Slice(merged, func(i, j int) bool {
+		return merged.less(merged[j], merged[i])
+	})
+	if len(merged) > n {
+		merged = merged[:n]
+	}
+	return merged, nil
+}
+
+// gatherWith executes the function on all of the collections concurrently and returns
+// the first error encountered, in the order of the collections.
+func gatherWith(collections []*Collection, fn func(i int, c *Collection) error) error {
+	errs := make([]error, len(collections))
+	var wg sync.WaitGroup
+	for i, c := range collections {
+		wg.Add(1)
+		go func(i int, c *Collection) {
+			defer wg.Done()
+			errs[i] = fn(i, c)
+		}(i, c)
+	}
+
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --------------------------- Ranked Heap ----------------------------
+
+// rankedHeap represents a min-heap of ranked rows, the smallest rank being at the top
+type rankedHeap []Ranked
+
+// less returns whether the first row ranks lower than the second one
+func (h rankedHeap) less(a, b Ranked) bool {
+	switch {
+	case a.Value != b.Value:
+		return a.Value < b.Value
+	case a.Collection != b.Collection:
+		return a.Collection > b.Collection
+	default:
+		return a.Index > b.Index
+	}
+}
+
+func (h rankedHeap) Len() int           { return len(h) }
+func (h rankedHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h rankedHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *rankedHeap) Push(x any)        { *h = append(*h, x.(Ranked)) }
+func (h *rankedHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
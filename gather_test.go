@@ -0,0 +1,111 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGather(t *testing.T) {
+	collections := make([]*Collection, 3)
+	for i := range collections {
+		collections[i] = NewCollection()
+		collections[i].CreateColumn("active", ForBool())
+		collections[i].CreateColumn("score", ForFloat64())
+		defer collections[i].Close()
+
+		for j := 0; j < 10; j++ {
+			collections[i].Insert(func(r Row) error {
+				r.SetBool("active", j%2 == 0)
+				r.SetFloat64("score", float64(i*10+j))
+				return nil
+			})
+		}
+	}
+
+	active := func(txn *Txn) *Txn {
+		return txn.With("active")
+	}
+
+	// Count the rows across all of the collections
+	count, err := GatherCount(collections, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, count)
+
+	count, err = GatherCount(collections, active)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, count)
+
+	// Merge the aggregates of all of the collections
+	sum, err := GatherReduce(collections, Sum("score"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(435), sum)
+
+	min, err := GatherReduce(collections, Min("score"), active)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), min)
+
+	avg, err := GatherReduce(collections, Avg("score"), active)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(14), avg)
+
+	_, err = GatherReduce(collections, Sum("missing"), nil)
+	assert.Error(t, err)
+	_, err = GatherReduce(collections, Aggregate{Func: Aggregation(255), Column: "score"}, nil)
+	assert.Error(t, err)
+
+	// Find the top rows across all of the collections
+	top, err := GatherTop(collections, "score", 4, active)
+	assert.NoError(t, err)
+	assert.Equal(t, []Ranked{
+		{Collection: 2, Index: 8, Value: 28},
+		{Collection: 2, Index: 6, Value: 26},
+		{Collection: 2, Index: 4, Value: 24},
+		{Collection: 2, Index: 2, Value: 22},
+	}, top)
+
+	top, err = GatherTop(collections, "score", 0, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, top)
+
+	_, err = GatherTop(collections, "missing", 3, nil)
+	assert.Error(t, err)
+
+	// Queries are executed on every collection
+	assert.NoError(t, Gather(collections, func(txn *Txn) error {
+		score := txn.Float64("score")
+		return txn.Range(func(idx uint32) {
+			score.Set(1)
+		})
+	}))
+
+	// Ties are ordered by their collection and index
+	top, err = GatherTop(collections, "score", 3, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Ranked{
+		{Collection: 0, Index: 0, Value: 1},
+		{Collection: 0, Index: 1, Value: 1},
+		{Collection: 0, Index: 2, Value: 1},
+	}, top)
+
+	// The first error is returned, while other collections commit
+	err = Gather(collections, func(txn *Txn) error {
+		if txn.owner == collections[1] {
+			return fmt.Errorf("boom")
+		}
+
+		score := txn.Float64("score")
+		return txn.Range(func(idx uint32) {
+			score.Set(2)
+		})
+	})
+	assert.Error(t, err)
+
+	sum, err = GatherReduce(collections, Sum("score"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(50), sum)
+}
@@ -0,0 +1,15 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build !columndebug
+
+package column
+
+// readGuard detects the dirty reads within the callbacks, only in the debug mode.
+type readGuard struct{}
+
+// checkRead validates a point read of the column at the specified row
+func (txn *Txn) checkRead(column Column, idx uint32) {}
+
+// clearReads clears the dirty reads reported during a callback
+func (g *readGuard) clearReads() {}
@@ -0,0 +1,79 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build columndebug
+
+package column
+
+import (
+	"fmt"
+
+	"github.com/kelindar/column/commit"
+)
+
+// readGuard detects the dirty reads within the callbacks of Range() or QueryAt(). Since the
+// changes of a transaction are only applied once it is flushed or committed, a callback which
+// reads a value that was already modified by the transaction observes the previous value, for
+// example when a row is updated through QueryAt() before being visited by the same range.
+type readGuard struct {
+	reported map[string]struct{} // The columns for which a dirty read was reported
+}
+
+// checkRead validates a point read of the column at the specified row and reports it if
+// the transaction has pending changes for it. Each column is reported once per callback.
+func (txn *Txn) checkRead(column Column, idx uint32) {
+	if txn.callbacks == 0 {
+		return
+	}
+
+	name, ok := txn.nameOf(column)
+	if !ok || !txn.isPending(name, idx) {
+		return
+	}
+
+	if _, ok := txn.guard.reported[name]; ok {
+		return
+	}
+
+	if txn.guard.reported == nil {
+		txn.guard.reported = make(map[string]struct{})
+	}
+
+	txn.guard.reported[name] = struct{}{}
+	debugReport(fmt.Sprintf("column: dirty read of column '%s' at row %d within a callback, the pending "+
+		"changes of the transaction are not visible until it is flushed or committed, read at:\n%s",
+		name, idx, formatStack(callers())))
+}
+
+// nameOf finds the name of a column loaded by the transaction
+func (txn *Txn) nameOf(column Column) (string, bool) {
+	for _, v := range txn.columns {
+		if v.col.Column == column {
+			return v.name, true
+		}
+	}
+	return "", false
+}
+
+// isPending returns whether the transaction has a pending change of the column at the row
+func (txn *Txn) isPending(columnName string, idx uint32) bool {
+	for _, u := range txn.updates {
+		if u.Column != columnName {
+			continue
+		}
+
+		reader := commit.NewReader()
+		reader.Seek(u)
+		for reader.Next() {
+			if reader.Index() == idx {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clearReads clears the dirty reads reported during a callback
+func (g *readGuard) clearReads() {
+	g.reported = nil
+}
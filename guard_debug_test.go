@@ -0,0 +1,62 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build columndebug
+
+package column
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugDirtyRead(t *testing.T) {
+	players := loadPlayers(500)
+
+	// Reading the rows which were updated by a previous pass is reported once
+	reports := captureReports(func() {
+		players.Query(func(txn *Txn) error {
+			balance := txn.Float64("balance")
+			txn.Range(func(idx uint32) {
+				balance.Merge(1)
+			})
+
+			return txn.Range(func(idx uint32) {
+				balance.Get()
+			})
+		})
+	})
+
+	assert.Len(t, reports, 1)
+	assert.Contains(t, reports[0], "column: dirty read of column 'balance' at row 0")
+
+	// Reading a value after updating it within the same callback is reported
+	reports = captureReports(func() {
+		players.QueryAt(10, func(r Row) error {
+			r.SetString("name", "Roman")
+			r.String("name")
+			return nil
+		})
+	})
+
+	assert.Len(t, reports, 1)
+	assert.Contains(t, reports[0], "column: dirty read of column 'name' at row 10")
+
+	// Reading after a flush is not reported
+	reports = captureReports(func() {
+		players.Query(func(txn *Txn) error {
+			balance := txn.Float64("balance")
+			txn.Range(func(idx uint32) {
+				balance.Merge(1)
+			})
+
+			txn.Flush()
+			return txn.Range(func(idx uint32) {
+				balance.Get()
+			})
+		})
+	})
+
+	assert.Empty(t, reports)
+}
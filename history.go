@@ -0,0 +1,270 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+	"github.com/kelindar/iostream"
+)
+
+// historyPoints is the number of points of the history captured over the retention horizon
+const historyPoints = 8
+
+var errReadOnlyView = errors.New("column: unable to update a past version, it is read-only")
+
+// HistoryOptions represents the options of the history of the past versions of a collection.
+type HistoryOptions struct {
+	// Horizon is the retention horizon during which the past versions of the collection can
+	// be queried with ViewAt(). The history keeps a few encoded states over the horizon, along
+	// with every commit since the oldest one.
+	Horizon time.Duration
+
+	// Schema creates the columns on the views of the past versions, since the columns are not
+	// part of the history.
+	Schema func(*Collection) error
+}
+
+// merge merges the options specified on top of the current ones, ignoring the zero values.
+func (o *HistoryOptions) merge(other HistoryOptions) {
+	if other.Horizon > 0 {
+		o.Horizon = other.Horizon
+	}
+	if other.Schema != nil {
+		o.Schema = other.Schema
+	}
+}
+
+// enabled returns whether the history is kept
+func (o HistoryOptions) enabled() bool {
+	return o.Horizon > 0
+}
+
+// ViewAt executes a read-only query on the collection as of a past version, as returned by
+// the Version of a QueryInfo(), for debugging and reproducible reports. The version must be
+// within the History.Horizon of the collection, and the view is built with History.Schema,
+// since the columns are not part of the history. The view contains every commit up to and
+// including the version, and any attempt to update it fails without applying any changes.
+func (c *Collection) ViewAt(version uint64, fn func(txn *Txn) error) error {
+	schema := c.options().History.Schema
+	if !c.options().History.enabled() || schema == nil {
+		return fmt.Errorf("column: unable to view version %d, history is not enabled", version)
+	}
+
+	point, changes, ok := c.history.at(version)
+	if !ok {
+		return fmt.Errorf("column: unable to view version %d, beyond the retention horizon", version)
+	}
+
+	view := NewCollection(Options{Capacity: c.options().Capacity, Vacuum: -1})
+	defer view.Close()
+	if err := schema(view); err != nil {
+		return err
+	}
+
+	// Restore the point of the history, then replay the subsequent commits up to the version
+	commits, _, err := view.readState(point.reader())
+	if err != nil {
+		return err
+	}
+
+	options := *view.options()
+	options.Vacuum = -1
+	view.configure(options)
+	for _, change := range changes {
+		if change.ID > commits[change.Chunk] && change.ID <= version {
+			// The commit is cloned, since the buffers replayed are released once applied
+			if err := view.replay(change.Clone(), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	summary, err := view.DryRun(fn)
+	switch {
+	case err != nil:
+		return err
+	case summary.Inserted > 0 || summary.Deleted > 0 || len(summary.Columns) > 0:
+		return errReadOnlyView
+	default:
+		return nil
+	}
+}
+
+// recordHistory captures a new point of the history if enough time has passed since the last
+// one and the collection has changed, then forgets the points beyond the retention horizon.
+// This is called periodically by the vacuum.
+func (c *Collection) recordHistory(now time.Time) {
+	horizon := c.options().History.Horizon
+	if horizon <= 0 {
+		return
+	}
+
+	if c.history.due(now, horizon/historyPoints) {
+		c.captureHistory(now)
+	}
+	c.history.prune(now.Add(-horizon))
+}
+
+// resetHistory forgets the entire history and captures the current state as its first point,
+// if the history is enabled.
+func (c *Collection) resetHistory() {
+	c.history.reset()
+	if c.options().History.enabled() {
+		c.captureHistory(time.Now())
+	}
+}
+
+// captureHistory captures the current state of the collection as a point of the history, by
+// encoding each of its chunks.
+func (c *Collection) captureHistory(now time.Time) {
+	buffer := c.txns.acquirePage(rowColumn)
+	defer c.txns.releasePage(buffer)
+
+	// The commits recorded from now on may not be part of the point
+	point := &historyPoint{created: now, from: c.history.next()}
+
+	// Encode the header, without the bitmaps of the indexes
+	header := bytes.NewBuffer(nil)
+	revision := atomic.LoadUint64(&c.revision)
+	indexes, _ := c.indexDefs(false)
+	if err := c.writeHeader(iostream.NewWriter(header), indexes, 0); err != nil {
+		return
+	}
+
+	point.header = header.Bytes()
+	chunks := c.chunks()
+	for chunk := commit.Chunk(0); int(chunk) < chunks; chunk++ {
+		if err := c.readChunk(chunk, func(lastCommit uint64, chunk commit.Chunk, fill bitmap.Bitmap) error {
+			if lastCommit > point.version {
+				point.version = lastCommit
+			}
+
+			encoded := bytes.NewBuffer(nil)
+			err := c.writeChunk(iostream.NewWriter(encoded), buffer, nil, lastCommit, chunk, fill)
+			point.chunks = append(point.chunks, encoded.Bytes())
+			return err
+		}); err != nil {
+			return
+		}
+	}
+
+	// The point is discarded if the columns have changed in the meantime
+	if atomic.LoadUint64(&c.revision) == revision {
+		c.history.append(point)
+	}
+}
+
+// --------------------------- History ----------------------------
+
+// historyPoint represents the encoded state of the collection at a point of its history
+type historyPoint struct {
+	created time.Time // The time at which the point was captured
+	version uint64    // The last commit applied on any of the chunks
+	from    uint64    // The sequence of the first commit which may not be part of the point
+	header  []byte    // The encoded header of the state
+	chunks  [][]byte  // The encoded state of each chunk
+}
+
+// reader returns a reader over the encoded state of the point, without copying it
+func (p *historyPoint) reader() io.Reader {
+	readers := make([]io.Reader, 0, len(p.chunks)+2)
+	readers = append(readers, bytes.NewReader(p.header))
+	readers = append(readers, bytes.NewReader(binary.AppendUvarint(nil, uint64(len(p.chunks)))))
+	for _, v := range p.chunks {
+		readers = append(readers, bytes.NewReader(v))
+	}
+	return io.MultiReader(readers...)
+}
+
+// history represents the points of the history of a collection, along with the commits
+// recorded since the oldest point, so that any version after it can be rebuilt.
+type history struct {
+	lock   sync.Mutex
+	points []*historyPoint // The points, ordered by time
+	log    []commit.Commit // The commits recorded since the oldest point
+	start  uint64          // The sequence of the first commit of the log
+}
+
+// record records a commit of the collection, this must be called while holding the write
+// lock of the chunk so that the points capture the chunks consistently.
+func (h *history) record(change commit.Commit) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.log = append(h.log, change.Clone())
+}
+
+// next returns the sequence of the next recorded commit
+func (h *history) next() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.start + uint64(len(h.log))
+}
+
+// due returns whether a new point should be captured
+func (h *history) due(now time.Time, interval time.Duration) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.points) == 0 {
+		return true
+	}
+
+	last := h.points[len(h.points)-1]
+	return now.Sub(last.created) >= interval && h.start+uint64(len(h.log)) > last.from
+}
+
+// append appends a point to the history
+func (h *history) append(point *historyPoint) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.points = append(h.points, point)
+}
+
+// prune forgets the points which are no longer needed to rebuild the versions committed
+// after the cutoff, along with the commits recorded before the oldest remaining point.
+func (h *history) prune(cutoff time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for len(h.points) > 1 && !h.points[1].created.After(cutoff) {
+		h.points[0] = nil
+		h.points = h.points[1:]
+	}
+
+	if len(h.points) > 0 && h.points[0].from > h.start {
+		n := h.points[0].from - h.start
+		h.log = append([]commit.Commit(nil), h.log[n:]...)
+		h.start += n
+	}
+}
+
+// reset forgets the entire history
+func (h *history) reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.start += uint64(len(h.log))
+	h.points = nil
+	h.log = nil
+}
+
+// at returns the latest point which does not contain any commit after the version, along with
+// the commits recorded since that point.
+func (h *history) at(version uint64) (*historyPoint, []commit.Commit, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i := len(h.points) - 1; i >= 0; i-- {
+		if point := h.points[i]; point.version <= version {
+			return point, h.log[point.from-h.start:], true
+		}
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,193 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewAt(t *testing.T) {
+	schema := func(c *Collection) error {
+		c.CreateColumn("name", ForString())
+		c.CreateColumn("balance", ForInt64())
+		return nil
+	}
+
+	coll := NewCollection(Options{
+		Vacuum: -1,
+		History: HistoryOptions{
+			Horizon: time.Hour,
+			Schema:  schema,
+		},
+	})
+	schema(coll)
+
+	// Insert a few rows and update them, keeping the version of each commit
+	v1, err := coll.QueryInfo(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetString("name", fmt.Sprintf("player-%d", i))
+				r.SetInt64("balance", 10)
+				return nil
+			})
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	v2, err := coll.QueryInfo(func(txn *Txn) error {
+		return txn.Range(func(idx uint32) {
+			txn.Int64("balance").Merge(5)
+		})
+	})
+	assert.NoError(t, err)
+
+	// Capture a point of the history, then delete some of the rows
+	now := time.Now().Add(10 * time.Minute)
+	coll.recordHistory(now)
+	v3, err := coll.QueryInfo(func(txn *Txn) error {
+		return txn.Range(func(idx uint32) {
+			if idx%2 == 0 {
+				txn.DeleteAt(idx)
+			}
+		})
+	})
+	assert.NoError(t, err)
+
+	view := func(version uint64) (count int, sum int64) {
+		assert.NoError(t, coll.ViewAt(version, func(txn *Txn) error {
+			count = txn.Count()
+			sum = txn.Int64("balance").Sum()
+			return nil
+		}))
+		return
+	}
+
+	count, sum := view(v1.Version)
+	assert.Equal(t, 100, count)
+	assert.Equal(t, int64(1000), sum)
+
+	count, sum = view(v2.Version)
+	assert.Equal(t, 100, count)
+	assert.Equal(t, int64(1500), sum)
+
+	count, sum = view(v3.Version)
+	assert.Equal(t, 50, count)
+	assert.Equal(t, int64(750), sum)
+
+	// Before the first commit, the collection was empty
+	count, _ = view(v1.Version - 1)
+	assert.Equal(t, 0, count)
+
+	// The views are read-only
+	assert.Equal(t, errReadOnlyView, coll.ViewAt(v3.Version, func(txn *Txn) error {
+		txn.DeleteAll()
+		return nil
+	}))
+
+	// The versions beyond the horizon are forgotten
+	coll.recordHistory(now.Add(2 * time.Hour))
+	assert.Error(t, coll.ViewAt(v1.Version, func(txn *Txn) error {
+		return nil
+	}))
+	count, _ = view(v3.Version)
+	assert.Equal(t, 50, count)
+}
+
+func TestViewAtChunks(t *testing.T) {
+	schema := func(c *Collection) error {
+		return c.CreateColumn("value", ForInt())
+	}
+
+	coll := NewCollection(Options{
+		Vacuum: -1,
+		History: HistoryOptions{
+			Horizon: time.Hour,
+			Schema:  schema,
+		},
+	})
+	schema(coll)
+
+	for i := 0; i < 20000; i++ {
+		coll.Insert(func(r Row) error {
+			r.SetInt("value", 1)
+			return nil
+		})
+	}
+
+	// Every chunk is encoded into the point of the history
+	coll.recordHistory(time.Now().Add(time.Hour))
+	coll.history.lock.Lock()
+	point := coll.history.points[len(coll.history.points)-1]
+	coll.history.lock.Unlock()
+	assert.Len(t, point.chunks, 2)
+
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		return txn.QueryAt(0, func(r Row) error {
+			r.SetInt("value", 100)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, coll.ViewAt(info.Version-1, func(txn *Txn) error {
+		assert.Equal(t, 20000, txn.Int("value").Sum())
+		return nil
+	}))
+	assert.NoError(t, coll.ViewAt(info.Version, func(txn *Txn) error {
+		assert.Equal(t, 20099, txn.Int("value").Sum())
+		return nil
+	}))
+}
+
+func TestViewAtRepeated(t *testing.T) {
+	schema := func(c *Collection) error {
+		return c.CreateColumn("value", ForInt())
+	}
+
+	coll := NewCollection(Options{
+		Vacuum: -1,
+		History: HistoryOptions{
+			Horizon: time.Hour,
+			Schema:  schema,
+		},
+	})
+	schema(coll)
+
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetInt("value", 1)
+				return nil
+			})
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Replaying the commits must not consume the history
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, coll.ViewAt(info.Version, func(txn *Txn) error {
+			assert.Equal(t, 100, txn.Count())
+			assert.Equal(t, 100, txn.Int("value").Sum())
+			return nil
+		}))
+	}
+}
+
+func TestViewAtDisabled(t *testing.T) {
+	coll := NewCollection(Options{Vacuum: -1})
+	assert.Error(t, coll.ViewAt(1, func(txn *Txn) error {
+		return nil
+	}))
+
+	// A schema is required to build the views
+	coll = NewCollection(Options{Vacuum: -1, History: HistoryOptions{Horizon: time.Hour}})
+	assert.Error(t, coll.ViewAt(1, func(txn *Txn) error {
+		return nil
+	}))
+}
@@ -0,0 +1,165 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"time"
+)
+
+// IngestOptions represents the options of an ingestion pipeline
+type IngestOptions struct {
+	BatchSize int                 // The maximum number of objects per transaction, defaults to 1000
+	Interval  time.Duration       // The interval between the reports, defaults to one second
+	OnReport  func(s IngestStats) // The function receiving the reports (optional)
+}
+
+// IngestStats represents the progress of an ingestion pipeline
+type IngestStats struct {
+	Ingested   int           // The total number of objects ingested
+	Batches    int           // The total number of transactions committed
+	Pending    int           // The number of objects waiting in the channel
+	Lag        time.Duration // The time between receiving the last batch and its commit
+	Throughput float64       // The number of objects ingested per second, since the last report
+}
+
+// Ingest inserts the objects received on the channel until it is closed. The objects which
+// are already waiting in the channel are batched together into a single transaction, so the
+// batches grow with the load while the latency remains low when the load is light. Since the
+// channel is not read while a batch is being committed, the producers are blocked once the
+// channel is full, which provides the backpressure.
+//
+// The fields of the objects which do not correspond to a writable column are ignored. If the
+// collection has a primary key, each object must contain its key as a string and is upserted.
+// When an object fails to be inserted, its batch is rolled back and the ingestion stops.
+func (c *Collection) Ingest(ch <-chan map[string]any, opts IngestOptions) (IngestStats, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+
+	var stats IngestStats
+	batch := make([]map[string]any, 0, opts.BatchSize)
+	lastReport, lastCount := time.Now(), 0
+	for first := range ch {
+		start := time.Now()
+		batch = append(batch[:0], first)
+
+		// Drain the objects which are already waiting, without blocking
+	drain:
+		for len(batch) < opts.BatchSize {
+			select {
+			case object, ok := <-ch:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, object)
+			default:
+				break drain
+			}
+		}
+
+		if err := c.Query(func(txn *Txn) error {
+			return txn.ingest(batch)
+		}); err != nil {
+			return stats, err
+		}
+
+		stats.Ingested += len(batch)
+		stats.Batches++
+		stats.Lag = time.Since(start)
+		if now := time.Now(); now.Sub(lastReport) >= opts.Interval {
+			stats.report(opts.OnReport, len(ch), lastCount, now.Sub(lastReport))
+			lastReport, lastCount = now, stats.Ingested
+		}
+	}
+
+	stats.report(opts.OnReport, 0, lastCount, time.Since(lastReport))
+	return stats, nil
+}
+
+// report updates the statistics and sends them to the callback, if specified
+func (s *IngestStats) report(fn func(IngestStats), pending, lastCount int, elapsed time.Duration) {
+	s.Pending = pending
+	if elapsed > 0 {
+		s.Throughput = float64(s.Ingested-lastCount) / elapsed.Seconds()
+	}
+
+	if fn != nil {
+		fn(*s)
+	}
+}
+
+// converter represents a column which converts the values to its own type
+type converter interface {
+	convert(value any) any
+}
+
+// ingest inserts a batch of objects within the transaction. If an object fails, the indices
+// reserved by the batch are released since the transaction is rolled back.
+func (txn *Txn) ingest(batch []map[string]any) error {
+	keys := make(map[string]uint32)
+	for _, object := range batch {
+		if err := txn.ingestObject(object, keys); err != nil {
+			inserted, _ := txn.findMarkedRows()
+			inserted.Range(txn.owner.free)
+			return err
+		}
+	}
+	return nil
+}
+
+// ingestObject inserts or upserts a single object within the transaction. Since the keys
+// are only indexed on commit, the keys inserted by the batch are tracked separately.
+func (txn *Txn) ingestObject(object map[string]any, keys map[string]uint32) error {
+	fn := func(r Row) error {
+		for name, value := range object {
+			if txn.owner.pk != nil && name == txn.owner.pk.name {
+				continue
+			}
+
+			column, ok := txn.columnAt(name)
+			if !ok || column.IsIndex() || column.IsReadOnly() {
+				continue
+			}
+
+			// The numbers may be of a different type, such as float64 when decoded from JSON
+			if c, ok := column.Column.(converter); ok {
+				value = c.convert(value)
+			}
+
+			if err := r.txn.Any(name).Set(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if txn.owner.pk == nil {
+		_, err := txn.Insert(fn)
+		return err
+	}
+
+	key, ok := object[txn.owner.pk.name].(string)
+	if !ok {
+		return fmt.Errorf("column: unable to ingest an object without a key '%s'", txn.owner.pk.name)
+	}
+
+	if idx, ok := keys[key]; ok {
+		return txn.QueryAt(idx, fn)
+	}
+	if idx, ok := txn.owner.pk.OffsetOf(key); ok {
+		return txn.QueryAt(idx, fn)
+	}
+	if _, err := txn.keyParts(key); err != nil {
+		return err
+	}
+
+	idx, err := txn.insert(fn, 0)
+	txn.putKey(idx, key)
+	keys[key] = idx
+	return err
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngest(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("name", ForString())
+	coll.CreateColumn("age", ForInt())
+	coll.CreateColumn("score", ForPacked())
+	coll.CreateIndex("old", "age", func(r Reader) bool {
+		return r.Int() >= 50
+	})
+
+	ch := make(chan map[string]any, 64)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 10000; i++ {
+			ch <- map[string]any{
+				"name":    fmt.Sprintf("player-%d", i),
+				"age":     float64(i % 100), // as decoded from JSON
+				"score":   i,
+				"unknown": true,
+			}
+		}
+	}()
+
+	var reports []IngestStats
+	stats, err := coll.Ingest(ch, IngestOptions{
+		BatchSize: 100,
+		OnReport: func(s IngestStats) {
+			reports = append(reports, s)
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10000, stats.Ingested)
+	assert.GreaterOrEqual(t, stats.Batches, 100)
+	assert.Greater(t, stats.Throughput, float64(0))
+	assert.NotEmpty(t, reports)
+	assert.Equal(t, 10000, coll.Count())
+
+	// The numbers are converted to the type of their column
+	assert.NoError(t, coll.QueryAt(142, func(r Row) error {
+		name, _ := r.String("name")
+		age, _ := r.Int("age")
+		score, _ := r.Packed("score")
+		assert.Equal(t, "player-142", name)
+		assert.Equal(t, 42, age)
+		assert.Equal(t, int64(142), score)
+		return nil
+	}))
+
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		assert.Equal(t, 5000, txn.With("old").Count())
+		return nil
+	}))
+}
+
+func TestIngestKey(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("id", ForKey())
+	coll.CreateColumn("balance", ForFloat64())
+
+	ch := make(chan map[string]any, 10)
+	for i := 0; i < 10; i++ {
+		ch <- map[string]any{"id": fmt.Sprint(i % 5), "balance": i}
+	}
+	close(ch)
+
+	// The objects with the same key are upserted
+	stats, err := coll.Ingest(ch, IngestOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, stats.Ingested)
+	assert.Equal(t, 5, coll.Count())
+	assert.NoError(t, coll.QueryKey("3", func(r Row) error {
+		balance, _ := r.Float64("balance")
+		assert.Equal(t, float64(8), balance)
+		return nil
+	}))
+
+	// The batch of an invalid object is rolled back
+	ch = make(chan map[string]any, 2)
+	ch <- map[string]any{"id": "10", "balance": 1}
+	ch <- map[string]any{"balance": 2}
+	close(ch)
+
+	_, err = coll.Ingest(ch, IngestOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, 5, coll.Count())
+}
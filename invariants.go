@@ -0,0 +1,196 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// maxViolations is the maximum number of violations reported by CheckInvariants()
+const maxViolations = 10
+
+// CheckInvariants verifies the internal consistency of a collection, for use in the tests
+// and after Restore() or Replay(). It checks that the count matches the fill list, that the
+// columns only contain values for the rows which exist, that the bitmap indexes match their
+// recomputed predicates and that the lookup table of the primary key matches its column.
+// The check holds the read locks of the entire collection while it runs.
+func CheckInvariants(c *Collection) error {
+	var check invariants
+	if err := c.QueryWith(ReadSnapshot, func(txn *Txn) error {
+		c.lock.RLock()
+		fill := c.fill.Clone(nil)
+		count := atomic.LoadUint64(&c.count)
+		c.lock.RUnlock()
+
+		if actual := uint64(fill.Count()); count != actual {
+			check.report("count is %d but the fill list contains %d rows", count, actual)
+		}
+
+		check.columns(c, fill)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return check.err()
+}
+
+// invariants represents the violations found while checking a collection
+type invariants struct {
+	count      int      // The number of violations
+	violations []string // The first violations found
+}
+
+// report records a violation
+func (v *invariants) report(format string, args ...any) {
+	if v.count++; len(v.violations) < maxViolations {
+		v.violations = append(v.violations, fmt.Sprintf(format, args...))
+	}
+}
+
+// err returns an error describing the violations, or nil if there are none
+func (v *invariants) err() error {
+	if v.count == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("column: %d invariant violation(s) found: %s",
+		v.count, strings.Join(v.violations, "; "))
+}
+
+// columns checks the columns of the collection along with their computed columns
+func (v *invariants) columns(c *Collection, fill bitmap.Bitmap) {
+	chunks := c.chunks()
+	entries := c.cols.cols.Load().([]columnEntry)
+	for _, entry := range entries {
+		columns, ok := c.cols.LoadWithIndex(entry.name)
+		if !ok {
+			continue
+		}
+
+		// Every value of a column must belong to an existing row
+		main := columns[0]
+		for chunk := commit.Chunk(0); int(chunk) < chunks; chunk++ {
+			rows := chunk.OfBitmap(fill)
+			main.Index(chunk).Range(func(x uint32) {
+				if !rows.Contains(x) {
+					v.report("column '%s' has a value at row %d which does not exist", main.name, chunk.Min()+x)
+				}
+			})
+		}
+
+		switch column := main.Column.(type) {
+		case *columnKey:
+			v.key(main.name, column, chunks)
+		case *columnDerived:
+			v.derived(c, main.name, column, chunks)
+		}
+
+		for _, computed := range columns[1:] {
+			if index, ok := computed.Column.(*columnIndex); ok && !main.IsIndex() {
+				v.index(main, computed.name, index, chunks)
+			}
+		}
+	}
+}
+
+// index checks that a bitmap index matches its predicate, recomputed on the values of its column
+func (v *invariants) index(main *column, indexName string, index *columnIndex, chunks int) {
+	expect := &columnIndex{
+		fill: make(bitmap.Bitmap, 0, 4),
+		name: index.name,
+		rule: index.rule,
+		cols: index.cols,
+	}
+
+	buffer := commit.NewBuffer(0)
+	reader := commit.NewReader()
+	for chunk := commit.Chunk(0); int(chunk) < chunks; chunk++ {
+		if main.Snapshot(chunk, buffer) {
+			reader.Seek(buffer)
+			expect.Apply(chunk, reader)
+		}
+
+		// The pending rows of an asynchronous index are not compared, as they may be stale
+		expected, actual := expect.Index(chunk), index.Index(chunk)
+		if index.async != nil {
+			index.async.lock.Lock()
+			pending := chunk.OfBitmap(index.async.pending)
+			expected, actual = expected.Clone(nil), actual.Clone(nil)
+			expected.AndNot(pending)
+			actual.AndNot(pending)
+			index.async.lock.Unlock()
+		}
+
+		v.compare(indexName, chunk, expected, actual)
+	}
+}
+
+// derived checks that a derived index matches its expression, evaluated on every row which
+// has a value in one of the source columns
+func (v *invariants) derived(c *Collection, indexName string, index *columnDerived, chunks int) {
+	for chunk := commit.Chunk(0); int(chunk) < chunks; chunk++ {
+		var expect bitmap.Bitmap
+		for _, columnName := range index.sources {
+			if source, ok := c.cols.Load(columnName); ok {
+				source.Index(chunk).Range(func(x uint32) {
+					if index.expr.eval(chunk.Min() + x) {
+						expect.Set(x)
+					}
+				})
+			}
+		}
+
+		v.compare(indexName, chunk, expect, index.Index(chunk))
+	}
+}
+
+// compare reports the rows which differ between the expected and the actual index of a chunk
+func (v *invariants) compare(indexName string, chunk commit.Chunk, expect, actual bitmap.Bitmap) {
+	expect.Range(func(x uint32) {
+		if !actual.Contains(x) {
+			v.report("index '%s' is missing row %d", indexName, chunk.Min()+x)
+		}
+	})
+
+	actual.Range(func(x uint32) {
+		if !expect.Contains(x) {
+			v.report("index '%s' contains row %d which does not match", indexName, chunk.Min()+x)
+		}
+	})
+}
+
+// key checks that the lookup table of a primary key matches the values of its column
+func (v *invariants) key(columnName string, key *columnKey, chunks int) {
+	key.lock.RLock()
+	defer key.lock.RUnlock()
+
+	values := 0
+	for chunk := commit.Chunk(0); int(chunk) < chunks && int(chunk) < len(key.chunks); chunk++ {
+		fill, data := key.chunkAt(chunk)
+		fill.Range(func(x uint32) {
+			values++
+			idx, ok := key.seek[data[x]]
+			switch {
+			case !ok:
+				v.report("key '%s' of column '%s' is missing from the lookup table", data[x], columnName)
+			case idx != chunk.Min()+x:
+				v.report("key '%s' of column '%s' is at row %d but the lookup table points to row %d",
+					data[x], columnName, chunk.Min()+x, idx)
+			}
+		})
+	}
+
+	if len(key.seek) != values {
+		v.report("column '%s' has %d keys but the lookup table contains %d", columnName, values, len(key.seek))
+	}
+	if key.keys.Len() != len(key.seek) {
+		v.report("column '%s' has %d ordered keys but the lookup table contains %d", columnName, key.keys.Len(), len(key.seek))
+	}
+}
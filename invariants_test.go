@@ -0,0 +1,66 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckInvariants(t *testing.T) {
+	players := loadPlayers(500)
+	assert.NoError(t, players.CreateDerivedIndex("young-human", And("human", Not("old"))))
+	players.Query(func(txn *Txn) error {
+		return txn.With("mage").Range(func(idx uint32) {
+			txn.DeleteAt(idx)
+		})
+	})
+	assert.NoError(t, CheckInvariants(players))
+
+	// Restored collections are consistent
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, players.Snapshot(buffer))
+	clone := newEmpty(500)
+	assert.NoError(t, clone.Restore(buffer))
+	assert.NoError(t, CheckInvariants(clone))
+
+	// An index which does not match its predicate
+	old, _ := players.cols.Load("old")
+	first, _ := old.Column.(*columnIndex).fill.Min()
+	old.Column.(*columnIndex).fill.Remove(first)
+
+	// A value for a row which does not exist
+	var deleted uint32
+	for players.fill.Contains(deleted) {
+		deleted++
+	}
+
+	age, _ := players.cols.Load("age")
+	age.Column.(*numericColumn[int]).chunks[0].fill.Set(deleted)
+
+	err := CheckInvariants(players)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("index 'old' is missing row %d", first))
+	assert.Contains(t, err.Error(), fmt.Sprintf("column 'age' has a value at row %d", deleted))
+}
+
+func TestCheckInvariantsKey(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("id", ForKey())
+	coll.InsertKey("a", func(r Row) error { return nil })
+	coll.InsertKey("b", func(r Row) error { return nil })
+	assert.NoError(t, CheckInvariants(coll))
+
+	// The lookup table points to the wrong row
+	coll.pk.seek["a"] = 1
+	assert.ErrorContains(t, CheckInvariants(coll), "key 'a' of column 'id' is at row 0")
+
+	// The lookup table contains a key which is not in the column
+	coll.pk.seek["a"] = 0
+	coll.pk.seek["c"] = 2
+	assert.ErrorContains(t, CheckInvariants(coll), "has 2 keys but the lookup table contains 3")
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sync"
+)
+
+// keyLocks represents the advisory locks of the keys, which are only kept while they are
+// held or awaited.
+type keyLocks struct {
+	lock  sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock represents the advisory lock of a single key
+type keyLock struct {
+	sync.Mutex
+	refs int // The number of holders and waiters
+}
+
+// LockKey acquires an advisory lock on the key and returns the function which releases it,
+// blocking until the lock is available. This allows to serialize the workflows which span
+// several transactions on the same entity, for example to read a row, compute a new value
+// externally and write it back, without blocking the other keys. The locks are advisory: they
+// only exclude the other callers of LockKey() and do not prevent any transaction from reading
+// or writing the row. The key does not need to exist in the collection.
+func (c *Collection) LockKey(key string) (unlock func()) {
+	c.keyLocks.lock.Lock()
+	if c.keyLocks.locks == nil {
+		c.keyLocks.locks = make(map[string]*keyLock)
+	}
+
+	l, ok := c.keyLocks.locks[key]
+	if !ok {
+		l = new(keyLock)
+		c.keyLocks.locks[key] = l
+	}
+	l.refs++
+	c.keyLocks.lock.Unlock()
+
+	l.Lock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Unlock()
+			c.keyLocks.lock.Lock()
+			if l.refs--; l.refs == 0 {
+				delete(c.keyLocks.locks, key)
+			}
+			c.keyLocks.lock.Unlock()
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockKey(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("key", ForKey())
+	c.CreateColumn("balance", ForInt())
+	assert.NoError(t, c.InsertKey("merlin", func(r Row) error {
+		r.SetInt("balance", 0)
+		return nil
+	}))
+
+	// Read, compute and write back in separate transactions
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := c.LockKey("merlin")
+			defer unlock()
+
+			var balance int
+			c.QueryKey("merlin", func(r Row) error {
+				balance, _ = r.Int("balance")
+				return nil
+			})
+
+			c.QueryKey("merlin", func(r Row) error {
+				r.SetInt("balance", balance+1)
+				return nil
+			})
+		}()
+	}
+
+	wg.Wait()
+	assert.NoError(t, c.QueryKey("merlin", func(r Row) error {
+		balance, _ := r.Int("balance")
+		assert.Equal(t, 50, balance)
+		return nil
+	}))
+
+	// Other keys are not blocked and the locks are released
+	unlock := c.LockKey("merlin")
+	c.LockKey("arthur")()
+	unlock()
+	unlock()
+	assert.Empty(t, c.keyLocks.locks)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// isPseudo returns whether the column is a pseudo-column maintained by the collection, such
+// as the lifecycle metadata of the rows. The pseudo-columns can be read and filtered like the
+// regular columns, but they are not part of the schema and can not be updated.
+func isPseudo(columnName string) bool {
+	return strings.HasPrefix(columnName, pseudoPrefix)
+}
+
+// lifecycleStamp represents the rows of a commit whose lifecycle metadata is stamped
+type lifecycleStamp struct {
+	now      int64         // The time of the commit, in unix nanoseconds
+	inserted bitmap.Bitmap // The rows inserted by the commit
+	updated  bitmap.Bitmap // The rows inserted or updated by the commit
+}
+
+// lifecycleStamp finds the rows of the transaction whose lifecycle metadata is stamped. The
+// metadata restored by a system transaction, for example from a snapshot, is kept as is.
+func (txn *Txn) lifecycleStamp() *lifecycleStamp {
+	stamp := new(lifecycleStamp)
+	stamp.now = time.Now().UnixNano()
+	stamp.inserted, stamp.updated = txn.findChanges()
+	for _, u := range txn.updates {
+		var rows *bitmap.Bitmap
+		switch u.Column {
+		case versionColumn:
+			rows = &stamp.updated
+		case createdColumn:
+			rows = &stamp.inserted
+		default:
+			continue
+		}
+
+		txn.reader.Seek(u)
+		for txn.reader.Next() {
+			rows.Remove(txn.reader.Index())
+		}
+	}
+	return stamp
+}
+
+// commitLifecycle stamps the lifecycle pseudo-columns of the rows changed in a chunk. The
+// version is the ID of the commit being applied on the chunk, which must be called while
+// holding its lock, so that it matches the versions reported by QueryInfo() and ViewAt().
+func (txn *Txn) commitLifecycle(reader *commit.Reader, chunk commit.Chunk, commitID uint64, stamp *lifecycleStamp) {
+	txn.stampChunk(reader, chunk, versionColumn, stamp.updated, func(b *commit.Buffer, idx uint32) {
+		b.PutUint64(commit.Put, idx, commitID)
+	})
+	txn.stampChunk(reader, chunk, createdColumn, stamp.inserted, func(b *commit.Buffer, idx uint32) {
+		b.PutInt64(commit.Put, idx, stamp.now)
+	})
+}
+
+// stampChunk applies a value on the rows of a chunk directly onto a column and its indexes.
+// Since the pseudo-columns are not part of the commit, each collection stamps them as it
+// applies the commits, including the replicas.
+func (txn *Txn) stampChunk(reader *commit.Reader, chunk commit.Chunk, columnName string, rows bitmap.Bitmap, put func(*commit.Buffer, uint32)) {
+	columns, ok := txn.owner.cols.LoadWithIndex(columnName)
+	if !ok || len(columns) == 0 {
+		return
+	}
+
+	buffer := txn.owner.txns.acquirePage(columnName)
+	defer txn.owner.txns.releasePage(buffer)
+	chunk.Range(rows, func(idx uint32) {
+		put(buffer, idx)
+	})
+
+	if buffer.IsEmpty() {
+		return
+	}
+
+	// Apply the values on the column first, and then on its indexes
+	reader.Range(buffer, chunk, func(r *commit.Reader) {
+		columns[0].Apply(chunk, r)
+	})
+	if len(columns) > 1 {
+		reader.Range(buffer, chunk, func(r *commit.Reader) {
+			for _, v := range columns[1:] {
+				v.Apply(chunk, r)
+			}
+		})
+	}
+	txn.owner.changes.mark(columnName, chunk)
+}
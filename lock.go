@@ -0,0 +1,22 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build !columndebug
+
+package column
+
+import (
+	"sync"
+
+	"github.com/kelindar/smutex"
+)
+
+// collectionLock represents the lock which guards the fill list of the collection.
+type collectionLock struct {
+	sync.RWMutex
+}
+
+// chunkLock represents the sharded lock which guards the chunks of the collection.
+type chunkLock struct {
+	smutex.SMutex128
+}
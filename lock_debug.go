@@ -0,0 +1,233 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build columndebug
+
+package column
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/kelindar/smutex"
+)
+
+// The debug mode is enabled with the "columndebug" build tag. In this mode, every lock of
+// the collection is tracked per goroutine in order to detect the acquisitions which may
+// deadlock, as well as the locks which are held for too long. The locks must be acquired
+// in the following order: the chunk locks in ascending order, then the collection lock. The
+// locks are tracked per instance, so that the locks of different collections are not mixed up,
+// and each violation is only reported once per pair of call sites.
+var (
+	debugHoldLimit = time.Second           // The duration after which a hold is reported
+	debugReport    = func(report string) { // The function which reports the violations
+		log.Print(report)
+	}
+)
+
+// collectionLock represents the lock which guards the fill list of the collection.
+type collectionLock struct {
+	sync.RWMutex
+}
+
+// Lock locks the collection for writing
+func (l *collectionLock) Lock() {
+	debugAcquire(unsafe.Pointer(l), lockCollection, 0)
+	l.RWMutex.Lock()
+}
+
+// Unlock unlocks the collection for writing
+func (l *collectionLock) Unlock() {
+	l.RWMutex.Unlock()
+	debugRelease(unsafe.Pointer(l), lockCollection, 0)
+}
+
+// RLock locks the collection for reading
+func (l *collectionLock) RLock() {
+	debugAcquire(unsafe.Pointer(l), lockCollection, 0)
+	l.RWMutex.RLock()
+}
+
+// RUnlock unlocks the collection for reading
+func (l *collectionLock) RUnlock() {
+	l.RWMutex.RUnlock()
+	debugRelease(unsafe.Pointer(l), lockCollection, 0)
+}
+
+// chunkLock represents the sharded lock which guards the chunks of the collection.
+type chunkLock struct {
+	smutex.SMutex128
+}
+
+// Lock locks the shard for writing
+func (l *chunkLock) Lock(shard uint) {
+	debugAcquire(unsafe.Pointer(l), lockChunk, shard%lockShards)
+	l.SMutex128.Lock(shard)
+}
+
+// Unlock unlocks the shard for writing
+func (l *chunkLock) Unlock(shard uint) {
+	l.SMutex128.Unlock(shard)
+	debugRelease(unsafe.Pointer(l), lockChunk, shard%lockShards)
+}
+
+// RLock locks the shard for reading
+func (l *chunkLock) RLock(shard uint) {
+	debugAcquire(unsafe.Pointer(l), lockChunk, shard%lockShards)
+	l.SMutex128.RLock(shard)
+}
+
+// RUnlock unlocks the shard for reading
+func (l *chunkLock) RUnlock(shard uint) {
+	l.SMutex128.RUnlock(shard)
+	debugRelease(unsafe.Pointer(l), lockChunk, shard%lockShards)
+}
+
+// --------------------------- Tracking ----------------------------
+
+// lockKind represents the kind of a tracked lock
+type lockKind uint8
+
+const (
+	lockChunk lockKind = iota
+	lockCollection
+)
+
+// heldLock represents a lock held by a goroutine
+type heldLock struct {
+	lock  unsafe.Pointer // The instance of the lock
+	kind  lockKind       // The kind of the lock
+	shard uint           // The shard of a chunk lock
+	since time.Time      // The time at which the lock was acquired
+	stack []uintptr      // The call stack of the acquisition
+}
+
+// String returns a description of the lock
+func (l heldLock) String() string {
+	if l.kind == lockCollection {
+		return "the collection lock"
+	}
+	return fmt.Sprintf("the chunk lock (shard %d)", l.shard)
+}
+
+// debugLocks tracks the locks held by each goroutine, along with the violations reported
+var debugLocks = struct {
+	sync.Mutex
+	held     map[uint64][]heldLock
+	reported map[string]struct{}
+}{
+	held:     make(map[uint64][]heldLock),
+	reported: make(map[string]struct{}),
+}
+
+// debugAcquire validates the order of a lock acquisition and starts tracking it
+func debugAcquire(instance unsafe.Pointer, kind lockKind, shard uint) {
+	gid := goroutine()
+	lock := heldLock{lock: instance, kind: kind, shard: shard, since: time.Now(), stack: callers()}
+
+	debugLocks.Lock()
+	held := debugLocks.held[gid]
+	debugLocks.held[gid] = append(held, lock)
+	debugLocks.Unlock()
+
+	// Check the acquisition against all of the locks held by the goroutine. The chunks of
+	// different collections are independent, hence only ordered within the same instance.
+	for _, h := range held {
+		switch {
+		case h.lock == instance && h.kind == kind && h.shard == shard:
+			reportViolation(fmt.Sprintf("acquiring %v recursively", lock), lock, h)
+		case h.kind == lockCollection:
+			reportViolation(fmt.Sprintf("acquiring %v while holding %v", lock, h), lock, h)
+		case h.lock == instance && kind == lockChunk && h.shard > shard:
+			reportViolation(fmt.Sprintf("acquiring %v while holding %v", lock, h), lock, h)
+		}
+	}
+}
+
+// debugRelease stops tracking a lock and reports it if it was held for too long
+func debugRelease(instance unsafe.Pointer, kind lockKind, shard uint) {
+	gid := goroutine()
+
+	debugLocks.Lock()
+	held, found := debugLocks.held[gid], heldLock{}
+	for i := len(held) - 1; i >= 0; i-- {
+		if h := held[i]; h.lock == instance && h.kind == kind && h.shard == shard {
+			found, held = h, append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+
+	if len(held) == 0 {
+		delete(debugLocks.held, gid)
+	} else {
+		debugLocks.held[gid] = held
+	}
+	debugLocks.Unlock()
+
+	// Report the lock if it was held for too long
+	if duration := time.Since(found.since); found.stack != nil && duration > debugHoldLimit {
+		debugReport(fmt.Sprintf("column: %v was held for %v, acquired at:\n%s",
+			found, duration, formatStack(found.stack)))
+	}
+}
+
+// reportViolation reports a lock ordering violation, along with the stacks of all goroutines.
+// The violations are only reported once for each pair of call sites, since a violation in a
+// loop would otherwise be reported on every iteration.
+func reportViolation(reason string, lock, held heldLock) {
+	key := fmt.Sprint(lock.kind, held.kind, lock.stack, held.stack)
+	debugLocks.Lock()
+	_, seen := debugLocks.reported[key]
+	debugLocks.reported[key] = struct{}{}
+	debugLocks.Unlock()
+	if seen {
+		return
+	}
+
+	stacks := make([]byte, 1<<20)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	debugReport(fmt.Sprintf("column: lock ordering violation, %s\n\n%v was acquired at:\n%s\n\ngoroutines:\n%s",
+		reason, held, formatStack(held.stack), stacks))
+}
+
+// goroutine returns the identifier of the current goroutine
+func goroutine() uint64 {
+	var buffer [64]byte
+	stack := buffer[:runtime.Stack(buffer[:], false)]
+
+	// The stack starts with "goroutine <id> [status]:"
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		stack = stack[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
+
+// callers returns the call stack of the lock acquisition, which is only formatted if reported
+func callers() []uintptr {
+	var pcs [32]uintptr
+	n := runtime.Callers(4, pcs[:])
+	return append([]uintptr(nil), pcs[:n]...)
+}
+
+// formatStack formats a call stack, one frame per line
+func formatStack(stack []uintptr) string {
+	var out strings.Builder
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&out, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			return out.String()
+		}
+	}
+}
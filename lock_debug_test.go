@@ -0,0 +1,161 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+//go:build columndebug
+
+package column
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugLockOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fn     func(c *Collection)
+		report string
+	}{
+		{"chunks then collection", func(c *Collection) {
+			c.slock.RLock(1)
+			c.slock.RLock(2)
+			c.lock.Lock()
+			c.lock.Unlock()
+			c.slock.RUnlock(2)
+			c.slock.RUnlock(1)
+		}, ""},
+		{"collection then chunk", func(c *Collection) {
+			c.lock.RLock()
+			c.slock.RLock(1)
+			c.slock.RUnlock(1)
+			c.lock.RUnlock()
+		}, "acquiring the chunk lock (shard 1) while holding the collection lock"},
+		{"chunks out of order", func(c *Collection) {
+			c.slock.Lock(2)
+			c.slock.Lock(1)
+			c.slock.Unlock(1)
+			c.slock.Unlock(2)
+		}, "acquiring the chunk lock (shard 1) while holding the chunk lock (shard 2)"},
+		{"recursive chunk", func(c *Collection) {
+			c.slock.RLock(130)
+			c.slock.RLock(2)
+			c.slock.RUnlock(2)
+			c.slock.RUnlock(130)
+		}, "acquiring the chunk lock (shard 2) recursively"},
+	} {
+		reports := captureReports(func() {
+			tc.fn(NewCollection())
+		})
+
+		if tc.report == "" {
+			assert.Empty(t, reports, tc.name)
+			continue
+		}
+
+		assert.Len(t, reports, 1, tc.name)
+		assert.Contains(t, reports[0], tc.report, tc.name)
+		assert.Contains(t, reports[0], "goroutines:", tc.name)
+	}
+}
+
+func TestDebugLockInstances(t *testing.T) {
+	a, b := NewCollection(), NewCollection()
+	reports := captureReports(func() {
+		a.slock.RLock(2)
+		b.slock.RLock(1)
+		b.slock.RLock(2)
+		b.slock.RUnlock(2)
+		b.slock.RUnlock(1)
+		a.slock.RUnlock(2)
+	})
+
+	assert.Empty(t, reports)
+}
+
+func TestDebugLockReportOnce(t *testing.T) {
+	players := NewCollection()
+	reports := captureReports(func() {
+		for i := 0; i < 10; i++ {
+			players.slock.Lock(2)
+			players.slock.Lock(1)
+			players.slock.Unlock(1)
+			players.slock.Unlock(2)
+		}
+	})
+
+	assert.Len(t, reports, 1)
+}
+
+func TestDebugLockHold(t *testing.T) {
+	limit := debugHoldLimit
+	debugHoldLimit = 10 * time.Millisecond
+	defer func() { debugHoldLimit = limit }()
+
+	reports := captureReports(func() {
+		players := loadPlayers(100)
+		players.QueryAt(0, func(r Row) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+	})
+
+	assert.Len(t, reports, 1)
+	assert.True(t, strings.HasPrefix(reports[0], "column: the chunk lock (shard 0) was held for"))
+}
+
+func TestDebugLockWorkload(t *testing.T) {
+	reports := captureReports(func() {
+		players := loadPlayers(500)
+		players.CreateIndex("rich", "balance", func(r Reader) bool {
+			return r.Float() > 3000
+		})
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				players.Query(func(txn *Txn) error {
+					return txn.With("rich").Range(func(idx uint32) {
+						txn.Float64("balance").Merge(1)
+					})
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				players.QueryWith(ReadSnapshot, func(txn *Txn) error {
+					txn.With("human").Count()
+					return nil
+				})
+			}
+		}()
+		wg.Wait()
+	})
+
+	assert.Empty(t, reports)
+}
+
+// captureReports captures the debug reports during the execution of the function
+func captureReports(fn func()) (reports []string) {
+	var lock sync.Mutex
+	report := debugReport
+	debugReport = func(v string) {
+		lock.Lock()
+		reports = append(reports, v)
+		lock.Unlock()
+	}
+
+	debugLocks.Lock()
+	debugLocks.reported = make(map[string]struct{})
+	debugLocks.Unlock()
+
+	defer func() { debugReport = report }()
+	fn()
+	return
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Logger represents a structured logger which receives the internal warnings of the
+// collections, such as the oversized commits, the contention of the chunk locks or the
+// index rebuilds. The arguments are alternating keys and values, hence a *slog.Logger
+// can be used directly. It is called synchronously, hence it should return quickly.
+type Logger interface {
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+}
+
+// loggerRef wraps the logger, since an atomic value requires a consistent type
+type loggerRef struct {
+	Logger
+}
+
+// logging is the logger configured with SetLogger()
+var logging atomic.Value
+
+// SetLogger sets the logger which receives the internal warnings of all of the collections,
+// unless a collection was created with its own Logging.Logger option. The logging is disabled
+// by default, or if the logger is nil.
+func SetLogger(l Logger) {
+	logging.Store(loggerRef{l})
+}
+
+// currentLogger returns the configured logger, or nil if the logging is disabled
+func currentLogger() Logger {
+	if v, ok := logging.Load().(loggerRef); ok {
+		return v.Logger
+	}
+	return nil
+}
+
+// warnings returns the logger of the collection, or the configured logger if none is set
+func (c *Collection) warnings() Logger {
+	if l := c.options().Logging.Logger; l != nil {
+		return l
+	}
+	return currentLogger()
+}
+
+// logCommit warns about the transactions whose commit is oversized
+func (txn *Txn) logCommit() {
+	l := txn.owner.warnings()
+	if l == nil {
+		return
+	}
+
+	size := 0
+	for _, u := range txn.updates {
+		size += u.Len()
+	}
+
+	if size >= txn.owner.options().Logging.LargeCommitSize {
+		l.Warn("column: large commit", "size", size, "chunks", txn.dirty.Count())
+	}
+}
+
+// logIndex reports that an index has been built on the existing rows
+func (c *Collection) logIndex(indexName string, start time.Time) {
+	if l := c.warnings(); l != nil {
+		l.Info("column: index built", "index", indexName, "duration", time.Since(start))
+	}
+}
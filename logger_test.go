@@ -0,0 +1,84 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Info(msg string, args ...any) {
+	l.log("INFO", msg, args)
+}
+
+func (l *testLogger) Warn(msg string, args ...any) {
+	l.log("WARN", msg, args)
+}
+
+func (l *testLogger) log(level, msg string, args []any) {
+	l.Lock()
+	defer l.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf("%s %s %v", level, msg, args[:2]))
+}
+
+func TestLogger(t *testing.T) {
+	log := new(testLogger)
+	players := loadPlayers(500, Options{
+		Logging: LoggingOptions{
+			Logger:          log,
+			LargeCommitSize: 100,
+			SlowLockWait:    time.Millisecond,
+		},
+	})
+
+	// A large commit, contending with a reader of the chunk
+	log.lines = nil
+	var wg sync.WaitGroup
+	wg.Add(1)
+	players.slock.RLock(0)
+	go func() {
+		defer wg.Done()
+		players.Query(func(txn *Txn) error {
+			return txn.Range(func(idx uint32) {
+				txn.Float64("balance").Set(1)
+			})
+		})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	players.slock.RUnlock(0)
+	wg.Wait()
+
+	// An index rebuild
+	assert.NoError(t, players.CreateIndex("broke", "balance", func(r Reader) bool {
+		return r.Float() < 10
+	}))
+
+	assert.Equal(t, []string{
+		"WARN column: large commit [size 4501]",
+		"WARN column: chunk lock contention [chunk 0]",
+		"INFO column: index built [index broke]",
+	}, log.lines)
+}
+
+func TestSetLogger(t *testing.T) {
+	log := new(testLogger)
+	SetLogger(log)
+	defer SetLogger(nil)
+
+	// The logger of the collection takes precedence
+	own := new(testLogger)
+	players := NewCollection(Options{Logging: LoggingOptions{Logger: own}})
+	assert.Equal(t, own, players.warnings())
+	assert.Equal(t, log, NewCollection().warnings())
+}
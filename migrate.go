@@ -0,0 +1,139 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sort"
+
+	"github.com/kelindar/column/commit"
+)
+
+// Migration represents an upgrade of the schema of a collection, which is applied when restoring
+// the snapshots written with an older schema version, so that the persisted data is not orphaned
+// when the columns are renamed or their encoding changes. The columns are referred to by their
+// name within the older schema, and the operations are applied in the order of the fields.
+type Migration struct {
+	Version uint64                                // The schema version produced by the migration
+	Drop    []string                              // The columns which were removed
+	Rename  map[string]string                     // The new name of each renamed column
+	Convert map[string]func(r *commit.Reader) any // The conversion of the encoded values of a column
+}
+
+// WithMigrations upgrades the snapshots written with an older SchemaVersion while restoring them.
+// The migrations whose version is greater than the schema version of the snapshot are applied
+// to each page of the snapshot and to the pending commits, in the ascending order of their
+// versions. The conversion functions read the value of each row in the older encoding from the
+// reader, for example with Int64() or String(), and return the value in the new encoding.
+func WithMigrations(migrations ...Migration) func(*restoreOptions) {
+	return func(v *restoreOptions) {
+		v.migrations = append(v.migrations, migrations...)
+	}
+}
+
+// migrator applies the migrations to the pages written with an older schema version
+type migrator struct {
+	steps  []Migration    // The migrations to apply, in ascending order
+	reader *commit.Reader // The reader used to convert the values
+}
+
+// newMigrator creates a migrator for the snapshots of the specified schema version, or returns
+// nil if none of the migrations applies.
+func newMigrator(schema uint64, migrations []Migration) *migrator {
+	var steps []Migration
+	for _, m := range migrations {
+		if m.Version > schema {
+			steps = append(steps, m)
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Version < steps[j].Version
+	})
+	return &migrator{
+		steps:  steps,
+		reader: commit.NewReader(),
+	}
+}
+
+// migrate upgrades a page, returning the page to use or nil if its column was dropped. If any of
+// the conversions applies, the values are converted into a new page.
+func (m *migrator) migrate(page *commit.Buffer) *commit.Buffer {
+	if m == nil {
+		return page
+	}
+
+	for _, step := range m.steps {
+		for _, name := range step.Drop {
+			if page.Column == name {
+				return nil
+			}
+		}
+
+		if name, ok := step.Rename[page.Column]; ok {
+			page.Column = name
+		}
+
+		if convert, ok := step.Convert[page.Column]; ok {
+			dst := commit.NewBuffer(page.Len())
+			dst.Reset(page.Column)
+			m.reader.Seek(page)
+			for m.reader.Next() {
+				switch m.reader.Type {
+				case commit.Insert, commit.Skip:
+					dst.PutOperation(m.reader.Type, m.reader.Index())
+				default:
+					dst.PutAny(m.reader.Type, m.reader.Index(), convert(m.reader))
+				}
+			}
+			page = dst
+		}
+	}
+	return page
+}
+
+// column returns the name of a column after the migrations, or false if the column was dropped
+// or its values are converted, since the type of the column is then unknown.
+func (m *migrator) column(name string) (string, bool) {
+	if m == nil {
+		return name, true
+	}
+
+	for _, step := range m.steps {
+		for _, dropped := range step.Drop {
+			if name == dropped {
+				return "", false
+			}
+		}
+
+		if renamed, ok := step.Rename[name]; ok {
+			name = renamed
+		}
+
+		if _, ok := step.Convert[name]; ok {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// migrateCommit upgrades the updates of a pending commit, dropping the removed columns
+func (m *migrator) migrateCommit(change commit.Commit) commit.Commit {
+	if m == nil {
+		return change
+	}
+
+	updates := make([]*commit.Buffer, 0, len(change.Updates))
+	for _, u := range change.Updates {
+		if page := m.migrate(u); page != nil {
+			updates = append(updates, page)
+		}
+	}
+
+	change.Updates = updates
+	return change
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kelindar/column/commit"
+	"github.com/klauspost/compress/s2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	older := NewCollection(Options{Storage: StorageOptions{SchemaVersion: 1}})
+	older.CreateColumn("name", ForString())
+	older.CreateColumn("age", ForInt())
+	older.CreateColumn("legacy", ForBool())
+	for i := 0; i < 20000; i++ {
+		older.Insert(func(r Row) error {
+			r.SetString("name", "Merlin")
+			r.SetInt("age", i%100)
+			r.SetBool("legacy", true)
+			return nil
+		})
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, older.Snapshot(buffer))
+
+	// The newer schema renamed the name and stores the age as a float
+	newer := NewCollection(Options{Storage: StorageOptions{SchemaVersion: 3}})
+	newer.CreateColumn("title", ForString())
+	newer.CreateColumn("age", ForFloat64())
+	assert.NoError(t, newer.Restore(buffer, WithMigrations(Migration{
+		Version: 3,
+		Convert: map[string]func(r *commit.Reader) any{
+			"age": func(r *commit.Reader) any {
+				return r.Float64() / 2
+			},
+		},
+	}, Migration{
+		Version: 2,
+		Drop:    []string{"legacy"},
+		Rename:  map[string]string{"name": "title"},
+		Convert: map[string]func(r *commit.Reader) any{
+			"age": func(r *commit.Reader) any {
+				return float64(r.Int64())
+			},
+		},
+	}, Migration{
+		Version: 1,
+		Drop:    []string{"age"},
+	})))
+
+	assert.Equal(t, 20000, newer.Count())
+	assert.NoError(t, newer.QueryAt(199, func(r Row) error {
+		title, _ := r.String("title")
+		age, _ := r.Float64("age")
+		assert.Equal(t, "Merlin", title)
+		assert.Equal(t, 49.5, age)
+		return nil
+	}))
+
+	_, ok := newer.cols.Load("legacy")
+	assert.False(t, ok)
+
+	// The snapshot records the newer schema version
+	buffer.Reset()
+	assert.NoError(t, newer.Snapshot(buffer))
+	_, header, err := NewCollection().readState(s2.NewReader(buffer))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), header.schema)
+}
+
+func TestMigrationsNotApplied(t *testing.T) {
+	assert.Nil(t, newMigrator(2, []Migration{{Version: 1}, {Version: 2}}))
+	assert.Nil(t, newMigrator(0, nil))
+
+	var m *migrator
+	page := commit.NewBuffer(10)
+	assert.Equal(t, page, m.migrate(page))
+}
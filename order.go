@@ -0,0 +1,61 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"math/rand"
+
+	"github.com/kelindar/column/commit"
+)
+
+// Order represents the order in which Range() and RangeRows() visit the selected rows
+type Order uint8
+
+const (
+	// OrderAscending visits the rows in the ascending order of their indexes. This is the
+	// default order, which is guaranteed to remain stable, for example for the pagination.
+	OrderAscending Order = iota
+
+	// OrderShuffled visits the rows in a pseudo-random order, both across and within the chunks,
+	// for example to spread the load of the requests issued for each row.
+	OrderShuffled
+)
+
+// WithOrder hints the order in which Range() and RangeRows() visit the selected rows. The
+// other iterations, such as RangeDelete() or First(), always visit them in ascending order.
+func WithOrder(order Order) Hint {
+	return func(h *hints) {
+		h.order = order
+	}
+}
+
+// rangeShuffled iterates over the rows of the index in a pseudo-random order until the function
+// returns false, while holding the read lock of the chunk being iterated.
+func (txn *Txn) rangeShuffled(f func(idx uint32) bool) {
+	random := rand.New(rand.NewSource(rand.Int63()))
+	limit := len(txn.index) >> bitmapShift
+	rows := make([]uint32, 0, 64)
+	for _, i := range random.Perm(limit + 1) {
+		chunk := commit.Chunk(i)
+		offset := chunk.Min()
+		rows = rows[:0]
+		chunk.OfBitmap(txn.index).Range(func(x uint32) {
+			rows = append(rows, offset+x)
+		})
+
+		random.Shuffle(len(rows), func(i, j int) {
+			rows[i], rows[j] = rows[j], rows[i]
+		})
+
+		txn.rlock(chunk)
+		for _, idx := range rows {
+			txn.cursor = idx
+			if !f(idx) {
+				txn.runlock(chunk)
+				return
+			}
+		}
+		txn.runlock(chunk)
+	}
+}
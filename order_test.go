@@ -0,0 +1,74 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrder(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("id", ForInt())
+	for i := 0; i < 20000; i++ {
+		c.Insert(func(r Row) error {
+			r.SetInt("id", i)
+			return nil
+		})
+	}
+
+	// The rows are visited in ascending order by default
+	var ascending, shuffled []uint32
+	c.Query(func(txn *Txn) error {
+		return txn.Hint(WithOrder(OrderAscending)).Range(func(idx uint32) {
+			ascending = append(ascending, idx)
+		})
+	})
+	assert.Len(t, ascending, 20000)
+	assert.True(t, sort.SliceIsSorted(ascending, func(i, j int) bool {
+		return ascending[i] < ascending[j]
+	}))
+
+	// The shuffled order visits every row exactly once
+	c.Query(func(txn *Txn) error {
+		id := txn.Int("id")
+		return txn.Hint(WithOrder(OrderShuffled)).Range(func(idx uint32) {
+			v, _ := id.Get()
+			assert.Equal(t, int(idx), v)
+			shuffled = append(shuffled, idx)
+		})
+	})
+	assert.Len(t, shuffled, 20000)
+	assert.NotEqual(t, ascending, shuffled)
+	sort.Slice(shuffled, func(i, j int) bool { return shuffled[i] < shuffled[j] })
+	assert.Equal(t, ascending, shuffled)
+
+	// The rows can also be shuffled and updated, until an error is returned
+	visited := 0
+	err := c.Query(func(txn *Txn) error {
+		return txn.Hint(WithOrder(OrderShuffled)).RangeRows(func(r Row) error {
+			if visited++; visited == 100 {
+				return fmt.Errorf("stop")
+			}
+			return nil
+		})
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 100, visited)
+
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		return txn.Hint(WithOrder(OrderShuffled)).RangeRows(func(r Row) error {
+			r.MergeInt("id", 1)
+			return nil
+		})
+	}))
+
+	c.Query(func(txn *Txn) error {
+		assert.Equal(t, 20000*20001/2, txn.Int("id").Sum())
+		return nil
+	})
+}
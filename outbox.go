@@ -0,0 +1,464 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kelindar/column/commit"
+	"github.com/kelindar/iostream"
+)
+
+// The backoff between the attempts to deliver a message, doubled after every failed attempt
+const (
+	outboxBackoff    = 10 * time.Millisecond
+	outboxMaxBackoff = 5 * time.Second
+)
+
+var errNoOutbox = errors.New("column: unable to enqueue a message, the outbox is not enabled")
+
+// EventOptions represents the sinks receiving the changes of each transaction of a collection.
+type EventOptions struct {
+	Audit  AuditSink // The sink receiving the audit records of each commit (optional)
+	Outbox Publisher // The publisher delivering the messages of each transaction (optional)
+}
+
+// merge merges the options specified on top of the current ones, ignoring the zero values.
+func (o *EventOptions) merge(other EventOptions) {
+	if other.Audit != nil {
+		o.Audit = other.Audit
+	}
+	if other.Outbox != nil {
+		o.Outbox = other.Outbox
+	}
+}
+
+// configureEvents starts delivering the outbox messages, or switches over to a new publisher
+func (c *Collection) configureEvents(options EventOptions) {
+	switch {
+	case options.Outbox != nil && c.outbox == nil:
+		c.outbox = newOutbox(options.Outbox)
+	case options.Outbox != nil:
+		c.outbox.setPublisher(options.Outbox)
+	}
+}
+
+// Publisher represents the destination of the outbox messages of a collection, such as a
+// message broker. A message is delivered once Publish returns without an error, otherwise
+// it is attempted again with an exponential backoff, and the next messages wait for it.
+type Publisher interface {
+	Publish(msg OutboxMessage) error
+}
+
+// OutboxMessage represents a message enqueued by a transaction, which is delivered to the
+// publisher once the transaction has committed. The messages are recorded in the commit log
+// and in the snapshots along with the changes, and the messages which may not have been
+// delivered are enqueued again when the collection is restored. A message may therefore be
+// delivered more than once, hence the consumers should discard the duplicates using its ID.
+type OutboxMessage struct {
+	ID      uint64 // The unique sequence of the message within the collection
+	Topic   string // The topic of the message
+	Payload []byte // The payload of the message
+	Version uint64 // The version of the commit which recorded the message
+}
+
+// Enqueue enqueues a message into the outbox of the collection, see the Events.Outbox option. The
+// message is delivered to the publisher only after the transaction has committed and its
+// changes are visible, while the messages of a transaction which rolls back are discarded,
+// even if some of its changes were flushed.
+func (txn *Txn) Enqueue(topic string, payload []byte) error {
+	if txn.owner.outbox == nil {
+		return errNoOutbox
+	}
+
+	txn.outbox = append(txn.outbox, OutboxMessage{
+		Topic:   topic,
+		Payload: append([]byte(nil), payload...),
+	})
+	return nil
+}
+
+// outboxChunk returns the chunk whose commit records the messages enqueued by the transaction,
+// which is the last chunk changed or the first one if nothing changed. The messages enqueued
+// before a flush are only recorded once the transaction completes.
+func (txn *Txn) outboxChunk() (commit.Chunk, bool) {
+	if len(txn.outbox) == 0 || txn.owner.outbox == nil || txn.flushed.active {
+		return 0, false
+	}
+
+	last, _ := txn.dirty.Max()
+	txn.dirty.Set(last)
+	return commit.Chunk(last), true
+}
+
+// recordOutbox reserves the messages enqueued by the transaction in the outbox and writes
+// them into the page recorded with the commit. This is called while the latch of the chunk is
+// held, so that the IDs of the messages follow the order in which the commits are applied.
+func (txn *Txn) recordOutbox(commitID uint64, chunk commit.Chunk) {
+	if txn.messages == nil {
+		txn.messages = commit.NewBuffer(0)
+	}
+
+	txn.messages.Reset(outboxColumn)
+	txn.owner.outbox.reserve(txn.outbox, commitID)
+	for _, msg := range txn.outbox {
+		txn.messages.PutBytes(commit.Put, chunk.Min(), encodeMessage(msg))
+	}
+}
+
+// releaseOutbox releases the messages reserved by the transaction once every chunk of its
+// commit was applied and published, or discards them if the commit did not complete.
+func (txn *Txn) releaseOutbox(deliver bool) {
+	if len(txn.outbox) > 0 && txn.outbox[0].ID > 0 {
+		txn.owner.outbox.release(txn.outbox[0].ID, deliver)
+	}
+	txn.outbox = txn.outbox[:0]
+}
+
+// recoverOutbox enqueues the messages recorded by a commit of the log which are not yet in the
+// outbox, when the collection is restored. Since the delivery is not recorded, the messages
+// which were delivered after the snapshot are delivered again.
+func (c *Collection) recoverOutbox(change commit.Commit) error {
+	if c.outbox == nil {
+		return nil
+	}
+
+	reader := commit.NewReader()
+	for _, u := range change.Updates {
+		if u.Column != outboxColumn {
+			continue
+		}
+
+		var messages []OutboxMessage
+		reader.Seek(u)
+		for reader.Next() {
+			msg, err := decodeMessage(reader.Bytes())
+			if err != nil {
+				return err
+			}
+			messages = append(messages, msg)
+		}
+		c.outbox.restore(0, messages)
+	}
+	return nil
+}
+
+// DrainOutbox waits until every message enqueued so far is delivered to the publisher, for
+// example before closing the collection, or until the context is cancelled.
+func (c *Collection) DrainOutbox(ctx context.Context) error {
+	if c.outbox == nil {
+		return nil
+	}
+
+	select {
+	case <-c.outbox.drained():
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("column: unable to drain the outbox, %w", ctx.Err())
+	}
+}
+
+// PendingMessages returns a copy of the messages which are not yet delivered to the publisher,
+// oldest first. This can be used to keep the undelivered messages once the collection is closed.
+func (c *Collection) PendingMessages() []OutboxMessage {
+	if c.outbox == nil {
+		return nil
+	}
+
+	c.outbox.lock.Lock()
+	defer c.outbox.lock.Unlock()
+	return append([]OutboxMessage(nil), c.outbox.queue...)
+}
+
+// --------------------------- Outbox ----------------------------
+
+// outbox represents the messages of the committed transactions which are pending delivery,
+// along with the goroutine delivering them to the publisher in order.
+type outbox struct {
+	lock      sync.Mutex
+	publisher Publisher       // The destination of the messages
+	queue     []OutboxMessage // The messages pending delivery, oldest first
+	held      []outboxRange   // The messages whose commits are still in progress
+	seq       uint64          // The sequence of the last message enqueued
+	idle      chan struct{}   // The channel which is closed while the queue is empty
+	wake      chan struct{}   // The signal that messages were enqueued
+	stop      chan struct{}   // The channel which is closed once the outbox is closed
+	once      sync.Once
+}
+
+// outboxRange represents the IDs of the messages reserved by a commit
+type outboxRange struct {
+	first, last uint64
+}
+
+// newOutbox creates a new outbox and starts delivering its messages to the publisher
+func newOutbox(publisher Publisher) *outbox {
+	o := &outbox{
+		publisher: publisher,
+		idle:      make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+
+	close(o.idle)
+	go o.run()
+	return o
+}
+
+// setPublisher replaces the publisher receiving the next messages
+func (o *outbox) setPublisher(publisher Publisher) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.publisher = publisher
+}
+
+// reserve appends the messages of a transaction being committed to the queue, assigning their
+// IDs and their version in place. The messages are held back until they are released, along
+// with the messages queued after them.
+func (o *outbox) reserve(messages []OutboxMessage, version uint64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.queue) == 0 {
+		o.idle = make(chan struct{})
+	}
+
+	for i := range messages {
+		o.seq++
+		messages[i].ID = o.seq
+		messages[i].Version = version
+		o.queue = append(o.queue, messages[i])
+	}
+	o.held = append(o.held, outboxRange{first: messages[0].ID, last: o.seq})
+}
+
+// release allows the delivery of the messages reserved starting at the specified ID, once their
+// commit has completed, or removes them from the queue if it did not.
+func (o *outbox) release(first uint64, deliver bool) {
+	o.lock.Lock()
+	for i, held := range o.held {
+		if held.first != first {
+			continue
+		}
+
+		o.held = append(o.held[:i], o.held[i+1:]...)
+		if !deliver {
+			o.discard(held)
+		}
+		break
+	}
+	o.lock.Unlock()
+	o.signal()
+}
+
+// discard removes a range of messages from the queue. Since the messages held back are never
+// delivered, none of them can be in flight.
+func (o *outbox) discard(held outboxRange) {
+	queue := o.queue[:0]
+	for _, msg := range o.queue {
+		if msg.ID < held.first || msg.ID > held.last {
+			queue = append(queue, msg)
+		}
+	}
+
+	for i := len(queue); i < len(o.queue); i++ {
+		o.queue[i] = OutboxMessage{}
+	}
+
+	if o.queue = queue; len(o.queue) == 0 {
+		o.queue = nil
+		close(o.idle)
+	}
+}
+
+// restore appends the restored messages which are not yet in the queue, and moves the sequence
+// past the specified one so that the IDs are not reused.
+func (o *outbox) restore(seq uint64, messages []OutboxMessage) {
+	o.lock.Lock()
+	for _, msg := range messages {
+		if msg.ID <= o.seq {
+			continue // Already enqueued
+		}
+
+		if len(o.queue) == 0 {
+			o.idle = make(chan struct{})
+		}
+		o.queue = append(o.queue, msg)
+		o.seq = msg.ID
+	}
+
+	if seq > o.seq {
+		o.seq = seq
+	}
+	o.lock.Unlock()
+	o.signal()
+}
+
+// signal wakes up the delivery, unless it was already signalled
+func (o *outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drained returns the channel which is closed once the queue is empty
+func (o *outbox) drained() <-chan struct{} {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.idle
+}
+
+// peek returns the oldest message pending delivery, along with the publisher, unless its
+// commit is still in progress.
+func (o *outbox) peek() (OutboxMessage, Publisher, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.queue) == 0 {
+		return OutboxMessage{}, nil, false
+	}
+
+	for _, held := range o.held {
+		if id := o.queue[0].ID; id >= held.first && id <= held.last {
+			return OutboxMessage{}, nil, false
+		}
+	}
+	return o.queue[0], o.publisher, true
+}
+
+// ack removes the oldest message once it was delivered
+func (o *outbox) ack() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.queue[0] = OutboxMessage{}
+	o.queue = o.queue[1:]
+	if len(o.queue) == 0 {
+		o.queue = nil
+		close(o.idle)
+	}
+}
+
+// run delivers the messages in order until the outbox is closed, attempting each message
+// again with an exponential backoff until the publisher accepts it.
+func (o *outbox) run() {
+	backoff := outboxBackoff
+	for {
+		msg, publisher, ok := o.peek()
+		if !ok {
+			select {
+			case <-o.wake:
+				continue
+			case <-o.stop:
+				return
+			}
+		}
+
+		if err := publisher.Publish(msg); err != nil {
+			select {
+			case <-time.After(backoff):
+			case <-o.stop:
+				return
+			}
+
+			if backoff *= 2; backoff > outboxMaxBackoff {
+				backoff = outboxMaxBackoff
+			}
+			continue
+		}
+
+		backoff = outboxBackoff
+		o.ack()
+	}
+}
+
+// close stops the delivery, the pending messages are kept
+func (o *outbox) close() {
+	o.once.Do(func() {
+		close(o.stop)
+	})
+}
+
+// --------------------------- Encoding ----------------------------
+
+// writeOutbox writes the sequence of the outbox along with the messages pending delivery
+func (c *Collection) writeOutbox(w *iostream.Writer) error {
+	var seq uint64
+	var pending []OutboxMessage
+	if c.outbox != nil {
+		c.outbox.lock.Lock()
+		seq, pending = c.outbox.seq, append(pending, c.outbox.queue...)
+		c.outbox.lock.Unlock()
+	}
+
+	if err := w.WriteUvarint(seq); err != nil {
+		return err
+	}
+
+	return w.WriteRange(len(pending), func(i int, w *iostream.Writer) error {
+		return w.WriteBytes(encodeMessage(pending[i]))
+	})
+}
+
+// readOutbox reads the messages pending delivery and restores them, if the outbox is enabled
+func (c *Collection) readOutbox(r *iostream.Reader) error {
+	seq, err := r.ReadUvarint()
+	if err != nil {
+		return err
+	}
+
+	var pending []OutboxMessage
+	if err := r.ReadRange(func(i int, r *iostream.Reader) error {
+		encoded, err := r.ReadBytes()
+		if err != nil {
+			return err
+		}
+
+		msg, err := decodeMessage(encoded)
+		pending = append(pending, msg)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if c.outbox != nil {
+		c.outbox.restore(seq, pending)
+	}
+	return nil
+}
+
+// encodeMessage encodes a message, as recorded in the commits and the snapshots
+func encodeMessage(msg OutboxMessage) []byte {
+	out := make([]byte, 0, 16+len(msg.Topic)+len(msg.Payload))
+	out = binary.AppendUvarint(out, msg.ID)
+	out = binary.AppendUvarint(out, msg.Version)
+	out = binary.AppendUvarint(out, uint64(len(msg.Topic)))
+	out = append(out, msg.Topic...)
+	return append(out, msg.Payload...)
+}
+
+// decodeMessage decodes a message encoded with encodeMessage()
+func decodeMessage(encoded []byte) (msg OutboxMessage, err error) {
+	errInvalid := fmt.Errorf("column: unable to restore, invalid outbox message")
+	var header [3]uint64
+	for i := range header {
+		v, n := binary.Uvarint(encoded)
+		if n <= 0 {
+			return msg, errInvalid
+		}
+		header[i], encoded = v, encoded[n:]
+	}
+
+	if header[2] > uint64(len(encoded)) {
+		return msg, errInvalid
+	}
+
+	msg.ID, msg.Version = header[0], header[1]
+	msg.Topic = string(encoded[:header[2]])
+	msg.Payload = append([]byte(nil), encoded[header[2]:]...)
+	return msg, nil
+}
@@ -0,0 +1,272 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kelindar/column/commit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	publisher := &mockPublisher{failures: 2}
+	coll := NewCollection(Options{Vacuum: -1, Events: EventOptions{Outbox: publisher}})
+	defer coll.Close()
+	coll.CreateColumn("name", ForString())
+
+	// The messages are delivered once the transaction commits
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		txn.Insert(func(r Row) error {
+			r.SetString("name", "merlin")
+			return nil
+		})
+		assert.NoError(t, txn.Enqueue("players", []byte("merlin")))
+		return txn.Enqueue("players", []byte("joined"))
+	})
+	assert.NoError(t, err)
+
+	// The messages of a transaction which rolls back are discarded
+	assert.Error(t, coll.Query(func(txn *Txn) error {
+		txn.Insert(func(r Row) error {
+			r.SetString("name", "morgana")
+			return nil
+		})
+		txn.Enqueue("players", []byte("morgana"))
+		return fmt.Errorf("boom")
+	}))
+
+	// The messages of a transaction without any changes are recorded in a commit as well
+	ping, err := coll.QueryInfo(func(txn *Txn) error {
+		return txn.Enqueue("ping", nil)
+	})
+	assert.NoError(t, err)
+	assert.NotZero(t, ping.Version)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, coll.DrainOutbox(ctx))
+	assert.Empty(t, coll.PendingMessages())
+
+	// The failed attempts are retried with the same message
+	messages := publisher.Messages()
+	assert.Len(t, messages, 5)
+	assert.Equal(t, messages[0], messages[1])
+	assert.Equal(t, messages[0], messages[2])
+	assert.Equal(t, []OutboxMessage{
+		{ID: 1, Topic: "players", Payload: []byte("merlin"), Version: info.Version},
+		{ID: 2, Topic: "players", Payload: []byte("joined"), Version: info.Version},
+		{ID: 3, Topic: "ping", Version: ping.Version},
+	}, messages[2:])
+}
+
+func TestOutboxFlush(t *testing.T) {
+	publisher := new(mockPublisher)
+	coll := NewCollection(Options{Vacuum: -1, Events: EventOptions{Outbox: publisher}})
+	defer coll.Close()
+	coll.CreateColumn("name", ForString())
+
+	// The messages enqueued before a flush wait for the transaction to complete
+	assert.Error(t, coll.Query(func(txn *Txn) error {
+		txn.Insert(func(r Row) error {
+			r.SetString("name", "merlin")
+			return nil
+		})
+		txn.Enqueue("players", []byte("merlin"))
+		assert.NoError(t, txn.Flush())
+		return fmt.Errorf("boom")
+	}))
+
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		txn.Enqueue("players", []byte("morgana"))
+		txn.Insert(func(r Row) error {
+			r.SetString("name", "morgana")
+			return nil
+		})
+		return txn.Flush()
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, coll.DrainOutbox(ctx))
+	assert.Equal(t, []OutboxMessage{
+		{ID: 1, Topic: "players", Payload: []byte("morgana"), Version: info.Version},
+	}, publisher.Messages())
+}
+
+func TestOutboxClosed(t *testing.T) {
+	publisher := &mockPublisher{failures: 1000}
+	coll := NewCollection(Options{Vacuum: -1, Events: EventOptions{Outbox: publisher}})
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		return txn.Enqueue("ping", []byte("hello"))
+	})
+	assert.NoError(t, err)
+
+	// The messages which can not be delivered are kept
+	coll.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, coll.DrainOutbox(ctx))
+	assert.Equal(t, []OutboxMessage{
+		{ID: 1, Topic: "ping", Payload: []byte("hello"), Version: info.Version},
+	}, coll.PendingMessages())
+
+	// The outbox must be enabled to enqueue messages
+	coll = NewCollection(Options{Vacuum: -1})
+	defer coll.Close()
+	assert.Equal(t, errNoOutbox, coll.Query(func(txn *Txn) error {
+		return txn.Enqueue("ping", nil)
+	}))
+	assert.NoError(t, coll.DrainOutbox(context.Background()))
+}
+
+func TestOutboxPublished(t *testing.T) {
+	writer := &versionWriter{delay: 20 * time.Millisecond}
+	publisher := &visiblePublisher{writer: writer}
+	coll := NewCollection(Options{Vacuum: -1, Writer: writer, Events: EventOptions{Outbox: publisher}})
+	defer coll.Close()
+	coll.CreateColumn("name", ForString())
+
+	// Insert rows spanning several chunks, the message is recorded along with the last one
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		for i := 0; i < 40000; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetString("name", "merlin")
+				return nil
+			})
+		}
+		return txn.Enqueue("players", []byte("merlin"))
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, coll.DrainOutbox(ctx))
+
+	// The message must only be delivered once its commit was published
+	assert.Equal(t, []bool{true}, publisher.Published())
+	assert.Equal(t, info.Version, publisher.version)
+}
+
+func TestOutboxRestore(t *testing.T) {
+	var log bytes.Buffer
+	input := NewCollection(Options{
+		Vacuum: -1,
+		Writer: commit.Open(&log),
+		Events: EventOptions{Outbox: &mockPublisher{failures: 1000}},
+	})
+	defer input.Close()
+	input.CreateColumn("name", ForString())
+
+	// A message pending at the time of the snapshot, then another one recorded in the log
+	enqueue := func(name string) {
+		assert.NoError(t, input.Query(func(txn *Txn) error {
+			txn.Insert(func(r Row) error {
+				r.SetString("name", name)
+				return nil
+			})
+			return txn.Enqueue("players", []byte(name))
+		}))
+	}
+
+	enqueue("merlin")
+	var snapshot bytes.Buffer
+	assert.NoError(t, input.Snapshot(&snapshot))
+	enqueue("morgana")
+
+	// The collection is restored along with every message which may not have been delivered
+	publisher := new(mockPublisher)
+	output := NewCollection(Options{Vacuum: -1, Events: EventOptions{Outbox: publisher}})
+	defer output.Close()
+	output.CreateColumn("name", ForString())
+	assert.NoError(t, output.Restore(io.MultiReader(&snapshot, &log)))
+	assert.Equal(t, 2, output.Count())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, output.DrainOutbox(ctx))
+	assert.Equal(t, input.PendingMessages(), publisher.Messages())
+
+	// The sequence continues after the restored messages
+	assert.NoError(t, output.Query(func(txn *Txn) error {
+		return txn.Enqueue("players", []byte("arthur"))
+	}))
+	assert.NoError(t, output.DrainOutbox(ctx))
+	assert.Equal(t, uint64(3), publisher.Messages()[2].ID)
+}
+
+// mockPublisher records every attempt to publish a message, failing the first ones
+type mockPublisher struct {
+	lock     sync.Mutex
+	failures int
+	messages []OutboxMessage
+}
+
+func (p *mockPublisher) Publish(msg OutboxMessage) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.messages = append(p.messages, msg)
+	if p.failures > 0 {
+		p.failures--
+		return fmt.Errorf("unavailable")
+	}
+	return nil
+}
+
+func (p *mockPublisher) Messages() []OutboxMessage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]OutboxMessage(nil), p.messages...)
+}
+
+// versionWriter records the versions of the commits appended, slowly
+type versionWriter struct {
+	lock     sync.Mutex
+	delay    time.Duration
+	versions map[uint64]bool
+}
+
+func (w *versionWriter) Append(change commit.Commit) error {
+	time.Sleep(w.delay)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.versions == nil {
+		w.versions = make(map[uint64]bool)
+	}
+	w.versions[change.ID] = true
+	return nil
+}
+
+// visiblePublisher records whether the commit of each message was already published
+type visiblePublisher struct {
+	lock      sync.Mutex
+	writer    *versionWriter
+	version   uint64
+	published []bool
+}
+
+func (p *visiblePublisher) Publish(msg OutboxMessage) error {
+	p.writer.lock.Lock()
+	published := p.writer.versions[msg.Version]
+	p.writer.lock.Unlock()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.version = msg.Version
+	p.published = append(p.published, published)
+	return nil
+}
+
+func (p *visiblePublisher) Published() []bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]bool(nil), p.published...)
+}
@@ -0,0 +1,223 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kelindar/column/commit"
+	"github.com/kelindar/simd"
+)
+
+// Overflow represents the behavior of the default merge of an integer column, which adds the
+// delta to the value, when the result does not fit into the type of the column.
+type Overflow uint8
+
+const (
+	// OverflowWrap wraps the result around, as the integer arithmetic of Go. This is the default.
+	OverflowWrap Overflow = iota
+
+	// OverflowSaturate clamps the result to the minimum or the maximum value of the type.
+	OverflowSaturate
+
+	// OverflowError fails the commit of a transaction which overflows the value of a row, with
+	// a *MergeOverflowError. The values are checked against the committed values once the query
+	// completes, and the values which overflow due to a concurrent commit are saturated.
+	OverflowError
+)
+
+// MergeOverflowError is returned when committing a transaction which overflows the value of a
+// row, for a column created with the OverflowError policy.
+type MergeOverflowError struct {
+	Column string // The name of the column
+	Index  uint32 // The index of the row
+}
+
+// Error returns the description of the overflow
+func (e *MergeOverflowError) Error() string {
+	return fmt.Sprintf("column: unable to merge into column '%s', value of row %d overflows", e.Column, e.Index)
+}
+
+// WithOverflow sets the behavior of the default merge of an integer column when the result
+// overflows. The deltas of the unsigned columns are always added, hence they can only overflow
+// the maximum value. It has no effect on the columns with a custom merge function.
+func WithOverflow[T any](policy Overflow) func(*option[T]) {
+	return func(v *option[T]) {
+		v.Overflow = policy
+	}
+}
+
+// overflowPolicy returns the behavior of the default merge of the column when it overflows.
+func (o option[T]) overflowPolicy() Overflow {
+	return o.Overflow
+}
+
+// mergeAdd returns the default merge function of a numeric column, adding the delta to the
+// value with the specified overflow behavior.
+func mergeAdd[T simd.Number](policy Overflow) func(value, delta T) T {
+	if policy == OverflowWrap {
+		return func(value, delta T) T { return value + delta }
+	}
+
+	lo, hi := limitsOf[T]()
+	return func(value, delta T) T {
+		sum := value + delta
+		switch {
+		case delta > 0 && sum < value:
+			return hi
+		case delta < 0 && sum > value:
+			return lo
+		default:
+			return sum
+		}
+	}
+}
+
+// addChecked adds the delta to the value and returns whether the result overflows
+func addChecked[T simd.Number](value, delta T) (T, bool) {
+	sum := value + delta
+	return sum, (delta > 0 && sum < value) || (delta < 0 && sum > value)
+}
+
+// limitsOf returns the minimum and the maximum value of an integer type
+func limitsOf[T simd.Number]() (lo, hi T) {
+	switch any(lo).(type) {
+	case int:
+		return any(math.MinInt).(T), any(math.MaxInt).(T)
+	case int8:
+		return any(int8(math.MinInt8)).(T), any(int8(math.MaxInt8)).(T)
+	case int16:
+		return any(int16(math.MinInt16)).(T), any(int16(math.MaxInt16)).(T)
+	case int32:
+		return any(int32(math.MinInt32)).(T), any(int32(math.MaxInt32)).(T)
+	case int64:
+		return any(int64(math.MinInt64)).(T), any(int64(math.MaxInt64)).(T)
+	case uint:
+		return 0, any(uint(math.MaxUint)).(T)
+	case uint8:
+		return 0, any(uint8(math.MaxUint8)).(T)
+	case uint16:
+		return 0, any(uint16(math.MaxUint16)).(T)
+	case uint32:
+		return 0, any(uint32(math.MaxUint32)).(T)
+	case uint64:
+		return 0, any(uint64(math.MaxUint64)).(T)
+	case float32:
+		return any(float32(-math.MaxFloat32)).(T), any(float32(math.MaxFloat32)).(T)
+	default:
+		return any(-math.MaxFloat64).(T), any(math.MaxFloat64).(T)
+	}
+}
+
+// readNumberAt reads the value of the current operation of a reader, for a numeric type
+func readNumberAt[T simd.Number](r *commit.Reader) T {
+	var v T
+	switch any(v).(type) {
+	case int:
+		return T(r.Int())
+	case int16:
+		return T(r.Int16())
+	case int32:
+		return T(r.Int32())
+	case int64:
+		return T(r.Int64())
+	case uint:
+		return T(r.Uint())
+	case uint16:
+		return T(r.Uint16())
+	case uint32:
+		return T(r.Uint32())
+	case uint64:
+		return T(r.Uint64())
+	case float32:
+		return T(r.Float32())
+	default:
+		return T(r.Float64())
+	}
+}
+
+// --------------------------- Overflow Check ----------------------------
+
+// overflowChecker represents a column which can check whether the merges overflow
+type overflowChecker interface {
+	overflowPolicy() Overflow
+	checkOverflow(txn *Txn, updates *commit.Buffer) error
+}
+
+// checkOverflow checks that the merges of the transaction do not overflow the committed
+// values, for the columns created with the OverflowError policy.
+func (txn *Txn) checkOverflow() error {
+	for _, u := range txn.updates {
+		if u.IsEmpty() || u.Column == rowColumn {
+			continue
+		}
+
+		column, ok := txn.owner.cols.Load(u.Column)
+		if !ok {
+			continue
+		}
+
+		checker, ok := column.Column.(overflowChecker)
+		if !ok || checker.overflowPolicy() != OverflowError {
+			continue
+		}
+
+		if err := checker.checkOverflow(txn, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMerges replays the operations of the updates of a column on top of the committed values,
+// which are loaded while holding the read lock of their chunk, and fails on the first overflow.
+func checkMerges[T simd.Number](txn *Txn, updates *commit.Buffer, read func(*commit.Reader) T, load func(idx uint32) T) error {
+	pending := make(map[uint32]T)
+	txn.reader.Seek(updates)
+	for txn.reader.Next() {
+		idx := txn.reader.Index()
+		switch txn.reader.Type {
+		case commit.Put:
+			pending[idx] = read(txn.reader)
+		case commit.Merge:
+			value, ok := pending[idx]
+			if !ok {
+				chunk := commit.ChunkAt(idx)
+				txn.rlock(chunk)
+				value = load(idx)
+				txn.runlock(chunk)
+			}
+
+			sum, overflow := addChecked(value, read(txn.reader))
+			if overflow {
+				return &MergeOverflowError{Column: updates.Column, Index: idx}
+			}
+			pending[idx] = sum
+		}
+	}
+	return nil
+}
+
+// checkOverflow checks whether the merges of the updates overflow the values of the column
+func (c *numericColumn[T]) checkOverflow(txn *Txn, updates *commit.Buffer) error {
+	return checkMerges(txn, updates, readNumberAt[T], func(idx uint32) T {
+		chunk := commit.ChunkAt(idx)
+		if int(chunk) >= len(c.chunks) {
+			return 0
+		}
+		return c.chunks[chunk].data[idx-chunk.Min()]
+	})
+}
+
+// checkOverflow checks whether the merges of the updates overflow the values of the column
+func (c *columnPacked) checkOverflow(txn *Txn, updates *commit.Buffer) error {
+	return checkMerges(txn, updates, readInt64, func(idx uint32) int64 {
+		chunk := commit.ChunkAt(idx)
+		if int(chunk) >= len(c.chunks) {
+			return 0
+		}
+		return c.chunks[chunk].load(idx - chunk.Min())
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverflow(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("wrap", ForUint16())
+	c.CreateColumn("saturate", ForInt32(WithOverflow[int32](OverflowSaturate)))
+	c.CreateColumn("packed", ForPacked(WithOverflow[int64](OverflowSaturate)))
+	c.CreateColumn("strict", ForInt64(WithOverflow[int64](OverflowError)))
+
+	idx, err := c.Insert(func(r Row) error {
+		r.SetUint16("wrap", math.MaxUint16)
+		r.SetInt32("saturate", math.MaxInt32-1)
+		r.SetPacked("packed", math.MinInt64+1)
+		r.SetInt64("strict", math.MaxInt64-10)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// The default merge wraps around, while the saturated ones are clamped
+	assert.NoError(t, c.QueryAt(idx, func(r Row) error {
+		r.MergeUint16("wrap", 2)
+		r.MergeInt32("saturate", 10)
+		r.MergePacked("packed", -10)
+		r.MergeInt64("strict", 10)
+		return nil
+	}))
+
+	assert.NoError(t, c.QueryAt(idx, func(r Row) error {
+		wrap, _ := r.Uint16("wrap")
+		saturate, _ := r.Int32("saturate")
+		packed, _ := r.Packed("packed")
+		strict, _ := r.Int64("strict")
+		assert.Equal(t, uint16(1), wrap)
+		assert.Equal(t, int32(math.MaxInt32), saturate)
+		assert.Equal(t, int64(math.MinInt64), packed)
+		assert.Equal(t, int64(math.MaxInt64), strict)
+		return nil
+	}))
+
+	// The overflow of the strict column fails the commit, along with its other changes
+	err = c.QueryAt(idx, func(r Row) error {
+		r.MergeInt32("saturate", -10)
+		r.MergeInt64("strict", -5)
+		r.MergeInt64("strict", 6)
+		return nil
+	})
+
+	var overflow *MergeOverflowError
+	assert.True(t, errors.As(err, &overflow))
+	assert.Equal(t, MergeOverflowError{Column: "strict", Index: idx}, *overflow)
+	assert.NoError(t, c.QueryAt(idx, func(r Row) error {
+		saturate, _ := r.Int32("saturate")
+		assert.Equal(t, int32(math.MaxInt32), saturate)
+		return nil
+	}))
+
+	// The values set by the transaction are merged before the check
+	assert.NoError(t, c.QueryAt(idx, func(r Row) error {
+		r.SetInt64("strict", 0)
+		r.MergeInt64("strict", math.MinInt64)
+		return nil
+	}))
+	assert.Error(t, c.QueryAt(idx, func(r Row) error {
+		r.MergeInt64("strict", -1)
+		return nil
+	}))
+}
+
+func TestMergeAdd(t *testing.T) {
+	assert.Equal(t, uint8(255), mergeAdd[uint8](OverflowSaturate)(250, 10))
+	assert.Equal(t, uint64(math.MaxUint64), mergeAdd[uint64](OverflowSaturate)(math.MaxUint64, 1))
+	assert.Equal(t, int8(-128), mergeAdd[int8](OverflowSaturate)(-120, -10))
+	assert.Equal(t, int16(4), mergeAdd[int16](OverflowWrap)(math.MaxInt16, math.MinInt16+5))
+	assert.Equal(t, 3.5, mergeAdd[float64](OverflowSaturate)(1, 2.5))
+
+	assert.Equal(t, math.MaxInt, mergeAdd[int](OverflowSaturate)(math.MaxInt, 1))
+	assert.Equal(t, uint(math.MaxUint), mergeAdd[uint](OverflowSaturate)(math.MaxUint, 1))
+	assert.Equal(t, uint32(math.MaxUint32), mergeAdd[uint32](OverflowSaturate)(math.MaxUint32, 1))
+
+	lo, hi := limitsOf[float32]()
+	assert.Equal(t, float32(-math.MaxFloat32), lo)
+	assert.Equal(t, float32(math.MaxFloat32), hi)
+}
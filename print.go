@@ -0,0 +1,85 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Various limits of the tables rendered by Print()
+const (
+	printRows  = 100 // The maximum number of rows rendered
+	printWidth = 40  // The maximum number of characters of a value
+)
+
+// Print renders the current selection as an aligned text table into the writer, with a row
+// per selected row and a column for its index followed by the specified columns, which is
+// useful for debugging and for the output of the failed tests. If no columns are specified,
+// all of the columns are rendered in the order of their creation, except for the indexes.
+// At most 100 rows are rendered and the long values are truncated, while the values of the
+// masked columns are masked unless the transaction was unmasked.
+func (txn *Txn) Print(w io.Writer, columns ...string) error {
+	if len(columns) == 0 {
+		txn.owner.cols.Range(func(column *column) {
+			if !column.IsIndex() && !isPseudo(column.name) && column.name != expireColumn && !strings.HasSuffix(column.name, "."+expireColumn) {
+				columns = append(columns, column.name)
+			}
+		})
+	}
+
+	readers := make([]rdAny, 0, len(columns))
+	for _, name := range columns {
+		if _, ok := txn.columnAt(name); !ok {
+			return fmt.Errorf("column: column '%s' does not exist", name)
+		}
+		readers = append(readers, readAnyOf(txn, name))
+	}
+
+	out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(out, "idx\t%s\n", strings.Join(columns, "\t"))
+
+	count, shown := txn.Count(), 0
+	cells := make([]string, len(readers))
+	txn.enterCallback()
+	txn.rangeReadUntil(func(idx uint32) bool {
+		for i, r := range readers {
+			cells[i] = "-"
+			if v, ok := r.Get(); ok {
+				cells[i] = printValue(v)
+			}
+		}
+
+		fmt.Fprintf(out, "%d\t%s\n", idx, strings.Join(cells, "\t"))
+		shown++
+		return shown < printRows
+	})
+	txn.leaveCallback()
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	var err error
+	switch {
+	case count > shown:
+		_, err = fmt.Fprintf(w, "(%d rows, %d not shown)\n", count, count-shown)
+	default:
+		_, err = fmt.Fprintf(w, "(%d rows)\n", count)
+	}
+	return err
+}
+
+// printValue formats a value as a single line, truncating it if it is too long
+func printValue(v any) string {
+	s := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(fmt.Sprint(v))
+	if utf8.RuneCountInString(s) <= printWidth {
+		return s
+	}
+
+	return string([]rune(s)[:printWidth-3]) + "..."
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrint(t *testing.T) {
+	players := NewCollection()
+	players.CreateColumn("name", ForString())
+	players.CreateColumn("age", ForInt())
+	players.CreateColumn("email", ForString(WithMask[string](func(any) any {
+		return "***"
+	})))
+	players.CreateIndex("old", "age", func(r Reader) bool {
+		return r.Int() >= 30
+	})
+
+	players.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		r.SetInt("age", 35)
+		r.SetString("email", "roman@example.com")
+		return nil
+	})
+	players.Insert(func(r Row) error {
+		r.SetString("name", "Merlin\tthe "+strings.Repeat("very ", 10)+"old")
+		r.SetInt("age", 500)
+		return nil
+	})
+	players.Insert(func(r Row) error {
+		r.SetString("name", "Arthur")
+		r.SetInt("age", 20)
+		return nil
+	})
+
+	var out bytes.Buffer
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		return txn.With("old").Print(&out)
+	}))
+	assert.Equal(t, ""+
+		"idx  name                                      age  email\n"+
+		"0    Roman                                     35   ***\n"+
+		"1    Merlin the very very very very very v...  500  -\n"+
+		"(2 rows)\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		return txn.Print(&out, "age")
+	}))
+	assert.Equal(t, "idx  age\n0    35\n1    500\n2    20\n(3 rows)\n", out.String())
+
+	assert.Error(t, players.Query(func(txn *Txn) error {
+		return txn.Print(&out, "invalid")
+	}))
+}
+
+func TestPrintLimit(t *testing.T) {
+	players := loadPlayers(500)
+	var out bytes.Buffer
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		return txn.Print(&out, "name", "age")
+	}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, printRows+2)
+	assert.Equal(t, "(500 rows, 400 not shown)", lines[len(lines)-1])
+}
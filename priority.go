@@ -0,0 +1,95 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Priority represents the priority lane in which the commit of a transaction is applied
+type Priority uint8
+
+// The priority lanes of the commits, a commit yields to the ones of a higher priority
+const (
+	PriorityNormal Priority = iota // The default lane of the transactions
+	PriorityLow                    // The lane of the bulk or analytical transactions
+	PriorityHigh                   // The lane of the small, latency-sensitive transactions
+)
+
+// rank returns the rank of the lane, the higher the rank the higher the priority
+func (p Priority) rank() int {
+	switch p {
+	case PriorityLow:
+		return 0
+	case PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// WithPriority hints that the commit of the transaction should be applied in the specified
+// priority lane. The commits are applied chunk by chunk, and before each chunk a commit waits
+// for the pending commits of the higher lanes, so that small latency-sensitive updates are not
+// queued behind giant transactions. Since the lower lanes wait as long as the higher ones are
+// busy, the high priority should be reserved to small transactions.
+func WithPriority(priority Priority) Hint {
+	return func(h *hints) {
+		h.priority = priority
+	}
+}
+
+// --------------------------- Commit Lanes ----------------------------
+
+// commitLanes schedules the commits of a collection according to their priority lanes
+type commitLanes struct {
+	pending [3]int32   // The number of pending commits per lane
+	lock    sync.Mutex // The mutex protecting the condition
+	cond    *sync.Cond // The condition signaled when a lane becomes idle
+}
+
+// enter registers a pending commit in the lane
+func (l *commitLanes) enter(p Priority) {
+	atomic.AddInt32(&l.pending[p.rank()], 1)
+}
+
+// leave unregisters a pending commit from the lane, waking up the lower lanes once it is idle
+func (l *commitLanes) leave(p Priority) {
+	if atomic.AddInt32(&l.pending[p.rank()], -1) > 0 {
+		return
+	}
+
+	l.lock.Lock()
+	if l.cond != nil {
+		l.cond.Broadcast()
+	}
+	l.lock.Unlock()
+}
+
+// busy returns whether a lane of a higher priority has pending commits
+func (l *commitLanes) busy(p Priority) bool {
+	for rank := p.rank() + 1; rank < len(l.pending); rank++ {
+		if atomic.LoadInt32(&l.pending[rank]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// yield waits until the lanes of a higher priority have no pending commits
+func (l *commitLanes) yield(p Priority) {
+	if !l.busy(p) {
+		return
+	}
+
+	l.lock.Lock()
+	if l.cond == nil {
+		l.cond = sync.NewCond(&l.lock)
+	}
+	for l.busy(p) {
+		l.cond.Wait()
+	}
+	l.lock.Unlock()
+}
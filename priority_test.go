@@ -0,0 +1,61 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityLanes(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("balance", ForFloat64())
+	for i := 0; i < 20000; i++ {
+		c.Insert(func(r Row) error {
+			r.SetFloat64("balance", 1)
+			return nil
+		})
+	}
+
+	// Simulate a pending high priority commit
+	c.lanes.enter(PriorityHigh)
+	update := func(priority Priority, done chan struct{}) {
+		defer close(done)
+		c.Query(func(txn *Txn) error {
+			txn.Hint(WithPriority(priority))
+			return txn.Range(func(idx uint32) {
+				txn.Float64("balance").Merge(1)
+			})
+		})
+	}
+
+	// The lower lanes yield to the pending commit
+	low, normal := make(chan struct{}), make(chan struct{})
+	go update(PriorityLow, low)
+	go update(PriorityNormal, normal)
+	select {
+	case <-low:
+		assert.Fail(t, "low priority commit was not delayed")
+	case <-normal:
+		assert.Fail(t, "normal priority commit was not delayed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The commits of the same lane are not delayed
+	high := make(chan struct{})
+	update(PriorityHigh, high)
+	<-high
+
+	// Once the lane is idle, the others are applied
+	c.lanes.leave(PriorityHigh)
+	<-low
+	<-normal
+
+	c.Query(func(txn *Txn) error {
+		assert.Equal(t, 4.0*20000, txn.Float64("balance").Sum())
+		return nil
+	})
+}
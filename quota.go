@@ -0,0 +1,209 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kelindar/column/commit"
+)
+
+// Quota represents the resource limits of a single collection of a registry, typically the
+// collection of a tenant, so that one of them can not consume the entire shared store.
+type Quota struct {
+	MaxRows  int // The maximum number of rows of the collection, unlimited if zero
+	MaxBytes int // The maximum estimated size of the values of the collection, unlimited if zero
+}
+
+// Usage represents the resources currently used by a collection of a registry
+type Usage struct {
+	Rows  int   // The number of rows of the collection
+	Bytes int   // The estimated size of the values of the collection, in bytes
+	Quota Quota // The quota of the collection
+}
+
+// QuotaError is returned when inserting a row into a collection which reached its quota. It
+// can be detected with errors.As() in order to report the exceeded resource to the tenant.
+type QuotaError struct {
+	Collection string // The name of the collection
+	Resource   string // The exceeded resource, either "rows" or "bytes"
+	Limit      int    // The configured limit of the resource
+	Usage      int    // The usage of the resource when the insert was attempted
+}
+
+// Error returns the description of the exceeded quota
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("column: unable to insert into '%s', quota of %d %s reached (used %d)",
+		e.Collection, e.Limit, e.Resource, e.Usage)
+}
+
+// SetQuota sets the quota of a collection of the registry, overriding the default quota. If
+// the quota limits the size of the collection, its values are measured first, while holding
+// the read lock of each chunk in turn.
+func (r *Registry) SetQuota(name string, quota Quota) error {
+	r.lock.Lock()
+	collection, ok := r.colls[name]
+	if ok {
+		r.quotas[name] = quota
+	}
+	r.lock.Unlock()
+
+	switch {
+	case !ok:
+		return fmt.Errorf("column: unable to set quota of collection '%s', does not exist", name)
+	case quota.MaxBytes > 0:
+		collection.trackSizes()
+	}
+	return nil
+}
+
+// Usage returns the resources currently used by a collection of the registry, along with its
+// quota. If the size of the collection is not limited, its values are measured on demand.
+func (r *Registry) Usage(name string) (Usage, error) {
+	r.lock.RLock()
+	collection, ok := r.colls[name]
+	quota := r.quotas[name]
+	r.lock.RUnlock()
+	if !ok {
+		return Usage{}, fmt.Errorf("column: unable to get usage of collection '%s', does not exist", name)
+	}
+
+	return Usage{
+		Rows:  collection.Count(),
+		Bytes: collection.byteSize(),
+		Quota: quota,
+	}, nil
+}
+
+// checkQuota checks whether a row can be inserted into a collection without exceeding either
+// the shared row limit of the registry or the quota of the collection.
+func (r *Registry) checkQuota(name string, collection *Collection) error {
+	if r.opts.MaxRows > 0 {
+		if err := r.checkRows(); err != nil {
+			return err
+		}
+	}
+
+	r.lock.RLock()
+	quota := r.quotas[name]
+	r.lock.RUnlock()
+
+	if count := collection.Count(); quota.MaxRows > 0 && count >= quota.MaxRows {
+		return &QuotaError{Collection: name, Resource: "rows", Limit: quota.MaxRows, Usage: count}
+	}
+
+	if quota.MaxBytes > 0 {
+		if size := collection.byteSize(); size >= quota.MaxBytes {
+			return &QuotaError{Collection: name, Resource: "bytes", Limit: quota.MaxBytes, Usage: size}
+		}
+	}
+	return nil
+}
+
+// --------------------------- Size Tracking ----------------------------
+
+// sizeSet keeps the encoded size of the values of each column, per chunk, along with their
+// total. It is only maintained for the collections whose size is limited by a quota.
+type sizeSet struct {
+	lock  sync.Mutex
+	total int64
+	sizes map[checksumKey]int
+}
+
+// store stores the size of a column chunk and updates the total
+func (s *sizeSet) store(key checksumKey, size int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.total += int64(size - s.sizes[key])
+	s.sizes[key] = size
+}
+
+// drop removes the sizes of a column, or of every column if the name is empty
+func (s *sizeSet) drop(columnName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, size := range s.sizes {
+		if columnName == "" || key.column == columnName {
+			s.total -= int64(size)
+			delete(s.sizes, key)
+		}
+	}
+}
+
+// size returns the total size of the columns
+func (s *sizeSet) size() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return int(s.total)
+}
+
+// sizeOf computes the encoded size of the values of a column chunk
+func (c *Collection) sizeOf(column *column, chunk commit.Chunk) int {
+	buffer := c.txns.acquirePage(column.name)
+	defer c.txns.releasePage(buffer)
+	if !column.Snapshot(chunk, buffer) {
+		return 0
+	}
+	return buffer.Len()
+}
+
+// updateSizes measures the size of a chunk once a commit was applied on it, if the size of the
+// collection is tracked. This must be called while holding the write lock of the chunk.
+func (c *Collection) updateSizes(chunk commit.Chunk) {
+	if sizes := c.sizes.Load(); sizes != nil {
+		c.cols.Range(func(column *column) {
+			sizes.store(checksumKey{column.name, chunk}, c.sizeOf(column, chunk))
+		})
+	}
+}
+
+// dropSizes removes the sizes of a column, if the size of the collection is tracked
+func (c *Collection) dropSizes(columnName string) {
+	if sizes := c.sizes.Load(); sizes != nil {
+		sizes.drop(columnName)
+	}
+}
+
+// trackSizes starts tracking the size of the collection on each commit, and measures the
+// chunks which were already committed. The set is published first, so that the concurrent
+// commits are not missed.
+func (c *Collection) trackSizes() {
+	if c.sizes.CompareAndSwap(nil, &sizeSet{sizes: make(map[checksumKey]int)}) {
+		c.measureSizes()
+	}
+}
+
+// measureSizes measures every chunk again if the size of the collection is tracked, for
+// example once the collection was restored.
+func (c *Collection) measureSizes() {
+	sizes := c.sizes.Load()
+	if sizes == nil {
+		return
+	}
+
+	sizes.drop("")
+	for chunk := commit.Chunk(0); c.isCommitted(chunk); chunk++ {
+		c.slock.RLock(uint(chunk))
+		c.updateSizes(chunk)
+		c.slock.RUnlock(uint(chunk))
+	}
+}
+
+// byteSize returns the estimated size of the values of the collection. If the size is not
+// tracked, every chunk is measured.
+func (c *Collection) byteSize() (size int) {
+	if sizes := c.sizes.Load(); sizes != nil {
+		return sizes.size()
+	}
+
+	for chunk := commit.Chunk(0); c.isCommitted(chunk); chunk++ {
+		c.slock.RLock(uint(chunk))
+		c.cols.Range(func(column *column) {
+			size += c.sizeOf(column, chunk)
+		})
+		c.slock.RUnlock(uint(chunk))
+	}
+	return
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	registry := NewRegistry(RegistryOptions{
+		Quota: Quota{MaxRows: 5},
+		OnCreate: func(name string, c *Collection) error {
+			return c.CreateColumn("name", ForString())
+		},
+	})
+	defer registry.Close()
+
+	acme, _ := registry.Create("acme")
+	globex, _ := registry.Create("globex")
+	insert := func(c *Collection, name string) error {
+		_, err := c.Insert(func(r Row) error {
+			r.SetString("name", name)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, insert(acme, "Roman"))
+	}
+
+	// The quota of one tenant does not affect the others
+	var quotaErr *QuotaError
+	err := insert(acme, "Roman")
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, QuotaError{Collection: "acme", Resource: "rows", Limit: 5, Usage: 5}, *quotaErr)
+	assert.NoError(t, insert(globex, "Roman"))
+
+	// The quota can be raised for a single tenant
+	assert.Error(t, registry.SetQuota("invalid", Quota{}))
+	assert.NoError(t, registry.SetQuota("acme", Quota{MaxRows: 10}))
+	assert.NoError(t, insert(acme, "Roman"))
+
+	usage, err := registry.Usage("acme")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, usage.Rows)
+	assert.Greater(t, usage.Bytes, 0)
+	assert.Equal(t, Quota{MaxRows: 10}, usage.Quota)
+
+	_, err = registry.Usage("invalid")
+	assert.Error(t, err)
+}
+
+func TestQuotaBytes(t *testing.T) {
+	registry := NewRegistry(RegistryOptions{
+		OnCreate: func(name string, c *Collection) error {
+			return c.CreateColumn("name", ForString())
+		},
+	})
+	defer registry.Close()
+
+	acme, _ := registry.Create("acme")
+	insert := func() error {
+		_, err := acme.Insert(func(r Row) error {
+			r.SetString("name", strings.Repeat("x", 1000))
+			return nil
+		})
+		return err
+	}
+
+	// The existing values are measured when the quota is set
+	assert.NoError(t, insert())
+	before, _ := registry.Usage("acme")
+	assert.NoError(t, registry.SetQuota("acme", Quota{MaxBytes: 5000}))
+	after, _ := registry.Usage("acme")
+	assert.Equal(t, before.Bytes, after.Bytes)
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = insert()
+	}
+
+	var quotaErr *QuotaError
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "bytes", quotaErr.Resource)
+	assert.GreaterOrEqual(t, quotaErr.Usage, 5000)
+	assert.Less(t, acme.Count(), 10)
+
+	// Deleting rows frees up some room
+	assert.True(t, acme.DeleteAt(0))
+	assert.True(t, acme.DeleteAt(1))
+	assert.NoError(t, insert())
+
+	// The size is measured again once restored
+	usage, _ := registry.Usage("acme")
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, acme.Snapshot(buffer))
+	assert.NoError(t, acme.Restore(buffer))
+	restored, _ := registry.Usage("acme")
+	assert.Equal(t, usage.Bytes, restored.Bytes)
+}
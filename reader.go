@@ -0,0 +1,95 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kelindar/column/commit"
+)
+
+// PointReader represents a read-only handle over a collection for the plain point reads, which
+// can be retained and used concurrently by several goroutines. Each read locks the chunk of its
+// row and observes its latest committed state, the reader neither pins a snapshot nor binds the
+// columns in advance, so successive reads may observe different commits. Several rows should be
+// read with a ReadSnapshot query instead, if they must be consistent with each other. The reads
+// borrow the transactions pooled by the reader, whose columns are resolved on first use and kept
+// afterwards, hence the reader should be recreated once a column it reads is dropped or replaced.
+type PointReader struct {
+	owner *Collection
+	txns  sync.Pool
+}
+
+// PointReader returns a read-only handle which can be retained across calls to read individual
+// rows under the lock of their chunk, without entering a full transaction, see PointReader.
+func (c *Collection) PointReader() *PointReader {
+	h := &PointReader{owner: c}
+	h.txns.New = func() any {
+		return c.txns.acquire(c)
+	}
+	return h
+}
+
+// ReadAt reads the latest committed state of the row at the specified index, holding the read
+// lock of its chunk while the callback is executed, so the row reflects a set of fully applied
+// commits. The values must not be modified through the row, and an error is returned if the row
+// does not exist.
+func (h *PointReader) ReadAt(idx uint32, fn func(Row) error) error {
+	txn := h.txns.Get().(*Txn)
+	defer h.release(txn)
+
+	chunk := commit.ChunkAt(idx)
+	txn.rlock(chunk)
+	h.owner.lock.RLock()
+	exists := h.owner.fill.Contains(idx)
+	h.owner.lock.RUnlock()
+	if !exists {
+		return fmt.Errorf("column: row %d does not exist", idx)
+	}
+
+	txn.cursor = idx
+	txn.enterCallback()
+	err := fn(Row{txn})
+	txn.leaveCallback()
+	switch {
+	case err != nil:
+		return err
+	case txn.corrupt != nil:
+		return txn.corrupt
+	case len(txn.updates) > 0:
+		return fmt.Errorf("column: unable to write through a point reader")
+	default:
+		return nil
+	}
+}
+
+// release releases the read lock which is still held by a transaction and resets it before
+// returning it to the reader, even if the callback has panicked. The values which were written
+// by mistake are discarded, since the reader is read-only.
+func (h *PointReader) release(txn *Txn) {
+	txn.runlockHeld()
+	txn.callbacks = 0
+	txn.corrupt = nil
+	txn.verified.Clear()
+	txn.guard.clearReads()
+	for _, u := range txn.updates {
+		txn.owner.txns.releasePage(u)
+	}
+	txn.updates = txn.updates[:0]
+	h.txns.Put(txn)
+}
+
+// ReadKey reads the row with the specified primary key, similarly to ReadAt().
+func (h *PointReader) ReadKey(key string, fn func(Row) error) error {
+	if h.owner.pk == nil {
+		return errNoKey
+	}
+
+	if idx, ok := h.owner.pk.OffsetOf(key); ok {
+		return h.ReadAt(idx, fn)
+	}
+
+	return fmt.Errorf("column: key '%s' was not found", key)
+}
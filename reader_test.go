@@ -0,0 +1,100 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPointReader(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("id", ForKey())
+	c.CreateColumn("balance", ForFloat64())
+	for i := 0; i < 20000; i++ {
+		c.InsertKey(fmt.Sprint(i), func(r Row) error {
+			r.SetFloat64("balance", float64(i))
+			return nil
+		})
+	}
+
+	// The reader is shared by several goroutines, while the rows are being updated
+	reader := c.PointReader()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := uint32(0); idx < 20000; idx += 7 {
+				assert.NoError(t, reader.ReadAt(idx, func(r Row) error {
+					balance, ok := r.Float64("balance")
+					assert.True(t, ok)
+					assert.GreaterOrEqual(t, balance, float64(idx))
+					return nil
+				}))
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		c.QueryKey(fmt.Sprint(i*150), func(r Row) error {
+			r.MergeFloat64("balance", 1)
+			return nil
+		})
+	}
+	wg.Wait()
+
+	// Reads by primary key observe the committed values
+	assert.NoError(t, reader.ReadKey("150", func(r Row) error {
+		balance, _ := r.Float64("balance")
+		assert.Equal(t, 151.0, balance)
+		return nil
+	}))
+	assert.Error(t, reader.ReadKey("missing", func(r Row) error { return nil }))
+	assert.Error(t, NewCollection().PointReader().ReadKey("0", func(r Row) error { return nil }))
+
+	// Missing rows and writes are rejected
+	assert.True(t, c.DeleteAt(5))
+	assert.Error(t, reader.ReadAt(5, func(r Row) error { return nil }))
+	assert.Error(t, reader.ReadAt(6, func(r Row) error {
+		r.SetFloat64("balance", 0)
+		return nil
+	}))
+	assert.NoError(t, reader.ReadAt(6, func(r Row) error {
+		balance, _ := r.Float64("balance")
+		assert.Equal(t, 6.0, balance)
+		return nil
+	}))
+}
+
+func TestPointReaderPanic(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("balance", ForFloat64())
+	idx, _ := c.Insert(func(r Row) error {
+		r.SetFloat64("balance", 1)
+		return nil
+	})
+
+	reader := c.PointReader()
+	assert.Panics(t, func() {
+		reader.ReadAt(idx, func(r Row) error {
+			r.SetFloat64("balance", 2)
+			panic("boom")
+		})
+	})
+
+	// The read lock must be released, and the transaction reset
+	assert.NoError(t, c.QueryAt(idx, func(r Row) error {
+		r.SetFloat64("balance", 3)
+		return nil
+	}))
+	assert.NoError(t, reader.ReadAt(idx, func(r Row) error {
+		balance, _ := r.Float64("balance")
+		assert.Equal(t, 3.0, balance)
+		return nil
+	}))
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError represents a panic which was recovered while executing a query, when the
+// Query.RecoverPanics option is enabled. The transaction is rolled back, as for any other error.
+type PanicError struct {
+	Value any    // The value passed to panic()
+	Stack []byte // The stack trace of the goroutine at the time of the panic
+}
+
+// Error returns the panic value along with the stack trace at which it was raised
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("column: query panicked: %v\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error, such as a runtime error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// execute calls the function of the query and, if the Query.RecoverPanics option is enabled,
+// converts a panic into an error after releasing the read locks held at the time.
+func (c *Collection) execute(txn *Txn, fn func(txn *Txn) error) (err error) {
+	if !c.options().Query.RecoverPanics {
+		return fn(txn)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			txn.runlockHeld()
+			txn.callbacks = 0
+			txn.guard.clearReads()
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(txn)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	assert.Panics(t, func() {
+		NewCollection().Query(func(txn *Txn) error {
+			panic("boom")
+		})
+	})
+
+	c := NewCollection(Options{Query: QueryOptions{RecoverPanics: true}})
+	c.CreateColumn("balance", ForFloat64())
+	for i := 0; i < 20000; i++ {
+		c.Insert(func(r Row) error {
+			r.SetFloat64("balance", float64(i))
+			return nil
+		})
+	}
+
+	// A bad predicate in the second chunk is returned as an error and rolled back
+	var limits []bool
+	err := c.Query(func(txn *Txn) error {
+		txn.QueryAt(0, func(r Row) error {
+			r.SetFloat64("balance", 99)
+			return nil
+		})
+
+		txn.WithFloat("balance", func(v float64) bool {
+			return v < 17000 || limits[int(v)]
+		})
+		return nil
+	})
+
+	var panicErr *PanicError
+	var runtimeErr runtime.Error
+	assert.ErrorAs(t, err, &panicErr)
+	assert.ErrorAs(t, err, &runtimeErr)
+	assert.Contains(t, err.Error(), "TestRecoverPanics")
+	assert.NoError(t, c.QueryAt(0, func(r Row) error {
+		balance, _ := r.Float64("balance")
+		assert.Equal(t, 0.0, balance)
+		return nil
+	}))
+
+	// The read locks were released, so the collection can still be updated
+	assert.NoError(t, c.QueryAt(17000, func(r Row) error {
+		r.SetFloat64("balance", 1)
+		return nil
+	}))
+
+	// The panics of a dry run are recovered as well
+	_, err = c.DryRun(func(txn *Txn) error {
+		return txn.Range(func(idx uint32) {
+			panic(errors.New("boom"))
+		})
+	})
+	assert.ErrorContains(t, err, "boom")
+	assert.True(t, c.DeleteAt(0))
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// RegistryOptions represents the options for a registry of collections.
+type RegistryOptions struct {
+	Defaults       Options // The default options of the collections created
+	MaxCollections int     // The maximum number of collections, unlimited if zero
+	MaxRows        int     // The maximum number of rows across all collections, unlimited if zero
+	Quota          Quota   // The default quota of each collection, see SetQuota()
+
+	// OnCreate is called when a collection is created, before it becomes visible to the
+	// other users of the registry. This is typically used to create the columns.
+	OnCreate func(name string, collection *Collection) error
+
+	// OnDrop is called when a collection is dropped, after it was removed from the registry.
+	OnDrop func(name string, collection *Collection)
+}
+
+// Registry represents a set of named collections which share the same configuration and
+// resource limits. It is safe for concurrent use.
+type Registry struct {
+	lock   sync.RWMutex           // The lock to guard the collections
+	opts   RegistryOptions        // The options of the registry
+	colls  map[string]*Collection // The collections, by name
+	quotas map[string]Quota       // The quotas of the collections, by name
+}
+
+// NewRegistry creates a new registry of collections.
+func NewRegistry(opts ...RegistryOptions) *Registry {
+	registry := &Registry{
+		colls:  make(map[string]*Collection),
+		quotas: make(map[string]Quota),
+	}
+
+	if len(opts) > 0 {
+		registry.opts = opts[0]
+	}
+	return registry
+}
+
+// Create creates a new collection with the specified name. The options, if specified, are
+// merged with the default options of the registry.
+func (r *Registry) Create(name string, opts ...Options) (*Collection, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	switch {
+	case name == "":
+		return nil, fmt.Errorf("column: unable to create collection, name must be specified")
+	case r.colls[name] != nil:
+		return nil, fmt.Errorf("column: unable to create collection '%s', already exists", name)
+	case r.opts.MaxCollections > 0 && len(r.colls) >= r.opts.MaxCollections:
+		return nil, fmt.Errorf("column: unable to create collection '%s', limit of %d collections reached",
+			name, r.opts.MaxCollections)
+	}
+
+	// Create the collection with the default options
+	collection := NewCollection(append([]Options{r.opts.Defaults}, opts...)...)
+	collection.quota = func() error {
+		return r.checkQuota(name, collection)
+	}
+	if r.opts.Quota.MaxBytes > 0 {
+		collection.trackSizes()
+	}
+
+	if r.opts.OnCreate != nil {
+		if err := r.opts.OnCreate(name, collection); err != nil {
+			collection.Close()
+			return nil, err
+		}
+	}
+
+	r.colls[name] = collection
+	r.quotas[name] = r.opts.Quota
+	return collection, nil
+}
+
+// Get returns the collection with the specified name, if it exists.
+func (r *Registry) Get(name string) (*Collection, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	collection, ok := r.colls[name]
+	return collection, ok
+}
+
+// Drop removes the collection with the specified name from the registry and closes it.
+func (r *Registry) Drop(name string) error {
+	r.lock.Lock()
+	collection, ok := r.colls[name]
+	delete(r.colls, name)
+	delete(r.quotas, name)
+	r.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("column: unable to drop collection '%s', does not exist", name)
+	}
+
+	if r.opts.OnDrop != nil {
+		r.opts.OnDrop(name, collection)
+	}
+	return collection.Close()
+}
+
+// List returns the names of all of the collections, in alphabetical order.
+func (r *Registry) List() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	names := make([]string, 0, len(r.colls))
+	for name := range r.colls {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Count returns the total number of rows across all of the collections.
+func (r *Registry) Count() (count int) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, collection := range r.colls {
+		count += collection.Count()
+	}
+	return
+}
+
+// Close drops all of the collections of the registry.
+func (r *Registry) Close() error {
+	for _, name := range r.List() {
+		if err := r.Drop(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRows checks whether a row can be inserted without exceeding the row limit
+func (r *Registry) checkRows() error {
+	if count := r.Count(); count >= r.opts.MaxRows {
+		return fmt.Errorf("column: unable to insert, limit of %d rows reached", r.opts.MaxRows)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	var dropped []string
+	registry := NewRegistry(RegistryOptions{
+		Defaults:       Options{Capacity: 100},
+		MaxCollections: 3,
+		OnCreate: func(name string, c *Collection) error {
+			if name == "invalid" {
+				return fmt.Errorf("invalid")
+			}
+			return c.CreateColumn("name", ForString())
+		},
+		OnDrop: func(name string, c *Collection) {
+			dropped = append(dropped, name)
+		},
+	})
+
+	// Create a few collections
+	for _, name := range []string{"users", "orders", "items"} {
+		coll, err := registry.Create(name)
+		assert.NoError(t, err)
+		assert.Equal(t, 100, coll.Options().Capacity)
+	}
+
+	_, err := registry.Create("users")
+	assert.Error(t, err)
+	_, err = registry.Create("more")
+	assert.Error(t, err)
+	_, err = registry.Create("")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"items", "orders", "users"}, registry.List())
+
+	// Collections are created with their schema
+	users, ok := registry.Get("users")
+	assert.True(t, ok)
+	_, err = users.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, registry.Count())
+
+	// Drop a collection
+	assert.NoError(t, registry.Drop("orders"))
+	assert.Error(t, registry.Drop("orders"))
+	assert.Equal(t, []string{"orders"}, dropped)
+	_, ok = registry.Get("orders")
+	assert.False(t, ok)
+
+	// A failing hook does not create the collection
+	_, err = registry.Create("invalid")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"items", "users"}, registry.List())
+
+	// Close drops everything
+	assert.NoError(t, registry.Close())
+	assert.Empty(t, registry.List())
+	assert.Equal(t, []string{"orders", "items", "users"}, dropped)
+}
+
+func TestRegistryMaxRows(t *testing.T) {
+	registry := NewRegistry(RegistryOptions{MaxRows: 10})
+	users, _ := registry.Create("users")
+	orders, _ := registry.Create("orders")
+	defer registry.Close()
+
+	insert := func(c *Collection) error {
+		_, err := c.Insert(func(r Row) error { return nil })
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, insert(users))
+		assert.NoError(t, insert(orders))
+	}
+
+	// The limit is shared across all of the collections
+	assert.Error(t, insert(users))
+	assert.Error(t, insert(orders))
+	assert.Equal(t, 10, registry.Count())
+
+	// Deleting rows frees up some room
+	assert.True(t, users.DeleteAt(0))
+	assert.NoError(t, insert(orders))
+}
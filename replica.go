@@ -0,0 +1,233 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/kelindar/column/commit"
+)
+
+var errReadOnlyReplica = errors.New("column: unable to update a replica, it is read-only")
+
+// --------------------------- Replica ----------------------------
+
+// Replica represents an eventually-consistent, read-only copy of a collection. The replica
+// receives the commits of the primary collection and applies them on a background goroutine,
+// so that the queries on the replica never contend with the locks of the primary.
+type Replica struct {
+	owner   *Collection             // The primary collection
+	copy    *Collection             // The read-only copy of the collection
+	lock    sync.Mutex              // The mutex to guard the pending commits
+	cond    *sync.Cond              // The condition signalled when commits are applied
+	pending []commit.Commit         // The commits which are not yet applied
+	last    map[commit.Chunk]uint64 // The last commit applied, for each chunk
+	seen    uint64                  // The number of commits received
+	applied uint64                  // The number of commits applied
+	signal  chan struct{}           // The signal for the pending commits
+	closed  chan struct{}           // The signal to stop the replica
+	done    chan struct{}           // The signal that the replica has stopped
+}
+
+// NewReplica creates a new read-only replica of the collection, which is updated with the
+// commits of the collection on a background goroutine. Since the columns are not part of
+// the commits, the schema function must create them on the replica, similarly to a restore.
+// The replica may also contain additional indexes, for example to serve analytical queries.
+func (c *Collection) NewReplica(schema func(*Collection) error) (*Replica, error) {
+	replica := &Replica{
+		owner:  c,
+		copy:   NewCollection(Options{Capacity: c.options().Capacity, Vacuum: -1}),
+		signal: make(chan struct{}, 1),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	replica.cond = sync.NewCond(&replica.lock)
+
+	if schema != nil {
+		if err := schema(replica.copy); err != nil {
+			replica.copy.Close()
+			return nil, err
+		}
+	}
+
+	// Start receiving the commits before copying the state, the commits which are already
+	// part of the copied state are skipped using their commit IDs.
+	c.subscribe(replica)
+	if err := replica.copyState(); err != nil {
+		c.unsubscribe(replica)
+		replica.copy.Close()
+		return nil, err
+	}
+
+	go replica.run()
+	return replica, nil
+}
+
+// copyState copies the current state of the primary collection into the replica
+func (r *Replica) copyState() (err error) {
+	buffer := bytes.NewBuffer(nil)
+	if _, err := r.owner.writeState(buffer); err != nil {
+		return err
+	}
+
+	r.last, _, err = r.copy.readState(buffer)
+
+	// Expired rows are deleted by the primary, the replica must not delete them by itself
+	options := *r.copy.options()
+	options.Vacuum = -1
+	r.copy.configure(options)
+	return
+}
+
+// Query executes a read-only query on the replica. The query observes a consistent snapshot
+// of the replica, which may not contain the latest commits of the primary yet. Any attempt to
+// update the replica fails with an error, without applying any changes.
+func (r *Replica) Query(fn func(txn *Txn) error) error {
+	summary, err := r.copy.DryRun(fn)
+	switch {
+	case err != nil:
+		return err
+	case summary.Inserted > 0 || summary.Deleted > 0 || len(summary.Columns) > 0:
+		return errReadOnlyReplica
+	default:
+		return nil
+	}
+}
+
+// QueryAt executes a read-only query on a single row of the replica.
+func (r *Replica) QueryAt(idx uint32, fn func(Row) error) error {
+	return r.Query(func(txn *Txn) error {
+		return txn.QueryAt(idx, fn)
+	})
+}
+
+// Count returns the total number of rows of the replica.
+func (r *Replica) Count() int {
+	return r.copy.Count()
+}
+
+// Pending returns the number of commits received from the primary which are not yet applied.
+func (r *Replica) Pending() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return int(r.seen - r.applied)
+}
+
+// Sync blocks until all of the commits received from the primary at the time of the call
+// are applied on the replica, or the replica is closed.
+func (r *Replica) Sync() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	target := r.seen
+	for r.applied < target && !r.isClosed() {
+		r.cond.Wait()
+	}
+}
+
+// Close stops the replication and releases the resources of the replica.
+func (r *Replica) Close() error {
+	r.owner.unsubscribe(r)
+	select {
+	case <-r.closed:
+		return nil
+	default:
+		close(r.closed)
+	}
+
+	// Wake up the callers of Sync(), the lock prevents them from missing the signal
+	<-r.done
+	r.lock.Lock()
+	r.cond.Broadcast()
+	r.lock.Unlock()
+	return r.copy.Close()
+}
+
+// isClosed returns whether the replica was closed
+func (r *Replica) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// append queues a commit of the primary, without blocking the primary
+func (r *Replica) append(change commit.Commit) {
+	r.lock.Lock()
+	r.pending = append(r.pending, change.Clone())
+	r.seen++
+	r.lock.Unlock()
+
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run applies the pending commits until the replica is closed
+func (r *Replica) run() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-r.signal:
+		}
+
+		r.lock.Lock()
+		batch := r.pending
+		r.pending = nil
+		r.lock.Unlock()
+
+		for _, change := range batch {
+			if change.ID > r.last[change.Chunk] {
+				r.last[change.Chunk] = change.ID
+				r.copy.replay(change, r.copy.commitLogger())
+			}
+		}
+
+		r.lock.Lock()
+		r.applied += uint64(len(batch))
+		r.cond.Broadcast()
+		r.lock.Unlock()
+	}
+}
+
+// --------------------------- Subscriptions ----------------------------
+
+// subscribe adds the replica to the receivers of the commits of the collection
+func (c *Collection) subscribe(replica *Replica) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	replicas, _ := c.replicas.Load().([]*Replica)
+	c.replicas.Store(append(append([]*Replica(nil), replicas...), replica))
+}
+
+// unsubscribe removes the replica from the receivers of the commits of the collection
+func (c *Collection) unsubscribe(replica *Replica) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	replicas, _ := c.replicas.Load().([]*Replica)
+	filtered := make([]*Replica, 0, len(replicas))
+	for _, v := range replicas {
+		if v != replica {
+			filtered = append(filtered, v)
+		}
+	}
+	c.replicas.Store(filtered)
+}
+
+// replicate sends the commit to all of the replicas of the collection
+func (c *Collection) replicate(change commit.Commit) {
+	replicas, _ := c.replicas.Load().([]*Replica)
+	for _, replica := range replicas {
+		replica.append(change)
+	}
+}
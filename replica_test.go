@@ -0,0 +1,103 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReplica(t *testing.T) {
+	schema := func(c *Collection) error {
+		c.CreateColumn("name", ForString())
+		c.CreateColumn("balance", ForInt64())
+		return nil
+	}
+
+	primary := NewCollection()
+	schema(primary)
+	for i := 0; i < 1000; i++ {
+		primary.Insert(func(r Row) error {
+			r.SetString("name", fmt.Sprintf("player-%d", i))
+			r.SetInt64("balance", 0)
+			return nil
+		})
+	}
+
+	// The replica may have additional indexes
+	replica, err := primary.NewReplica(func(c *Collection) error {
+		schema(c)
+		return c.CreateIndex("rich", "balance", func(r Reader) bool {
+			return r.Int() >= 100
+		})
+	})
+	assert.NoError(t, err)
+	defer replica.Close()
+	assert.Equal(t, 1000, replica.Count())
+
+	// Concurrently merge the balances, while the replica is being read
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				primary.Query(func(txn *Txn) error {
+					balance := txn.Int64("balance")
+					return txn.Range(func(idx uint32) {
+						balance.Merge(1)
+					})
+				})
+				replica.Query(func(txn *Txn) error {
+					txn.With("rich").Count()
+					return nil
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+	primary.DeleteAt(0)
+	replica.Sync()
+	assert.Equal(t, 0, replica.Pending())
+	assert.Equal(t, 999, replica.Count())
+	assert.NoError(t, replica.QueryAt(500, func(r Row) error {
+		balance, _ := r.Int64("balance")
+		assert.Equal(t, int64(400), balance)
+		return nil
+	}))
+
+	assert.NoError(t, replica.Query(func(txn *Txn) error {
+		assert.Equal(t, 999, txn.With("rich").Count())
+		return nil
+	}))
+
+	// The replica can not be updated
+	assert.Error(t, replica.QueryAt(1, func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	}))
+	assert.Error(t, replica.Query(func(txn *Txn) error {
+		_, err := txn.Insert(func(r Row) error { return nil })
+		return err
+	}))
+	assert.Equal(t, 999, replica.Count())
+
+	// Once closed, the replica no longer receives the commits
+	assert.NoError(t, replica.Close())
+	primary.DeleteAt(1)
+	replica.Sync()
+	assert.Equal(t, 999, replica.Count())
+}
+
+func TestNewReplicaError(t *testing.T) {
+	primary := NewCollection()
+	_, err := primary.NewReplica(func(c *Collection) error {
+		return fmt.Errorf("boom")
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Retention represents a retention policy of a collection, which deletes the rows whose
+// timestamp is older than the retention period. The timestamp column must contain the time
+// in unix nanoseconds, such as the columns created with the WithAutoNow() option.
+type Retention struct {
+	Column string        // The name of the timestamp column
+	Period time.Duration // The period for which the rows are retained
+}
+
+// WithRetention creates a retention policy which deletes the rows whose timestamp in the
+// specified column is older than the period, to be used in the Retention option.
+func WithRetention(columnName string, period time.Duration) Retention {
+	return Retention{Column: columnName, Period: period}
+}
+
+// RetentionStats represents the rows purged by a retention policy of a collection
+type RetentionStats struct {
+	Retention           // The retention policy
+	Purged    int       // The number of rows purged since the collection was created
+	LastPurge time.Time // The time at which rows were last purged, if any
+}
+
+// retentionStats keeps the statistics of the retention policies, by column
+type retentionStats struct {
+	lock  sync.Mutex
+	stats map[string]RetentionStats
+}
+
+// observe records the rows purged by a retention policy
+func (s *retentionStats) observe(policy Retention, purged int, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stats == nil {
+		s.stats = make(map[string]RetentionStats)
+	}
+
+	stats := s.stats[policy.Column]
+	stats.Retention = policy
+	if purged > 0 {
+		stats.Purged += purged
+		stats.LastPurge = now
+	}
+	s.stats[policy.Column] = stats
+}
+
+// RetentionStats returns the statistics of the retention policies which were enforced at least
+// once, ordered by the name of their column.
+func (c *Collection) RetentionStats() []RetentionStats {
+	c.retained.lock.Lock()
+	defer c.retained.lock.Unlock()
+
+	out := make([]RetentionStats, 0, len(c.retained.stats))
+	for _, stats := range c.retained.stats {
+		out = append(out, stats)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Column < out[j].Column
+	})
+	return out
+}
+
+// enforceRetention deletes the rows which are older than the period of each retention policy,
+// this is called periodically by the vacuum.
+func (c *Collection) enforceRetention(policies []Retention, now time.Time) {
+	for _, policy := range policies {
+		if policy.Period <= 0 {
+			continue
+		}
+
+		cutoff := now.Add(-policy.Period).UnixNano()
+		info, err := c.QueryInfo(func(txn *Txn) error {
+			txn.WithInt(policy.Column, func(v int64) bool {
+				return v < cutoff
+			}).DeleteAll()
+			return nil
+		})
+		if err != nil {
+			continue // The replicas are purged by their primary
+		}
+
+		c.retained.observe(policy, info.Deleted, now)
+		if l := currentLogger(); l != nil && info.Deleted > 0 {
+			l.Info("column: rows purged", "column", policy.Column, "rows", info.Deleted)
+		}
+	}
+}
+
+// sameRetention returns whether two sets of retention policies are identical
+func sameRetention(a, b []Retention) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
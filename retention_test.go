@@ -0,0 +1,79 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention(t *testing.T) {
+	c := NewCollection(Options{
+		Vacuum:    10 * time.Millisecond,
+		Retention: []Retention{WithRetention("ts", time.Hour)},
+	})
+	defer c.Close()
+	c.CreateColumn("ts", ForInt64(WithAutoNow()))
+
+	old := time.Now().Add(-2 * time.Hour).UnixNano()
+	for i := 0; i < 1000; i++ {
+		c.Insert(func(r Row) error {
+			if i%4 == 0 {
+				r.SetInt64("ts", old)
+			}
+			return nil
+		})
+	}
+
+	// The old rows are purged in the background
+	assert.Eventually(t, func() bool {
+		return c.Count() == 750
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := c.RetentionStats()
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "ts", stats[0].Column)
+	assert.Equal(t, time.Hour, stats[0].Period)
+	assert.Equal(t, 250, stats[0].Purged)
+	assert.False(t, stats[0].LastPurge.IsZero())
+}
+
+func TestEnforceRetention(t *testing.T) {
+	c := NewCollection(Options{Vacuum: -1})
+	defer c.Close()
+	c.CreateColumn("ts", ForInt64())
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		c.Insert(func(r Row) error {
+			r.SetInt64("ts", now.Add(-time.Duration(i)*time.Minute).UnixNano())
+			return nil
+		})
+	}
+
+	c.enforceRetention([]Retention{
+		WithRetention("ts", 0),
+		WithRetention("invalid", time.Minute),
+		WithRetention("ts", 30*time.Minute),
+	}, now)
+	assert.Equal(t, 31, c.Count())
+	assert.Equal(t, []RetentionStats{{
+		Retention: WithRetention("invalid", time.Minute),
+	}, {
+		Retention: WithRetention("ts", 30*time.Minute),
+		Purged:    69,
+		LastPurge: now,
+	}}, c.RetentionStats())
+
+	// The retention is merged with the other options
+	var options Options
+	options.merge(Options{Retention: []Retention{WithRetention("a", time.Hour)}})
+	options.merge(Options{Retention: []Retention{WithRetention("b", time.Hour)}})
+	assert.Len(t, options.Retention, 2)
+	assert.True(t, sameRetention(options.Retention, options.Retention))
+	assert.False(t, sameRetention(options.Retention, options.Retention[:1]))
+	assert.False(t, sameRetention(options.Retention[:1], options.Retention[1:]))
+}
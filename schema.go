@@ -0,0 +1,54 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import "reflect"
+
+// ColumnSchema represents a column of a collection along with the kind of its values
+type ColumnSchema struct {
+	Name string       // The name of the column
+	Kind reflect.Kind // The kind of the values, or reflect.String for the values read as text
+}
+
+// Schema returns the specified columns along with the kind of their values, or the columns
+// exported by default by Export() if none is specified. This allows to describe the columns
+// to external consumers, such as the query servers, before reading any row. The values which
+// are not numbers or booleans are reported as text, as well as the values of the masked
+// columns unless the transaction was unmasked.
+func (txn *Txn) Schema(columnNames ...string) ([]ColumnSchema, error) {
+	columns, err := txn.exportColumns(columnNames)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make([]ColumnSchema, 0, len(columns))
+	for _, column := range columns {
+		kind := valueKindOf(column.Column)
+		if txn.maskOf(column.name) != nil {
+			kind = reflect.String // The masked values may not be numbers
+		}
+		schema = append(schema, ColumnSchema{Name: column.name, Kind: kind})
+	}
+	return schema, nil
+}
+
+// valueKind returns the kind of the values of a numeric column
+func (c *numericColumn[T]) valueKind() reflect.Kind {
+	return reflect.TypeOf(T(0)).Kind()
+}
+
+// valueKindOf returns the kind of the values of a column, or reflect.String if they are not
+// numbers or booleans.
+func valueKindOf(c Column) reflect.Kind {
+	switch v := c.(type) {
+	case interface{ valueKind() reflect.Kind }:
+		return v.valueKind()
+	case *columnBool:
+		return reflect.Bool
+	case *columnCounter, *columnPacked:
+		return reflect.Int64
+	default:
+		return reflect.String
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("name", ForString())
+	c.CreateColumn("active", ForBool())
+	c.CreateColumn("balance", ForFloat64())
+	c.CreateColumn("age", ForInt32(WithMask[int32](func(any) any {
+		return "***"
+	})))
+	c.CreateIndex("rich", "balance", func(r Reader) bool {
+		return r.Float() >= 100
+	})
+
+	// The schema is available without any row, the masked columns are text
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		schema, err := txn.Schema()
+		assert.NoError(t, err)
+		assert.Equal(t, []ColumnSchema{
+			{Name: "active", Kind: reflect.Bool},
+			{Name: "age", Kind: reflect.String},
+			{Name: "balance", Kind: reflect.Float64},
+			{Name: "name", Kind: reflect.String},
+		}, schema)
+
+		schema, err = txn.Schema("balance")
+		assert.NoError(t, err)
+		assert.Equal(t, []ColumnSchema{{Name: "balance", Kind: reflect.Float64}}, schema)
+
+		_, err = txn.Schema("invalid")
+		assert.Error(t, err)
+		return nil
+	}))
+}
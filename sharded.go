@@ -0,0 +1,141 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Sharded represents a set of collections which partition the rows by the hash of their
+// primary key. Since each shard has its own locks, the contention of the writers decreases
+// with the number of shards. The queries are executed on all of the shards concurrently,
+// and each shard commits independently, hence a query is not atomic across the shards.
+type Sharded struct {
+	shards []*Collection // The underlying collections
+}
+
+// NewSharded creates a new set of collections partitioned by the primary key. The schema
+// function is called for each of the shards and must create a key column using ForKey().
+func NewSharded(shards int, schema func(*Collection) error, opts ...Options) (*Sharded, error) {
+	if shards < 1 || schema == nil {
+		return nil, fmt.Errorf("column: sharded collection must specify shards and a schema")
+	}
+
+	sharded := &Sharded{
+		shards: make([]*Collection, 0, shards),
+	}
+
+	for i := 0; i < shards; i++ {
+		shard := NewCollection(opts...)
+		sharded.shards = append(sharded.shards, shard)
+		switch err := schema(shard); {
+		case err != nil:
+			sharded.Close()
+			return nil, err
+		case shard.pk == nil:
+			sharded.Close()
+			return nil, fmt.Errorf("column: sharded collection requires a key column")
+		}
+	}
+
+	return sharded, nil
+}
+
+// Shard returns the collection which contains the row with the specified key.
+func (s *Sharded) Shard(key string) *Collection {
+	return s.shards[xxh3.HashString(key)%uint64(len(s.shards))]
+}
+
+// InsertKey inserts a row given its corresponding primary key.
+func (s *Sharded) InsertKey(key string, fn func(Row) error) error {
+	return s.Shard(key).InsertKey(key, fn)
+}
+
+// UpsertKey inserts or updates a row given its corresponding primary key.
+func (s *Sharded) UpsertKey(key string, fn func(Row) error) error {
+	return s.Shard(key).UpsertKey(key, fn)
+}
+
+// QueryKey queries/updates a row given its corresponding primary key.
+func (s *Sharded) QueryKey(key string, fn func(Row) error) error {
+	return s.Shard(key).QueryKey(key, fn)
+}
+
+// DeleteKey deletes a row for a given primary key.
+func (s *Sharded) DeleteKey(key string) error {
+	return s.Shard(key).DeleteKey(key)
+}
+
+// Query executes the transaction on all of the shards concurrently. Each shard commits or
+// rolls back its own transaction, and the first error encountered is returned.
+func (s *Sharded) Query(fn func(txn *Txn) error) error {
+	return Gather(s.shards, fn)
+}
+
+// Count returns the total number of rows across all of the shards.
+func (s *Sharded) Count() (count int) {
+	for _, shard := range s.shards {
+		count += shard.Count()
+	}
+	return
+}
+
+// Reduce computes an aggregation over a numeric column for the rows selected by the filter
+// on all of the shards, merging their partial results. The filter is optional.
+func (s *Sharded) Reduce(agg Aggregate, filter func(txn *Txn) *Txn) (float64, error) {
+	return GatherReduce(s.shards, agg, filter)
+}
+
+// Top finds the n rows with the largest values of a numeric column, among the rows selected
+// by the filter on all of the shards. The collection of each row is the position of its shard.
+func (s *Sharded) Top(columnName string, n int, filter func(txn *Txn) *Txn) ([]Ranked, error) {
+	return GatherTop(s.shards, columnName, n, filter)
+}
+
+// RegisterAggregate registers an aggregate with a specified name on all of the shards.
+func (s *Sharded) RegisterAggregate(aggregateName string, agg Aggregate) error {
+	for _, shard := range s.shards {
+		if err := shard.RegisterAggregate(aggregateName, agg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Aggregate returns the current value of a registered aggregate, merged across all of the
+// shards. It returns false if the aggregate does not exist, or if there are no values to
+// aggregate (except for the count).
+func (s *Sharded) Aggregate(aggregateName string) (float64, bool) {
+	var fn Aggregation
+	var total accumulator
+	for _, shard := range s.shards {
+		column, ok := shard.cols.Load(aggregateName)
+		if !ok {
+			return 0, false
+		}
+
+		aggregate, ok := column.Column.(*columnAggregate)
+		if !ok {
+			return 0, false
+		}
+
+		fn = aggregate.fn
+		aggregate.accumulate(&total)
+	}
+
+	if total.count == 0 && fn != AggCount {
+		return 0, false
+	}
+	return total.result(fn), true
+}
+
+// Close closes all of the shards.
+func (s *Sharded) Close() error {
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+	return nil
+}
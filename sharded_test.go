@@ -0,0 +1,104 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharded(t *testing.T) {
+	sharded, err := NewSharded(4, func(c *Collection) error {
+		c.CreateColumn("id", ForKey())
+		c.CreateColumn("age", ForInt())
+		return nil
+	})
+	assert.NoError(t, err)
+	defer sharded.Close()
+	assert.NoError(t, sharded.RegisterAggregate("total", Sum("age")))
+
+	// Insert concurrently, the rows are distributed across the shards
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 1000; i += 4 {
+				assert.NoError(t, sharded.InsertKey(fmt.Sprint(i), func(r Row) error {
+					r.SetInt("age", i%100)
+					return nil
+				}))
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1000, sharded.Count())
+	for _, shard := range sharded.shards {
+		assert.Greater(t, shard.Count(), 150)
+	}
+
+	// Rows are routed by their key
+	assert.NoError(t, sharded.QueryKey("42", func(r Row) error {
+		age, _ := r.Int("age")
+		assert.Equal(t, 42, age)
+		return nil
+	}))
+	assert.NoError(t, sharded.DeleteKey("42"))
+	assert.Error(t, sharded.QueryKey("42", func(r Row) error { return nil }))
+	assert.NoError(t, sharded.UpsertKey("42", func(r Row) error {
+		r.SetInt("age", 100)
+		return nil
+	}))
+
+	// The results of the shards are merged
+	sum, err := sharded.Reduce(Sum("age"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(49558), sum)
+
+	total, ok := sharded.Aggregate("total")
+	assert.True(t, ok)
+	assert.Equal(t, sum, total)
+
+	count, err := sharded.Reduce(Count("age"), func(txn *Txn) *Txn {
+		return txn.WithInt("age", func(v int64) bool { return v >= 50 })
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(501), count)
+
+	max, err := sharded.Reduce(Max("age"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), max)
+
+	avg, err := sharded.Reduce(Avg("age"), nil)
+	assert.NoError(t, err)
+	assert.InDelta(t, 49.558, avg, 1e-9)
+
+	// Queries are executed on every shard
+	assert.NoError(t, sharded.Query(func(txn *Txn) error {
+		age := txn.Int("age")
+		return txn.Range(func(idx uint32) {
+			age.Merge(1)
+		})
+	}))
+	sum, _ = sharded.Reduce(Sum("age"), nil)
+	assert.Equal(t, float64(50558), sum)
+
+	_, err = sharded.Reduce(Sum("missing"), nil)
+	assert.Error(t, err)
+	_, ok = sharded.Aggregate("missing")
+	assert.False(t, ok)
+}
+
+func TestShardedInvalid(t *testing.T) {
+	_, err := NewSharded(0, func(c *Collection) error { return nil })
+	assert.Error(t, err)
+	_, err = NewSharded(2, func(c *Collection) error { return nil })
+	assert.Error(t, err)
+	_, err = NewSharded(2, func(c *Collection) error { return fmt.Errorf("boom") })
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// LoggingOptions represents the options of the diagnostic logs of a collection.
+type LoggingOptions struct {
+	// SlowQueries is the logger receiving the queries which took at least SlowQueryThreshold,
+	// along with the filters they applied and the number of rows they scanned (optional).
+	SlowQueries        SlowQueryLogger
+	SlowQueryThreshold time.Duration
+
+	// Logger receives the operational warnings of the collection instead of the logger set
+	// with SetLogger() (optional). LargeCommitSize and SlowLockWait are the thresholds from
+	// which the oversized commits and the contended chunk locks are reported, which are 64MB
+	// and 100ms by default.
+	Logger          Logger
+	LargeCommitSize int
+	SlowLockWait    time.Duration
+}
+
+// merge merges the options specified on top of the current ones, ignoring the zero values.
+func (o *LoggingOptions) merge(other LoggingOptions) {
+	if other.SlowQueries != nil {
+		o.SlowQueries = other.SlowQueries
+	}
+	if other.SlowQueryThreshold > 0 {
+		o.SlowQueryThreshold = other.SlowQueryThreshold
+	}
+	if other.Logger != nil {
+		o.Logger = other.Logger
+	}
+	if other.LargeCommitSize > 0 {
+		o.LargeCommitSize = other.LargeCommitSize
+	}
+	if other.SlowLockWait > 0 {
+		o.SlowLockWait = other.SlowLockWait
+	}
+}
+
+// SlowQueryLogger represents a logger which receives the queries of a collection which took
+// longer than the configured threshold. It is called synchronously once the query completes,
+// hence it should return quickly.
+type SlowQueryLogger interface {
+	OnSlowQuery(query SlowQuery)
+}
+
+// SlowQuery represents the information about a query which exceeded the slow query threshold
+type SlowQuery struct {
+	Filters  []string      // The filters applied by the query, in order, such as "with(rogue)"
+	Scanned  int           // The number of rows scanned by the value filters
+	Selected int           // The number of rows selected once the query completed
+	Duration time.Duration // The duration of the query, including its commit
+	Err      error         // The error returned by the query, if any
+}
+
+// String returns a human-readable representation of the slow query
+func (q SlowQuery) String() string {
+	var out strings.Builder
+	out.WriteString("slow query (")
+	out.WriteString(q.Duration.String())
+	out.WriteString("): ")
+	if len(q.Filters) == 0 {
+		out.WriteString("<all>")
+	}
+
+	out.WriteString(strings.Join(q.Filters, "."))
+	return out.String()
+}
+
+// --------------------------- Query Trace ----------------------------
+
+// queryTrace records the filters applied by a transaction for the slow query log, it is only
+// enabled when a slow query logger is configured.
+type queryTrace struct {
+	enabled bool      // Whether the filters are recorded
+	start   time.Time // The time at which the query started
+	filters []string  // The filters applied by the query
+	scanned int       // The number of rows scanned by the value filters
+}
+
+// begin starts the trace of a query, if the slow query log is enabled
+func (t *queryTrace) begin(enabled bool) {
+	t.enabled = enabled
+	t.filters = t.filters[:0]
+	t.scanned = 0
+	if enabled {
+		t.start = time.Now()
+	}
+}
+
+// trace records a filter applied by the transaction. If the filter scans the values, the rows
+// currently selected are counted as scanned.
+func (txn *Txn) trace(op string, scan bool, args ...string) {
+	if !txn.tracer.enabled {
+		return
+	}
+
+	txn.tracer.filters = append(txn.tracer.filters, op+"("+strings.Join(args, ", ")+")")
+	if scan {
+		txn.tracer.scanned += int(txn.index.Count())
+	}
+}
+
+// traceFilter records a composable filter applied by the transaction
+func (txn *Txn) traceFilter(filter Filter) {
+	if txn.tracer.enabled {
+		encoded, _ := json.Marshal(filter)
+		txn.trace("withFilter", true, string(encoded))
+	}
+}
+
+// selected returns the number of rows selected by the transaction, without initializing it
+func (txn *Txn) selected() int {
+	if !txn.setup {
+		return txn.owner.Count()
+	}
+	return int(txn.index.Count())
+}
+
+// observeSlow reports the query to the slow query logger, if it exceeded the threshold
+func (c *Collection) observeSlow(txn *Txn, err error) {
+	if !txn.tracer.enabled {
+		return
+	}
+
+	elapsed := time.Since(txn.tracer.start)
+	if elapsed < c.options().Logging.SlowQueryThreshold {
+		return
+	}
+
+	c.options().Logging.SlowQueries.OnSlowQuery(SlowQuery{
+		Filters:  append([]string(nil), txn.tracer.filters...),
+		Scanned:  txn.tracer.scanned,
+		Selected: txn.selected(),
+		Duration: elapsed,
+		Err:      err,
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type slowQueries []SlowQuery
+
+func (s *slowQueries) OnSlowQuery(query SlowQuery) {
+	*s = append(*s, query)
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	var log slowQueries
+	players := loadPlayers(500)
+	players.configure(Options{
+		Capacity: players.Options().Capacity,
+		Vacuum:   players.Options().Vacuum,
+		Logging:  LoggingOptions{SlowQueries: &log},
+	})
+
+	var scanned, selected int
+	players.Query(func(txn *Txn) error {
+		scanned = txn.With("human").Without("mage").Count()
+		selected = txn.WithString("class", func(v string) bool {
+			return v == "rogue"
+		}).Count()
+		return nil
+	})
+
+	log = log[:0]
+	players.Query(func(txn *Txn) error {
+		txn.With("human").Without("mage").WithString("class", func(v string) bool {
+			return v == "rogue"
+		})
+		return nil
+	})
+
+	players.Query(func(txn *Txn) error {
+		return errors.New("boom")
+	})
+
+	assert.Len(t, log, 2)
+	assert.Equal(t, []string{"with(human)", "without(mage)", "withString(class)"}, log[0].Filters)
+	assert.Equal(t, scanned, log[0].Scanned)
+	assert.Equal(t, selected, log[0].Selected)
+	assert.NoError(t, log[0].Err)
+	assert.Contains(t, log[0].String(), "with(human).without(mage).withString(class)")
+	assert.Empty(t, log[1].Filters)
+	assert.Equal(t, 500, log[1].Selected)
+	assert.Error(t, log[1].Err)
+	assert.Contains(t, log[1].String(), "<all>")
+
+	// The queries below the threshold are not logged
+	players.options().Logging.SlowQueryThreshold = time.Hour
+	players.Query(func(txn *Txn) error {
+		txn.WithExpr("age > 30").Count()
+		return nil
+	})
+	assert.Len(t, log, 2)
+}
@@ -4,11 +4,15 @@
 package column
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/kelindar/bitmap"
@@ -21,11 +25,107 @@ var (
 	errUnexpectedEOF = errors.New("column: unable to restore, unexpected EOF")
 )
 
+// snapshotVersion is the version of the snapshot format. Version 2 embeds the commit
+// log using the versioned commit encoding, version 3 the configuration profile,
+// version 4 the index definitions along with their optional bitmaps, version 5 the
+// schema version of the collection, version 6 the messages pending in the outbox and
+// version 7 prefixes the commit log and the pages with their format version and version 8
+// the type names of the columns. Since the versions 2 to 6 were never released, only the
+// version 1 needs to remain readable.
+const snapshotVersion = 0x8
+
+// snapshotHeader represents the versions of a snapshot which was read
+type snapshotHeader struct {
+	version uint64 // The version of the snapshot format
+	schema  uint64 // The schema version of the collection, zero if unknown
+}
+
 // --------------------------- Commit Replay ---------------------------
 
-// Replay replays a commit on a collection, applying the changes.
+// Replay replays a commit on a collection, applying the changes. The update buffers are
+// validated first, and a malformed commit is rejected without applying any of its changes.
 func (c *Collection) Replay(change commit.Commit) error {
+	if err := validate(change); err != nil {
+		return err
+	}
+
+	if err := c.validateTypes(change); err != nil {
+		return err
+	}
+
+	return c.replay(change, c.commitLogger())
+}
+
+// validate checks that all of the updates of a commit are well-formed
+func validate(change commit.Commit) error {
+	for _, u := range change.Updates {
+		if err := commit.Validate(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTypes checks that the fixed-size values of a well-formed commit have the size
+// expected by the columns they target, since a value of another type would panic when the
+// column reads it while holding the chunk lock.
+func (c *Collection) validateTypes(change commit.Commit) error {
+	reader := commit.NewReader()
+	for _, u := range change.Updates {
+		column, ok := c.cols.Load(u.Column)
+		if !ok {
+			continue
+		}
+
+		accepts := valueSizeOf(column.Column)
+		if accepts == nil {
+			continue
+		}
+
+		var err error
+		u.RangeChunks(func(chunk commit.Chunk) {
+			reader.Range(u, chunk, func(r *commit.Reader) {
+				for err == nil && r.Next() {
+					if (r.Type == commit.Put || r.Type == commit.Merge) && !accepts(r.Size()) {
+						err = fmt.Errorf("column: invalid value of %d bytes for column '%s' at %d",
+							r.Size(), u.Column, r.Index())
+					}
+				}
+			})
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueSizeOf returns a function which checks whether a value of the specified size can be
+// read by the column, or nil if the column accepts values of any size.
+func valueSizeOf(c Column) func(size int) bool {
+	switch v := c.(type) {
+	case interface{ valueSize() int }:
+		size := v.valueSize()
+		return func(n int) bool { return n == size }
+	case *columnPacked:
+		return func(n int) bool { return n == 2 || n == 4 || n == 8 }
+	default:
+		return nil
+	}
+}
+
+// valueSize returns the size in bytes of the encoded values of a numeric column
+func (c *numericColumn[T]) valueSize() int {
+	return int(unsafe.Sizeof(T(0)))
+}
+
+// replay replays a commit which is known to be well-formed on a collection, and writes it
+// into the specified commit logger.
+func (c *Collection) replay(change commit.Commit, logger commit.Logger) error {
 	return c.Query(func(txn *Txn) error {
+		txn.system = true
+		txn.logger = logger
 		txn.dirty.Set(uint32(change.Chunk))
 		for i := range change.Updates {
 			if !change.Updates[i].IsEmpty() {
@@ -38,34 +138,100 @@ func (c *Collection) Replay(change commit.Commit) error {
 
 // --------------------------- Snapshotting ---------------------------
 
+// restoreOptions represents the options for restoring a snapshot
+type restoreOptions struct {
+	lazy       bool          // Whether the columns are restored on first access
+	logger     commit.Logger // The commit logger for the pending commits which are replayed
+	migrations []Migration   // The migrations of the older schema versions
+}
+
+// WithLazyRestore defers the restoration of the columns until they are first accessed, so
+// that the start-up time depends on the working set rather than on the size of the entire
+// collection. The row fill list is always restored immediately, along with the columns
+// which have indexes, the primary key and the automatically stamped columns.
+func WithLazyRestore() func(*restoreOptions) {
+	return func(v *restoreOptions) {
+		v.lazy = true
+	}
+}
+
+// snapshotOptions represents the options for writing a snapshot
+type snapshotOptions struct {
+	bitmaps    bool // Whether the bitmaps of the indexes are written
+	checkpoint bool // Whether the changed chunks are cleared once written
+}
+
+// WithIndexBitmaps writes the bitmaps of the indexes into the snapshot, so that Restore() loads
+// them instead of evaluating every index function over all of the rows. Since the functions
+// can not be serialized, the indexes must still be created with the same names, columns and
+// functions before restoring, and the indexes which do not match are evaluated as usual. The
+// bitmaps of the asynchronous indexes are never written, as they might be stale.
+func WithIndexBitmaps() func(*snapshotOptions) {
+	return func(v *snapshotOptions) {
+		v.bitmaps = true
+	}
+}
+
 // Restore restores the collection from the underlying snapshot reader. This operation
 // should be called before any of transactions, right after initialization.
-func (c *Collection) Restore(snapshot io.Reader) error {
-	commits, err := c.readState(s2.NewReader(snapshot))
+func (c *Collection) Restore(snapshot io.Reader, opts ...func(*restoreOptions)) error {
+	options := restoreOptions{logger: c.commitLogger()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	commits, header, err := c.readState(s2.NewReader(snapshot), opts...)
+	c.sums.drop("")
+	c.measureSizes()
+	atomic.AddUint64(&c.revision, 1)
+	c.resetHistory()
 	if err != nil {
 		return err
 	}
 
+	// The format of the commit log is detected, older snapshots contain a legacy log
+	log := commit.Open(snapshot)
+
+	// The pending commits were written with the schema of the snapshot
+	upgrade := newMigrator(header.schema, options.migrations)
+
 	// Reconcile the pending commit log
-	return commit.Open(snapshot).Range(func(commit commit.Commit) error {
+	return log.Range(func(commit commit.Commit) error {
+		if err := validate(commit); err != nil {
+			return err
+		}
+
+		// The messages are recovered even if the changes are already part of the snapshot
+		if err := c.recoverOutbox(commit); err != nil {
+			return err
+		}
+
 		lastCommit := commits[commit.Chunk]
-		if commit.ID > lastCommit {
-			return c.Replay(commit)
+		if commit.ID <= lastCommit {
+			return nil
 		}
-		return nil
+
+		commit = upgrade.migrateCommit(commit)
+		if err := c.validateTypes(commit); err != nil {
+			return err
+		}
+		return c.replay(commit, options.logger)
 	})
 }
 
 // Snapshot writes a collection snapshot into the underlying writer.
-func (c *Collection) Snapshot(dst io.Writer) error {
+func (c *Collection) Snapshot(dst io.Writer, opts ...func(*snapshotOptions)) error {
 	recorder, err := c.recorderOpen()
 	if err != nil {
 		return err
 	}
 
-	// Take a snapshot of the current state
+	// Take a snapshot of the current state and clear the changed chunks
 	defer os.Remove(recorder.Name())
-	if _, err := c.writeState(s2.NewWriter(dst)); err != nil {
+	opts = append(opts, func(v *snapshotOptions) {
+		v.checkpoint = true
+	})
+	if _, err := c.writeState(s2.NewWriter(dst), opts...); err != nil {
 		return err
 	}
 
@@ -74,6 +240,26 @@ func (c *Collection) Snapshot(dst io.Writer) error {
 	return recorder.Copy(dst)
 }
 
+// MarshalBinary encodes a snapshot of the collection, so that it can be embedded in some other
+// serialized state, for example using encoding/gob.
+func (c *Collection) MarshalBinary() ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	if err := c.Snapshot(buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalBinary restores the collection from a snapshot encoded with MarshalBinary(). Since
+// the snapshot does not contain the schema, the collection must be created with its columns
+// beforehand and, similarly to Restore(), this must be done before any of the transactions.
+func (c *Collection) UnmarshalBinary(data []byte) error {
+	if c.txns == nil {
+		return fmt.Errorf("column: unable to unmarshal, the collection must be created first")
+	}
+	return c.Restore(bytes.NewReader(data))
+}
+
 // recorderOpen opens a recorder for commits while the snapshot is in progress
 func (c *Collection) recorderOpen() (log *commit.Log, err error) {
 	if log, err = commit.OpenTemp(); err == nil {
@@ -108,81 +294,220 @@ func (c *Collection) isSnapshotting() (*commit.Log, bool) {
 // --------------------------- Collection Encoding ---------------------------
 
 // writeState writes collection state into the specified writer.
-func (c *Collection) writeState(dst io.Writer) (int64, error) {
+func (c *Collection) writeState(dst io.Writer, opts ...func(*snapshotOptions)) (int64, error) {
+	var options snapshotOptions
+	for _, fn := range opts {
+		fn(&options)
+	}
+
 	writer := iostream.NewWriter(dst)
 	buffer := c.txns.acquirePage(rowColumn)
 	defer c.txns.releasePage(buffer)
 
-	// Write the schema version
-	if err := writer.WriteUvarint(0x1); err != nil {
+	// Write the header
+	indexes, bitmaps := c.indexDefs(options.bitmaps)
+	if err := c.writeHeader(writer, indexes, bitmaps); err != nil {
 		return writer.Offset(), err
 	}
 
-	// Load the number of columns and the max index
+	// Load the max index
 	chunks := c.chunks()
-	columns := uint64(c.cols.Count()) + 1 // extra 'insert' column
 
-	// Write the number of columns
-	if err := writer.WriteUvarint(columns); err != nil {
-		return writer.Offset(), err
-	}
+	// If the snapshot fails, the chunks which were written are marked as changed again
+	var written []changedChunk
+	defer func() {
+		for _, v := range written {
+			for _, name := range v.columns {
+				c.changes.mark(name, v.chunk)
+			}
+		}
+	}()
 
 	// Write each chunk
 	if err := writer.WriteRange(chunks, func(i int, w *iostream.Writer) error {
 		return c.readChunk(commit.Chunk(i), func(lastCommit uint64, chunk commit.Chunk, fill bitmap.Bitmap) error {
-			offset := chunk.Min()
-
-			// Write the last written commit for this chunk
-			if err := writer.WriteUvarint(lastCommit); err != nil {
-				return err
-			}
-
-			// Write the inserts column
-			buffer.Reset(rowColumn)
-			fill.Range(func(idx uint32) {
-				buffer.PutOperation(commit.Insert, offset+idx)
-			})
-			if err := writer.WriteSelf(buffer); err != nil {
-				return err
+			if options.checkpoint {
+				written = append(written, changedChunk{chunk: chunk, columns: c.changes.take(chunk)})
 			}
 
-			// Snapshot each column and write the buffer
-			return c.cols.RangeUntil(func(column *column) error {
-				if !column.Snapshot(chunk, buffer) {
-					return nil // Skip indexes
-				}
-				return writer.WriteSelf(buffer)
-			})
+			return c.writeChunk(writer, buffer, indexes, lastCommit, chunk, fill)
 		})
 	}); err != nil {
 		return writer.Offset(), err
 	}
 
-	return writer.Offset(), writer.Flush()
+	if err := writer.Flush(); err != nil {
+		return writer.Offset(), err
+	}
+
+	written = written[:0]
+	return writer.Offset(), nil
+}
+
+// writeHeader writes the header of the collection state, up to the number of columns.
+func (c *Collection) writeHeader(writer *iostream.Writer, indexes []indexDef, bitmaps int) error {
+
+	// Write the schema version
+	if err := writer.WriteUvarint(snapshotVersion); err != nil {
+		return err
+	}
+
+	// Write the configuration profile
+	if err := writer.WriteBytes(encodeProfile(*c.options())); err != nil {
+		return err
+	}
+
+	// Write the index definitions, along with whether their bitmaps are included
+	if err := writer.WriteRange(len(indexes), func(i int, w *iostream.Writer) error {
+		if err := w.WriteString(indexes[i].name); err != nil {
+			return err
+		}
+		if err := w.WriteString(indexes[i].column); err != nil {
+			return err
+		}
+		return w.WriteBool(indexes[i].bitmap)
+	}); err != nil {
+		return err
+	}
+
+	// Write the schema version, so that the older snapshots can be migrated
+	if err := writer.WriteUvarint(c.options().Storage.SchemaVersion); err != nil {
+		return err
+	}
+
+	// Write the messages pending delivery, the later ones are recorded in the commit log
+	if err := c.writeOutbox(writer); err != nil {
+		return err
+	}
+
+	// Write the type names of the columns, so they can be created on restore
+	if err := c.writeSchema(writer); err != nil {
+		return err
+	}
+
+	// Write the number of columns
+	columns := uint64(c.cols.Count()+bitmaps) + 1 // extra 'insert' column
+	return writer.WriteUvarint(columns)
+}
+
+// writeChunk writes the state of a chunk, along with the bitmaps of the indexes if requested.
+func (c *Collection) writeChunk(writer *iostream.Writer, buffer *commit.Buffer, indexes []indexDef, lastCommit uint64, chunk commit.Chunk, fill bitmap.Bitmap) error {
+	offset := chunk.Min()
+
+	// Write the last written commit for this chunk
+	if err := writer.WriteUvarint(lastCommit); err != nil {
+		return err
+	}
+
+	// Write the inserts column
+	buffer.Reset(rowColumn)
+	fill.Range(func(idx uint32) {
+		buffer.PutOperation(commit.Insert, offset+idx)
+	})
+	if err := writer.WriteSelf(buffer); err != nil {
+		return err
+	}
+
+	// Write the index bitmaps before the columns, so that the derived indexes are
+	// evaluated on the restored bitmaps
+	for _, index := range indexes {
+		if index.bitmap {
+			buffer.Reset(index.name)
+			index.index.Snapshot(chunk, buffer)
+			if err := writer.WriteSelf(buffer); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Snapshot each column and write the buffer
+	return c.cols.RangeUntil(func(column *column) error {
+		if !column.Snapshot(chunk, buffer) {
+			return nil // Skip indexes
+		}
+		return writer.WriteSelf(buffer)
+	})
 }
 
 // readState reads a collection snapshotted state from the underlying reader. It
-// returns the last commit IDs for each chunk.
-func (c *Collection) readState(src io.Reader) (map[commit.Chunk]uint64, error) {
+// returns the last commit IDs for each chunk, along with the versions of the snapshot.
+func (c *Collection) readState(src io.Reader, opts ...func(*restoreOptions)) (map[commit.Chunk]uint64, snapshotHeader, error) {
+	var options restoreOptions
+	for _, fn := range opts {
+		fn(&options)
+	}
+
 	r := iostream.NewReader(src)
 	commits := make(map[commit.Chunk]uint64)
 
 	// Read the version and make sure it matches
+	var header snapshotHeader
 	version, err := r.ReadUvarint()
-	if err != nil || version != 0x1 {
-		return nil, fmt.Errorf("column: unable to restore (version %d) %v", version, err)
+	if header.version = version; err != nil || version == 0 || version > snapshotVersion {
+		return nil, header, fmt.Errorf("column: unable to restore (version %d) %v", version, err)
+	}
+
+	// The unreleased versions did not prefix the pages with their format version
+	if version > 0x1 && version < 0x7 {
+		return nil, header, fmt.Errorf("column: unable to restore (version %d), unsupported format", version)
+	}
+
+	// Read the configuration profile and apply it
+	if version >= 0x3 {
+		profile, err := r.ReadBytes()
+		if err != nil {
+			return nil, header, err
+		}
+
+		options := *c.options()
+		if err := decodeProfile(profile, &options); err != nil {
+			return nil, header, err
+		}
+		c.configure(options)
+	}
+
+	// Read the index definitions and find the bitmaps which can be restored
+	var bitmaps map[string]*columnIndex
+	if version >= 0x4 {
+		if bitmaps, err = c.readIndexDefs(r); err != nil {
+			return nil, header, err
+		}
+	}
+
+	// Read the schema version, the older snapshots are migrated from the first version
+	if version >= 0x5 {
+		if header.schema, err = r.ReadUvarint(); err != nil {
+			return nil, header, err
+		}
+	}
+
+	// Read the messages pending delivery
+	if version >= 0x6 {
+		if err := c.readOutbox(r); err != nil {
+			return nil, header, err
+		}
+	}
+
+	// Read the type names of the columns and create the missing ones
+	upgrade := newMigrator(header.schema, options.migrations)
+	if version >= 0x8 {
+		if err := c.readSchema(r, upgrade); err != nil {
+			return nil, header, err
+		}
 	}
 
 	// Read the number of columns
 	columns, err := r.ReadUvarint()
 	if err != nil {
-		return nil, err
+		return nil, header, err
 	}
 
 	// Read each chunk
-	return commits, r.ReadRange(func(chunk int, r *iostream.Reader) error {
+	return commits, header, r.ReadRange(func(chunk int, r *iostream.Reader) error {
 		return c.Query(func(txn *Txn) error {
+			txn.system = true
 			txn.dirty.Set(uint32(chunk))
+			txn.restored = bitmaps
 
 			// Read the last written commit ID for the chunk
 			if commits[commit.Chunk(chunk)], err = r.ReadUvarint(); err != nil {
@@ -197,6 +522,18 @@ func (c *Collection) readState(src io.Reader) (map[commit.Chunk]uint64, error) {
 					return errUnexpectedEOF
 				case err != nil:
 					return err
+				}
+
+				// Upgrade the pages written with an older schema
+				if buffer = upgrade.migrate(buffer); buffer == nil {
+					continue // The column was dropped
+				}
+
+				switch {
+				case c.loadIndex(commit.Chunk(chunk), buffer, bitmaps):
+					continue // Restored from the index bitmap
+				case options.lazy && c.deferPage(buffer):
+					continue // Restored on first access
 				default:
 					txn.updates = append(txn.updates, buffer)
 				}
@@ -207,6 +544,191 @@ func (c *Collection) readState(src io.Reader) (map[commit.Chunk]uint64, error) {
 	})
 }
 
+// deferPage defers a snapshot page until its column is first accessed. It returns false
+// if the column must be restored immediately instead.
+func (c *Collection) deferPage(page *commit.Buffer) bool {
+	columns, ok := c.cols.lookup(page.Column)
+	if !ok || len(columns) != 1 || columns[0] == nil || columns[0].IsIndex() {
+		return false // Unknown columns and columns with indexes
+	}
+
+	// The primary key and the sequences must be up to date for the next inserts
+	if _, ok := columns[0].Column.(*columnKey); ok {
+		return false
+	}
+	if mode, _ := columns[0].stampMode(); mode != 0 {
+		return false
+	}
+
+	columns[0].deferPage(page)
+	return true
+}
+
+// indexDef represents the definition of an index in a snapshot
+type indexDef struct {
+	name   string       // The name of the index
+	column string       // The name of the indexed column
+	bitmap bool         // Whether the bitmap of the index is written
+	index  *columnIndex // The index itself
+}
+
+// indexDefs returns the definitions of the indexes of the collection, along with the number
+// of bitmaps which will be written.
+func (c *Collection) indexDefs(bitmaps bool) (defs []indexDef, count int) {
+	c.cols.Range(func(column *column) {
+		if index, ok := column.Column.(*columnIndex); ok {
+			def := indexDef{name: column.name, column: index.name, index: index}
+			if def.bitmap = bitmaps && index.async == nil; def.bitmap {
+				count++
+			}
+			defs = append(defs, def)
+		}
+	})
+	return
+}
+
+// writeSchema writes the names of the columns along with the names of their registered types.
+// The columns whose type is not registered are omitted, and must be created before restoring.
+func (c *Collection) writeSchema(w *iostream.Writer) error {
+	var names, types []string
+	c.cols.Range(func(column *column) {
+		if typ := column.typeName(); typ != "" && !column.IsIndex() && !isPseudo(column.name) {
+			names = append(names, column.name)
+			types = append(types, typ)
+		}
+	})
+
+	return w.WriteRange(len(names), func(i int, w *iostream.Writer) error {
+		if err := w.WriteString(names[i]); err != nil {
+			return err
+		}
+		return w.WriteString(types[i])
+	})
+}
+
+// readSchema reads the names and types of the columns, creating the columns which do not exist
+// in the collection using their registered constructor. The existing columns are kept as-is.
+func (c *Collection) readSchema(r *iostream.Reader, upgrade *migrator) error {
+	return r.ReadRange(func(i int, r *iostream.Reader) error {
+		name, err := r.ReadString()
+		if err != nil {
+			return err
+		}
+
+		typ, err := r.ReadString()
+		if err != nil {
+			return err
+		}
+
+		// The columns which were dropped or converted by a migration are not created
+		name, ok := upgrade.column(name)
+		if !ok {
+			return nil
+		}
+
+		if _, ok := c.cols.Load(name); ok {
+			return nil
+		}
+
+		column, err := ForType(typ)
+		if err != nil {
+			return fmt.Errorf("column: unable to restore column '%s', %w", name, err)
+		}
+		return c.CreateColumn(name, column)
+	})
+}
+
+// readIndexDefs reads the index definitions of a snapshot. It returns the bitmaps of the
+// snapshot, mapped to the index they can be restored into or nil if there is none.
+func (c *Collection) readIndexDefs(r *iostream.Reader) (map[string]*columnIndex, error) {
+	bitmaps := make(map[string]*columnIndex)
+	return bitmaps, r.ReadRange(func(i int, r *iostream.Reader) error {
+		name, err := r.ReadString()
+		if err != nil {
+			return err
+		}
+
+		target, err := r.ReadString()
+		if err != nil {
+			return err
+		}
+
+		switch bitmap, err := r.ReadBool(); {
+		case err != nil:
+			return err
+		case !bitmap:
+			return nil
+		}
+
+		// The bitmap can only be restored into an index of the same column
+		bitmaps[name] = nil
+		if column, ok := c.cols.Load(name); ok {
+			if index, ok := column.Column.(*columnIndex); ok && index.name == target && index.async == nil {
+				bitmaps[name] = index
+			}
+		}
+		return nil
+	})
+}
+
+// loadIndex loads a snapshot page with the bitmap of an index, instead of evaluating the
+// index on the rows. It returns false if the page is not an index bitmap.
+func (c *Collection) loadIndex(chunk commit.Chunk, page *commit.Buffer, bitmaps map[string]*columnIndex) bool {
+	index, ok := bitmaps[page.Column]
+	if !ok {
+		return false
+	}
+
+	defer c.txns.releasePage(page)
+	if index != nil {
+		c.slock.Lock(uint(chunk))
+		index.load(page)
+		c.slock.Unlock(uint(chunk))
+	}
+	return true
+}
+
+// encodeProfile encodes the configuration profile of the collection. The writer and the
+// metrics sink are not part of the profile, as they can not be serialized.
+func encodeProfile(options Options) []byte {
+	profile := make([]byte, 0, 32)
+	profile = binary.AppendUvarint(profile, uint64(options.Capacity))
+	profile = binary.AppendVarint(profile, int64(options.Vacuum))
+	profile = binary.AppendUvarint(profile, uint64(options.Query.Cache))
+	if options.Storage.Lifecycle {
+		return append(profile, 1)
+	}
+	return append(profile, 0)
+}
+
+// decodeProfile decodes the configuration profile onto the destination options. Any trailing
+// bytes are ignored, so that new settings can be appended to the profile.
+func decodeProfile(profile []byte, dst *Options) error {
+	errInvalid := fmt.Errorf("column: unable to restore, invalid profile")
+	capacity, n := binary.Uvarint(profile)
+	if n <= 0 || capacity > math.MaxInt32 {
+		return errInvalid
+	}
+
+	profile = profile[n:]
+	vacuum, n := binary.Varint(profile)
+	if n <= 0 {
+		return errInvalid
+	}
+
+	profile = profile[n:]
+	cache, n := binary.Uvarint(profile)
+	if n <= 0 || cache > math.MaxInt32 || len(profile) <= n {
+		return errInvalid
+	}
+
+	dst.Capacity = int(capacity)
+	dst.Vacuum = time.Duration(vacuum)
+	dst.Query.Cache = int(cache)
+	dst.Storage.Lifecycle = profile[n] == 1
+	return nil
+}
+
 // chunks returns the number of chunks and columns
 func (c *Collection) chunks() int {
 	c.lock.Lock()
@@ -228,5 +750,12 @@ func (c *Collection) readChunk(chunk commit.Chunk, fn func(uint64, commit.Chunk,
 	c.lock.Lock()
 	defer c.slock.RUnlock(uint(chunk))
 	defer c.lock.Unlock()
+
+	// Do not persist the values which were corrupted in memory
+	if c.options().Storage.Paranoid {
+		if err := c.verifyChunk(chunk); err != nil {
+			return err
+		}
+	}
 	return fn(c.commits[chunk], chunk, chunk.OfBitmap(c.fill))
 }
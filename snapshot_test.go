@@ -6,6 +6,7 @@ package column
 import (
 	"bytes"
 	"context"
+	"encoding/gob"
 	"fmt"
 	"io"
 	"math"
@@ -15,6 +16,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/kelindar/async"
 	"github.com/kelindar/column/commit"
@@ -174,6 +176,52 @@ func runReplication(t *testing.T, updates, inserts, concurrency int) {
 	})
 }
 
+func TestReplayMalformed(t *testing.T) {
+	buffer := commit.NewBuffer(0)
+	buffer.Column = "float64"
+	buffer.PutFloat64(commit.Put, 10, 1)
+
+	// Corrupt the operation type of the encoded value
+	var encoded bytes.Buffer
+	_, err := buffer.WriteTo(&encoded)
+	assert.NoError(t, err)
+	data := encoded.Bytes()
+	data[len(data)-10] = 0x0f
+
+	malformed := commit.NewBuffer(0)
+	_, err = malformed.ReadFrom(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	replica := NewCollection()
+	replica.CreateColumn("float64", ForFloat64())
+	assert.Error(t, replica.Replay(commit.Commit{
+		Updates: []*commit.Buffer{malformed},
+	}))
+	assert.NoError(t, replica.Replay(commit.Commit{
+		Updates: []*commit.Buffer{buffer},
+	}))
+}
+
+func TestReplayTypeMismatch(t *testing.T) {
+	buffer := commit.NewBuffer(0)
+	buffer.Column = "float64"
+	buffer.PutInt16(commit.Put, 10, 1)
+
+	replica := NewCollection()
+	replica.CreateColumn("float64", ForFloat64())
+	replica.CreateColumn("packed", ForPacked())
+	assert.Error(t, replica.Replay(commit.Commit{
+		Updates: []*commit.Buffer{buffer},
+	}))
+
+	// The packed columns accept integers of any size
+	buffer.Reset("packed")
+	buffer.PutInt16(commit.Put, 10, 1)
+	assert.NoError(t, replica.Replay(commit.Commit{
+		Updates: []*commit.Buffer{buffer},
+	}))
+}
+
 // --------------------------- Snapshotting ----------------------------
 
 func TestSnapshot(t *testing.T) {
@@ -204,6 +252,280 @@ func TestSnapshot(t *testing.T) {
 	assert.Equal(t, amount, output.Count())
 }
 
+func TestRestoreProfile(t *testing.T) {
+	input := NewCollection(Options{
+		Capacity: 4096,
+		Vacuum:   -1,
+		Query:    QueryOptions{Cache: 10},
+		Storage:  StorageOptions{Lifecycle: true},
+	})
+	input.CreateColumn("name", ForString())
+	idx, _ := input.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	})
+
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, input.Snapshot(buffer))
+
+	// The restored collection is configured as the original
+	output := NewCollection()
+	output.CreateColumn("name", ForString())
+	assert.NoError(t, output.Restore(buffer))
+	assert.Equal(t, input.Options(), output.Options())
+	assert.NotNil(t, output.cache)
+	assert.NoError(t, output.QueryAt(idx, func(r Row) error {
+		created, ok := r.Int64(createdColumn)
+		assert.True(t, ok)
+		assert.NotZero(t, created)
+		return nil
+	}))
+
+	// A malformed profile is rejected
+	assert.Error(t, decodeProfile([]byte{0x80}, new(Options)))
+	assert.Error(t, decodeProfile(encodeProfile(Options{})[:3], new(Options)))
+}
+
+func TestRestoreProfileConcurrent(t *testing.T) {
+	input := NewCollection(Options{Vacuum: 2 * time.Millisecond})
+	defer input.Close()
+	input.CreateColumn("name", ForString())
+	input.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	})
+
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, input.Snapshot(buffer))
+
+	// Restore the profile while the vacuum and the other queries read the options
+	output := NewCollection(Options{Vacuum: time.Millisecond})
+	defer output.Close()
+	output.CreateColumn("name", ForString())
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				output.Query(func(txn *Txn) error {
+					txn.Count()
+					return nil
+				})
+			}
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, output.Restore(bytes.NewReader(buffer.Bytes())))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	close(done)
+	wg.Wait()
+	assert.Equal(t, 2*time.Millisecond, output.Options().Vacuum)
+}
+
+func TestRestoreSchema(t *testing.T) {
+	_ = Register("named", func() Column { return &namedColumn{makeStrings()} })
+	input := NewCollection(Options{Vacuum: -1})
+	input.CreateColumn("id", ForSequence())
+	input.CreateColumn("name", ForString())
+	input.CreateColumn("class", ForEnum())
+	input.CreateColumn("balance", ForFloat64())
+	input.CreateColumn("custom", &namedColumn{makeStrings()})
+	input.CreateColumn("location", ForVector(2, Euclidean))
+	input.CreateIndex("rich", "balance", func(r Reader) bool { return r.Float() > 100 })
+	input.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		r.SetEnum("class", "mage")
+		r.SetFloat64("balance", 500)
+		return nil
+	})
+
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, input.Snapshot(buffer))
+
+	// The columns of a registered type are created, except the ones renamed or converted
+	output := NewCollection()
+	assert.NoError(t, output.Restore(buffer, WithMigrations(Migration{
+		Version: 1,
+		Rename:  map[string]string{"name": "nickname"},
+		Convert: map[string]func(r *commit.Reader) any{"balance": func(r *commit.Reader) any { return r.Float64() }},
+	})))
+
+	for name, typ := range map[string]string{
+		"id":       "sequence",
+		"nickname": "string",
+		"class":    "enum",
+		"custom":   "named",
+	} {
+		column, ok := output.cols.Load(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, typ, column.typeName())
+	}
+
+	for _, name := range []string{"name", "balance", "location", "rich"} {
+		_, ok := output.cols.Load(name)
+		assert.False(t, ok, name)
+	}
+
+	assert.NoError(t, output.QueryAt(0, func(r Row) error {
+		id, _ := r.Uint64("id")
+		name, _ := r.String("nickname")
+		class, _ := r.Enum("class")
+		assert.Equal(t, uint64(1), id)
+		assert.Equal(t, "Roman", name)
+		assert.Equal(t, "mage", class)
+		return nil
+	}))
+
+	// The type which is not registered can not be restored
+	buffer.Reset()
+	input.CreateColumn("unknown", &namedColumn{makeStrings()})
+	assert.NoError(t, input.Snapshot(buffer))
+	registry.Lock()
+	delete(registry.byName, "named")
+	registry.Unlock()
+	assert.Error(t, NewCollection().Restore(buffer))
+}
+
+func TestLazyRestore(t *testing.T) {
+	newPlayers := func() *Collection {
+		coll := NewCollection()
+		coll.CreateColumn("name", ForString())
+		coll.CreateColumn("age", ForInt())
+		coll.CreateColumn("class", ForString())
+		coll.CreateIndex("old", "age", func(r Reader) bool {
+			return r.Int() >= 50
+		})
+		return coll
+	}
+
+	input := newPlayers()
+	for i := 0; i < 20000; i++ {
+		input.Insert(func(r Row) error {
+			r.SetString("name", fmt.Sprintf("player-%d", i))
+			r.SetInt("age", i%100)
+			r.SetString("class", "mage")
+			return nil
+		})
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, input.Snapshot(buffer))
+	output := newPlayers()
+	assert.NoError(t, output.Restore(buffer, WithLazyRestore()))
+	assert.Equal(t, 20000, output.Count())
+
+	// Only the columns without indexes are deferred
+	isLazy := func(name string) bool {
+		cols, _ := output.cols.lookup(name)
+		return atomic.LoadInt32(&cols[0].lazy) == 1
+	}
+	assert.True(t, isLazy("name"))
+	assert.True(t, isLazy("class"))
+	assert.False(t, isLazy("age"))
+
+	// The column is restored on first access
+	assert.NoError(t, output.QueryAt(42, func(r Row) error {
+		name, _ := r.String("name")
+		assert.Equal(t, "player-42", name)
+		return nil
+	}))
+	assert.False(t, isLazy("name"))
+	assert.True(t, isLazy("class"))
+
+	// Deleting a row restores the columns first, so the value is not resurrected
+	assert.True(t, output.DeleteAt(55))
+	assert.False(t, isLazy("class"))
+	cols, _ := output.cols.lookup("class")
+	assert.False(t, cols[0].Contains(55))
+
+	output.Query(func(txn *Txn) error {
+		assert.Equal(t, 9999, txn.With("old").Count())
+		assert.Equal(t, 9999, txn.WithValue("class", func(v any) bool {
+			return v == "mage"
+		}).Count())
+		return nil
+	})
+}
+
+func TestLazyRestoreRange(t *testing.T) {
+	input := loadPlayers(500)
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, input.Snapshot(buffer))
+
+	// The dumps read the deferred columns directly
+	output := newEmpty(500)
+	assert.NoError(t, output.Restore(bytes.NewReader(buffer.Bytes()), WithLazyRestore()))
+	assert.Equal(t, input.DumpAt(42).Values, output.DumpAt(42).Values)
+
+	// The diffs compare the deferred columns of both collections
+	output = newEmpty(500)
+	assert.NoError(t, output.Restore(bytes.NewReader(buffer.Bytes()), WithLazyRestore()))
+	report, err := Diff(input, output)
+	assert.NoError(t, err)
+	assert.True(t, report.IsEmpty())
+}
+
+func TestRestoreIndexBitmaps(t *testing.T) {
+	var evaluated int32
+	newPlayers := func(column string) *Collection {
+		coll := NewCollection()
+		coll.CreateColumn("age", ForInt())
+		coll.CreateColumn("level", ForInt())
+		coll.CreateIndex("old", column, func(r Reader) bool {
+			atomic.AddInt32(&evaluated, 1)
+			return r.Int() >= 50
+		})
+		coll.CreateDerivedIndex("young", Not("old"))
+		return coll
+	}
+
+	input := newPlayers("age")
+	for i := 0; i < 20000; i++ {
+		input.Insert(func(r Row) error {
+			r.SetInt("age", i%100)
+			r.SetInt("level", i%10)
+			return nil
+		})
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, input.Snapshot(buffer, WithIndexBitmaps()))
+	snapshot := buffer.Bytes()
+	count := func(coll *Collection, indexName string) (n int) {
+		coll.Query(func(txn *Txn) error {
+			n = txn.With(indexName).Count()
+			return nil
+		})
+		return
+	}
+
+	// The index is loaded from its bitmap, without evaluating the function
+	atomic.StoreInt32(&evaluated, 0)
+	output := newPlayers("age")
+	assert.NoError(t, output.Restore(bytes.NewReader(snapshot)))
+	assert.Zero(t, atomic.LoadInt32(&evaluated))
+	assert.Equal(t, 10000, count(output, "old"))
+	assert.Equal(t, 10000, count(output, "young"))
+	assert.NoError(t, CheckInvariants(output))
+
+	// The index of a different column is evaluated instead
+	other := newPlayers("level")
+	assert.NoError(t, other.Restore(bytes.NewReader(snapshot)))
+	assert.NotZero(t, atomic.LoadInt32(&evaluated))
+	assert.Equal(t, 0, count(other, "old"))
+	assert.Equal(t, 20000, count(other, "young"))
+	assert.NoError(t, CheckInvariants(other))
+}
+
 func TestLargeSnapshot(t *testing.T) {
 	const amount = 3_000_000
 
@@ -324,7 +646,7 @@ func TestWriteTo(t *testing.T) {
 	// Restore the collection from the snapshot
 	output := NewCollection()
 	output.CreateColumn("name", ForEnum())
-	m, err := output.readState(buffer)
+	m, _, err := output.readState(buffer)
 	assert.NotEmpty(t, m)
 	assert.NoError(t, err)
 	assert.Equal(t, input.Count(), output.Count())
@@ -336,6 +658,34 @@ func TestWriteTo(t *testing.T) {
 	}))
 }
 
+func TestMarshalBinary(t *testing.T) {
+	type state struct {
+		Term    uint64
+		Players *Collection
+	}
+
+	input := loadPlayers(5e3)
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, gob.NewEncoder(buffer).Encode(state{Term: 7, Players: input}))
+
+	// Decode into a collection with the same schema
+	output := state{Players: newEmpty(5e3)}
+	assert.NoError(t, gob.NewDecoder(buffer).Decode(&output))
+	assert.Equal(t, uint64(7), output.Term)
+	assert.Equal(t, input.Count(), output.Players.Count())
+	assert.NoError(t, output.Players.QueryAt(42, func(r Row) error {
+		name, _ := r.String("name")
+		assert.Equal(t, "Rowe Cole", name)
+		return nil
+	}))
+
+	// The collection must be created first
+	data, err := input.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Error(t, new(Collection).UnmarshalBinary(data))
+	assert.Error(t, newEmpty(10).UnmarshalBinary(data[:10]))
+}
+
 func TestCollectionCodec(t *testing.T) {
 	input := loadPlayers(5e4)
 
@@ -347,7 +697,7 @@ func TestCollectionCodec(t *testing.T) {
 
 	// Restore the collection from the snapshot
 	output := newEmpty(5e4)
-	m, err := output.readState(buffer)
+	m, _, err := output.readState(buffer)
 	assert.NotEmpty(t, m)
 	assert.NoError(t, err)
 	assert.Equal(t, input.Count(), output.Count())
@@ -389,7 +739,7 @@ func TestWriteEmpty(t *testing.T) {
 	{ // Read the collection back
 		output := NewCollection()
 		output.CreateColumn("name", ForString())
-		_, err := output.readState(buffer)
+		_, _, err := output.readState(buffer)
 		assert.NoError(t, err)
 		assert.Equal(t, 0, output.Count())
 	}
@@ -411,13 +761,23 @@ func TestReadFromFailures(t *testing.T) {
 		output := NewCollection()
 
 		output.CreateColumn("name", ForString())
-		_, err := output.readState(bytes.NewReader(buffer.Bytes()[:size]))
+		_, _, err := output.readState(bytes.NewReader(buffer.Bytes()[:size]))
 		assert.Error(t, err, fmt.Sprintf("read size %v", size))
 	}
 }
 
 // --------------------------- Mocks & Fixtures ----------------------------
 
+// namedColumn represents a custom column type which is recorded by its name
+type namedColumn struct {
+	Column
+}
+
+// TypeName returns the registered name of the column type
+func (c *namedColumn) TypeName() string {
+	return "named"
+}
+
 // noopWriter is a writer that simply counts the commits
 type noopWriter struct {
 	commits uint64
@@ -429,6 +789,26 @@ func (w *noopWriter) Append(commit commit.Commit) error {
 	return nil
 }
 
+// orderWriter is a writer which records the chunks of the commits, in order
+type orderWriter struct {
+	busy    int32
+	overlap bool
+	chunks  []commit.Chunk
+}
+
+// Append records the chunk of the commit and whether the appends overlapped
+func (w *orderWriter) Append(commit commit.Commit) error {
+	if !atomic.CompareAndSwapInt32(&w.busy, 0, 1) {
+		w.overlap = true
+		return nil
+	}
+
+	w.chunks = append(w.chunks, commit.Chunk)
+	time.Sleep(time.Millisecond)
+	atomic.StoreInt32(&w.busy, 0)
+	return nil
+}
+
 // limitWriter is a io.Writer that allows for limiting input
 type limitWriter struct {
 	value uint32
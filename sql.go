@@ -0,0 +1,160 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// sqlBatchSize is the number of rows inserted per transaction when loading from a database
+const sqlBatchSize = 1000
+
+// Various scan types of the nullable values, which are mapped to the type of their value
+var sqlNullTypes = map[reflect.Type]reflect.Kind{
+	reflect.TypeOf(sql.NullBool{}):    reflect.Bool,
+	reflect.TypeOf(sql.NullInt16{}):   reflect.Int16,
+	reflect.TypeOf(sql.NullInt32{}):   reflect.Int32,
+	reflect.TypeOf(sql.NullInt64{}):   reflect.Int64,
+	reflect.TypeOf(sql.NullFloat64{}): reflect.Float64,
+	reflect.TypeOf(sql.NullString{}):  reflect.String,
+	reflect.TypeOf(sql.NullTime{}):    reflect.Int64,
+	reflect.TypeOf(time.Time{}):       reflect.Int64,
+}
+
+// FromSQLRows creates a new collection with a column for each column of the result set, and
+// loads all of the rows into it, for example to hydrate an in-memory cache from a database.
+// The type of each column is derived from the scan type reported by the driver. The times
+// are stored as int64 unix nanoseconds, while the types which are not supported, such as
+// binary values, are stored as strings. The NULL values are left empty. The rows are not
+// closed by this function.
+func FromSQLRows(rows *sql.Rows, opts ...Options) (*Collection, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	coll := NewCollection(opts...)
+	kinds := make([]reflect.Kind, len(types))
+	for i, t := range types {
+		kinds[i] = sqlKindOf(t.ScanType())
+		column, err := ForKind(kinds[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if err := coll.CreateColumn(t.Name(), column); err != nil {
+			return nil, err
+		}
+	}
+
+	// Scan the values as returned by the driver and load them in batches
+	values := make([]any, len(types))
+	targets := make([]any, len(types))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+
+	batch := make([]map[string]any, 0, sqlBatchSize)
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+
+		object := make(map[string]any, len(types))
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+
+			value, err := sqlValueOf(kinds[i], v)
+			if err != nil {
+				return nil, fmt.Errorf("column: unable to load column '%s', %w", types[i].Name(), err)
+			}
+			object[types[i].Name()] = value
+		}
+
+		if batch = append(batch, object); len(batch) == sqlBatchSize {
+			if err := coll.Query(func(txn *Txn) error { return txn.ingest(batch) }); err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := coll.Query(func(txn *Txn) error { return txn.ingest(batch) }); err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+// sqlKindOf returns the kind of column to create for the scan type of a database column
+func sqlKindOf(scanType reflect.Type) reflect.Kind {
+	if scanType == nil {
+		return reflect.String
+	}
+
+	if kind, ok := sqlNullTypes[scanType]; ok {
+		return kind
+	}
+
+	switch kind := scanType.Kind(); kind {
+	case reflect.Int8:
+		return reflect.Int16
+	case reflect.Uint8:
+		return reflect.Uint16
+	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Bool:
+		return kind
+	default:
+		return reflect.String
+	}
+}
+
+// sqlValueOf converts a value returned by the driver to the kind of its column. Since some
+// drivers return the numbers as text, these are parsed as well.
+func sqlValueOf(kind reflect.Kind, value any) (any, error) {
+	if v, ok := value.(time.Time); ok {
+		value = v.UnixNano()
+	}
+
+	if v, ok := value.([]byte); ok {
+		value = string(v)
+	}
+
+	switch kind {
+	case reflect.String:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		return fmt.Sprint(value), nil
+	case reflect.Bool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		case int64:
+			return v != 0, nil
+		}
+	default:
+		if v, ok := value.(string); ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+			return strconv.ParseFloat(v, 64)
+		}
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value of type %T", value)
+}
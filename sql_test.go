@@ -0,0 +1,124 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromSQLRows(t *testing.T) {
+	db := sql.OpenDB(mockConnector{rows: 2500})
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM players")
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	players, err := FromSQLRows(rows)
+	assert.NoError(t, err)
+	assert.Equal(t, 2500, players.Count())
+	assert.NoError(t, players.QueryAt(42, func(r Row) error {
+		name, _ := r.String("name")
+		age, _ := r.Int16("age")
+		balance, _ := r.Float64("balance")
+		active := r.Bool("active")
+		joined, _ := r.Int64("joined")
+		score, _ := r.Float64("score")
+		assert.Equal(t, "player-42", name)
+		assert.Equal(t, int16(42), age)
+		assert.Equal(t, float64(21), balance)
+		assert.True(t, active)
+		assert.Equal(t, time.Unix(42, 0).UnixNano(), joined)
+		assert.Equal(t, float64(4.2), score)
+		return nil
+	}))
+
+	// The NULL values are left empty
+	assert.NoError(t, players.QueryAt(5, func(r Row) error {
+		_, ok := r.Float64("score")
+		assert.False(t, ok)
+		return nil
+	}))
+
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		assert.Equal(t, 2250, txn.WithFloat("score", func(v float64) bool { return v >= 0 }).Count())
+		return nil
+	}))
+}
+
+// --------------------------- Mock Driver ----------------------------
+
+type mockConnector struct {
+	rows int
+}
+
+func (c mockConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return mockConn(c), nil
+}
+
+func (c mockConnector) Driver() driver.Driver { return nil }
+
+type mockConn mockConnector
+
+func (c mockConn) Prepare(query string) (driver.Stmt, error) { return mockStmt(c), nil }
+func (c mockConn) Close() error                              { return nil }
+func (c mockConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type mockStmt mockConnector
+
+func (s mockStmt) Close() error                                    { return nil }
+func (s mockStmt) NumInput() int                                   { return 0 }
+func (s mockStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &mockRows{count: s.rows}, nil
+}
+
+type mockRows struct {
+	count, next int
+}
+
+func (r *mockRows) Columns() []string {
+	return []string{"name", "age", "balance", "active", "joined", "score"}
+}
+
+func (r *mockRows) ColumnTypeScanType(index int) reflect.Type {
+	return []reflect.Type{
+		reflect.TypeOf(""),
+		reflect.TypeOf(int8(0)),
+		reflect.TypeOf(float64(0)), // returned as text
+		reflect.TypeOf(sql.NullBool{}),
+		reflect.TypeOf(time.Time{}),
+		reflect.TypeOf(sql.NullFloat64{}),
+	}[index]
+}
+
+func (r *mockRows) Close() error { return nil }
+
+func (r *mockRows) Next(dst []driver.Value) error {
+	if r.next >= r.count {
+		return io.EOF
+	}
+
+	i := r.next
+	r.next++
+	dst[0] = fmt.Sprintf("player-%d", i)
+	dst[1] = int64(i % 100)
+	dst[2] = []byte(fmt.Sprint(i / 2))
+	dst[3] = i%2 == 0
+	dst[4] = time.Unix(int64(i), 0)
+	dst[5] = float64(i) / 10
+	if i%10 == 5 {
+		dst[5] = nil
+	}
+	return nil
+}
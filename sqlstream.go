@@ -0,0 +1,232 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kelindar/column/commit"
+)
+
+// SQLSchema represents the schema of the relational table which receives the changes of a
+// keyed collection.
+type SQLSchema struct {
+	Table   string            // The name of the table
+	Key     string            // The name of the primary key column of the table, the key column name by default
+	Columns map[string]string // The columns of the table per column of the collection, the same names if empty
+}
+
+// SQLEncoder converts the commits of a keyed collection into INSERT, UPDATE and DELETE statements
+// on a relational table, so that the collection can be trailed into a warehouse. Similarly to
+// the DebeziumEncoder, it replays the commits on its own copy of the collection in order to find
+// the values which have changed, and must therefore receive all of the commits, starting with
+// an empty collection. The values are written as literals, with the identifiers quoted, and the
+// values of the masked columns of the copy are masked.
+type SQLEncoder struct {
+	lock   sync.Mutex
+	schema SQLSchema      // The schema of the table
+	mirror *Collection    // The copy of the collection used to diff the rows
+	reader *commit.Reader // The reader for the update buffers
+	output io.Writer      // The optional destination of the statements
+}
+
+// NewSQLEncoder creates a new encoder of the SQL statements for the changes of a collection.
+// Since the columns are not part of the commits, the columns function must create them on the
+// copy of the collection, including the primary key. If an output is specified, the encoder
+// can be used as the commit logger of the collection and writes each statement as a line.
+func NewSQLEncoder(schema SQLSchema, columns func(*Collection) error, output io.Writer) (*SQLEncoder, error) {
+	if schema.Table == "" {
+		return nil, fmt.Errorf("column: unable to encode SQL, the table is not specified")
+	}
+
+	mirror := NewCollection(Options{Vacuum: -1})
+	if columns != nil {
+		if err := columns(mirror); err != nil {
+			mirror.Close()
+			return nil, err
+		}
+	}
+
+	if mirror.pk == nil {
+		mirror.Close()
+		return nil, errNoKey
+	}
+
+	if schema.Key == "" {
+		schema.Key = mirror.pk.name
+	}
+
+	return &SQLEncoder{
+		schema: schema,
+		mirror: mirror,
+		reader: commit.NewReader(),
+		output: output,
+	}, nil
+}
+
+// Append converts the commit into SQL statements and writes them into the output, one line
+// per statement, implementing commit.Logger.
+func (e *SQLEncoder) Append(change commit.Commit) error {
+	statements, err := e.Encode(change)
+	if err != nil || e.output == nil {
+		return err
+	}
+
+	for _, stmt := range statements {
+		if _, err := io.WriteString(e.output, stmt+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode converts the commit into a statement for each row it modified, in the order of their
+// indexes. The updates only set the columns whose value has changed.
+func (e *SQLEncoder) Encode(change commit.Commit) ([]string, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	changes, err := replayChange(e.mirror, e.reader, change)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0, len(changes))
+	for _, row := range changes {
+		switch {
+		case row.before == nil:
+			statements = append(statements, e.insert(row.after))
+		case row.after == nil:
+			statements = append(statements, e.delete(row.before))
+		default:
+			if stmt, ok := e.update(row.before, row.after); ok {
+				statements = append(statements, stmt)
+			}
+		}
+	}
+	return statements, nil
+}
+
+// Close closes the encoder and releases its copy of the collection
+func (e *SQLEncoder) Close() error {
+	return e.mirror.Close()
+}
+
+// insert encodes the INSERT statement of a row
+func (e *SQLEncoder) insert(image map[string]any) string {
+	names := []string{sqlQuote(e.schema.Key)}
+	values := []string{sqlLiteral(image[e.mirror.pk.name])}
+	for _, column := range e.columnsOf(image) {
+		names = append(names, sqlQuote(column.table))
+		values = append(values, sqlLiteral(image[column.name]))
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", sqlQuote(e.schema.Table),
+		strings.Join(names, ", "), strings.Join(values, ", "))
+}
+
+// update encodes the UPDATE statement of a row, if any of its values has changed
+func (e *SQLEncoder) update(before, after map[string]any) (string, bool) {
+	var changes []string
+	for _, column := range e.columnsOf(before, after) {
+		if v, ok := after[column.name]; !ok || !reflect.DeepEqual(v, before[column.name]) {
+			changes = append(changes, sqlQuote(column.table)+" = "+sqlLiteral(v))
+		}
+	}
+
+	if len(changes) == 0 {
+		return "", false
+	}
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;", sqlQuote(e.schema.Table),
+		strings.Join(changes, ", "), e.where(after)), true
+}
+
+// delete encodes the DELETE statement of a row
+func (e *SQLEncoder) delete(image map[string]any) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s;", sqlQuote(e.schema.Table), e.where(image))
+}
+
+// where encodes the condition matching a row by its primary key
+func (e *SQLEncoder) where(image map[string]any) string {
+	return sqlQuote(e.schema.Key) + " = " + sqlLiteral(image[e.mirror.pk.name])
+}
+
+// sqlColumn represents a column of the collection along with the column of the table
+type sqlColumn struct {
+	name  string // The name of the column of the collection
+	table string // The name of the column of the table
+}
+
+// columnsOf returns the mapped columns of the images except for the primary key, in the order
+// of the columns of the table.
+func (e *SQLEncoder) columnsOf(images ...map[string]any) (columns []sqlColumn) {
+	seen := make(map[string]bool)
+	for _, image := range images {
+		for name := range image {
+			table, ok := e.schema.Columns[name]
+			switch {
+			case seen[name] || name == e.mirror.pk.name || name == expireColumn:
+				continue
+			case len(e.schema.Columns) == 0:
+				table = name
+			case !ok:
+				continue
+			}
+
+			seen[name] = true
+			columns = append(columns, sqlColumn{name: name, table: table})
+		}
+	}
+
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].table < columns[j].table
+	})
+	return
+}
+
+// sqlQuote quotes an identifier, such as the name of a table or a column
+func sqlQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqlLiteral encodes a value as a SQL literal
+func sqlLiteral(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case float32:
+		return sqlLiteral(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "NULL"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	default:
+		if encoded, err := json.Marshal(v); err == nil {
+			return sqlLiteral(string(encoded))
+		}
+		return sqlLiteral(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLEncoder(t *testing.T) {
+	columns := func(c *Collection) error {
+		c.CreateColumn("id", ForKey())
+		c.CreateColumn("name", ForString())
+		c.CreateColumn("balance", ForFloat64())
+		return c.CreateColumn("active", ForBool())
+	}
+
+	_, err := NewSQLEncoder(SQLSchema{}, columns, nil)
+	assert.Error(t, err)
+	_, err = NewSQLEncoder(SQLSchema{Table: "players"}, nil, nil)
+	assert.Error(t, err)
+
+	output := bytes.NewBuffer(nil)
+	encoder, err := NewSQLEncoder(SQLSchema{
+		Table: "players",
+		Key:   "player_id",
+		Columns: map[string]string{
+			"name":    "full_name",
+			"balance": "balance",
+		},
+	}, columns, output)
+	assert.NoError(t, err)
+	defer encoder.Close()
+
+	players := NewCollection(Options{Writer: encoder})
+	assert.NoError(t, columns(players))
+
+	// Insert, update and delete a row
+	assert.NoError(t, players.InsertKey("merlin", func(r Row) error {
+		r.SetString("name", "Merlin O'Brien")
+		r.SetFloat64("balance", 10.5)
+		r.SetBool("active", true)
+		return nil
+	}))
+	assert.NoError(t, players.QueryKey("merlin", func(r Row) error {
+		r.SetFloat64("balance", 20)
+		r.SetBool("active", false)
+		return nil
+	}))
+	assert.NoError(t, players.QueryKey("merlin", func(r Row) error {
+		r.SetBool("active", true) // Not mapped
+		return nil
+	}))
+	assert.NoError(t, players.DeleteKey("merlin"))
+
+	assert.Equal(t, []string{
+		`INSERT INTO "players" ("player_id", "balance", "full_name") VALUES ('merlin', 10.5, 'Merlin O''Brien');`,
+		`UPDATE "players" SET "balance" = 20 WHERE "player_id" = 'merlin';`,
+		`DELETE FROM "players" WHERE "player_id" = 'merlin';`,
+	}, strings.Split(strings.TrimSpace(output.String()), "\n"))
+}
+
+func TestSQLEncoderMask(t *testing.T) {
+	columns := func(c *Collection) error {
+		c.CreateColumn("id", ForKey())
+		return c.CreateColumn("email", ForString(WithMask[string](func(any) any {
+			return "***"
+		})))
+	}
+
+	output := bytes.NewBuffer(nil)
+	encoder, err := NewSQLEncoder(SQLSchema{Table: "players"}, columns, output)
+	assert.NoError(t, err)
+	defer encoder.Close()
+
+	players := NewCollection(Options{Writer: encoder})
+	assert.NoError(t, columns(players))
+	assert.NoError(t, players.InsertKey("merlin", func(r Row) error {
+		r.SetString("email", "merlin@example.com")
+		return nil
+	}))
+
+	assert.Equal(t, `INSERT INTO "players" ("id", "email") VALUES ('merlin', '***');`,
+		strings.TrimSpace(output.String()))
+}
+
+func TestSQLLiteral(t *testing.T) {
+	assert.Equal(t, "NULL", sqlLiteral(nil))
+	assert.Equal(t, "NULL", sqlLiteral(math.NaN()))
+	assert.Equal(t, "FALSE", sqlLiteral(false))
+	assert.Equal(t, "X'0a0b'", sqlLiteral([]byte{10, 11}))
+	assert.Equal(t, "1.5", sqlLiteral(float32(1.5)))
+	assert.Equal(t, "-3", sqlLiteral(int16(-3)))
+	assert.Equal(t, "'[1,2]'", sqlLiteral([]float32{1, 2}))
+	assert.Equal(t, `"a""b"`, sqlQuote(`a"b`))
+}
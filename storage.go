@@ -0,0 +1,42 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+// StorageOptions represents the options of the storage of a collection.
+type StorageOptions struct {
+	// Lifecycle enables tracking of the row lifecycle metadata. When enabled, the collection
+	// maintains the "$version" and "$created" pseudo-columns, containing the ID of the last
+	// commit that touched a row and the time at which it was inserted.
+	Lifecycle bool
+
+	// SchemaVersion is the version of the schema of the collection, which is written into the
+	// snapshots so that the older ones can be upgraded on restore, see WithMigrations().
+	SchemaVersion uint64
+
+	// Paranoid maintains a checksum of the values of each column chunk, which is verified
+	// whenever a chunk is read or written to a snapshot, in order to detect the corruption of
+	// the memory early. This is significantly slower and reserved to the critical data.
+	Paranoid bool
+}
+
+// merge merges the options specified on top of the current ones, ignoring the zero values.
+func (o *StorageOptions) merge(other StorageOptions) {
+	if other.Lifecycle {
+		o.Lifecycle = true
+	}
+	if other.SchemaVersion > 0 {
+		o.SchemaVersion = other.SchemaVersion
+	}
+	if other.Paranoid {
+		o.Paranoid = true
+	}
+}
+
+// configureStorage creates the lifecycle pseudo-columns, if enabled.
+func (c *Collection) configureStorage(options StorageOptions) {
+	if options.Lifecycle && !c.options().Storage.Lifecycle {
+		c.createColumn(versionColumn, ForUint64())
+		c.createColumn(createdColumn, ForInt64())
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"context"
+	"fmt"
+)
+
+// streamBatch is the number of rows gathered before they are sent into the stream
+const streamBatch = 1024
+
+// StreamRow represents a row sent into a stream, with a copy of the values of its columns, so
+// that it remains valid once the query has moved on.
+type StreamRow struct {
+	Index   uint32   // The index of the row
+	Columns []string // The names of the streamed columns, shared by all of the rows
+	Values  []any    // The value of each column, or nil if the row has no value
+}
+
+// Value returns the value of a column of the row, or false if the row has no value or if the
+// column was not streamed.
+func (r StreamRow) Value(columnName string) (any, bool) {
+	for i, name := range r.Columns {
+		if name == columnName {
+			return r.Values[i], r.Values[i] != nil
+		}
+	}
+	return nil, false
+}
+
+// Stream streams the rows selected by the filter into a channel with the specified buffer, so
+// that they can be consumed by the stages of a pipeline without materializing all of them first.
+// The rows are gathered in small batches within a read-only query, which holds the read lock of
+// a chunk only while copying its values, hence the commits are not blocked by a slow consumer.
+// The filter is optional and, if no column is specified, all of the columns except for the
+// indexes are streamed. The channel is closed once every row was sent, or once the context is
+// cancelled, which must be done if the consumer stops before the end of the stream.
+func (c *Collection) Stream(ctx context.Context, buffer int, filter func(txn *Txn) *Txn, columnNames ...string) (<-chan StreamRow, error) {
+	for _, columnName := range columnNames {
+		if _, ok := c.cols.Load(columnName); !ok {
+			return nil, fmt.Errorf("column: unable to stream, column '%s' does not exist", columnName)
+		}
+	}
+
+	out := make(chan StreamRow, buffer)
+	go func() {
+		defer close(out)
+		c.Query(func(txn *Txn) error {
+			if filter != nil {
+				txn = filter(txn)
+			}
+
+			return txn.export(ExportFunc(func(batch *ExportBatch) error {
+				columns := make([]string, 0, len(batch.Columns))
+				for _, column := range batch.Columns {
+					columns = append(columns, column.Name)
+				}
+
+				for i := 0; i < batch.Rows; i++ {
+					row := StreamRow{Index: batch.Indexes[i], Columns: columns, Values: make([]any, len(columns))}
+					for j, column := range batch.Columns {
+						row.Values[j] = column.Values[i]
+					}
+
+					select {
+					case out <- row:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+				return nil
+			}), streamBatch, true, columnNames)
+		})
+	}()
+	return out, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	players := loadPlayers(500)
+	defer players.Close()
+
+	_, err := players.Stream(context.Background(), 10, nil, "invalid")
+	assert.Error(t, err)
+
+	rows, err := players.Stream(context.Background(), 10, func(txn *Txn) *Txn {
+		return txn.With("human")
+	}, "name", "balance")
+	assert.NoError(t, err)
+
+	// The values are copied, so they can be read once the query has moved on
+	count := 0
+	for row := range rows {
+		count++
+		assert.Equal(t, []string{"name", "balance"}, row.Columns)
+		assert.NoError(t, players.QueryAt(row.Index, func(r Row) error {
+			name, _ := r.String("name")
+			race, _ := r.Enum("race")
+			value, ok := row.Value("name")
+			assert.True(t, ok)
+			assert.Equal(t, name, value)
+			assert.Equal(t, "human", race)
+			return nil
+		}))
+
+		_, ok := row.Value("race")
+		assert.False(t, ok)
+	}
+	assert.Equal(t, 138, count)
+
+	// The commits are not blocked while the consumer is slow
+	rows, err = players.Stream(context.Background(), 0, nil)
+	assert.NoError(t, err)
+	first := <-rows
+	assert.Equal(t, uint32(0), first.Index)
+	assert.True(t, players.DeleteAt(499))
+	for range rows {
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	players := loadPlayers(500)
+	defer players.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := players.Stream(ctx, 0, nil, "name")
+	assert.NoError(t, err)
+	<-rows
+	cancel()
+
+	// The channel is closed once cancelled, without sending every row
+	count := 0
+	for range rows {
+		count++
+	}
+	assert.Less(t, count, 499)
+}
@@ -0,0 +1,232 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"sync/atomic"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// --------------------------- Change Summary ----------------------------
+
+// ChangeSummary represents the changes which a transaction would apply to the collection.
+type ChangeSummary struct {
+	Inserted int                    // The number of rows inserted
+	Deleted  int                    // The number of rows deleted
+	Columns  map[string]int         // The number of rows touched, per column
+	Indexes  map[string]IndexChange // The rows entering or leaving, per bitmap index
+}
+
+// IndexChange represents the rows which would enter or leave a bitmap index.
+type IndexChange struct {
+	Added   int // The number of rows which would be added to the index
+	Removed int // The number of rows which would be removed from the index
+}
+
+// DryRun executes a transaction and reports the changes it would apply, then rolls it back
+// unconditionally. This is useful to preview bulk operations before running them. The query
+// observes a consistent snapshot of the collection and blocks the writers while running.
+// The index changes are predicted from the values written by the transaction, hence the
+// merge operations (which depend on the stored value) are not reflected in them.
+func (c *Collection) DryRun(fn func(txn *Txn) error) (ChangeSummary, error) {
+	txn := c.txns.acquire(c)
+	txn.lockStable()
+	defer c.txns.release(txn)
+
+	err := c.execute(txn, fn)
+	if err == nil {
+		err = txn.checkReadOnly()
+	}
+	if err == nil {
+		err = txn.checkOverflow()
+	}
+	if err == nil {
+		err = txn.corrupt
+	}
+
+	var summary ChangeSummary
+	if err == nil {
+		summary = txn.summarize()
+	}
+
+	// Rows reserved by the inserts must be freed, since they will never be committed
+	inserted, _ := txn.findMarkedRows()
+	txn.unlockStable()
+	txn.rollback()
+	inserted.Range(func(idx uint32) {
+		c.free(idx)
+	})
+	return summary, err
+}
+
+// summarize computes the summary of the pending changes of the transaction
+func (txn *Txn) summarize() ChangeSummary {
+	inserted, deleted := txn.findMarkedRows()
+	summary := ChangeSummary{
+		Inserted: inserted.Count() - countAnd(inserted, deleted),
+		Deleted:  deleted.Count() - countAnd(deleted, inserted),
+		Columns:  make(map[string]int),
+		Indexes:  make(map[string]IndexChange),
+	}
+
+	// Predict the final state of each index for the rows touched by the transaction
+	predicted := make(map[*column]map[uint32]bool)
+	for _, u := range txn.updates {
+		if u.IsEmpty() || u.Column == rowColumn {
+			continue
+		}
+
+		var rows bitmap.Bitmap
+		txn.reader.Seek(u)
+		for txn.reader.Next() {
+			rows.Set(txn.reader.Index())
+		}
+		summary.Columns[u.Column] += rows.Count()
+
+		columns, ok := txn.owner.cols.LoadWithIndex(u.Column)
+		if !ok {
+			continue
+		}
+
+		for _, col := range columns[1:] {
+			if index, ok := col.Column.(*columnIndex); ok {
+				predicted[col] = txn.predictIndex(u, index, predicted[col])
+			}
+		}
+	}
+
+	// Deleted rows leave all of the indexes
+	if deleted.Count() > 0 {
+		txn.owner.cols.Range(func(col *column) {
+			if !col.IsIndex() {
+				return
+			}
+
+			state := predicted[col]
+			if state == nil {
+				state = make(map[uint32]bool, deleted.Count())
+				predicted[col] = state
+			}
+			deleted.Range(func(idx uint32) {
+				state[idx] = false
+			})
+		})
+	}
+
+	// Compare the predicted state with the current one
+	for col, state := range predicted {
+		var change IndexChange
+		for idx, set := range state {
+			switch was := col.Contains(idx); {
+			case set && !was:
+				change.Added++
+			case !set && was:
+				change.Removed++
+			}
+		}
+
+		if change.Added > 0 || change.Removed > 0 {
+			summary.Indexes[col.name] = change
+		}
+	}
+	return summary
+}
+
+// predictIndex predicts the final state of the index for the rows written into the buffer
+func (txn *Txn) predictIndex(buffer *commit.Buffer, index *columnIndex, state map[uint32]bool) map[uint32]bool {
+	if state == nil {
+		state = make(map[uint32]bool)
+	}
+
+	txn.reader.Seek(buffer)
+	reader := rowReader{Reader: txn.reader, cols: index.cols}
+	for txn.reader.Next() {
+		idx := txn.reader.Index()
+		switch txn.reader.Type {
+		case commit.Put:
+			state[idx] = index.rule(reader)
+		case commit.Delete:
+			state[idx] = false
+		default:
+			delete(state, idx) // The final value is unknown
+		}
+	}
+	return state
+}
+
+// findMarkedRows finds the rows which are marked as inserted or deleted by the transaction
+func (txn *Txn) findMarkedRows() (inserted, deleted bitmap.Bitmap) {
+	markers, ok := txn.findMarkers()
+	if !ok {
+		return
+	}
+
+	txn.reader.Seek(markers)
+	for txn.reader.Next() {
+		switch txn.reader.Type {
+		case commit.Insert:
+			inserted.Set(txn.reader.Index())
+		case commit.Delete:
+			deleted.Set(txn.reader.Index())
+		}
+	}
+	return
+}
+
+// countAnd counts the rows which are present in both bitmaps
+func countAnd(a, b bitmap.Bitmap) int {
+	count := 0
+	a.Range(func(idx uint32) {
+		if b.Contains(idx) {
+			count++
+		}
+	})
+	return count
+}
+
+// --------------------------- Commit Info ----------------------------
+
+// CommitInfo represents the information about the changes committed by a transaction.
+type CommitInfo struct {
+	Version  uint64 // The version of the last commit applied, or zero if nothing changed
+	Inserted int    // The number of rows inserted
+	Updated  int    // The number of existing rows updated
+	Deleted  int    // The number of rows deleted
+	Bytes    int    // The size of the encoded commit, in bytes
+}
+
+// describe populates the commit information from the pending changes of the transaction
+func (txn *Txn) describe(info *CommitInfo) {
+	inserted, deleted := txn.findMarkedRows()
+	_, updated := txn.findChanges()
+
+	info.Inserted = inserted.Count() - countAnd(inserted, deleted)
+	info.Deleted = deleted.Count() - countAnd(deleted, inserted)
+	info.Updated = updated.Count() - info.Inserted
+	for _, u := range txn.updates {
+		info.Bytes += u.Len()
+	}
+}
+
+// add adds the information about another commit of the same transaction
+func (info *CommitInfo) add(other CommitInfo) {
+	info.Inserted += other.Inserted
+	info.Updated += other.Updated
+	info.Deleted += other.Deleted
+	info.Bytes += other.Bytes
+	info.observe(other.Version)
+}
+
+// observe records the version of a commit, keeping the latest one. This is called
+// concurrently when the chunks are committed in parallel.
+func (info *CommitInfo) observe(version uint64) {
+	for {
+		last := atomic.LoadUint64(&info.Version)
+		if version <= last || atomic.CompareAndSwapUint64(&info.Version, last, version) {
+			return
+		}
+	}
+}
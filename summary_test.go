@@ -0,0 +1,160 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	players := loadPlayers(500)
+	count := players.Count()
+
+	// Turning all humans into elves
+	summary, err := players.DryRun(func(txn *Txn) error {
+		return txn.With("human").RangeRows(func(r Row) error {
+			r.SetEnum("race", "elf")
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"race": 138}, summary.Columns)
+	assert.Equal(t, map[string]IndexChange{
+		"human": {Removed: 138},
+		"elf":   {Added: 138},
+	}, summary.Indexes)
+
+	// Deleting all of the old players
+	var old int
+	summary, err = players.DryRun(func(txn *Txn) error {
+		old = txn.With("old").Count()
+		return txn.Range(func(idx uint32) {
+			txn.DeleteAt(idx)
+		})
+	})
+	assert.NoError(t, err)
+	assert.NotZero(t, old)
+	assert.Equal(t, old, summary.Deleted)
+	assert.Equal(t, old, summary.Indexes["old"].Removed)
+
+	// Inserting a new player
+	summary, err = players.DryRun(func(txn *Txn) error {
+		_, err := txn.Insert(func(r Row) error {
+			r.SetInt("age", 50)
+			return nil
+		})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.Inserted)
+	assert.Equal(t, map[string]int{"age": 1}, summary.Columns)
+	assert.Equal(t, map[string]IndexChange{"old": {Added: 1}}, summary.Indexes)
+
+	// Errors are returned
+	_, err = players.DryRun(func(txn *Txn) error {
+		return fmt.Errorf("boom")
+	})
+	assert.Error(t, err)
+
+	// Nothing was applied
+	assert.Equal(t, count, players.Count())
+	players.Query(func(txn *Txn) error {
+		assert.Equal(t, count, txn.Count())
+		assert.Equal(t, 138, txn.With("human").Count())
+		return nil
+	})
+
+	// The collection is still writable
+	_, err = players.Insert(func(r Row) error {
+		r.SetInt("age", 50)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, count+1, players.Count())
+}
+
+func TestQueryInfo(t *testing.T) {
+	players := loadPlayers(500)
+
+	// Updating the existing rows
+	info, err := players.QueryInfo(func(txn *Txn) error {
+		return txn.With("human").RangeRows(func(r Row) error {
+			r.SetInt("age", 10)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 138, info.Updated)
+	assert.Equal(t, 0, info.Inserted)
+	assert.Equal(t, 0, info.Deleted)
+	assert.NotZero(t, info.Bytes)
+	assert.NotZero(t, info.Version)
+
+	// Inserting and deleting rows
+	last := info.Version
+	info, err = players.QueryInfo(func(txn *Txn) error {
+		txn.DeleteAt(0)
+		txn.DeleteAt(1)
+		_, err := txn.Insert(func(r Row) error {
+			r.SetInt("age", 50)
+			return nil
+		})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, info.Inserted)
+	assert.Equal(t, 0, info.Updated)
+	assert.Equal(t, 2, info.Deleted)
+	assert.Greater(t, info.Version, last)
+
+	// Read-only transactions commit nothing
+	info, err = players.QueryInfo(func(txn *Txn) error {
+		assert.Equal(t, 499, txn.Count())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, CommitInfo{}, info)
+
+	// Errors are returned and nothing is committed
+	info, err = players.QueryInfo(func(txn *Txn) error {
+		txn.DeleteAt(2)
+		return fmt.Errorf("boom")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, CommitInfo{}, info)
+	assert.Equal(t, 499, players.Count())
+}
+
+func TestMetricsSink(t *testing.T) {
+	sink := new(mockMetrics)
+	coll := NewCollection(Options{Metrics: sink})
+	coll.CreateColumn("name", ForString())
+	for i := 0; i < 10; i++ {
+		coll.Insert(func(r Row) error {
+			r.SetString("name", "Roman")
+			return nil
+		})
+	}
+
+	// Read-only queries are not reported
+	coll.Query(func(txn *Txn) error {
+		return nil
+	})
+
+	assert.Equal(t, 10, len(sink.commits))
+	assert.Equal(t, 1, sink.commits[0].Inserted)
+	assert.NotZero(t, sink.commits[9].Version)
+}
+
+// mockMetrics is a metrics sink which records the commits
+type mockMetrics struct {
+	commits []CommitInfo
+}
+
+func (m *mockMetrics) OnCommit(info CommitInfo) {
+	m.commits = append(m.commits, info)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// SyncLoader loads the objects from an external source. The objects which changed since the
+// specified time must be returned, or all of them if the time is zero. A full loader may
+// ignore the time and always return all of the objects.
+type SyncLoader func(ctx context.Context, since time.Time) ([]map[string]any, error)
+
+// SyncOptions represents the options for synchronizing a collection with an external source
+type SyncOptions struct {
+	Interval    time.Duration   // The interval between the loads, one minute by default
+	Incremental bool            // Whether the loader only returns the objects which changed
+	OnSync      func(SyncStats) // The callback which receives the statistics of each sync
+	OnError     func(error)     // The callback which receives the errors, which stop the sync otherwise
+}
+
+// SyncStats represents the statistics of a single synchronization
+type SyncStats struct {
+	Loaded   int           // The number of objects loaded
+	Inserted int           // The number of rows inserted
+	Updated  int           // The number of rows which were updated
+	Deleted  int           // The number of rows deleted
+	Elapsed  time.Duration // The duration of the load and the commit
+}
+
+// Sync periodically loads the objects from an external source and applies the differences
+// to the collection, until the context is cancelled. The collection must have a primary key,
+// which is used to match the objects with the rows. Each load is applied within a single
+// transaction, and only the values which differ are written, so the change stream and the
+// triggers only observe the real differences. Unless the loader is incremental, the rows
+// whose key was not loaded are deleted. The first load happens immediately.
+func (c *Collection) Sync(ctx context.Context, load SyncLoader, opts SyncOptions) error {
+	if c.pk == nil {
+		return fmt.Errorf("column: unable to sync a collection without a primary key")
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	var since time.Time
+	for {
+		start := time.Now()
+		stats, err := c.syncOnce(ctx, load, since, !opts.Incremental)
+		switch {
+		case err != nil && opts.OnError == nil:
+			return err
+		case err != nil:
+			opts.OnError(err)
+		default:
+			since = start
+			if opts.OnSync != nil {
+				opts.OnSync(stats)
+			}
+		}
+
+		// Stop first if cancelled, since the ticker may be ready at the same time
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncOnce loads the objects and applies the differences in a single transaction
+func (c *Collection) syncOnce(ctx context.Context, load SyncLoader, since time.Time, full bool) (SyncStats, error) {
+	start := time.Now()
+	objects, err := load(ctx, since)
+	if err != nil {
+		return SyncStats{}, err
+	}
+
+	stats := SyncStats{Loaded: len(objects)}
+	err = c.Query(func(txn *Txn) error {
+		return txn.sync(objects, full, &stats)
+	})
+
+	stats.Elapsed = time.Since(start)
+	return stats, err
+}
+
+// sync applies the differences between the objects and the rows within the transaction
+func (txn *Txn) sync(objects []map[string]any, full bool, stats *SyncStats) error {
+	pk := txn.owner.pk
+	keys := make(map[string]uint32, len(objects))
+	for _, object := range objects {
+		key, ok := object[pk.name].(string)
+		if !ok {
+			return fmt.Errorf("column: unable to sync an object without a key '%s'", pk.name)
+		}
+
+		// Objects which are new or loaded several times are simply upserted
+		idx, ok := pk.OffsetOf(key)
+		if _, loaded := keys[key]; loaded || !ok {
+			if !ok && !loaded {
+				stats.Inserted++
+			}
+
+			if err := txn.ingestObject(object, keys); err != nil {
+				inserted, _ := txn.findMarkedRows()
+				inserted.Range(txn.owner.free)
+				return err
+			}
+			continue
+		}
+
+		keys[key] = idx
+		changed, err := txn.syncObject(idx, object)
+		if err != nil {
+			return err
+		}
+		if changed {
+			stats.Updated++
+		}
+	}
+
+	if !full {
+		return nil
+	}
+
+	// Delete the rows whose key was not loaded
+	var deleted []uint32
+	pk.lock.RLock()
+	for key, idx := range pk.seek {
+		if _, ok := keys[key]; !ok {
+			deleted = append(deleted, idx)
+		}
+	}
+	pk.lock.RUnlock()
+
+	for _, idx := range deleted {
+		txn.DeleteAt(idx)
+	}
+	stats.Deleted = len(deleted)
+	return nil
+}
+
+// syncObject writes the values of the object which differ from the ones of the row, and
+// returns whether any value was written.
+func (txn *Txn) syncObject(idx uint32, object map[string]any) (changed bool, err error) {
+	err = txn.QueryAt(idx, func(r Row) error {
+		for name, value := range object {
+			if name == txn.owner.pk.name {
+				continue
+			}
+
+			column, ok := txn.columnAt(name)
+			if !ok || column.IsIndex() || column.IsReadOnly() {
+				continue
+			}
+
+			if c, ok := column.Column.(converter); ok {
+				value = c.convert(value)
+			}
+
+			if current, ok := column.Value(idx); ok && reflect.DeepEqual(current, value) {
+				continue
+			}
+
+			if err := txn.Any(name).Set(value); err != nil {
+				return err
+			}
+			changed = true
+		}
+		return nil
+	})
+	return
+}
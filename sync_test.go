@@ -0,0 +1,107 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kelindar/column/commit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSync(t *testing.T) {
+	changes := make(commit.Channel, 1024)
+	coll := NewCollection(Options{Writer: changes})
+	coll.CreateColumn("id", ForKey())
+	coll.CreateColumn("name", ForString())
+	coll.CreateColumn("balance", ForInt())
+
+	// The source changes on every load
+	sources := [][]map[string]any{
+		{{"id": "a", "name": "Alice", "balance": 10.0}, {"id": "b", "name": "Bob", "balance": 20.0}},
+		{{"id": "a", "name": "Alice", "balance": 10.0}, {"id": "b", "name": "Bob", "balance": 20.0}},
+		{{"id": "a", "name": "Alice", "balance": 15.0}, {"id": "c", "name": "Carol", "balance": 30.0}},
+	}
+
+	var stats []SyncStats
+	ctx, cancel := context.WithCancel(context.Background())
+	err := coll.Sync(ctx, func(_ context.Context, since time.Time) ([]map[string]any, error) {
+		return sources[len(stats)], nil
+	}, SyncOptions{
+		Interval: time.Millisecond,
+		OnSync: func(s SyncStats) {
+			stats = append(stats, s)
+			if len(stats) == len(sources) {
+				cancel()
+			}
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 3)
+	assert.Equal(t, SyncStats{Loaded: 2, Inserted: 2}, withoutElapsed(stats[0]))
+	assert.Equal(t, SyncStats{Loaded: 2}, withoutElapsed(stats[1]))
+	assert.Equal(t, SyncStats{Loaded: 2, Inserted: 1, Updated: 1, Deleted: 1}, withoutElapsed(stats[2]))
+
+	// Only the real differences are committed
+	assert.Len(t, changes, 2)
+	assert.Equal(t, 2, coll.Count())
+	assert.NoError(t, coll.QueryKey("a", func(r Row) error {
+		balance, _ := r.Int("balance")
+		assert.Equal(t, 15, balance)
+		return nil
+	}))
+	assert.Error(t, coll.QueryKey("b", func(r Row) error { return nil }))
+}
+
+func TestSyncIncremental(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("id", ForKey())
+	coll.CreateColumn("balance", ForFloat64())
+
+	var calls []time.Time
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, coll.Sync(ctx, func(_ context.Context, since time.Time) ([]map[string]any, error) {
+		calls = append(calls, since)
+		if len(calls) == 2 {
+			cancel()
+			return nil, errors.New("unavailable")
+		}
+		return []map[string]any{{"id": fmt.Sprint(len(calls)), "balance": 1}}, nil
+	}, SyncOptions{
+		Interval:    time.Millisecond,
+		Incremental: true,
+		OnError:     func(err error) { assert.Error(t, err) },
+	}))
+
+	// The first load has no start time, and the missing objects are kept
+	assert.Len(t, calls, 2)
+	assert.True(t, calls[0].IsZero())
+	assert.False(t, calls[1].IsZero())
+	assert.Equal(t, 1, coll.Count())
+}
+
+func TestSyncErrors(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("balance", ForFloat64())
+	load := func(context.Context, time.Time) ([]map[string]any, error) {
+		return []map[string]any{{"balance": 1}}, nil
+	}
+
+	// A primary key is required
+	assert.Error(t, coll.Sync(context.Background(), load, SyncOptions{}))
+
+	// Without an error callback, the sync stops at the first error
+	coll.CreateColumn("id", ForKey())
+	assert.Error(t, coll.Sync(context.Background(), load, SyncOptions{}))
+	assert.Equal(t, 0, coll.Count())
+}
+
+func withoutElapsed(s SyncStats) SyncStats {
+	s.Elapsed = 0
+	return s
+}
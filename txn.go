@@ -6,8 +6,11 @@ package column
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/kelindar/bitmap"
 	"github.com/kelindar/column/commit"
@@ -16,14 +19,16 @@ import (
 var (
 	errNoKey         = errors.New("column: collection does not have a key column")
 	errUnkeyedInsert = errors.New("column: use InsertKey or UpsertKey methods instead")
+	errFlushLocked   = errors.New("column: unable to flush a transaction while holding read locks")
 )
 
 // --------------------------- Pool of Transactions ----------------------------
 
 // txnPool is a pool of transactions which are retained for the lifetime of the process.
 type txnPool struct {
-	txns  sync.Pool
-	pages sync.Pool
+	txns    sync.Pool
+	pages   sync.Pool
+	readers sync.Pool
 }
 
 func newTxnPool() *txnPool {
@@ -44,6 +49,11 @@ func newTxnPool() *txnPool {
 				return commit.NewBuffer(chunkSize)
 			},
 		},
+		readers: sync.Pool{
+			New: func() interface{} {
+				return commit.NewReader()
+			},
+		},
 	}
 }
 
@@ -51,8 +61,12 @@ func newTxnPool() *txnPool {
 func (p *txnPool) acquire(owner *Collection) *Txn {
 	txn := p.txns.Get().(*Txn)
 	txn.owner = owner
-	txn.logger = owner.logger
+	txn.logger = owner.commitLogger()
+	txn.logged = nil
 	txn.setup = false
+	txn.hints.reset()
+	txn.actor = ""
+	txn.outbox = txn.outbox[:0]
 	return txn
 }
 
@@ -74,19 +88,48 @@ func (p *txnPool) releasePage(buffer *commit.Buffer) {
 	p.pages.Put(buffer)
 }
 
+// acquireReader acquires a commit reader, used to apply chunks in parallel
+func (p *txnPool) acquireReader() *commit.Reader {
+	return p.readers.Get().(*commit.Reader)
+}
+
+// releaseReader releases the commit reader back
+func (p *txnPool) releaseReader(r *commit.Reader) {
+	p.readers.Put(r)
+}
+
 // --------------------------- Transaction ----------------------------
 
 // Txn represents a transaction which supports filtering and projection.
 type Txn struct {
-	cursor  uint32           // The current cursor
-	setup   bool             // Whether the transaction was set up or not
-	owner   *Collection      // The target collection
-	index   bitmap.Bitmap    // The filtering index
-	dirty   bitmap.Bitmap    // The dirty chunks
-	updates []*commit.Buffer // The update buffers
-	columns []columnCache    // The column mapping
-	logger  commit.Logger    // The optional commit logger
-	reader  *commit.Reader   // The commit reader to re-use
+	cursor    uint32                  // The current cursor
+	setup     bool                    // Whether the transaction was set up or not
+	owner     *Collection             // The target collection
+	index     bitmap.Bitmap           // The filtering index
+	dirty     bitmap.Bitmap           // The dirty chunks
+	updates   []*commit.Buffer        // The update buffers
+	columns   []columnCache           // The column mapping
+	logger    commit.Logger           // The optional commit logger
+	logged    error                   // The first error returned by the commit logger
+	reader    *commit.Reader          // The commit reader to re-use
+	stable    bool                    // Whether the read locks of all chunks are held
+	system    bool                    // Whether the transaction may update the read-only columns
+	readOnly  bool                    // Whether the transaction must not change the collection
+	callbacks int                     // The number of callbacks in progress, which hold read locks
+	guard     readGuard               // The detection of the dirty reads, in the debug mode
+	exclusive bool                    // Whether the write locks of all chunks are held
+	flushed   flushState              // The commits flushed by the transaction
+	hints     hints                   // The hints overriding the evaluation strategy
+	actor     string                  // The actor of the transaction, for the audit records
+	audits    auditTrail              // The audit records of the commits
+	outbox    []OutboxMessage         // The messages enqueued, delivered once committed
+	messages  *commit.Buffer          // The page recording the outbox messages with the commit
+	sequences []sequenceStamp         // The rows stamped with a sequence once the latch is held
+	restored  map[string]*columnIndex // The indexes restored from a snapshot, not evaluated
+	tracer    queryTrace              // The trace of the filters, for the slow query log
+	held      []commit.Chunk          // The chunks whose read locks are currently held
+	corrupt   error                   // The checksum mismatch found in the paranoid mode, or an invalid value written
+	verified  bitmap.Bitmap           // The chunks whose checksums were verified, in the paranoid mode
 }
 
 // Index returns the current index
@@ -96,14 +139,30 @@ func (txn *Txn) Index() uint32 {
 
 // Reset resets the transaction state so it can be used again.
 func (txn *Txn) reset() {
-	for i := range txn.updates {
-		txn.owner.txns.releasePage(txn.updates[i])
+	switch {
+	case txn.flushed.active:
+		// The accessors created before the flush still refer to the buffers, keep them
+		for _, u := range txn.updates {
+			u.Reset(u.Column)
+		}
+	default:
+		for i := range txn.updates {
+			txn.owner.txns.releasePage(txn.updates[i])
+		}
+		txn.updates = txn.updates[:0]
 	}
 
+	txn.system = false
+	txn.readOnly = false
+	txn.restored = nil
+	txn.sequences = txn.sequences[:0]
+	txn.callbacks = 0
+	txn.corrupt = nil
+	txn.verified.Clear()
+	txn.guard.clearReads()
 	txn.dirty.Clear()
 	txn.reader.Rewind()
 	txn.columns = txn.columns[:0]
-	txn.updates = txn.updates[:0]
 }
 
 // bufferFor loads or creates a buffer for a given column.
@@ -152,6 +211,7 @@ func (txn *Txn) columnAt(columnName string) (*column, bool) {
 // With applies a logical AND operation to the current query and the specified index.
 func (txn *Txn) With(columns ...string) *Txn {
 	txn.initialize()
+	txn.trace("with", false, columns...)
 	for _, columnName := range columns {
 		if idx, ok := txn.columnAt(columnName); ok {
 			txn.rangeReadPair(idx, func(dst, src bitmap.Bitmap) {
@@ -167,6 +227,7 @@ func (txn *Txn) With(columns ...string) *Txn {
 // Without applies a logical AND NOT operation to the current query and the specified index.
 func (txn *Txn) Without(columns ...string) *Txn {
 	txn.initialize()
+	txn.trace("without", false, columns...)
 	for _, columnName := range columns {
 		if idx, ok := txn.columnAt(columnName); ok {
 			txn.rangeReadPair(idx, func(dst, src bitmap.Bitmap) {
@@ -181,6 +242,7 @@ func (txn *Txn) Without(columns ...string) *Txn {
 func (txn *Txn) Union(columns ...string) *Txn {
 	first := !txn.setup
 	txn.initialize()
+	txn.trace("union", false, columns...)
 
 	for _, columnName := range columns {
 		if idx, ok := txn.columnAt(columnName); ok {
@@ -197,6 +259,26 @@ func (txn *Txn) Union(columns ...string) *Txn {
 	return txn
 }
 
+// IndexesAt returns the names of all of the bitmap indexes which contain the row at the
+// specified index, in alphabetical order. This is useful to understand why a row is or is
+// not included in a filtered selection.
+func (txn *Txn) IndexesAt(idx uint32) (indexes []string) {
+	chunk := commit.ChunkAt(idx)
+	if !txn.holds(chunk) { // Called from within a Range()
+		txn.rlock(chunk)
+		defer txn.runlock(chunk)
+	}
+
+	txn.owner.cols.Range(func(column *column) {
+		if column.IsIndex() && column.Contains(idx) {
+			indexes = append(indexes, column.name)
+		}
+	})
+
+	sort.Strings(indexes)
+	return
+}
+
 // WithUnion computes a union between all given indexes, and then
 // applies the result to the txn index.
 func (txn *Txn) WithUnion(columns ...string) *Txn {
@@ -204,6 +286,8 @@ func (txn *Txn) WithUnion(columns ...string) *Txn {
 		return txn.Union(columns...)
 	}
 
+	txn.trace("withUnion", false, columns...)
+
 	// allocate slice of column pointers
 	cols := make([]*column, 0)
 	for _, columnName := range columns {
@@ -217,11 +301,10 @@ func (txn *Txn) WithUnion(columns ...string) *Txn {
 
 	// adapted from rangeReadPair
 	limit := commit.Chunk(len(txn.index) >> bitmapShift)
-	lock := txn.owner.slock
 
 	// range & lock over each available chunk
 	for chunk := commit.Chunk(0); chunk <= limit; chunk++ {
-		lock.RLock(uint(chunk))
+		txn.rlock(chunk)
 
 		// reset entire bitmap
 		for i := range tmpMap {
@@ -237,26 +320,32 @@ func (txn *Txn) WithUnion(columns ...string) *Txn {
 		idxMap := chunk.OfBitmap(txn.index)
 		idxMap.And(tmpMap)
 
-		lock.RUnlock(uint(chunk))
+		txn.runlock(chunk)
 	}
 
 	return txn
 }
 
 // WithValue applies a filter predicate over values for a specific properties. It filters
-// down the items in the query.
+// down the items in the query. If the column is masked, the predicate receives the masked
+// values unless the transaction is unmasked.
 func (txn *Txn) WithValue(column string, predicate func(v interface{}) bool) *Txn {
 	txn.initialize()
+	txn.trace("withValue", true, column)
 	c, ok := txn.columnAt(column)
 	if !ok {
 		txn.index.Clear()
 		return txn
 	}
 
+	mask := txn.maskOf(column)
 	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		offset := chunk.Min()
 		index.Filter(func(x uint32) (match bool) {
 			if v, ok := c.Value(offset + x); ok {
+				if mask != nil {
+					v = mask(v)
+				}
 				match = predicate(v)
 			}
 			return
@@ -266,31 +355,60 @@ func (txn *Txn) WithValue(column string, predicate func(v interface{}) bool) *Tx
 }
 
 // WithFloat filters down the values based on the specified predicate. The column for
-// this filter must be numerical and convertible to float64.
+// this filter must be numerical and convertible to float64. If the column is masked, the
+// predicate receives the masked values unless the transaction is unmasked.
 func (txn *Txn) WithFloat(column string, predicate func(v float64) bool) *Txn {
 	txn.initialize()
+	txn.trace("withFloat", true, column)
 	c, ok := txn.columnAt(column)
 	if !ok || !c.IsNumeric() {
 		txn.index.Clear()
 		return txn
 	}
 
+	if mask := txn.maskOf(column); mask != nil {
+		txn.filterMasked(c, mask, func(v any) bool {
+			n, ok := numberOf[float64](v)
+			return ok && predicate(n)
+		})
+		return txn
+	}
+
 	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		c.Column.(Numeric).FilterFloat64(chunk, index, predicate)
 	})
 	return txn
 }
 
+// WithFloatNear filters down the rows whose value is within the epsilon of the target, for
+// example to compare the floats which accumulated some rounding errors, where an exact equality
+// would silently fail. The column for this filter must be numerical.
+func (txn *Txn) WithFloatNear(column string, target, epsilon float64) *Txn {
+	return txn.WithFloat(column, func(v float64) bool {
+		return isNear(v, target, epsilon)
+	})
+}
+
 // WithInt filters down the values based on the specified predicate. The column for
-// this filter must be numerical and convertible to int64.
+// this filter must be numerical and convertible to int64. If the column is masked, the
+// predicate receives the masked values unless the transaction is unmasked.
 func (txn *Txn) WithInt(column string, predicate func(v int64) bool) *Txn {
 	txn.initialize()
+	txn.trace("withInt", true, column)
 	c, ok := txn.columnAt(column)
 	if !ok || !c.IsNumeric() {
 		txn.index.Clear()
 		return txn
 	}
 
+	if mask := txn.maskOf(column); mask != nil {
+		txn.filterMasked(c, mask, func(v any) bool {
+			n, ok := numberOf[int64](v)
+			return ok && predicate(n)
+		})
+		return txn
+	}
+
 	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		c.Column.(Numeric).FilterInt64(chunk, index, predicate)
 	})
@@ -298,15 +416,25 @@ func (txn *Txn) WithInt(column string, predicate func(v int64) bool) *Txn {
 }
 
 // WithUint filters down the values based on the specified predicate. The column for
-// this filter must be numerical and convertible to uint64.
+// this filter must be numerical and convertible to uint64. If the column is masked, the
+// predicate receives the masked values unless the transaction is unmasked.
 func (txn *Txn) WithUint(column string, predicate func(v uint64) bool) *Txn {
 	txn.initialize()
+	txn.trace("withUint", true, column)
 	c, ok := txn.columnAt(column)
 	if !ok || !c.IsNumeric() {
 		txn.index.Clear()
 		return txn
 	}
 
+	if mask := txn.maskOf(column); mask != nil {
+		txn.filterMasked(c, mask, func(v any) bool {
+			n, ok := numberOf[uint64](v)
+			return ok && predicate(n)
+		})
+		return txn
+	}
+
 	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		c.Column.(Numeric).FilterUint64(chunk, index, predicate)
 	})
@@ -314,29 +442,95 @@ func (txn *Txn) WithUint(column string, predicate func(v uint64) bool) *Txn {
 }
 
 // WithString filters down the values based on the specified predicate. The column for
-// this filter must be a string.
+// this filter must be a string. If the column is masked, the predicate receives the masked
+// values unless the transaction is unmasked.
 func (txn *Txn) WithString(column string, predicate func(v string) bool) *Txn {
 	txn.initialize()
+	txn.trace("withString", true, column)
 	c, ok := txn.columnAt(column)
 	if !ok || !c.IsTextual() {
 		txn.index.Clear()
 		return txn
 	}
 
+	if mask := txn.maskOf(column); mask != nil {
+		txn.filterMasked(c, mask, func(v any) bool {
+			s, ok := v.(string)
+			return ok && predicate(s)
+		})
+		return txn
+	}
+
 	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		c.Column.(Textual).FilterString(chunk, index, predicate)
 	})
 	return txn
 }
 
+// filterMasked filters down the rows based on the masked values of a column, so that a filter
+// on a masked column can not be used to find out its actual values. The rows whose masked value
+// is not of the type expected by the predicate are filtered out.
+func (txn *Txn) filterMasked(c *column, mask func(any) any, predicate func(v any) bool) {
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		offset := chunk.Min()
+		index.Filter(func(x uint32) bool {
+			v, ok := c.Value(offset + x)
+			return ok && predicate(mask(v))
+		})
+	})
+}
+
 // Count returns the number of objects matching the query
 func (txn *Txn) Count() int {
 	txn.initialize()
 	return int(txn.index.Count())
 }
 
+// MinOf finds the row with the smallest value of the numeric column within the current
+// selection and returns its index along with the value, converted to float64.
+func (txn *Txn) MinOf(columnName string) (idx uint32, min float64, ok bool) {
+	if column, found := txn.columnAt(columnName); found {
+		if c, isNumeric := column.Column.(interface {
+			argMin(*Txn, func(any) any) (uint32, float64, bool)
+		}); isNumeric {
+			return c.argMin(txn, txn.maskOf(columnName))
+		}
+	}
+	return
+}
+
+// MaxOf finds the row with the largest value of the numeric column within the current
+// selection and returns its index along with the value, converted to float64.
+func (txn *Txn) MaxOf(columnName string) (idx uint32, max float64, ok bool) {
+	if column, found := txn.columnAt(columnName); found {
+		if c, isNumeric := column.Column.(interface {
+			argMax(*Txn, func(any) any) (uint32, float64, bool)
+		}); isNumeric {
+			return c.argMax(txn, txn.maskOf(columnName))
+		}
+	}
+	return
+}
+
+// PickWeighted selects a random row from the current selection, with the probability of
+// each row being proportional to its value of the numeric (weight) column. Rows which have
+// no weight or a weight which is not positive are never selected.
+func (txn *Txn) PickWeighted(columnName string) (idx uint32, ok bool) {
+	if column, found := txn.columnAt(columnName); found {
+		if c, isNumeric := column.Column.(interface {
+			pickWeighted(*Txn, func(any) any) (uint32, bool)
+		}); isNumeric {
+			return c.pickWeighted(txn, txn.maskOf(columnName))
+		}
+	}
+	return
+}
+
 // DeleteAt attempts to delete an item at the specified index for this transaction. If the item
 // exists, it marks at as deleted and returns true, otherwise it returns false.
+//
+// The row is only deleted when the transaction commits and remains in the selection of the
+// transaction until then. To delete rows while iterating over them, use RangeDelete().
 func (txn *Txn) DeleteAt(index uint32) bool {
 	txn.initialize()
 	if !txn.index.Contains(index) {
@@ -363,6 +557,11 @@ func (txn *Txn) Insert(fn func(Row) error) (uint32, error) {
 
 // insert creates an insertion cursor for a given column and expiration time.
 func (txn *Txn) insert(fn func(Row) error, expireAt int64) (uint32, error) {
+	if quota := txn.owner.quota; quota != nil {
+		if err := quota(); err != nil {
+			return 0, err
+		}
+	}
 
 	// At a new index, add the insertion marker
 	idx := txn.owner.next()
@@ -380,9 +579,21 @@ func (txn *Txn) insert(fn func(Row) error, expireAt int64) (uint32, error) {
 // --------------------------- Iteration ----------------------------
 
 // Range selects and iterates over result set. In each iteration step, the internal
-// transaction cursor is updated and can be used by various column accessors.
+// transaction cursor is updated and can be used by various column accessors. The rows
+// are visited in the ascending order of their indexes, unless hinted otherwise with
+// WithOrder().
 func (txn *Txn) Range(fn func(idx uint32)) error {
 	txn.initialize()
+	txn.enterCallback()
+	defer txn.leaveCallback()
+	if txn.hints.order == OrderShuffled {
+		txn.rangeShuffled(func(idx uint32) bool {
+			fn(idx)
+			return true
+		})
+		return nil
+	}
+
 	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
 		offset := chunk.Min()
 		index.Range(func(x uint32) {
@@ -393,6 +604,100 @@ func (txn *Txn) Range(fn func(idx uint32)) error {
 	return nil
 }
 
+// RangeRows iterates over the result set and calls the function with a row positioned at
+// each one of the selected rows. The row can be used to both read and write the values of
+// any column within a single callback, without creating the column accessors upfront or
+// calling QueryAt() from within Range(). If the function returns an error, the iteration
+// stops and the error is returned. Similarly to Range(), the rows are visited in ascending
+// order unless hinted otherwise.
+func (txn *Txn) RangeRows(fn func(r Row) error) (err error) {
+	txn.initialize()
+	txn.enterCallback()
+	defer txn.leaveCallback()
+	iterate := txn.rangeReadUntil
+	if txn.hints.order == OrderShuffled {
+		iterate = txn.rangeShuffled
+	}
+
+	iterate(func(idx uint32) bool {
+		err = fn(Row{txn})
+		return err == nil
+	})
+	return
+}
+
+// RangeDelete iterates over the result set and deletes the rows for which the function
+// returns true. Every row of the selection is visited exactly once in ascending order,
+// and the values of a row can still be read within the callback. Once visited, a deleted
+// row is removed from the selection of the transaction, so the subsequent operations of
+// the same transaction no longer observe it. The rows are actually deleted when the
+// transaction commits and are kept if it rolls back. It returns the number of rows deleted.
+func (txn *Txn) RangeDelete(fn func(idx uint32) bool) (deleted int) {
+	txn.initialize()
+	txn.enterCallback()
+	defer txn.leaveCallback()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		offset := chunk.Min()
+		index.Filter(func(x uint32) bool {
+			txn.cursor = offset + x
+			if !fn(offset + x) {
+				return true
+			}
+
+			txn.deleteAt(offset + x)
+			deleted++
+			return false
+		})
+	})
+	return
+}
+
+// First calls the specified function on the first row of the current selection, if any,
+// and returns whether such a row was found. This stops scanning as soon as a row is found.
+func (txn *Txn) First(fn func(idx uint32)) (found bool) {
+	txn.initialize()
+	txn.rangeReadUntil(func(idx uint32) bool {
+		found = true
+		fn(idx)
+		return false
+	})
+	return
+}
+
+// Exists returns whether the current selection contains at least one row. This is a cheaper
+// alternative to Count() > 0 since it does not need to count the entire selection. It is not
+// named Any(), since Any() returns an accessor for the values of a column of any type.
+func (txn *Txn) Exists() bool {
+	txn.initialize()
+	_, ok := txn.index.Min()
+	return ok
+}
+
+// All returns whether the predicate holds for every row of the current selection. This
+// stops scanning as soon as a row which does not satisfy the predicate is found. Similar
+// to Range(), the cursor is moved to the row for which the predicate is called.
+func (txn *Txn) All(predicate func(idx uint32) bool) (all bool) {
+	txn.initialize()
+	all = true
+	txn.rangeReadUntil(func(idx uint32) bool {
+		all = predicate(idx)
+		return all
+	})
+	return
+}
+
+// enterCallback marks the start of a callback, during which the read locks are held
+func (txn *Txn) enterCallback() {
+	txn.callbacks++
+}
+
+// leaveCallback marks the end of a callback
+func (txn *Txn) leaveCallback() {
+	if txn.callbacks--; txn.callbacks == 0 {
+		txn.guard.clearReads()
+	}
+}
+
 // Ascend through a given SortedIndex and returns each offset
 // remaining in the transaction's index
 func (txn *Txn) Ascend(sortIndexName string, fn func(idx uint32)) error {
@@ -442,10 +747,13 @@ func (txn *Txn) InsertKey(key string, fn func(Row) error) error {
 	if idx, ok := txn.owner.pk.OffsetOf(key); ok {
 		return fmt.Errorf("column: key '%s' already exists at offset %d", key, idx)
 	}
+	if _, err := txn.keyParts(key); err != nil {
+		return err
+	}
 
 	// If not found, insert at a new index
 	idx, err := txn.insert(fn, 0)
-	txn.bufferFor(txn.owner.pk.name).PutString(commit.Put, idx, key)
+	txn.putKey(idx, key)
 	return err
 }
 
@@ -458,13 +766,64 @@ func (txn *Txn) UpsertKey(key string, fn func(Row) error) error {
 	if idx, ok := txn.owner.pk.OffsetOf(key); ok {
 		return txn.QueryAt(idx, fn)
 	}
+	if _, err := txn.keyParts(key); err != nil {
+		return err
+	}
 
 	// If not found, insert at a new index
 	idx, err := txn.insert(fn, 0)
-	txn.bufferFor(txn.owner.pk.name).PutString(commit.Put, idx, key)
+	txn.putKey(idx, key)
 	return err
 }
 
+// InsertOrMerge inserts a row with the values of the object if the primary key does not
+// exist, or merges the values of the object into the existing row otherwise, similarly to
+// INSERT ... ON CONFLICT in SQL. When both the row and the object have a different value for
+// a column, the merge function resolves the conflict by returning the value to keep, while
+// the incoming value is kept if the function is nil. The numbers are converted to the type
+// of their column, and the read-only columns are only written on insert.
+func (txn *Txn) InsertOrMerge(key string, object map[string]any, merge func(column string, current, incoming any) any) error {
+	if txn.owner.pk == nil {
+		return errNoKey
+	}
+
+	idx, exists := txn.owner.pk.OffsetOf(key)
+	fn := func(r Row) error {
+		for name, value := range object {
+			column, ok := txn.columnAt(name)
+			switch {
+			case name == txn.owner.pk.name:
+				continue
+			case !ok || column.IsIndex() || (exists && column.IsReadOnly()):
+				continue
+			}
+
+			if c, ok := column.Column.(converter); ok {
+				value = c.convert(value)
+			}
+
+			if current, ok := column.Value(r.Index()); exists && ok {
+				if reflect.DeepEqual(current, value) {
+					continue
+				}
+				if merge != nil {
+					value = merge(name, current, value)
+				}
+			}
+
+			if err := txn.Any(name).Set(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if exists {
+		return txn.QueryAt(idx, fn)
+	}
+	return txn.InsertKey(key, fn)
+}
+
 // QueryKey queries/updates a row given its corresponding primary key.
 func (txn *Txn) QueryKey(key string, fn func(Row) error) error {
 	if txn.owner.pk == nil {
@@ -478,6 +837,27 @@ func (txn *Txn) QueryKey(key string, fn func(Row) error) error {
 	return fmt.Errorf("column: key '%s' was not found", key)
 }
 
+// WithKeyPrefix applies a logical AND operation between the current query and the rows whose
+// primary key starts with the prefix. If the collection has no primary key, the result is empty.
+func (txn *Txn) WithKeyPrefix(prefix string) *Txn {
+	txn.initialize()
+	txn.trace("withKeyPrefix", false, prefix)
+	if txn.owner.pk == nil {
+		txn.index.Clear()
+		return txn
+	}
+
+	var rows bitmap.Bitmap
+	for _, key := range txn.owner.pk.keysWithPrefix(prefix) {
+		if idx, ok := txn.owner.pk.OffsetOf(key); ok {
+			rows.Set(idx)
+		}
+	}
+
+	txn.index.And(rows)
+	return txn
+}
+
 // DeleteKey deletes a row for a given primary key.
 func (txn *Txn) DeleteKey(key string) error {
 	if txn.owner.pk == nil {
@@ -492,6 +872,24 @@ func (txn *Txn) DeleteKey(key string) error {
 	return fmt.Errorf("column: key '%s' was not found", key)
 }
 
+// DeleteKeys deletes the rows for the given primary keys and returns the number of rows
+// which existed. The keys which are not found are ignored.
+func (txn *Txn) DeleteKeys(keys []string) (deleted int) {
+	if txn.owner.pk == nil {
+		return 0
+	}
+
+	var rows bitmap.Bitmap
+	for _, key := range keys {
+		if idx, ok := txn.owner.pk.OffsetOf(key); ok && !rows.Contains(idx) {
+			rows.Set(idx)
+			txn.deleteAt(idx)
+			deleted++
+		}
+	}
+	return
+}
+
 // --------------------------- Commit & Rollback ----------------------------
 
 // Rollback empties the pending update and delete queues and does not apply any of
@@ -502,16 +900,25 @@ func (txn *Txn) rollback() {
 	atomic.StoreUint64(&txn.owner.count, uint64(txn.owner.fill.Count()))
 	txn.owner.lock.Unlock()
 
+	txn.outbox = txn.outbox[:0]
 	txn.reset()
 }
 
 // Commit commits the transaction by applying all pending updates and deletes to
 // the collection. This operation is can be called several times for a transaction
 // in order to perform partial commits. If there's no pending updates/deletes, this
-// operation will result in a no-op.
-func (txn *Txn) commit() {
+// operation will result in a no-op. If the info is specified, it is populated with the
+// information about the changes committed.
+func (txn *Txn) commit(info *CommitInfo) {
 	defer txn.reset()
 
+	// Stamp the columns which are automatically populated with the current time
+	txn.commitStamps()
+	txn.commitExpiry()
+	if info != nil {
+		txn.describe(info)
+	}
+
 	// Mark the dirty chunks from the updates
 	for _, u := range txn.updates {
 		u.RangeChunks(func(chunk commit.Chunk) {
@@ -519,45 +926,107 @@ func (txn *Txn) commit() {
 		})
 	}
 
+	// Find the chunk whose commit records the messages enqueued, if any. The messages are
+	// only delivered once every chunk was applied and published.
+	var delivered bool
+	outboxChunk, enqueued := txn.outboxChunk()
+	if enqueued {
+		defer func() { txn.releaseOutbox(delivered) }()
+	}
+
 	// Grow the size of the fill list
+	txn.logCommit()
 	markers, changedRows := txn.findMarkers()
 	if last, ok := txn.dirty.Max(); ok {
 		txn.commitCapacity(commit.Chunk(last))
 	}
 
+	// Find the rows whose lifecycle metadata is stamped, if tracked
+	var lifecycle *lifecycleStamp
+	if txn.owner.options().Storage.Lifecycle {
+		lifecycle = txn.lifecycleStamp()
+	}
+
 	// Commit chunk by chunk to reduce lock contentions
-	txn.rangeWrite(func(commitID uint64, chunk commit.Chunk, fill bitmap.Bitmap) {
+	audit := txn.owner.options().Events.Audit != nil
+	txn.rangeWrite(func(commitID uint64, chunk commit.Chunk) {
+		txn.commitSequences(chunk)
+
+		// Record the messages while the latch is held, so that their IDs follow the commits
+		if enqueued && chunk == outboxChunk {
+			txn.recordOutbox(commitID, chunk)
+		}
+	}, func(r *commit.Reader, commitID uint64, chunk commit.Chunk, fill bitmap.Bitmap) bool {
+		// The chunks may be applied in parallel, so the state shared between them is either
+		// written by the prepare step above or guarded by its own lock.
+		var audited map[uint32]*AuditRow
+		if audit {
+			audited = txn.auditBefore(r, chunk, markers)
+		}
+
 		if changedRows {
-			txn.commitMarkers(chunk, fill, markers)
+			txn.commitMarkers(r, chunk, fill, markers)
 		}
 
 		// Attemp to update, if nothing was changed we're done
-		updated := txn.commitUpdates(chunk)
-		if !changedRows && !updated {
-			return
+		updated := txn.commitUpdates(r, chunk)
+		recorded := enqueued && chunk == outboxChunk
+		if !changedRows && !updated && !recorded {
+			return false
+		}
+
+		if lifecycle != nil {
+			txn.commitLifecycle(r, chunk, commitID, lifecycle)
+		}
+
+		// Invalidate the cached queries, now that the changes are visible
+		txn.owner.changed()
+		if txn.owner.options().Storage.Paranoid {
+			txn.owner.updateChecksums(chunk)
+		}
+		txn.owner.updateSizes(chunk)
+		if audit {
+			txn.auditAfter(audited, commitID)
+		}
+		if info != nil {
+			info.observe(commitID)
+		}
+		return true
+	}, func(commitID uint64, chunk commit.Chunk) {
+		change := commit.Commit{
+			ID:      commitID,
+			Chunk:   chunk,
+			Updates: txn.updates,
+		}
+
+		// The messages are written along with the changes of the chunk which recorded them
+		if enqueued && chunk == outboxChunk {
+			change.Updates = append(txn.updates[:len(txn.updates):len(txn.updates)], txn.messages)
+		}
+
+		// Record the commit into the history, so that the past versions can be rebuilt
+		if txn.owner.options().History.enabled() {
+			txn.owner.history.record(change)
 		}
 
 		// If there is a pending snapshot, append commit into a temp log
 		if dst, ok := txn.owner.isSnapshotting(); ok {
-			dst.Append(commit.Commit{
-				ID:      commitID,
-				Chunk:   chunk,
-				Updates: txn.updates,
-			})
+			dst.Append(change)
 		}
 
-		if txn.logger != nil {
-			txn.logger.Append(commit.Commit{
-				ID:      commitID,
-				Chunk:   chunk,
-				Updates: txn.updates,
-			})
-		}
+		txn.publish(change)
 	})
+
+	if audit {
+		txn.publishAudits()
+	}
+	delivered = true
 }
 
-// commitUpdates applies the pending updates to the collection.
-func (txn *Txn) commitUpdates(chunk commit.Chunk) (updated bool) {
+// commitUpdates applies the pending updates to the collection. Only the columns which
+// have operations in the chunk (and their computed columns) are touched, so the index
+// maintenance scales with the number of dirty chunks rather than the size of the commit.
+func (txn *Txn) commitUpdates(reader *commit.Reader, chunk commit.Chunk) (updated bool) {
 	for _, u := range txn.updates {
 		if u.IsEmpty() || u.Column == rowColumn {
 			continue // No updates for this column
@@ -571,16 +1040,27 @@ func (txn *Txn) commitUpdates(chunk commit.Chunk) (updated bool) {
 
 		// Apply the updates on the column itself first. This may result in a modified
 		// buffer caused by merge updates, so we need to range our indexes separately.
-		updated = true
-		txn.reader.Range(u, chunk, func(r *commit.Reader) {
+		dirty := false
+		reader.Range(u, chunk, func(r *commit.Reader) {
+			dirty = true
 			columns[0].Apply(chunk, r)
 		})
 
-		// Range through all of the computed columns and apply the final state updates.
-		if len(columns) > 1 {
-			txn.reader.Range(u, chunk, func(r *commit.Reader) {
+		if dirty {
+			txn.owner.changes.mark(u.Column, chunk)
+		}
+
+		// Range through all of the computed columns and apply the final state updates. Since
+		// only the final state matters, we coalesce the operations so that the computed
+		// columns are only updated once per row.
+		updated = updated || dirty
+		if dirty && len(columns) > 1 {
+			reader.Coalesce(u, chunk)
+			reader.Range(u, chunk, func(r *commit.Reader) {
 				for _, v := range columns[1:] {
-					v.Apply(chunk, r)
+					if txn.restored[v.name] == nil {
+						v.Apply(chunk, r)
+					}
 				}
 			})
 		}
@@ -589,31 +1069,181 @@ func (txn *Txn) commitUpdates(chunk commit.Chunk) (updated bool) {
 }
 
 // commitMarkers commits inserts and deletes to the collection.
-func (txn *Txn) commitMarkers(chunk commit.Chunk, fill bitmap.Bitmap, buffer *commit.Buffer) {
-	txn.reader.Range(buffer, chunk, func(r *commit.Reader) {
+func (txn *Txn) commitMarkers(reader *commit.Reader, chunk commit.Chunk, fill bitmap.Bitmap, buffer *commit.Buffer) {
+	deletes := false
+	reader.Range(buffer, chunk, func(r *commit.Reader) {
 		txn.owner.lock.Lock()
+		delta := int64(0)
 		for r.Next() {
+			idx := r.Index()
 			switch r.Type {
 			case commit.Insert:
-				txn.owner.fill.Set(r.Index())
+				if !txn.owner.fill.Contains(idx) {
+					txn.owner.fill.Set(idx)
+					delta++
+				}
 			case commit.Delete:
-				txn.owner.fill.Remove(r.Index())
+				deletes = true
+				if txn.owner.fill.Contains(idx) {
+					txn.owner.fill.Remove(idx)
+					delta--
+				}
 			}
 		}
+
+		// Adjust the count by the number of rows changed in this chunk only, instead of
+		// counting the entire fill list for every commit.
+		atomic.AddUint64(&txn.owner.count, uint64(delta))
 		txn.owner.lock.Unlock()
+		txn.owner.changes.mark(rowColumn, chunk)
 	})
 
 	// We also need to apply the delete operations on the column so it
 	// can remove unnecessary data.
-	txn.reader.Range(buffer, chunk, func(r *commit.Reader) {
+	if !deletes {
+		return
+	}
+
+	reader.Range(buffer, chunk, func(r *commit.Reader) {
 		txn.owner.cols.Range(func(column *column) {
 			column.Apply(chunk, r)
 		})
 	})
+	txn.owner.cols.Range(func(column *column) {
+		if !column.IsIndex() {
+			txn.owner.changes.mark(column.name, chunk)
+		}
+	})
+}
 
-	txn.owner.lock.Lock()
-	atomic.StoreUint64(&txn.owner.count, uint64(txn.owner.fill.Count()))
-	txn.owner.lock.Unlock()
+// checkReadOnly validates that the transaction does not update any pseudo-column, nor any
+// read-only column of the rows which were not inserted by the transaction itself.
+func (txn *Txn) checkReadOnly() error {
+	if txn.system {
+		return nil
+	}
+
+	var inserted bitmap.Bitmap
+	var loaded bool
+	for _, u := range txn.updates {
+		if u.IsEmpty() || u.Column == rowColumn {
+			continue
+		}
+
+		if isPseudo(u.Column) {
+			return fmt.Errorf("column: unable to update pseudo-column '%s'", u.Column)
+		}
+
+		column, ok := txn.owner.cols.Load(u.Column)
+		if !ok || !column.IsReadOnly() {
+			continue
+		}
+
+		// Lazily find the inserted rows, only once per commit
+		if !loaded {
+			inserted, _ = txn.findChanges()
+			loaded = true
+		}
+
+		txn.reader.Seek(u)
+		for txn.reader.Next() {
+			if !inserted.Contains(txn.reader.Index()) {
+				return fmt.Errorf("column: unable to update read-only column '%s'", u.Column)
+			}
+		}
+	}
+	return nil
+}
+
+// checkWrites returns an error if a read-only transaction attempts to change the collection
+func (txn *Txn) checkWrites() error {
+	if !txn.readOnly {
+		return nil
+	}
+
+	for _, u := range txn.updates {
+		if !u.IsEmpty() {
+			return fmt.Errorf("column: unable to change the collection in a read-only query")
+		}
+	}
+
+	if len(txn.outbox) > 0 {
+		return fmt.Errorf("column: unable to enqueue a message in a read-only query")
+	}
+	return nil
+}
+
+// commitStamps populates the columns which are configured to be automatically stamped
+// with the current time or a sequence, for every row inserted or updated by the transaction.
+func (txn *Txn) commitStamps() {
+	var inserted, updated bitmap.Bitmap
+	var now int64
+	txn.owner.cols.Range(func(column *column) {
+		mode, seq := column.stampMode()
+		if mode == 0 {
+			return
+		}
+
+		// Lazily find the changed rows, only once per commit
+		if now == 0 {
+			now = time.Now().UnixNano()
+			inserted, updated = txn.findChanges()
+		}
+
+		rows := inserted
+		if mode&stampUpdate != 0 {
+			rows = updated
+		}
+
+		if rows.Count() == 0 {
+			return
+		}
+
+		// Values which were explicitly set by the transaction must not be overwritten, and the
+		// sequence must continue after them so that the values drawn do not collide
+		var explicit bitmap.Bitmap
+		buffer := txn.bufferFor(column.name)
+		txn.reader.Seek(buffer)
+		for txn.reader.Next() {
+			explicit.Set(txn.reader.Index())
+			if seq != nil && txn.reader.Type == commit.Put {
+				seq.observe(txn.reader.Uint64())
+			}
+		}
+
+		// The sequence is only drawn once the latch of each chunk is held, so the values
+		// are assigned in the order in which the commits are applied.
+		if mode&stampSequence != 0 {
+			n := len(txn.sequences)
+			if n == cap(txn.sequences) {
+				txn.sequences = append(txn.sequences, sequenceStamp{})
+			}
+
+			txn.sequences = txn.sequences[:n+1]
+			stamp := &txn.sequences[n]
+			stamp.seq, stamp.buffer = seq, buffer
+			rows.Clone(&stamp.rows)
+			stamp.rows.AndNot(explicit)
+			return
+		}
+
+		rows.Range(func(idx uint32) {
+			if !explicit.Contains(idx) {
+				buffer.PutInt64(commit.Put, idx, now)
+			}
+		})
+	})
+}
+
+// commitSequences draws the values of the sequences for the rows of a chunk. This must be
+// called while holding the latch of the chunk, and never concurrently for the chunks of
+// the same transaction since they share the buffers.
+func (txn *Txn) commitSequences(chunk commit.Chunk) {
+	for _, stamp := range txn.sequences {
+		chunk.Range(stamp.rows, func(idx uint32) {
+			stamp.buffer.PutUint64(commit.Put, idx, stamp.seq.next())
+		})
+	}
 }
 
 // commitCapacity grows all columns until they reach the max index
@@ -639,6 +1269,41 @@ func (txn *Txn) commitCapacity(last commit.Chunk) {
 
 // --------------------------- Buffer Lookups ----------------------------
 
+// isParallel returns whether the chunks of the transaction can be committed in parallel
+func (txn *Txn) isParallel() bool {
+	for _, u := range txn.updates {
+		if !u.IsParallel() {
+			return false
+		}
+	}
+	return true
+}
+
+// findChanges finds the rows which were inserted by the transaction, as well as all of the
+// rows which were either inserted or updated. Rows which were deleted are not included.
+func (txn *Txn) findChanges() (inserted, updated bitmap.Bitmap) {
+	var deleted bitmap.Bitmap
+	for _, u := range txn.updates {
+		txn.reader.Seek(u)
+		for txn.reader.Next() {
+			idx := txn.reader.Index()
+			switch {
+			case u.Column != rowColumn:
+				updated.Set(idx)
+			case txn.reader.Type == commit.Insert:
+				inserted.Set(idx)
+				updated.Set(idx)
+			case txn.reader.Type == commit.Delete:
+				deleted.Set(idx)
+			}
+		}
+	}
+
+	inserted.AndNot(deleted)
+	updated.AndNot(deleted)
+	return
+}
+
 // findMarkers finds a set of insert/deletes
 func (txn *Txn) findMarkers() (*commit.Buffer, bool) {
 	for _, u := range txn.updates {
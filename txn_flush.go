@@ -0,0 +1,90 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kelindar/column/commit"
+)
+
+// flushState represents the commits flushed by a transaction, which are only published to
+// the commit log and the replicas once the transaction completes.
+type flushState struct {
+	sync.Mutex                 // The mutex, since chunks may be committed in parallel
+	active     bool            // Whether a flush is in progress
+	commits    []commit.Commit // The commits which are not yet published
+	info       CommitInfo      // The information about the flushed commits
+}
+
+// Flush applies the pending changes of the transaction to the collection, so that they are
+// visible to the subsequent reads of the same transaction, for example when some values are
+// computed in several passes. The filters of the transaction are not re-evaluated.
+//
+// The first flush acquires the write locks of the collection and holds them until the
+// transaction completes, so the other transactions do not observe the flushed changes in
+// the meantime and wait for the transaction instead. The flushed changes are written to the
+// commit log and the replicas once the transaction completes, and are kept even if it rolls
+// back. Since the read locks are held during the callbacks, it can not be called from within
+// Range() or QueryAt(), nor in a query with the ReadSnapshot consistency level.
+func (txn *Txn) Flush() error {
+	if txn.callbacks > 0 || txn.stable {
+		return errFlushLocked
+	}
+
+	if err := txn.checkReadOnly(); err != nil {
+		return err
+	}
+	if err := txn.checkOverflow(); err != nil {
+		return err
+	}
+
+	if !txn.exclusive {
+		txn.lockExclusive()
+	}
+
+	// Keep the privileges of the transaction, since the commit resets it
+	var info CommitInfo
+	system := txn.system
+	txn.flushed.active = true
+	txn.commit(&info)
+	txn.flushed.active = false
+	txn.system = system
+	txn.flushed.info.add(info)
+	return nil
+}
+
+// publish sends the commit to the commit log and the replicas of the collection. While the
+// transaction is being flushed, a copy of the commit is kept until it completes.
+func (txn *Txn) publish(change commit.Commit) {
+	if txn.flushed.active {
+		txn.flushed.Lock()
+		txn.flushed.commits = append(txn.flushed.commits, change.Clone())
+		txn.flushed.Unlock()
+		return
+	}
+
+	// The changes are already applied, so the transaction can only report the failure
+	if txn.logger != nil {
+		if err := txn.logger.Append(change); err != nil && txn.logged == nil {
+			txn.logged = fmt.Errorf("column: unable to log commit %d, %w", change.ID, err)
+		}
+	}
+	txn.owner.replicate(change)
+}
+
+// publishFlushed publishes the commits flushed by the transaction and returns the information
+// about them. This must be called before the final commit of the transaction, in order to
+// publish the commits in the order of their IDs.
+func (txn *Txn) publishFlushed() (info CommitInfo) {
+	for _, change := range txn.flushed.commits {
+		txn.publish(change)
+	}
+
+	info = txn.flushed.info
+	txn.flushed.commits = txn.flushed.commits[:0]
+	txn.flushed.info = CommitInfo{}
+	return
+}
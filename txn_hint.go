@@ -0,0 +1,208 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// maxSampleStride is the largest stride of the sampled blocks, so that at least 1/64 of the
+// rows are always evaluated
+const maxSampleStride = 64
+
+// Hint represents a hint which overrides the evaluation strategy of a transaction, for
+// example to get a more predictable latency. Hints can be created with UseIndex(), NoParallel(),
+// Unmask(), WithinLatency(), WithPriority() or WithOrder() and are applied using Hint() on the
+// transaction.
+type Hint func(*hints)
+
+// hints represents the hints of a transaction
+type hints struct {
+	indexes    []string      // The indexes which contain every row matching the filters
+	noParallel bool          // Whether the chunks must be committed sequentially
+	unmask     string        // The token which unmasks the masked columns
+	latency    time.Duration // The target latency of the query
+	start      time.Time     // The time at which the target latency was hinted
+	stride     int           // The stride of the sampled blocks, or zero if not sampled
+	priority   Priority      // The priority lane of the commit
+	order      Order         // The order in which the rows are visited
+}
+
+// UseIndex hints that the specified indexes contain every row matching the filters of
+// WithExpr() and WithFilter(), so that these filters are only evaluated on the rows of the
+// indexes instead of the entire selection. If an index does not contain some of the matching
+// rows, they are not selected. The names which do not refer to an index are ignored.
+func UseIndex(indexNames ...string) Hint {
+	return func(h *hints) {
+		h.indexes = append(h.indexes, indexNames...)
+	}
+}
+
+// NoParallel hints that the changes of the transaction must be committed sequentially,
+// instead of committing the chunks in parallel on all of the available cores.
+func NoParallel() Hint {
+	return func(h *hints) {
+		h.noParallel = true
+	}
+}
+
+// Unmask hints that the transaction may read the actual values of the masked columns, if the
+// token matches the Query.UnmaskToken of the collection. Otherwise, the values remain masked.
+func Unmask(token string) Hint {
+	return func(h *hints) {
+		h.unmask = token
+	}
+}
+
+// WithinLatency hints that the query should complete within the target latency. The collection
+// keeps track of the latency of the queries with this hint and, once they exceed the target,
+// the selection of the transaction is sampled down to a fraction of the rows which can be
+// evaluated in time, so the results become approximate. This is reported by IsApproximate()
+// and the counts or sums can be extrapolated using SampleRate(). Since the writes would only
+// apply to the sampled rows, a sampled transaction which changes the collection fails.
+func WithinLatency(target time.Duration) Hint {
+	return func(h *hints) {
+		h.latency = target
+	}
+}
+
+// Hint applies the hints to the transaction, which remain in effect until it completes.
+func (txn *Txn) Hint(hints ...Hint) *Txn {
+	for _, fn := range hints {
+		fn(&txn.hints)
+	}
+
+	if txn.hints.latency > 0 && txn.hints.start.IsZero() {
+		txn.hints.start = time.Now()
+		txn.sample(txn.owner.latency.strideFor(txn.hints.latency))
+	}
+	return txn
+}
+
+// IsApproximate returns whether the selection of the transaction was sampled in order to meet
+// the target latency of the WithinLatency() hint, in which case the results are approximate.
+func (txn *Txn) IsApproximate() bool {
+	return txn.hints.stride > 1
+}
+
+// SampleRate returns the fraction of the rows which are evaluated by the transaction, which
+// is one unless the selection was sampled. Dividing a count or a sum by the sample rate gives
+// an estimate of its exact value.
+func (txn *Txn) SampleRate() float64 {
+	if txn.hints.stride > 1 {
+		return 1 / float64(txn.hints.stride)
+	}
+	return 1
+}
+
+// sample narrows down the selection to one block of 64 rows out of every stride blocks
+func (txn *Txn) sample(stride int) {
+	if stride <= 1 {
+		return
+	}
+
+	txn.initialize()
+	txn.hints.stride = stride
+	for i := range txn.index {
+		if i%stride != 0 {
+			txn.index[i] = 0
+		}
+	}
+}
+
+// checkSampled returns an error if a sampled transaction attempts to change the collection
+func (txn *Txn) checkSampled() error {
+	if txn.hints.stride <= 1 {
+		return nil
+	}
+
+	for _, u := range txn.updates {
+		if !u.IsEmpty() {
+			return fmt.Errorf("column: unable to commit a sampled transaction, the results are approximate")
+		}
+	}
+	return nil
+}
+
+// useIndexes narrows down the selection to the indexes specified by the UseIndex() hint
+func (txn *Txn) useIndexes() {
+	for _, indexName := range txn.hints.indexes {
+		if column, ok := txn.columnAt(indexName); ok && column.IsIndex() {
+			txn.With(indexName)
+		}
+	}
+}
+
+// maskOf returns the function which masks the values of a column, or nil if the column is not
+// masked or the transaction was unmasked with the token of the collection.
+func (txn *Txn) maskOf(columnName string) func(any) any {
+	if token := txn.owner.options().Query.UnmaskToken; token != "" && txn.hints.unmask == token {
+		return nil
+	}
+
+	if column, ok := txn.columnAt(columnName); ok {
+		return column.valueMask()
+	}
+	return nil
+}
+
+// maskAs masks a value read by a typed accessor. If the masked value is not of the type of the
+// column, the value is reported as missing rather than revealed.
+func maskAs[T any](mask func(any) any, v T, ok bool) (T, bool) {
+	if !ok || mask == nil {
+		return v, ok
+	}
+
+	masked, ok := mask(v).(T)
+	return masked, ok
+}
+
+// reset clears the hints
+func (h *hints) reset() {
+	h.indexes = h.indexes[:0]
+	h.noParallel = false
+	h.unmask = ""
+	h.latency = 0
+	h.start = time.Time{}
+	h.stride = 0
+	h.priority = PriorityNormal
+	h.order = OrderAscending
+}
+
+// --------------------------- Latency Tracker ----------------------------
+
+// latencyTracker keeps track of the latency of the queries with the WithinLatency() hint, in
+// order to decide whether the next ones need to be sampled.
+type latencyTracker struct {
+	estimate int64 // The moving average of the latency of an exact query, in nanoseconds
+}
+
+// observe records the latency of a query, extrapolated to the latency of an exact query
+func (t *latencyTracker) observe(elapsed time.Duration, stride int) {
+	if stride < 1 {
+		stride = 1
+	}
+
+	latency := int64(elapsed) * int64(stride)
+	if last := atomic.LoadInt64(&t.estimate); last > 0 {
+		latency = last + (latency-last)/4
+	}
+	atomic.StoreInt64(&t.estimate, latency)
+}
+
+// strideFor returns the stride of the sampled blocks required to meet the target latency
+func (t *latencyTracker) strideFor(target time.Duration) int {
+	estimate := atomic.LoadInt64(&t.estimate)
+	if estimate <= int64(target) {
+		return 0
+	}
+
+	stride := int((estimate + int64(target) - 1) / int64(target))
+	if stride > maxSampleStride {
+		stride = maxSampleStride
+	}
+	return stride
+}
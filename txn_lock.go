@@ -4,6 +4,11 @@
 package column
 
 import (
+	"math/bits"
+	"runtime"
+	"sync"
+	"time"
+
 	"github.com/kelindar/bitmap"
 	"github.com/kelindar/column/commit"
 )
@@ -13,6 +18,7 @@ const (
 	bitmapSize  = 1 << bitmapShift
 	chunkShift  = 14 // 16K
 	chunkSize   = 1 << chunkShift
+	lockShards  = 128 // The number of shards of the chunk locks
 )
 
 // initialize ensures that the transaction is pre-initialized with the snapshot
@@ -23,7 +29,7 @@ func (txn *Txn) initialize() {
 	}
 
 	txn.owner.lock.RLock()
-	txn.index.Grow(uint32(txn.owner.opts.Capacity))
+	txn.index.Grow(uint32(txn.owner.options().Capacity))
 	txn.owner.fill.Clone(&txn.index)
 	txn.owner.lock.RUnlock()
 	txn.setup = true
@@ -34,62 +40,305 @@ func (txn *Txn) initialize() {
 // QueryAt jumps at a particular offset in the collection, sets the cursor to the
 // provided position and executes given callback fn.
 func (txn *Txn) QueryAt(index uint32, f func(Row) error) (err error) {
-	lock := txn.owner.slock
 	txn.cursor = index
 
 	chunk := commit.ChunkAt(index)
-	lock.RLock(uint(chunk))
+	txn.rlock(chunk)
+	txn.enterCallback()
 	err = f(Row{txn})
-	lock.RUnlock(uint(chunk))
+	txn.leaveCallback()
+	txn.runlock(chunk)
 	return err
 }
 
+// --------------------------- Read Locks ---------------------------
+
+// rlock acquires a read lock for the chunk, unless the transaction already holds the
+// read or write locks of all chunks.
+func (txn *Txn) rlock(chunk commit.Chunk) {
+	if !txn.stable && !txn.exclusive {
+		txn.owner.slock.RLock(uint(chunk))
+		txn.held = append(txn.held, chunk)
+	}
+	txn.verify(chunk)
+}
+
+// runlock releases a read lock acquired by rlock()
+func (txn *Txn) runlock(chunk commit.Chunk) {
+	if !txn.stable && !txn.exclusive {
+		txn.owner.slock.RUnlock(uint(chunk))
+		txn.held = txn.held[:len(txn.held)-1]
+	}
+}
+
+// holds returns whether the transaction already holds a read lock which guards the chunk
+func (txn *Txn) holds(chunk commit.Chunk) bool {
+	for _, c := range txn.held {
+		if uint(c)%lockShards == uint(chunk)%lockShards {
+			return true
+		}
+	}
+	return false
+}
+
+// runlockHeld releases the read locks which are still held, when a callback was interrupted
+func (txn *Txn) runlockHeld() {
+	for i := len(txn.held) - 1; i >= 0; i-- {
+		txn.owner.slock.RUnlock(uint(txn.held[i]))
+	}
+	txn.held = txn.held[:0]
+}
+
+// lockStable acquires the read locks of all chunks, so the transaction observes a single
+// state of the collection until unlockStable() is called.
+func (txn *Txn) lockStable() {
+	for shard := uint(0); shard < lockShards; shard++ {
+		txn.owner.slock.RLock(shard)
+	}
+	txn.stable = true
+}
+
+// unlockStable releases the read locks acquired by lockStable()
+func (txn *Txn) unlockStable() {
+	if !txn.stable {
+		return
+	}
+
+	txn.stable = false
+	for shard := uint(0); shard < lockShards; shard++ {
+		txn.owner.slock.RUnlock(shard)
+	}
+}
+
+// lockExclusive acquires the write locks of all chunks, so that the changes flushed by the
+// transaction are not observed by other transactions until unlockExclusive() is called.
+func (txn *Txn) lockExclusive() {
+	for shard := uint(0); shard < lockShards; shard++ {
+		txn.owner.slock.Lock(shard)
+	}
+	txn.exclusive = true
+}
+
+// unlockExclusive releases the write locks acquired by lockExclusive()
+func (txn *Txn) unlockExclusive() {
+	if !txn.exclusive {
+		return
+	}
+
+	txn.exclusive = false
+	for shard := uint(0); shard < lockShards; shard++ {
+		txn.owner.slock.Unlock(shard)
+	}
+}
+
 // --------------------------- Locked Range ---------------------------
 
 // rangeRead iterates over index, chunk by chunk and ensures that each
 // chunk is protected by an appropriate read lock.
 func (txn *Txn) rangeRead(f func(chunk commit.Chunk, index bitmap.Bitmap)) {
 	limit := commit.Chunk(len(txn.index) >> bitmapShift)
-	lock := txn.owner.slock
-
 	for chunk := commit.Chunk(0); chunk <= limit; chunk++ {
-		lock.RLock(uint(chunk))
+		txn.rlock(chunk)
 		f(chunk, chunk.OfBitmap(txn.index))
-		lock.RUnlock(uint(chunk))
+		txn.runlock(chunk)
 	}
 }
 
+// rangeReadUntil iterates over the rows of the index, chunk by chunk and ensures that each
+// chunk is protected by an appropriate read lock. It stops as soon as the function returns
+// false and moves the cursor to the row being iterated.
+func (txn *Txn) rangeReadUntil(f func(idx uint32) bool) {
+	limit := commit.Chunk(len(txn.index) >> bitmapShift)
+	for chunk := commit.Chunk(0); chunk <= limit; chunk++ {
+		offset := chunk.Min()
+		txn.rlock(chunk)
+		next := rangeUntil(chunk.OfBitmap(txn.index), func(x uint32) bool {
+			txn.cursor = offset + x
+			return f(offset + x)
+		})
+		txn.runlock(chunk)
+		if !next {
+			return
+		}
+	}
+}
+
+// rangeUntil iterates over the set bits of the bitmap until the function returns false.
+func rangeUntil(index bitmap.Bitmap, fn func(x uint32) bool) bool {
+	for blkAt, blk := range index {
+		for blk != 0 {
+			if !fn(uint32(blkAt<<6 + bits.TrailingZeros64(blk))) {
+				return false
+			}
+			blk &= blk - 1
+		}
+	}
+	return true
+}
+
 // rangeReadPair iterates over the index and another bitmap, chunk by chunk and
 // ensures that each chunk is protected by an appropriate read lock.
 func (txn *Txn) rangeReadPair(column *column, f func(a, b bitmap.Bitmap)) {
 	limit := commit.Chunk(len(txn.index) >> bitmapShift)
-	lock := txn.owner.slock
 
 	// Iterate through all of the chunks and acquire appropriate shard locks.
 	for chunk := commit.Chunk(0); chunk <= limit; chunk++ {
-		lock.RLock(uint(chunk))
+		txn.rlock(chunk)
 		f(chunk.OfBitmap(txn.index), column.Index(chunk))
-		lock.RUnlock(uint(chunk))
+		txn.runlock(chunk)
 	}
 }
 
 // rangeWrite ranges over the dirty chunks and acquires exclusive latches along
-// the way. This is used to commit a transaction.
-func (txn *Txn) rangeWrite(fn func(commitID uint64, chunk commit.Chunk, fill bitmap.Bitmap)) {
-	lock := txn.owner.slock
+// the way. This is used to commit a transaction. If the transaction spans multiple
+// chunks, they are applied in parallel, each one with its own commit reader, while
+// the changed chunks are always published sequentially and in the order of the chunks.
+// The prepare delegate is always called sequentially on the calling goroutine, before
+// the chunk is applied, so it may write the state shared by the chunks of the transaction.
+// The delegate applying the chunk must only write the state of its own chunk, or the
+// state which is guarded by a lock.
+func (txn *Txn) rangeWrite(prepare func(commitID uint64, chunk commit.Chunk), fn func(r *commit.Reader, commitID uint64, chunk commit.Chunk, fill bitmap.Bitmap) bool, publish func(commitID uint64, chunk commit.Chunk)) {
+	count := txn.dirty.Count()
+	if count == 0 {
+		return
+	}
+
+	// Register the commit in its priority lane, so the lower lanes yield to it
+	txn.owner.lanes.enter(txn.hints.priority)
+	defer txn.owner.lanes.leave(txn.hints.priority)
+	if count <= 1 || txn.hints.noParallel || !txn.isParallel() {
+		txn.dirty.Range(func(x uint32) {
+			txn.writeChunk(txn.reader, commit.Chunk(x), prepare, fn, publish)
+		})
+		return
+	}
+
+	// Acquire the latches of all dirty chunks upfront and keep them until the chunks are
+	// published, so that the commits of each chunk are published in the order of their IDs.
+	chunks := make([]commit.Chunk, 0, count)
 	txn.dirty.Range(func(x uint32) {
-		chunk := commit.Chunk(x)
-		commitID := commit.Next()
-		lock.Lock(uint(chunk))
-
-		// Compute the fill and set the last commit ID
-		txn.owner.lock.RLock()
-		fill := chunk.OfBitmap(txn.owner.fill)
-		txn.owner.commits[chunk] = commitID // OK, since we have a shard lock
-		txn.owner.lock.RUnlock()
-
-		// Call the delegate
-		fn(commitID, chunk, fill)
-		lock.Unlock(uint(chunk))
+		chunks = append(chunks, commit.Chunk(x))
+	})
+	shards := txn.lockChunks(chunks)
+
+	// Generate the commit IDs and prepare the chunks before the fan-out
+	commits := make([]uint64, count)
+	fills := make([]bitmap.Bitmap, count)
+	for i, chunk := range chunks {
+		commits[i], fills[i] = txn.beginChunk(chunk)
+		prepare(commits[i], chunk)
+	}
+
+	// Start a worker per available core, but no more than the number of chunks
+	workers := runtime.GOMAXPROCS(0)
+	if workers > count {
+		workers = count
+	}
+
+	var wg sync.WaitGroup
+	queue := make(chan int, count)
+	changed := make([]bool, count)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader := txn.owner.txns.acquireReader()
+			for i := range queue {
+				changed[i] = fn(reader, commits[i], chunks[i], fills[i])
+			}
+			txn.owner.txns.releaseReader(reader)
+		}()
+	}
+
+	// Distribute the dirty chunks across the workers and wait for them
+	for i := range chunks {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	// Publish the changed chunks in order, before releasing their latches
+	for i, chunk := range chunks {
+		if changed[i] {
+			publish(commits[i], chunk)
+		}
+	}
+	txn.unlockChunks(shards)
+}
+
+// lockChunks acquires the exclusive latches of the chunks in the ascending order of their
+// shards, so that the commits holding several latches at once can not deadlock. If the
+// transaction already holds the write locks of all chunks, no latch is acquired.
+func (txn *Txn) lockChunks(chunks []commit.Chunk) (shards bitmap.Bitmap) {
+	if txn.exclusive {
+		return nil
+	}
+
+	for _, chunk := range chunks {
+		shards.Set(uint32(chunk) % lockShards)
+	}
+
+	txn.owner.lanes.yield(txn.hints.priority)
+	shards.Range(func(shard uint32) {
+		txn.lockChunk(commit.Chunk(shard))
 	})
+	return
+}
+
+// unlockChunks releases the latches acquired by lockChunks()
+func (txn *Txn) unlockChunks(shards bitmap.Bitmap) {
+	shards.Range(func(shard uint32) {
+		txn.owner.slock.Unlock(uint(shard))
+	})
+}
+
+// lockChunk acquires the exclusive latch of a chunk, and warns if it was contended
+func (txn *Txn) lockChunk(chunk commit.Chunk) {
+	l := txn.owner.warnings()
+	if l == nil {
+		txn.owner.slock.Lock(uint(chunk))
+		return
+	}
+
+	start := time.Now()
+	txn.owner.slock.Lock(uint(chunk))
+	if wait := time.Since(start); wait >= txn.owner.options().Logging.SlowLockWait {
+		l.Warn("column: chunk lock contention", "chunk", chunk, "wait", wait)
+	}
+}
+
+// writeChunk acquires an exclusive latch on a chunk, calls the delegates and publishes
+// the chunk if it was changed. If the transaction already holds the write locks of all
+// chunks, no latch is acquired.
+func (txn *Txn) writeChunk(r *commit.Reader, chunk commit.Chunk, prepare func(commitID uint64, chunk commit.Chunk), fn func(r *commit.Reader, commitID uint64, chunk commit.Chunk, fill bitmap.Bitmap) bool, publish func(commitID uint64, chunk commit.Chunk)) {
+	lock := txn.owner.slock
+	if !txn.exclusive {
+		txn.owner.lanes.yield(txn.hints.priority)
+		txn.lockChunk(chunk)
+	}
+
+	commitID, fill := txn.beginChunk(chunk)
+	prepare(commitID, chunk)
+	if fn(r, commitID, chunk, fill) {
+		publish(commitID, chunk)
+	}
+
+	if !txn.exclusive {
+		lock.Unlock(uint(chunk))
+	}
+}
+
+// beginChunk generates the commit ID of a chunk whose latch is held and returns it along
+// with the fill list of the chunk.
+func (txn *Txn) beginChunk(chunk commit.Chunk) (uint64, bitmap.Bitmap) {
+	// Generate the commit ID while holding the lock, so that the IDs of the commits of
+	// a chunk are always increasing in the order in which they are applied.
+	commitID := commit.Next()
+
+	// Compute the fill and set the last commit ID
+	txn.owner.lock.RLock()
+	fill := chunk.OfBitmap(txn.owner.fill)
+	txn.owner.commits[chunk] = commitID // OK, since we have a shard lock
+	txn.owner.lock.RUnlock()
+	return commitID, fill
 }
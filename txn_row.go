@@ -6,6 +6,7 @@ package column
 import (
 	"encoding"
 	"fmt"
+	"time"
 
 	"github.com/kelindar/column/commit"
 )
@@ -20,6 +21,22 @@ func (r Row) Index() uint32 {
 	return r.txn.Index()
 }
 
+// Version returns the version of the last commit which inserted or updated the row. This
+// requires the collection to be created with the Storage.Lifecycle option enabled.
+func (r Row) Version() (uint64, bool) {
+	return r.Uint64(versionColumn)
+}
+
+// CreatedAt returns the time at which the row was inserted. This requires the collection
+// to be created with the Storage.Lifecycle option enabled.
+func (r Row) CreatedAt() (time.Time, bool) {
+	nanos, ok := r.Int64(createdColumn)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
 // --------------------------- Numbers ----------------------------
 
 // Int loads a int value at a particular column
@@ -229,6 +246,59 @@ func (r Row) MergeRecord(columnName string, delta encoding.BinaryMarshaler) erro
 	return r.txn.Record(columnName).Merge(delta)
 }
 
+// --------------------------- Vectors ----------------------------
+
+// Vector loads a copy of the vector value at a particular column
+func (r Row) Vector(columnName string) ([]float32, bool) {
+	return rdVector(readerFor[*columnVector](r.txn, columnName)).Get()
+}
+
+// SetVector stores a vector value at a particular column
+func (r Row) SetVector(columnName string, value []float32) {
+	r.txn.Vector(columnName).Set(value)
+}
+
+// --------------------------- Packed ----------------------------
+
+// Packed loads a bit-packed value at a particular column
+func (r Row) Packed(columnName string) (int64, bool) {
+	return r.txn.Packed(columnName).Get()
+}
+
+// SetPacked stores a bit-packed value at a particular column
+func (r Row) SetPacked(columnName string, value int64) {
+	r.txn.Packed(columnName).Set(value)
+}
+
+// MergePacked atomically merges a delta into bit-packed value at a particular column
+func (r Row) MergePacked(columnName string, delta int64) {
+	r.txn.Packed(columnName).Merge(delta)
+}
+
+// --------------------------- Counter ----------------------------
+
+// Counter loads the estimated value of a windowed counter at a particular column
+func (r Row) Counter(columnName string) (int64, bool) {
+	return r.txn.Counter(columnName).Get()
+}
+
+// Increment atomically increments a windowed counter at a particular column
+func (r Row) Increment(columnName string, delta int64) {
+	r.txn.Counter(columnName).Increment(delta)
+}
+
+// --------------------------- Sketch ----------------------------
+
+// Sketch loads a copy of the sketch at a particular column
+func (r Row) Sketch(columnName string) (Sketch, bool) {
+	return r.txn.Sketch(columnName).Get()
+}
+
+// Observe atomically adds an item into the sketch at a particular column
+func (r Row) Observe(columnName string, item string) {
+	r.txn.Sketch(columnName).Add(item)
+}
+
 // --------------------------- Map ----------------------------
 
 // SetMany stores a set of columns for a given map
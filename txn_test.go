@@ -4,10 +4,16 @@
 package column
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"runtime"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/kelindar/column/commit"
 	"github.com/kelindar/xxrand"
@@ -154,6 +160,174 @@ func TestCount(t *testing.T) {
 	})
 }
 
+func TestCountDirtyChunks(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("name", ForString())
+	coll.CreateColumn("age", ForInt())
+	coll.CreateIndex("old", "age", func(r Reader) bool {
+		return r.Int() >= 30
+	})
+
+	for i := 0; i < 3*chunkSize; i++ {
+		coll.Insert(func(r Row) error {
+			r.SetInt("age", 20)
+			return nil
+		})
+	}
+
+	// Delete a few rows in the first chunk and update the last chunk only
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		for i := uint32(0); i < 10; i++ {
+			txn.DeleteAt(i)
+			txn.QueryAt(2*chunkSize+i, func(r Row) error {
+				r.SetInt("age", 40)
+				return nil
+			})
+		}
+		return nil
+	}))
+
+	assert.Equal(t, 3*chunkSize-10, coll.Count())
+	coll.Query(func(txn *Txn) error {
+		assert.Equal(t, 3*chunkSize-10, txn.Count())
+		assert.Equal(t, 10, txn.With("old").Count())
+		return nil
+	})
+}
+
+func TestRangeRows(t *testing.T) {
+	players := loadPlayers(500)
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		return txn.With("human").RangeRows(func(r Row) error {
+			balance, ok := r.Float64("balance")
+			assert.True(t, ok)
+			if balance > 2500 {
+				r.SetEnum("class", "mage")
+				r.SetFloat64("balance", 100)
+			}
+			return nil
+		})
+	}))
+
+	players.Query(func(txn *Txn) error {
+		assert.Equal(t, 0, txn.With("human").WithFloat("balance", func(v float64) bool {
+			return v > 2500
+		}).Count())
+		return nil
+	})
+
+	// Must stop on the first error and roll back
+	visited := 0
+	assert.Error(t, players.Query(func(txn *Txn) error {
+		return txn.RangeRows(func(r Row) error {
+			visited++
+			r.SetFloat64("balance", 0)
+			return fmt.Errorf("stop")
+		})
+	}))
+
+	assert.Equal(t, 1, visited)
+	players.Query(func(txn *Txn) error {
+		assert.Equal(t, 0, txn.WithFloat("balance", func(v float64) bool {
+			return v == 0
+		}).Count())
+		return nil
+	})
+}
+
+func TestRangeDelete(t *testing.T) {
+	players := loadPlayers(500)
+	players.Query(func(txn *Txn) error {
+		visited := 0
+		balance := txn.Float64("balance")
+		deleted := txn.With("human").RangeDelete(func(idx uint32) bool {
+			visited++
+			v, ok := balance.Get()
+			assert.True(t, ok)
+			return v > 2500
+		})
+
+		// Deleted rows are no longer part of the selection
+		assert.Equal(t, 138, visited)
+		assert.NotZero(t, deleted)
+		assert.Equal(t, 138-deleted, txn.Count())
+		assert.Equal(t, 0, txn.WithFloat("balance", func(v float64) bool {
+			return v > 2500
+		}).Count())
+
+		// Rollback, nothing is deleted
+		return fmt.Errorf("rollback")
+	})
+	assert.Equal(t, 500, players.Count())
+
+	// Commit the deletions this time
+	var deleted int
+	players.Query(func(txn *Txn) error {
+		deleted = txn.With("human").RangeDelete(func(idx uint32) bool {
+			return idx%2 == 0
+		})
+		return nil
+	})
+
+	assert.NotZero(t, deleted)
+	assert.Equal(t, 500-deleted, players.Count())
+	players.Query(func(txn *Txn) error {
+		assert.Equal(t, 138-deleted, txn.With("human").Count())
+		return txn.With("human").Range(func(idx uint32) {
+			assert.Equal(t, uint32(1), idx%2)
+		})
+	})
+}
+
+func TestFirstAnyAll(t *testing.T) {
+	players := loadPlayers(500)
+	players.Query(func(txn *Txn) error {
+		race := txn.Enum("race")
+		found := txn.With("human").First(func(idx uint32) {
+			v, _ := race.Get()
+			assert.Equal(t, "human", v)
+		})
+		assert.True(t, found)
+		return nil
+	})
+
+	// Empty selection
+	players.Query(func(txn *Txn) error {
+		txn.WithString("race", func(v string) bool {
+			return v == "goblin"
+		})
+
+		assert.False(t, txn.Exists())
+		assert.True(t, txn.All(func(idx uint32) bool { return false }))
+		assert.False(t, txn.First(func(idx uint32) {
+			assert.Fail(t, "unexpected row")
+		}))
+		return nil
+	})
+
+	// Non-empty selection
+	players.Query(func(txn *Txn) error {
+		race := txn.Enum("race")
+		assert.True(t, txn.With("human").Exists())
+		assert.True(t, txn.All(func(idx uint32) bool {
+			v, _ := race.Get()
+			return v == "human"
+		}))
+		return nil
+	})
+
+	// Must stop as soon as the predicate fails
+	players.Query(func(txn *Txn) error {
+		count := 0
+		assert.False(t, txn.All(func(idx uint32) bool {
+			count++
+			return false
+		}))
+		assert.Equal(t, 1, count)
+		return nil
+	})
+}
+
 func TestIndexInvalid(t *testing.T) {
 	players := loadPlayers(500)
 	players.Query(func(txn *Txn) error {
@@ -335,6 +509,116 @@ func TestSortIndex(t *testing.T) {
 	assert.Equal(t, "rob", res[2])
 }
 
+func TestWindow(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("ts", ForString())
+	c.CreateColumn("value", ForFloat64())
+	c.CreateSortIndex("byTime", "ts")
+	for i, v := range []float64{4, 1, 3, 2} {
+		c.Insert(func(r Row) error {
+			r.SetString("ts", fmt.Sprintf("t%d", 4-i))
+			r.SetFloat64("value", v)
+			return nil
+		})
+	}
+
+	// Rows are ordered as t1=2, t2=3, t3=1, t4=4
+	var avg, sum []float64
+	var lags, leads []bool
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		return txn.Window("byTime", 2).Range(func(f Frame) {
+			avg = append(avg, f.Avg("value"))
+			sum = append(sum, f.Sum("value"))
+			_, hasLag := f.Lag(1)
+			_, hasLead := f.Lead(1)
+			lags = append(lags, hasLag)
+			leads = append(leads, hasLead)
+		})
+	}))
+
+	assert.Equal(t, []float64{2, 2.5, 2, 2.5}, avg)
+	assert.Equal(t, []float64{2, 5, 4, 5}, sum)
+	assert.Equal(t, []bool{false, true, true, true}, lags)
+	assert.Equal(t, []bool{true, true, true, false}, leads)
+
+	// Min, max and the cursor
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		values := txn.Float64("value")
+		return txn.Window("byTime", 3).Range(func(f Frame) {
+			v, _ := values.Get()
+			min, _ := f.Min("value")
+			max, _ := f.Max("value")
+			assert.Equal(t, f.Rows()[len(f.Rows())-1], f.Index())
+			assert.LessOrEqual(t, min, v)
+			assert.GreaterOrEqual(t, max, v)
+
+			_, ok := f.Min("missing")
+			assert.False(t, ok)
+		})
+	}))
+
+	assert.Error(t, c.Query(func(txn *Txn) error {
+		return txn.Window("missing", 2).Range(func(f Frame) {})
+	}))
+}
+
+func TestWindowConcurrent(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("ts", ForString())
+	c.CreateColumn("value", ForFloat64())
+	c.CreateSortIndex("byTime", "ts")
+	for i := 0; i < 100; i++ {
+		c.Insert(func(r Row) error {
+			r.SetString("ts", fmt.Sprintf("t%03d", i))
+			return nil
+		})
+	}
+
+	// The writer sets all of the values at once, in a single commit
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for v := 1.0; ; v++ {
+			select {
+			case <-done:
+				return
+			default:
+				c.Query(func(txn *Txn) error {
+					values := txn.Float64("value")
+					return txn.Range(func(idx uint32) {
+						values.Set(v)
+					})
+				})
+			}
+		}
+	}()
+
+	// Each frame must observe the values of a single commit
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, c.Query(func(txn *Txn) error {
+			return txn.Window("byTime", 10).Range(func(f Frame) {
+				min, _ := f.Min("value")
+				max, _ := f.Max("value")
+				assert.Equal(t, min, max)
+			})
+		}))
+	}
+
+	close(done)
+	wg.Wait()
+
+	// A window can not be iterated while holding the read lock of a chunk
+	assert.Error(t, c.Query(func(txn *Txn) error {
+		var err error
+		txn.Range(func(idx uint32) {
+			err = txn.Window("byTime", 10).Range(func(f Frame) {})
+		})
+		return err
+	}))
+}
+
 func TestSortIndexLoad(t *testing.T) {
 
 	players := loadPlayers(500)
@@ -503,6 +787,176 @@ func TestUpdateBulkWithIndex(t *testing.T) {
 	})
 }
 
+func TestUpdateBulkParallel(t *testing.T) {
+	const amount = 50000
+	coll := NewCollection()
+	coll.CreateColumn("balance", ForFloat64())
+	coll.CreateColumn("name", ForString())
+	coll.CreateIndex("rich", "balance", func(r Reader) bool {
+		return r.Float() > 100
+	})
+
+	for i := 0; i < amount; i++ {
+		coll.Insert(func(r Row) error {
+			r.SetFloat64("balance", 1)
+			return nil
+		})
+	}
+
+	// Update every row, spanning multiple chunks
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		name := txn.String("name")
+		return txn.Range(func(idx uint32) {
+			balance.Set(float64(idx) + 1000)
+			name.Set(fmt.Sprintf("%d", idx))
+		})
+	}))
+
+	// Every row and the index must be updated
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		name := txn.String("name")
+		assert.Equal(t, amount, txn.With("rich").Count())
+		return txn.Range(func(idx uint32) {
+			v, _ := balance.Get()
+			s, _ := name.Get()
+			assert.Equal(t, float64(idx)+1000, v)
+			assert.Equal(t, fmt.Sprintf("%d", idx), s)
+		})
+	}))
+}
+
+func TestUpdateBulkParallelPublish(t *testing.T) {
+	const amount = 50000
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	logger := new(orderWriter)
+	coll := NewCollection(Options{Writer: logger})
+	coll.CreateColumn("balance", ForFloat64())
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		for i := 0; i < amount; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetFloat64("balance", 1)
+				return nil
+			})
+		}
+		return nil
+	}))
+
+	// Update every row, spanning multiple chunks
+	logger.chunks = logger.chunks[:0]
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		return txn.Range(func(idx uint32) {
+			balance.Set(float64(idx))
+		})
+	}))
+
+	// The chunks must be published one at a time, in order
+	assert.False(t, logger.overlap)
+	assert.Equal(t, []commit.Chunk{0, 1, 2, 3}, logger.chunks)
+}
+
+func TestInsertParallelSequence(t *testing.T) {
+	const amount = 100000
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	coll := NewCollection()
+	coll.CreateColumn("id", ForSequence())
+	coll.CreateColumn("balance", ForFloat64())
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		for i := 0; i < amount; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetFloat64("balance", 1)
+				return nil
+			})
+		}
+		return nil
+	}))
+
+	// Every row spanning the chunks must get a unique value of the sequence
+	unique := make(map[uint64]bool, amount)
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		id := txn.Uint64("id")
+		return txn.Range(func(idx uint32) {
+			v, ok := id.Get()
+			assert.True(t, ok)
+			unique[v] = true
+		})
+	}))
+	assert.Equal(t, amount, len(unique))
+	assert.False(t, unique[0])
+}
+
+func TestCommitParallelShared(t *testing.T) {
+	const amount = 100000
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	schema := func(c *Collection) error {
+		c.CreateColumn("id", ForSequence())
+		c.CreateColumn("balance", ForFloat64())
+		return nil
+	}
+
+	publisher := new(mockPublisher)
+	coll := NewCollection(Options{
+		Vacuum:  -1,
+		Storage: StorageOptions{Paranoid: true},
+		History: HistoryOptions{Horizon: time.Hour, Schema: schema},
+		Events:  EventOptions{Outbox: publisher, Audit: NewAuditLog(10)},
+	})
+	defer coll.Close()
+	schema(coll)
+
+	// Insert and then update the rows spanning the chunks, both of them in parallel
+	inserted, err := coll.QueryInfo(func(txn *Txn) error {
+		for i := 0; i < amount; i++ {
+			txn.Insert(func(r Row) error {
+				r.SetFloat64("balance", 1)
+				return nil
+			})
+		}
+		return txn.Enqueue("players", []byte("inserted"))
+	})
+	assert.NoError(t, err)
+
+	updated, err := coll.QueryInfo(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		return txn.Range(func(idx uint32) {
+			balance.Set(2)
+		})
+	})
+	assert.NoError(t, err)
+
+	// The checksums and the history must follow the commits
+	assert.NoError(t, coll.Verify())
+	assert.NoError(t, coll.ViewAt(inserted.Version, func(txn *Txn) error {
+		assert.Equal(t, amount, txn.Count())
+		assert.Equal(t, float64(amount), txn.Float64("balance").Sum())
+		return nil
+	}))
+	assert.NoError(t, coll.ViewAt(updated.Version, func(txn *Txn) error {
+		assert.Equal(t, float64(2*amount), txn.Float64("balance").Sum())
+		return nil
+	}))
+
+	// The message is delivered once, and every row has a unique value of the sequence
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, coll.DrainOutbox(ctx))
+	assert.Equal(t, []OutboxMessage{
+		{ID: 1, Topic: "players", Payload: []byte("inserted"), Version: inserted.Version},
+	}, publisher.Messages())
+
+	unique := make(map[uint64]bool, amount)
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		id := txn.Uint64("id")
+		return txn.Range(func(idx uint32) {
+			v, _ := id.Get()
+			unique[v] = true
+		})
+	}))
+	assert.Equal(t, amount, len(unique))
+}
+
 func TestIndexWithAtomicAdd(t *testing.T) {
 	players := loadPlayers(500)
 	players.CreateIndex("rich", "balance", func(r Reader) bool {
@@ -535,6 +989,78 @@ func TestIndexWithAtomicAdd(t *testing.T) {
 	})
 }
 
+func TestWithFloatNear(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("x", ForFloat64())
+	c.CreateIndex("third", "x", func(r Reader) bool {
+		return r.FloatNear(0.3, 1e-9)
+	})
+
+	for i := 0; i < 10; i++ {
+		c.Insert(func(r Row) error {
+			r.SetFloat64("x", 0)
+			return nil
+		})
+	}
+
+	// Accumulate the rounding errors, 0.1 + 0.1 + 0.1 is not exactly 0.3
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Query(func(txn *Txn) error {
+			x := txn.Float64("x")
+			return txn.Range(func(idx uint32) {
+				x.Merge(0.1)
+			})
+		}))
+	}
+
+	c.Query(func(txn *Txn) error {
+		assert.Equal(t, 0, txn.WithFloat("x", func(v float64) bool { return v == 0.3 }).Count())
+		return nil
+	})
+
+	c.Query(func(txn *Txn) error {
+		assert.Equal(t, 10, txn.WithFloatNear("x", 0.3, 1e-9).Count())
+		assert.Equal(t, 10, txn.With("third").Count())
+		assert.Equal(t, 0, txn.WithFloatNear("x", 0.3, 1e-18).Count())
+		assert.Equal(t, 0, txn.WithFloatNear("missing", 0.3, 1e-9).Count())
+		return nil
+	})
+
+	// The values read by a lookup can also be compared
+	reader, ok := lookupValue(&c.cols, "x", 0)
+	assert.True(t, ok)
+	assert.True(t, reader.FloatNear(0.3, 1e-9))
+	assert.False(t, isNear(math.NaN(), math.NaN(), 1))
+}
+
+func TestIndexCoalesce(t *testing.T) {
+	players := loadPlayers(500)
+
+	var calls int64
+	players.CreateIndex("rich", "balance", func(r Reader) bool {
+		atomic.AddInt64(&calls, 1)
+		return r.Float() >= 3000
+	})
+
+	// Add balance 30 times, the index should only be evaluated once per row
+	atomic.StoreInt64(&calls, 0)
+	players.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		for i := 0; i < 30; i++ {
+			txn.Range(func(index uint32) {
+				balance.Merge(100.0)
+			})
+		}
+		return nil
+	})
+
+	assert.Equal(t, int64(500), atomic.LoadInt64(&calls))
+	players.Query(func(txn *Txn) error {
+		assert.Equal(t, 500, txn.With("rich").Count())
+		return nil
+	})
+}
+
 func TestUpdateWithRollback(t *testing.T) {
 	players := loadPlayers(500)
 	players.CreateIndex("rich", "balance", func(r Reader) bool {
@@ -643,28 +1169,203 @@ func TestUninitializedSet(t *testing.T) {
 	}))
 }
 
-func TestUpdateAt(t *testing.T) {
-	c := NewCollection()
-	c.CreateColumn("col1", ForString())
-	index, err := c.Insert(func(r Row) error {
-		return r.SetMany(map[string]any{
-			"col1": "hello",
-		})
-	})
+func TestAutoNow(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("name", ForString())
+	coll.CreateColumn("created", ForInt64(WithAutoNow()))
+	coll.CreateColumn("updated", ForInt64(WithAutoUpdateNow()))
 
+	before := time.Now().UnixNano()
+	idx, err := coll.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	})
 	assert.NoError(t, err)
-	assert.NoError(t, c.QueryAt(index, func(r Row) error {
-		r.SetString("col1", "hi")
+
+	// Both columns must be stamped on insert
+	var created, updated int64
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		created, _ = r.Int64("created")
+		updated, _ = r.Int64("updated")
 		return nil
 	}))
-}
-
-func TestUpdateAtInvalid(t *testing.T) {
-	c := NewCollection()
-	c.CreateColumn("col1", ForString())
+	assert.GreaterOrEqual(t, created, before)
+	assert.Equal(t, created, updated)
 
-	assert.Panics(t, func() {
-		c.QueryAt(0, func(r Row) error {
+	// Only the update column must be stamped on update
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		r.SetString("name", "Merlin")
+		return nil
+	}))
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		v1, _ := r.Int64("created")
+		v2, _ := r.Int64("updated")
+		assert.Equal(t, created, v1)
+		assert.Greater(t, v2, updated)
+		return nil
+	}))
+
+	// Explicitly set values must be kept
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		r.SetInt64("updated", 42)
+		return nil
+	}))
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		v, _ := r.Int64("updated")
+		assert.Equal(t, int64(42), v)
+		return nil
+	}))
+}
+
+func TestReadOnly(t *testing.T) {
+	writer := make(commit.Channel, 10)
+	coll := NewCollection(Options{Writer: &writer})
+	coll.CreateColumn("name", ForString())
+	coll.CreateColumn("owner", ForString(WithReadOnly[string]()))
+	coll.CreateColumn("created", ForInt64(WithAutoNow(), WithReadOnly[int64]()))
+
+	// Read-only columns can be set on insert and are stamped automatically
+	idx, err := coll.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		r.SetString("owner", "system")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Updating a read-only column fails and rolls back the entire transaction
+	assert.Error(t, coll.QueryAt(idx, func(r Row) error {
+		r.SetString("name", "Merlin")
+		r.SetString("owner", "user")
+		return nil
+	}))
+	assert.Error(t, coll.QueryAt(idx, func(r Row) error {
+		r.SetInt64("created", 42)
+		return nil
+	}))
+
+	// Other columns can still be updated
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		r.SetString("name", "Merlin")
+		return nil
+	}))
+	assert.NoError(t, coll.QueryAt(idx, func(r Row) error {
+		name, _ := r.String("name")
+		owner, _ := r.String("owner")
+		created, _ := r.Int64("created")
+		assert.Equal(t, "Merlin", name)
+		assert.Equal(t, "system", owner)
+		assert.NotZero(t, created)
+		return nil
+	}))
+
+	// Replaying the commits on a replica bypasses the check
+	close(writer)
+	replica := NewCollection()
+	replica.CreateColumn("name", ForString())
+	replica.CreateColumn("owner", ForString(WithReadOnly[string]()))
+	replica.CreateColumn("created", ForInt64(WithAutoNow(), WithReadOnly[int64]()))
+	for change := range writer {
+		assert.NoError(t, replica.Replay(change))
+	}
+	assert.NoError(t, replica.QueryAt(idx, func(r Row) error {
+		owner, _ := r.String("owner")
+		assert.Equal(t, "system", owner)
+		return nil
+	}))
+}
+
+func TestLifecycle(t *testing.T) {
+	coll := NewCollection(Options{Storage: StorageOptions{Lifecycle: true}})
+	coll.CreateColumn("name", ForString())
+
+	before := time.Now()
+	idx0, _ := coll.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	})
+	idx1, _ := coll.Insert(func(r Row) error {
+		r.SetString("name", "Merlin")
+		return nil
+	})
+
+	var v0, v1 uint64
+	assert.NoError(t, coll.QueryAt(idx0, func(r Row) error {
+		createdAt, ok := r.CreatedAt()
+		assert.True(t, ok)
+		assert.False(t, createdAt.Before(before))
+		v0, ok = r.Version()
+		assert.True(t, ok)
+		return nil
+	}))
+
+	// Update the first row, its version must now be the ID of that commit
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		return txn.QueryAt(idx0, func(r Row) error {
+			r.SetString("name", "Arthur")
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, coll.QueryAt(idx1, func(r Row) error {
+		v1, _ = r.Version()
+		return nil
+	}))
+	assert.NoError(t, coll.QueryAt(idx0, func(r Row) error {
+		v, _ := r.Version()
+		assert.Equal(t, info.Version, v)
+		assert.Greater(t, v, v0)
+		assert.Greater(t, v, v1)
+		return nil
+	}))
+
+	// Lifecycle pseudo-columns can be filtered like regular columns
+	coll.Query(func(txn *Txn) error {
+		assert.Equal(t, 1, txn.WithUint("$version", func(v uint64) bool {
+			return v > v1
+		}).Count())
+		return nil
+	})
+
+	// Lifecycle pseudo-columns are reserved and can not be updated
+	assert.NoError(t, coll.CreateColumn("version", ForString()))
+	assert.Error(t, coll.CreateColumn("$version", ForString()))
+	assert.Error(t, coll.QueryAt(idx0, func(r Row) error {
+		r.SetUint64("$version", 1)
+		return nil
+	}))
+
+	// Without lifecycle tracking, the metadata is not available
+	_, err = NewCollection().Insert(func(r Row) error {
+		_, ok := r.Version()
+		assert.False(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestUpdateAt(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("col1", ForString())
+	index, err := c.Insert(func(r Row) error {
+		return r.SetMany(map[string]any{
+			"col1": "hello",
+		})
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, c.QueryAt(index, func(r Row) error {
+		r.SetString("col1", "hi")
+		return nil
+	}))
+}
+
+func TestUpdateAtInvalid(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("col1", ForString())
+
+	assert.Panics(t, func() {
+		c.QueryAt(0, func(r Row) error {
 			r.SetString("col2", "hi")
 			return nil
 		})
@@ -730,6 +1431,89 @@ func TestDeleteKey(t *testing.T) {
 	assert.Equal(t, 0, c.Count())
 }
 
+func TestInsertOrMerge(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("key", ForKey())
+	c.CreateColumn("name", ForString())
+	c.CreateColumn("balance", ForFloat64())
+	c.CreateColumn("visits", ForInt())
+	c.CreateColumn("owner", ForString(WithReadOnly[string]()))
+
+	// Sum the numbers and keep the current strings
+	merge := func(column string, current, incoming any) any {
+		switch v := current.(type) {
+		case int:
+			return v + incoming.(int)
+		case float64:
+			return v + incoming.(float64)
+		default:
+			return current
+		}
+	}
+
+	assert.NoError(t, c.InsertOrMerge("roman", map[string]any{
+		"key":     "ignored",
+		"name":    "Roman",
+		"balance": 10.0,
+		"visits":  1.0, // Converted, as if decoded from JSON
+		"owner":   "alice",
+		"unknown": true,
+	}, merge))
+
+	assert.NoError(t, c.InsertOrMerge("roman", map[string]any{
+		"name":    "Merlin",
+		"balance": 5.0,
+		"visits":  2,
+		"owner":   "bob",
+	}, merge))
+
+	assert.NoError(t, c.QueryKey("roman", func(r Row) error {
+		name, _ := r.String("name")
+		balance, _ := r.Float64("balance")
+		visits, _ := r.Int("visits")
+		owner, _ := r.String("owner")
+		assert.Equal(t, "Roman", name)
+		assert.Equal(t, 15.0, balance)
+		assert.Equal(t, 3, visits)
+		assert.Equal(t, "alice", owner)
+		return nil
+	}))
+
+	// Without a merge function, the incoming values are kept
+	assert.NoError(t, c.InsertOrMerge("roman", map[string]any{"name": "Merlin"}, nil))
+	assert.NoError(t, c.QueryKey("roman", func(r Row) error {
+		name, _ := r.String("name")
+		assert.Equal(t, "Merlin", name)
+		return nil
+	}))
+
+	assert.Equal(t, 1, c.Count())
+	assert.Error(t, NewCollection().InsertOrMerge("roman", nil, nil))
+}
+
+func TestDeleteKeys(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("key", ForKey())
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		for i := 0; i < 1000; i++ {
+			txn.InsertKey(strconv.Itoa(i), func(r Row) error { return nil })
+		}
+		return nil
+	}))
+
+	keys := make([]string, 0, 600)
+	for i := 500; i < 1100; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+
+	assert.Equal(t, 500, c.DeleteKeys(append(keys, "500")))
+	assert.Equal(t, 500, c.Count())
+	assert.Equal(t, 0, c.DeleteKeys(keys))
+	assert.NoError(t, c.QueryKey("499", func(r Row) error { return nil }))
+	assert.Error(t, c.QueryKey("500", func(r Row) error { return nil }))
+	assert.Equal(t, 0, NewCollection().DeleteKeys(keys))
+}
+
 func TestInsertKey(t *testing.T) {
 	c := NewCollection()
 	c.CreateColumn("key", ForKey())
@@ -1061,6 +1845,38 @@ func TestWithUnionPlayers(t *testing.T) {
 	})
 }
 
+func TestIndexesAt(t *testing.T) {
+	players := loadPlayers(500)
+	assert.NoError(t, players.CreateDerivedIndex("old-mage", And("old", "mage")))
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		return txn.Range(func(idx uint32) {
+			race, _ := txn.Enum("race").Get()
+			class, _ := txn.Enum("class").Get()
+			age, _ := txn.Int("age").Get()
+
+			expect := []string{race}
+			if class == "mage" {
+				expect = append(expect, "mage")
+			}
+			if age >= 30 {
+				expect = append(expect, "old")
+			}
+			if class == "mage" && age >= 30 {
+				expect = append(expect, "old-mage")
+			}
+
+			sort.Strings(expect)
+			assert.Equal(t, expect, txn.IndexesAt(idx))
+		})
+	}))
+
+	// A missing row belongs to no index
+	players.Query(func(txn *Txn) error {
+		assert.Empty(t, txn.IndexesAt(100000))
+		return nil
+	})
+}
+
 func TestSumBalance(t *testing.T) {
 	players := loadPlayers(500)
 	assert.Equal(t, 500, players.Count())
@@ -1133,6 +1949,298 @@ func TestMaxBalance(t *testing.T) {
 	})
 }
 
+func TestArgMinMax(t *testing.T) {
+	players := loadPlayers(500)
+	players.Query(func(txn *Txn) error {
+		min, _ := txn.Float64("balance").Min()
+		max, _ := txn.Float64("balance").Max()
+
+		// Typed accessors
+		idx, v, ok := txn.Float64("balance").ArgMax()
+		assert.True(t, ok)
+		assert.Equal(t, max, v)
+		assert.NoError(t, txn.QueryAt(idx, func(r Row) error {
+			balance, _ := r.Float64("balance")
+			assert.Equal(t, max, balance)
+			return nil
+		}))
+
+		_, v, ok = txn.Float64("balance").ArgMin()
+		assert.True(t, ok)
+		assert.Equal(t, min, v)
+
+		// Untyped accessors
+		_, v, ok = txn.MaxOf("balance")
+		assert.True(t, ok)
+		assert.Equal(t, max, v)
+
+		_, v, ok = txn.MinOf("balance")
+		assert.True(t, ok)
+		assert.Equal(t, min, v)
+		return nil
+	})
+
+	// Within a selection
+	players.Query(func(txn *Txn) error {
+		_, v, ok := txn.With("old", "mage", "human").MaxOf("balance")
+		assert.True(t, ok)
+		assert.Equal(t, float64(3978.83), v)
+		return nil
+	})
+
+	// Invalid column or empty selection
+	players.Query(func(txn *Txn) error {
+		_, _, ok := txn.MaxOf("name")
+		assert.False(t, ok)
+		_, _, ok = txn.MinOf("invalid")
+		assert.False(t, ok)
+		_, _, ok = txn.WithValue("race", func(v any) bool { return false }).MaxOf("balance")
+		assert.False(t, ok)
+		return nil
+	})
+}
+
+func TestPickWeighted(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("name", ForString())
+	coll.CreateColumn("weight", ForInt())
+	for _, w := range []int{0, 1, 3, -1} {
+		coll.Insert(func(r Row) error {
+			r.SetInt("weight", w)
+			return nil
+		})
+	}
+
+	// Row without a weight
+	coll.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		return nil
+	})
+
+	picks := make(map[uint32]int)
+	coll.Query(func(txn *Txn) error {
+		for i := 0; i < 4000; i++ {
+			idx, ok := txn.PickWeighted("weight")
+			assert.True(t, ok)
+			picks[idx]++
+		}
+		return nil
+	})
+
+	assert.Equal(t, 2, len(picks))
+	assert.InDelta(t, 3000, picks[2], 300)
+	assert.InDelta(t, 1000, picks[1], 300)
+
+	// Empty selection or invalid column
+	coll.Query(func(txn *Txn) error {
+		_, ok := txn.PickWeighted("name")
+		assert.False(t, ok)
+		_, ok = txn.WithValue("weight", func(v any) bool { return false }).PickWeighted("weight")
+		assert.False(t, ok)
+		return nil
+	})
+}
+
+func TestDownsample(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("ts", ForInt64())
+	c.CreateColumn("value", ForFloat64())
+	c.CreateColumn("name", ForString())
+	for _, v := range []struct {
+		ts    time.Duration
+		value float64
+	}{
+		{65 * time.Second, 2}, {5 * time.Second, 1}, {10 * time.Second, 3},
+		{130 * time.Second, 7}, {61 * time.Second, 4}, {-5 * time.Second, 5},
+	} {
+		c.Insert(func(r Row) error {
+			r.SetInt64("ts", int64(v.ts))
+			r.SetFloat64("value", v.value)
+			return nil
+		})
+	}
+
+	c.Query(func(txn *Txn) error {
+		series, err := txn.Downsample("ts", "value", int64(time.Minute), AggAvg)
+		assert.NoError(t, err)
+		assert.Equal(t, []Sample{
+			{Time: int64(-time.Minute), Value: 5, Count: 1},
+			{Time: 0, Value: 2, Count: 2},
+			{Time: int64(time.Minute), Value: 3, Count: 2},
+			{Time: int64(2 * time.Minute), Value: 7, Count: 1},
+		}, series)
+
+		for agg, expect := range map[Aggregation]float64{
+			AggCount: 2, AggSum: 6, AggMin: 2, AggMax: 4, AggFirst: 4, AggLast: 2,
+		} {
+			series, err := txn.Downsample("ts", "value", int64(time.Minute), agg)
+			assert.NoError(t, err)
+			assert.Equal(t, expect, series[2].Value)
+		}
+
+		// Invalid arguments
+		_, err = txn.Downsample("ts", "value", 0, AggAvg)
+		assert.Error(t, err)
+		_, err = txn.Downsample("missing", "value", 1, AggAvg)
+		assert.Error(t, err)
+		_, err = txn.Downsample("ts", "name", 1, AggAvg)
+		assert.Error(t, err)
+		return nil
+	})
+}
+
+func TestPivot(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("race", ForEnum())
+	c.CreateColumn("class", ForEnum())
+	c.CreateColumn("balance", ForFloat64())
+	for _, v := range []struct {
+		race, class string
+		balance     float64
+	}{
+		{"human", "mage", 10}, {"human", "mage", 20}, {"human", "rogue", 5},
+		{"elf", "mage", 7}, {"elf", "warrior", 1},
+	} {
+		c.Insert(func(r Row) error {
+			r.SetEnum("race", v.race)
+			r.SetEnum("class", v.class)
+			r.SetFloat64("balance", v.balance)
+			return nil
+		})
+	}
+
+	c.Query(func(txn *Txn) error {
+		table, err := txn.Pivot("race", "class", "balance", AggAvg)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"elf", "human"}, table.Rows)
+		assert.Equal(t, []string{"mage", "rogue", "warrior"}, table.Columns)
+		assert.Equal(t, [][]float64{{7, 0, 1}, {15, 5, 0}}, table.Values)
+		assert.Equal(t, [][]int{{1, 0, 1}, {2, 1, 0}}, table.Counts)
+
+		v, ok := table.Value("human", "mage")
+		assert.True(t, ok)
+		assert.Equal(t, 15.0, v)
+		_, ok = table.Value("human", "warrior")
+		assert.False(t, ok)
+		_, ok = table.Value("dwarf", "mage")
+		assert.False(t, ok)
+
+		// Invalid arguments
+		_, err = txn.Pivot("missing", "class", "balance", AggSum)
+		assert.Error(t, err)
+		_, err = txn.Pivot("race", "missing", "balance", AggSum)
+		assert.Error(t, err)
+		_, err = txn.Pivot("race", "class", "class", AggSum)
+		assert.Error(t, err)
+		return nil
+	})
+
+	// Within a selection
+	c.Query(func(txn *Txn) error {
+		table, err := txn.WithValue("race", func(v any) bool {
+			return v == "elf"
+		}).Pivot("race", "class", "balance", AggLast)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]float64{{7, 1}}, table.Values)
+		return nil
+	})
+}
+
+func TestAggregateMany(t *testing.T) {
+	players := loadPlayers(500)
+	players.Query(func(txn *Txn) error {
+		txn = txn.With("human", "mage")
+		values, err := txn.Aggregate(Count("balance"), Sum("balance"), Avg("age"), Min("age"), Max("balance"))
+		assert.NoError(t, err)
+		assert.Len(t, values, 5)
+
+		maxBalance, _ := txn.Float64("balance").Max()
+		minAge, _ := txn.Int("age").Min()
+		assert.Equal(t, float64(txn.Count()), values[0])
+		assert.InDelta(t, txn.Float64("balance").Sum(), values[1], 1e-6)
+		assert.InDelta(t, txn.Int("age").Avg(), values[2], 1e-6)
+		assert.Equal(t, float64(minAge), values[3])
+		assert.Equal(t, maxBalance, values[4])
+
+		// Invalid arguments
+		_, err = txn.Aggregate(Sum("missing"))
+		assert.Error(t, err)
+		_, err = txn.Aggregate(Sum("race"))
+		assert.Error(t, err)
+		return nil
+	})
+
+	// Empty selection
+	players.Query(func(txn *Txn) error {
+		values, err := txn.WithValue("race", func(v any) bool {
+			return false
+		}).Aggregate(Count("balance"), Avg("balance"))
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{0, 0}, values)
+		return nil
+	})
+}
+
+func TestAggregateWhere(t *testing.T) {
+	players := loadPlayers(500)
+	players.Query(func(txn *Txn) error {
+		values, err := txn.With("human").Aggregate(
+			Sum("balance"),
+			SumWhere("balance", With("active")),
+			CountWhere("balance", With("active", "mage")),
+			MaxWhere("age", Or("mage", Not("active"))),
+			AvgWhere("age", Not("active")),
+			MinWhere("age", With("active")),
+		)
+		assert.NoError(t, err)
+
+		// Compute the expected values, one selection at a time
+		var expect []float64
+		players.Query(func(txn *Txn) error {
+			expect = append(expect, txn.With("human").Float64("balance").Sum())
+			expect = append(expect, txn.With("human", "active").Float64("balance").Sum())
+			return nil
+		})
+		players.Query(func(txn *Txn) error {
+			expect = append(expect, float64(txn.With("human", "active", "mage").Count()))
+			return nil
+		})
+		var mages, inactive int
+		players.Query(func(txn *Txn) error {
+			mages, _ = txn.With("human", "mage").Int("age").Max()
+			return nil
+		})
+		players.Query(func(txn *Txn) error {
+			inactive, _ = txn.With("human").Without("active").Int("age").Max()
+			expect = append(expect, math.Max(float64(mages), float64(inactive)))
+			return nil
+		})
+		players.Query(func(txn *Txn) error {
+			expect = append(expect, txn.With("human").Without("active").Int("age").Avg())
+			return nil
+		})
+		players.Query(func(txn *Txn) error {
+			min, _ := txn.With("human", "active").Int("age").Min()
+			expect = append(expect, float64(min))
+			return nil
+		})
+
+		assert.InDeltaSlice(t, expect, values, 1e-6)
+
+		// Invalid filters
+		_, err = txn.Aggregate(SumWhere("balance", With("missing")))
+		assert.Error(t, err)
+		_, err = txn.Aggregate(SumWhere("balance", Or()))
+		assert.Error(t, err)
+		_, err = txn.Aggregate(SumWhere("balance", And(1)))
+		assert.Error(t, err)
+		return nil
+	})
+
+	// Filtered aggregates can not be maintained incrementally
+	assert.Error(t, players.RegisterAggregate("active_balance", SumWhere("balance", With("active"))))
+}
+
 func TestSetManyErr(t *testing.T) {
 	players := loadPlayers(500)
 	t.Run("invalid", func(t *testing.T) {
@@ -1153,3 +2261,286 @@ func TestSetManyErr(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestFlush(t *testing.T) {
+	coll := NewCollection()
+	coll.CreateColumn("balance", ForFloat64())
+	for i := 0; i < 100; i++ {
+		coll.Insert(func(r Row) error {
+			r.SetFloat64("balance", 10)
+			return nil
+		})
+	}
+
+	// The flushed changes are visible to the subsequent reads, and kept on rollback
+	assert.Error(t, coll.Query(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		txn.Range(func(idx uint32) {
+			balance.Merge(5)
+		})
+
+		assert.Equal(t, float64(1000), balance.Sum())
+		assert.NoError(t, txn.Flush())
+		assert.Equal(t, float64(1500), balance.Sum())
+
+		txn.Range(func(idx uint32) {
+			balance.Set(0)
+		})
+		return fmt.Errorf("rollback")
+	}))
+
+	assert.NoError(t, coll.QueryAt(42, func(r Row) error {
+		balance, _ := r.Float64("balance")
+		assert.Equal(t, float64(15), balance)
+		return nil
+	}))
+
+	// Can not be flushed while holding read locks
+	assert.NoError(t, coll.Query(func(txn *Txn) error {
+		txn.Range(func(idx uint32) {
+			assert.Error(t, txn.Flush())
+		})
+		return txn.QueryAt(0, func(r Row) error {
+			assert.Error(t, txn.Flush())
+			return nil
+		})
+	}))
+	assert.NoError(t, coll.QueryWith(ReadSnapshot, func(txn *Txn) error {
+		assert.Error(t, txn.Flush())
+		return nil
+	}))
+}
+
+func TestFlushIsolation(t *testing.T) {
+	writer := make(commit.Channel, 10)
+	coll := NewCollection(Options{Writer: writer})
+	coll.CreateColumn("balance", ForFloat64())
+	coll.Insert(func(r Row) error {
+		r.SetFloat64("balance", 10)
+		return nil
+	})
+	<-writer
+
+	// The flushed changes are only observed by the transaction itself
+	read := make(chan float64)
+	info, err := coll.QueryInfo(func(txn *Txn) error {
+		balance := txn.Float64("balance")
+		txn.Range(func(idx uint32) {
+			balance.Merge(5)
+		})
+
+		assert.NoError(t, txn.Flush())
+		assert.Equal(t, float64(15), balance.Sum())
+		assert.Empty(t, writer)
+
+		go coll.Query(func(txn *Txn) error {
+			read <- txn.Float64("balance").Sum()
+			return nil
+		})
+
+		select {
+		case <-read:
+			assert.Fail(t, "the flushed changes must not be observed")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		txn.Range(func(idx uint32) {
+			balance.Merge(balance.Sum())
+		})
+		return nil
+	})
+
+	// The commits are published once the transaction completes, in order
+	assert.NoError(t, err)
+	assert.Equal(t, float64(30), <-read)
+	assert.Equal(t, 2, info.Updated)
+	assert.Len(t, writer, 2)
+
+	first, second := <-writer, <-writer
+	assert.Equal(t, info.Version, second.ID)
+	assert.Less(t, first.ID, second.ID)
+}
+
+func TestHint(t *testing.T) {
+	players := loadPlayers(5000)
+	count := func(hints ...Hint) (n int) {
+		players.Query(func(txn *Txn) error {
+			n = txn.Hint(hints...).WithExpr("age >= 40 && race == 'human'").Count()
+			return nil
+		})
+		return
+	}
+
+	// Since every matching row is old, the index does not change the result
+	expect := count()
+	assert.NotZero(t, expect)
+	assert.Equal(t, expect, count(UseIndex("old")))
+	assert.Equal(t, expect, count(UseIndex("old", "missing", "age")))
+
+	// The filter is only evaluated on the rows of the index
+	assert.Zero(t, count(UseIndex("dwarf")))
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		assert.Zero(t, txn.Hint(UseIndex("elf")).WithFilter(F("race").Eq("human")).Count())
+		return nil
+	}))
+
+	// The hints do not outlive the transaction
+	assert.Equal(t, expect, count())
+
+	// The changes are committed sequentially
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		balance := txn.Hint(NoParallel()).Float64("balance")
+		return txn.Range(func(idx uint32) {
+			balance.Set(10)
+		})
+	}))
+	assert.NoError(t, players.Query(func(txn *Txn) error {
+		assert.Equal(t, float64(50000), txn.Float64("balance").Sum())
+		return nil
+	}))
+}
+
+func TestMask(t *testing.T) {
+	redact := func(v any) any {
+		return "***"
+	}
+
+	players := NewCollection(Options{Query: QueryOptions{UnmaskToken: "secret"}})
+	players.CreateColumn("name", ForString(WithMask[string](redact)))
+	players.CreateColumn("class", ForString())
+	players.CreateColumn("age", ForInt(WithMask[int](func(v any) any {
+		return v.(int) / 10 * 10
+	})))
+	players.Insert(func(r Row) error {
+		r.SetString("name", "Roman")
+		r.SetString("class", "mage")
+		r.SetInt("age", 37)
+		return nil
+	})
+
+	read := func(hints ...Hint) (name, age any) {
+		players.QueryAt(0, func(r Row) error {
+			r.txn.Hint(hints...)
+			name, _ = r.Any("name")
+			age, _ = r.Any("age")
+			return nil
+		})
+		return
+	}
+
+	// The values are masked, unless the token is correct
+	name, age := read()
+	assert.Equal(t, "***", name)
+	assert.Equal(t, 30, age)
+	name, age = read(Unmask("wrong"))
+	assert.Equal(t, "***", name)
+	name, age = read(Unmask("secret"))
+	assert.Equal(t, "Roman", name)
+	assert.Equal(t, 37, age)
+
+	// The typed accessors and the aggregates observe the masked values
+	players.QueryAt(0, func(r Row) error {
+		name, _ := r.String("name")
+		assert.Equal(t, "***", name)
+		age, _ := r.Int("age")
+		assert.Equal(t, 30, age)
+		age, _ = r.txn.Int("age").Get()
+		assert.Equal(t, 30, age)
+		return nil
+	})
+	players.Query(func(txn *Txn) error {
+		assert.Equal(t, 30, txn.Int("age").Sum())
+		max, _ := txn.Int("age").Max()
+		assert.Equal(t, 30, max)
+		_, min, _ := txn.MinOf("age")
+		assert.Equal(t, float64(30), min)
+		return nil
+	})
+	players.QueryAt(0, func(r Row) error {
+		r.txn.Hint(Unmask("secret"))
+		name, _ := r.String("name")
+		assert.Equal(t, "Roman", name)
+		return nil
+	})
+
+	// The filters and the pivot tables observe the masked values
+	count := func(hint Hint, fn func(txn *Txn) *Txn) (n int) {
+		players.Query(func(txn *Txn) error {
+			txn.Hint(hint)
+			n = fn(txn).Count()
+			return nil
+		})
+		return
+	}
+
+	players.Query(func(txn *Txn) error {
+		pivot, err := txn.Pivot("name", "class", "age", AggCount)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"***"}, pivot.Rows)
+		assert.Equal(t, 0, txn.WithValue("name", func(v any) bool {
+			return v == "Roman"
+		}).Count())
+		return nil
+	})
+
+	for _, tc := range []struct {
+		filter func(txn *Txn) *Txn
+		masked int
+	}{
+		{func(txn *Txn) *Txn { return txn.WithString("name", func(v string) bool { return v == "Roman" }) }, 0},
+		{func(txn *Txn) *Txn { return txn.WithString("name", func(v string) bool { return v == "***" }) }, 1},
+		{func(txn *Txn) *Txn { return txn.WithInt("age", func(v int64) bool { return v == 37 }) }, 0},
+		{func(txn *Txn) *Txn { return txn.WithFloat("age", func(v float64) bool { return v > 35 }) }, 0},
+		{func(txn *Txn) *Txn { return txn.WithUint("age", func(v uint64) bool { return v == 30 }) }, 1},
+		{func(txn *Txn) *Txn { return txn.WithExpr("age > 35") }, 0},
+		{func(txn *Txn) *Txn { return txn.WithExpr("name == 'Roman'") }, 0},
+		{func(txn *Txn) *Txn { return txn.WithFilter(F("age").Eq(37)) }, 0},
+	} {
+		assert.Equal(t, tc.masked, count(Unmask("wrong"), tc.filter))
+		assert.Equal(t, 1-tc.masked, count(Unmask("secret"), tc.filter))
+	}
+}
+
+func TestWithinLatency(t *testing.T) {
+	players := loadPlayers(5000)
+	count := func() (n int, rate float64, approximate bool) {
+		players.Query(func(txn *Txn) error {
+			txn.Hint(WithinLatency(100 * time.Millisecond))
+			n = txn.With("human").Count()
+			rate = txn.SampleRate()
+			approximate = txn.IsApproximate()
+			return nil
+		})
+		return
+	}
+
+	// The queries meeting the target are exact
+	exact, rate, approximate := count()
+	assert.Equal(t, 1.0, rate)
+	assert.False(t, approximate)
+	assert.NotZero(t, players.latency.estimate)
+
+	// Once the queries exceed the target, they are sampled
+	players.latency.estimate = int64(time.Second)
+	n, rate, approximate := count()
+	assert.True(t, approximate)
+	assert.Equal(t, 0.1, rate)
+	assert.Less(t, n, exact)
+	assert.InDelta(t, exact, float64(n)/rate, float64(exact)/4)
+
+	// The estimate converges back as the sampled queries are fast
+	for i := 0; i < 50; i++ {
+		count()
+	}
+	_, _, approximate = count()
+	assert.False(t, approximate)
+
+	// A sampled transaction can not change the collection
+	players.latency.estimate = int64(time.Second)
+	assert.Error(t, players.Query(func(txn *Txn) error {
+		txn.Hint(WithinLatency(time.Millisecond))
+		return txn.Range(func(idx uint32) {
+			txn.Int("age").Set(1)
+		})
+	}))
+}
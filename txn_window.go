@@ -0,0 +1,175 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import "errors"
+
+var errWindowLocked = errors.New("column: unable to range over a window while holding read locks")
+
+// --------------------------- Window ----------------------------
+
+// Window represents a sliding window over the rows of a transaction, ordered by a sorted
+// index. It allows computing rolling aggregates such as moving averages, as well as
+// accessing the preceding (lag) and following (lead) rows.
+type Window struct {
+	txn   *Txn   // The owning transaction
+	order string // The name of the sorted index
+	size  int    // The number of rows in the window
+}
+
+// Window creates a sliding window of the specified number of rows over the current selection,
+// ordered by the specified sorted index.
+func (txn *Txn) Window(sortIndexName string, size int) *Window {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Window{
+		txn:   txn,
+		order: sortIndexName,
+		size:  size,
+	}
+}
+
+// Range iterates over the rows of the selection in the order of the sorted index. For each
+// row, the cursor is moved to the row and the callback receives the frame of the window
+// which ends at that row. Since a frame spans several rows, the read locks of all chunks
+// are held while iterating, so the frames observe a single state of the collection and the
+// writers wait until the iteration completes. Hence, it must not be called within Range().
+func (w *Window) Range(fn func(frame Frame)) error {
+	if !w.txn.stable && !w.txn.exclusive {
+		if len(w.txn.held) > 0 {
+			return errWindowLocked
+		}
+
+		w.txn.lockStable()
+		defer w.txn.unlockStable()
+	}
+
+	rows := make([]uint32, 0, 64)
+	if err := w.txn.Ascend(w.order, func(idx uint32) {
+		rows = append(rows, idx)
+	}); err != nil {
+		return err
+	}
+
+	for i, idx := range rows {
+		from := i - w.size + 1
+		if from < 0 {
+			from = 0
+		}
+
+		w.txn.cursor = idx
+		fn(Frame{
+			txn:  w.txn,
+			rows: rows,
+			at:   i,
+			from: from,
+		})
+	}
+	return nil
+}
+
+// --------------------------- Frame ----------------------------
+
+// Frame represents the rows of a window ending at the current row.
+type Frame struct {
+	txn  *Txn     // The owning transaction
+	rows []uint32 // The ordered rows of the selection
+	at   int      // The position of the current row
+	from int      // The position of the first row of the frame
+}
+
+// Index returns the index of the current row.
+func (f Frame) Index() uint32 {
+	return f.rows[f.at]
+}
+
+// Rows returns the indexes of the rows in the frame, from the oldest to the current one.
+// The returned slice must not be modified.
+func (f Frame) Rows() []uint32 {
+	return f.rows[f.from : f.at+1]
+}
+
+// Lag returns the index of the row which precedes the current row by the specified offset
+// in the order of the window, if present.
+func (f Frame) Lag(offset int) (uint32, bool) {
+	return f.rowAt(f.at - offset)
+}
+
+// Lead returns the index of the row which follows the current row by the specified offset
+// in the order of the window, if present.
+func (f Frame) Lead(offset int) (uint32, bool) {
+	return f.rowAt(f.at + offset)
+}
+
+// rowAt returns the row at a specific position
+func (f Frame) rowAt(at int) (uint32, bool) {
+	if at < 0 || at >= len(f.rows) {
+		return 0, false
+	}
+	return f.rows[at], true
+}
+
+// Sum computes a sum of the numeric column values within the frame.
+func (f Frame) Sum(columnName string) (sum float64) {
+	f.rangeNumbers(columnName, func(v float64) {
+		sum += v
+	})
+	return
+}
+
+// Avg computes an arithmetic mean of the numeric column values within the frame, also
+// known as a moving average.
+func (f Frame) Avg(columnName string) float64 {
+	sum, count := 0.0, 0
+	f.rangeNumbers(columnName, func(v float64) {
+		sum += v
+		count++
+	})
+
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// Min finds the smallest numeric column value within the frame.
+func (f Frame) Min(columnName string) (min float64, ok bool) {
+	f.rangeNumbers(columnName, func(v float64) {
+		if !ok || v < min {
+			min, ok = v, true
+		}
+	})
+	return
+}
+
+// Max finds the largest numeric column value within the frame.
+func (f Frame) Max(columnName string) (max float64, ok bool) {
+	f.rangeNumbers(columnName, func(v float64) {
+		if !ok || v > max {
+			max, ok = v, true
+		}
+	})
+	return
+}
+
+// rangeNumbers iterates over the numeric values of the rows within the frame
+func (f Frame) rangeNumbers(columnName string, fn func(v float64)) {
+	column, ok := f.txn.columnAt(columnName)
+	if !ok {
+		return
+	}
+
+	numeric, ok := column.Column.(Numeric)
+	if !ok {
+		return
+	}
+
+	for _, idx := range f.Rows() {
+		if v, ok := numeric.LoadFloat64(idx); ok {
+			fn(v)
+		}
+	}
+}
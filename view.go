@@ -0,0 +1,114 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/kelindar/bitmap"
+	"github.com/kelindar/column/commit"
+)
+
+// ColumnView represents a read-only view over the raw values of a float64 column. The values
+// are stored in chunks of 16K rows, so the value of a row is found at Chunks[idx>>14][idx&0x3fff],
+// while the values of the rows which are not set in the corresponding fill list are undefined.
+type ColumnView struct {
+	Chunks [][]float64     // The raw values of each chunk
+	Fill   []bitmap.Bitmap // The rows of each chunk which have a value
+}
+
+// ColumnData returns a view over the raw values of a float64 column without copying them, so
+// that they can be passed to the numeric libraries or vectorized kernels, along with the
+// function which releases it. The view holds the read locks of all of the chunks until it is
+// released, so the commits are blocked in the meantime and the slices must not be modified or
+// retained afterwards. A transaction must not be committed while the view is held.
+func (c *Collection) ColumnData(columnName string) (ColumnView, func(), error) {
+	column, ok := c.cols.Load(columnName)
+	if !ok {
+		return ColumnView{}, nil, fmt.Errorf("column: column '%s' does not exist", columnName)
+	}
+
+	values, ok := column.Column.(*numericColumn[float64])
+	if !ok {
+		return ColumnView{}, nil, fmt.Errorf("column: column '%s' is not a float64 column", columnName)
+	}
+
+	for shard := uint(0); shard < lockShards; shard++ {
+		c.slock.RLock(shard)
+	}
+
+	// Collect the chunks, the column may be growing concurrently
+	column.lock.RLock()
+	view := ColumnView{
+		Chunks: make([][]float64, 0, len(values.chunks)),
+		Fill:   make([]bitmap.Bitmap, 0, len(values.chunks)),
+	}
+	for _, chunk := range values.chunks {
+		view.Chunks = append(view.Chunks, chunk.data)
+		view.Fill = append(view.Fill, chunk.fill)
+	}
+	column.lock.RUnlock()
+
+	var once sync.Once
+	return view, func() {
+		once.Do(func() {
+			for shard := uint(0); shard < lockShards; shard++ {
+				c.slock.RUnlock(shard)
+			}
+		})
+	}, nil
+}
+
+// Transform applies a vectorized transformation to the values of a float64 column, for the
+// rows selected by the transaction which have a value. The function is called for each chunk
+// of 16K rows with a slice of the values of these rows, in the order of the rows, and it can
+// modify them in place. The values which were modified are then written into the transaction,
+// so that they are committed atomically along with it and update the indexes of the column.
+// The function is called while holding the read lock of the chunk.
+func (txn *Txn) Transform(columnName string, fn func(chunk []float64)) error {
+	column, ok := txn.columnAt(columnName)
+	if !ok {
+		return fmt.Errorf("column: column '%s' does not exist", columnName)
+	}
+
+	source, ok := column.Column.(*numericColumn[float64])
+	if !ok {
+		return fmt.Errorf("column: column '%s' is not a float64 column", columnName)
+	}
+
+	writer := txn.bufferFor(columnName)
+	values := make([]float64, 0, chunkSize)
+	selected := make(bitmap.Bitmap, 0, chunkSize/64)
+	txn.initialize()
+	txn.rangeRead(func(chunk commit.Chunk, index bitmap.Bitmap) {
+		if int(chunk) >= len(source.chunks) {
+			return
+		}
+
+		// Gather the values of the selected rows
+		fill, data := source.chunkAt(chunk)
+		index.Clone(&selected)
+		selected.And(fill)
+		values = values[:0]
+		selected.Range(func(x uint32) {
+			values = append(values, data[x])
+		})
+		if len(values) == 0 {
+			return
+		}
+
+		// Transform the values and write the ones which have changed
+		fn(values)
+		offset, i := chunk.Min(), 0
+		selected.Range(func(x uint32) {
+			if math.Float64bits(values[i]) != math.Float64bits(data[x]) {
+				source.write(writer, offset+x, values[i])
+			}
+			i++
+		})
+	})
+	return nil
+}
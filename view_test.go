@@ -0,0 +1,79 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package column
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnData(t *testing.T) {
+	players := loadPlayers(500)
+	defer players.Close()
+
+	_, _, err := players.ColumnData("invalid")
+	assert.Error(t, err)
+	_, _, err = players.ColumnData("name")
+	assert.Error(t, err)
+
+	// The view contains the same values as the column
+	var expect float64
+	players.Query(func(txn *Txn) error {
+		expect = txn.Float64("balance").Sum()
+		return nil
+	})
+
+	assert.True(t, players.DeleteAt(0))
+	view, release, err := players.ColumnData("balance")
+	assert.NoError(t, err)
+	assert.Len(t, view.Chunks, 1)
+
+	var actual float64
+	view.Fill[0].Range(func(idx uint32) {
+		actual += view.Chunks[0][idx]
+	})
+	release()
+	release()
+
+	assert.Less(t, actual, expect)
+	assert.InDelta(t, expect-actual, view.Chunks[0][0], 0.001)
+
+	// The commits can proceed once released
+	assert.True(t, players.DeleteAt(1))
+}
+
+func TestTransform(t *testing.T) {
+	c := NewCollection()
+	c.CreateColumn("name", ForString())
+	c.CreateColumn("balance", ForFloat64())
+	c.CreateIndex("rich", "balance", func(r Reader) bool {
+		return r.Float() >= 10000
+	})
+
+	for i := 0; i < 20000; i++ {
+		c.Insert(func(r Row) error {
+			r.SetFloat64("balance", float64(i))
+			return nil
+		})
+	}
+
+	// Double the balance of every player, the index is updated once committed
+	assert.NoError(t, c.Query(func(txn *Txn) error {
+		assert.Error(t, txn.Transform("invalid", nil))
+		assert.Error(t, txn.Transform("name", nil))
+		return txn.Transform("balance", func(chunk []float64) {
+			assert.LessOrEqual(t, len(chunk), 16384)
+			for i := range chunk {
+				chunk[i] *= 2
+			}
+		})
+	}))
+
+	c.Query(func(txn *Txn) error {
+		assert.Equal(t, float64(2*19999*20000/2), txn.Float64("balance").Sum())
+		assert.Equal(t, 15000, txn.With("rich").Count())
+		return nil
+	})
+}